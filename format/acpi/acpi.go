@@ -0,0 +1,318 @@
+package acpi
+
+// https://uefi.org/specs/ACPI/6.5/05_ACPI_Software_Programming_Model.html
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed acpi.md
+var acpiFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.ACPI,
+		&decode.Format{
+			Description: "Advanced Configuration and Power Interface table",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeACPI,
+		})
+	interp.RegisterFS(acpiFS)
+}
+
+const sdtHeaderLen = 36
+
+var signatureNames = scalar.StrMapDescription{
+	"APIC": "Multiple APIC Description Table",
+	"BERT": "Boot Error Record Table",
+	"BGRT": "Boot Graphics Resource Table",
+	"DBG2": "Debug Port Table 2",
+	"DMAR": "DMA Remapping Table",
+	"DSDT": "Differentiated System Description Table",
+	"ECDT": "Embedded Controller Boot Resources Table",
+	"EINJ": "Error Injection Table",
+	"ERST": "Error Record Serialization Table",
+	"FACP": "Fixed ACPI Description Table",
+	"FACS": "Firmware ACPI Control Structure",
+	"FPDT": "Firmware Performance Data Table",
+	"GTDT": "Generic Timer Description Table",
+	"HEST": "Hardware Error Source Table",
+	"HMAT": "Heterogeneous Memory Attribute Table",
+	"HPET": "High Precision Event Timer Table",
+	"IVRS": "I/O Virtualization Reporting Structure",
+	"LPIT": "Low Power Idle Table",
+	"MCFG": "PCI Express Memory Mapped Configuration Table",
+	"MSDM": "Microsoft Data Management Table",
+	"NFIT": "NVDIMM Firmware Interface Table",
+	"PPTT": "Processor Properties Topology Table",
+	"RSDT": "Root System Description Table",
+	"SLIT": "System Locality Distance Information Table",
+	"SPCR": "Serial Port Console Redirection Table",
+	"SRAT": "System Resource Affinity Table",
+	"SSDT": "Secondary System Description Table",
+	"TPM2": "Trusted Platform Module 2 Table",
+	"WAET": "Windows ACPI Emulated Devices Table",
+	"WSMT": "Windows SMM Security Mitigations Table",
+	"XSDT": "Extended System Description Table",
+}
+
+var preferredPMProfileNames = scalar.UintMapSymStr{
+	0: "unspecified",
+	1: "desktop",
+	2: "mobile",
+	3: "workstation",
+	4: "enterprise_server",
+	5: "soho_server",
+	6: "appliance_pc",
+	7: "performance_server",
+	8: "tablet",
+}
+
+var addressSpaceNames = scalar.UintMapSymStr{
+	0x00: "system_memory",
+	0x01: "system_io",
+	0x02: "pci_configuration",
+	0x03: "embedded_controller",
+	0x04: "smbus",
+	0x05: "system_cmos",
+	0x06: "pci_bar_target",
+	0x07: "ipmi",
+	0x08: "gpio",
+	0x09: "generic_serial_bus",
+	0x0a: "pcc",
+	0x0b: "prm",
+	0x7f: "functional_fixed_hardware",
+}
+
+var accessSizeNames = scalar.UintMapSymStr{
+	0: "undefined",
+	1: "byte",
+	2: "word",
+	3: "dword",
+	4: "qword",
+}
+
+func peekTableLength(d *decode.D) int64 {
+	return int64(binary.LittleEndian.Uint32(d.PeekBytes(8)[4:]))
+}
+
+// checksum byte that makes all bytes sum to zero
+func checksum(bs []byte, checksumIndex int) uint64 {
+	var sum byte
+	for i, b := range bs {
+		if i != checksumIndex {
+			sum += b
+		}
+	}
+	return uint64(-sum)
+}
+
+// checksum field that is also recorded as a constraint so it shows up in validate
+func fieldChecksum(d *decode.D, name string, bs []byte, checksumIndex int) {
+	expected := checksum(bs, checksumIndex)
+	actual := d.FieldU8(name, d.UintValidate(expected), scalar.UintHex)
+	d.Constraint(actual == expected, "%s 0x%x == 0x%x", name, actual, expected)
+}
+
+func decodeGenericAddress(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU8("address_space_id", addressSpaceNames)
+		d.FieldU8("register_bit_width")
+		d.FieldU8("register_bit_offset")
+		d.FieldU8("access_size", accessSizeNames)
+		d.FieldU64("address", scalar.UintHex)
+	})
+}
+
+func decodeRSDP(d *decode.D) {
+	bs := d.PeekBytes(int(min(d.BitsLeft()/8, 36)))
+	d.FieldUTF8("signature", 8, d.StrAssert("RSD PTR "))
+	if len(bs) < 20 {
+		d.Fatalf("RSDP too short %d < 20", len(bs))
+	}
+	fieldChecksum(d, "checksum", bs[0:20], 8)
+	d.FieldUTF8("oem_id", 6)
+	revision := d.FieldU8("revision")
+	d.FieldU32("rsdt_address", scalar.UintHex)
+	// revision 0 is ACPI 1.0 with only the first 20 bytes
+	if revision >= 2 {
+		length := d.FieldU32("length")
+		if length != 36 || len(bs) < 36 {
+			d.Fatalf("invalid RSDP length %d", length)
+		}
+		d.FieldU64("xsdt_address", scalar.UintHex)
+		fieldChecksum(d, "extended_checksum", bs[0:36], 32)
+		d.FieldRawLen("reserved", 3*8)
+	}
+}
+
+func decodeFACS(d *decode.D) {
+	d.FieldUTF8("signature", 4, d.StrAssert("FACS"))
+	d.FieldU32("length")
+	d.FieldU32("hardware_signature", scalar.UintHex)
+	d.FieldU32("firmware_waking_vector", scalar.UintHex)
+	d.FieldU32("global_lock", scalar.UintHex)
+	d.FieldU32("flags", scalar.UintHex)
+	d.FieldU64("x_firmware_waking_vector", scalar.UintHex)
+	d.FieldU8("version")
+	d.FieldRawLen("reserved0", 3*8)
+	d.FieldU32("ospm_flags", scalar.UintHex)
+	d.FieldRawLen("reserved1", d.BitsLeft())
+}
+
+func decodeFADT(d *decode.D, length int64) {
+	// fields were added in later revisions, only decode what the table length covers
+	has := func(end int64) bool { return end <= length }
+
+	d.FieldU32("firmware_ctrl", scalar.UintHex)
+	d.FieldU32("dsdt", scalar.UintHex)
+	d.FieldU8("reserved0")
+	d.FieldU8("preferred_pm_profile", preferredPMProfileNames)
+	d.FieldU16("sci_int")
+	d.FieldU32("smi_cmd", scalar.UintHex)
+	d.FieldU8("acpi_enable", scalar.UintHex)
+	d.FieldU8("acpi_disable", scalar.UintHex)
+	d.FieldU8("s4bios_req", scalar.UintHex)
+	d.FieldU8("pstate_cnt", scalar.UintHex)
+	d.FieldU32("pm1a_evt_blk", scalar.UintHex)
+	d.FieldU32("pm1b_evt_blk", scalar.UintHex)
+	d.FieldU32("pm1a_cnt_blk", scalar.UintHex)
+	d.FieldU32("pm1b_cnt_blk", scalar.UintHex)
+	d.FieldU32("pm2_cnt_blk", scalar.UintHex)
+	d.FieldU32("pm_tmr_blk", scalar.UintHex)
+	d.FieldU32("gpe0_blk", scalar.UintHex)
+	d.FieldU32("gpe1_blk", scalar.UintHex)
+	d.FieldU8("pm1_evt_len")
+	d.FieldU8("pm1_cnt_len")
+	d.FieldU8("pm2_cnt_len")
+	d.FieldU8("pm_tmr_len")
+	d.FieldU8("gpe0_blk_len")
+	d.FieldU8("gpe1_blk_len")
+	d.FieldU8("gpe1_base")
+	d.FieldU8("cst_cnt", scalar.UintHex)
+	d.FieldU16("p_lvl2_lat")
+	d.FieldU16("p_lvl3_lat")
+	d.FieldU16("flush_size")
+	d.FieldU16("flush_stride")
+	d.FieldU8("duty_offset")
+	d.FieldU8("duty_width")
+	d.FieldU8("day_alrm")
+	d.FieldU8("mon_alrm")
+	d.FieldU8("century")
+	d.FieldU16("iapc_boot_arch", scalar.UintHex)
+	d.FieldU8("reserved1")
+	d.FieldU32("flags", scalar.UintHex)
+	if has(132) {
+		decodeGenericAddress(d, "reset_reg")
+		d.FieldU8("reset_value", scalar.UintHex)
+		d.FieldU16("arm_boot_arch", scalar.UintHex)
+		d.FieldU8("fadt_minor_version")
+	}
+	if has(148) {
+		d.FieldU64("x_firmware_ctrl", scalar.UintHex)
+		d.FieldU64("x_dsdt", scalar.UintHex)
+	}
+	if has(244) {
+		decodeGenericAddress(d, "x_pm1a_evt_blk")
+		decodeGenericAddress(d, "x_pm1b_evt_blk")
+		decodeGenericAddress(d, "x_pm1a_cnt_blk")
+		decodeGenericAddress(d, "x_pm1b_cnt_blk")
+		decodeGenericAddress(d, "x_pm2_cnt_blk")
+		decodeGenericAddress(d, "x_pm_tmr_blk")
+		decodeGenericAddress(d, "x_gpe0_blk")
+		decodeGenericAddress(d, "x_gpe1_blk")
+	}
+	if has(268) {
+		decodeGenericAddress(d, "sleep_control_reg")
+		decodeGenericAddress(d, "sleep_status_reg")
+	}
+	if has(276) {
+		d.FieldU64("hypervisor_vendor_identity", scalar.UintHex)
+	}
+}
+
+func decodeSDT(d *decode.D) {
+	length := peekTableLength(d)
+	if length < sdtHeaderLen {
+		d.Fatalf("table length %d is less than header length", length)
+	}
+	if length*8 > d.BitsLeft() {
+		d.Fatalf("table length %d is larger than input", length)
+	}
+	bs := d.PeekBytes(int(length))
+
+	var signature string
+	d.FieldStruct("header", func(d *decode.D) {
+		signature = d.FieldUTF8("signature", 4, signatureNames)
+		d.FieldU32("length")
+		d.FieldU8("revision")
+		fieldChecksum(d, "checksum", bs, 9)
+		d.FieldUTF8("oem_id", 6)
+		d.FieldUTF8("oem_table_id", 8)
+		d.FieldU32("oem_revision", scalar.UintHex)
+		d.FieldUTF8("creator_id", 4)
+		d.FieldU32("creator_revision", scalar.UintHex)
+	})
+
+	d.FramedFn((length-sdtHeaderLen)*8, func(d *decode.D) {
+		switch signature {
+		case "RSDT":
+			d.FieldArray("entries", func(d *decode.D) {
+				for !d.End() {
+					d.FieldU32("entry", scalar.UintHex)
+				}
+			})
+		case "XSDT":
+			d.FieldArray("entries", func(d *decode.D) {
+				for !d.End() {
+					d.FieldU64("entry", scalar.UintHex)
+				}
+			})
+		case "FACP":
+			decodeFADT(d, length)
+		case "DSDT", "SSDT":
+			// AML definition blocks are not decoded
+			d.FieldRawLen("aml", d.BitsLeft())
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeACPI(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	switch {
+	case bytes.HasPrefix(d.PeekBytes(8), []byte("RSD PTR ")):
+		decodeRSDP(d)
+	case bytes.HasPrefix(d.PeekBytes(4), []byte("FACS")):
+		decodeFACS(d)
+	default:
+		var pi format.Probe_In
+		if d.ArgAs(&pi) {
+			// tables has no magic so require a known signature and a length matching the input
+			sig := string(d.PeekBytes(4))
+			if _, ok := signatureNames[sig]; !ok {
+				d.Fatalf("unknown signature %q", sig)
+			}
+			if peekTableLength(d) != d.BitsLeft()/8 {
+				d.Fatalf("table length does not match input length")
+			}
+		}
+		decodeSDT(d)
+	}
+
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
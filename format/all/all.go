@@ -2,6 +2,8 @@
 package all
 
 import (
+	_ "github.com/wader/fq/format/acpi"
+	_ "github.com/wader/fq/format/android"
 	_ "github.com/wader/fq/format/ape"
 	_ "github.com/wader/fq/format/apple/bookmark"
 	_ "github.com/wader/fq/format/apple/bplist"
@@ -16,26 +18,37 @@ import (
 	_ "github.com/wader/fq/format/bson"
 	_ "github.com/wader/fq/format/bzip2"
 	_ "github.com/wader/fq/format/caff"
+	_ "github.com/wader/fq/format/can"
 	_ "github.com/wader/fq/format/cbor"
 	_ "github.com/wader/fq/format/crypto"
 	_ "github.com/wader/fq/format/csv"
+	_ "github.com/wader/fq/format/disk"
 	_ "github.com/wader/fq/format/dns"
+	_ "github.com/wader/fq/format/dtb"
 	_ "github.com/wader/fq/format/elf"
+	_ "github.com/wader/fq/format/ext4"
 	_ "github.com/wader/fq/format/fairplay"
 	_ "github.com/wader/fq/format/fit"
 	_ "github.com/wader/fq/format/flac"
 	_ "github.com/wader/fq/format/gif"
+	_ "github.com/wader/fq/format/git"
 	_ "github.com/wader/fq/format/gzip"
+	_ "github.com/wader/fq/format/hexrec"
+	_ "github.com/wader/fq/format/i2c"
 	_ "github.com/wader/fq/format/icc"
 	_ "github.com/wader/fq/format/id3"
 	_ "github.com/wader/fq/format/inet"
+	_ "github.com/wader/fq/format/java"
 	_ "github.com/wader/fq/format/jpeg"
 	_ "github.com/wader/fq/format/json"
+	_ "github.com/wader/fq/format/kaitai"
 	_ "github.com/wader/fq/format/leveldb"
 	_ "github.com/wader/fq/format/luajit"
+	_ "github.com/wader/fq/format/lz4"
 	_ "github.com/wader/fq/format/markdown"
 	_ "github.com/wader/fq/format/math"
 	_ "github.com/wader/fq/format/matroska"
+	_ "github.com/wader/fq/format/matter"
 	_ "github.com/wader/fq/format/midi"
 	_ "github.com/wader/fq/format/moc3"
 	_ "github.com/wader/fq/format/mp3"
@@ -44,28 +57,45 @@ import (
 	_ "github.com/wader/fq/format/msgpack"
 	_ "github.com/wader/fq/format/negentropy"
 	_ "github.com/wader/fq/format/nes"
+	_ "github.com/wader/fq/format/nvme"
 	_ "github.com/wader/fq/format/ogg"
 	_ "github.com/wader/fq/format/opentimestamps"
 	_ "github.com/wader/fq/format/opus"
 	_ "github.com/wader/fq/format/pcap"
+	_ "github.com/wader/fq/format/pdf"
+	_ "github.com/wader/fq/format/pe"
 	_ "github.com/wader/fq/format/png"
 	_ "github.com/wader/fq/format/postgres"
 	_ "github.com/wader/fq/format/prores"
 	_ "github.com/wader/fq/format/protobuf"
+	_ "github.com/wader/fq/format/quic"
+	_ "github.com/wader/fq/format/rar"
 	_ "github.com/wader/fq/format/riff"
 	_ "github.com/wader/fq/format/rtmp"
+	_ "github.com/wader/fq/format/rtp"
+	_ "github.com/wader/fq/format/sevenzip"
+	_ "github.com/wader/fq/format/smbios"
+	_ "github.com/wader/fq/format/sqlite3"
+	_ "github.com/wader/fq/format/squashfs"
 	_ "github.com/wader/fq/format/tap"
 	_ "github.com/wader/fq/format/tar"
 	_ "github.com/wader/fq/format/text"
 	_ "github.com/wader/fq/format/tiff"
 	_ "github.com/wader/fq/format/tls"
 	_ "github.com/wader/fq/format/toml"
+	_ "github.com/wader/fq/format/tpm"
+	_ "github.com/wader/fq/format/transform"
 	_ "github.com/wader/fq/format/tzif"
 	_ "github.com/wader/fq/format/tzx"
+	_ "github.com/wader/fq/format/ubi"
+	_ "github.com/wader/fq/format/uefi"
+	_ "github.com/wader/fq/format/usb"
 	_ "github.com/wader/fq/format/vorbis"
 	_ "github.com/wader/fq/format/vpx"
 	_ "github.com/wader/fq/format/wasm"
 	_ "github.com/wader/fq/format/xml"
 	_ "github.com/wader/fq/format/yaml"
+	_ "github.com/wader/fq/format/zigbee"
 	_ "github.com/wader/fq/format/zip"
+	_ "github.com/wader/fq/format/zstd"
 )
@@ -0,0 +1,161 @@
+package android
+
+// https://android.googlesource.com/platform/system/tools/mkbootimg/+/refs/heads/main/include/bootimg/bootimg.h
+// https://source.android.com/docs/core/architecture/bootloader/boot-image-header
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed android_bootimg.md
+var androidBootimgFS embed.FS
+
+var bootimgProbeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.Android_Bootimg,
+		&decode.Format{
+			Description: "Android boot image",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeAndroidBootimg,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &bootimgProbeGroup},
+			},
+		})
+	interp.RegisterFS(androidBootimgFS)
+}
+
+const (
+	bootimgMagic = "ANDROID!"
+	// v3 and later has fixed page size
+	bootimgV3PageSize = 4096
+)
+
+// os_version is A.B.C in upper 21 bits and year-2000 and month in lower 11 bits
+var bootimgOSVersion = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual == 0 {
+		return s, nil
+	}
+	version := s.Actual >> 11
+	patch := s.Actual & 0x7ff
+	s.Description = fmt.Sprintf("%d.%d.%d %d-%02d",
+		version>>14&0x7f, version>>7&0x7f, version&0x7f,
+		2000+patch>>4, patch&0xf,
+	)
+	return s, nil
+})
+
+type bootimgSection struct {
+	name string
+	size uint64
+}
+
+func decodeBootimgHeaderV0(d *decode.D) (pageSize uint64, sections []bootimgSection) {
+	kernelSize := d.FieldU32("kernel_size")
+	d.FieldU32("kernel_addr", scalar.UintHex)
+	ramdiskSize := d.FieldU32("ramdisk_size")
+	d.FieldU32("ramdisk_addr", scalar.UintHex)
+	secondSize := d.FieldU32("second_size")
+	d.FieldU32("second_addr", scalar.UintHex)
+	d.FieldU32("tags_addr", scalar.UintHex)
+	pageSize = d.FieldU32("page_size")
+	headerVersion := d.FieldU32("header_version")
+	d.FieldU32("os_version", bootimgOSVersion)
+	d.FieldUTF8NullFixedLen("name", 16)
+	d.FieldUTF8NullFixedLen("cmdline", 512)
+	d.FieldRawLen("id", 32*8)
+	d.FieldUTF8NullFixedLen("extra_cmdline", 1024)
+
+	sections = []bootimgSection{
+		{name: "kernel", size: kernelSize},
+		{name: "ramdisk", size: ramdiskSize},
+		{name: "second", size: secondSize},
+	}
+	if headerVersion >= 1 {
+		recoveryDTBOSize := d.FieldU32("recovery_dtbo_size")
+		d.FieldU64("recovery_dtbo_offset")
+		d.FieldU32("header_size")
+		sections = append(sections, bootimgSection{name: "recovery_dtbo", size: recoveryDTBOSize})
+	}
+	if headerVersion >= 2 {
+		dtbSize := d.FieldU32("dtb_size")
+		d.FieldU64("dtb_addr", scalar.UintHex)
+		sections = append(sections, bootimgSection{name: "dtb", size: dtbSize})
+	}
+
+	return pageSize, sections
+}
+
+func decodeBootimgHeaderV3(d *decode.D) (pageSize uint64, sections []bootimgSection) {
+	kernelSize := d.FieldU32("kernel_size")
+	ramdiskSize := d.FieldU32("ramdisk_size")
+	d.FieldU32("os_version", bootimgOSVersion)
+	d.FieldU32("header_size")
+	d.FieldArray("reserved", func(d *decode.D) {
+		for i := 0; i < 4; i++ {
+			d.FieldU32("reserved")
+		}
+	})
+	headerVersion := d.FieldU32("header_version")
+	d.FieldUTF8NullFixedLen("cmdline", 1536)
+
+	sections = []bootimgSection{
+		{name: "kernel", size: kernelSize},
+		{name: "ramdisk", size: ramdiskSize},
+	}
+	if headerVersion >= 4 {
+		signatureSize := d.FieldU32("signature_size")
+		sections = append(sections, bootimgSection{name: "signature", size: signatureSize})
+	}
+
+	return bootimgV3PageSize, sections
+}
+
+func decodeAndroidBootimg(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	// header_version is at the same offset in all versions
+	var headerVersion uint64
+	d.SeekAbs(40*8, func(d *decode.D) { headerVersion = d.U32() })
+	if headerVersion > 4 {
+		d.Fatalf("unsupported header version %d", headerVersion)
+	}
+
+	var pageSize uint64
+	var sections []bootimgSection
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("magic", 8, d.StrAssert(bootimgMagic))
+		if headerVersion >= 3 {
+			pageSize, sections = decodeBootimgHeaderV3(d)
+		} else {
+			pageSize, sections = decodeBootimgHeaderV0(d)
+		}
+	})
+	if pageSize == 0 || pageSize&(pageSize-1) != 0 {
+		d.Fatalf("invalid page size %d", pageSize)
+	}
+
+	// header and each section are padded to page size, last padding might be missing
+	pagePadding := func(name string) {
+		if padding := min(int64(d.AlignBits(int(pageSize)*8)), d.BitsLeft()); padding > 0 {
+			d.FieldRawLen(name, padding)
+		}
+	}
+	pagePadding("header_padding")
+	for _, s := range sections {
+		if s.size == 0 {
+			continue
+		}
+		d.FieldFormatOrRawLen(s.name, int64(s.size)*8, &bootimgProbeGroup, format.Probe_In{})
+		pagePadding(s.name + "_padding")
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package android
+
+// https://android.googlesource.com/platform/system/core/+/refs/heads/main/libsparse/sparse_format.h
+// https://android.googlesource.com/platform/system/core/+/refs/heads/main/libsparse/sparse_read.cpp
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed android_sparse.md
+var androidSparseFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Android_Sparse,
+		&decode.Format{
+			Description: "Android sparse image",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeAndroidSparse,
+		})
+	interp.RegisterFS(androidSparseFS)
+}
+
+const sparseMagic = 0xed26ff3a
+
+const (
+	sparseFileHeaderSize  = 28
+	sparseChunkHeaderSize = 12
+)
+
+const (
+	sparseChunkRaw      = 0xcac1
+	sparseChunkFill     = 0xcac2
+	sparseChunkDontCare = 0xcac3
+	sparseChunkCRC32    = 0xcac4
+)
+
+var sparseChunkTypeNames = scalar.UintMapSymStr{
+	sparseChunkRaw:      "raw",
+	sparseChunkFill:     "fill",
+	sparseChunkDontCare: "dont_care",
+	sparseChunkCRC32:    "crc32",
+}
+
+func decodeAndroidSparse(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	d.FieldU32("magic", d.UintAssert(sparseMagic), scalar.UintHex)
+	d.FieldU16("major_version", d.UintAssert(1))
+	d.FieldU16("minor_version")
+	fileHeaderSize := d.FieldU16("file_header_size", d.UintAssertRange(sparseFileHeaderSize, 0xffff))
+	chunkHeaderSize := d.FieldU16("chunk_header_size", d.UintAssertRange(sparseChunkHeaderSize, 0xffff))
+	blockSize := d.FieldU32("block_size")
+	if blockSize == 0 || blockSize%4 != 0 {
+		d.Fatalf("invalid block size %d", blockSize)
+	}
+	d.FieldU32("total_blocks")
+	totalChunks := d.FieldU32("total_chunks")
+	d.FieldU32("image_checksum", scalar.UintHex)
+	if fileHeaderSize > sparseFileHeaderSize {
+		d.FieldRawLen("header_unknown", int64(fileHeaderSize-sparseFileHeaderSize)*8)
+	}
+
+	// output offset is the sum of all previous chunk sizes
+	var outputBlock uint64
+	d.FieldArray("chunks", func(d *decode.D) {
+		for i := uint64(0); i < totalChunks; i++ {
+			d.FieldStruct("chunk", func(d *decode.D) {
+				chunkType := d.FieldU16("type", sparseChunkTypeNames, scalar.UintHex)
+				d.FieldU16("reserved")
+				chunkBlocks := d.FieldU32("chunk_size")
+				totalSize := d.FieldU32("total_size", d.UintAssertRange(chunkHeaderSize, 0xffff_ffff))
+				if chunkHeaderSize > sparseChunkHeaderSize {
+					d.FieldRawLen("header_unknown", int64(chunkHeaderSize-sparseChunkHeaderSize)*8)
+				}
+				d.FieldValueUint("output_offset", outputBlock*blockSize)
+
+				dataSize := int64(totalSize-chunkHeaderSize) * 8
+				switch chunkType {
+				case sparseChunkRaw:
+					if totalSize-chunkHeaderSize != chunkBlocks*blockSize {
+						d.Fatalf("raw chunk data size %d does not match %d blocks", totalSize-chunkHeaderSize, chunkBlocks)
+					}
+					d.FieldRawLen("data", dataSize)
+				case sparseChunkFill, sparseChunkCRC32:
+					if dataSize != 32 {
+						d.Fatalf("%s chunk data size %d is not 4", sparseChunkTypeNames[chunkType], dataSize/8)
+					}
+					if chunkType == sparseChunkFill {
+						d.FieldU32("fill_value", scalar.UintHex)
+					} else {
+						d.FieldU32("crc32", scalar.UintHex)
+					}
+				default:
+					if dataSize > 0 {
+						d.FieldRawLen("data", dataSize)
+					}
+				}
+				// crc32 chunks has zero chunk size
+				outputBlock += chunkBlocks
+			})
+		}
+	})
+
+	return nil
+}
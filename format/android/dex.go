@@ -0,0 +1,493 @@
+package android
+
+// https://source.android.com/docs/core/runtime/dex-format
+//
+// Files in android using this format include:
+//  - classes.dex in .apk files
+
+import (
+	"crypto/sha1"
+	"embed"
+	"hash/adler32"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed dex.md
+var dexFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.DEX,
+		&decode.Format{
+			Description: "Dalvik executable",
+			Extensions:  []string{"dex"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeDEX,
+		})
+	interp.RegisterFS(dexFS)
+}
+
+const (
+	dexMagic         = "dex\n"
+	dexSignatureLen  = 20
+	dexEndianConst   = 0x1234_5678
+	dexReverseEndian = 0x7856_3412
+)
+
+var dexEndianNames = scalar.UintMapSymStr{
+	dexEndianConst:   "little_endian",
+	dexReverseEndian: "big_endian",
+}
+
+var dexMapItemTypeNames = scalar.UintMapSymStr{
+	0x0000: "header_item",
+	0x0001: "string_id_item",
+	0x0002: "type_id_item",
+	0x0003: "proto_id_item",
+	0x0004: "field_id_item",
+	0x0005: "method_id_item",
+	0x0006: "class_def_item",
+	0x0007: "call_site_id_item",
+	0x0008: "method_handle_item",
+	0x1000: "map_list",
+	0x1001: "type_list",
+	0x1002: "annotation_set_ref_list",
+	0x1003: "annotation_set_item",
+	0x2000: "class_data_item",
+	0x2001: "code_item",
+	0x2002: "string_data_item",
+	0x2003: "debug_info_item",
+	0x2004: "annotation_item",
+	0x2005: "encoded_array_item",
+	0x2006: "annotations_directory_item",
+	0xf000: "hiddenapi_class_data_item",
+}
+
+var dexClassAccessFlags = map[uint64]string{
+	0x0001: "public",
+	0x0002: "private",
+	0x0004: "protected",
+	0x0008: "static",
+	0x0010: "final",
+	0x0200: "interface",
+	0x0400: "abstract",
+	0x1000: "synthetic",
+	0x2000: "annotation",
+	0x4000: "enum",
+}
+
+var dexFieldAccessFlags = map[uint64]string{
+	0x0001: "public",
+	0x0002: "private",
+	0x0004: "protected",
+	0x0008: "static",
+	0x0010: "final",
+	0x0040: "volatile",
+	0x0080: "transient",
+	0x1000: "synthetic",
+	0x4000: "enum",
+}
+
+var dexMethodAccessFlags = map[uint64]string{
+	0x0001:  "public",
+	0x0002:  "private",
+	0x0004:  "protected",
+	0x0008:  "static",
+	0x0010:  "final",
+	0x0020:  "synchronized",
+	0x0040:  "bridge",
+	0x0080:  "varargs",
+	0x0100:  "native",
+	0x0400:  "abstract",
+	0x0800:  "strict",
+	0x1000:  "synthetic",
+	0x10000: "constructor",
+	0x20000: "declared_synchronized",
+}
+
+// dexTable maps an index to a resolved string, ex: a type index to a type descriptor
+type dexTable []string
+
+func (t dexTable) MapUint(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual < uint64(len(t)) {
+		s.Sym = t[s.Actual]
+	}
+	return s, nil
+}
+
+type dexHeader struct {
+	stringIDsSize uint64
+	stringIDsOff  uint64
+	typeIDsSize   uint64
+	typeIDsOff    uint64
+	protoIDsSize  uint64
+	protoIDsOff   uint64
+	fieldIDsSize  uint64
+	fieldIDsOff   uint64
+	methodIDsSize uint64
+	methodIDsOff  uint64
+	classDefsSize uint64
+	classDefsOff  uint64
+	mapOff        uint64
+}
+
+type dexContext struct {
+	strings dexTable
+	types   dexTable
+	protos  dexTable
+	fields  dexTable
+	methods dexTable
+}
+
+func (t dexTable) get(i uint64) string {
+	if i < uint64(len(t)) {
+		return t[i]
+	}
+	return ""
+}
+
+// string_data_item is uleb128 length in UTF-16 code units followed by null terminated modified UTF-8
+func dexReadStringData(d *decode.D, off uint64) string {
+	var s string
+	d.SeekAbs(int64(off)*8, func(d *decode.D) {
+		d.ULEB128()
+		s = d.UTF8Null()
+	})
+	return s
+}
+
+func dexReadTypeList(d *decode.D, off uint64, types dexTable) []string {
+	var l []string
+	d.SeekAbs(int64(off)*8, func(d *decode.D) {
+		size := d.U32()
+		for i := uint64(0); i < size; i++ {
+			l = append(l, types.get(d.U16()))
+		}
+	})
+	return l
+}
+
+// first pass to resolve strings and references used as symbolic values
+func dexReadTables(d *decode.D, h dexHeader) dexContext {
+	var c dexContext
+
+	d.SeekAbs(int64(h.stringIDsOff) * 8)
+	for i := uint64(0); i < h.stringIDsSize; i++ {
+		c.strings = append(c.strings, dexReadStringData(d, d.U32()))
+	}
+	d.SeekAbs(int64(h.typeIDsOff) * 8)
+	for i := uint64(0); i < h.typeIDsSize; i++ {
+		c.types = append(c.types, c.strings.get(d.U32()))
+	}
+	d.SeekAbs(int64(h.protoIDsOff) * 8)
+	for i := uint64(0); i < h.protoIDsSize; i++ {
+		d.U32() // shorty_idx
+		returnType := c.types.get(d.U32())
+		var params []string
+		if paramsOff := d.U32(); paramsOff != 0 {
+			params = dexReadTypeList(d, paramsOff, c.types)
+		}
+		c.protos = append(c.protos, "("+strings.Join(params, "")+")"+returnType)
+	}
+	d.SeekAbs(int64(h.fieldIDsOff) * 8)
+	for i := uint64(0); i < h.fieldIDsSize; i++ {
+		class := c.types.get(d.U16())
+		typ := c.types.get(d.U16())
+		name := c.strings.get(d.U32())
+		c.fields = append(c.fields, class+"->"+name+":"+typ)
+	}
+	d.SeekAbs(int64(h.methodIDsOff) * 8)
+	for i := uint64(0); i < h.methodIDsSize; i++ {
+		class := c.types.get(d.U16())
+		proto := c.protos.get(d.U16())
+		name := c.strings.get(d.U32())
+		c.methods = append(c.methods, class+"->"+name+proto)
+	}
+
+	return c
+}
+
+// dexFieldFlags decodes access flags and adds a bool per known flag bit
+func dexFieldFlags(d *decode.D, fn func(d *decode.D, name string) uint64, bits map[uint64]string) {
+	d.FieldStruct("access_flags", func(d *decode.D) {
+		v := fn(d, "value")
+		for bit := uint64(1); bit <= 0x20000; bit <<= 1 {
+			if n, ok := bits[bit]; ok {
+				d.FieldValueBool(n, v&bit != 0)
+			}
+		}
+	})
+}
+
+func dexFieldU32Flags(d *decode.D, bits map[uint64]string) {
+	dexFieldFlags(d, func(d *decode.D, name string) uint64 { return d.FieldU32(name, scalar.UintHex) }, bits)
+}
+
+func dexFieldULEB128Flags(d *decode.D, bits map[uint64]string) {
+	dexFieldFlags(d, func(d *decode.D, name string) uint64 { return d.FieldULEB128(name, scalar.UintHex) }, bits)
+}
+
+func decodeDEXHeader(d *decode.D) dexHeader {
+	var h dexHeader
+
+	d.FieldUTF8("magic", 4, d.StrAssert(dexMagic))
+	d.FieldUTF8NullFixedLen("version", 4)
+	d.FieldU32("checksum", d.UintValidate(uint64(adler32.Checksum(d.BytesRange(12*8, int(d.Len()/8-12))))), scalar.UintHex)
+	sh := sha1.New()
+	d.Copy(sh, bitio.NewIOReader(d.BitBufRange(32*8, d.Len()-32*8)))
+	d.FieldRawLen("signature", dexSignatureLen*8, d.ValidateBitBuf(sh.Sum(nil)), scalar.RawHex)
+	d.FieldU32("file_size", d.UintValidate(uint64(d.Len()/8)))
+	d.FieldU32("header_size")
+	d.FieldU32("endian_tag", dexEndianNames, scalar.UintHex)
+	d.FieldU32("link_size")
+	d.FieldU32("link_off", scalar.UintHex)
+	h.mapOff = d.FieldU32("map_off", scalar.UintHex)
+	h.stringIDsSize = d.FieldU32("string_ids_size")
+	h.stringIDsOff = d.FieldU32("string_ids_off", scalar.UintHex)
+	h.typeIDsSize = d.FieldU32("type_ids_size")
+	h.typeIDsOff = d.FieldU32("type_ids_off", scalar.UintHex)
+	h.protoIDsSize = d.FieldU32("proto_ids_size")
+	h.protoIDsOff = d.FieldU32("proto_ids_off", scalar.UintHex)
+	h.fieldIDsSize = d.FieldU32("field_ids_size")
+	h.fieldIDsOff = d.FieldU32("field_ids_off", scalar.UintHex)
+	h.methodIDsSize = d.FieldU32("method_ids_size")
+	h.methodIDsOff = d.FieldU32("method_ids_off", scalar.UintHex)
+	h.classDefsSize = d.FieldU32("class_defs_size")
+	h.classDefsOff = d.FieldU32("class_defs_off", scalar.UintHex)
+	d.FieldU32("data_size")
+	d.FieldU32("data_off", scalar.UintHex)
+
+	return h
+}
+
+func decodeDEXTypeList(d *decode.D, name string, off uint64, c dexContext) {
+	d.SeekAbs(int64(off)*8, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			size := d.FieldU32("size")
+			d.FieldArray("list", func(d *decode.D) {
+				for i := uint64(0); i < size; i++ {
+					d.FieldU16("type_idx", c.types)
+				}
+			})
+		})
+	})
+}
+
+func decodeDEXCode(d *decode.D, c dexContext) {
+	d.FieldU16("registers_size")
+	d.FieldU16("ins_size")
+	d.FieldU16("outs_size")
+	triesSize := d.FieldU16("tries_size")
+	d.FieldU32("debug_info_off", scalar.UintHex)
+	insnsSize := d.FieldU32("insns_size")
+	d.FieldRawLen("insns", int64(insnsSize)*16)
+	if triesSize == 0 {
+		return
+	}
+	if insnsSize%2 != 0 {
+		d.FieldU16("padding")
+	}
+	d.FieldArray("tries", func(d *decode.D) {
+		for i := uint64(0); i < triesSize; i++ {
+			d.FieldStruct("try", func(d *decode.D) {
+				d.FieldU32("start_addr")
+				d.FieldU16("insn_count")
+				d.FieldU16("handler_off")
+			})
+		}
+	})
+	d.FieldStruct("handlers", func(d *decode.D) {
+		size := d.FieldULEB128("size")
+		d.FieldArray("list", func(d *decode.D) {
+			for i := uint64(0); i < size; i++ {
+				d.FieldStruct("handler", func(d *decode.D) {
+					// negative size means there is a catch-all handler
+					n := d.FieldSLEB128("size")
+					d.FieldArray("handlers", func(d *decode.D) {
+						for j := int64(0); j < max(n, -n); j++ {
+							d.FieldStruct("handler", func(d *decode.D) {
+								d.FieldULEB128("type_idx", c.types)
+								d.FieldULEB128("addr")
+							})
+						}
+					})
+					if n <= 0 {
+						d.FieldULEB128("catch_all_addr")
+					}
+				})
+			}
+		})
+	})
+}
+
+func decodeDEXClassData(d *decode.D, c dexContext) {
+	staticFieldsSize := d.FieldULEB128("static_fields_size")
+	instanceFieldsSize := d.FieldULEB128("instance_fields_size")
+	directMethodsSize := d.FieldULEB128("direct_methods_size")
+	virtualMethodsSize := d.FieldULEB128("virtual_methods_size")
+
+	// indexes are delta encoded from previous index in same list
+	fieldsFn := func(name string, size uint64) {
+		d.FieldArray(name, func(d *decode.D) {
+			var idx uint64
+			for i := uint64(0); i < size; i++ {
+				d.FieldStruct("field", func(d *decode.D) {
+					idx += d.FieldULEB128("field_idx_diff")
+					d.FieldValueUint("field_idx", idx, c.fields)
+					dexFieldULEB128Flags(d, dexFieldAccessFlags)
+				})
+			}
+		})
+	}
+	methodsFn := func(name string, size uint64) {
+		d.FieldArray(name, func(d *decode.D) {
+			var idx uint64
+			for i := uint64(0); i < size; i++ {
+				d.FieldStruct("method", func(d *decode.D) {
+					idx += d.FieldULEB128("method_idx_diff")
+					d.FieldValueUint("method_idx", idx, c.methods)
+					dexFieldULEB128Flags(d, dexMethodAccessFlags)
+					codeOff := d.FieldULEB128("code_off", scalar.UintHex)
+					if codeOff != 0 {
+						d.SeekAbs(int64(codeOff)*8, func(d *decode.D) {
+							d.FieldStruct("code", func(d *decode.D) { decodeDEXCode(d, c) })
+						})
+					}
+				})
+			}
+		})
+	}
+
+	fieldsFn("static_fields", staticFieldsSize)
+	fieldsFn("instance_fields", instanceFieldsSize)
+	methodsFn("direct_methods", directMethodsSize)
+	methodsFn("virtual_methods", virtualMethodsSize)
+}
+
+func decodeDEX(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	var h dexHeader
+	d.FieldStruct("header", func(d *decode.D) { h = decodeDEXHeader(d) })
+
+	headerEnd := d.Pos()
+	c := dexReadTables(d, h)
+	d.SeekAbs(headerEnd)
+
+	d.SeekAbs(int64(h.stringIDsOff)*8, func(d *decode.D) {
+		d.FieldArray("string_ids", func(d *decode.D) {
+			for i := uint64(0); i < h.stringIDsSize; i++ {
+				d.FieldU32("string_data_off", scalar.UintHex)
+			}
+		})
+	})
+	d.SeekAbs(int64(h.typeIDsOff)*8, func(d *decode.D) {
+		d.FieldArray("type_ids", func(d *decode.D) {
+			for i := uint64(0); i < h.typeIDsSize; i++ {
+				d.FieldU32("descriptor_idx", c.strings)
+			}
+		})
+	})
+	d.SeekAbs(int64(h.protoIDsOff)*8, func(d *decode.D) {
+		d.FieldArray("proto_ids", func(d *decode.D) {
+			for i := uint64(0); i < h.protoIDsSize; i++ {
+				d.FieldStruct("proto_id", func(d *decode.D) {
+					d.FieldValueStr("prototype", c.protos.get(i))
+					d.FieldU32("shorty_idx", c.strings)
+					d.FieldU32("return_type_idx", c.types)
+					parametersOff := d.FieldU32("parameters_off", scalar.UintHex)
+					if parametersOff != 0 {
+						decodeDEXTypeList(d, "parameters", parametersOff, c)
+					}
+				})
+			}
+		})
+	})
+	d.SeekAbs(int64(h.fieldIDsOff)*8, func(d *decode.D) {
+		d.FieldArray("field_ids", func(d *decode.D) {
+			for i := uint64(0); i < h.fieldIDsSize; i++ {
+				d.FieldStruct("field_id", func(d *decode.D) {
+					d.FieldValueStr("field", c.fields.get(i))
+					d.FieldU16("class_idx", c.types)
+					d.FieldU16("type_idx", c.types)
+					d.FieldU32("name_idx", c.strings)
+				})
+			}
+		})
+	})
+	d.SeekAbs(int64(h.methodIDsOff)*8, func(d *decode.D) {
+		d.FieldArray("method_ids", func(d *decode.D) {
+			for i := uint64(0); i < h.methodIDsSize; i++ {
+				d.FieldStruct("method_id", func(d *decode.D) {
+					d.FieldValueStr("method", c.methods.get(i))
+					d.FieldU16("class_idx", c.types)
+					d.FieldU16("proto_idx", c.protos)
+					d.FieldU32("name_idx", c.strings)
+				})
+			}
+		})
+	})
+	d.SeekAbs(int64(h.classDefsOff)*8, func(d *decode.D) {
+		d.FieldArray("class_defs", func(d *decode.D) {
+			for i := uint64(0); i < h.classDefsSize; i++ {
+				d.FieldStruct("class_def", func(d *decode.D) {
+					d.FieldU32("class_idx", c.types)
+					dexFieldU32Flags(d, dexClassAccessFlags)
+					d.FieldU32("superclass_idx", c.types)
+					interfacesOff := d.FieldU32("interfaces_off", scalar.UintHex)
+					d.FieldU32("source_file_idx", c.strings)
+					d.FieldU32("annotations_off", scalar.UintHex)
+					classDataOff := d.FieldU32("class_data_off", scalar.UintHex)
+					d.FieldU32("static_values_off", scalar.UintHex)
+
+					if interfacesOff != 0 {
+						decodeDEXTypeList(d, "interfaces", interfacesOff, c)
+					}
+					if classDataOff != 0 {
+						d.SeekAbs(int64(classDataOff)*8, func(d *decode.D) {
+							d.FieldStruct("class_data", func(d *decode.D) { decodeDEXClassData(d, c) })
+						})
+					}
+				})
+			}
+		})
+	})
+	d.FieldArray("strings", func(d *decode.D) {
+		d.SeekAbs(int64(h.stringIDsOff)*8, func(d *decode.D) {
+			for i := uint64(0); i < h.stringIDsSize; i++ {
+				off := d.U32()
+				d.SeekAbs(int64(off)*8, func(d *decode.D) {
+					d.FieldStruct("string", func(d *decode.D) {
+						d.FieldULEB128("utf16_size")
+						d.FieldUTF8Null("data")
+					})
+				})
+			}
+		})
+	})
+	if h.mapOff != 0 {
+		d.SeekAbs(int64(h.mapOff)*8, func(d *decode.D) {
+			d.FieldStruct("map_list", func(d *decode.D) {
+				size := d.FieldU32("size")
+				d.FieldArray("list", func(d *decode.D) {
+					for i := uint64(0); i < size; i++ {
+						d.FieldStruct("item", func(d *decode.D) {
+							d.FieldU16("type", dexMapItemTypeNames)
+							d.FieldU16("unused")
+							d.FieldU32("size")
+							d.FieldU32("offset", scalar.UintHex)
+						})
+					}
+				})
+			})
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+#!/usr/bin/env python3
+# generates a dex file similar to what d8 would produce for:
+#
+# public class Hello implements Runnable {
+#     static int count;
+#     String name;
+#     public static void main(String[] args) {
+#         try { System.out.println("Hello"); } catch (Exception e) {}
+#     }
+#     public void run() {}
+# }
+import hashlib
+import pathlib
+import struct
+import zlib
+
+here = pathlib.Path(__file__).parent
+
+
+def uleb128(v):
+    b = b""
+    while True:
+        c = v & 0x7F
+        v >>= 7
+        if v:
+            b += bytes([c | 0x80])
+        else:
+            return b + bytes([c])
+
+
+def sleb128(v):
+    b = b""
+    while True:
+        c = v & 0x7F
+        v >>= 7
+        if (v == 0 and c & 0x40 == 0) or (v == -1 and c & 0x40):
+            return b + bytes([c])
+        b += bytes([c | 0x80])
+
+
+def align(b, n=4):
+    return b + bytes(-len(b) % n)
+
+
+strings = sorted(
+    [
+        "<init>",
+        "Hello",
+        "Hello.java",
+        "I",
+        "LHello;",
+        "Ljava/io/PrintStream;",
+        "Ljava/lang/Exception;",
+        "Ljava/lang/Object;",
+        "Ljava/lang/Runnable;",
+        "Ljava/lang/String;",
+        "Ljava/lang/System;",
+        "V",
+        "VL",
+        "[Ljava/lang/String;",
+        "count",
+        "main",
+        "name",
+        "out",
+        "println",
+        "run",
+    ]
+)
+s = strings.index
+types = sorted(
+    [
+        "I",
+        "LHello;",
+        "Ljava/io/PrintStream;",
+        "Ljava/lang/Exception;",
+        "Ljava/lang/Object;",
+        "Ljava/lang/Runnable;",
+        "Ljava/lang/String;",
+        "Ljava/lang/System;",
+        "V",
+        "[Ljava/lang/String;",
+    ],
+    key=s,
+)
+t = types.index
+# shorty, return type, parameters
+protos = [("V", "V", []), ("VL", "V", ["Ljava/lang/String;"]), ("VL", "V", ["[Ljava/lang/String;"])]
+# class, type, name
+fields = [
+    ("LHello;", "I", "count"),
+    ("LHello;", "Ljava/lang/String;", "name"),
+    ("Ljava/lang/System;", "Ljava/io/PrintStream;", "out"),
+]
+# class, proto index, name
+methods = [
+    ("LHello;", 0, "<init>"),
+    ("LHello;", 2, "main"),
+    ("LHello;", 0, "run"),
+    ("Ljava/io/PrintStream;", 1, "println"),
+    ("Ljava/lang/Object;", 0, "<init>"),
+]
+
+header_size = 0x70
+string_ids_off = header_size
+type_ids_off = string_ids_off + 4 * len(strings)
+proto_ids_off = type_ids_off + 4 * len(types)
+field_ids_off = proto_ids_off + 12 * len(protos)
+method_ids_off = field_ids_off + 8 * len(fields)
+class_defs_off = method_ids_off + 8 * len(methods)
+data_off = class_defs_off + 32
+
+# data section is built with absolute offsets
+data = b""
+
+
+def add_data(b, n=1):
+    global data
+    data = data + bytes(-(data_off + len(data)) % n)
+    off = data_off + len(data)
+    data += b
+    return off
+
+
+def code_item(registers, ins, outs, insns, tries=b"", handlers=b"", tries_size=0):
+    b = struct.pack("<HHHHII", registers, ins, outs, tries_size, 0, len(insns) // 2) + insns
+    if tries_size:
+        b = align(b) + tries + handlers
+    return b
+
+
+# invoke-direct {v0}, Ljava/lang/Object;-><init>()V; return-void
+init_code = add_data(code_item(1, 1, 1, struct.pack("<HHHH", 0x1070, 4, 0x0000, 0x000E)), 4)
+# sget-object v0, System.out; const-string v1, "Hello"; invoke-virtual {v0, v1}, println; return-void; move-exception v0; return-void
+main_insns = struct.pack("<HH HH HHH H H H", 0x0062, 2, 0x011A, s("Hello"), 0x206E, 3, 0x0010, 0x000E, 0x000D, 0x000E)
+main_code = add_data(
+    code_item(
+        2,
+        1,
+        2,
+        main_insns,
+        tries=struct.pack("<IHH", 0, 7, 1),
+        handlers=uleb128(1) + sleb128(1) + uleb128(t("Ljava/lang/Exception;")) + uleb128(8),
+        tries_size=1,
+    ),
+    4,
+)
+run_code = add_data(code_item(1, 1, 0, struct.pack("<H", 0x000E)), 4)
+
+type_list_offs = {}
+for params in [["Ljava/lang/String;"], ["[Ljava/lang/String;"], ["Ljava/lang/Runnable;"]]:
+    type_list_offs[tuple(params)] = add_data(struct.pack("<I", len(params)) + b"".join(struct.pack("<H", t(p)) for p in params), 4)
+
+string_data_offs = [add_data(uleb128(len(v)) + v.encode() + b"\x00") for v in strings]
+
+class_data = add_data(
+    uleb128(1)
+    + uleb128(1)
+    + uleb128(2)
+    + uleb128(1)
+    # static fields
+    + uleb128(0)
+    + uleb128(0x8)
+    # instance fields
+    + uleb128(1)
+    + uleb128(0x0)
+    # direct methods
+    + uleb128(0)
+    + uleb128(0x10001)
+    + uleb128(init_code)
+    + uleb128(1)
+    + uleb128(0x9)
+    + uleb128(main_code)
+    # virtual methods
+    + uleb128(2)
+    + uleb128(0x1)
+    + uleb128(run_code)
+)
+
+map_items = [
+    (0x0000, 1, 0),
+    (0x0001, len(strings), string_ids_off),
+    (0x0002, len(types), type_ids_off),
+    (0x0003, len(protos), proto_ids_off),
+    (0x0004, len(fields), field_ids_off),
+    (0x0005, len(methods), method_ids_off),
+    (0x0006, 1, class_defs_off),
+    (0x2001, 3, init_code),
+    (0x1001, len(type_list_offs), min(type_list_offs.values())),
+    (0x2002, len(strings), string_data_offs[0]),
+    (0x2000, 1, class_data),
+    (0x1000, 1, 0),
+]
+map_off = data_off + len(data) + (-(data_off + len(data)) % 4)
+map_items[-1] = (0x1000, 1, map_off)
+add_data(struct.pack("<I", len(map_items)) + b"".join(struct.pack("<HHII", ty, 0, n, o) for ty, n, o in map_items), 4)
+
+tables = b"".join(struct.pack("<I", o) for o in string_data_offs)
+tables += b"".join(struct.pack("<I", s(v)) for v in types)
+tables += b"".join(
+    struct.pack("<III", s(shorty), t(ret), type_list_offs[tuple(params)] if params else 0) for shorty, ret, params in protos
+)
+tables += b"".join(struct.pack("<HHI", t(c), t(ty), s(n)) for c, ty, n in fields)
+tables += b"".join(struct.pack("<HHI", t(c), p, s(n)) for c, p, n in methods)
+tables += struct.pack(
+    "<IIIIIIII",
+    t("LHello;"),
+    0x1,
+    t("Ljava/lang/Object;"),
+    type_list_offs[("Ljava/lang/Runnable;",)],
+    s("Hello.java"),
+    0,
+    class_data,
+    0,
+)
+
+file_size = data_off + len(data)
+header = struct.pack(
+    "<IIIIIIIIIIIIIIIIIIII",
+    file_size,
+    header_size,
+    0x12345678,
+    0,
+    0,
+    map_off,
+    len(strings),
+    string_ids_off,
+    len(types),
+    type_ids_off,
+    len(protos),
+    proto_ids_off,
+    len(fields),
+    field_ids_off,
+    len(methods),
+    method_ids_off,
+    1,
+    class_defs_off,
+    len(data),
+    data_off,
+)
+body = header + tables + data
+signature = hashlib.sha1(body).digest()
+checksum = zlib.adler32(signature + body)
+
+(here / "classes.dex").write_bytes(b"dex\n035\x00" + struct.pack("<I", checksum) + signature + body)
@@ -0,0 +1,99 @@
+#!/usr/bin/env python3
+# generates sparse and boot image test files, dtb is from dtb testdata
+import gzip
+import pathlib
+import struct
+import zlib
+
+here = pathlib.Path(__file__).parent
+
+
+def pad(b, n):
+    return b + bytes(-len(b) % n)
+
+
+def os_version(a, b, c, year, month):
+    return (a << 25 | b << 18 | c << 11) | ((year - 2000) << 4 | month)
+
+
+block_size = 4096
+raw1 = pad(b"raw block\n" * 100, block_size)
+raw2 = pad(b"another raw block\n" * 10, block_size)
+fill = struct.pack("<I", 0xDEADBEEF)
+chunks = [
+    (0xCAC1, 1, raw1),
+    (0xCAC2, 2, fill),
+    (0xCAC3, 3, b""),
+    (0xCAC1, 1, raw2),
+]
+image = raw1 + fill * (2 * block_size // 4) + bytes(3 * block_size) + raw2
+chunks.append((0xCAC4, 0, struct.pack("<I", zlib.crc32(image))))
+sparse = struct.pack(
+    "<IHHHHIIII", 0xED26FF3A, 1, 0, 28, 12, block_size, 7, len(chunks), 0
+)
+for t, n, data in chunks:
+    sparse += struct.pack("<HHII", t, 0, n, 12 + len(data)) + data
+(here / "test.simg").write_bytes(sparse)
+
+kernel = b"kernel image\n" * 10
+ramdisk = gzip.compress(b"ramdisk\n" * 10, mtime=0)
+dtb = (here / "../../dtb/testdata/test.dtb").read_bytes()
+
+
+def bootimg_v0(version, page_size, second=b""):
+    h = b"ANDROID!"
+    h += struct.pack(
+        "<10I",
+        len(kernel),
+        0x10008000,
+        len(ramdisk),
+        0x11000000,
+        len(second),
+        0x10F00000,
+        0x10000100,
+        page_size,
+        version,
+        os_version(11, 0, 0, 2021, 3),
+    )
+    h += pad(b"test", 16)
+    h += pad(b"console=ttyS0", 512)
+    h += bytes(range(32))
+    h += pad(b"quiet", 1024)
+    if version >= 1:
+        h += struct.pack("<IQI", 0, 0, 1660 if version >= 2 else 1648)
+    if version >= 2:
+        h += struct.pack("<IQ", len(dtb), 0x11F00000)
+    b = pad(h, page_size) + pad(kernel, page_size) + pad(ramdisk, page_size)
+    if second:
+        b += pad(second, page_size)
+    if version >= 2:
+        b += pad(dtb, page_size)
+    return b
+
+
+def bootimg_v3(version, signature=b""):
+    h = b"ANDROID!"
+    h += struct.pack(
+        "<4I4II",
+        len(kernel),
+        len(ramdisk),
+        os_version(13, 0, 0, 2023, 5),
+        1584 if version >= 4 else 1580,
+        0,
+        0,
+        0,
+        0,
+        version,
+    )
+    h += pad(b"console=ttyS0 androidboot.hardware=test", 1536)
+    if version >= 4:
+        h += struct.pack("<I", len(signature))
+    b = pad(h, 4096) + pad(kernel, 4096) + pad(ramdisk, 4096)
+    if signature:
+        b += pad(signature, 4096)
+    return b
+
+
+(here / "boot_v0.img").write_bytes(bootimg_v0(0, 2048, second=b"second stage"))
+(here / "boot_v2.img").write_bytes(bootimg_v0(2, 2048))
+(here / "boot_v4.img").write_bytes(bootimg_v3(4, signature=bytes(range(64))))
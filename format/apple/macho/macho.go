@@ -17,6 +17,9 @@ import (
 //go:embed macho.md
 var machoFS embed.FS
 
+var xmlGroup decode.Group
+var asn1BerGroup decode.Group
+
 func init() {
 	interp.RegisterFormat(
 		format.MachO,
@@ -24,6 +27,10 @@ func init() {
 			Description: "Mach-O macOS executable",
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    machoDecode,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.XML}, Out: &xmlGroup},
+				{Groups: []*decode.Group{format.ASN1_BER}, Out: &asn1BerGroup},
+			},
 		})
 	interp.RegisterFS(machoFS)
 }
@@ -679,8 +686,16 @@ func machoDecode(d *decode.D) any {
 						d.FieldU32("version")
 						ntoolsIdx++
 					})
-				case LC_CODE_SIGNATURE,
-					LC_SEGMENT_SPLIT_INFO,
+				case LC_CODE_SIGNATURE:
+					var off, size uint64
+					d.FieldStruct("linkedit_data", func(d *decode.D) {
+						off = d.FieldU32("off")
+						size = d.FieldU32("size")
+					})
+					d.RangeFn(int64(off)*8, int64(size)*8, func(d *decode.D) {
+						d.FieldStruct("code_signature", decodeCodeSignature)
+					})
+				case LC_SEGMENT_SPLIT_INFO,
 					LC_FUNCTION_STARTS,
 					LC_DATA_IN_CODE,
 					LC_DYLIB_CODE_SIGN_DRS,
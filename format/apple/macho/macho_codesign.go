@@ -0,0 +1,324 @@
+package macho
+
+// https://github.com/apple-oss-distributions/xnu/blob/main/osfmk/kern/cs_blobs.h
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// code signature blobs are always big endian
+const (
+	CSMAGIC_REQUIREMENT               = 0xfade_0c00
+	CSMAGIC_REQUIREMENTS              = 0xfade_0c01
+	CSMAGIC_CODEDIRECTORY             = 0xfade_0c02
+	CSMAGIC_EMBEDDED_SIGNATURE        = 0xfade_0cc0
+	CSMAGIC_DETACHED_SIGNATURE        = 0xfade_0cc1
+	CSMAGIC_BLOBWRAPPER               = 0xfade_0b01
+	CSMAGIC_EMBEDDED_ENTITLEMENTS     = 0xfade_7171
+	CSMAGIC_EMBEDDED_DER_ENTITLEMENTS = 0xfade_7172
+)
+
+var csMagicNames = scalar.UintMapSymStr{
+	CSMAGIC_REQUIREMENT:               "requirement",
+	CSMAGIC_REQUIREMENTS:              "requirements",
+	CSMAGIC_CODEDIRECTORY:             "code_directory",
+	CSMAGIC_EMBEDDED_SIGNATURE:        "embedded_signature",
+	CSMAGIC_DETACHED_SIGNATURE:        "detached_signature",
+	CSMAGIC_BLOBWRAPPER:               "blob_wrapper",
+	CSMAGIC_EMBEDDED_ENTITLEMENTS:     "embedded_entitlements",
+	CSMAGIC_EMBEDDED_DER_ENTITLEMENTS: "embedded_der_entitlements",
+}
+
+var csSlotNames = scalar.UintMapSymStr{
+	0x0:     "code_directory",
+	0x1:     "info",
+	0x2:     "requirements",
+	0x3:     "resource_dir",
+	0x4:     "application",
+	0x5:     "entitlements",
+	0x7:     "der_entitlements",
+	0x1000:  "alternate_code_directory0",
+	0x1001:  "alternate_code_directory1",
+	0x1002:  "alternate_code_directory2",
+	0x1003:  "alternate_code_directory3",
+	0x1004:  "alternate_code_directory4",
+	0x10000: "signature",
+}
+
+// special slots are negative index before hash_offset
+var csSpecialSlotNames = scalar.SintMapSymStr{
+	-1: "info",
+	-2: "requirements",
+	-3: "resource_dir",
+	-4: "application",
+	-5: "entitlements",
+	-7: "der_entitlements",
+}
+
+var csRequirementTypeNames = scalar.UintMapSymStr{
+	1: "host",
+	2: "guest",
+	3: "designated",
+	4: "library",
+	5: "plugin",
+}
+
+const (
+	CS_HASHTYPE_SHA1             = 1
+	CS_HASHTYPE_SHA256           = 2
+	CS_HASHTYPE_SHA256_TRUNCATED = 3
+	CS_HASHTYPE_SHA384           = 4
+)
+
+var csHashTypeNames = scalar.UintMapSymStr{
+	CS_HASHTYPE_SHA1:             "sha1",
+	CS_HASHTYPE_SHA256:           "sha256",
+	CS_HASHTYPE_SHA256_TRUNCATED: "sha256_truncated",
+	CS_HASHTYPE_SHA384:           "sha384",
+}
+
+var csFlagNames = map[uint64]string{
+	0x0000_0001: "valid",
+	0x0000_0002: "adhoc",
+	0x0000_0004: "get_task_allow",
+	0x0000_0008: "installer",
+	0x0000_0010: "forced_lv",
+	0x0000_0020: "invalid_allowed",
+	0x0000_0100: "hard",
+	0x0000_0200: "kill",
+	0x0000_0400: "check_expiration",
+	0x0000_0800: "restrict",
+	0x0000_1000: "enforcement",
+	0x0000_2000: "require_lv",
+	0x0000_4000: "entitlements_validated",
+	0x0000_8000: "nvram_unrestricted",
+	0x0001_0000: "runtime",
+	0x0002_0000: "linker_signed",
+}
+
+// code directory versions that adds fields
+const (
+	CS_SUPPORTSSCATTER     = 0x2_0100
+	CS_SUPPORTSTEAMID      = 0x2_0200
+	CS_SUPPORTSCODELIMIT64 = 0x2_0300
+	CS_SUPPORTSEXECSEG     = 0x2_0400
+	CS_SUPPORTSRUNTIME     = 0x2_0500
+	CS_SUPPORTSLINKAGE     = 0x2_0600
+)
+
+var pageSizeDescription = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual < 32 {
+		s.Description = fmt.Sprintf("%d", uint64(1)<<s.Actual)
+	}
+	return s, nil
+})
+
+func csHash(hashType uint64) hash.Hash {
+	switch hashType {
+	case CS_HASHTYPE_SHA1:
+		return sha1.New()
+	case CS_HASHTYPE_SHA256,
+		CS_HASHTYPE_SHA256_TRUNCATED:
+		return sha256.New()
+	case CS_HASHTYPE_SHA384:
+		return sha512.New384()
+	default:
+		return nil
+	}
+}
+
+func decodeCSFlags(d *decode.D) {
+	d.FieldStruct("flags", func(d *decode.D) {
+		v := d.FieldU32("value", scalar.UintHex)
+		for bit := uint64(1); bit <= 0x2_0000; bit <<= 1 {
+			if n, ok := csFlagNames[bit]; ok {
+				d.FieldValueBool(n, v&bit != 0)
+			}
+		}
+	})
+}
+
+// hashes of code pages are relative to start of the mach-o file, decoder position are absolute
+// within the mach-o file also when a range is used
+func decodeCodeDirectory(d *decode.D, cdStart int64, slotBlobs map[uint64][]byte) {
+	version := d.FieldU32("version", scalar.UintHex)
+	decodeCSFlags(d)
+	hashOffset := d.FieldU32("hash_offset")
+	identOffset := d.FieldU32("ident_offset")
+	nSpecialSlots := d.FieldU32("n_special_slots")
+	nCodeSlots := d.FieldU32("n_code_slots")
+	codeLimit := d.FieldU32("code_limit")
+	hashSize := d.FieldU8("hash_size")
+	hashType := d.FieldU8("hash_type", csHashTypeNames)
+	d.FieldU8("platform")
+	pageSizeLog2 := d.FieldU8("page_size", pageSizeDescription)
+	d.FieldU32("spare2")
+	var teamOffset uint64
+	if version >= CS_SUPPORTSSCATTER {
+		d.FieldU32("scatter_offset")
+	}
+	if version >= CS_SUPPORTSTEAMID {
+		teamOffset = d.FieldU32("team_offset")
+	}
+	if version >= CS_SUPPORTSCODELIMIT64 {
+		d.FieldU32("spare3")
+		if codeLimit64 := d.FieldU64("code_limit_64"); codeLimit64 != 0 {
+			codeLimit = codeLimit64
+		}
+	}
+	if version >= CS_SUPPORTSEXECSEG {
+		d.FieldU64("exec_seg_base", scalar.UintHex)
+		d.FieldU64("exec_seg_limit")
+		d.FieldU64("exec_seg_flags", scalar.UintHex)
+	}
+	if version >= CS_SUPPORTSRUNTIME {
+		d.FieldU32("runtime", scalar.UintHex)
+		d.FieldU32("pre_encrypt_offset")
+	}
+	if version >= CS_SUPPORTSLINKAGE {
+		d.FieldU8("linkage_hash_type", csHashTypeNames)
+		d.FieldU8("linkage_application_type")
+		d.FieldU16("linkage_application_sub_type")
+		d.FieldU32("linkage_offset")
+		d.FieldU32("linkage_size")
+	}
+
+	if identOffset != 0 {
+		d.SeekAbs(cdStart+int64(identOffset)*8, func(d *decode.D) {
+			d.FieldUTF8Null("identifier")
+		})
+	}
+	if teamOffset != 0 {
+		d.SeekAbs(cdStart+int64(teamOffset)*8, func(d *decode.D) {
+			d.FieldUTF8Null("team_id")
+		})
+	}
+
+	if hashSize == 0 || nSpecialSlots*hashSize > hashOffset {
+		return
+	}
+	// special slot -n is the hash of the superblob blob with slot type n
+	d.SeekAbs(cdStart+int64(hashOffset-nSpecialSlots*hashSize)*8, func(d *decode.D) {
+		d.FieldArray("special_slots", func(d *decode.D) {
+			for i := int64(nSpecialSlots); i > 0; i-- {
+				d.FieldStruct("slot", func(d *decode.D) {
+					d.FieldValueSint("index", -i, csSpecialSlotNames)
+					b, ok := slotBlobs[uint64(i)]
+					h := csHash(hashType)
+					if !ok || h == nil {
+						d.FieldRawLen("hash", int64(hashSize)*8, scalar.RawHex)
+						return
+					}
+					h.Write(b)
+					sum := h.Sum(nil)
+					if int(hashSize) <= len(sum) {
+						sum = sum[:hashSize]
+					}
+					d.FieldRawLen("hash", int64(hashSize)*8, d.ValidateBitBuf(sum), scalar.RawHex)
+				})
+			}
+		})
+	})
+	if pageSizeLog2 >= 32 {
+		d.Fatalf("invalid page size")
+	}
+	// zero page size means one page for all code
+	pageSize := int64(codeLimit)
+	if pageSizeLog2 != 0 {
+		pageSize = int64(1) << pageSizeLog2
+	}
+	d.SeekAbs(cdStart+int64(hashOffset)*8, func(d *decode.D) {
+		d.FieldArray("code_slots", func(d *decode.D) {
+			for i := int64(0); i < int64(nCodeSlots); i++ {
+				pageStart := i * pageSize
+				pageEnd := min(pageStart+pageSize, int64(codeLimit))
+				h := csHash(hashType)
+				if h == nil || pageEnd > d.Len()/8 || pageStart > pageEnd {
+					d.FieldRawLen("hash", int64(hashSize)*8, scalar.RawHex)
+					continue
+				}
+				h.Write(d.BytesRange(pageStart*8, int(pageEnd-pageStart)))
+				sum := h.Sum(nil)
+				if int(hashSize) <= len(sum) {
+					sum = sum[:hashSize]
+				}
+				d.FieldRawLen("hash", int64(hashSize)*8, d.ValidateBitBuf(sum), scalar.RawHex)
+			}
+		})
+	})
+}
+
+func decodeCSBlob(d *decode.D, slotBlobs map[uint64][]byte) {
+	blobStart := d.Pos()
+	magic := d.FieldU32("magic", csMagicNames, scalar.UintHex)
+	length := d.FieldU32("length")
+	if length < 8 {
+		d.Fatalf("invalid blob length %d", length)
+	}
+	d.FramedFn(int64(length-8)*8, func(d *decode.D) {
+		switch magic {
+		case CSMAGIC_EMBEDDED_SIGNATURE,
+			CSMAGIC_DETACHED_SIGNATURE:
+			count := d.FieldU32("count")
+			var offsets []uint64
+			slotBlobs := map[uint64][]byte{}
+			d.FieldArray("index", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("entry", func(d *decode.D) {
+						typ := d.FieldU32("type", csSlotNames, scalar.UintHex)
+						offset := d.FieldU32("offset")
+						offsets = append(offsets, offset)
+						// collect blob bytes to be able to validate code directory special slot hashes
+						d.SeekAbs(blobStart+int64(offset+4)*8, func(d *decode.D) {
+							l := d.U32()
+							slotBlobs[typ] = d.BytesRange(blobStart+int64(offset)*8, int(l))
+						})
+					})
+				}
+			})
+			d.FieldArray("blobs", func(d *decode.D) {
+				for _, o := range offsets {
+					d.SeekAbs(blobStart+int64(o)*8, func(d *decode.D) {
+						d.FieldStruct("blob", func(d *decode.D) { decodeCSBlob(d, slotBlobs) })
+					})
+				}
+			})
+		case CSMAGIC_CODEDIRECTORY:
+			decodeCodeDirectory(d, blobStart, slotBlobs)
+		case CSMAGIC_REQUIREMENTS:
+			count := d.FieldU32("count")
+			d.FieldArray("index", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("entry", func(d *decode.D) {
+						d.FieldU32("type", csRequirementTypeNames)
+						d.FieldU32("offset")
+					})
+				}
+			})
+			d.FieldRawLen("data", d.BitsLeft())
+		case CSMAGIC_EMBEDDED_ENTITLEMENTS:
+			d.FieldFormatOrRawLen("entitlements", d.BitsLeft(), &xmlGroup, nil)
+		case CSMAGIC_EMBEDDED_DER_ENTITLEMENTS:
+			d.FieldFormatOrRawLen("entitlements", d.BitsLeft(), &asn1BerGroup, nil)
+		case CSMAGIC_BLOBWRAPPER:
+			// cms signature, empty for ad-hoc signatures
+			if d.BitsLeft() > 0 {
+				d.FieldFormatOrRawLen("cms", d.BitsLeft(), &asn1BerGroup, nil)
+			}
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeCodeSignature(d *decode.D) {
+	d.Endian = decode.BigEndian
+	decodeCSBlob(d, nil)
+}
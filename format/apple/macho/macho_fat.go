@@ -24,7 +24,15 @@ func init() {
 		})
 }
 
-const FAT_MAGIC = 0xcafe_babe
+const (
+	FAT_MAGIC    = 0xcafe_babe
+	FAT_MAGIC_64 = 0xcafe_babf
+)
+
+var fatMagicSymMapper = scalar.UintMap{
+	FAT_MAGIC:    scalar.Uint{Sym: "fat", Description: "32-bit offsets"},
+	FAT_MAGIC_64: scalar.Uint{Sym: "fat64", Description: "64-bit offsets"},
+}
 
 func machoFatDecode(d *decode.D) any {
 	type ofile struct {
@@ -34,7 +42,7 @@ func machoFatDecode(d *decode.D) any {
 	var ofiles []ofile
 
 	d.FieldStruct("fat_header", func(d *decode.D) {
-		d.FieldU32("magic", magicSymMapper, scalar.UintHex, d.UintAssert(FAT_MAGIC))
+		magic := d.FieldU32("magic", fatMagicSymMapper, scalar.UintHex, d.UintAssert(FAT_MAGIC, FAT_MAGIC_64))
 
 		narchs := d.FieldU32("narchs")
 		d.FieldArray("archs", func(d *decode.D) {
@@ -43,9 +51,17 @@ func machoFatDecode(d *decode.D) any {
 					// beware cputype and cpusubtype changes from ofile header to fat header
 					cpuType := d.FieldU32("cputype", cpuTypes, scalar.UintHex)
 					d.FieldU32("cpusubtype", cpuSubTypes[cpuType], scalar.UintHex)
-					offset := d.FieldU32("offset", scalar.UintHex)
-					size := d.FieldU32("size")
-					d.FieldU32("align")
+					var offset, size uint64
+					if magic == FAT_MAGIC_64 {
+						offset = d.FieldU64("offset", scalar.UintHex)
+						size = d.FieldU64("size")
+						d.FieldU32("align")
+						d.FieldU32("reserved")
+					} else {
+						offset = d.FieldU32("offset", scalar.UintHex)
+						size = d.FieldU32("size")
+						d.FieldU32("align")
+					}
 
 					ofiles = append(ofiles, ofile{offset: int64(offset), size: int64(size)})
 				})
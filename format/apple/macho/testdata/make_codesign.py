@@ -0,0 +1,162 @@
+#!/usr/bin/env python3
+# re-signs darwin_aarch64/a_dynamic with a code signature that has requirements, xml and der
+# entitlements and a cms blob wrapper and wraps it in a 64-bit fat binary, similar to what
+# codesign --entitlements and lipo -create -fat64 would produce
+import hashlib
+import pathlib
+import struct
+
+here = pathlib.Path(__file__).parent
+
+LC_SEGMENT_64 = 0x19
+LC_CODE_SIGNATURE = 0x1D
+PAGE_SIZE_LOG2 = 12
+
+
+def blob(magic, data):
+    return struct.pack(">II", magic, 8 + len(data)) + data
+
+
+def der(tag, content):
+    n = len(content)
+    if n < 0x80:
+        return bytes([tag, n]) + content
+    l = n.to_bytes((n.bit_length() + 7) // 8, "big")
+    return bytes([tag, 0x80 | len(l)]) + l + content
+
+
+macho = bytearray((here / "darwin_aarch64" / "a_dynamic").read_bytes())
+ncmds, sizeofcmds = struct.unpack_from("<II", macho, 16)
+pos = 32
+linkedit_pos = None
+for _ in range(ncmds):
+    cmd, cmdsize = struct.unpack_from("<II", macho, pos)
+    if cmd == LC_SEGMENT_64 and macho[pos + 8 : pos + 24].rstrip(b"\x00") == b"__LINKEDIT":
+        linkedit_pos = pos
+    if cmd == LC_CODE_SIGNATURE:
+        cs_pos = pos
+    pos += cmdsize
+dataoff, _ = struct.unpack_from("<II", macho, cs_pos + 8)
+
+requirements = blob(0xFADE0C01, struct.pack(">I", 0))
+entitlements = blob(
+    0xFADE7171,
+    b"""<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>com.apple.security.app-sandbox</key>
+	<true/>
+</dict>
+</plist>
+""",
+)
+der_entitlements = blob(
+    0xFADE7172,
+    der(
+        0x70,
+        der(0x02, b"\x01") + der(0xB0, der(0x30, der(0x0C, b"com.apple.security.app-sandbox") + der(0x01, b"\xff"))),
+    ),
+)
+# pkcs7 signedData content info with a dummy signer and signature
+sha256 = der(0x30, der(0x06, bytes.fromhex("608648016503040201")))
+issuer = der(0x30, der(0x31, der(0x30, der(0x06, bytes.fromhex("550403")) + der(0x0C, b"Example"))))
+signer_info = der(
+    0x30,
+    der(0x02, b"\x01")
+    + der(0x30, issuer + der(0x02, b"\x01"))
+    + sha256
+    + der(0x30, der(0x06, bytes.fromhex("2a864886f70d010101")))
+    + der(0x04, bytes(8)),
+)
+cms = blob(
+    0xFADE0B01,
+    der(
+        0x30,
+        der(0x06, bytes.fromhex("2a864886f70d010702"))
+        + der(
+            0xA0,
+            der(
+                0x30,
+                der(0x02, b"\x01")
+                + der(0x31, sha256)
+                + der(0x30, der(0x06, bytes.fromhex("2a864886f70d010701")))
+                + der(0x31, signer_info),
+            ),
+        ),
+    ),
+)
+
+# slot type, blob
+slots = [(0x2, requirements), (0x5, entitlements), (0x7, der_entitlements)]
+n_special_slots = 7
+identifier = b"com.example.a_dynamic\x00"
+team_id = b"EXAMPLE123\x00"
+# code directory version 0x20400 header size
+cd_header_size = 88
+ident_offset = cd_header_size
+team_offset = ident_offset + len(identifier)
+hash_offset = team_offset + len(team_id) + 32 * n_special_slots
+n_code_slots = (dataoff + (1 << PAGE_SIZE_LOG2) - 1) >> PAGE_SIZE_LOG2
+cd_length = hash_offset + 32 * n_code_slots
+
+superblob_header_size = 12 + 8 * (len(slots) + 2)
+signature_size = superblob_header_size + cd_length + sum(len(b) for _, b in slots) + len(cms)
+
+# update code signature and __LINKEDIT sizes before hashing pages
+struct.pack_into("<I", macho, cs_pos + 12, signature_size)
+linkedit_fileoff = struct.unpack_from("<Q", macho, linkedit_pos + 40)[0]
+struct.pack_into("<Q", macho, linkedit_pos + 48, dataoff + signature_size - linkedit_fileoff)
+del macho[dataoff:]
+
+special_hashes = b""
+for i in range(n_special_slots, 0, -1):
+    b = dict(slots).get(i)
+    special_hashes += hashlib.sha256(b).digest() if b else bytes(32)
+code_hashes = b"".join(
+    hashlib.sha256(macho[i << PAGE_SIZE_LOG2 : min((i + 1) << PAGE_SIZE_LOG2, dataoff)]).digest() for i in range(n_code_slots)
+)
+code_directory = (
+    struct.pack(
+        ">IIIIIIIIIBBBBIIIIQQQQ",
+        0xFADE0C02,
+        cd_length,
+        0x20400,
+        0x0,
+        hash_offset,
+        ident_offset,
+        n_special_slots,
+        n_code_slots,
+        dataoff,
+        32,
+        2,
+        0,
+        PAGE_SIZE_LOG2,
+        0,
+        0,
+        team_offset,
+        0,
+        0,
+        0,
+        0x4000,
+        0x1,
+    )
+    + identifier
+    + team_id
+    + special_hashes
+    + code_hashes
+)
+assert len(code_directory) == cd_length
+
+index = b""
+blobs = b""
+for typ, b in [(0x0, code_directory)] + slots + [(0x10000, cms)]:
+    index += struct.pack(">II", typ, superblob_header_size + len(blobs))
+    blobs += b
+macho += struct.pack(">III", 0xFADE0CC0, signature_size, len(slots) + 2) + index + blobs
+
+# fat64 header with one arm64 slice aligned to 2^14
+align = 14
+fat = struct.pack(">II", 0xCAFEBABF, 1) + struct.pack(">IIQQII", 0x0100000C, 0, 1 << align, len(macho), align, 0)
+fat += bytes((1 << align) - len(fat))
+(here / "codesign" / "a_dynamic_fat64").write_bytes(fat + macho)
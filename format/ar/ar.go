@@ -27,7 +27,7 @@ func decodeAr(d *decode.D) any {
 	d.FieldArray("files", func(d *decode.D) {
 		for !d.End() {
 			d.FieldStruct("file", func(d *decode.D) {
-				d.FieldUTF8("identifier", 16, scalar.ActualTrimSpace)
+				d.FieldStrPadded("identifier", 16, decode.PaddedTextSpace)
 				d.FieldUTF8("modification_timestamp", 12, scalar.ActualTrimSpace, scalar.TryStrSymParseUint(10))
 				d.FieldUTF8("owner_id", 6, scalar.ActualTrimSpace, scalar.TryStrSymParseUint(10))
 				d.FieldUTF8("group_id", 6, scalar.ActualTrimSpace, scalar.TryStrSymParseUint(10))
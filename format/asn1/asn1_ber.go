@@ -168,16 +168,10 @@ func decodeTagNumber(d *decode.D) uint64 {
 	return v
 }
 
-func decodeASN1BERValue(d *decode.D, bib *bitio.Buffer, sb *strings.Builder, parentForm uint64, parentTag uint64) {
-	class := d.FieldU2("class", tagClassMap)
-	form := d.FieldU1("form", constructedPrimitiveMap)
-
-	// TODO: verify
-	// TODO: constructed types verify
-	_ = parentTag
-	_ = parentForm
+func decodeASN1BERHeader(d *decode.D) (class uint64, form uint64, tag uint64, length uint64) {
+	class = d.FieldU2("class", tagClassMap)
+	form = d.FieldU1("form", constructedPrimitiveMap)
 
-	var tag uint64
 	switch class {
 	case classUniversal:
 		tag = d.FieldUintFn("tag", decodeTagNumber, universalTypeMap, scalar.UintHex)
@@ -185,7 +179,19 @@ func decodeASN1BERValue(d *decode.D, bib *bitio.Buffer, sb *strings.Builder, par
 		tag = d.FieldUintFn("tag", decodeTagNumber)
 	}
 
-	length := d.FieldUintFn("length", decodeLength, lengthMap)
+	length = d.FieldUintFn("length", decodeLength, lengthMap)
+
+	return class, form, tag, length
+}
+
+func decodeASN1BERValue(d *decode.D, bib *bitio.Buffer, sb *strings.Builder, parentForm uint64, parentTag uint64) {
+	class, form, tag, length := decodeASN1BERHeader(d)
+
+	// TODO: verify
+	// TODO: constructed types verify
+	_ = parentTag
+	_ = parentForm
+
 	var l int64
 	switch length {
 	case lengthIndefinite:
@@ -298,13 +304,14 @@ func decodeASN1BERValue(d *decode.D, bib *bitio.Buffer, sb *strings.Builder, par
 		case class == classUniversal && tag == universalTypeNull:
 			d.FieldValueAny("value", nil)
 		case class == classUniversal && tag == universalTypeObjectIdentifier:
+			var oid []string
 			d.FieldArray("value", func(d *decode.D) {
 				// first byte is = oid0*40 + oid1
-				d.FieldUintFn("oid", func(d *decode.D) uint64 { return d.U8() / 40 })
+				oid = append(oid, strconv.FormatUint(d.FieldUintFn("oid", func(d *decode.D) uint64 { return d.U8() / 40 }), 10))
 				d.SeekRel(-8)
-				d.FieldUintFn("oid", func(d *decode.D) uint64 { return d.U8() % 40 })
+				oid = append(oid, strconv.FormatUint(d.FieldUintFn("oid", func(d *decode.D) uint64 { return d.U8() % 40 }), 10))
 				for !d.End() {
-					d.FieldUintFn("oid", func(d *decode.D) uint64 {
+					n := d.FieldUintFn("oid", func(d *decode.D) uint64 {
 						more := true
 						var n uint64
 						for more {
@@ -314,8 +321,10 @@ func decodeASN1BERValue(d *decode.D, bib *bitio.Buffer, sb *strings.Builder, par
 						}
 						return n
 					})
+					oid = append(oid, strconv.FormatUint(n, 10))
 				}
 			})
+			d.FieldValueStr("oid", strings.Join(oid, "."), oidNames)
 		case class == classUniversal && tag == universalTypeObjectDescriptor: // not encoded, just documentation?
 			// nop
 		case class == classUniversal && tag == universalTypeExternal:
@@ -0,0 +1,80 @@
+package asn1
+
+// helpers to decode DER with a known structure, objects are decoded as
+// structs with header fields and named children or a generic value
+
+import (
+	"github.com/wader/fq/pkg/decode"
+)
+
+// derPeek returns class, form and tag of next object, tag numbers >= 31 are returned as 31
+func derPeek(d *decode.D) (class uint64, form uint64, tag uint64, ok bool) {
+	if d.BitsLeft() < 16 {
+		return 0, 0, 0, false
+	}
+	b := d.PeekUintBits(8)
+	return b >> 6, (b >> 5) & 1, b & 0x1f, true
+}
+
+func derIs(d *decode.D, class uint64, tag uint64) bool {
+	c, _, t, ok := derPeek(d)
+	return ok && c == class && t == tag
+}
+
+func derExpect(d *decode.D, name string, class uint64, tag uint64) {
+	c, _, t, ok := derPeek(d)
+	if !ok {
+		d.Fatalf("%s: missing", name)
+	}
+	if c != class || t != tag {
+		d.Fatalf("%s: expected %s tag %d found %s tag %d", name, tagClassMap[class], tag, tagClassMap[c], t)
+	}
+}
+
+// derObject decodes a universal object using the generic decoder
+func derObject(d *decode.D, name string, tag uint64) {
+	derExpect(d, name, classUniversal, tag)
+	d.FieldStruct(name, func(d *decode.D) {
+		decodeASN1BERValue(d, nil, nil, formConstructed, universalTypeSequence)
+	})
+}
+
+// derAny decodes any object using the generic decoder
+func derAny(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		decodeASN1BERValue(d, nil, nil, formConstructed, universalTypeSequence)
+	})
+}
+
+// derConstructed decodes header of a constructed object and its content using fn,
+// DER always has definite lengths
+func derConstructed(d *decode.D, name string, class uint64, tag uint64, fn func(d *decode.D)) {
+	derExpect(d, name, class, tag)
+	d.FieldStruct(name, func(d *decode.D) {
+		_, form, _, length := decodeASN1BERHeader(d)
+		if form != formConstructed {
+			d.Fatalf("%s: not constructed", name)
+		}
+		if length == lengthIndefinite {
+			d.Fatalf("%s: indefinite length", name)
+		}
+		d.FramedFn(int64(length)*8, fn)
+	})
+}
+
+// derRaw returns bytes of the complete object at current position
+func derRaw(d *decode.D) []byte {
+	start := d.Pos()
+	var end int64
+	d.RangeFn(start, d.BitsLeft(), func(d *decode.D) {
+		// decode header unnamed to find out size
+		d.U3()
+		decodeTagNumber(d)
+		l := decodeLength(d)
+		end = d.Pos() + int64(l)*8
+	})
+	if end > start+d.BitsLeft() {
+		d.Fatalf("object length outside of parent")
+	}
+	return d.BytesRange(start, int((end-start)/8))
+}
@@ -0,0 +1,228 @@
+package asn1
+
+// https://www.theiphonewiki.com/wiki/IMG4_File_Format
+// https://github.com/xerub/img4lib
+// https://github.com/tihmstar/img4tool
+
+import (
+	"embed"
+	goasn1 "encoding/asn1"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed img4.md
+var img4FS embed.FS
+
+var img4ProbeGroup decode.Group
+var img4ASN1BerGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.IMG4,
+		&decode.Format{
+			Description: "Apple IMG4 image, payload and manifest",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeIMG4,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &img4ProbeGroup},
+				{Groups: []*decode.Group{format.ASN1_BER}, Out: &img4ASN1BerGroup},
+			},
+		})
+	interp.RegisterFS(img4FS)
+}
+
+const (
+	img4MagicIMG4 = "IMG4"
+	img4MagicIM4P = "IM4P"
+	img4MagicIM4M = "IM4M"
+	img4MagicIM4R = "IM4R"
+)
+
+var im4pCompressionNames = scalar.UintMapSymStr{
+	1: "lzfse",
+}
+
+// img4Elements returns the elements of the sequence at current position
+func img4Elements(d *decode.D) []goasn1.RawValue {
+	var seq goasn1.RawValue
+	if _, err := goasn1.Unmarshal(derRaw(d), &seq); err != nil {
+		d.Fatalf("%s", err)
+	}
+	var elements []goasn1.RawValue
+	for rest := seq.Bytes; len(rest) > 0; {
+		var e goasn1.RawValue
+		var err error
+		if rest, err = goasn1.Unmarshal(rest, &e); err != nil {
+			d.Fatalf("%s", err)
+		}
+		elements = append(elements, e)
+	}
+	return elements
+}
+
+// img4Magic returns the magic IA5String that is first in all IMG4 sequences
+func img4Magic(elements []goasn1.RawValue) string {
+	if len(elements) == 0 || elements[0].Class != classUniversal || elements[0].Tag != universalTypeIA5String {
+		return ""
+	}
+	return string(elements[0].Bytes)
+}
+
+func img4Sequence(d *decode.D, name string, magic string, fn func(d *decode.D, elements []goasn1.RawValue)) {
+	elements := img4Elements(d)
+	if m := img4Magic(elements); m != magic {
+		d.Fatalf("%s: expected magic %q found %q", name, magic, m)
+	}
+	derConstructed(d, name, classUniversal, universalTypeSequence, func(d *decode.D) {
+		derObject(d, "magic", universalTypeIA5String)
+		fn(d, elements)
+	})
+}
+
+func decodeIM4P(d *decode.D, elements []goasn1.RawValue) {
+	derObject(d, "type", universalTypeIA5String)
+	derObject(d, "description", universalTypeIA5String)
+
+	// keybags and compression info comes after the data
+	var encrypted, compressed bool
+	for _, e := range elements[min(len(elements), 4):] {
+		switch {
+		case e.Class == classUniversal && e.Tag == universalTypeOctetString:
+			encrypted = true
+		case e.Class == classUniversal && e.Tag == universalTypeSequence:
+			compressed = true
+		}
+	}
+
+	derExpect(d, "data", classUniversal, universalTypeOctetString)
+	d.FieldStruct("data", func(d *decode.D) {
+		_, form, _, length := decodeASN1BERHeader(d)
+		if form != formPrimitive || length == lengthIndefinite {
+			d.Fatalf("data: not a definite length primitive")
+		}
+		if encrypted || compressed {
+			d.FieldRawLen("value", int64(length)*8)
+		} else {
+			d.FieldFormatOrRawLen("value", int64(length)*8, &img4ProbeGroup, format.Probe_In{})
+		}
+	})
+
+	if derIs(d, classUniversal, universalTypeOctetString) {
+		derExpect(d, "keybags", classUniversal, universalTypeOctetString)
+		d.FieldStruct("keybags", func(d *decode.D) {
+			_, _, _, length := decodeASN1BERHeader(d)
+			d.FieldFormatOrRawLen("value", int64(length)*8, &img4ASN1BerGroup, nil)
+		})
+	}
+	if derIs(d, classUniversal, universalTypeSequence) {
+		derConstructed(d, "compression", classUniversal, universalTypeSequence, func(d *decode.D) {
+			derExpect(d, "algorithm", classUniversal, universalTypeInteger)
+			d.FieldStruct("algorithm", func(d *decode.D) {
+				_, _, _, length := decodeASN1BERHeader(d)
+				d.FieldU("value", int(length)*8, im4pCompressionNames)
+			})
+			derObject(d, "uncompressed_size", universalTypeInteger)
+		})
+	}
+	if !d.End() {
+		d.FieldArray("unknown", func(d *decode.D) {
+			for !d.End() {
+				derAny(d, "object")
+			}
+		})
+	}
+}
+
+// properties are private class tagged with a fourcc and contain a sequence with
+// the fourcc as a string and a value or a set with more properties
+func decodeIMG4Properties(d *decode.D) {
+	d.FieldArray("properties", func(d *decode.D) {
+		for !d.End() {
+			c, _, _, _ := derPeek(d)
+			if c != classPrivate {
+				derAny(d, "object")
+				continue
+			}
+			d.FieldStruct("property", func(d *decode.D) {
+				_, form, _, length := decodeASN1BERHeader(d)
+				if form != formConstructed || length == lengthIndefinite {
+					d.Fatalf("property: not a definite length constructed")
+				}
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					derConstructed(d, "sequence", classUniversal, universalTypeSequence, func(d *decode.D) {
+						derObject(d, "name", universalTypeIA5String)
+						if derIs(d, classUniversal, universalTypeSet) {
+							derConstructed(d, "value", classUniversal, universalTypeSet, decodeIMG4Properties)
+						} else {
+							derAny(d, "value")
+						}
+					})
+				})
+			})
+		}
+	})
+}
+
+func decodeIM4M(d *decode.D, elements []goasn1.RawValue) {
+	derObject(d, "version", universalTypeInteger)
+	derConstructed(d, "body", classUniversal, universalTypeSet, decodeIMG4Properties)
+	derObject(d, "signature", universalTypeOctetString)
+	derConstructed(d, "certificates", classUniversal, universalTypeSequence, func(d *decode.D) {
+		d.FieldArray("entries", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("certificate", func(d *decode.D) { decodeX509Certificate(d) })
+			}
+		})
+	})
+}
+
+func decodeIM4R(d *decode.D, elements []goasn1.RawValue) {
+	derConstructed(d, "body", classUniversal, universalTypeSet, decodeIMG4Properties)
+}
+
+func decodeIMG4(d *decode.D) any {
+	derExpect(d, "img4", classUniversal, universalTypeSequence)
+	elements := img4Elements(d)
+	magic := img4Magic(elements)
+
+	var fn func(d *decode.D, elements []goasn1.RawValue)
+	switch magic {
+	case img4MagicIMG4:
+		fn = func(d *decode.D, elements []goasn1.RawValue) {
+			img4Sequence(d, "payload", img4MagicIM4P, decodeIM4P)
+			if derIs(d, classContext, 0) {
+				derConstructed(d, "manifest", classContext, 0, func(d *decode.D) {
+					img4Sequence(d, "manifest", img4MagicIM4M, decodeIM4M)
+				})
+			}
+			if derIs(d, classContext, 1) {
+				derConstructed(d, "restore_info", classContext, 1, func(d *decode.D) {
+					img4Sequence(d, "restore_info", img4MagicIM4R, decodeIM4R)
+				})
+			}
+		}
+	case img4MagicIM4P:
+		fn = decodeIM4P
+	case img4MagicIM4M:
+		fn = decodeIM4M
+	case img4MagicIM4R:
+		fn = decodeIM4R
+	default:
+		d.Fatalf("unknown magic %q", magic)
+	}
+
+	_, form, _, length := decodeASN1BERHeader(d)
+	if form != formConstructed || length == lengthIndefinite {
+		d.Fatalf("not a definite length constructed sequence")
+	}
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		derObject(d, "magic", universalTypeIA5String)
+		fn(d, elements)
+	})
+
+	return nil
+}
@@ -0,0 +1,105 @@
+#!/usr/bin/env python3
+# generates img4 test files, payload is 4x4.png from png testdata
+import pathlib
+
+here = pathlib.Path(__file__).parent
+
+
+def length(n):
+    if n < 0x80:
+        return bytes([n])
+    b = n.to_bytes((n.bit_length() + 7) // 8, "big")
+    return bytes([0x80 | len(b)]) + b
+
+
+def tlv(tag, v):
+    return tag + length(len(v)) + v
+
+
+def seq(*vs):
+    return tlv(b"\x30", b"".join(vs))
+
+
+def set_(*vs):
+    return tlv(b"\x31", b"".join(vs))
+
+
+def ia5(s):
+    return tlv(b"\x16", s.encode())
+
+
+def octets(b):
+    return tlv(b"\x04", b)
+
+
+def integer(n):
+    return tlv(b"\x02", n.to_bytes(max(1, (n.bit_length() + 8) // 8), "big"))
+
+
+def boolean(v):
+    return tlv(b"\x01", b"\xff" if v else b"\x00")
+
+
+def context(n, v):
+    return tlv(bytes([0xa0 | n]), v)
+
+
+def prop(name, value):
+    # private constructed tag with fourcc as multi byte tag number
+    n = int.from_bytes(name.encode(), "big")
+    tn = []
+    while True:
+        tn.insert(0, n & 0x7F)
+        n >>= 7
+        if n == 0:
+            break
+    tag = bytes([0xFF] + [b | 0x80 for b in tn[:-1]] + [tn[-1]])
+    return tlv(tag, seq(ia5(name), value))
+
+
+png = (here / "../../png/testdata/4x4.png").read_bytes()
+cert = (here / "letsencrypt-x3.der").read_bytes()
+
+im4p = seq(ia5("IM4P"), ia5("krnl"), ia5("KernelCache"), octets(png))
+im4m = seq(
+    ia5("IM4M"),
+    integer(0),
+    set_(
+        prop(
+            "MANB",
+            set_(
+                prop(
+                    "MANP",
+                    set_(
+                        prop("BNCH", octets(bytes(range(32)))),
+                        prop("CHIP", integer(0x8015)),
+                        prop("ECID", integer(0x1234567890)),
+                    ),
+                ),
+                prop(
+                    "krnl",
+                    set_(
+                        prop("DGST", octets(bytes(range(48)))),
+                        prop("EPRO", boolean(True)),
+                    ),
+                ),
+            ),
+        ),
+    ),
+    octets(bytes(range(64))),
+    seq(cert),
+)
+im4r = seq(ia5("IM4R"), set_(prop("BNCN", octets(bytes(8)))))
+
+(here / "test.img4").write_bytes(seq(ia5("IMG4"), im4p, context(0, im4m), context(1, im4r)))
+(here / "test.im4m").write_bytes(im4m)
+(here / "encrypted.im4p").write_bytes(
+    seq(
+        ia5("IM4P"),
+        ia5("ibot"),
+        ia5("iBoot"),
+        octets(bytes(range(16))),
+        octets(seq(seq(integer(1), octets(bytes(16)), octets(bytes(32))))),
+        seq(integer(1), integer(1234)),
+    )
+)
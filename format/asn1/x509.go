@@ -0,0 +1,184 @@
+package asn1
+
+// https://www.rfc-editor.org/rfc/rfc5280#section-4.1
+
+import (
+	"crypto/x509/pkix"
+	"embed"
+	goasn1 "encoding/asn1"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed x509_certificate.md
+var x509FS embed.FS
+
+var x509ASN1BerGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.X509_Certificate,
+		&decode.Format{
+			Description: "X.509 certificate (DER)",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeX509Certificate,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.ASN1_BER}, Out: &x509ASN1BerGroup},
+			},
+		})
+	interp.RegisterFS(x509FS)
+}
+
+func x509AlgorithmIdentifier(d *decode.D, name string) {
+	derConstructed(d, name, classUniversal, universalTypeSequence, func(d *decode.D) {
+		derObject(d, "algorithm", universalTypeObjectIdentifier)
+		if !d.End() {
+			derAny(d, "parameters")
+		}
+	})
+}
+
+func x509Name(d *decode.D, name string) {
+	var rdns pkix.RDNSequence
+	if _, err := goasn1.Unmarshal(derRaw(d), &rdns); err != nil {
+		d.Fatalf("%s: %s", name, err)
+	}
+
+	derConstructed(d, name, classUniversal, universalTypeSequence, func(d *decode.D) {
+		d.FieldArray("rdns", func(d *decode.D) {
+			for !d.End() {
+				derConstructed(d, "rdn", classUniversal, universalTypeSet, func(d *decode.D) {
+					d.FieldArray("attributes", func(d *decode.D) {
+						for !d.End() {
+							derConstructed(d, "attribute", classUniversal, universalTypeSequence, func(d *decode.D) {
+								derObject(d, "type", universalTypeObjectIdentifier)
+								derAny(d, "value")
+							})
+						}
+					})
+				})
+			}
+		})
+		d.FieldValueStr("string", rdns.String())
+	})
+}
+
+// UTCTime or GeneralizedTime, description is the time in RFC 3339
+func x509Time(d *decode.D, name string) {
+	var t time.Time
+	if _, err := goasn1.Unmarshal(derRaw(d), &t); err != nil {
+		d.Fatalf("%s: %s", name, err)
+	}
+	d.FieldStruct(name, func(d *decode.D) {
+		_, _, tag, length := decodeASN1BERHeader(d)
+		if tag != universalTypeUTCTime && tag != universalTypeGeneralizedtime {
+			d.Fatalf("%s: not a time", name)
+		}
+		d.FieldUTF8("value", int(length), scalar.StrDescription(t.UTC().Format(time.RFC3339)))
+	})
+}
+
+func x509Extension(d *decode.D) {
+	derConstructed(d, "extension", classUniversal, universalTypeSequence, func(d *decode.D) {
+		derObject(d, "extn_id", universalTypeObjectIdentifier)
+		if derIs(d, classUniversal, universalTypeBoolean) {
+			derObject(d, "critical", universalTypeBoolean)
+		}
+		// OCTET STRING with DER encoding of the extension value
+		derExpect(d, "extn_value", classUniversal, universalTypeOctetString)
+		d.FieldStruct("extn_value", func(d *decode.D) {
+			_, form, _, length := decodeASN1BERHeader(d)
+			if form != formPrimitive {
+				d.Fatalf("extn_value: not primitive")
+			}
+			d.FieldFormatOrRawLen("value", int64(length)*8, &x509ASN1BerGroup, nil)
+		})
+	})
+}
+
+func x509SubjectPublicKeyInfo(d *decode.D) {
+	derConstructed(d, "subject_public_key_info", classUniversal, universalTypeSequence, func(d *decode.D) {
+		var algorithm string
+		derConstructed(d, "algorithm", classUniversal, universalTypeSequence, func(d *decode.D) {
+			var oid goasn1.ObjectIdentifier
+			if _, err := goasn1.Unmarshal(derRaw(d), &oid); err == nil {
+				algorithm = oid.String()
+			}
+			derObject(d, "algorithm", universalTypeObjectIdentifier)
+			if !d.End() {
+				derAny(d, "parameters")
+			}
+		})
+
+		derExpect(d, "subject_public_key", classUniversal, universalTypeBitString)
+		d.FieldStruct("subject_public_key", func(d *decode.D) {
+			_, form, _, length := decodeASN1BERHeader(d)
+			if form != formPrimitive || length < 1 {
+				d.Fatalf("subject_public_key: invalid bit string")
+			}
+			d.FieldU8("unused_bits_count", d.UintAssert(0))
+			// RSAPublicKey is DER, other key types are just bytes, ex: EC point
+			if algorithm == oidRSAEncryption {
+				d.FieldFormatOrRawLen("value", int64(length-1)*8, &x509ASN1BerGroup, nil)
+			} else {
+				d.FieldRawLen("value", int64(length-1)*8)
+			}
+		})
+	})
+}
+
+func x509TBSCertificate(d *decode.D) {
+	derConstructed(d, "tbs_certificate", classUniversal, universalTypeSequence, func(d *decode.D) {
+		// version is DEFAULT v1 and is then not encoded
+		if derIs(d, classContext, 0) {
+			derConstructed(d, "version", classContext, 0, func(d *decode.D) {
+				derObject(d, "version", universalTypeInteger)
+			})
+		}
+		derObject(d, "serial_number", universalTypeInteger)
+		x509AlgorithmIdentifier(d, "signature")
+		x509Name(d, "issuer")
+		derConstructed(d, "validity", classUniversal, universalTypeSequence, func(d *decode.D) {
+			x509Time(d, "not_before")
+			x509Time(d, "not_after")
+		})
+		x509Name(d, "subject")
+		x509SubjectPublicKeyInfo(d)
+		if derIs(d, classContext, 1) {
+			derAny(d, "issuer_unique_id")
+		}
+		if derIs(d, classContext, 2) {
+			derAny(d, "subject_unique_id")
+		}
+		if derIs(d, classContext, 3) {
+			derConstructed(d, "extensions", classContext, 3, func(d *decode.D) {
+				derConstructed(d, "extensions", classUniversal, universalTypeSequence, func(d *decode.D) {
+					d.FieldArray("entries", func(d *decode.D) {
+						for !d.End() {
+							x509Extension(d)
+						}
+					})
+				})
+			})
+		}
+	})
+}
+
+func decodeX509Certificate(d *decode.D) any {
+	derExpect(d, "certificate", classUniversal, universalTypeSequence)
+	_, form, _, length := decodeASN1BERHeader(d)
+	if form != formConstructed || length == lengthIndefinite {
+		d.Fatalf("certificate: not a definite length constructed sequence")
+	}
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		x509TBSCertificate(d)
+		x509AlgorithmIdentifier(d, "signature_algorithm")
+		derObject(d, "signature_value", universalTypeBitString)
+	})
+
+	return nil
+}
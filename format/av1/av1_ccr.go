@@ -11,12 +11,17 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+var av1CCRObuGroup decode.Group
+
 func init() {
 	interp.RegisterFormat(
 		format.AV1_CCR,
 		&decode.Format{
 			Description: "AV1 Codec Configuration Record",
 			DecodeFn:    ccrDecode,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.AV1_OBU}, Out: &av1CCRObuGroup},
+			},
 		})
 }
 
@@ -39,9 +44,17 @@ func ccrDecode(d *decode.D) any {
 	} else {
 		d.FieldU4("reserved")
 	}
+	var si format.AV1_Sequence_Header_State
 	if d.BitsLeft() > 0 {
-		d.FieldRawLen("config_obus", d.BitsLeft())
+		d.FieldArray("config_obus", func(d *decode.D) {
+			for d.NotEnd() {
+				_, v := d.FieldFormat("obu", &av1CCRObuGroup, si)
+				if so, ok := v.(format.AV1_Sequence_Header_State); ok {
+					si = so
+				}
+			}
+		})
 	}
 
-	return nil
+	return si
 }
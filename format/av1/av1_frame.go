@@ -27,8 +27,14 @@ func init() {
 }
 
 func frameDecode(d *decode.D) any {
+	var si format.AV1_Sequence_Header_State
+	d.ArgAs(&si)
+
 	for d.NotEnd() {
-		d.FieldFormat("obu", &av1FrameObuGroup, nil)
+		_, v := d.FieldFormat("obu", &av1FrameObuGroup, si)
+		if so, ok := v.(format.AV1_Sequence_Header_State); ok {
+			si = so
+		}
 	}
 
 	return nil
@@ -0,0 +1,711 @@
+package av1
+
+// https://aomediacodec.github.io/av1-spec/#uncompressed-header-syntax
+//
+// Some syntax elements depend on state from previously decoded frames (reference frame
+// sizes, order hints and segmentation data). When such an element is reached decoding
+// stops and the rest of the header is left undecoded.
+
+import (
+	"math/bits"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	numRefFrames    = 8
+	refsPerFrame    = 7
+	primaryRefNone  = 7
+	maxSegments     = 8
+	segLvlMax       = 8
+	segLvlAltQ      = 0
+	superresNum     = 8
+	superresDenMin  = 9
+	maxTileWidth    = 4096
+	maxTileArea     = 4096 * 2304
+	maxTileRows     = 64
+	maxTileCols     = 64
+	frameTypeKey    = 0
+	frameTypeInter  = 1
+	frameTypeIntra  = 2
+	frameTypeSwitch = 3
+)
+
+var frameTypeNames = scalar.UintMapSymStr{
+	frameTypeKey:    "key_frame",
+	frameTypeInter:  "inter_frame",
+	frameTypeIntra:  "intra_only_frame",
+	frameTypeSwitch: "switch_frame",
+}
+
+var interpolationFilterNames = scalar.UintMapSymStr{
+	0: "eighttap",
+	1: "eighttap_smooth",
+	2: "eighttap_sharp",
+	3: "bilinear",
+}
+
+var lrTypeNames = scalar.UintMapSymStr{
+	0: "none",
+	1: "switchable",
+	2: "wiener",
+	3: "sgrproj",
+}
+
+var segmentationFeatureBits = [segLvlMax]int{8, 6, 6, 6, 6, 3, 0, 0}
+var segmentationFeatureSigned = [segLvlMax]bool{true, true, true, true, true, false, false, false}
+var segmentationFeatureMax = [segLvlMax]int64{255, 63, 63, 63, 63, 7, 0, 0}
+
+type frameHeader struct {
+	frameType            uint64
+	frameIsIntra         bool
+	showFrame            bool
+	showableFrame        bool
+	errorResilientMode   bool
+	frameSizeOverride    bool
+	allowScreenContent   bool
+	forceIntegerMV       bool
+	primaryRefFrame      uint64
+	allowIntrabc         bool
+	sizeKnown            bool
+	frameWidth           uint64
+	frameHeight          uint64
+	upscaledWidth        uint64
+	miCols               uint64
+	miRows               uint64
+	baseQIdx             uint64
+	deltaQNonZero        bool
+	segmentationEnabled  bool
+	featureEnabled       [maxSegments][segLvlMax]bool
+	featureData          [maxSegments][segLvlMax]int64
+	deltaQPresent        bool
+	codedLossless        bool
+	allLossless          bool
+	numPlanes            int
+	refreshFrameFlagsAll bool
+}
+
+func clip3(lo int64, hi int64, v int64) int64 {
+	return max(lo, min(hi, v))
+}
+
+// 4.10.7 ns(n)
+func ns(d *decode.D, n uint64) uint64 {
+	w := bits.Len64(n)
+	m := (uint64(1) << w) - n
+	v := d.U(w - 1)
+	if v < m {
+		return v
+	}
+	extraBit := d.U1()
+	return (v << 1) - m + extraBit
+}
+
+func tileLog2(blkSize uint64, target uint64) int {
+	k := 0
+	for (blkSize << k) < target {
+		k++
+	}
+	return k
+}
+
+func decodeTemporalPointInfo(d *decode.D, sh *format.AV1_Sequence_Header) {
+	d.FieldU("frame_presentation_time", sh.FramePresentationTimeLength)
+}
+
+func decodeSuperresParams(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	superresDenom := uint64(superresNum)
+	if sh.EnableSuperres && d.FieldBool("use_superres") {
+		superresDenom = d.FieldU3("coded_denom", scalar.UintActualAdd(superresDenMin))
+	}
+	fh.upscaledWidth = fh.frameWidth
+	fh.frameWidth = (fh.upscaledWidth*superresNum + (superresDenom / 2)) / superresDenom
+}
+
+func computeImageSize(fh *frameHeader) {
+	fh.miCols = 2 * ((fh.frameWidth + 7) >> 3)
+	fh.miRows = 2 * ((fh.frameHeight + 7) >> 3)
+}
+
+func decodeFrameSize(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	if fh.frameSizeOverride {
+		fh.frameWidth = d.FieldU("frame_width", sh.FrameWidthBits, scalar.UintActualAdd(1))
+		fh.frameHeight = d.FieldU("frame_height", sh.FrameHeightBits, scalar.UintActualAdd(1))
+	} else {
+		fh.frameWidth = sh.MaxFrameWidth
+		fh.frameHeight = sh.MaxFrameHeight
+	}
+	decodeSuperresParams(d, sh, fh)
+	computeImageSize(fh)
+	fh.sizeKnown = true
+}
+
+func decodeRenderSize(d *decode.D) {
+	if d.FieldBool("render_and_frame_size_different") {
+		d.FieldU16("render_width", scalar.UintActualAdd(1))
+		d.FieldU16("render_height", scalar.UintActualAdd(1))
+	}
+}
+
+func decodeFrameSizeWithRefs(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	foundRef := false
+	d.FieldArray("found_refs", func(d *decode.D) {
+		for i := 0; i < refsPerFrame; i++ {
+			if foundRef = d.FieldBool("found_ref"); foundRef {
+				break
+			}
+		}
+	})
+	if !foundRef {
+		decodeFrameSize(d, sh, fh)
+		decodeRenderSize(d)
+		return
+	}
+	// size comes from a reference frame so only the superres syntax can be decoded
+	if sh.EnableSuperres && d.FieldBool("use_superres") {
+		d.FieldU3("coded_denom", scalar.UintActualAdd(superresDenMin))
+	}
+}
+
+func decodeTileInfo(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	var sbCols, sbRows uint64
+	sbShift := 4
+	if sh.Use128x128Superblock {
+		sbCols = (fh.miCols + 31) >> 5
+		sbRows = (fh.miRows + 31) >> 5
+		sbShift = 5
+	} else {
+		sbCols = (fh.miCols + 15) >> 4
+		sbRows = (fh.miRows + 15) >> 4
+	}
+	sbSize := sbShift + 2
+	maxTileWidthSb := uint64(maxTileWidth >> sbSize)
+	maxTileAreaSb := uint64(maxTileArea >> (2 * sbSize))
+	minLog2TileCols := tileLog2(maxTileWidthSb, sbCols)
+	maxLog2TileCols := tileLog2(1, min(sbCols, maxTileCols))
+	maxLog2TileRows := tileLog2(1, min(sbRows, maxTileRows))
+	minLog2Tiles := max(minLog2TileCols, tileLog2(maxTileAreaSb, sbRows*sbCols))
+
+	var tileCols, tileRows int
+	var tileColsLog2, tileRowsLog2 int
+	if d.FieldBool("uniform_tile_spacing_flag") {
+		tileColsLog2 = minLog2TileCols
+		for tileColsLog2 < maxLog2TileCols {
+			if !d.FieldBool("increment_tile_cols_log2") {
+				break
+			}
+			tileColsLog2++
+		}
+		tileWidthSb := (sbCols + (1 << tileColsLog2) - 1) >> tileColsLog2
+		for startSb := uint64(0); startSb < sbCols; startSb += tileWidthSb {
+			tileCols++
+		}
+
+		tileRowsLog2 = max(minLog2Tiles-tileColsLog2, 0)
+		for tileRowsLog2 < maxLog2TileRows {
+			if !d.FieldBool("increment_tile_rows_log2") {
+				break
+			}
+			tileRowsLog2++
+		}
+		tileHeightSb := (sbRows + (1 << tileRowsLog2) - 1) >> tileRowsLog2
+		for startSb := uint64(0); startSb < sbRows; startSb += tileHeightSb {
+			tileRows++
+		}
+	} else {
+		widestTileSb := uint64(0)
+		d.FieldArray("tile_widths", func(d *decode.D) {
+			for startSb := uint64(0); startSb < sbCols; tileCols++ {
+				maxWidth := min(sbCols-startSb, maxTileWidthSb)
+				sizeSb := d.FieldUintFn("width_in_sbs", func(d *decode.D) uint64 { return ns(d, maxWidth) }, scalar.UintActualAdd(1))
+				widestTileSb = max(sizeSb, widestTileSb)
+				startSb += sizeSb
+			}
+		})
+		tileColsLog2 = tileLog2(1, uint64(tileCols))
+
+		if minLog2Tiles > 0 {
+			maxTileAreaSb = (sbRows * sbCols) >> (minLog2Tiles + 1)
+		} else {
+			maxTileAreaSb = sbRows * sbCols
+		}
+		maxTileHeightSb := max(maxTileAreaSb/widestTileSb, 1)
+		d.FieldArray("tile_heights", func(d *decode.D) {
+			for startSb := uint64(0); startSb < sbRows; tileRows++ {
+				maxHeight := min(sbRows-startSb, maxTileHeightSb)
+				sizeSb := d.FieldUintFn("height_in_sbs", func(d *decode.D) uint64 { return ns(d, maxHeight) }, scalar.UintActualAdd(1))
+				startSb += sizeSb
+			}
+		})
+		tileRowsLog2 = tileLog2(1, uint64(tileRows))
+	}
+	d.FieldValueUint("tile_cols", uint64(tileCols))
+	d.FieldValueUint("tile_rows", uint64(tileRows))
+
+	if tileColsLog2 > 0 || tileRowsLog2 > 0 {
+		d.FieldU("context_update_tile_id", tileRowsLog2+tileColsLog2)
+		d.FieldU2("tile_size_bytes", scalar.UintActualAdd(1))
+	}
+}
+
+func decodeDeltaQ(d *decode.D, name string) int64 {
+	if d.FieldBool(name + "_coded") {
+		return d.FieldS7(name)
+	}
+	return 0
+}
+
+func decodeQuantizationParams(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	fh.baseQIdx = d.FieldU8("base_q_idx")
+	deltas := []int64{decodeDeltaQ(d, "delta_q_y_dc")}
+	if fh.numPlanes > 1 {
+		diffUVDelta := false
+		if sh.SeparateUVDeltaQ {
+			diffUVDelta = d.FieldBool("diff_uv_delta")
+		}
+		deltas = append(deltas,
+			decodeDeltaQ(d, "delta_q_u_dc"),
+			decodeDeltaQ(d, "delta_q_u_ac"),
+		)
+		if diffUVDelta {
+			deltas = append(deltas,
+				decodeDeltaQ(d, "delta_q_v_dc"),
+				decodeDeltaQ(d, "delta_q_v_ac"),
+			)
+		}
+	}
+	for _, v := range deltas {
+		if v != 0 {
+			fh.deltaQNonZero = true
+		}
+	}
+	if d.FieldBool("using_qmatrix") {
+		d.FieldU4("qm_y")
+		d.FieldU4("qm_u")
+		if sh.SeparateUVDeltaQ {
+			d.FieldU4("qm_v")
+		}
+	}
+}
+
+// returns false if segmentation data is inherited from a reference frame
+func decodeSegmentationParams(d *decode.D, fh *frameHeader) bool {
+	fh.segmentationEnabled = d.FieldBool("segmentation_enabled")
+	if !fh.segmentationEnabled {
+		return true
+	}
+	updateData := true
+	if fh.primaryRefFrame != primaryRefNone {
+		if d.FieldBool("segmentation_update_map") {
+			d.FieldBool("segmentation_temporal_update")
+		}
+		updateData = d.FieldBool("segmentation_update_data")
+	}
+	if !updateData {
+		return false
+	}
+	d.FieldArray("segments", func(d *decode.D) {
+		for i := 0; i < maxSegments; i++ {
+			d.FieldArray("features", func(d *decode.D) {
+				for j := 0; j < segLvlMax; j++ {
+					d.FieldStruct("feature", func(d *decode.D) {
+						fh.featureEnabled[i][j] = d.FieldBool("enabled")
+						if !fh.featureEnabled[i][j] {
+							return
+						}
+						limit := segmentationFeatureMax[j]
+						if segmentationFeatureSigned[j] {
+							fh.featureData[i][j] = clip3(-limit, limit, d.FieldS("value", 1+segmentationFeatureBits[j]))
+						} else {
+							fh.featureData[i][j] = clip3(0, limit, int64(d.FieldU("value", segmentationFeatureBits[j])))
+						}
+					})
+				}
+			})
+		}
+	})
+	return true
+}
+
+func decodeDeltaParams(d *decode.D, fh *frameHeader) {
+	if fh.baseQIdx > 0 {
+		fh.deltaQPresent = d.FieldBool("delta_q_present")
+	}
+	if !fh.deltaQPresent {
+		return
+	}
+	d.FieldU2("delta_q_res")
+	if !fh.allowIntrabc && d.FieldBool("delta_lf_present") {
+		d.FieldU2("delta_lf_res")
+		d.FieldBool("delta_lf_multi")
+	}
+}
+
+func computeLossless(fh *frameHeader) {
+	fh.codedLossless = true
+	for segmentID := 0; segmentID < maxSegments; segmentID++ {
+		qindex := int64(fh.baseQIdx)
+		if fh.segmentationEnabled && fh.featureEnabled[segmentID][segLvlAltQ] {
+			qindex = clip3(0, 255, qindex+fh.featureData[segmentID][segLvlAltQ])
+		}
+		if qindex != 0 || fh.deltaQNonZero {
+			fh.codedLossless = false
+		}
+	}
+	fh.allLossless = fh.codedLossless && fh.frameWidth == fh.upscaledWidth
+}
+
+func decodeLoopFilterParams(d *decode.D, fh *frameHeader) {
+	if fh.codedLossless || fh.allowIntrabc {
+		return
+	}
+	l0 := d.FieldU6("loop_filter_level_0")
+	l1 := d.FieldU6("loop_filter_level_1")
+	if fh.numPlanes > 1 && (l0 != 0 || l1 != 0) {
+		d.FieldU6("loop_filter_level_2")
+		d.FieldU6("loop_filter_level_3")
+	}
+	d.FieldU3("loop_filter_sharpness")
+	if !d.FieldBool("loop_filter_delta_enabled") {
+		return
+	}
+	if !d.FieldBool("loop_filter_delta_update") {
+		return
+	}
+	d.FieldArray("loop_filter_ref_deltas", func(d *decode.D) {
+		for i := 0; i < numRefFrames; i++ {
+			d.FieldStruct("ref_delta", func(d *decode.D) {
+				if d.FieldBool("update") {
+					d.FieldS7("delta")
+				}
+			})
+		}
+	})
+	d.FieldArray("loop_filter_mode_deltas", func(d *decode.D) {
+		for i := 0; i < 2; i++ {
+			d.FieldStruct("mode_delta", func(d *decode.D) {
+				if d.FieldBool("update") {
+					d.FieldS7("delta")
+				}
+			})
+		}
+	})
+}
+
+func decodeCDEFParams(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	if fh.codedLossless || fh.allowIntrabc || !sh.EnableCDEF {
+		return
+	}
+	d.FieldU2("cdef_damping", scalar.UintActualAdd(3))
+	cdefBits := d.FieldU2("cdef_bits")
+	d.FieldArray("cdef_strengths", func(d *decode.D) {
+		for i := 0; i < 1<<cdefBits; i++ {
+			d.FieldStruct("strength", func(d *decode.D) {
+				d.FieldU4("y_pri")
+				d.FieldU2("y_sec")
+				if fh.numPlanes > 1 {
+					d.FieldU4("uv_pri")
+					d.FieldU2("uv_sec")
+				}
+			})
+		}
+	})
+}
+
+func decodeLRParams(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	if fh.allLossless || fh.allowIntrabc || !sh.EnableRestoration {
+		return
+	}
+	usesLR := false
+	usesChromaLR := false
+	d.FieldArray("lr_types", func(d *decode.D) {
+		for i := 0; i < fh.numPlanes; i++ {
+			if d.FieldU2("lr_type", lrTypeNames) != 0 {
+				usesLR = true
+				if i > 0 {
+					usesChromaLR = true
+				}
+			}
+		}
+	})
+	if !usesLR {
+		return
+	}
+	if sh.Use128x128Superblock {
+		d.FieldU1("lr_unit_shift")
+	} else if d.FieldBool("lr_unit_shift") {
+		d.FieldU1("lr_unit_extra_shift")
+	}
+	if sh.SubsamplingX && sh.SubsamplingY && usesChromaLR {
+		d.FieldU1("lr_uv_shift")
+	}
+}
+
+func decodeFilmGrainParams(d *decode.D, sh *format.AV1_Sequence_Header, fh *frameHeader) {
+	if !sh.FilmGrainParamsPresent || (!fh.showFrame && !fh.showableFrame) {
+		return
+	}
+	d.FieldStruct("film_grain_params", func(d *decode.D) {
+		if !d.FieldBool("apply_grain") {
+			return
+		}
+		d.FieldU16("grain_seed")
+		if fh.frameType == frameTypeInter && !d.FieldBool("update_grain") {
+			d.FieldU3("film_grain_params_ref_idx")
+			return
+		}
+		decodePoints := func(name string) uint64 {
+			n := d.FieldU4("num_" + name + "_points")
+			d.FieldArray(name+"_points", func(d *decode.D) {
+				for i := uint64(0); i < n; i++ {
+					d.FieldStruct("point", func(d *decode.D) {
+						d.FieldU8("value")
+						d.FieldU8("scaling")
+					})
+				}
+			})
+			return n
+		}
+		numYPoints := decodePoints("y")
+		chromaScalingFromLuma := false
+		if !sh.MonoChrome {
+			chromaScalingFromLuma = d.FieldBool("chroma_scaling_from_luma")
+		}
+		var numCbPoints, numCrPoints uint64
+		if !(sh.MonoChrome || chromaScalingFromLuma || (sh.SubsamplingX && sh.SubsamplingY && numYPoints == 0)) {
+			numCbPoints = decodePoints("cb")
+			numCrPoints = decodePoints("cr")
+		}
+		d.FieldU2("grain_scaling", scalar.UintActualAdd(8))
+		arCoeffLag := d.FieldU2("ar_coeff_lag")
+		numPosLuma := 2 * arCoeffLag * (arCoeffLag + 1)
+		numPosChroma := numPosLuma
+		decodeCoeffs := func(name string, n uint64) {
+			d.FieldArray(name, func(d *decode.D) {
+				for i := uint64(0); i < n; i++ {
+					d.FieldU8("coeff", scalar.UintActualAdd(-128))
+				}
+			})
+		}
+		if numYPoints > 0 {
+			numPosChroma = numPosLuma + 1
+			decodeCoeffs("ar_coeffs_y", numPosLuma)
+		}
+		if chromaScalingFromLuma || numCbPoints > 0 {
+			decodeCoeffs("ar_coeffs_cb", numPosChroma)
+		}
+		if chromaScalingFromLuma || numCrPoints > 0 {
+			decodeCoeffs("ar_coeffs_cr", numPosChroma)
+		}
+		d.FieldU2("ar_coeff_shift", scalar.UintActualAdd(6))
+		d.FieldU2("grain_scale_shift")
+		if numCbPoints > 0 {
+			d.FieldU8("cb_mult")
+			d.FieldU8("cb_luma_mult")
+			d.FieldU9("cb_offset")
+		}
+		if numCrPoints > 0 {
+			d.FieldU8("cr_mult")
+			d.FieldU8("cr_luma_mult")
+			d.FieldU9("cr_offset")
+		}
+		d.FieldBool("overlap_flag")
+		d.FieldBool("clip_to_restricted_range")
+	})
+}
+
+// decodeFrameHeader decodes uncompressed_header() and returns true if it was fully decoded
+func decodeFrameHeader(d *decode.D, sh *format.AV1_Sequence_Header, temporalID uint64, spatialID uint64) bool {
+	fh := &frameHeader{numPlanes: 3}
+	if sh.MonoChrome {
+		fh.numPlanes = 1
+	}
+
+	idLen := 0
+	if sh.FrameIDNumbersPresent {
+		idLen = sh.AdditionalFrameIDLength + sh.DeltaFrameIDLength
+	}
+
+	if sh.ReducedStillPictureHeader {
+		fh.frameType = frameTypeKey
+		fh.frameIsIntra = true
+		fh.showFrame = true
+	} else {
+		if d.FieldBool("show_existing_frame") {
+			d.FieldU3("frame_to_show_map_idx")
+			if sh.DecoderModelInfoPresent && !sh.EqualPictureInterval {
+				decodeTemporalPointInfo(d, sh)
+			}
+			if sh.FrameIDNumbersPresent {
+				d.FieldU("display_frame_id", idLen)
+			}
+			return true
+		}
+		fh.frameType = d.FieldU2("frame_type", frameTypeNames)
+		fh.frameIsIntra = fh.frameType == frameTypeIntra || fh.frameType == frameTypeKey
+		fh.showFrame = d.FieldBool("show_frame")
+		if fh.showFrame && sh.DecoderModelInfoPresent && !sh.EqualPictureInterval {
+			decodeTemporalPointInfo(d, sh)
+		}
+		if fh.showFrame {
+			fh.showableFrame = fh.frameType != frameTypeKey
+		} else {
+			fh.showableFrame = d.FieldBool("showable_frame")
+		}
+		if fh.frameType == frameTypeSwitch || (fh.frameType == frameTypeKey && fh.showFrame) {
+			fh.errorResilientMode = true
+		} else {
+			fh.errorResilientMode = d.FieldBool("error_resilient_mode")
+		}
+	}
+
+	disableCDFUpdate := d.FieldBool("disable_cdf_update")
+	if sh.SeqForceScreenContentTools == selectScreenContentTools {
+		fh.allowScreenContent = d.FieldBool("allow_screen_content_tools")
+	} else {
+		fh.allowScreenContent = sh.SeqForceScreenContentTools == 1
+	}
+	if fh.allowScreenContent {
+		if sh.SeqForceIntegerMV == selectIntegerMV {
+			fh.forceIntegerMV = d.FieldBool("force_integer_mv")
+		} else {
+			fh.forceIntegerMV = sh.SeqForceIntegerMV == 1
+		}
+	}
+	if fh.frameIsIntra {
+		fh.forceIntegerMV = true
+	}
+	if sh.FrameIDNumbersPresent {
+		d.FieldU("current_frame_id", idLen)
+	}
+	switch {
+	case fh.frameType == frameTypeSwitch:
+		fh.frameSizeOverride = true
+	case sh.ReducedStillPictureHeader:
+	default:
+		fh.frameSizeOverride = d.FieldBool("frame_size_override_flag")
+	}
+	d.FieldU("order_hint", sh.OrderHintBits)
+	fh.primaryRefFrame = primaryRefNone
+	if !fh.frameIsIntra && !fh.errorResilientMode {
+		fh.primaryRefFrame = d.FieldU3("primary_ref_frame")
+	}
+
+	if sh.DecoderModelInfoPresent {
+		if d.FieldBool("buffer_removal_time_present_flag") {
+			d.FieldArray("buffer_removal_times", func(d *decode.D) {
+				for opNum, opPtIdc := range sh.OperatingPointIdc {
+					if !sh.DecoderModelPresentForThisOp[opNum] {
+						continue
+					}
+					inTemporalLayer := (opPtIdc>>temporalID)&1 == 1
+					inSpatialLayer := (opPtIdc>>(spatialID+8))&1 == 1
+					if opPtIdc == 0 || (inTemporalLayer && inSpatialLayer) {
+						d.FieldU("buffer_removal_time", sh.BufferRemovalTimeLength)
+					}
+				}
+			})
+		}
+	}
+
+	if fh.frameType == frameTypeSwitch || (fh.frameType == frameTypeKey && fh.showFrame) {
+		fh.refreshFrameFlagsAll = true
+	} else {
+		fh.refreshFrameFlagsAll = d.FieldU8("refresh_frame_flags", scalar.UintHex) == 0xff
+	}
+	if (!fh.frameIsIntra || !fh.refreshFrameFlagsAll) && fh.errorResilientMode && sh.EnableOrderHint {
+		d.FieldArray("ref_order_hints", func(d *decode.D) {
+			for i := 0; i < numRefFrames; i++ {
+				d.FieldU("ref_order_hint", sh.OrderHintBits)
+			}
+		})
+	}
+
+	if fh.frameIsIntra {
+		decodeFrameSize(d, sh, fh)
+		decodeRenderSize(d)
+		if fh.allowScreenContent && fh.upscaledWidth == fh.frameWidth {
+			fh.allowIntrabc = d.FieldBool("allow_intrabc")
+		}
+	} else {
+		frameRefsShortSignaling := false
+		if sh.EnableOrderHint {
+			frameRefsShortSignaling = d.FieldBool("frame_refs_short_signaling")
+			if frameRefsShortSignaling {
+				d.FieldU3("last_frame_idx")
+				d.FieldU3("gold_frame_idx")
+			}
+		}
+		d.FieldArray("refs", func(d *decode.D) {
+			for i := 0; i < refsPerFrame; i++ {
+				d.FieldStruct("ref", func(d *decode.D) {
+					if !frameRefsShortSignaling {
+						d.FieldU3("ref_frame_idx")
+					}
+					if sh.FrameIDNumbersPresent {
+						d.FieldU("delta_frame_id", sh.DeltaFrameIDLength, scalar.UintActualAdd(1))
+					}
+				})
+			}
+		})
+		if fh.frameSizeOverride && !fh.errorResilientMode {
+			decodeFrameSizeWithRefs(d, sh, fh)
+		} else {
+			decodeFrameSize(d, sh, fh)
+			decodeRenderSize(d)
+		}
+		if !fh.forceIntegerMV {
+			d.FieldBool("allow_high_precision_mv")
+		}
+		if !d.FieldBool("is_filter_switchable") {
+			d.FieldU2("interpolation_filter", interpolationFilterNames)
+		}
+		d.FieldBool("is_motion_mode_switchable")
+		if !fh.errorResilientMode && sh.EnableRefFrameMVs {
+			d.FieldBool("use_ref_frame_mvs")
+		}
+	}
+
+	if !sh.ReducedStillPictureHeader && !disableCDFUpdate {
+		d.FieldBool("disable_frame_end_update_cdf")
+	}
+
+	if !fh.sizeKnown {
+		return false
+	}
+	d.FieldStruct("tile_info", func(d *decode.D) { decodeTileInfo(d, sh, fh) })
+	d.FieldStruct("quantization_params", func(d *decode.D) { decodeQuantizationParams(d, sh, fh) })
+	segmentationKnown := true
+	d.FieldStruct("segmentation_params", func(d *decode.D) { segmentationKnown = decodeSegmentationParams(d, fh) })
+	if !segmentationKnown {
+		return false
+	}
+	decodeDeltaParams(d, fh)
+	computeLossless(fh)
+	d.FieldValueBool("coded_lossless", fh.codedLossless)
+	d.FieldStruct("loop_filter_params", func(d *decode.D) { decodeLoopFilterParams(d, fh) })
+	d.FieldStruct("cdef_params", func(d *decode.D) { decodeCDEFParams(d, sh, fh) })
+	d.FieldStruct("lr_params", func(d *decode.D) { decodeLRParams(d, sh, fh) })
+	if !fh.codedLossless {
+		d.FieldBool("tx_mode_select")
+	}
+	if !fh.frameIsIntra {
+		// skip_mode_present depends on reference frame order hints
+		if d.FieldBool("reference_select") && sh.EnableOrderHint {
+			return false
+		}
+		if !fh.errorResilientMode && sh.EnableWarpedMotion {
+			d.FieldBool("allow_warped_motion")
+		}
+	}
+	d.FieldBool("reduced_tx_set")
+	if !fh.frameIsIntra {
+		// global motion params are coded relative to the previous frame
+		return false
+	}
+	decodeFilmGrainParams(d, sh, fh)
+
+	return true
+}
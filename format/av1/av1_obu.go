@@ -41,8 +41,13 @@ var obuTypeNames = scalar.UintMapSymStr{
 }
 
 func obuDecode(d *decode.D) any {
+	var oi format.AV1_Sequence_Header_State
+	d.ArgAs(&oi)
+
 	var obuType uint64
 	var obuSize int64
+	var temporalID uint64
+	var spatialID uint64
 	hasExtension := false
 	hasSizeField := false
 
@@ -53,8 +58,8 @@ func obuDecode(d *decode.D) any {
 		hasSizeField = d.FieldBool("has_size_field")
 		d.FieldU1("reserved_1bit")
 		if hasExtension {
-			d.FieldU3("temporal_id")
-			d.FieldU2("spatial_id")
+			temporalID = d.FieldU3("temporal_id")
+			spatialID = d.FieldU2("spatial_id")
 			d.FieldU3("extension_header_reserved_3bits")
 		}
 	})
@@ -63,16 +68,35 @@ func obuDecode(d *decode.D) any {
 		obuSize = int64(d.FieldULEB128("size"))
 	} else {
 		obuSize = d.BitsLeft() / 8
-		if hasExtension {
-			obuSize--
-		}
 	}
 
-	_ = obuType
+	oo := oi
 
-	if d.BitsLeft() > 0 {
-		d.FieldRawLen("data", obuSize*8)
-	}
+	d.FramedFn(obuSize*8, func(d *decode.D) {
+		switch obuType {
+		case OBU_SEQUENCE_HEADER:
+			d.FieldStruct("sequence_header", func(d *decode.D) {
+				oo.SequenceHeader = decodeSequenceHeader(d)
+			})
+			oo.HasSequenceHeader = true
+		case OBU_FRAME_HEADER,
+			OBU_FRAME:
+			if !oi.HasSequenceHeader {
+				break
+			}
+			complete := false
+			d.FieldStruct("frame_header", func(d *decode.D) {
+				complete = decodeFrameHeader(d, &oi.SequenceHeader, temporalID, spatialID)
+			})
+			if complete && obuType == OBU_FRAME {
+				d.FieldU("byte_alignment", d.ByteAlignBits())
+				d.FieldRawLen("tile_group", d.BitsLeft())
+			}
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
 
-	return nil
+	return oo
 }
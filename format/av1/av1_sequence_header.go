@@ -0,0 +1,219 @@
+package av1
+
+// https://aomediacodec.github.io/av1-spec/#sequence-header-obu-syntax
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	selectScreenContentTools = 2
+	selectIntegerMV          = 2
+)
+
+const (
+	cpBT709       = 1
+	tcSRGB        = 13
+	mcIdentity    = 0
+	cpUnspecified = 2
+	tcUnspecified = 2
+	mcUnspecified = 2
+)
+
+var seqProfileNames = scalar.UintMapSymStr{
+	0: "main",
+	1: "high",
+	2: "professional",
+}
+
+var chromaSamplePositionNames = scalar.UintMapSymStr{
+	0: "unknown",
+	1: "vertical",
+	2: "colocated",
+	3: "reserved",
+}
+
+var colorRangeNames = scalar.UintMapSymStr{
+	0: "studio",
+	1: "full",
+}
+
+// 4.10.3 uvlc()
+func uvlc(d *decode.D) uint64 {
+	leadingZeros := 0
+	for !d.Bool() {
+		leadingZeros++
+	}
+	if leadingZeros >= 32 {
+		return (1 << 32) - 1
+	}
+	return d.U(leadingZeros) + (1 << leadingZeros) - 1
+}
+
+func decodeColorConfig(d *decode.D, seqProfile uint64, sh *format.AV1_Sequence_Header) {
+	highBitdepth := d.FieldBool("high_bitdepth")
+	bitDepth := uint64(8)
+	if seqProfile == 2 && highBitdepth {
+		if d.FieldBool("twelve_bit") {
+			bitDepth = 12
+		} else {
+			bitDepth = 10
+		}
+	} else if highBitdepth {
+		bitDepth = 10
+	}
+	d.FieldValueUint("bit_depth", bitDepth)
+
+	if seqProfile != 1 {
+		sh.MonoChrome = d.FieldBool("mono_chrome")
+	}
+
+	colorPrimaries := uint64(cpUnspecified)
+	transferCharacteristics := uint64(tcUnspecified)
+	matrixCoefficients := uint64(mcUnspecified)
+	if d.FieldBool("color_description_present_flag") {
+		colorPrimaries = d.FieldU8("color_primaries", format.ISO_23091_2_ColourPrimariesMap)
+		transferCharacteristics = d.FieldU8("transfer_characteristics", format.ISO_23091_2_TransferCharacteristicMap)
+		matrixCoefficients = d.FieldU8("matrix_coefficients", format.ISO_23091_2_MatrixCoefficients)
+	}
+
+	switch {
+	case sh.MonoChrome:
+		d.FieldU1("color_range", colorRangeNames)
+		sh.SubsamplingX = true
+		sh.SubsamplingY = true
+		return
+	case colorPrimaries == cpBT709 && transferCharacteristics == tcSRGB && matrixCoefficients == mcIdentity:
+		// 4:4:4 full range
+	default:
+		d.FieldU1("color_range", colorRangeNames)
+		switch {
+		case seqProfile == 0:
+			sh.SubsamplingX = true
+			sh.SubsamplingY = true
+		case seqProfile == 1:
+		case bitDepth == 12:
+			sh.SubsamplingX = d.FieldBool("subsampling_x")
+			if sh.SubsamplingX {
+				sh.SubsamplingY = d.FieldBool("subsampling_y")
+			}
+		default:
+			sh.SubsamplingX = true
+		}
+		if sh.SubsamplingX && sh.SubsamplingY {
+			d.FieldU2("chroma_sample_position", chromaSamplePositionNames)
+		}
+	}
+	sh.SeparateUVDeltaQ = d.FieldBool("separate_uv_delta_q")
+}
+
+func decodeSequenceHeader(d *decode.D) format.AV1_Sequence_Header {
+	var sh format.AV1_Sequence_Header
+
+	seqProfile := d.FieldU3("seq_profile", seqProfileNames)
+	d.FieldBool("still_picture")
+	sh.ReducedStillPictureHeader = d.FieldBool("reduced_still_picture_header")
+	if sh.ReducedStillPictureHeader {
+		sh.OperatingPointIdc = []uint64{0}
+		sh.DecoderModelPresentForThisOp = []bool{false}
+		d.FieldU5("seq_level_idx")
+	} else {
+		bufferDelayLength := 0
+		if d.FieldBool("timing_info_present_flag") {
+			d.FieldStruct("timing_info", func(d *decode.D) {
+				d.FieldU32("num_units_in_display_tick")
+				d.FieldU32("time_scale")
+				sh.EqualPictureInterval = d.FieldBool("equal_picture_interval")
+				if sh.EqualPictureInterval {
+					d.FieldUintFn("num_ticks_per_picture", uvlc, scalar.UintActualAdd(1))
+				}
+			})
+			sh.DecoderModelInfoPresent = d.FieldBool("decoder_model_info_present_flag")
+			if sh.DecoderModelInfoPresent {
+				d.FieldStruct("decoder_model_info", func(d *decode.D) {
+					bufferDelayLength = int(d.FieldU5("buffer_delay_length", scalar.UintActualAdd(1)))
+					d.FieldU32("num_units_in_decoding_tick")
+					sh.BufferRemovalTimeLength = int(d.FieldU5("buffer_removal_time_length", scalar.UintActualAdd(1)))
+					sh.FramePresentationTimeLength = int(d.FieldU5("frame_presentation_time_length", scalar.UintActualAdd(1)))
+				})
+			}
+		}
+		initialDisplayDelayPresent := d.FieldBool("initial_display_delay_present_flag")
+		operatingPointsCnt := d.FieldU5("operating_points_cnt", scalar.UintActualAdd(1))
+		d.FieldArray("operating_points", func(d *decode.D) {
+			for i := uint64(0); i < operatingPointsCnt; i++ {
+				d.FieldStruct("operating_point", func(d *decode.D) {
+					sh.OperatingPointIdc = append(sh.OperatingPointIdc, d.FieldU12("idc", scalar.UintHex))
+					seqLevelIdx := d.FieldU5("seq_level_idx")
+					if seqLevelIdx > 7 {
+						d.FieldU1("seq_tier")
+					}
+					decoderModelPresent := false
+					if sh.DecoderModelInfoPresent {
+						decoderModelPresent = d.FieldBool("decoder_model_present_for_this_op")
+						if decoderModelPresent {
+							d.FieldU("decoder_buffer_delay", bufferDelayLength)
+							d.FieldU("encoder_buffer_delay", bufferDelayLength)
+							d.FieldBool("low_delay_mode_flag")
+						}
+					}
+					sh.DecoderModelPresentForThisOp = append(sh.DecoderModelPresentForThisOp, decoderModelPresent)
+					if initialDisplayDelayPresent {
+						if d.FieldBool("initial_display_delay_present_for_this_op") {
+							d.FieldU4("initial_display_delay", scalar.UintActualAdd(1))
+						}
+					}
+				})
+			}
+		})
+	}
+
+	sh.FrameWidthBits = int(d.FieldU4("frame_width_bits", scalar.UintActualAdd(1)))
+	sh.FrameHeightBits = int(d.FieldU4("frame_height_bits", scalar.UintActualAdd(1)))
+	sh.MaxFrameWidth = d.FieldU("max_frame_width", sh.FrameWidthBits, scalar.UintActualAdd(1))
+	sh.MaxFrameHeight = d.FieldU("max_frame_height", sh.FrameHeightBits, scalar.UintActualAdd(1))
+	if !sh.ReducedStillPictureHeader {
+		sh.FrameIDNumbersPresent = d.FieldBool("frame_id_numbers_present_flag")
+	}
+	if sh.FrameIDNumbersPresent {
+		sh.DeltaFrameIDLength = int(d.FieldU4("delta_frame_id_length", scalar.UintActualAdd(2)))
+		sh.AdditionalFrameIDLength = int(d.FieldU3("additional_frame_id_length", scalar.UintActualAdd(1)))
+	}
+	sh.Use128x128Superblock = d.FieldBool("use_128x128_superblock")
+	d.FieldBool("enable_filter_intra")
+	d.FieldBool("enable_intra_edge_filter")
+
+	sh.SeqForceScreenContentTools = selectScreenContentTools
+	sh.SeqForceIntegerMV = selectIntegerMV
+	if !sh.ReducedStillPictureHeader {
+		d.FieldBool("enable_interintra_compound")
+		d.FieldBool("enable_masked_compound")
+		sh.EnableWarpedMotion = d.FieldBool("enable_warped_motion")
+		d.FieldBool("enable_dual_filter")
+		sh.EnableOrderHint = d.FieldBool("enable_order_hint")
+		if sh.EnableOrderHint {
+			d.FieldBool("enable_jnt_comp")
+			sh.EnableRefFrameMVs = d.FieldBool("enable_ref_frame_mvs")
+		}
+		if !d.FieldBool("seq_choose_screen_content_tools") {
+			sh.SeqForceScreenContentTools = d.FieldU1("seq_force_screen_content_tools")
+		}
+		if sh.SeqForceScreenContentTools > 0 {
+			if !d.FieldBool("seq_choose_integer_mv") {
+				sh.SeqForceIntegerMV = d.FieldU1("seq_force_integer_mv")
+			}
+		}
+		if sh.EnableOrderHint {
+			sh.OrderHintBits = int(d.FieldU3("order_hint_bits", scalar.UintActualAdd(1)))
+		}
+	}
+	sh.EnableSuperres = d.FieldBool("enable_superres")
+	sh.EnableCDEF = d.FieldBool("enable_cdef")
+	sh.EnableRestoration = d.FieldBool("enable_restoration")
+	d.FieldStruct("color_config", func(d *decode.D) { decodeColorConfig(d, seqProfile, &sh) })
+	sh.FilmGrainParamsPresent = d.FieldBool("film_grain_params_present")
+
+	return sh
+}
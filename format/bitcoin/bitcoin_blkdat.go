@@ -4,6 +4,7 @@ import (
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/ranges"
 )
 
 var bitcoinBlockGroup decode.Group
@@ -24,15 +25,28 @@ func init() {
 }
 
 func decodeBlkDat(d *decode.D) any {
-	validBlocks := 0
+	// find block ranges using the size in each block header so that blocks
+	// can be decoded independently
+	var blockRanges []ranges.Range
 	for !d.End() {
-		d.FieldFormat("block", &bitcoinBlockGroup, format.Bitcoin_Block_In{HasHeader: true})
-		validBlocks++
+		start := d.Pos()
+		nBits := d.BitsLeft()
+		if nBits >= 64 {
+			d.SeekRel(32)
+			nBits = min(64+int64(d.U32LE())*8, nBits)
+		}
+		blockRanges = append(blockRanges, ranges.Range{Start: start, Len: nBits})
+		d.SeekAbs(start + nBits)
 	}
 
-	if validBlocks == 0 {
+	if len(blockRanges) == 0 {
 		d.Fatalf("no valid blocks found")
 	}
 
+	d.RangesFn(blockRanges, func(d *decode.D) {
+		d.FieldFormat("block", &bitcoinBlockGroup, format.Bitcoin_Block_In{HasHeader: true})
+	})
+	d.SeekAbs(d.Len())
+
 	return nil
 }
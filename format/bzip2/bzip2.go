@@ -26,6 +26,8 @@ func init() {
 		format.Bzip2,
 		&decode.Format{
 			Description: "bzip2 compression",
+			Extensions:  []string{"bz2"},
+			MIMETypes:   []string{"application/x-bzip2"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    bzip2Decode,
 			Dependencies: []decode.Dependency{
@@ -0,0 +1,93 @@
+package can
+
+// https://www.kernel.org/doc/html/latest/networking/can.html
+// https://www.tcpdump.org/linktypes/LINKTYPE_CAN_SOCKETCAN.html
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed can_frame.md
+var canFrameFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.CAN_Frame,
+		&decode.Format{
+			Description:  "SocketCAN frame",
+			Groups:       []*decode.Group{format.Link_Frame},
+			DecodeFn:     decodeCANFrame,
+			DefaultInArg: format.CAN_Frame_In{},
+		})
+	interp.RegisterFS(canFrameFS)
+}
+
+const (
+	canMaxDataLen   = 8
+	canFDMaxDataLen = 64
+	canFDFlagFDF    = 0x04
+)
+
+func decodeCANFrame(d *decode.D) any {
+	var ci format.CAN_Frame_In
+	d.ArgAs(&ci)
+
+	// struct can_frame is in host order, assume little endian
+	d.Endian = decode.LittleEndian
+	var lfi format.Link_Frame_In
+	if d.ArgAs(&lfi) {
+		if lfi.Type != format.LinkTypeCAN_SOCKETCAN {
+			d.Fatalf("wrong link type %d", lfi.Type)
+		}
+		// pseudo-header has can_id in network byte order
+		d.Endian = decode.BigEndian
+	}
+
+	db := parseDBC(d, ci.DBC)
+
+	canID := d.FieldU32("can_id", scalar.UintHex)
+	msg, msgOk := fieldCANID(d, canID, db)
+
+	dataLen := int64(d.FieldU8("len"))
+	fd := d.PeekUintBits(8)&canFDFlagFDF != 0 || d.BitsLeft() > (3+canMaxDataLen)*8
+	maxDataLen := int64(canMaxDataLen)
+	if fd {
+		maxDataLen = canFDMaxDataLen
+	}
+	if dataLen > maxDataLen {
+		d.Fatalf("len %d larger than %d", dataLen, maxDataLen)
+	}
+
+	d.FieldValueBool("fd", fd)
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldU5("unused")
+		d.FieldBool("fdf")
+		d.FieldBool("esi")
+		d.FieldBool("brs")
+	})
+	d.FieldU8("reserved0")
+	if fd {
+		d.FieldU8("reserved1")
+	} else {
+		d.FieldU8("len8_dlc")
+	}
+
+	dataLen = min(dataLen, d.BitsLeft()/8)
+	dataStart := d.Pos()
+	bs := d.PeekBytes(int(dataLen))
+	d.FieldRawLen("data", dataLen*8)
+	if msgOk {
+		d.SeekAbs(dataStart)
+		d.FieldStruct("signals", func(d *decode.D) { fieldSignals(d, msg, bs) })
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+	}
+
+	return nil
+}
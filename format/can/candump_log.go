@@ -0,0 +1,139 @@
+package can
+
+// https://github.com/linux-can/can-utils/blob/master/lib.c
+// (<seconds>.<microseconds>) <interface> <can_id>#<data>
+
+import (
+	"embed"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed candump_log.md
+var candumpLogFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Candump_Log,
+		&decode.Format{
+			Description:  "Linux can-utils candump log",
+			DecodeFn:     decodeCandumpLog,
+			DefaultInArg: format.Candump_Log_In{},
+			RootArray:    true,
+			RootName:     "frames",
+		})
+	interp.RegisterFS(candumpLogFS)
+}
+
+// separators are included in the field before or after them and trimmed from the actual value
+// timestamp, interface, can_id, fd flags, frame data and optional direction
+var candumpLineRE = regexp.MustCompile(`^(\([0-9]+\.[0-9]+\) )([^ ]+ )([0-9A-Fa-f]{3}#|[0-9A-Fa-f]{8}#)(#[0-9A-Fa-f])?([^ ]*)( [RT])?$`)
+
+// hex data with optional dot separators or remote request with optional length, both with optional len8_dlc
+var candumpDataRE = regexp.MustCompile(`^(?:([0-9A-Fa-f.]*)|(R[0-9]?))(_[0-9A-Fa-f])?$`)
+
+var directionNames = scalar.StrMapDescription{
+	"R": "Received",
+	"T": "Transmitted",
+}
+
+func decodeCandumpLog(d *decode.D) any {
+	var ci format.Candump_Log_In
+	d.ArgAs(&ci)
+
+	db := parseDBC(d, ci.DBC)
+
+	for !d.End() {
+		lineLen := d.PeekFindByte('\n', d.BitsLeft()/8)
+		hasNewline := lineLen != -1
+		if !hasNewline {
+			lineLen = d.BitsLeft() / 8
+		}
+		line := strings.TrimSuffix(string(d.PeekBytes(int(lineLen))), "\r")
+
+		m := candumpLineRE.FindStringSubmatchIndex(line)
+		if m == nil {
+			d.Fatalf("invalid line: %q", line)
+		}
+		start := d.Pos()
+
+		d.FieldStruct("frame", func(d *decode.D) {
+			// seek to submatch and add field for it
+			field := func(i int, name string, sms ...scalar.StrMapper) string {
+				if m[i*2] == -1 {
+					return ""
+				}
+				d.SeekAbs(start + int64(m[i*2])*8)
+				return d.FieldUTF8(name, m[i*2+1]-m[i*2], sms...)
+			}
+
+			field(1, "timestamp", scalar.StrActualTrim("() "))
+			field(2, "interface", scalar.StrActualTrim(" "))
+			canIDStr := field(3, "can_id", scalar.StrActualTrim("#"))
+			canID, _ := strconv.ParseUint(canIDStr, 16, 32)
+			if len(canIDStr) == 8 && canID&canERRFlag == 0 {
+				canID |= canEFFFlag
+			}
+			fd := m[8] != -1
+			if fd {
+				field(4, "fd_flags", scalar.StrActualTrim("#"), scalar.StrSymParseUint(16))
+			}
+
+			dataStart := m[10]
+			dm := candumpDataRE.FindStringSubmatchIndex(line[dataStart:m[11]])
+			if dm == nil || (fd && (dm[4] != -1 || dm[6] != -1)) {
+				d.Fatalf("invalid frame data: %q", line[dataStart:m[11]])
+			}
+			// data submatches are relative to data start
+			dataField := func(i int, name string, sms ...scalar.StrMapper) string {
+				if dm[i*2] == -1 {
+					return ""
+				}
+				d.SeekAbs(start + int64(dataStart+dm[i*2])*8)
+				return d.FieldUTF8(name, dm[i*2+1]-dm[i*2], sms...)
+			}
+
+			remote := dm[4] != -1
+			if remote {
+				canID |= canRTRFlag
+			}
+			msg, msgOk := fieldCANID(d, canID, db)
+			d.FieldValueBool("fd", fd)
+
+			if remote {
+				dataField(2, "rtr")
+				dataField(3, "len8_dlc", scalar.StrActualTrim("_"), scalar.StrSymParseUint(16))
+			} else {
+				hexStr := dataField(1, "data")
+				dataField(3, "len8_dlc", scalar.StrActualTrim("_"), scalar.StrSymParseUint(16))
+
+				bs, err := hex.DecodeString(strings.ReplaceAll(hexStr, ".", ""))
+				if err != nil {
+					d.Fatalf("invalid frame data: %s", err)
+				}
+				br := bitio.NewBitReader(bs, -1)
+				d.FieldRootBitBuf("payload", br)
+				if msgOk {
+					d.FieldStructRootBitBufFn("signals", br, func(d *decode.D) { fieldSignals(d, msg, bs) })
+				}
+			}
+
+			field(6, "direction", scalar.StrActualTrim(" "), directionNames)
+
+			d.SeekAbs(start + lineLen*8)
+			if hasNewline {
+				d.FieldUTF8("newline", 1)
+			}
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package dbc parses the message and signal parts of Vector CAN database (DBC) files
+// https://www.csselectronics.com/pages/can-dbc-file-database-intro
+//
+// BO_ <ID> <Name>: <Size> <Transmitter>
+// SG_ <Name> [M|m<N>] : <Start>|<Length>@<1=little,0=big><+|-> (<Factor>,<Offset>) [<Min>|<Max>] "<Unit>" <Receivers>
+// VAL_ <ID> <Signal> <Value> "<Name>" ... ;
+package dbc
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExtendedFlag is set in DBC message ids for 29 bit identifiers
+const ExtendedFlag = 0x80000000
+
+type Signal struct {
+	Name         string
+	StartBit     int
+	Length       int
+	LittleEndian bool
+	Signed       bool
+	Factor       float64
+	Offset       float64
+	Min          float64
+	Max          float64
+	Unit         string
+	// IsMultiplexer is set for the signal selecting which multiplexed signals are present
+	IsMultiplexer bool
+	// MultiplexValue is the multiplexer value for multiplexed signals, -1 if always present
+	MultiplexValue int
+	Values         map[int64]string
+}
+
+type Message struct {
+	ID      uint32
+	Name    string
+	Size    int
+	Signals []*Signal
+}
+
+type Database map[uint32]*Message
+
+var (
+	messageRE = regexp.MustCompile(`^BO_\s+(\d+)\s+(\w+)\s*:\s*(\d+)`)
+	signalRE  = regexp.MustCompile(`^SG_\s+(\w+)\s*(M|m\d+)?\s*:\s*(\d+)\|(\d+)@([01])([+-])\s*\(([^,]+),([^)]+)\)\s*\[([^|]+)\|([^\]]+)\]\s*"([^"]*)"`)
+	valuesRE  = regexp.MustCompile(`^VAL_\s+(\d+)\s+(\w+)\s+(.*);`)
+	valueRE   = regexp.MustCompile(`(-?\d+)\s+"([^"]*)"`)
+)
+
+func parseFloats(ss ...string) ([]float64, error) {
+	var fs []float64
+	for _, s := range ss {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+// Parse DBC messages, signals and value descriptions, other sections are ignored
+func Parse(s string) (Database, error) {
+	db := Database{}
+
+	var msg *Message
+	lines := bufio.NewScanner(strings.NewReader(s))
+	lineNr := 0
+	for lines.Scan() {
+		lineNr++
+		line := strings.TrimSpace(lines.Text())
+
+		switch {
+		case strings.HasPrefix(line, "BO_ "):
+			m := messageRE.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("invalid message %d: %s", lineNr, line)
+			}
+			id, err := strconv.ParseUint(m[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid message id %d: %w", lineNr, err)
+			}
+			size, _ := strconv.Atoi(m[3])
+			msg = &Message{ID: uint32(id), Name: m[2], Size: size}
+			db[msg.ID] = msg
+		case strings.HasPrefix(line, "SG_ "):
+			if msg == nil {
+				return nil, fmt.Errorf("signal outside message %d: %s", lineNr, line)
+			}
+			m := signalRE.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("invalid signal %d: %s", lineNr, line)
+			}
+			fs, err := parseFloats(m[7], m[8], m[9], m[10])
+			if err != nil {
+				return nil, fmt.Errorf("invalid signal number %d: %w", lineNr, err)
+			}
+			sig := &Signal{
+				Name:           m[1],
+				LittleEndian:   m[5] == "1",
+				Signed:         m[6] == "-",
+				Factor:         fs[0],
+				Offset:         fs[1],
+				Min:            fs[2],
+				Max:            fs[3],
+				Unit:           m[11],
+				MultiplexValue: -1,
+			}
+			sig.StartBit, _ = strconv.Atoi(m[3])
+			sig.Length, _ = strconv.Atoi(m[4])
+			if sig.Length < 1 || sig.Length > 64 {
+				return nil, fmt.Errorf("invalid signal length %d: %d", lineNr, sig.Length)
+			}
+			switch {
+			case m[2] == "M":
+				sig.IsMultiplexer = true
+			case m[2] != "":
+				sig.MultiplexValue, _ = strconv.Atoi(m[2][1:])
+			}
+			msg.Signals = append(msg.Signals, sig)
+		case strings.HasPrefix(line, "VAL_ "):
+			m := valuesRE.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			vm, ok := db[uint32(id)]
+			if !ok {
+				continue
+			}
+			for _, sig := range vm.Signals {
+				if sig.Name != m[2] {
+					continue
+				}
+				sig.Values = map[int64]string{}
+				for _, v := range valueRE.FindAllStringSubmatch(m[3], -1) {
+					n, _ := strconv.ParseInt(v[1], 10, 64)
+					sig.Values[n] = v[2]
+				}
+			}
+		case line == "":
+			msg = nil
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Lookup message by CAN identifier
+func (db Database) Lookup(id uint32, extended bool) (*Message, bool) {
+	if extended {
+		id |= ExtendedFlag
+	}
+	m, ok := db[id]
+	return m, ok
+}
@@ -0,0 +1,54 @@
+package dbc_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/wader/fq/format/can/dbc"
+)
+
+func TestParse(t *testing.T) {
+	b, err := os.ReadFile("../testdata/vehicle.dbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dbc.Parse(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := dbc.Database{
+		256: &dbc.Message{
+			ID: 256, Name: "EngineData", Size: 8,
+			Signals: []*dbc.Signal{
+				{Name: "EngineSpeed", StartBit: 0, Length: 16, LittleEndian: true, Factor: 0.25, Min: 0, Max: 16383.75, Unit: "rpm", MultiplexValue: -1},
+				{Name: "CoolantTemp", StartBit: 16, Length: 8, LittleEndian: true, Factor: 1, Offset: -40, Min: -40, Max: 215, Unit: "degC", MultiplexValue: -1},
+				{Name: "Gear", StartBit: 24, Length: 4, LittleEndian: true, Factor: 1, Max: 15, MultiplexValue: -1,
+					Values: map[int64]string{0: "park", 1: "reverse", 2: "neutral", 3: "drive"}},
+				{Name: "ThrottlePos", StartBit: 39, Length: 10, Factor: 0.1, Max: 100, Unit: "%", MultiplexValue: -1},
+			},
+		},
+		0x18fef1fe | dbc.ExtendedFlag: &dbc.Message{
+			ID: 0x18fef1fe | dbc.ExtendedFlag, Name: "Diagnostics", Size: 8,
+			Signals: []*dbc.Signal{
+				{Name: "Page", StartBit: 0, Length: 8, LittleEndian: true, Factor: 1, Max: 255, IsMultiplexer: true, MultiplexValue: -1},
+				{Name: "Voltage", StartBit: 8, Length: 16, LittleEndian: true, Factor: 0.001, Max: 65.535, Unit: "V", MultiplexValue: 1},
+				{Name: "Current", StartBit: 24, Length: 16, LittleEndian: true, Signed: true, Factor: 0.01, Min: -327.68, Max: 327.67, Unit: "A", MultiplexValue: 1},
+				{Name: "ErrorCount", StartBit: 8, Length: 8, LittleEndian: true, Factor: 1, Max: 255, MultiplexValue: 2},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+#v, got %+#v", expected, actual)
+	}
+
+	if m, ok := actual.Lookup(0x18fef1fe, true); !ok || m.Name != "Diagnostics" {
+		t.Errorf("expected extended lookup to find Diagnostics, got %v %v", m, ok)
+	}
+	if _, ok := actual.Lookup(0x18fef1fe, false); ok {
+		t.Error("expected standard lookup of extended id to fail")
+	}
+}
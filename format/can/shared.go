@@ -0,0 +1,151 @@
+package can
+
+import (
+	"github.com/wader/fq/format/can/dbc"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/can.h
+const (
+	canEFFFlag = 0x80000000
+	canRTRFlag = 0x40000000
+	canERRFlag = 0x20000000
+	canSFFMask = 0x000007ff
+	canEFFMask = 0x1fffffff
+)
+
+func parseDBC(d *decode.D, s string) dbc.Database {
+	if s == "" {
+		return nil
+	}
+	db, err := dbc.Parse(s)
+	if err != nil {
+		d.Fatalf("failed to parse dbc: %s", err)
+	}
+	return db
+}
+
+type messageNames struct {
+	db       dbc.Database
+	extended bool
+}
+
+func (m messageNames) MapUint(s scalar.Uint) (scalar.Uint, error) {
+	if msg, ok := m.db.Lookup(uint32(s.Actual), m.extended); ok {
+		s.Sym = msg.Name
+	}
+	return s, nil
+}
+
+// fieldCANID adds flag and identifier fields for a can_id and returns the matching DBC message if any
+func fieldCANID(d *decode.D, canID uint64, db dbc.Database) (*dbc.Message, bool) {
+	extended := canID&canEFFFlag != 0
+	d.FieldValueBool("extended", extended)
+	d.FieldValueBool("remote", canID&canRTRFlag != 0)
+	d.FieldValueBool("error", canID&canERRFlag != 0)
+
+	id := canID & canSFFMask
+	if extended {
+		id = canID & canEFFMask
+	}
+	d.FieldValueUint("id", id, scalar.UintHex, messageNames{db: db, extended: extended})
+
+	if canID&(canRTRFlag|canERRFlag) != 0 {
+		return nil, false
+	}
+	return db.Lookup(uint32(id), extended)
+}
+
+// signalBits returns MSB first bit position and length of the bits covering signal
+func signalBits(s *dbc.Signal) (int, int) {
+	if !s.LittleEndian {
+		// start bit is the most significant bit with bit 7 being the first bit in a byte
+		return (s.StartBit/8)*8 + 7 - s.StartBit%8, s.Length
+	}
+	// start bit is the least significant bit counting bits from the least significant bit
+	first := s.StartBit / 8
+	last := (s.StartBit + s.Length - 1) / 8
+	if first == last {
+		return first*8 + 7 - (s.StartBit+s.Length-1)%8, s.Length
+	}
+	// little endian signals spanning bytes are not continuous, cover whole bytes
+	return first * 8, (last - first + 1) * 8
+}
+
+func signalRaw(bs []byte, s *dbc.Signal) uint64 {
+	bit := func(i int) uint64 { return uint64(bs[i/8]>>(7-i%8)) & 1 }
+
+	var v uint64
+	if s.LittleEndian {
+		for i := 0; i < s.Length; i++ {
+			n := s.StartBit + i
+			v |= bit(n/8*8+7-n%8) << i
+		}
+	} else {
+		p, _ := signalBits(s)
+		for i := 0; i < s.Length; i++ {
+			v = v<<1 | bit(p+i)
+		}
+	}
+	return v
+}
+
+func signalSignExtend(s *dbc.Signal, v uint64) int64 {
+	shift := 64 - s.Length
+	return int64(v<<shift) >> shift
+}
+
+// signalPhysical returns value description name or scaled value, nil if raw value is the physical value
+func signalPhysical(s *dbc.Signal, raw float64) any {
+	if name, ok := s.Values[int64(raw)]; ok {
+		return name
+	}
+	if s.Factor == 1 && s.Offset == 0 {
+		return nil
+	}
+	return raw*s.Factor + s.Offset
+}
+
+// fieldSignals decodes signals of a DBC message from data at current position
+func fieldSignals(d *decode.D, msg *dbc.Message, bs []byte) {
+	start := d.Pos()
+	nBits := len(bs) * 8
+
+	inData := func(s *dbc.Signal) bool {
+		p, n := signalBits(s)
+		return p >= 0 && p+n <= nBits
+	}
+
+	muxValue := int64(-1)
+	for _, s := range msg.Signals {
+		if s.IsMultiplexer && inData(s) {
+			muxValue = int64(signalRaw(bs, s))
+		}
+	}
+
+	for _, s := range msg.Signals {
+		if !inData(s) || (s.MultiplexValue != -1 && int64(s.MultiplexValue) != muxValue) {
+			continue
+		}
+		p, n := signalBits(s)
+		raw := signalRaw(bs, s)
+		d.SeekAbs(start + int64(p))
+
+		if s.Signed {
+			v := signalSignExtend(s, raw)
+			d.FieldSintFn(s.Name, func(d *decode.D) int64 { d.SeekRel(int64(n)); return v }, scalar.SintFn(func(sv scalar.Sint) (scalar.Sint, error) {
+				sv.Sym = signalPhysical(s, float64(sv.Actual))
+				sv.Description = s.Unit
+				return sv, nil
+			}))
+		} else {
+			d.FieldUintFn(s.Name, func(d *decode.D) uint64 { d.SeekRel(int64(n)); return raw }, scalar.UintFn(func(sv scalar.Uint) (scalar.Uint, error) {
+				sv.Sym = signalPhysical(s, float64(sv.Actual))
+				sv.Description = s.Unit
+				return sv, nil
+			}))
+		}
+	}
+	d.SeekAbs(start + int64(nBits))
+}
@@ -4,7 +4,6 @@ package cbor
 // https://www.rfc-editor.org/rfc/rfc8949.html
 
 // TODO: streaming bytes test?
-// TODO: decode some sematic tags
 
 import (
 	"bytes"
@@ -76,22 +75,34 @@ var shortCountMap = scalar.UintMapSymStr{
 	shortCountIndefinite:    "indefinite",
 }
 
+const (
+	tagUnsignedBignum = 2
+	tagNegativeBignum = 3
+	tagEncodedCBOR    = 24
+)
+
 var tagMap = scalar.UintMapSymStr{
-	0:     "date_time",
-	1:     "epoch_date_time",
-	2:     "unsigned_bignum",
-	3:     "negative_bignum",
-	4:     "decimal_fraction",
-	5:     "bigfloat",
-	21:    "base64url",
-	22:    "base64",
-	23:    "base16",
-	24:    "encoded_cbor",
-	32:    "uri",
-	33:    "base64url",
-	34:    "base64",
-	36:    "mime_message",
-	55799: "self_described_cbor",
+	0:                 "date_time",
+	1:                 "epoch_date_time",
+	tagUnsignedBignum: "unsigned_bignum",
+	tagNegativeBignum: "negative_bignum",
+	4:                 "decimal_fraction",
+	5:                 "bigfloat",
+	tagCOSEEncrypt0:   "cose_encrypt0",
+	tagCOSEMac0:       "cose_mac0",
+	tagCOSESign1:      "cose_sign1",
+	21:                "base64url",
+	22:                "base64",
+	23:                "base16",
+	tagEncodedCBOR:    "encoded_cbor",
+	32:                "uri",
+	33:                "base64url",
+	34:                "base64",
+	36:                "mime_message",
+	tagCOSEEncrypt:    "cose_encrypt",
+	tagCOSEMac:        "cose_mac",
+	tagCOSESign:       "cose_sign",
+	55799:             "self_described_cbor",
 }
 
 const (
@@ -109,17 +120,19 @@ const (
 	breakMarker = 0xff
 )
 
-func decodeCBORValue(d *decode.D) any {
+// decodeCBORValue decodes a value, returns uint64, *big.Int, []byte or string for
+// ints, bytes and strings, otherwise nil. schema is used to name parts of COSE structures.
+func decodeCBORValue(d *decode.D, schema *coseSchema) any {
 	majorTypeMap := majorTypeEntries{
 		majorTypePositiveInt: {s: scalar.Uint{Sym: "positive_int"}, d: func(d *decode.D, shortCount uint64, count uint64) any {
 			d.FieldValueUint("value", count)
-			return nil
+			return count
 		}},
 		majorTypeNegativeInt: {s: scalar.Uint{Sym: "negative_int"}, d: func(d *decode.D, shortCount uint64, count uint64) any {
 			n := new(big.Int)
 			n.SetUint64(count).Neg(n).Sub(n, mathx.BigIntOne)
 			d.FieldValueBigInt("value", n)
-			return nil
+			return n
 		}},
 		majorTypeBytes: {s: scalar.Uint{Sym: "bytes"}, d: func(d *decode.D, shortCount uint64, count uint64) any {
 			if shortCount == shortCountIndefinite {
@@ -127,7 +140,7 @@ func decodeCBORValue(d *decode.D) any {
 				d.FieldArray("items", func(d *decode.D) {
 					for d.PeekUintBits(8) != breakMarker {
 						d.FieldStruct("item", func(d *decode.D) {
-							v := decodeCBORValue(d)
+							v := decodeCBORValue(d, nil)
 							switch v := v.(type) {
 							case []byte:
 								bb.Write(v)
@@ -152,7 +165,7 @@ func decodeCBORValue(d *decode.D) any {
 				d.FieldArray("items", func(d *decode.D) {
 					for d.PeekUintBits(8) != breakMarker {
 						d.FieldStruct("item", func(d *decode.D) {
-							v := decodeCBORValue(d)
+							v := decodeCBORValue(d, nil)
 							switch v := v.(type) {
 							case string:
 								sb.WriteString(v)
@@ -177,7 +190,13 @@ func decodeCBORValue(d *decode.D) any {
 					} else if i >= count {
 						break
 					}
-					d.FieldStruct("element", func(d *decode.D) { decodeCBORValue(d) })
+					d.FieldStruct("element", func(d *decode.D) {
+						if schema != nil {
+							schema.decodeElement(d, int(i))
+							return
+						}
+						decodeCBORValue(d, nil)
+					})
 				}
 			})
 			if shortCount == shortCountIndefinite {
@@ -194,8 +213,12 @@ func decodeCBORValue(d *decode.D) any {
 						break
 					}
 					d.FieldStruct("pair", func(d *decode.D) {
-						d.FieldStruct("key", func(d *decode.D) { decodeCBORValue(d) })
-						d.FieldStruct("value", func(d *decode.D) { decodeCBORValue(d) })
+						var k, v any
+						d.FieldStruct("key", func(d *decode.D) { k = decodeCBORValue(d, nil) })
+						d.FieldStruct("value", func(d *decode.D) { v = decodeCBORValue(d, nil) })
+						if schema != nil && schema.headers {
+							coseHeaderFields(d, k, v)
+						}
 					})
 				}
 			})
@@ -206,12 +229,26 @@ func decodeCBORValue(d *decode.D) any {
 		}},
 		majorTypeSematic: {s: scalar.Uint{Sym: "semantic"}, d: func(d *decode.D, shortCount uint64, count uint64) any {
 			d.FieldValueUint("tag", count, tagMap)
-			d.FieldStruct("value", func(d *decode.D) { decodeCBORValue(d) })
+			var v any
+			d.FieldStruct("value", func(d *decode.D) { v = decodeCBORValue(d, coseTagSchemas[count]) })
+			switch b, _ := v.([]byte); count {
+			case tagUnsignedBignum, tagNegativeBignum:
+				if b != nil {
+					n := new(big.Int).SetBytes(b)
+					if count == tagNegativeBignum {
+						n.Neg(n).Sub(n, mathx.BigIntOne)
+					}
+					d.FieldValueBigInt("bignum", n)
+				}
+			case tagEncodedCBOR:
+				if len(b) > 0 {
+					d.FieldStructRootBitBufFn("decoded", bitio.NewBitReader(b, -1), func(d *decode.D) { decodeCBORValue(d, nil) })
+				}
+			}
 			return nil
 		}},
 		majorTypeSpecialFloat: {s: scalar.Uint{Sym: "special_float"}, d: func(d *decode.D, shortCount uint64, count uint64) any {
 			switch shortCount {
-			// TODO: 0-19
 			case shortCountSpecialFalse:
 				d.FieldValueBool("value", false)
 			case shortCountSpecialTrue:
@@ -219,9 +256,10 @@ func decodeCBORValue(d *decode.D) any {
 			case shortCountSpecialNull:
 				d.FieldValueAny("value", nil)
 			case shortCountSpecialUndefined:
-				// TODO: undefined
-			case 24:
-				// TODO: future
+				d.FieldValueAny("value", nil)
+			case shortCountVariable8Bit:
+				// simple value 0-31 are reserved in this form
+				d.FieldU8("value", d.UintAssertRange(32, 255))
 			case shortCountSpecialFloat16Bit:
 				d.FieldF16("value")
 			case shortCountSpecialFloat32Bit:
@@ -230,6 +268,9 @@ func decodeCBORValue(d *decode.D) any {
 				d.FieldF64("value")
 			case 28, 29, 30:
 				// TODO: future
+			default:
+				// unassigned simple value 0-19
+				d.FieldValueUint("value", shortCount)
 			}
 			return nil
 		}},
@@ -265,6 +306,6 @@ func decodeCBORValue(d *decode.D) any {
 }
 
 func decodeCBOR(d *decode.D) any {
-	decodeCBORValue(d)
+	decodeCBORValue(d, nil)
 	return nil
 }
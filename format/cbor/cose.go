@@ -0,0 +1,185 @@
+package cbor
+
+// https://www.rfc-editor.org/rfc/rfc9052.html
+// https://www.rfc-editor.org/rfc/rfc9053.html
+// https://www.iana.org/assignments/cose/cose.xhtml
+
+import (
+	"math/big"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+)
+
+const (
+	tagCOSEEncrypt0 = 16
+	tagCOSEMac0     = 17
+	tagCOSESign1    = 18
+	tagCOSEEncrypt  = 96
+	tagCOSEMac      = 97
+	tagCOSESign     = 98
+)
+
+const coseHeaderAlg = 1
+
+var coseHeaderNames = map[int64]string{
+	coseHeaderAlg: "alg",
+	2:             "crit",
+	3:             "content_type",
+	4:             "kid",
+	5:             "iv",
+	6:             "partial_iv",
+	7:             "counter_signature",
+	32:            "x5bag",
+	33:            "x5chain",
+	34:            "x5t",
+	35:            "x5u",
+}
+
+var coseAlgNames = map[int64]string{
+	-259: "RS512",
+	-258: "RS384",
+	-257: "RS256",
+	-44:  "SHA-512",
+	-43:  "SHA-384",
+	-39:  "PS512",
+	-38:  "PS384",
+	-37:  "PS256",
+	-36:  "ES512",
+	-35:  "ES384",
+	-16:  "SHA-256",
+	-8:   "EdDSA",
+	-7:   "ES256",
+	-6:   "direct",
+	1:    "A128GCM",
+	2:    "A192GCM",
+	3:    "A256GCM",
+	4:    "HMAC 256/64",
+	5:    "HMAC 256/256",
+	6:    "HMAC 384/384",
+	7:    "HMAC 512/512",
+}
+
+// coseSchema describes a COSE array or header map
+type coseSchema struct {
+	elements []coseElement // named array elements
+	items    *coseSchema   // schema for all array elements, ex: signatures
+	headers  bool          // map with header labels
+}
+
+type coseElement struct {
+	name    string
+	schema  *coseSchema
+	wrapped bool // bstr with CBOR encoded value, ex: protected headers
+}
+
+var (
+	coseHeaders     = &coseSchema{headers: true}
+	coseProtected   = coseElement{name: "protected", schema: coseHeaders, wrapped: true}
+	coseUnprotected = coseElement{name: "unprotected", schema: coseHeaders}
+
+	coseSignature = &coseSchema{elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "signature"},
+	}}
+	coseRecipient = &coseSchema{elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "ciphertext"},
+	}}
+)
+
+var coseTagSchemas = map[uint64]*coseSchema{
+	tagCOSEEncrypt0: {elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "ciphertext"},
+	}},
+	tagCOSEMac0: {elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "payload"},
+		{name: "tag"},
+	}},
+	tagCOSESign1: {elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "payload"},
+		{name: "signature"},
+	}},
+	tagCOSEEncrypt: {elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "ciphertext"},
+		{name: "recipients", schema: &coseSchema{items: coseRecipient}},
+	}},
+	tagCOSEMac: {elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "payload"},
+		{name: "tag"},
+		{name: "recipients", schema: &coseSchema{items: coseRecipient}},
+	}},
+	tagCOSESign: {elements: []coseElement{
+		coseProtected,
+		coseUnprotected,
+		{name: "payload"},
+		{name: "signatures", schema: &coseSchema{items: coseSignature}},
+	}},
+}
+
+func init() {
+	// recipients can have recipients
+	coseRecipient.elements = append(coseRecipient.elements, coseElement{name: "recipients", schema: &coseSchema{items: coseRecipient}})
+}
+
+func (s *coseSchema) decodeElement(d *decode.D, i int) {
+	if s.items != nil {
+		decodeCBORValue(d, s.items)
+		return
+	}
+	if i >= len(s.elements) {
+		decodeCBORValue(d, nil)
+		return
+	}
+
+	e := s.elements[i]
+	d.FieldValueStr("name", e.name)
+	if !e.wrapped {
+		decodeCBORValue(d, e.schema)
+		return
+	}
+	if b, ok := decodeCBORValue(d, nil).([]byte); ok && len(b) > 0 {
+		d.FieldStructRootBitBufFn("decoded", bitio.NewBitReader(b, -1), func(d *decode.D) { decodeCBORValue(d, e.schema) })
+	}
+}
+
+func coseInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case uint64:
+		return int64(v), v < 1<<63
+	case *big.Int:
+		return v.Int64(), v.IsInt64()
+	}
+	return 0, false
+}
+
+// coseHeaderFields adds label name for a header map pair and algorithm name for alg header
+func coseHeaderFields(d *decode.D, k any, v any) {
+	label, ok := coseInt(k)
+	if !ok {
+		return
+	}
+	if name, ok := coseHeaderNames[label]; ok {
+		d.FieldValueStr("label", name)
+	}
+	if label != coseHeaderAlg {
+		return
+	}
+	if alg, ok := coseInt(v); ok {
+		if name, ok := coseAlgNames[alg]; ok {
+			d.FieldValueStr("algorithm", name)
+		}
+	}
+}
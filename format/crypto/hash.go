@@ -9,9 +9,11 @@ import (
 	"embed"
 	"fmt"
 	"hash"
+	"hash/crc32"
 	"io"
 
 	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
 	"github.com/wader/fq/pkg/interp"
 
 	//nolint: staticcheck
@@ -27,8 +29,14 @@ func init() {
 	interp.RegisterFS(hashFS)
 }
 
-func hashFn(s string) hash.Hash {
+func hashFn(s string, opts toHashOpts) hash.Hash {
 	switch s {
+	case "crc8":
+		return &checksum.CRC{Bits: 8, Current: uint(opts.Init), Table: checksum.MakeTable(uint(opts.Poly), 8)}
+	case "crc16":
+		return &checksum.CRC{Bits: 16, Table: checksum.ANSI16Table}
+	case "crc32":
+		return crc32.NewIEEE()
 	case "md4":
 		return md4.New()
 	case "md5":
@@ -54,6 +62,9 @@ func hashFn(s string) hash.Hash {
 
 type toHashOpts struct {
 	Name string
+	// polynomial and initial value for crc8
+	Poly int
+	Init int
 }
 
 func toHash(_ *interp.Interp, c any, opts toHashOpts) any {
@@ -62,7 +73,10 @@ func toHash(_ *interp.Interp, c any, opts toHashOpts) any {
 		return err
 	}
 
-	h := hashFn(opts.Name)
+	if opts.Name == "crc8" && (opts.Poly < 0 || opts.Poly > 0xff || opts.Init < 0 || opts.Init > 0xff) {
+		return fmt.Errorf("crc8 polynomial and initial value must be 0-255")
+	}
+	h := hashFn(opts.Name, opts)
 	if h == nil {
 		return fmt.Errorf("unknown hash function %s", opts.Name)
 	}
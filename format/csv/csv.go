@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/internal/gojqx"
@@ -73,7 +74,31 @@ func decodeCSV(d *decode.D) any {
 }
 
 type ToCSVOpts struct {
-	Comma string
+	Comma   string
+	Columns []string
+}
+
+func toCSVRecord(v any) ([]string, error) {
+	rs, ok := gojqx.Cast[[]any](v)
+	if !ok {
+		return nil, fmt.Errorf("expected row to be an array or object, got %s", gojqx.TypeErrorPreview(v))
+	}
+	vs, ok := gojqx.NormalizeToStrings(rs).([]any)
+	if !ok {
+		panic("not array")
+	}
+	var ss []string
+	for _, v := range vs {
+		switch v := v.(type) {
+		case string:
+			ss = append(ss, v)
+		case nil:
+			ss = append(ss, "")
+		default:
+			return nil, fmt.Errorf("expected row record to be scalars, got %s", gojqx.TypeErrorPreview(v))
+		}
+	}
+	return ss, nil
 }
 
 func toCSV(_ *interp.Interp, c []any, opts ToCSVOpts) any {
@@ -82,22 +107,34 @@ func toCSV(_ *interp.Interp, c []any, opts ToCSVOpts) any {
 	if opts.Comma != "" {
 		w.Comma = rune(opts.Comma[0])
 	}
+	// object rows are written as columns with a header row, columns are
+	// from options or the sorted keys of the first object row
+	columns := opts.Columns
+	wroteHeader := false
 	for _, row := range c {
-		rs, ok := gojqx.Cast[[]any](row)
-		if !ok {
-			return fmt.Errorf("expected row to be an array, got %s", gojqx.TypeErrorPreview(row))
-		}
-		vs, ok := gojqx.NormalizeToStrings(rs).([]any)
-		if !ok {
-			panic("not array")
-		}
-		var ss []string
-		for _, v := range vs {
-			s, ok := v.(string)
-			if !ok {
-				return fmt.Errorf("expected row record to be scalars, got %s", gojqx.TypeErrorPreview(v))
+		if obj, ok := row.(map[string]any); ok {
+			if columns == nil {
+				for k := range obj {
+					columns = append(columns, k)
+				}
+				sort.Strings(columns)
+			}
+			if !wroteHeader {
+				if err := w.Write(columns); err != nil {
+					return err
+				}
+				wroteHeader = true
+			}
+			rs := make([]any, len(columns))
+			for i, k := range columns {
+				rs[i] = obj[k]
 			}
-			ss = append(ss, s)
+			row = rs
+		}
+
+		ss, err := toCSVRecord(row)
+		if err != nil {
+			return err
 		}
 		if err := w.Write(ss); err != nil {
 			return err
@@ -0,0 +1,349 @@
+package disk
+
+// https://en.wikipedia.org/wiki/Master_boot_record
+// https://uefi.org/specs/UEFI/2.10/05_GUID_Partition_Table_Format.html
+
+import (
+	"embed"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed disk_image.md
+var diskImageFS embed.FS
+
+var filesystemGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.Disk_Image,
+		&decode.Format{
+			Description: "Disk image with MBR or GPT partition table",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeDiskImage,
+			DefaultInArg: format.Disk_Image_In{
+				ProbePartitions: true,
+			},
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Filesystem}, Out: &filesystemGroup},
+			},
+		})
+	interp.RegisterFS(diskImageFS)
+}
+
+const (
+	mbrPartitionsOffset      = 446
+	mbrPartitionCount        = 4
+	mbrSignature             = 0x55aa
+	gptSignature             = "EFI PART"
+	gptMinHeaderSize         = 92
+	gptMinEntrySize          = 128
+	gptMaxEntries            = 1024
+	defaultSectorSize        = 512
+	advancedFormatSectorSize = 4096
+)
+
+const (
+	mbrTypeEmpty         = 0x00
+	mbrTypeExtended      = 0x05
+	mbrTypeExtendedLBA   = 0x0f
+	mbrTypeLinuxExtended = 0x85
+	mbrTypeGPTProtective = 0xee
+)
+
+var mbrTypeNames = scalar.UintMapSymStr{
+	mbrTypeEmpty:         "empty",
+	0x01:                 "fat12",
+	0x04:                 "fat16_small",
+	mbrTypeExtended:      "extended",
+	0x06:                 "fat16",
+	0x07:                 "ntfs_exfat",
+	0x0b:                 "fat32_chs",
+	0x0c:                 "fat32_lba",
+	0x0e:                 "fat16_lba",
+	mbrTypeExtendedLBA:   "extended_lba",
+	0x82:                 "linux_swap",
+	0x83:                 "linux",
+	mbrTypeLinuxExtended: "linux_extended",
+	0x8e:                 "linux_lvm",
+	0xa5:                 "freebsd",
+	0xa6:                 "openbsd",
+	0xa9:                 "netbsd",
+	0xaf:                 "hfs",
+	mbrTypeGPTProtective: "gpt_protective",
+	0xef:                 "efi_system",
+	0xfd:                 "linux_raid",
+}
+
+var mbrStatusNames = scalar.UintMapSymStr{
+	0x00: "inactive",
+	0x80: "active",
+}
+
+// GUIDs are stored with the first three fields little endian
+func guidString(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)
+}
+
+var rawGUID = scalar.BitBufFn(func(s scalar.BitBuf) (scalar.BitBuf, error) {
+	return scalar.RawSym(s, -1, guidString)
+})
+
+type guidMapDescription map[string]string
+
+func (m guidMapDescription) MapBitBuf(s scalar.BitBuf) (scalar.BitBuf, error) {
+	if g, ok := s.Sym.(string); ok {
+		s.Description = m[g]
+	}
+	return s, nil
+}
+
+const guidUnused = "00000000-0000-0000-0000-000000000000"
+
+var partitionTypeNames = guidMapDescription{
+	"c12a7328-f81f-11d2-ba4b-00a0c93ec93b": "efi_system",
+	"21686148-6449-6e6f-744e-656564454649": "bios_boot",
+	"e3c9e316-0b5c-4db8-817d-f92df00215ae": "microsoft_reserved",
+	"ebd0a0a2-b9e5-4433-87c0-68b6b72699c7": "microsoft_basic_data",
+	"de94bba4-06d1-4d40-a16a-bfd50179d6ac": "windows_recovery",
+	"0fc63daf-8483-4772-8e79-3d69d8477de4": "linux_filesystem",
+	"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f": "linux_swap",
+	"e6d6d379-f507-44c2-a23c-238f2a3df928": "linux_lvm",
+	"a19d880f-05fc-4d3b-a006-743f0f84911e": "linux_raid",
+	"933ac7e1-2eb4-4f13-b844-0e14e2aef915": "linux_home",
+	"4f68bce3-e8cd-4db1-96e7-fbcaf984b709": "linux_root_x86_64",
+	"b921b045-1df0-41c3-af44-4c6f280d3fae": "linux_root_arm64",
+	"8484680c-9521-48c6-9c11-b0720656f69e": "linux_usr_x86_64",
+	"bc13c2ff-59e6-4262-a352-b275fd6f7172": "linux_extended_boot",
+	"48465300-0000-11aa-aa11-00306543ecac": "apple_hfs_plus",
+	"7c3457ef-0000-11aa-aa11-00306543ecac": "apple_apfs",
+	"516e7cb4-6ecf-11d6-8ff8-00022d09712b": "freebsd_data",
+	"83bd6b9d-7f41-11dc-be0b-001560b84f0f": "freebsd_boot",
+	"fe3a2a5d-4f32-41a7-b725-accc3285a309": "chromeos_kernel",
+	"3cb8e202-3b7e-47dd-8a3c-7ff2a13cfcec": "chromeos_root",
+}
+
+func fieldGUID(d *decode.D, name string, sms ...scalar.BitBufMapper) string {
+	v := d.FieldScalarRawLen(name, 16*8, append([]scalar.BitBufMapper{rawGUID}, sms...)...)
+	s, _ := v.Sym.(string)
+	return s
+}
+
+type partition struct {
+	entry int
+	start int64 // in bytes
+	size  int64 // in bytes
+}
+
+// CHS address with 6 bit sector and 10 bit cylinder sharing the last two bytes
+func decodeCHS(d *decode.D) {
+	d.FieldU8("head")
+	cylinderHi := d.FieldU2("cylinder_hi")
+	d.FieldU6("sector")
+	cylinderLo := d.FieldU8("cylinder_lo")
+	d.FieldValueUint("cylinder", cylinderHi<<8|cylinderLo)
+}
+
+func decodeMBR(d *decode.D) (partitions []partition, isProtective bool) {
+	d.FieldRawLen("bootstrap_code", (mbrPartitionsOffset-6)*8)
+	d.FieldU32("disk_signature", scalar.UintHex)
+	d.FieldU16("reserved")
+	d.FieldArray("partitions", func(d *decode.D) {
+		for i := 0; i < mbrPartitionCount; i++ {
+			d.FieldStruct("partition", func(d *decode.D) {
+				d.FieldU8("status", mbrStatusNames, scalar.UintHex)
+				d.FieldStruct("first_chs", decodeCHS)
+				partitionType := d.FieldU8("type", mbrTypeNames, scalar.UintHex)
+				d.FieldStruct("last_chs", decodeCHS)
+				lbaStart := d.FieldU32("lba_start")
+				sectorCount := d.FieldU32("sector_count")
+
+				switch partitionType {
+				case mbrTypeEmpty,
+					mbrTypeExtended,
+					mbrTypeExtendedLBA,
+					mbrTypeLinuxExtended:
+				case mbrTypeGPTProtective:
+					isProtective = true
+				default:
+					partitions = append(partitions, partition{
+						entry: i,
+						start: int64(lbaStart) * defaultSectorSize,
+						size:  int64(sectorCount) * defaultSectorSize,
+					})
+				}
+			})
+		}
+	})
+	d.FieldU16BE("signature", d.UintAssert(mbrSignature), scalar.UintHex)
+
+	return partitions, isProtective
+}
+
+type gptHeader struct {
+	backupLBA  uint64
+	entriesLBA uint64
+	entryCount uint64
+	entrySize  uint64
+}
+
+func decodeGPTHeader(d *decode.D, sectorSize int64) gptHeader {
+	var h gptHeader
+	start := d.Pos()
+
+	d.FieldUTF8("signature", len(gptSignature), d.StrAssert(gptSignature))
+	d.FieldU32("revision", scalar.UintHex)
+	headerSize := d.FieldU32("header_size")
+	if headerSize < gptMinHeaderSize || int64(headerSize) > sectorSize {
+		d.Fatalf("invalid header size %d", headerSize)
+	}
+	// crc is of the header with the crc field zeroed
+	header := append([]byte{}, d.BytesRange(start, int(headerSize))...)
+	copy(header[16:20], []byte{0, 0, 0, 0})
+	d.FieldU32("header_crc32", d.UintValidate(uint64(crc32.ChecksumIEEE(header))), scalar.UintHex)
+	d.FieldU32("reserved")
+	d.FieldU64("current_lba")
+	h.backupLBA = d.FieldU64("backup_lba")
+	d.FieldU64("first_usable_lba")
+	d.FieldU64("last_usable_lba")
+	fieldGUID(d, "disk_guid")
+	h.entriesLBA = d.FieldU64("partition_entries_lba")
+	h.entryCount = d.FieldU32("partition_entry_count")
+	h.entrySize = d.FieldU32("partition_entry_size")
+	if h.entryCount > gptMaxEntries || h.entrySize < gptMinEntrySize || h.entrySize%8 != 0 {
+		d.Fatalf("invalid partition entry count %d or size %d", h.entryCount, h.entrySize)
+	}
+	entriesPos := int64(h.entriesLBA) * sectorSize * 8
+	entriesLen := int64(h.entryCount * h.entrySize)
+	if entriesPos+entriesLen*8 <= d.Len() {
+		entriesCRC := crc32.ChecksumIEEE(d.BytesRange(entriesPos, int(entriesLen)))
+		d.FieldU32("partition_entries_crc32", d.UintValidate(uint64(entriesCRC)), scalar.UintHex)
+	} else {
+		d.FieldU32("partition_entries_crc32", scalar.UintHex)
+	}
+	d.FieldRawLen("reserved2", sectorSize*8-(d.Pos()-start))
+
+	return h
+}
+
+func decodeGPTEntries(d *decode.D, h gptHeader, sectorSize int64) []partition {
+	var partitions []partition
+
+	d.FieldArray("gpt_entries", func(d *decode.D) {
+		for i := 0; i < int(h.entryCount); i++ {
+			entryStart := d.Pos()
+			// unused entries have a zero partition type
+			if guidString(d.PeekBytes(16)) == guidUnused {
+				d.SeekRel(int64(h.entrySize) * 8)
+				continue
+			}
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldValueUint("index", uint64(i))
+				fieldGUID(d, "type_guid", partitionTypeNames)
+				fieldGUID(d, "unique_guid")
+				firstLBA := d.FieldU64("first_lba")
+				lastLBA := d.FieldU64("last_lba")
+				d.FieldU64("attributes", scalar.UintHex)
+				d.FieldUTF16LE("name", 72, scalar.StrActualTrim("\x00"))
+				if n := entryStart + int64(h.entrySize)*8 - d.Pos(); n > 0 {
+					d.FieldRawLen("reserved", n)
+				}
+				if lastLBA >= firstLBA {
+					partitions = append(partitions, partition{
+						entry: i,
+						start: int64(firstLBA) * sectorSize,
+						size:  int64(lastLBA-firstLBA+1) * sectorSize,
+					})
+				}
+			})
+		}
+	})
+
+	return partitions
+}
+
+func decodeDiskImage(d *decode.D) any {
+	var di format.Disk_Image_In
+	d.ArgAs(&di)
+
+	d.Endian = decode.LittleEndian
+
+	// validate signature and MBR entries to not probe boot sectors etc
+	d.SeekAbs(mbrPartitionsOffset*8, func(d *decode.D) {
+		for i := 0; i < mbrPartitionCount; i++ {
+			if status := d.U8(); status != 0x00 && status != 0x80 {
+				d.Fatalf("invalid partition %d status %x", i, status)
+			}
+			d.SeekRel(15 * 8)
+		}
+		if d.U16BE() != mbrSignature {
+			d.Fatalf("no MBR signature")
+		}
+	})
+
+	var partitions []partition
+	var isProtective bool
+	d.FieldStruct("mbr", func(d *decode.D) { partitions, isProtective = decodeMBR(d) })
+	if len(partitions) == 0 && !isProtective {
+		d.Fatalf("no partitions found")
+	}
+
+	if isProtective {
+		// GPT header is at LBA 1 so its position depends on sector size
+		sectorSize := int64(0)
+		for _, s := range []int64{defaultSectorSize, advancedFormatSectorSize} {
+			if (s+int64(len(gptSignature)))*8 <= d.Len() && string(d.BytesRange(s*8, len(gptSignature))) == gptSignature {
+				sectorSize = s
+				break
+			}
+		}
+		if sectorSize == 0 {
+			d.Fatalf("protective MBR without GPT header")
+		}
+
+		var h gptHeader
+		d.SeekAbs(sectorSize * 8)
+		d.FieldStruct("gpt_header", func(d *decode.D) { h = decodeGPTHeader(d, sectorSize) })
+		d.SeekAbs(int64(h.entriesLBA) * sectorSize * 8)
+		partitions = decodeGPTEntries(d, h, sectorSize)
+
+		backupPos := int64(h.backupLBA) * sectorSize * 8
+		if h.backupLBA > 1 && backupPos+sectorSize*8 <= d.Len() {
+			d.SeekAbs(backupPos)
+			d.FieldStruct("gpt_backup_header", func(d *decode.D) { decodeGPTHeader(d, sectorSize) })
+		}
+	}
+
+	d.FieldArray("partitions", func(d *decode.D) {
+		for _, p := range partitions {
+			// partitions might be truncated or outside of image
+			size := min(p.size*8, d.Len()-p.start*8)
+			if size <= 0 {
+				continue
+			}
+			d.SeekAbs(p.start * 8)
+			d.FieldStruct("partition", func(d *decode.D) {
+				d.FieldValueUint("entry", uint64(p.entry))
+				if di.ProbePartitions {
+					d.FieldFormatOrRawLen("data", size, &filesystemGroup, nil)
+				} else {
+					d.FieldRawLen("data", size)
+				}
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,121 @@
+#!/usr/bin/env python3
+# generates small GPT and MBR disk images with a squashfs partition and a raw partition
+import pathlib
+import struct
+import uuid
+import zlib
+
+here = pathlib.Path(__file__).parent
+
+SECTOR = 512
+ENTRY_COUNT = 128
+ENTRY_SIZE = 128
+ENTRIES_SECTORS = ENTRY_COUNT * ENTRY_SIZE // SECTOR
+
+LINUX_FILESYSTEM = uuid.UUID("0fc63daf-8483-4772-8e79-3d69d8477de4")
+LINUX_SWAP = uuid.UUID("0657fd6d-a4ab-43c4-84e5-0933c84b4f4f")
+
+squashfs = (here / "../../squashfs/testdata/test.squashfs").read_bytes()
+raw = bytes(range(256)) * 8
+
+
+def pad_sectors(b):
+    return b + b"\0" * (-len(b) % SECTOR)
+
+
+def chs(lba):
+    # only valid for small disks, 16 heads 63 sectors
+    c, rem = divmod(lba, 16 * 63)
+    h, s = divmod(rem, 63)
+    return struct.pack("<BBB", h, ((c >> 2) & 0xC0) | (s + 1), c & 0xFF)
+
+
+def mbr(partitions):
+    b = b"\xfa\xeb\xfe" + b"\0" * (440 - 3) + struct.pack("<IH", 0x12345678, 0)
+    for status, ptype, lba, count in partitions:
+        b += struct.pack("<B", status) + chs(lba) + struct.pack("<B", ptype) + chs(lba + count - 1) + struct.pack("<II", lba, count)
+    b += b"\0" * 16 * (4 - len(partitions))
+    return b + b"\x55\xaa"
+
+
+def gpt_header(current, backup, first_usable, last_usable, entries_lba, entries):
+    def pack(crc):
+        return struct.pack(
+            "<8sIIIIQQQQ16sQIII",
+            b"EFI PART",
+            0x00010000,
+            92,
+            crc,
+            0,
+            current,
+            backup,
+            first_usable,
+            last_usable,
+            uuid.UUID("01234567-89ab-cdef-0123-456789abcdef").bytes_le,
+            entries_lba,
+            ENTRY_COUNT,
+            ENTRY_SIZE,
+            zlib.crc32(entries),
+        )
+
+    return pad_sectors(pack(zlib.crc32(pack(0))))
+
+
+def gpt_entry(type_guid, unique, first, last, attributes, name):
+    return struct.pack("<16s16sQQQ72s", type_guid.bytes_le, unique.bytes_le, first, last, attributes, name.encode("utf-16-le"))
+
+
+def gpt_image():
+    parts = [pad_sectors(squashfs), pad_sectors(raw)]
+    first_usable = 2 + ENTRIES_SECTORS
+    lba = first_usable
+    entries = b""
+    data = b""
+    for i, (p, type_guid, name, attributes) in enumerate(
+        [
+            (parts[0], LINUX_FILESYSTEM, "root", 0),
+            (parts[1], LINUX_SWAP, "swap", 1),
+        ]
+    ):
+        n = len(p) // SECTOR
+        entries += gpt_entry(type_guid, uuid.UUID(int=i + 1), lba, lba + n - 1, attributes, name)
+        data += p
+        lba += n
+    entries += b"\0" * (ENTRY_COUNT * ENTRY_SIZE - len(entries))
+    last_usable = lba - 1
+    backup_entries_lba = lba
+    backup_lba = backup_entries_lba + ENTRIES_SECTORS
+
+    return (
+        mbr([(0x00, 0xEE, 1, backup_lba)])
+        + gpt_header(1, backup_lba, first_usable, last_usable, 2, entries)
+        + entries
+        + data
+        + entries
+        + gpt_header(backup_lba, 1, first_usable, last_usable, backup_entries_lba, entries)
+    )
+
+
+def mbr_image():
+    p0 = pad_sectors(squashfs)
+    p1 = pad_sectors(raw)
+    lba0 = 1
+    lba1 = lba0 + len(p0) // SECTOR
+    lba2 = lba1 + len(p1) // SECTOR
+    return (
+        mbr(
+            [
+                (0x80, 0x83, lba0, len(p0) // SECTOR),
+                (0x00, 0x0C, lba1, len(p1) // SECTOR),
+                # extended partition without logical partitions
+                (0x00, 0x05, lba2, 1),
+            ]
+        )
+        + p0
+        + p1
+        + b"\0" * SECTOR
+    )
+
+
+(here / "gpt.img").write_bytes(gpt_image())
+(here / "mbr.img").write_bytes(mbr_image())
@@ -1,11 +1,18 @@
 package dns
 
 // https://datatracker.ietf.org/doc/html/rfc1035
+// https://datatracker.ietf.org/doc/html/rfc2782 SRV
+// https://datatracker.ietf.org/doc/html/rfc4034 DNSSEC resource records
+// https://datatracker.ietf.org/doc/html/rfc6762 Multicast DNS
+// https://datatracker.ietf.org/doc/html/rfc6891 EDNS(0)
+// https://datatracker.ietf.org/doc/html/rfc8659 CAA
 // https://github.com/Forescout/namewreck/blob/main/rfc/draft-dashevskyi-dnsrr-antipatterns-00.txt
 
 import (
+	"embed"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
@@ -13,6 +20,9 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed dns.md
+var dnsFS embed.FS
+
 func init() {
 	interp.RegisterFormat(
 		format.DNS,
@@ -21,6 +31,7 @@ func init() {
 			Groups:      []*decode.Group{format.UDP_Payload},
 			DecodeFn:    dnsUDPDecode,
 		})
+	interp.RegisterFS(dnsFS)
 }
 
 const (
@@ -42,63 +53,152 @@ var classNames = scalar.UintRangeToScalar{
 }
 
 const (
-	typeA     = 1
-	typeNS    = 2
-	typeCNAME = 5
-	typeSOA   = 6
-	typePTR   = 12
-	typeTXT   = 16
-	typeAAAA  = 28
+	typeA      = 1
+	typeNS     = 2
+	typeCNAME  = 5
+	typeSOA    = 6
+	typePTR    = 12
+	typeHINFO  = 13
+	typeMX     = 15
+	typeTXT    = 16
+	typeAAAA   = 28
+	typeSRV    = 33
+	typeOPT    = 41
+	typeDS     = 43
+	typeRRSIG  = 46
+	typeDNSKEY = 48
+	typeCAA    = 257
 )
 
 var typeNames = scalar.UintMapSymStr{
-	typeA:     "a",
-	typeAAAA:  "aaaa",
-	18:        "afsdb",
-	42:        "apl",
-	257:       "caa",
-	60:        "cdnskey",
-	59:        "cds",
-	37:        "cert",
-	typeCNAME: "cname",
-	62:        "csync",
-	49:        "dhcid",
-	32769:     "dlv",
-	39:        "dname",
-	48:        "dnskey",
-	43:        "ds",
-	108:       "eui48",
-	109:       "eui64",
-	13:        "hinfo",
-	55:        "hip",
-	45:        "ipseckey",
-	25:        "key",
-	36:        "kx",
-	29:        "loc",
-	15:        "mx",
-	35:        "naptr",
-	typeNS:    "ns",
-	47:        "nsec",
-	50:        "nsec3",
-	51:        "nsec3_param",
-	61:        "openpgp_key",
-	typePTR:   "ptr",
-	46:        "rrsig",
-	17:        "rp",
-	24:        "sig",
-	53:        "smimea",
-	typeSOA:   "soa",
-	33:        "srv",
-	44:        "sshfp",
-	32768:     "ta",
-	249:       "tkey",
-	52:        "tlsa",
-	250:       "tsig",
-	typeTXT:   "txt",
-	256:       "uri",
-	63:        "zonemd",
-	64:        "svcb",
-	65:        "https",
+	typeA:      "a",
+	typeAAAA:   "aaaa",
+	18:         "afsdb",
+	255:        "any",
+	42:         "apl",
+	252:        "axfr",
+	typeCAA:    "caa",
+	60:         "cdnskey",
+	59:         "cds",
+	37:         "cert",
+	typeCNAME:  "cname",
+	62:         "csync",
+	49:         "dhcid",
+	32769:      "dlv",
+	39:         "dname",
+	typeDNSKEY: "dnskey",
+	typeDS:     "ds",
+	108:        "eui48",
+	109:        "eui64",
+	typeHINFO:  "hinfo",
+	55:         "hip",
+	45:         "ipseckey",
+	251:        "ixfr",
+	25:         "key",
+	36:         "kx",
+	29:         "loc",
+	typeMX:     "mx",
+	35:         "naptr",
+	typeNS:     "ns",
+	47:         "nsec",
+	50:         "nsec3",
+	51:         "nsec3_param",
+	61:         "openpgp_key",
+	typeOPT:    "opt",
+	typePTR:    "ptr",
+	typeRRSIG:  "rrsig",
+	17:         "rp",
+	24:         "sig",
+	53:         "smimea",
+	typeSOA:    "soa",
+	typeSRV:    "srv",
+	44:         "sshfp",
+	32768:      "ta",
+	249:        "tkey",
+	52:         "tlsa",
+	250:        "tsig",
+	typeTXT:    "txt",
+	256:        "uri",
+	63:         "zonemd",
+	64:         "svcb",
+	65:         "https",
+}
+
+// https://datatracker.ietf.org/doc/html/rfc8914#section-5.2
+var extendedDNSErrorNames = scalar.UintMapSymStr{
+	0:  "other",
+	1:  "unsupported_dnskey_algorithm",
+	2:  "unsupported_ds_digest_type",
+	3:  "stale_answer",
+	4:  "forged_answer",
+	5:  "dnssec_indeterminate",
+	6:  "dnssec_bogus",
+	7:  "signature_expired",
+	8:  "signature_not_yet_valid",
+	9:  "dnskey_missing",
+	10: "rrsigs_missing",
+	11: "no_zone_key_bit_set",
+	12: "nsec_missing",
+	13: "cached_error",
+	14: "not_ready",
+	15: "blocked",
+	16: "censored",
+	17: "filtered",
+	18: "prohibited",
+	19: "stale_nxdomain_answer",
+	20: "not_authoritative",
+	21: "not_supported",
+	22: "no_reachable_authority",
+	23: "network_error",
+	24: "invalid_data",
+}
+
+// https://www.iana.org/assignments/dns-sec-alg-numbers/dns-sec-alg-numbers.xhtml
+var dnssecAlgorithmNames = scalar.UintMapSymStr{
+	1:  "rsamd5",
+	3:  "dsa",
+	5:  "rsasha1",
+	6:  "dsa_nsec3_sha1",
+	7:  "rsasha1_nsec3_sha1",
+	8:  "rsasha256",
+	10: "rsasha512",
+	12: "ecc_gost",
+	13: "ecdsap256sha256",
+	14: "ecdsap384sha384",
+	15: "ed25519",
+	16: "ed448",
+}
+
+var dsDigestTypeNames = scalar.UintMapSymStr{
+	1: "sha1",
+	2: "sha256",
+	3: "gost_r_34_11_94",
+	4: "sha384",
+}
+
+const (
+	ednsOptionClientSubnet     = 8
+	ednsOptionCookie           = 10
+	ednsOptionPadding          = 12
+	ednsOptionExtendedDNSError = 15
+	ednsClientSubnetFamilyIPv4 = 1
+	ednsClientSubnetFamilyIPv6 = 2
+)
+
+// https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml#dns-parameters-11
+var ednsOptionNames = scalar.UintMapSymStr{
+	3:                          "nsid",
+	5:                          "dau",
+	6:                          "dhu",
+	7:                          "n3u",
+	ednsOptionClientSubnet:     "client_subnet",
+	9:                          "expire",
+	ednsOptionCookie:           "cookie",
+	11:                         "tcp_keepalive",
+	ednsOptionPadding:          "padding",
+	13:                         "chain",
+	14:                         "key_tag",
+	ednsOptionExtendedDNSError: "extended_dns_error",
 }
 
 var rcodeNames = scalar.UintMap{
@@ -172,58 +272,187 @@ func fieldDecodeLabel(d *decode.D, pointerOffset int64, name string) {
 	}
 }
 
-func dnsDecodeRR(d *decode.D, pointerOffset int64, resp bool, count uint64, name string, structName string) {
+func fieldCharacterStrings(d *decode.D, name string) {
+	var ss []string
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldArray("strings", func(d *decode.D) {
+			for !d.End() {
+				ss = append(ss, d.FieldUTF8ShortString("string"))
+			}
+		})
+		d.FieldValueStr("value", strings.Join(ss, ""))
+	})
+}
+
+func decodeEDNSOptions(d *decode.D) {
+	d.FieldArray("options", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("option", func(d *decode.D) {
+				code := d.FieldU16("code", ednsOptionNames)
+				length := d.FieldU16("length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					switch code {
+					case ednsOptionClientSubnet:
+						family := d.FieldU16("family", scalar.UintMapSymStr{
+							ednsClientSubnetFamilyIPv4: "ipv4",
+							ednsClientSubnetFamilyIPv6: "ipv6",
+						})
+						d.FieldU8("source_prefix_length")
+						d.FieldU8("scope_prefix_length")
+						// address is truncated to source prefix length, pad to full length
+						addressLen := int(d.BitsLeft() / 8)
+						d.FieldStrFn("address", func(d *decode.D) string {
+							var b []byte
+							switch family {
+							case ednsClientSubnetFamilyIPv4:
+								b = make([]byte, 4)
+							case ednsClientSubnetFamilyIPv6:
+								b = make([]byte, 16)
+							default:
+								d.Fatalf("unknown client subnet family %d", family)
+							}
+							if addressLen > len(b) {
+								d.Fatalf("client subnet address length %d too long", addressLen)
+							}
+							copy(b, d.BytesLen(addressLen))
+							return net.IP(b).String()
+						})
+					case ednsOptionCookie:
+						d.FieldRawLen("client_cookie", 8*8)
+						if !d.End() {
+							d.FieldRawLen("server_cookie", d.BitsLeft())
+						}
+					case ednsOptionPadding:
+						d.FieldRawLen("padding", d.BitsLeft())
+					case ednsOptionExtendedDNSError:
+						d.FieldU16("info_code", extendedDNSErrorNames)
+						d.FieldUTF8("extra_text", int(d.BitsLeft()/8))
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+}
+
+func decodeRData(d *decode.D, pointerOffset int64, typ uint64, class uint64) {
+	// TODO: all only for classIN?
+	switch {
+	case class == classIN && typ == typeA:
+		d.FieldStrFn("address", decodeAStr)
+	case typ == typeNS:
+		fieldDecodeLabel(d, pointerOffset, "ns")
+	case typ == typeCNAME:
+		fieldDecodeLabel(d, pointerOffset, "cname")
+	case typ == typeSOA:
+		fieldDecodeLabel(d, pointerOffset, "mname")
+		fieldDecodeLabel(d, pointerOffset, "rname")
+		d.FieldU32("serial")
+		d.FieldU32("refresh")
+		d.FieldU32("retry")
+		d.FieldU32("expire")
+		d.FieldU32("minimum")
+	case typ == typePTR:
+		fieldDecodeLabel(d, pointerOffset, "ptr")
+	case typ == typeHINFO:
+		d.FieldUTF8ShortString("cpu")
+		d.FieldUTF8ShortString("os")
+	case typ == typeMX:
+		d.FieldU16("preference")
+		fieldDecodeLabel(d, pointerOffset, "exchange")
+	case typ == typeTXT:
+		fieldCharacterStrings(d, "txt")
+	case class == classIN && typ == typeAAAA:
+		d.FieldStrFn("address", decodeAAAAStr)
+	case typ == typeSRV:
+		d.FieldU16("priority")
+		d.FieldU16("weight")
+		d.FieldU16("port")
+		fieldDecodeLabel(d, pointerOffset, "target")
+	case typ == typeOPT:
+		decodeEDNSOptions(d)
+	case typ == typeDS:
+		d.FieldU16("key_tag")
+		d.FieldU8("algorithm", dnssecAlgorithmNames)
+		d.FieldU8("digest_type", dsDigestTypeNames)
+		d.FieldRawLen("digest", d.BitsLeft())
+	case typ == typeRRSIG:
+		d.FieldU16("type_covered", typeNames)
+		d.FieldU8("algorithm", dnssecAlgorithmNames)
+		d.FieldU8("labels")
+		d.FieldU32("original_ttl")
+		d.FieldU32("signature_expiration", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+		d.FieldU32("signature_inception", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+		d.FieldU16("key_tag")
+		fieldDecodeLabel(d, pointerOffset, "signer_name")
+		d.FieldRawLen("signature", d.BitsLeft())
+	case typ == typeDNSKEY:
+		d.FieldStruct("flags", func(d *decode.D) {
+			d.FieldU7("unused0")
+			d.FieldBool("zone_key")
+			d.FieldBool("revoked")
+			d.FieldU6("unused1")
+			d.FieldBool("secure_entry_point")
+		})
+		d.FieldU8("protocol")
+		d.FieldU8("algorithm", dnssecAlgorithmNames)
+		d.FieldRawLen("public_key", d.BitsLeft())
+	case typ == typeCAA:
+		d.FieldStruct("flags", func(d *decode.D) {
+			d.FieldBool("critical")
+			d.FieldU7("unused")
+		})
+		tagLength := d.FieldU8("tag_length")
+		d.FieldUTF8("tag", int(tagLength))
+		d.FieldUTF8("value", int(d.BitsLeft()/8))
+	default:
+		d.FieldRawLen("rdata", d.BitsLeft())
+	}
+}
+
+func dnsDecodeRR(d *decode.D, pointerOffset int64, isMDNS bool, resp bool, count uint64, name string, structName string) {
 	d.FieldArray(name, func(d *decode.D) {
 		for i := uint64(0); i < count; i++ {
 			d.FieldStruct(structName, func(d *decode.D) {
 				fieldDecodeLabel(d, pointerOffset, "name")
 				typ := d.FieldU16("type", typeNames)
-				class := d.FieldU16("class", classNames)
-				if resp {
+				var class uint64
+				switch {
+				case resp && typ == typeOPT:
+					// EDNS(0) pseudo RR reuses class as payload size and ttl as extended rcode and flags
+					d.FieldU16("udp_payload_size")
+					d.FieldU8("extended_rcode")
+					d.FieldU8("version")
+					d.FieldBool("dnssec_ok")
+					d.FieldU15("z")
+				case isMDNS:
+					// top bit of class is unicast-response for questions and cache-flush for records
+					if resp {
+						d.FieldBool("cache_flush")
+					} else {
+						d.FieldBool("unicast_response")
+					}
+					class = d.FieldU15("class", classNames)
+				default:
+					class = d.FieldU16("class", classNames)
+				}
+				if !resp {
+					return
+				}
+				if typ != typeOPT {
 					d.FieldU32("ttl")
-					rdLength := d.FieldU16("rdlength")
-					d.FramedFn(int64(rdLength)*8, func(d *decode.D) {
-						// TODO: all only for classIN?
-						switch {
-						case class == classIN && typ == typeA:
-							d.FieldStrFn("address", decodeAStr)
-						case typ == typeNS:
-							fieldDecodeLabel(d, pointerOffset, "ns")
-						case typ == typeCNAME:
-							fieldDecodeLabel(d, pointerOffset, "cname")
-						case typ == typeSOA:
-							fieldDecodeLabel(d, pointerOffset, "mname")
-							fieldDecodeLabel(d, pointerOffset, "rname")
-							d.FieldU32("serial")
-							d.FieldU32("refresh")
-							d.FieldU32("retry")
-							d.FieldU32("expire")
-							d.FieldU32("minimum")
-						case typ == typePTR:
-							fieldDecodeLabel(d, pointerOffset, "ptr")
-						case typ == typeTXT:
-							var ss []string
-							d.FieldStruct("txt", func(d *decode.D) {
-								d.FieldArray("strings", func(d *decode.D) {
-									for !d.End() {
-										ss = append(ss, d.FieldUTF8ShortString("string"))
-									}
-								})
-								d.FieldValueStr("value", strings.Join(ss, ""))
-							})
-						case class == classIN && typ == typeAAAA:
-							d.FieldStrFn("address", decodeAAAAStr)
-						default:
-							d.FieldUTF8("rdata", int(rdLength))
-						}
-					})
 				}
+				rdLength := d.FieldU16("rdlength")
+				d.FramedFn(int64(rdLength)*8, func(d *decode.D) {
+					decodeRData(d, pointerOffset, typ, class)
+				})
 			})
 		}
 	})
 }
 
-func dnsDecode(d *decode.D, hasLengthHeader bool) any {
+func dnsDecode(d *decode.D, hasLengthHeader bool, isMDNS bool) any {
 	pointerOffset := int64(0)
 	d.FieldStruct("header", func(d *decode.D) {
 		if hasLengthHeader {
@@ -246,7 +475,9 @@ func dnsDecode(d *decode.D, hasLengthHeader bool) any {
 		d.FieldBool("truncation")
 		d.FieldBool("recursion_desired")
 		d.FieldBool("recursion_available")
-		d.FieldU3("z")
+		d.FieldU1("z")
+		d.FieldBool("authentic_data")    // RFC 4035
+		d.FieldBool("checking_disabled") // RFC 4035
 		d.FieldU4("rcode", rcodeNames)
 	})
 
@@ -254,19 +485,21 @@ func dnsDecode(d *decode.D, hasLengthHeader bool) any {
 	anCount := d.FieldU16("an_count")
 	nsCount := d.FieldU16("ns_count")
 	arCount := d.FieldU16("ar_count")
-	dnsDecodeRR(d, pointerOffset, false, qdCount, "questions", "question")
-	dnsDecodeRR(d, pointerOffset, true, anCount, "answers", "answer")
-	dnsDecodeRR(d, pointerOffset, true, nsCount, "nameservers", "nameserver")
-	dnsDecodeRR(d, pointerOffset, true, arCount, "additionals", "additional")
+	dnsDecodeRR(d, pointerOffset, isMDNS, false, qdCount, "questions", "question")
+	dnsDecodeRR(d, pointerOffset, isMDNS, true, anCount, "answers", "answer")
+	dnsDecodeRR(d, pointerOffset, isMDNS, true, nsCount, "nameservers", "nameserver")
+	dnsDecodeRR(d, pointerOffset, isMDNS, true, arCount, "additionals", "additional")
 
 	return nil
 }
 
 func dnsUDPDecode(d *decode.D) any {
 	var upi format.UDP_Payload_In
+	isMDNS := false
 	if d.ArgAs(&upi) {
 		upi.MustIsPort(d.Fatalf, format.UDPPortDomain, format.UDPPortMDNS)
+		isMDNS = upi.IsPort(format.UDPPortMDNS)
 	}
 
-	return dnsDecode(d, false)
+	return dnsDecode(d, false, isMDNS)
 }
@@ -21,5 +21,5 @@ func dnsTCPDecode(d *decode.D) any {
 	if d.ArgAs(&tsi) {
 		tsi.MustIsPort(d.Fatalf, format.TCPPortDomain)
 	}
-	return dnsDecode(d, true)
+	return dnsDecode(d, true, false)
 }
@@ -0,0 +1,154 @@
+#!/usr/bin/env python3
+# generates dns test messages and a mdns capture
+import struct
+
+
+class Message:
+    def __init__(self):
+        self.b = b""
+        self.names = {}
+
+    def name(self, n, extra=0):
+        # encode name using compression pointers to previously written suffixes,
+        # extra is number of bytes that will be written before the name
+        labels = n.split(".") if n else []
+        out = b""
+        for i in range(len(labels)):
+            suffix = ".".join(labels[i:])
+            if suffix in self.names:
+                return out + struct.pack(">H", 0xC000 | self.names[suffix])
+            self.names[suffix] = len(self.b) + extra + len(out)
+            out += bytes([len(labels[i])]) + labels[i].encode()
+        return out + b"\x00"
+
+    def add(self, b):
+        self.b += b
+
+    def question(self, n, typ, cls=1):
+        self.add(self.name(n))
+        self.add(struct.pack(">HH", typ, cls))
+
+    def rr(self, n, typ, rdata_fn, cls=1, ttl=3600):
+        self.add(self.name(n))
+        self.add(struct.pack(">HHI", typ, cls, ttl))
+        # rdata is generated after rdlength so names in it are compressed with correct offsets
+        rdata = rdata_fn(len(self.b) + 2)
+        self.add(struct.pack(">H", len(rdata)) + rdata)
+
+    def with_name(self, prefix, n):
+        return lambda offset: prefix + self.name(n, offset - len(self.b) + len(prefix))
+
+
+def header(id, flags, qd, an, ns, ar):
+    return struct.pack(">HHHHHH", id, flags, qd, an, ns, ar)
+
+
+def char_string(s):
+    return bytes([len(s)]) + s
+
+
+def edns_option(code, data):
+    return struct.pack(">HH", code, len(data)) + data
+
+
+def opt_rr(payload_size, ext_rcode, version, do, options):
+    ttl = ext_rcode << 24 | version << 16 | (0x8000 if do else 0)
+    rdata = b"".join(options)
+    return b"\x00" + struct.pack(">HHIH", 41, payload_size, ttl, len(rdata)) + rdata
+
+
+# recursive query with ad bit and edns cookie, client subnet and padding
+m = Message()
+m.add(header(0x1234, 0x0120, 1, 0, 0, 1))
+m.question("example.com", 1)
+m.add(
+    opt_rr(
+        1232,
+        0,
+        0,
+        True,
+        [
+            edns_option(10, bytes(range(8))),
+            edns_option(8, struct.pack(">HBB", 1, 24, 0) + bytes([192, 0, 2])),
+            edns_option(12, bytes(4)),
+        ],
+    )
+)
+open("query_edns.dns", "wb").write(m.b)
+
+# response with common rr types
+m = Message()
+answers = 10
+m.add(header(0x1234, 0x81A0, 1, answers, 0, 1))
+m.question("example.com", 255)
+
+
+m.rr("example.com", 15, m.with_name(struct.pack(">H", 10), "mail.example.com"))
+m.rr("_sip._tcp.example.com", 33, m.with_name(struct.pack(">HHH", 10, 60, 5060), "sip.example.com"))
+m.rr("example.com", 257, lambda _: b"\x00" + char_string(b"issue") + b"letsencrypt.org")
+m.rr("example.com", 257, lambda _: b"\x80" + char_string(b"iodef") + b"mailto:security@example.com")
+m.rr("host.example.com", 13, lambda _: char_string(b"x86_64") + char_string(b"Linux"))
+m.rr("example.com", 16, lambda _: char_string(b"v=spf1 ") + char_string(b"-all"))
+m.rr("example.com", 43, lambda _: struct.pack(">HBB", 12345, 13, 2) + bytes(range(32)))
+m.rr("example.com", 48, lambda _: struct.pack(">HBB", 257, 3, 13) + bytes(range(64)))
+m.rr(
+    "example.com",
+    46,
+    m.with_name(struct.pack(">HBBIIIH", 48, 13, 2, 3600, 1704067200, 1701388800, 12345), "example.com"),
+)
+m.rr("example.com", 65280, lambda _: b"private data")
+m.add(opt_rr(1232, 0, 0, False, [edns_option(15, struct.pack(">H", 18) + b"prohibited")]))
+open("response_rr_types.dns", "wb").write(m.b)
+
+# truncated rdata
+open("truncated.dns", "wb").write(m.b[:60])
+
+
+def checksum(b):
+    if len(b) % 2:
+        b += b"\x00"
+    s = sum(struct.unpack(">%dH" % (len(b) // 2), b))
+    while s >> 16:
+        s = (s & 0xFFFF) + (s >> 16)
+    return ~s & 0xFFFF
+
+
+def ipv4_udp(src, dst, sport, dport, data):
+    udp = struct.pack(">HHHH", sport, dport, 8 + len(data), 0) + data
+    ip = struct.pack(">BBHHHBBH4s4s", 0x45, 0, 20 + len(udp), 0, 0x4000, 255, 17, 0, bytes(src), bytes(dst))
+    ip = ip[:10] + struct.pack(">H", checksum(ip)) + ip[12:]
+    return ip + udp
+
+
+def pcap(packets):
+    # LINKTYPE_RAW
+    out = struct.pack("<IHHiIII", 0xA1B2C3D4, 2, 4, 0, 0, 65535, 101)
+    for i, p in enumerate(packets):
+        out += struct.pack("<IIII", 1700000000, i * 1000, len(p), len(p)) + p
+    return out
+
+
+host = [192, 168, 0, 10]
+mdns_group = [224, 0, 0, 251]
+
+# mdns query with unicast-response bit set
+q = Message()
+q.add(header(0, 0, 1, 0, 0, 0))
+q.question("_http._tcp.local", 12, 0x8001)
+
+# mdns response with cache-flush bit set on unique records
+r = Message()
+r.add(header(0, 0x8400, 0, 1, 0, 3))
+r.rr("_http._tcp.local", 12, r.with_name(b"", "web._http._tcp.local"), ttl=4500)
+r.rr("web._http._tcp.local", 33, r.with_name(struct.pack(">HHH", 0, 0, 80), "web.local"), cls=0x8001, ttl=120)
+r.rr("web._http._tcp.local", 16, lambda _: char_string(b"path=/"), cls=0x8001, ttl=4500)
+r.rr("web.local", 1, lambda _: bytes(host), cls=0x8001, ttl=120)
+
+open("mdns.pcap", "wb").write(
+    pcap(
+        [
+            ipv4_udp(host, mdns_group, 5353, 5353, q.b),
+            ipv4_udp(host, mdns_group, 5353, 5353, r.b),
+        ]
+    )
+)
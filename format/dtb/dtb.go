@@ -0,0 +1,306 @@
+package dtb
+
+// https://devicetree-specification.readthedocs.io/en/stable/flattened-format.html
+
+import (
+	"bytes"
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed dtb.md
+var dtbFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.DTB,
+		&decode.Format{
+			Description: "Devicetree blob (flattened device tree)",
+			Groups:      []*decode.Group{format.Probe},
+			ProbeOrder:  format.ProbeOrderBinFuzzy, // after uboot_fit that is also a devicetree blob
+			DecodeFn:    decodeDTB,
+		})
+	interp.RegisterFS(dtbFS)
+}
+
+const magic = 0xd00dfeed
+
+const (
+	tokenBeginNode = 0x1
+	tokenEndNode   = 0x2
+	tokenProp      = 0x3
+	tokenNop       = 0x4
+	tokenEnd       = 0x9
+)
+
+var tokenNames = scalar.UintMapSymStr{
+	tokenBeginNode: "begin_node",
+	tokenEndNode:   "end_node",
+	tokenProp:      "prop",
+	tokenNop:       "nop",
+	tokenEnd:       "end",
+}
+
+// offset into strings block to null terminated string
+type strTable []byte
+
+func (m strTable) lookup(off uint64) (string, bool) {
+	if off < uint64(len(m)) {
+		bs := m[off:]
+		if i := bytes.IndexByte(bs, 0); i != -1 {
+			return string(bs[:i]), true
+		}
+	}
+	return "", false
+}
+
+func (m strTable) MapUint(s scalar.Uint) (scalar.Uint, error) {
+	if str, ok := m.lookup(s.Actual); ok {
+		s.Sym = str
+	}
+	return s, nil
+}
+
+// property of a node, value is nil for empty properties
+type property struct {
+	bytes []byte
+	value *decode.Value
+}
+
+type node struct {
+	parent     *node
+	name       string
+	properties map[string]property
+	children   []*node
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *node) str(name string) string {
+	if p, ok := n.properties[name]; ok && len(p.bytes) > 0 {
+		return string(bytes.TrimRight(p.bytes, "\x00"))
+	}
+	return ""
+}
+
+// depth of node, root is 0
+func (n *node) depth() int {
+	i := 0
+	for p := n.parent; p != nil; p = p.parent {
+		i++
+	}
+	return i
+}
+
+// hooks used by formats that are devicetree blobs, ex: U-Boot FIT
+type blobDecoder struct {
+	strs strTable
+	// decode property value, return false to use default decoding
+	valueFn func(d *decode.D, n *node, name string, length int64) bool
+	// called after the node and all its children has been decoded
+	nodeEndFn func(d *decode.D, n *node)
+}
+
+// values that are one or more printable null terminated strings, ex: "compatible"
+func isStringList(bs []byte) bool {
+	if len(bs) == 0 || bs[0] == 0 || bs[len(bs)-1] != 0 {
+		return false
+	}
+	for i, b := range bs {
+		switch {
+		case b == 0:
+			if bs[i-1] == 0 {
+				return false
+			}
+		case b < 0x20 || b > 0x7e:
+			return false
+		}
+	}
+	return true
+}
+
+func decodePropValue(d *decode.D, length int64, sms ...scalar.StrMapper) {
+	if length == 0 {
+		// empty properties are booleans, ex: "interrupt-controller"
+		return
+	}
+	bs := d.PeekBytes(int(length))
+	switch {
+	case isStringList(bs):
+		if n := bytes.Count(bs, []byte{0}); n == 1 {
+			d.FieldUTF8Null("value", sms...)
+		} else {
+			d.FieldArray("value", func(d *decode.D) {
+				for i := 0; i < n; i++ {
+					d.FieldUTF8Null("string", sms...)
+				}
+			})
+		}
+	case length == 4:
+		d.FieldU32("value", scalar.UintHex)
+	case length%4 == 0:
+		d.FieldArray("value", func(d *decode.D) {
+			for i := int64(0); i < length/4; i++ {
+				d.FieldU32("cell", scalar.UintHex)
+			}
+		})
+	default:
+		d.FieldRawLen("value", length*8)
+	}
+}
+
+func fieldPadding(d *decode.D) {
+	if n := d.AlignBits(32); n > 0 {
+		d.FieldRawLen("padding", int64(n))
+	}
+}
+
+func decodeNode(d *decode.D, bd *blobDecoder, parent *node) *node {
+	n := &node{parent: parent, properties: map[string]property{}}
+
+	d.FieldU32("token", tokenNames, d.UintAssert(tokenBeginNode))
+	n.name = d.FieldUTF8Null("name")
+	fieldPadding(d)
+
+	// properties comes before child nodes, nops can appear anywhere
+	d.FieldArray("properties", func(d *decode.D) {
+		for {
+			switch d.PeekUintBits(32) {
+			case tokenProp:
+				d.FieldStruct("property", func(d *decode.D) {
+					d.FieldU32("token", tokenNames)
+					length := int64(d.FieldU32("len"))
+					name, _ := bd.strs.lookup(d.FieldU32("name", bd.strs))
+					if length*8 > d.BitsLeft() {
+						d.Fatalf("property length %d outside structure block", length)
+					}
+					valueStart := d.Pos()
+					if bd.valueFn == nil || !bd.valueFn(d, n, name, length) {
+						decodePropValue(d, length)
+					}
+					p := property{bytes: d.BytesRange(valueStart, int(length))}
+					if length > 0 {
+						p.value = d.FieldGet("value")
+					}
+					n.properties[name] = p
+					fieldPadding(d)
+				})
+			case tokenNop:
+				d.FieldU32("token", tokenNames)
+			default:
+				return
+			}
+		}
+	})
+	d.FieldArray("children", func(d *decode.D) {
+		for {
+			switch d.PeekUintBits(32) {
+			case tokenBeginNode:
+				d.FieldStruct("node", func(d *decode.D) {
+					n.children = append(n.children, decodeNode(d, bd, n))
+				})
+			case tokenNop:
+				d.FieldU32("token", tokenNames)
+			default:
+				return
+			}
+		}
+	})
+	d.FieldU32("end_token", tokenNames, d.UintAssert(tokenEndNode))
+
+	if bd.nodeEndFn != nil {
+		bd.nodeEndFn(d, n)
+	}
+
+	return n
+}
+
+func decodeDTB(d *decode.D) any {
+	decodeBlob(d, &blobDecoder{})
+	return nil
+}
+
+// decodes blob and returns root node
+func decodeBlob(d *decode.D, bd *blobDecoder) *node {
+	d.Endian = decode.BigEndian
+
+	var totalSize, offStruct, offStrings, offMemRsvmap, version, sizeStrings, sizeStruct uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU32("magic", d.UintAssert(magic), scalar.UintHex)
+		totalSize = d.FieldU32("totalsize")
+		offStruct = d.FieldU32("off_dt_struct")
+		offStrings = d.FieldU32("off_dt_strings")
+		offMemRsvmap = d.FieldU32("off_mem_rsvmap")
+		version = d.FieldU32("version")
+		d.FieldU32("last_comp_version")
+		if version >= 2 {
+			d.FieldU32("boot_cpuid_phys")
+		}
+		if version >= 3 {
+			sizeStrings = d.FieldU32("size_dt_strings")
+		}
+		if version >= 17 {
+			sizeStruct = d.FieldU32("size_dt_struct")
+		}
+	})
+	if totalSize*8 > uint64(d.Len()) {
+		d.Fatalf("totalsize %d larger than input", totalSize)
+	}
+	// sizes are only in newer versions, assume blocks extends to end of blob
+	if sizeStrings == 0 {
+		sizeStrings = totalSize - offStrings
+	}
+	if sizeStruct == 0 {
+		sizeStruct = totalSize - offStruct
+	}
+
+	d.RangeFn(int64(offStrings)*8, int64(sizeStrings)*8, func(d *decode.D) {
+		bd.strs = d.BytesLen(int(sizeStrings))
+	})
+
+	d.SeekAbs(int64(offMemRsvmap) * 8)
+	d.FieldArray("memory_reservations", func(d *decode.D) {
+		for {
+			var address, size uint64
+			d.FieldStruct("entry", func(d *decode.D) {
+				address = d.FieldU64("address", scalar.UintHex)
+				size = d.FieldU64("size", scalar.UintHex)
+			})
+			// list ends with a zero entry
+			if address == 0 && size == 0 {
+				break
+			}
+		}
+	})
+
+	var root *node
+	d.SeekAbs(int64(offStruct) * 8)
+	d.FramedFn(int64(sizeStruct)*8, func(d *decode.D) {
+		d.FieldStruct("structure", func(d *decode.D) {
+			d.FieldStruct("root", func(d *decode.D) { root = decodeNode(d, bd, nil) })
+			d.FieldU32("end_token", tokenNames, d.UintAssert(tokenEnd))
+		})
+	})
+
+	d.SeekAbs(int64(offStrings) * 8)
+	d.FramedFn(int64(sizeStrings)*8, func(d *decode.D) {
+		d.FieldArray("strings", func(d *decode.D) {
+			for !d.End() {
+				d.FieldUTF8Null("string")
+			}
+		})
+	})
+
+	return root
+}
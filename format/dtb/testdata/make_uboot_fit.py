@@ -0,0 +1,168 @@
+#!/usr/bin/env python3
+# generates U-Boot FIT images similar to mkimage -f and mkimage -E -f
+import gzip
+import hashlib
+import pathlib
+import struct
+import zlib
+
+here = pathlib.Path(__file__).parent
+
+FDT_MAGIC = 0xD00DFEED
+FDT_BEGIN_NODE = 1
+FDT_END_NODE = 2
+FDT_PROP = 3
+FDT_END = 9
+
+
+def pad4(b):
+    return b + b"\0" * (-len(b) % 4)
+
+
+def u32(v):
+    return struct.pack(">I", v)
+
+
+def s(v):
+    return v.encode() + b"\0"
+
+
+def fdt(root):
+    strings = b""
+    offsets = {}
+
+    def str_offset(name):
+        nonlocal strings
+        if name not in offsets:
+            offsets[name] = len(strings)
+            strings += s(name)
+        return offsets[name]
+
+    def node(name, n):
+        b = u32(FDT_BEGIN_NODE) + pad4(s(name))
+        for k, v in n.items():
+            if isinstance(v, dict):
+                continue
+            b += u32(FDT_PROP) + u32(len(v)) + u32(str_offset(k)) + pad4(v)
+        for k, v in n.items():
+            if isinstance(v, dict):
+                b += node(k, v)
+        return b + u32(FDT_END_NODE)
+
+    struct_block = node("", root) + u32(FDT_END)
+    header_size = 40
+    rsvmap = b"\0" * 16
+    off_rsvmap = header_size
+    off_struct = off_rsvmap + len(rsvmap)
+    off_strings = off_struct + len(struct_block)
+    total = off_strings + len(strings)
+    header = struct.pack(
+        ">10I",
+        FDT_MAGIC,
+        total,
+        off_struct,
+        off_strings,
+        off_rsvmap,
+        17,
+        16,
+        0,
+        len(strings),
+        len(struct_block),
+    )
+    return header + rsvmap + struct_block + strings
+
+
+def hashes(data, algos):
+    r = {}
+    for i, algo in enumerate(algos):
+        if algo == "crc32":
+            value = u32(zlib.crc32(data))
+        else:
+            value = hashlib.new(algo, data).digest()
+        r[f"hash-{i + 1}"] = {"value": value, "algo": s(algo)}
+    return r
+
+
+kernel = gzip.compress(b"test kernel " * 32, mtime=0)
+ramdisk = bytes(range(128, 256))
+dtb = (here / "test.dtb").read_bytes()
+
+
+def images(external):
+    images = {
+        "kernel-1": {
+            "description": s("Test kernel"),
+            "data": kernel,
+            "type": s("kernel"),
+            "arch": s("arm64"),
+            "os": s("linux"),
+            "compression": s("gzip"),
+            "load": u32(0x80080000),
+            "entry": u32(0x80080000),
+            **hashes(kernel, ["sha256", "crc32"]),
+        },
+        "ramdisk-1": {
+            "description": s("Test ramdisk"),
+            "data": ramdisk,
+            "type": s("ramdisk"),
+            "arch": s("arm64"),
+            "os": s("linux"),
+            "compression": s("none"),
+            # invalid hash
+            **hashes(b"other", ["md5"]),
+        },
+        "fdt-1": {
+            "description": s("Test devicetree"),
+            "data": dtb,
+            "type": s("flat_dt"),
+            "arch": s("arm64"),
+            "compression": s("none"),
+            **hashes(dtb, ["sha1"]),
+        },
+    }
+    if not external:
+        return images, b""
+
+    data = b""
+    for image in images.values():
+        d = image.pop("data")
+        image_props = {"data-size": u32(len(d)), "data-offset": u32(len(data))}
+        # properties are before child nodes
+        hash_nodes = {k: v for k, v in image.items() if isinstance(v, dict)}
+        for k in hash_nodes:
+            del image[k]
+        image.update(image_props)
+        image.update(hash_nodes)
+        data += pad4(d)
+    return images, data
+
+
+def fit(external):
+    imgs, data = images(external)
+    blob = fdt(
+        {
+            "description": s("Test FIT"),
+            "timestamp": u32(1700000000),
+            "#address-cells": u32(1),
+            "images": imgs,
+            "configurations": {
+                "default": s("conf-1"),
+                "conf-1": {
+                    "description": s("Test configuration"),
+                    "kernel": s("kernel-1"),
+                    "ramdisk": s("ramdisk-1"),
+                    "fdt": s("fdt-1"),
+                },
+                "conf-2": {
+                    "description": s("Missing image"),
+                    "kernel": s("kernel-1"),
+                    "fdt": s("fdt-2"),
+                },
+            },
+        }
+    )
+    return pad4(blob) + data if external else blob
+
+
+(here / "test.itb").write_bytes(fit(False))
+(here / "external.itb").write_bytes(fit(True))
@@ -0,0 +1,220 @@
+package dtb
+
+// https://fitspec.osfw.foundation/
+// https://github.com/u-boot/u-boot/blob/master/doc/usage/fit/source_file_format.rst
+
+import (
+	"crypto/md5"
+	//nolint: gosec
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"embed"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed uboot_fit.md
+var ubootFITFS embed.FS
+
+var probeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.UBoot_FIT,
+		&decode.Format{
+			Description: "U-Boot Flattened Image Tree",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeUBootFIT,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(ubootFITFS)
+}
+
+const (
+	fitImagesNode         = "images"
+	fitConfigurationsNode = "configurations"
+)
+
+// configuration properties that reference image nodes
+var fitImageRefProperties = map[string]bool{
+	"kernel":     true,
+	"fdt":        true,
+	"ramdisk":    true,
+	"firmware":   true,
+	"loadables":  true,
+	"setup":      true,
+	"standalone": true,
+	"fpga":       true,
+}
+
+func fitHash(algo string) hash.Hash {
+	switch algo {
+	case "crc32":
+		return crc32.NewIEEE()
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "sha384":
+		return sha512.New384()
+	case "sha512":
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+func isImageNode(n *node) bool {
+	return n.depth() == 2 && n.parent.name == fitImagesNode
+}
+
+func isConfigurationNode(n *node) bool {
+	return n.depth() == 2 && n.parent.name == fitConfigurationsNode
+}
+
+func isImageHashNode(n *node) bool {
+	return n.depth() == 3 && isImageNode(n.parent) && strings.HasPrefix(n.name, "hash")
+}
+
+type externalData struct {
+	image string
+	pos   int64 // in bytes
+	size  int64 // in bytes
+}
+
+type fitDecoder struct {
+	totalSize    int64
+	externalData []externalData
+	hashNodes    []*node
+}
+
+// external image data is stored after the blob, ex: mkimage -E
+func (fd *fitDecoder) imageExternalData(image *node) (externalData, bool) {
+	size, ok := image.properties["data-size"]
+	if !ok || len(size.bytes) != 4 {
+		return externalData{}, false
+	}
+	e := externalData{image: image.name, size: int64(binary.BigEndian.Uint32(size.bytes))}
+	if p, ok := image.properties["data-position"]; ok && len(p.bytes) == 4 {
+		e.pos = int64(binary.BigEndian.Uint32(p.bytes))
+	} else if p, ok := image.properties["data-offset"]; ok && len(p.bytes) == 4 {
+		// offset is relative to the 4 byte aligned end of the blob
+		e.pos = (fd.totalSize+3)&^3 + int64(binary.BigEndian.Uint32(p.bytes))
+	} else {
+		return externalData{}, false
+	}
+	return e, true
+}
+
+func (fd *fitDecoder) imageData(d *decode.D, image *node) ([]byte, bool) {
+	if p, ok := image.properties["data"]; ok {
+		return p.bytes, true
+	}
+	if e, ok := fd.imageExternalData(image); ok && (e.pos+e.size)*8 <= d.Len() {
+		return d.BytesRange(e.pos*8, int(e.size)), true
+	}
+	return nil, false
+}
+
+func (fd *fitDecoder) valueFn(d *decode.D, n *node, name string, length int64) bool {
+	switch {
+	case n.depth() == 0 && name == "timestamp" && length == 4:
+		d.FieldU32("value", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+	case isImageNode(n) && name == "data":
+		d.FieldFormatOrRawLen("value", length*8, &probeGroup, format.Probe_In{})
+	case isImageHashNode(n) && name == "value":
+		d.FieldRawLen("value", length*8, scalar.RawHex)
+	case isConfigurationNode(n) && fitImageRefProperties[name]:
+		// images are decoded before configurations so references can be resolved
+		var images *node
+		if r := n.parent.parent; r != nil {
+			images = r.child(fitImagesNode)
+		}
+		decodePropValue(d, length, scalar.StrFn(func(s scalar.Str) (scalar.Str, error) {
+			if images == nil {
+				return s, nil
+			}
+			if image := images.child(s.Actual); image != nil {
+				s.Description = image.str("type")
+			} else {
+				s.Description = "missing"
+			}
+			return s, nil
+		}))
+	default:
+		return false
+	}
+	return true
+}
+
+func (fd *fitDecoder) nodeEndFn(d *decode.D, n *node) {
+	switch {
+	case isImageNode(n):
+		if e, ok := fd.imageExternalData(n); ok {
+			fd.externalData = append(fd.externalData, e)
+		}
+	case isImageHashNode(n):
+		// validated after blob is decoded as external data is outside of the structure block
+		fd.hashNodes = append(fd.hashNodes, n)
+	}
+}
+
+func (fd *fitDecoder) validateHash(d *decode.D, n *node) {
+	value := n.properties["value"].value
+	h := fitHash(n.str("algo"))
+	if value == nil || h == nil {
+		return
+	}
+	data, ok := fd.imageData(d, n.parent)
+	if !ok {
+		return
+	}
+	h.Write(data)
+	_ = value.TryBitBufScalarFn(d.ValidateBitBuf(h.Sum(nil)))
+}
+
+func decodeUBootFIT(d *decode.D) any {
+	fd := &fitDecoder{}
+	// total size is needed to find external data
+	d.SeekAbs(4*8, func(d *decode.D) { fd.totalSize = int64(d.U32BE()) })
+
+	root := decodeBlob(d, &blobDecoder{valueFn: fd.valueFn, nodeEndFn: fd.nodeEndFn})
+	if root == nil || root.child(fitImagesNode) == nil {
+		d.Fatalf("no images node")
+	}
+	for _, n := range fd.hashNodes {
+		fd.validateHash(d, n)
+	}
+
+	if len(fd.externalData) > 0 {
+		sort.Slice(fd.externalData, func(i, j int) bool { return fd.externalData[i].pos < fd.externalData[j].pos })
+		d.FieldArray("external_data", func(d *decode.D) {
+			for _, e := range fd.externalData {
+				if (e.pos+e.size)*8 > d.Len() {
+					continue
+				}
+				d.SeekAbs(e.pos * 8)
+				d.FieldStruct("image", func(d *decode.D) {
+					d.FieldValueStr("name", e.image)
+					d.FieldFormatOrRawLen("data", e.size*8, &probeGroup, format.Probe_In{})
+				})
+			}
+		})
+	}
+
+	return nil
+}
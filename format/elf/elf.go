@@ -83,6 +83,8 @@ var typeNames = scalar.UintRangeToScalar{
 }
 
 const (
+	EM_386    = 0x03
+	EM_ARM    = 0x28
 	EM_X86_64 = 0x3e
 	EM_ARM64  = 0xb7
 )
@@ -91,7 +93,7 @@ var machineNames = scalar.UintMap{
 	0x00:      {Description: "No specific instruction set"},
 	0x01:      {Sym: "we_32100", Description: "AT&T WE 32100"},
 	0x02:      {Sym: "sparc", Description: "SPARC"},
-	0x03:      {Sym: "x86", Description: "x86"},
+	EM_386:    {Sym: "x86", Description: "x86"},
 	0x04:      {Sym: "m68k", Description: "Motorola 68000 (M68k)"},
 	0x05:      {Sym: "m88k", Description: "Motorola 88000 (M88k)"},
 	0x06:      {Sym: "intel_mcu", Description: "Intel MCU"},
@@ -110,7 +112,7 @@ var machineNames = scalar.UintMap{
 	0x25:      {Sym: "fr20", Description: "Fujitsu FR20"},
 	0x26:      {Sym: "trw_rh_32", Description: "TRW RH-32"},
 	0x27:      {Sym: "motorola_rce", Description: "Motorola RCE"},
-	0x28:      {Sym: "arm", Description: "ARM (up to ARMv7/Aarch32)"},
+	EM_ARM:    {Sym: "arm", Description: "ARM (up to ARMv7/Aarch32)"},
 	0x29:      {Sym: "alpha", Description: "Digital Alpha"},
 	0x2a:      {Sym: "superh", Description: "SuperH"},
 	0x2b:      {Sym: "sparc_v9", Description: "SPARC Version 9"},
@@ -346,6 +348,13 @@ var sectionHeaderTypeMap = scalar.UintMap{
 	SHT_GNU_HASH:      {Sym: "gnu_hash", Description: "GNU symbol hash table"},
 }
 
+const SHF_TLS = 0x400
+
+const (
+	SHN_UNDEF  = 0
+	SHN_XINDEX = 0xffff
+)
+
 const (
 	STRTAB_DYNSTR   = ".dynstr"
 	STRTAB_SHSTRTAB = ".shstrtab"
@@ -662,6 +671,7 @@ func elfReadSymbolTable(d *decode.D, ec *elfContext, sh sectionHeader) []symbol
 
 type sectionHeader struct {
 	addr    int64
+	flags   uint64
 	offset  int64
 	size    int64
 	entSize int64
@@ -689,8 +699,8 @@ func elfReadSectionHeaders(d *decode.D, ec *elfContext) {
 		case 32:
 			sh.name = int(d.U32())
 			sh.typ = int(d.U32())
-			d.U32()                      // flags
-			sh.addr = int64(d.U32() * 8) // addr
+			sh.flags = d.U32()
+			sh.addr = int64(d.U32() * 8)
 			sh.offset = int64(d.U32()) * 8
 			sh.size = int64(d.U32()) * 8
 			d.U32() // link
@@ -700,8 +710,8 @@ func elfReadSectionHeaders(d *decode.D, ec *elfContext) {
 		case 64:
 			sh.name = int(d.U32())
 			sh.typ = int(d.U32())
-			d.U64()                      // addr
-			sh.addr = int64(d.U64() * 8) // flags
+			sh.flags = d.U64()
+			sh.addr = int64(d.U64() * 8)
 			sh.offset = int64(d.U64()) * 8
 			sh.size = int64(d.U64()) * 8
 			d.U32() // link
@@ -757,6 +767,60 @@ func elfReadSectionHeaders(d *decode.D, ec *elfContext) {
 	}
 }
 
+type programHeader struct {
+	typ    uint64
+	offset int64
+	fileSz int64
+	vaddr  uint64
+	memSz  uint64
+}
+
+// containsSection checks if section is in segment by file range, or for sections
+// occupying no space in file by address range
+func (ph programHeader) containsSection(sh sectionHeader) bool {
+	if sh.size == 0 {
+		return false
+	}
+	if sh.typ == SHT_NOBITS {
+		// .tbss only occupies memory in the TLS segment
+		if sh.flags&SHF_TLS != 0 && ph.typ != PT_TLS {
+			return false
+		}
+		addr := uint64(sh.addr / 8)
+		return ph.memSz > 0 && addr >= ph.vaddr && addr+uint64(sh.size/8) <= ph.vaddr+ph.memSz
+	}
+	return ph.fileSz > 0 && sh.offset >= ph.offset && sh.offset+sh.size <= ph.offset+ph.fileSz
+}
+
+func elfReadProgramHeaders(d *decode.D, ec *elfContext) {
+	for i := 0; i < ec.phNum; i++ {
+		d.SeekAbs(ec.phOff + int64(i)*ec.phSize)
+		var ph programHeader
+
+		switch ec.archBits {
+		case 32:
+			ph.typ = d.U32()
+			ph.offset = int64(d.U32()) * 8
+			ph.vaddr = d.U32()
+			d.U32() // paddr
+			ph.fileSz = int64(d.U32()) * 8
+			ph.memSz = d.U32()
+		case 64:
+			ph.typ = d.U32()
+			d.U32() // flags
+			ph.offset = int64(d.U64()) * 8
+			ph.vaddr = d.U64()
+			d.U64() // paddr
+			ph.fileSz = int64(d.U64()) * 8
+			ph.memSz = d.U64()
+		default:
+			panic("unreachable")
+		}
+
+		ec.programHeaders = append(ec.programHeaders, ph)
+	}
+}
+
 type elfContext struct {
 	archBits int
 	typ      int
@@ -773,8 +837,10 @@ type elfContext struct {
 
 	shStrNdx int
 
-	sections  []sectionHeader
-	strTabMap map[string]string
+	programHeaders []programHeader
+	fileMappings   []fileMapping // from core NT_FILE note
+	sections       []sectionHeader
+	strTabMap      map[string]string
 }
 
 func (ec *elfContext) sectionIndexByAddr(addr int64) (int, bool) {
@@ -833,6 +899,11 @@ func elfDecodeHeader(d *decode.D, ec *elfContext) {
 	shNum := d.FieldU16("shnum")
 	shStrNdx := d.FieldU16("shstrndx")
 
+	d.Constraint(
+		shStrNdx == SHN_UNDEF || shStrNdx == SHN_XINDEX || shStrNdx < shNum,
+		"shstrndx %d < shnum %d", shStrNdx, shNum,
+	)
+
 	ec.archBits = archBits
 	ec.endian = d.Endian
 	ec.typ = int(typ)
@@ -846,7 +917,7 @@ func elfDecodeHeader(d *decode.D, ec *elfContext) {
 	ec.shStrNdx = int(shStrNdx)
 }
 
-func elfDecodeProgramHeader(d *decode.D, ec elfContext) {
+func elfDecodeProgramHeader(d *decode.D, ec elfContext, index int) {
 	pFlags := func(d *decode.D) {
 		d.FieldStruct("flags", func(d *decode.D) {
 			if d.Endian == decode.LittleEndian {
@@ -867,12 +938,13 @@ func elfDecodeProgramHeader(d *decode.D, ec elfContext) {
 	var typ uint64
 	var offset uint64
 	var size uint64
+	var vaddr uint64
 
 	switch ec.archBits {
 	case 32:
 		typ = d.FieldU32("type", phTypeNames)
 		offset = d.FieldU("offset", ec.archBits, scalar.UintHex)
-		d.FieldU("vaddr", ec.archBits, scalar.UintHex)
+		vaddr = d.FieldU("vaddr", ec.archBits, scalar.UintHex)
 		d.FieldU("paddr", ec.archBits, scalar.UintHex)
 		size = d.FieldU32("filesz")
 		d.FieldU32("memsz")
@@ -882,40 +954,41 @@ func elfDecodeProgramHeader(d *decode.D, ec elfContext) {
 		typ = d.FieldU32("type", phTypeNames)
 		pFlags(d)
 		offset = d.FieldU("offset", ec.archBits, scalar.UintHex)
-		d.FieldU("vaddr", ec.archBits, scalar.UintHex)
+		vaddr = d.FieldU("vaddr", ec.archBits, scalar.UintHex)
 		d.FieldU("paddr", ec.archBits, scalar.UintHex)
 		size = d.FieldU64("filesz")
 		d.FieldU64("memsz")
 		d.FieldU64("align")
 	}
 
+	if ec.typ == ET_CORE && typ == PT_LOAD {
+		if fm, ok := ec.fileMappingByAddr(vaddr); ok {
+			d.FieldValueStr("file", fm.name)
+			d.FieldValueUint("file_offset", fm.fileOfs+vaddr-fm.start, scalar.UintHex)
+		}
+	}
+	if index < len(ec.programHeaders) {
+		ph := ec.programHeaders[index]
+		var sectionIndexes []int
+		for i, sh := range ec.sections {
+			if ph.containsSection(sh) {
+				sectionIndexes = append(sectionIndexes, i)
+			}
+		}
+		if len(sectionIndexes) > 0 {
+			d.FieldArray("section_indexes", func(d *decode.D) {
+				for _, i := range sectionIndexes {
+					d.FieldValueUint("section_index", uint64(i))
+				}
+			})
+		}
+	}
+
 	d.RangeFn(int64(offset*8), int64(size*8), func(d *decode.D) {
 		switch {
 		case typ == PT_NOTE:
 			d.FieldArray("notes", func(d *decode.D) {
-				for !d.End() {
-					d.FieldStruct("note", func(d *decode.D) {
-						// elf manpage says this is 32 or 64 bit but it seems it is always 32
-						// and that is also what readelf external.h says
-						nameSz := d.FieldU32("n_namesz")
-						descSz := d.FieldU32("n_descsz")
-						if ec.typ == ET_CORE {
-							d.FieldU32("n_type", coreNoteNames, scalar.UintHex)
-						} else {
-							d.FieldU32("n_type", scalar.UintHex)
-						}
-						d.FieldUTF8NullFixedLen("name", int(nameSz))
-						nameAlign := d.AlignBits(4 * 8)
-						if nameAlign != 0 {
-							d.FieldRawLen("name_align", int64(nameAlign))
-						}
-						d.FieldRawLen("desc", int64(descSz)*8)
-						descAlign := d.AlignBits(4 * 8)
-						if descAlign != 0 {
-							d.FieldRawLen("decs_align", int64(descAlign))
-						}
-					})
-				}
+				elfDecodeNotes(d, ec)
 			})
 		default:
 			d.FieldRawLen("data", d.BitsLeft())
@@ -927,7 +1000,7 @@ func elfDecodeProgramHeaders(d *decode.D, ec elfContext) {
 	for i := 0; i < ec.phNum; i++ {
 		d.FieldStruct("program_header", func(d *decode.D) {
 			d.SeekAbs(ec.phOff + int64(i)*ec.phSize)
-			elfDecodeProgramHeader(d, ec)
+			elfDecodeProgramHeader(d, ec, i)
 		})
 	}
 }
@@ -980,6 +1053,13 @@ func elfDecodeDynamicTags(d *decode.D, ec elfContext, dc dynamicContext) {
 }
 
 func elfDecodeSectionHeader(d *decode.D, ec elfContext, sh sectionHeader) {
+	var programHeaderIndexes []int
+	for i, ph := range ec.programHeaders {
+		if ph.containsSection(sh) {
+			programHeaderIndexes = append(programHeaderIndexes, i)
+		}
+	}
+
 	shFlags := func(d *decode.D, archBits int) {
 		d.FieldStruct("flags", func(d *decode.D) {
 			if d.Endian == decode.LittleEndian {
@@ -1055,6 +1135,14 @@ func elfDecodeSectionHeader(d *decode.D, ec elfContext, sh sectionHeader) {
 		entSize = int64(d.FieldU64("entsize") * 8)
 	}
 
+	if len(programHeaderIndexes) > 0 {
+		d.FieldArray("program_header_indexes", func(d *decode.D) {
+			for _, i := range programHeaderIndexes {
+				d.FieldValueUint("program_header_index", uint64(i))
+			}
+		})
+	}
+
 	if typ == SHT_NOBITS {
 		// section occupies no space in file
 		return
@@ -1078,6 +1166,12 @@ func elfDecodeSectionHeader(d *decode.D, ec elfContext, sh sectionHeader) {
 		d.FieldArray("symbol_table", func(d *decode.D) {
 			elfDecodeSymbolTable(d, ec, int(size/entSize), ec.strTabMap[STRTAB_DYNSTR])
 		})
+	case SHT_NOTE:
+		d.FramedFn(size, func(d *decode.D) {
+			d.FieldArray("notes", func(d *decode.D) {
+				elfDecodeNotes(d, ec)
+			})
+		})
 	case SHT_PROGBITS:
 		// TODO: name progbits?
 		// TODO: decode opcodes
@@ -1105,7 +1199,11 @@ func elfDecode(d *decode.D) any {
 
 	d.FieldStruct("header", func(d *decode.D) { elfDecodeHeader(d, &ec) })
 	d.Endian = ec.endian
-	// a first pass to find all sections and string table information etc
+	// a first pass to find all segments, sections and string table information etc
+	elfReadProgramHeaders(d, &ec)
+	if ec.typ == ET_CORE {
+		elfReadFileMappings(d, &ec)
+	}
 	elfReadSectionHeaders(d, &ec)
 	d.FieldArray("program_headers", func(d *decode.D) {
 		elfDecodeProgramHeaders(d, ec)
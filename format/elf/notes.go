@@ -0,0 +1,439 @@
+package elf
+
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/elfcore.h
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/auxvec.h
+// https://sourceware.org/git/?p=glibc.git;a=blob;f=elf/elf.h;hb=HEAD
+
+import (
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	NT_GNU_ABI_TAG         = 1
+	NT_GNU_HWCAP           = 2
+	NT_GNU_BUILD_ID        = 3
+	NT_GNU_GOLD_VERSION    = 4
+	NT_GNU_PROPERTY_TYPE_0 = 5
+)
+
+var gnuNoteNames = scalar.UintMap{
+	NT_GNU_ABI_TAG:         {Sym: "abi_tag", Description: "ABI information"},
+	NT_GNU_HWCAP:           {Sym: "hwcap", Description: "Hardware capabilities"},
+	NT_GNU_BUILD_ID:        {Sym: "build_id", Description: "Build ID"},
+	NT_GNU_GOLD_VERSION:    {Sym: "gold_version", Description: "Gold linker version"},
+	NT_GNU_PROPERTY_TYPE_0: {Sym: "property_type_0", Description: "Program properties"},
+}
+
+const NT_GO_BUILD_ID = 4
+
+var goNoteNames = scalar.UintMap{
+	NT_GO_BUILD_ID: {Sym: "build_id", Description: "Go build ID"},
+}
+
+var abiTagOSNames = scalar.UintMapSymStr{
+	0: "linux",
+	1: "hurd",
+	2: "solaris",
+	3: "freebsd",
+}
+
+var gnuPropertyTypeNames = scalar.UintMapSymStr{
+	1:          "stack_size",
+	2:          "no_copy_on_protected",
+	0xc0000000: "aarch64_feature_1_and",
+	0xc0000002: "x86_feature_1_and",
+	0xc0008001: "x86_feature_2_needed",
+	0xc0008002: "x86_isa_1_needed",
+	0xc0010001: "x86_feature_2_used",
+	0xc0010002: "x86_isa_1_used",
+}
+
+// linux numbering, some architectures like mips and alpha differ
+var signalNames = scalar.UintMapSymStr{
+	1:  "sighup",
+	2:  "sigint",
+	3:  "sigquit",
+	4:  "sigill",
+	5:  "sigtrap",
+	6:  "sigabrt",
+	7:  "sigbus",
+	8:  "sigfpe",
+	9:  "sigkill",
+	10: "sigusr1",
+	11: "sigsegv",
+	12: "sigusr2",
+	13: "sigpipe",
+	14: "sigalrm",
+	15: "sigterm",
+	16: "sigstkflt",
+	17: "sigchld",
+	18: "sigcont",
+	19: "sigstop",
+	20: "sigtstp",
+	21: "sigttin",
+	22: "sigttou",
+	23: "sigurg",
+	24: "sigxcpu",
+	25: "sigxfsz",
+	26: "sigvtalrm",
+	27: "sigprof",
+	28: "sigwinch",
+	29: "sigio",
+	30: "sigpwr",
+	31: "sigsys",
+}
+
+// signals with a faulting address in siginfo
+var signalHasAddr = map[uint64]bool{
+	4:  true, // sigill
+	7:  true, // sigbus
+	8:  true, // sigfpe
+	11: true, // sigsegv
+}
+
+const AT_NULL = 0
+
+var auxvTypeNames = scalar.UintMapSymStr{
+	AT_NULL: "null",
+	1:       "ignore",
+	2:       "execfd",
+	3:       "phdr",
+	4:       "phent",
+	5:       "phnum",
+	6:       "pagesz",
+	7:       "base",
+	8:       "flags",
+	9:       "entry",
+	10:      "notelf",
+	11:      "uid",
+	12:      "euid",
+	13:      "gid",
+	14:      "egid",
+	15:      "platform",
+	16:      "hwcap",
+	17:      "clktck",
+	23:      "secure",
+	24:      "base_platform",
+	25:      "random",
+	26:      "hwcap2",
+	27:      "rseq_feature_size",
+	28:      "rseq_align",
+	29:      "hwcap3",
+	30:      "hwcap4",
+	31:      "execfn",
+	32:      "sysinfo",
+	33:      "sysinfo_ehdr",
+	51:      "minsigstksz",
+}
+
+// elf_gregset_t register order per machine
+var prRegNames = map[int][]string{
+	EM_386: {
+		"ebx", "ecx", "edx", "esi", "edi", "ebp", "eax", "xds", "xes", "xfs", "xgs",
+		"orig_eax", "eip", "xcs", "eflags", "esp", "xss",
+	},
+	EM_X86_64: {
+		"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8", "rax", "rcx",
+		"rdx", "rsi", "rdi", "orig_rax", "rip", "cs", "eflags", "rsp", "ss", "fs_base",
+		"gs_base", "ds", "es", "fs", "gs",
+	},
+	EM_ARM: {
+		"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10", "fp", "ip",
+		"sp", "lr", "pc", "cpsr", "orig_r0",
+	},
+	EM_ARM64: {
+		"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10", "x11", "x12",
+		"x13", "x14", "x15", "x16", "x17", "x18", "x19", "x20", "x21", "x22", "x23", "x24",
+		"x25", "x26", "x27", "x28", "x29", "x30", "sp", "pc", "pstate",
+	},
+}
+
+type fileMapping struct {
+	start   uint64
+	end     uint64
+	fileOfs uint64 // in bytes
+	name    string
+}
+
+// elfReadNTFile reads NT_FILE mappings with d positioned at start of desc
+func elfReadNTFile(d *decode.D, ec elfContext, descBits int64) []fileMapping {
+	start := d.Pos()
+	wordBits := int64(ec.archBits)
+	if descBits < 2*wordBits {
+		return nil
+	}
+	count := d.U(ec.archBits)
+	pageSize := d.U(ec.archBits)
+	if count > uint64((descBits-2*wordBits)/(3*wordBits)) {
+		return nil
+	}
+	fms := make([]fileMapping, count)
+	for i := range fms {
+		fms[i].start = d.U(ec.archBits)
+		fms[i].end = d.U(ec.archBits)
+		fms[i].fileOfs = d.U(ec.archBits) * pageSize
+	}
+	names := strings.Split(string(d.BytesLen(int((start+descBits-d.Pos())/8))), "\x00")
+	for i := range fms {
+		if i < len(names) {
+			fms[i].name = names[i]
+		}
+	}
+	return fms
+}
+
+// elfReadFileMappings finds NT_FILE mappings in core file notes
+func elfReadFileMappings(d *decode.D, ec *elfContext) {
+	for _, ph := range ec.programHeaders {
+		if ph.typ != PT_NOTE || ph.offset+ph.fileSz > d.Len() {
+			continue
+		}
+		end := ph.offset + ph.fileSz
+		d.SeekAbs(ph.offset)
+		for d.Pos()+12*8 <= end {
+			nameSz := d.U32()
+			descSz := d.U32()
+			typ := d.U32()
+			if d.Pos()+int64(nameSz)*8 > end {
+				break
+			}
+			name := d.UTF8NullFixedLen(int(nameSz))
+			d.SeekRel(int64(d.AlignBits(4 * 8)))
+			descStart := d.Pos()
+			descBits := int64(descSz) * 8
+			if descStart+descBits > end {
+				break
+			}
+			if name == "CORE" && typ == NT_FILE {
+				ec.fileMappings = elfReadNTFile(d, *ec, descBits)
+			}
+			d.SeekAbs(descStart + descBits)
+			d.SeekRel(int64(d.AlignBits(4 * 8)))
+		}
+	}
+}
+
+func (ec elfContext) fileMappingByAddr(addr uint64) (fileMapping, bool) {
+	for _, fm := range ec.fileMappings {
+		if addr >= fm.start && addr < fm.end {
+			return fm, true
+		}
+	}
+	return fileMapping{}, false
+}
+
+func elfDecodeTimeval(d *decode.D, ec elfContext, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU("tv_sec", ec.archBits)
+		d.FieldU("tv_usec", ec.archBits)
+	})
+}
+
+// elf_prstatus
+func elfDecodePrStatus(d *decode.D, ec elfContext) {
+	d.FieldStruct("pr_info", func(d *decode.D) {
+		d.FieldU32("si_signo", signalNames)
+		d.FieldS32("si_code")
+		d.FieldS32("si_errno")
+	})
+	d.FieldU16("pr_cursig", signalNames)
+	d.FieldRawLen("pad0", 2*8)
+	d.FieldU("pr_sigpend", ec.archBits, scalar.UintHex)
+	d.FieldU("pr_sighold", ec.archBits, scalar.UintHex)
+	d.FieldU32("pr_pid")
+	d.FieldU32("pr_ppid")
+	d.FieldU32("pr_pgrp")
+	d.FieldU32("pr_sid")
+	elfDecodeTimeval(d, ec, "pr_utime")
+	elfDecodeTimeval(d, ec, "pr_stime")
+	elfDecodeTimeval(d, ec, "pr_cutime")
+	elfDecodeTimeval(d, ec, "pr_cstime")
+
+	// pr_fpvalid int and on 64 bit padding to long alignment
+	trailingBits := int64(32)
+	if ec.archBits == 64 {
+		trailingBits = 64
+	}
+	regBits := d.BitsLeft() - trailingBits
+	if regNames, ok := prRegNames[ec.machine]; ok && regBits == int64(len(regNames)*ec.archBits) {
+		d.FieldStruct("pr_reg", func(d *decode.D) {
+			for _, n := range regNames {
+				d.FieldU(n, ec.archBits, scalar.UintHex)
+			}
+		})
+	} else if regBits > 0 {
+		d.FieldRawLen("pr_reg", regBits)
+	}
+	d.FieldU32("pr_fpvalid")
+	if ec.archBits == 64 {
+		d.FieldRawLen("pad1", 4*8)
+	}
+}
+
+// elf_prpsinfo
+func elfDecodePrPsInfo(d *decode.D, ec elfContext) {
+	d.FieldU8("pr_state")
+	d.FieldUTF8("pr_sname", 1)
+	d.FieldU8("pr_zomb")
+	d.FieldS8("pr_nice")
+	if ec.archBits == 64 {
+		d.FieldRawLen("pad0", 4*8)
+	}
+	d.FieldU("pr_flag", ec.archBits, scalar.UintHex)
+	// uid and gid are 16 bit on some 32 bit architectures
+	uidBits := int((d.BitsLeft() - (4*4+16+80)*8) / 2)
+	d.FieldU("pr_uid", uidBits)
+	d.FieldU("pr_gid", uidBits)
+	d.FieldU32("pr_pid")
+	d.FieldU32("pr_ppid")
+	d.FieldU32("pr_pgrp")
+	d.FieldU32("pr_sid")
+	d.FieldUTF8NullFixedLen("pr_fname", 16)
+	d.FieldUTF8NullFixedLen("pr_psargs", 80)
+}
+
+// siginfo_t
+func elfDecodeSigInfo(d *decode.D, ec elfContext) {
+	signo := d.FieldU32("si_signo", signalNames)
+	d.FieldS32("si_errno")
+	d.FieldS32("si_code")
+	if ec.archBits == 64 {
+		d.FieldRawLen("pad0", 4*8)
+	}
+	if signalHasAddr[signo] {
+		d.FieldU("si_addr", ec.archBits, scalar.UintHex)
+	}
+	d.FieldRawLen("data", d.BitsLeft())
+}
+
+func elfDecodeAuxv(d *decode.D, ec elfContext) {
+	seenNull := false
+	for !d.End() && !seenNull {
+		d.FieldStruct("entry", func(d *decode.D) {
+			typ := d.FieldU("a_type", ec.archBits, auxvTypeNames)
+			d.FieldU("a_val", ec.archBits, scalar.UintHex)
+			seenNull = typ == AT_NULL
+		})
+	}
+}
+
+func elfDecodeNTFile(d *decode.D, ec elfContext) {
+	pos := d.Pos()
+	fms := elfReadNTFile(d, ec, d.BitsLeft())
+	d.SeekAbs(pos)
+	if fms == nil {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+
+	d.FieldU("count", ec.archBits)
+	d.FieldU("page_size", ec.archBits)
+	d.FieldArray("mappings", func(d *decode.D) {
+		for _, fm := range fms {
+			d.FieldStruct("mapping", func(d *decode.D) {
+				d.FieldU("start", ec.archBits, scalar.UintHex)
+				d.FieldU("end", ec.archBits, scalar.UintHex)
+				d.FieldU("file_ofs", ec.archBits, scalar.UintDescription("Offset in pages"))
+				d.FieldValueStr("filename", fm.name)
+			})
+		}
+	})
+	d.FieldArray("filenames", func(d *decode.D) {
+		for range fms {
+			d.FieldUTF8Null("filename")
+		}
+	})
+}
+
+func elfDecodeGNUProperties(d *decode.D, ec elfContext) {
+	for !d.End() {
+		d.FieldStruct("property", func(d *decode.D) {
+			d.FieldU32("pr_type", gnuPropertyTypeNames, scalar.UintHex)
+			dataSz := d.FieldU32("pr_datasz")
+			d.FieldRawLen("pr_data", int64(dataSz)*8)
+			if padding := d.AlignBits(ec.archBits); padding != 0 {
+				d.FieldRawLen("pr_padding", int64(padding))
+			}
+		})
+	}
+}
+
+func elfDecodeNote(d *decode.D, ec elfContext) {
+	// elf manpage says this is 32 or 64 bit but it seems it is always 32
+	// and that is also what readelf external.h says
+	nameSz := d.FieldU32("n_namesz")
+	descSz := d.FieldU32("n_descsz")
+	// name is needed to know type namespace but comes after type
+	name := strings.TrimRight(string(d.BytesRange(d.Pos()+32, int(nameSz))), "\x00")
+	var typ uint64
+	switch {
+	case ec.typ == ET_CORE:
+		typ = d.FieldU32("n_type", coreNoteNames, scalar.UintHex)
+	case name == "GNU":
+		typ = d.FieldU32("n_type", gnuNoteNames, scalar.UintHex)
+	case name == "Go":
+		typ = d.FieldU32("n_type", goNoteNames, scalar.UintHex)
+	default:
+		typ = d.FieldU32("n_type", scalar.UintHex)
+	}
+	d.FieldUTF8NullFixedLen("name", int(nameSz))
+	nameAlign := d.AlignBits(4 * 8)
+	if nameAlign != 0 {
+		d.FieldRawLen("name_align", int64(nameAlign))
+	}
+
+	descBits := int64(descSz) * 8
+	descFn := func(fn func(d *decode.D, ec elfContext)) func(d *decode.D) {
+		return func(d *decode.D) {
+			d.FramedFn(descBits, func(d *decode.D) {
+				fn(d, ec)
+				if d.BitsLeft() > 0 {
+					d.FieldRawLen("unused", d.BitsLeft())
+				}
+			})
+		}
+	}
+	switch {
+	case ec.typ == ET_CORE && name == "CORE" && typ == NT_PRSTATUS:
+		d.FieldStruct("desc", descFn(elfDecodePrStatus))
+	case ec.typ == ET_CORE && name == "CORE" && typ == NT_PRPSINFO:
+		d.FieldStruct("desc", descFn(elfDecodePrPsInfo))
+	case ec.typ == ET_CORE && name == "CORE" && typ == NT_SIGINFO:
+		d.FieldStruct("desc", descFn(elfDecodeSigInfo))
+	case ec.typ == ET_CORE && name == "CORE" && typ == NT_AUXV:
+		d.FieldArray("desc", descFn(elfDecodeAuxv))
+	case ec.typ == ET_CORE && name == "CORE" && typ == NT_FILE:
+		d.FieldStruct("desc", descFn(elfDecodeNTFile))
+	case ec.typ != ET_CORE && name == "GNU" && typ == NT_GNU_ABI_TAG && descSz == 16:
+		d.FieldStruct("desc", func(d *decode.D) {
+			d.FieldU32("os", abiTagOSNames)
+			d.FieldU32("major")
+			d.FieldU32("minor")
+			d.FieldU32("subminor")
+		})
+	case ec.typ != ET_CORE && name == "GNU" && typ == NT_GNU_BUILD_ID:
+		d.FieldRawLen("desc", descBits, scalar.RawHex)
+	case ec.typ != ET_CORE && name == "GNU" && typ == NT_GNU_GOLD_VERSION,
+		ec.typ != ET_CORE && name == "Go" && typ == NT_GO_BUILD_ID:
+		d.FieldUTF8NullFixedLen("desc", int(descSz))
+	case ec.typ != ET_CORE && name == "GNU" && typ == NT_GNU_PROPERTY_TYPE_0:
+		d.FieldArray("desc", descFn(elfDecodeGNUProperties))
+	default:
+		d.FieldRawLen("desc", descBits)
+	}
+	descAlign := d.AlignBits(4 * 8)
+	if descAlign != 0 {
+		d.FieldRawLen("decs_align", int64(descAlign))
+	}
+}
+
+func elfDecodeNotes(d *decode.D, ec elfContext) {
+	for !d.End() {
+		d.FieldStruct("note", func(d *decode.D) {
+			elfDecodeNote(d, ec)
+		})
+	}
+}
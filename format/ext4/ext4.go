@@ -0,0 +1,646 @@
+package ext4
+
+// https://www.kernel.org/doc/html/latest/filesystems/ext4/index.html
+// https://github.com/torvalds/linux/blob/master/fs/ext4/ext4.h
+
+import (
+	"embed"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed ext4.md
+var ext4FS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Ext4,
+		&decode.Format{
+			Description: "Linux ext2, ext3 and ext4 filesystem",
+			Groups:      []*decode.Group{format.Probe, format.Filesystem},
+			DecodeFn:    decodeExt4,
+		})
+	interp.RegisterFS(ext4FS)
+}
+
+const (
+	superblockOffset = 1024
+	superblockSize   = 1024
+	superblockMagic  = 0xef53
+	extentMagic      = 0xf30a
+	goodOldInodeSize = 128
+	inodeBlockSize   = 60
+)
+
+const (
+	incompat64Bit    = 0x80
+	roCompatGdtCsum  = 0x10
+	roCompatMetaCsum = 0x400
+)
+
+const (
+	inodeFlagExtents    = 0x80000
+	inodeFlagInlineData = 0x10000000
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+var unixTime = scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339)
+
+var stateNames = scalar.UintMapSymStr{
+	1: "clean",
+	2: "errors",
+	4: "orphans",
+}
+
+var errorsNames = scalar.UintMapSymStr{
+	1: "continue",
+	2: "remount_ro",
+	3: "panic",
+}
+
+var creatorOSNames = scalar.UintMapSymStr{
+	0: "linux",
+	1: "hurd",
+	2: "masix",
+	3: "freebsd",
+	4: "lites",
+}
+
+var revLevelNames = scalar.UintMapSymStr{
+	0: "good_old",
+	1: "dynamic",
+}
+
+var hashVersionNames = scalar.UintMapSymStr{
+	0: "legacy",
+	1: "half_md4",
+	2: "tea",
+	3: "legacy_unsigned",
+	4: "half_md4_unsigned",
+	5: "tea_unsigned",
+	6: "siphash",
+}
+
+var fileTypeNames = scalar.UintMapSymStr{
+	0x1: "fifo",
+	0x2: "char_device",
+	0x4: "directory",
+	0x6: "block_device",
+	0x8: "regular",
+	0xa: "symlink",
+	0xc: "socket",
+}
+
+// bit number to flag name for 32 bit flag fields
+type flagNames map[int]string
+
+var compatFlags = flagNames{
+	0:  "dir_prealloc",
+	1:  "imagic_inodes",
+	2:  "has_journal",
+	3:  "ext_attr",
+	4:  "resize_inode",
+	5:  "dir_index",
+	6:  "lazy_bg",
+	7:  "exclude_inode",
+	8:  "exclude_bitmap",
+	9:  "sparse_super2",
+	10: "fast_commit",
+	11: "stable_inodes",
+	12: "orphan_file",
+}
+
+var incompatFlags = flagNames{
+	0:  "compression",
+	1:  "filetype",
+	2:  "recover",
+	3:  "journal_dev",
+	4:  "meta_bg",
+	6:  "extents",
+	7:  "64bit",
+	8:  "mmp",
+	9:  "flex_bg",
+	10: "ea_inode",
+	12: "dirdata",
+	13: "csum_seed",
+	14: "largedir",
+	15: "inline_data",
+	16: "encrypt",
+	17: "casefold",
+}
+
+var roCompatFlags = flagNames{
+	0:  "sparse_super",
+	1:  "large_file",
+	2:  "btree_dir",
+	3:  "huge_file",
+	4:  "gdt_csum",
+	5:  "dir_nlink",
+	6:  "extra_isize",
+	7:  "has_snapshot",
+	8:  "quota",
+	9:  "bigalloc",
+	10: "metadata_csum",
+	11: "replica",
+	12: "readonly",
+	13: "project",
+	14: "shared_blocks",
+	15: "verity",
+	16: "orphan_present",
+}
+
+var defaultMountOptsFlags = flagNames{
+	0:  "debug",
+	1:  "bsdgroups",
+	2:  "xattr_user",
+	3:  "acl",
+	4:  "uid16",
+	5:  "jmode_data",
+	6:  "jmode_ordered",
+	8:  "nobarrier",
+	9:  "block_validity",
+	10: "discard",
+	11: "nodelalloc",
+}
+
+var superblockFlags = flagNames{
+	0: "signed_directory_hash",
+	1: "unsigned_directory_hash",
+	2: "test_filesys",
+}
+
+var groupDescriptorFlags = flagNames{
+	0: "inode_uninit",
+	1: "block_uninit",
+	2: "inode_zeroed",
+}
+
+var inodeFlags = flagNames{
+	0:  "secrm",
+	1:  "unrm",
+	2:  "compr",
+	3:  "sync",
+	4:  "immutable",
+	5:  "append",
+	6:  "nodump",
+	7:  "noatime",
+	8:  "dirty",
+	9:  "comprblk",
+	10: "nocompr",
+	11: "encrypt",
+	12: "index",
+	13: "imagic",
+	14: "journal_data",
+	15: "notail",
+	16: "dirsync",
+	17: "topdir",
+	18: "huge_file",
+	19: "extents",
+	20: "verity",
+	21: "ea_inode",
+	25: "dax",
+	28: "inline_data",
+	29: "projinherit",
+	30: "casefold",
+	31: "reserved",
+}
+
+// little endian so first byte has the low bits, unnamed bits are "unused<n>"
+func fieldFlags(d *decode.D, name string, nBits int, names flagNames) uint64 {
+	var v uint64
+	d.SeekRel(0, func(d *decode.D) { v = d.U(nBits) })
+	d.FieldStruct(name, func(d *decode.D) {
+		unusedN := 0
+		fieldUnused := func(nBits int) {
+			d.FieldU(fmt.Sprintf("unused%d", unusedN), nBits)
+			unusedN++
+		}
+		for b := 0; b < nBits/8; b++ {
+			unused := 0
+			for bit := b*8 + 7; bit >= b*8; bit-- {
+				n, ok := names[bit]
+				if !ok {
+					unused++
+					continue
+				}
+				if unused > 0 {
+					fieldUnused(unused)
+					unused = 0
+				}
+				d.FieldBool(n)
+			}
+			if unused > 0 {
+				fieldUnused(unused)
+			}
+		}
+	})
+	return v
+}
+
+type superblock struct {
+	blocksCount     uint64
+	firstDataBlock  uint64
+	blockSize       int64
+	blocksPerGroup  uint64
+	inodesPerGroup  uint64
+	inodeSize       int64
+	incompat        uint64
+	roCompat        uint64
+	descSize        int64
+	groupCount      uint64
+	groupDescOffset int64
+}
+
+func decodeSuperblock(d *decode.D) superblock {
+	var sb superblock
+	start := d.Pos()
+
+	d.FieldU32("inodes_count")
+	blocksCountLo := d.FieldU32("blocks_count_lo")
+	d.FieldU32("r_blocks_count_lo")
+	d.FieldU32("free_blocks_count_lo")
+	d.FieldU32("free_inodes_count")
+	sb.firstDataBlock = d.FieldU32("first_data_block")
+	logBlockSize := d.FieldU32("log_block_size", scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		if s.Actual < 32 {
+			s.Description = fmt.Sprintf("%d bytes", 1024<<s.Actual)
+		}
+		return s, nil
+	}))
+	if logBlockSize > 16 {
+		d.Fatalf("invalid log block size %d", logBlockSize)
+	}
+	sb.blockSize = 1024 << logBlockSize
+	d.FieldU32("log_cluster_size")
+	sb.blocksPerGroup = d.FieldU32("blocks_per_group")
+	d.FieldU32("clusters_per_group")
+	sb.inodesPerGroup = d.FieldU32("inodes_per_group")
+	d.FieldU32("mtime", unixTime)
+	d.FieldU32("wtime", unixTime)
+	d.FieldU16("mnt_count")
+	d.FieldS16("max_mnt_count")
+	d.FieldU16("magic", d.UintAssert(superblockMagic), scalar.UintHex)
+	d.FieldU16("state", stateNames)
+	d.FieldU16("errors", errorsNames)
+	d.FieldU16("minor_rev_level")
+	d.FieldU32("lastcheck", unixTime)
+	d.FieldU32("checkinterval")
+	d.FieldU32("creator_os", creatorOSNames)
+	revLevel := d.FieldU32("rev_level", revLevelNames)
+	d.FieldU16("def_resuid")
+	d.FieldU16("def_resgid")
+
+	// dynamic revision fields
+	d.FieldU32("first_ino")
+	inodeSize := d.FieldU16("inode_size")
+	if revLevel == 0 {
+		inodeSize = goodOldInodeSize
+	}
+	sb.inodeSize = int64(inodeSize)
+	d.FieldU16("block_group_nr")
+	fieldFlags(d, "feature_compat", 32, compatFlags)
+	sb.incompat = fieldFlags(d, "feature_incompat", 32, incompatFlags)
+	sb.roCompat = fieldFlags(d, "feature_ro_compat", 32, roCompatFlags)
+	d.FieldRawLen("uuid", 16*8)
+	d.FieldUTF8NullFixedLen("volume_name", 16)
+	d.FieldUTF8NullFixedLen("last_mounted", 64)
+	d.FieldU32("algorithm_usage_bitmap")
+
+	// performance hints
+	d.FieldU8("prealloc_blocks")
+	d.FieldU8("prealloc_dir_blocks")
+	d.FieldU16("reserved_gdt_blocks")
+
+	// journaling
+	d.FieldRawLen("journal_uuid", 16*8)
+	d.FieldU32("journal_inum")
+	d.FieldU32("journal_dev")
+	d.FieldU32("last_orphan")
+	d.FieldArray("hash_seed", func(d *decode.D) {
+		for i := 0; i < 4; i++ {
+			d.FieldU32("seed", scalar.UintHex)
+		}
+	})
+	d.FieldU8("def_hash_version", hashVersionNames)
+	d.FieldU8("jnl_backup_type")
+	descSize := d.FieldU16("desc_size")
+	fieldFlags(d, "default_mount_opts", 32, defaultMountOptsFlags)
+	d.FieldU32("first_meta_bg")
+	d.FieldU32("mkfs_time", unixTime)
+	d.FieldArray("jnl_blocks", func(d *decode.D) {
+		for i := 0; i < 17; i++ {
+			d.FieldU32("block")
+		}
+	})
+
+	// 64bit support
+	blocksCountHi := d.FieldU32("blocks_count_hi")
+	d.FieldU32("r_blocks_count_hi")
+	d.FieldU32("free_blocks_count_hi")
+	d.FieldU16("min_extra_isize")
+	d.FieldU16("want_extra_isize")
+	fieldFlags(d, "flags", 32, superblockFlags)
+	d.FieldU16("raid_stride")
+	d.FieldU16("mmp_interval")
+	d.FieldU64("mmp_block")
+	d.FieldU32("raid_stripe_width")
+	d.FieldU8("log_groups_per_flex")
+	d.FieldU8("checksum_type", scalar.UintMapSymStr{1: "crc32c"})
+	d.FieldU8("encryption_level")
+	d.FieldU8("reserved_pad")
+	d.FieldU64("kbytes_written")
+	d.FieldU32("snapshot_inum")
+	d.FieldU32("snapshot_id")
+	d.FieldU64("snapshot_r_blocks_count")
+	d.FieldU32("snapshot_list")
+	d.FieldU32("error_count")
+	d.FieldU32("first_error_time", unixTime)
+	d.FieldU32("first_error_ino")
+	d.FieldU64("first_error_block")
+	d.FieldUTF8NullFixedLen("first_error_func", 32)
+	d.FieldU32("first_error_line")
+	d.FieldU32("last_error_time", unixTime)
+	d.FieldU32("last_error_ino")
+	d.FieldU32("last_error_line")
+	d.FieldU64("last_error_block")
+	d.FieldUTF8NullFixedLen("last_error_func", 32)
+	d.FieldUTF8NullFixedLen("mount_opts", 64)
+	d.FieldU32("usr_quota_inum")
+	d.FieldU32("grp_quota_inum")
+	d.FieldU32("overhead_clusters")
+	d.FieldArray("backup_bgs", func(d *decode.D) {
+		d.FieldU32("group")
+		d.FieldU32("group")
+	})
+	d.FieldRawLen("encrypt_algos", 4*8)
+	d.FieldRawLen("encrypt_pw_salt", 16*8)
+	d.FieldU32("lpf_ino")
+	d.FieldU32("prj_quota_inum")
+	d.FieldU32("checksum_seed", scalar.UintHex)
+	d.FieldU8("wtime_hi")
+	d.FieldU8("mtime_hi")
+	d.FieldU8("mkfs_time_hi")
+	d.FieldU8("lastcheck_hi")
+	d.FieldU8("first_error_time_hi")
+	d.FieldU8("last_error_time_hi")
+	d.FieldU8("first_error_errcode")
+	d.FieldU8("last_error_errcode")
+	d.FieldU16("encoding")
+	d.FieldU16("encoding_flags")
+	d.FieldU32("orphan_file_inum")
+	d.FieldRawLen("reserved", 94*4*8)
+	if sb.roCompat&roCompatMetaCsum != 0 {
+		// crc32c without final xor
+		csum := crc32.Checksum(d.BytesRange(start, superblockSize-4), crc32cTable) ^ 0xffff_ffff
+		d.FieldU32("checksum", d.UintValidate(uint64(csum)), scalar.UintHex)
+	} else {
+		d.FieldU32("checksum", scalar.UintHex)
+	}
+
+	sb.blocksCount = blocksCountLo
+	sb.descSize = 32
+	if sb.incompat&incompat64Bit != 0 {
+		sb.blocksCount |= blocksCountHi << 32
+		if descSize != 0 {
+			sb.descSize = int64(descSize)
+		}
+	}
+	if sb.blocksPerGroup == 0 || sb.inodesPerGroup == 0 {
+		d.Fatalf("invalid blocks or inodes per group")
+	}
+	sb.groupCount = (sb.blocksCount - sb.firstDataBlock + sb.blocksPerGroup - 1) / sb.blocksPerGroup
+	// group descriptors are in the block after the superblock
+	sb.groupDescOffset = (int64(sb.firstDataBlock) + 1) * sb.blockSize
+
+	return sb
+}
+
+type groupDescriptor struct {
+	inodeTable   uint64
+	itableUnused uint64
+}
+
+func decodeGroupDescriptor(d *decode.D, sb superblock) groupDescriptor {
+	var gd groupDescriptor
+	d.FieldU32("block_bitmap_lo")
+	d.FieldU32("inode_bitmap_lo")
+	inodeTableLo := d.FieldU32("inode_table_lo")
+	d.FieldU16("free_blocks_count_lo")
+	d.FieldU16("free_inodes_count_lo")
+	d.FieldU16("used_dirs_count_lo")
+	fieldFlags(d, "flags", 16, groupDescriptorFlags)
+	d.FieldU32("exclude_bitmap_lo")
+	d.FieldU16("block_bitmap_csum_lo", scalar.UintHex)
+	d.FieldU16("inode_bitmap_csum_lo", scalar.UintHex)
+	itableUnusedLo := d.FieldU16("itable_unused_lo")
+	d.FieldU16("checksum", scalar.UintHex)
+
+	gd.inodeTable = inodeTableLo
+	gd.itableUnused = itableUnusedLo
+	if sb.descSize >= 64 {
+		d.FieldU32("block_bitmap_hi")
+		d.FieldU32("inode_bitmap_hi")
+		inodeTableHi := d.FieldU32("inode_table_hi")
+		d.FieldU16("free_blocks_count_hi")
+		d.FieldU16("free_inodes_count_hi")
+		d.FieldU16("used_dirs_count_hi")
+		itableUnusedHi := d.FieldU16("itable_unused_hi")
+		d.FieldU32("exclude_bitmap_hi")
+		d.FieldU16("block_bitmap_csum_hi", scalar.UintHex)
+		d.FieldU16("inode_bitmap_csum_hi", scalar.UintHex)
+		d.FieldU32("reserved")
+		gd.inodeTable |= inodeTableHi << 32
+		gd.itableUnused |= itableUnusedHi << 16
+	}
+	if !d.End() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return gd
+}
+
+func decodeExtents(d *decode.D) {
+	d.FieldStruct("extent_header", func(d *decode.D) {
+		d.FieldU16("magic", d.UintAssert(extentMagic), scalar.UintHex)
+		entryCount := d.FieldU16("entry_count")
+		d.FieldU16("max")
+		depth := d.FieldU16("depth")
+		d.FieldU32("generation")
+		if entryCount > (inodeBlockSize-12)/12 {
+			d.Fatalf("too many extent entries %d", entryCount)
+		}
+
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < entryCount; i++ {
+				if depth == 0 {
+					d.FieldStruct("extent", func(d *decode.D) {
+						d.FieldU32("block")
+						d.FieldU16("len")
+						d.FieldU16("start_hi")
+						d.FieldU32("start_lo")
+					})
+				} else {
+					d.FieldStruct("index", func(d *decode.D) {
+						d.FieldU32("block")
+						d.FieldU32("leaf_lo")
+						d.FieldU16("leaf_hi")
+						d.FieldU16("unused")
+					})
+				}
+			}
+		})
+	})
+}
+
+func decodeInode(d *decode.D, sb superblock) {
+	mode := d.FieldU16("mode", scalar.UintOct)
+	fileType := mode >> 12
+	d.FieldValueUint("file_type", fileType, fileTypeNames)
+	d.FieldU16("uid")
+	sizeLo := d.FieldU32("size_lo")
+	d.FieldU32("atime", unixTime)
+	d.FieldU32("ctime", unixTime)
+	d.FieldU32("mtime", unixTime)
+	d.FieldU32("dtime", unixTime)
+	d.FieldU16("gid")
+	d.FieldU16("links_count")
+	d.FieldU32("blocks_lo")
+	flags := fieldFlags(d, "flags", 32, inodeFlags)
+	d.FieldU32("version")
+
+	d.FramedFn(inodeBlockSize*8, func(d *decode.D) {
+		switch {
+		case flags&inodeFlagInlineData != 0:
+			d.FieldRawLen("inline_data", d.BitsLeft())
+		case fileType == 0xa && flags&inodeFlagExtents == 0 && sizeLo < inodeBlockSize:
+			// fast symlink, target is stored in block
+			d.FieldUTF8NullFixedLen("symlink_target", inodeBlockSize)
+		case flags&inodeFlagExtents != 0:
+			decodeExtents(d)
+			if !d.End() {
+				d.FieldRawLen("unused", d.BitsLeft())
+			}
+		default:
+			d.FieldArray("block", func(d *decode.D) {
+				for i := 0; i < 12; i++ {
+					d.FieldU32("direct")
+				}
+				d.FieldU32("indirect")
+				d.FieldU32("double_indirect")
+				d.FieldU32("triple_indirect")
+			})
+		}
+	})
+
+	d.FieldU32("generation")
+	d.FieldU32("file_acl_lo")
+	d.FieldU32("size_high")
+	d.FieldU32("obso_faddr")
+	d.FieldU16("blocks_high")
+	d.FieldU16("file_acl_high")
+	d.FieldU16("uid_high")
+	d.FieldU16("gid_high")
+	d.FieldU16("checksum_lo", scalar.UintHex)
+	d.FieldU16("reserved")
+	if sb.inodeSize <= goodOldInodeSize {
+		return
+	}
+
+	extraISize := d.FieldU16("extra_isize")
+	extraFields := []struct {
+		name string
+		bits int
+		sms  []scalar.UintMapper
+	}{
+		{"checksum_hi", 16, []scalar.UintMapper{scalar.UintHex}},
+		{"ctime_extra", 32, nil},
+		{"mtime_extra", 32, nil},
+		{"atime_extra", 32, nil},
+		{"crtime", 32, []scalar.UintMapper{unixTime}},
+		{"crtime_extra", 32, nil},
+		{"version_hi", 32, nil},
+		{"projid", 32, nil},
+	}
+	// extra_isize is the size of the extra fields including itself
+	extraLeft := int(extraISize)*8 - 16
+	for _, f := range extraFields {
+		if extraLeft < f.bits {
+			break
+		}
+		d.FieldU(f.name, f.bits, f.sms...)
+		extraLeft -= f.bits
+	}
+	if extraLeft > 0 {
+		d.FieldRawLen("extra_unknown", int64(extraLeft))
+	}
+	if !d.End() {
+		d.FieldRawLen("extended_attributes", d.BitsLeft())
+	}
+}
+
+func decodeExt4(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	d.FieldRawLen("boot_sector", superblockOffset*8)
+
+	var sb superblock
+	d.FieldStruct("superblock", func(d *decode.D) { sb = decodeSuperblock(d) })
+	if sb.blockSize*int64(sb.blocksCount) > d.Len()/8 {
+		d.Errorf("image is smaller than block count")
+	}
+
+	var gds []groupDescriptor
+	d.SeekAbs(sb.groupDescOffset * 8)
+	d.FieldArray("group_descriptors", func(d *decode.D) {
+		for i := uint64(0); i < sb.groupCount; i++ {
+			d.FramedFn(sb.descSize*8, func(d *decode.D) {
+				d.FieldStruct("group_descriptor", func(d *decode.D) {
+					gds = append(gds, decodeGroupDescriptor(d, sb))
+				})
+			})
+		}
+	})
+
+	// unused inodes are all zero and are skipped
+	d.FieldArray("inodes", func(d *decode.D) {
+		for i, gd := range gds {
+			tableStart := int64(gd.inodeTable) * sb.blockSize * 8
+			inodesUsed := sb.inodesPerGroup
+			// with group checksums the end of the inode table might not be initialized
+			if sb.roCompat&(roCompatGdtCsum|roCompatMetaCsum) != 0 && gd.itableUnused < inodesUsed {
+				inodesUsed -= gd.itableUnused
+			}
+			for j := uint64(0); j < inodesUsed; j++ {
+				pos := tableStart + int64(j)*sb.inodeSize*8
+				if pos+sb.inodeSize*8 > d.Len() {
+					break
+				}
+				var modeAndLinks uint64
+				d.SeekAbs(pos, func(d *decode.D) {
+					modeAndLinks = d.U16()
+					d.SeekRel(24 * 8)
+					modeAndLinks |= d.U16()
+				})
+				if modeAndLinks == 0 {
+					continue
+				}
+				d.SeekAbs(pos)
+				d.FramedFn(sb.inodeSize*8, func(d *decode.D) {
+					d.FieldStruct("inode", func(d *decode.D) {
+						d.FieldValueUint("number", uint64(i)*sb.inodesPerGroup+j+1)
+						decodeInode(d, sb)
+					})
+				})
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,29 @@
+#!/bin/sh
+# generates small deterministic ext4 and ext2 images, requires mke2fs from e2fsprogs
+set -eu
+cd "$(dirname "$0")"
+
+root=$(mktemp -d)
+trap 'rm -rf "$root"' EXIT
+mkdir "$root/dir"
+echo "hello ext4" > "$root/hello.txt"
+echo "nested" > "$root/dir/nested.txt"
+head -c 20000 /dev/zero | tr '\0' x > "$root/big.txt"
+ln -s hello.txt "$root/link"
+ln -s "$(printf '%080d' 0 | tr 0 a)" "$root/longlink"
+find "$root" -exec touch -h -d @1700000000 {} +
+
+export E2FSPROGS_FAKE_TIME=1700000000
+uuid=01234567-89ab-cdef-0123-456789abcdef
+rm -f test.ext4 test.ext2
+mke2fs -q -F -t ext4 -b 1024 -N 32 -O ^has_journal,^resize_inode -U $uuid -E hash_seed=$uuid,root_owner=0:0 -L test -d "$root" test.ext4 256
+mke2fs -q -F -t ext2 -b 1024 -N 32 -U $uuid -E hash_seed=$uuid,root_owner=0:0 -L test2 -d "$root" test.ext2 128
+
+# inode change and access times are taken from the source files, set them to make the images reproducible
+for img in test.ext4 test.ext2; do
+	for ino in 12 13 14 15 16 17; do
+		for field in atime ctime; do
+			debugfs -w -R "set_inode_field <$ino> $field @1700000000" $img 2>/dev/null
+		done
+	done
+done
@@ -23,6 +23,8 @@ func init() {
 		format.FLAC,
 		&decode.Format{
 			Description: "Free Lossless Audio Codec file",
+			Extensions:  []string{"flac"},
+			MIMETypes:   []string{"audio/flac"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    flacDecode,
 			Dependencies: []decode.Dependency{
@@ -44,6 +44,7 @@ type Probe_Args_In struct {
 }
 
 var (
+	Filesystem     = &decode.Group{Name: "filesystem"}
 	Image          = &decode.Group{Name: "image"}
 	INET_Packet    = &decode.Group{Name: "inet_packet", DefaultInArg: INET_Packet_In{}} // ex: ipv4
 	IP_Packet      = &decode.Group{Name: "ip_packet", DefaultInArg: INET_Packet_In{}}   // ex: tcp
@@ -58,10 +59,13 @@ var (
 	Bytes = &decode.Group{Name: "bytes"}
 
 	AAC_Frame           = &decode.Group{Name: "aac_frame"}
+	ACPI                = &decode.Group{Name: "acpi"}
 	ADTS                = &decode.Group{Name: "adts"}
 	ADTS_Frame          = &decode.Group{Name: "adts_frame"}
 	AIFF                = &decode.Group{Name: "aiff"}
 	AMF0                = &decode.Group{Name: "amf0"}
+	Android_Bootimg     = &decode.Group{Name: "android_bootimg"}
+	Android_Sparse      = &decode.Group{Name: "android_sparse"}
 	Apev2               = &decode.Group{Name: "apev2"}
 	Apple_Bookmark      = &decode.Group{Name: "apple_bookmark"}
 	AR                  = &decode.Group{Name: "ar"}
@@ -88,13 +92,19 @@ var (
 	BSON                = &decode.Group{Name: "bson"}
 	Bzip2               = &decode.Group{Name: "bzip2"}
 	CAFF                = &decode.Group{Name: "caff"}
+	CAN_Frame           = &decode.Group{Name: "can_frame"}
+	Candump_Log         = &decode.Group{Name: "candump_log"}
 	CBOR                = &decode.Group{Name: "cbor"}
 	CSV                 = &decode.Group{Name: "csv"}
+	DEX                 = &decode.Group{Name: "dex"}
+	Disk_Image          = &decode.Group{Name: "disk_image"}
 	DNS                 = &decode.Group{Name: "dns"}
 	DNS_TCP             = &decode.Group{Name: "dns_tcp"}
+	DTB                 = &decode.Group{Name: "dtb"}
 	ELF                 = &decode.Group{Name: "elf"}
 	Ether_8023_Frame    = &decode.Group{Name: "ether8023_frame"}
 	Exif                = &decode.Group{Name: "exif"}
+	Ext4                = &decode.Group{Name: "ext4"}
 	Fairplay_SPC        = &decode.Group{Name: "fairplay_spc"}
 	FIT                 = &decode.Group{Name: "fit"}
 	FLAC                = &decode.Group{Name: "flac"}
@@ -105,6 +115,8 @@ var (
 	FLAC_Streaminfo     = &decode.Group{Name: "flac_streaminfo"}
 	FLV                 = &decode.Group{Name: "flv"}
 	GIF                 = &decode.Group{Name: "gif"}
+	Git_Pack            = &decode.Group{Name: "git_pack"}
+	Git_Pack_Index      = &decode.Group{Name: "git_pack_index"}
 	Gzip                = &decode.Group{Name: "gzip"}
 	HEVC_Annexb         = &decode.Group{Name: "hevc_annexb"}
 	HEVC_AU             = &decode.Group{Name: "hevc_au"}
@@ -113,27 +125,36 @@ var (
 	HEVC_PPS            = &decode.Group{Name: "hevc_pps"}
 	HEVC_SPS            = &decode.Group{Name: "hevc_sps"}
 	HEVC_VPS            = &decode.Group{Name: "hevc_vps"}
+	HID_Report_Desc     = &decode.Group{Name: "hid_report_desc"}
 	HTML                = &decode.Group{Name: "html"}
+	HTTP3               = &decode.Group{Name: "http3"}
+	I2C_Capture         = &decode.Group{Name: "i2c_capture"}
 	ICC_Profile         = &decode.Group{Name: "icc_profile"}
 	ICMP                = &decode.Group{Name: "icmp"}
 	ICMPv6              = &decode.Group{Name: "icmpv6"}
 	ID3v1               = &decode.Group{Name: "id3v1"}
 	ID3v11              = &decode.Group{Name: "id3v11"}
 	ID3v2               = &decode.Group{Name: "id3v2"}
+	IHEX                = &decode.Group{Name: "ihex"}
+	IMG4                = &decode.Group{Name: "img4"}
 	IPv4Packet          = &decode.Group{Name: "ipv4_packet"}
 	IPv6Packet          = &decode.Group{Name: "ipv6_packet"}
+	Java_Class          = &decode.Group{Name: "java_class"}
 	JP2C                = &decode.Group{Name: "jp2c"}
 	JPEG                = &decode.Group{Name: "jpeg"}
 	JSON                = &decode.Group{Name: "json"}
 	JSONL               = &decode.Group{Name: "jsonl"}
+	Kaitai              = &decode.Group{Name: "kaitai"}
 	LevelDB_Descriptor  = &decode.Group{Name: "leveldb_descriptor"}
 	LevelDB_LDB         = &decode.Group{Name: "leveldb_table"}
 	LevelDB_LOG         = &decode.Group{Name: "leveldb_log"}
 	LuaJIT              = &decode.Group{Name: "luajit"}
+	LZ4                 = &decode.Group{Name: "lz4"}
 	MachO               = &decode.Group{Name: "macho"}
 	MachO_Fat           = &decode.Group{Name: "macho_fat"}
 	Markdown            = &decode.Group{Name: "markdown"}
 	Matroska            = &decode.Group{Name: "matroska"}
+	Matter_TLV          = &decode.Group{Name: "matter_tlv"}
 	MIDI                = &decode.Group{Name: "midi"}
 	MOC3                = &decode.Group{Name: "moc3"}
 	MP3                 = &decode.Group{Name: "mp3"}
@@ -150,12 +171,16 @@ var (
 	MsgPack             = &decode.Group{Name: "msgpack"}
 	Negentropy          = &decode.Group{Name: "negentropy"}
 	NES                 = &decode.Group{Name: "nes"}
+	NVMe_ID_Ctrl        = &decode.Group{Name: "nvme_id_ctrl"}
+	NVMe_ID_NS          = &decode.Group{Name: "nvme_id_ns"}
 	Ogg                 = &decode.Group{Name: "ogg"}
 	Ogg_Page            = &decode.Group{Name: "ogg_page"}
 	Opentimestamps      = &decode.Group{Name: "opentimestamps"}
 	Opus_Packet         = &decode.Group{Name: "opus_packet"}
 	PCAP                = &decode.Group{Name: "pcap"}
 	PCAPNG              = &decode.Group{Name: "pcapng"}
+	PDF                 = &decode.Group{Name: "pdf"}
+	PE                  = &decode.Group{Name: "pe"}
 	Pg_BTree            = &decode.Group{Name: "pg_btree"}
 	Pg_Control          = &decode.Group{Name: "pg_control"}
 	Pg_Heap             = &decode.Group{Name: "pg_heap"}
@@ -164,18 +189,33 @@ var (
 	Protobuf            = &decode.Group{Name: "protobuf"}
 	ProtobufWidevine    = &decode.Group{Name: "protobuf_widevine"}
 	PSSH_Playready      = &decode.Group{Name: "pssh_playready"}
+	QUIC                = &decode.Group{Name: "quic"}
+	RAR                 = &decode.Group{Name: "rar"}
+	RTCP                = &decode.Group{Name: "rtcp"}
 	RTMP                = &decode.Group{Name: "rtmp"}
+	RTP                 = &decode.Group{Name: "rtp"}
+	Seven_Zip           = &decode.Group{Name: "seven_zip"}
 	SLL_Packet          = &decode.Group{Name: "sll_packet"}
 	SLL2_Packet         = &decode.Group{Name: "sll2_packet"}
+	SMBIOS              = &decode.Group{Name: "smbios"}
+	SQLite3             = &decode.Group{Name: "sqlite3"}
+	SquashFS            = &decode.Group{Name: "squashfs"}
+	SREC                = &decode.Group{Name: "srec"}
 	TAP                 = &decode.Group{Name: "tap"}
 	TAR                 = &decode.Group{Name: "tar"}
 	TCP_Segment         = &decode.Group{Name: "tcp_segment"}
 	TIFF                = &decode.Group{Name: "tiff"}
 	TLS                 = &decode.Group{Name: "tls"}
 	TOML                = &decode.Group{Name: "toml"}
+	TPM_Eventlog        = &decode.Group{Name: "tpm_eventlog"}
 	Tzif                = &decode.Group{Name: "tzif"}
 	TZX                 = &decode.Group{Name: "tzx"}
+	UBI                 = &decode.Group{Name: "ubi"}
+	UBIFS               = &decode.Group{Name: "ubifs"}
+	UBoot_FIT           = &decode.Group{Name: "uboot_fit"}
 	UDP_Datagram        = &decode.Group{Name: "udp_datagram"}
+	UEFI_FV             = &decode.Group{Name: "uefi_fv"}
+	USB_Descriptors     = &decode.Group{Name: "usb_descriptors"}
 	Vorbis_Comment      = &decode.Group{Name: "vorbis_comment"}
 	Vorbis_Packet       = &decode.Group{Name: "vorbis_packet"}
 	VP8_Frame           = &decode.Group{Name: "vp8_frame"}
@@ -185,9 +225,12 @@ var (
 	WASM                = &decode.Group{Name: "wasm"}
 	WAV                 = &decode.Group{Name: "wav"}
 	WebP                = &decode.Group{Name: "webp"}
+	X509_Certificate    = &decode.Group{Name: "x509_certificate"}
 	XML                 = &decode.Group{Name: "xml"}
 	YAML                = &decode.Group{Name: "yaml"}
+	Zigbee_ZCL          = &decode.Group{Name: "zigbee_zcl"}
 	Zip                 = &decode.Group{Name: "zip"}
+	Zstd                = &decode.Group{Name: "zstd"}
 )
 
 // below are data types used to communicate between formats <FormatName>In/Out
@@ -195,6 +238,46 @@ var (
 type AAC_Frame_In struct {
 	ObjectType int `doc:"Audio object type"`
 }
+
+// AV1_Sequence_Header is the sequence header state needed to decode frame headers
+type AV1_Sequence_Header struct {
+	ReducedStillPictureHeader    bool
+	DecoderModelInfoPresent      bool
+	EqualPictureInterval         bool
+	BufferRemovalTimeLength      int
+	FramePresentationTimeLength  int
+	OperatingPointIdc            []uint64
+	DecoderModelPresentForThisOp []bool
+	FrameWidthBits               int
+	FrameHeightBits              int
+	MaxFrameWidth                uint64
+	MaxFrameHeight               uint64
+	FrameIDNumbersPresent        bool
+	DeltaFrameIDLength           int
+	AdditionalFrameIDLength      int
+	Use128x128Superblock         bool
+	EnableWarpedMotion           bool
+	EnableOrderHint              bool
+	EnableRefFrameMVs            bool
+	SeqForceScreenContentTools   uint64
+	SeqForceIntegerMV            uint64
+	OrderHintBits                int
+	EnableSuperres               bool
+	EnableCDEF                   bool
+	EnableRestoration            bool
+	MonoChrome                   bool
+	SubsamplingX                 bool
+	SubsamplingY                 bool
+	SeparateUVDeltaQ             bool
+	FilmGrainParamsPresent       bool
+}
+
+// AV1_Sequence_Header_State is used as in and out argument by av1_ccr, av1_obu and av1_frame
+type AV1_Sequence_Header_State struct {
+	HasSequenceHeader bool
+	SequenceHeader    AV1_Sequence_Header
+}
+
 type AVC_AU_In struct {
 	LengthSize uint64 `doc:"Length value size"`
 }
@@ -207,6 +290,10 @@ type CAFF_In struct {
 	Uncompress bool `doc:"Uncompress and probe files"`
 }
 
+type Disk_Image_In struct {
+	ProbePartitions bool `doc:"Probe partitions for filesystems"`
+}
+
 type FLAC_Frame_In struct {
 	SamplesBuf    []byte
 	BitsPerSample int `doc:"Bits per sample"`
@@ -258,7 +345,9 @@ type Ogg_Page_Out struct {
 }
 
 type Protobuf_In struct {
-	Message ProtoBufMessage
+	Message       ProtoBufMessage
+	DescriptorSet string `doc:"FileDescriptorSet content, ex: from protoc --descriptor_set_out"`
+	MessageType   string `doc:"Fully qualified message type name, default first message in last file"`
 }
 
 type Matroska_In struct {
@@ -366,10 +455,26 @@ type AVI_In struct {
 	DecodeExtendedChunks bool `doc:"Decode extended chunks"`
 }
 
+type Zigbee_ZCL_In struct {
+	ClusterID int `doc:"Cluster ID used to name cluster specific commands, -1 if unknown"`
+}
+
+type WASM_In struct {
+	DecodeInstructions bool `doc:"Decode function body instructions"`
+}
+
 type Zip_In struct {
 	Uncompress bool `doc:"Uncompress and probe files"`
 }
 
+type LZ4_In struct {
+	Uncompress bool `doc:"Uncompress and probe content"`
+}
+
+type Zstd_In struct {
+	Uncompress bool `doc:"Uncompress and probe content"`
+}
+
 type XML_In struct {
 	Seq             bool   `doc:"Use seq attribute to preserve element order"`
 	Array           bool   `doc:"Decode as nested arrays"`
@@ -391,10 +496,37 @@ type Bitcoin_Block_In struct {
 	HasHeader bool `doc:"Has blkdat header"`
 }
 
+type CAN_Frame_In struct {
+	DBC string `doc:"DBC database content"`
+}
+
+type Candump_Log_In struct {
+	DBC string `doc:"DBC database content"`
+}
+
+type I2C_Capture_In struct {
+	SCL      int `doc:"SCL channel number"`
+	SDA      int `doc:"SDA channel number"`
+	Unitsize int `doc:"Bytes per sample"`
+}
+
 type TLS_In struct {
 	Keylog string `doc:"NSS Key Log content"`
 }
 
+type QUIC_In struct {
+	HpKey      string `doc:"Header protection key as hex, used for non-initial packets"`
+	DcidLength int    `doc:"Destination connection ID length of short header packets"`
+}
+
+type HTTP3_In struct {
+	UniStream bool `doc:"Unidirectional stream starting with a stream type"`
+}
+
+type RTP_In struct {
+	SDP string `doc:"SDP content used to map payload types to codecs"`
+}
+
 type Pg_Control_In struct {
 	Flavour string `doc:"PostgreSQL flavour: postgres14, pgproee14.., postgres10"`
 }
@@ -408,3 +540,7 @@ type Pg_Heap_In struct {
 type Pg_BTree_In struct {
 	Page int `doc:"First page number in file, default is 0"`
 }
+
+type Kaitai_In struct {
+	Ksy string `doc:"Kaitai Struct YAML definition"`
+}
@@ -21,6 +21,8 @@ func init() {
 		format.GIF,
 		&decode.Format{
 			Description: "Graphics Interchange Format",
+			Extensions:  []string{"gif"},
+			MIMETypes:   []string{"image/gif"},
 			Groups:      []*decode.Group{format.Probe, format.Image},
 			DecodeFn:    gifDecode,
 		})
@@ -0,0 +1,307 @@
+package git
+
+// https://git-scm.com/docs/gitformat-pack
+//
+// Files in git using this format include:
+//  - .git/objects/pack/*.pack
+
+import (
+	"compress/zlib"
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed git_pack.md
+var gitPackFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Git_Pack,
+		&decode.Format{
+			Description: "Git pack file",
+			Extensions:  []string{"pack"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    gitPackDecode,
+		})
+	interp.RegisterFS(gitPackFS)
+}
+
+const objectIDLen = 20
+
+const (
+	objectTypeCommit   = 1
+	objectTypeTree     = 2
+	objectTypeBlob     = 3
+	objectTypeTag      = 4
+	objectTypeOfsDelta = 6
+	objectTypeRefDelta = 7
+)
+
+var objectTypeNames = scalar.UintMapSymStr{
+	objectTypeCommit:   "commit",
+	objectTypeTree:     "tree",
+	objectTypeBlob:     "blob",
+	objectTypeTag:      "tag",
+	objectTypeOfsDelta: "ofs_delta",
+	objectTypeRefDelta: "ref_delta",
+}
+
+// resolved object used as base for deltas
+type packObject struct {
+	typ     uint64
+	content []byte
+	depth   int
+}
+
+func deltaVarint(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid delta varint")
+}
+
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	baseSize, n, err := deltaVarint(delta)
+	if err != nil {
+		return nil, err
+	}
+	delta = delta[n:]
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta base size %d does not match base object size %d", baseSize, len(base))
+	}
+	resultSize, n, err := deltaVarint(delta)
+	if err != nil {
+		return nil, err
+	}
+	delta = delta[n:]
+
+	// resultSize is untrusted so don't preallocate, instead fail if result grows past it
+	var result []byte
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 != 0 {
+			var offset, size uint64
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, io.ErrUnexpectedEOF
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, fmt.Errorf("delta copy outside of base object")
+			}
+			if uint64(len(result))+size > resultSize {
+				return nil, fmt.Errorf("delta result larger than %d", resultSize)
+			}
+			result = append(result, base[offset:offset+size]...)
+		} else if op != 0 {
+			if int(op) > len(delta) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if uint64(len(result))+uint64(op) > resultSize {
+				return nil, fmt.Errorf("delta result larger than %d", resultSize)
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		} else {
+			return nil, fmt.Errorf("reserved delta opcode 0")
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, fmt.Errorf("delta result size %d does not match %d", len(result), resultSize)
+	}
+
+	return result, nil
+}
+
+func objectID(typ uint64, content []byte) []byte {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", objectTypeNames[typ], len(content))
+	h.Write(content)
+	return h.Sum(nil)
+}
+
+func decodeDelta(d *decode.D) {
+	d.FieldULEB128("base_size")
+	d.FieldULEB128("result_size")
+	d.FieldArray("instructions", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("instruction", func(d *decode.D) {
+				if !d.FieldBool("copy") {
+					size := d.FieldU7("size")
+					if size == 0 {
+						d.Fatalf("reserved delta opcode 0")
+					}
+					d.FieldRawLen("data", int64(size)*8)
+					return
+				}
+				sizeBytes := d.FieldU3("size_bytes", scalar.UintBin)
+				offsetBytes := d.FieldU4("offset_bytes", scalar.UintBin)
+				// bytes are present for each set bit, least significant bit first
+				partsFn := func(mask uint64, n int) func(d *decode.D) uint64 {
+					return func(d *decode.D) uint64 {
+						var v uint64
+						for i := 0; i < n; i++ {
+							if mask&(1<<i) != 0 {
+								v |= d.U8() << (8 * i)
+							}
+						}
+						return v
+					}
+				}
+				if offsetBytes != 0 {
+					d.FieldUintFn("offset", partsFn(offsetBytes, 4))
+				} else {
+					d.FieldValueUint("offset", 0)
+				}
+				if sizeBytes != 0 {
+					d.FieldUintFn("size", partsFn(sizeBytes, 3), scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+						if s.Actual == 0 {
+							s.Actual = 0x10000
+						}
+						return s, nil
+					}))
+				} else {
+					d.FieldValueUint("size", 0x10000)
+				}
+			})
+		}
+	})
+}
+
+func gitPackDecode(d *decode.D) any {
+	d.FieldUTF8("signature", 4, d.StrAssert("PACK"))
+	version := d.FieldU32("version")
+	if version != 2 && version != 3 {
+		d.Fatalf("unsupported version %d", version)
+	}
+	numObjects := d.FieldU32("number_of_objects")
+
+	objects := map[int64]*packObject{}
+	offsetByID := map[string]int64{}
+	trailerPos := d.Len() - objectIDLen*8
+
+	d.FieldArray("objects", func(d *decode.D) {
+		for i := uint64(0); i < numObjects; i++ {
+			d.FieldStruct("object", func(d *decode.D) {
+				objectOffset := d.Pos() / 8
+				d.FieldValueUint("offset", uint64(objectOffset))
+
+				typ := d.PeekUintBits(8) >> 4 & 0x7
+				d.FieldValueUint("type", typ, objectTypeNames)
+				d.FieldUintFn("size", func(d *decode.D) uint64 {
+					b := d.U8()
+					size := b & 0xf
+					shift := 4
+					for b&0x80 != 0 {
+						b = d.U8()
+						size |= (b & 0x7f) << shift
+						shift += 7
+					}
+					return size
+				})
+
+				var base *packObject
+				switch typ {
+				case objectTypeCommit, objectTypeTree, objectTypeBlob, objectTypeTag:
+				case objectTypeOfsDelta:
+					distance := d.FieldUintFn("base_distance", func(d *decode.D) uint64 {
+						b := d.U8()
+						v := b & 0x7f
+						for b&0x80 != 0 {
+							b = d.U8()
+							v = ((v + 1) << 7) | (b & 0x7f)
+						}
+						return v
+					})
+					baseOffset := objectOffset - int64(distance)
+					d.FieldValueUint("base_offset", uint64(baseOffset))
+					base = objects[baseOffset]
+				case objectTypeRefDelta:
+					baseID := d.FieldRawLen("base_id", objectIDLen*8, scalar.RawHex)
+					if b, err := io.ReadAll(bitio.NewIOReader(baseID)); err == nil {
+						if baseOffset, ok := offsetByID[string(b)]; ok {
+							d.FieldValueUint("base_offset", uint64(baseOffset))
+							base = objects[baseOffset]
+						}
+					}
+				default:
+					d.Fatalf("unknown object type %d", typ)
+				}
+
+				// zlib stream has no length, inflate to find end of it
+				r := bitio.NewIOReadSeeker(d.BitBufRange(d.Pos(), trailerPos-d.Pos()))
+				zr, err := zlib.NewReader(r)
+				if err != nil {
+					d.IOPanic(err, "compressed", "zlib.NewReader")
+				}
+				content, err := io.ReadAll(zr)
+				if err != nil {
+					d.IOPanic(err, "compressed", "ReadAll")
+				}
+				compressedLen, err := r.Seek(0, io.SeekCurrent)
+				if err != nil {
+					d.IOPanic(err, "compressed", "Seek")
+				}
+
+				contentBR := bitio.NewBitReader(content, -1)
+				resolved := &packObject{typ: typ, content: content}
+				if typ == objectTypeOfsDelta || typ == objectTypeRefDelta {
+					d.FieldStructRootBitBufFn("delta", contentBR, decodeDelta)
+					resolved = nil
+					if base != nil {
+						if result, err := applyDelta(base.content, content); err == nil {
+							resolved = &packObject{typ: base.typ, content: result, depth: base.depth + 1}
+						}
+					}
+				} else {
+					d.FieldRootBitBuf("uncompressed", contentBR)
+				}
+				d.FieldRawLen("compressed", compressedLen*8)
+
+				if resolved != nil {
+					id := objectID(resolved.typ, resolved.content)
+					objects[objectOffset] = resolved
+					offsetByID[string(id)] = objectOffset
+					d.FieldValueStr("id", hex.EncodeToString(id))
+					if resolved.depth > 0 {
+						d.FieldValueUint("resolved_type", resolved.typ, objectTypeNames)
+						d.FieldValueUint("depth", uint64(resolved.depth))
+					}
+				}
+			})
+		}
+	})
+
+	checksumPos := d.Pos()
+	h := sha1.New()
+	d.Copy(h, bitio.NewIOReader(d.BitBufRange(0, checksumPos)))
+	d.FieldRawLen("checksum", objectIDLen*8, d.ValidateBitBuf(h.Sum(nil)), scalar.RawHex)
+
+	return nil
+}
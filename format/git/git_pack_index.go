@@ -0,0 +1,121 @@
+package git
+
+// https://git-scm.com/docs/gitformat-pack#_pack_idx_files_have_the_following_format
+//
+// Files in git using this format include:
+//  - .git/objects/pack/*.idx
+
+import (
+	"crypto/sha1"
+	"embed"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed git_pack_index.md
+var gitPackIndexFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Git_Pack_Index,
+		&decode.Format{
+			Description: "Git pack index file",
+			Extensions:  []string{"idx"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    gitPackIndexDecode,
+		})
+	interp.RegisterFS(gitPackIndexFS)
+}
+
+var indexV2Magic = []byte("\xfftOc")
+
+const fanoutEntries = 256
+
+const largeOffsetFlag = 0x8000_0000
+
+var offsetDescription = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual&largeOffsetFlag != 0 {
+		s.Description = fmt.Sprintf("large offset index %d", s.Actual&^largeOffsetFlag)
+	}
+	return s, nil
+})
+
+func decodeFanout(d *decode.D) uint64 {
+	var prev uint64
+	d.FieldArray("fanout", func(d *decode.D) {
+		for i := 0; i < fanoutEntries; i++ {
+			// number of objects with first byte of id less than or equal to i
+			n := d.FieldU32("count")
+			if n < prev {
+				d.Fatalf("fanout count decreases")
+			}
+			prev = n
+		}
+	})
+	return prev
+}
+
+func gitPackIndexDecode(d *decode.D) any {
+	version := uint64(1)
+	if d.PeekBytes(len(indexV2Magic))[0] == indexV2Magic[0] {
+		d.FieldRawLen("magic", int64(len(indexV2Magic))*8, d.AssertBitBuf(indexV2Magic))
+		version = d.FieldU32("version", d.UintAssert(2))
+	}
+
+	numObjects := decodeFanout(d)
+
+	switch version {
+	case 1:
+		// version 1 has no magic, make sure size matches
+		if numObjects == 0 || d.Len() != (fanoutEntries*4+int64(numObjects)*24+2*objectIDLen)*8 {
+			d.Fatalf("size does not match number of objects")
+		}
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < numObjects; i++ {
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldU32("offset")
+					d.FieldRawLen("id", objectIDLen*8, scalar.RawHex)
+				})
+			}
+		})
+	case 2:
+		d.FieldArray("ids", func(d *decode.D) {
+			for i := uint64(0); i < numObjects; i++ {
+				d.FieldRawLen("id", objectIDLen*8, scalar.RawHex)
+			}
+		})
+		d.FieldArray("crc32s", func(d *decode.D) {
+			for i := uint64(0); i < numObjects; i++ {
+				d.FieldU32("crc32", scalar.UintHex)
+			}
+		})
+		largeOffsets := 0
+		d.FieldArray("offsets", func(d *decode.D) {
+			for i := uint64(0); i < numObjects; i++ {
+				if d.FieldU32("offset", offsetDescription)&largeOffsetFlag != 0 {
+					largeOffsets++
+				}
+			}
+		})
+		if largeOffsets > 0 {
+			d.FieldArray("large_offsets", func(d *decode.D) {
+				for i := 0; i < largeOffsets; i++ {
+					d.FieldU64("offset")
+				}
+			})
+		}
+	}
+
+	d.FieldRawLen("pack_checksum", objectIDLen*8, scalar.RawHex)
+	checksumPos := d.Pos()
+	h := sha1.New()
+	d.Copy(h, bitio.NewIOReader(d.BitBufRange(0, checksumPos)))
+	d.FieldRawLen("checksum", objectIDLen*8, d.ValidateBitBuf(h.Sum(nil)), scalar.RawHex)
+
+	return nil
+}
@@ -24,6 +24,8 @@ func init() {
 		format.Gzip,
 		&decode.Format{
 			Description: "gzip compression",
+			Extensions:  []string{"gz", "tgz"},
+			MIMETypes:   []string{"application/gzip"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    gzipDecode,
 			Dependencies: []decode.Dependency{
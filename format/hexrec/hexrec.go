@@ -0,0 +1,147 @@
+package hexrec
+
+// Intel HEX and Motorola S-record are line based text formats with hex encoded
+// records of addressed data, usually firmware images for programmers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var probeGroup decode.Group
+
+// sanity limit as gaps between chunks are filled
+const maxImageSize = 256 * 1024 * 1024
+
+type chunk struct {
+	address uint64
+	data    []byte
+}
+
+// buildImage places chunks relative to the lowest address, gaps are zero filled same as objcopy
+func buildImage(chunks []chunk) (uint64, []byte, error) {
+	if len(chunks) == 0 {
+		return 0, nil, nil
+	}
+	start := chunks[0].address
+	stop := start
+	for _, c := range chunks {
+		start = min(start, c.address)
+		stop = max(stop, c.address+uint64(len(c.data)))
+	}
+	if stop-start > maxImageSize {
+		return 0, nil, fmt.Errorf("image 0x%x-0x%x larger than %d bytes", start, stop, maxImageSize)
+	}
+	image := make([]byte, stop-start)
+	for _, c := range chunks {
+		copy(image[c.address-start:], c.data)
+	}
+	return start, image, nil
+}
+
+// fieldImage adds the image address and the image, probed if possible
+func fieldImage(d *decode.D, chunks []chunk) {
+	address, image, err := buildImage(chunks)
+	if err != nil {
+		d.Fatalf("%s", err)
+	}
+	if image == nil {
+		return
+	}
+	d.FieldValueUint("image_address", address, scalar.UintHex)
+	br := bitio.NewBitReader(image, -1)
+	dv, _, _ := d.TryFieldFormatBitBuf("image", br, &probeGroup, format.Probe_In{})
+	if dv == nil {
+		d.FieldRootBitBuf("image", br)
+	}
+}
+
+func fieldHex(d *decode.D, name string, nChars int, sms ...scalar.UintMapper) uint64 {
+	return d.FieldUintFn(name, func(d *decode.D) uint64 {
+		s := d.UTF8(nChars)
+		v, err := strconv.ParseUint(s, 16, 64)
+		if err != nil {
+			d.Fatalf("%s: invalid hex %q", name, s)
+		}
+		return v
+	}, sms...)
+}
+
+func fieldHexBytes(d *decode.D, name string, nBytes int) []byte {
+	if nBytes == 0 {
+		return nil
+	}
+	var b []byte
+	d.FieldStrFn(name, func(d *decode.D) string {
+		s := d.UTF8(nBytes * 2)
+		var err error
+		b, err = hex.DecodeString(s)
+		if err != nil {
+			d.Fatalf("%s: invalid hex %q", name, s)
+		}
+		return s
+	})
+	return b
+}
+
+// fieldNewline is optional for the last record
+func fieldNewline(d *decode.D) {
+	switch {
+	case d.End():
+	case d.PeekUintBits(8) == '\r':
+		d.FieldUTF8("newline", 2, d.StrAssert("\r\n"))
+	default:
+		d.FieldUTF8("newline", 1, d.StrAssert("\n"))
+	}
+}
+
+func byteSum(b []byte) uint64 {
+	var s uint64
+	for _, v := range b {
+		s += uint64(v)
+	}
+	return s
+}
+
+// recordLines returns lines with line endings removed
+func recordLines(c any) ([]string, error) {
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(bitio.NewIOReader(br))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n"), nil
+}
+
+// transform converts text records to a binary image
+func transform(c any, parse func(lines []string) ([]chunk, error)) any {
+	lines, err := recordLines(c)
+	if err != nil {
+		return err
+	}
+	chunks, err := parse(lines)
+	if err != nil {
+		return err
+	}
+	_, image, err := buildImage(chunks)
+	if err != nil {
+		return err
+	}
+	bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(image, -1), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
@@ -0,0 +1,171 @@
+package hexrec
+
+// https://en.wikipedia.org/wiki/Intel_HEX
+// Hexadecimal Object File Format Specification, Revision A, Intel 1988
+
+import (
+	"embed"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed ihex.md
+var ihexFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.IHEX,
+		&decode.Format{
+			Description: "Intel HEX",
+			Extensions:  []string{"hex", "ihex"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeIHEX,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(ihexFS)
+	interp.RegisterFunc0("ihex_to_binary", func(_ *interp.Interp, c any) any {
+		return transform(c, parseIHEX)
+	})
+}
+
+const (
+	ihexData                   = 0x00
+	ihexEndOfFile              = 0x01
+	ihexExtendedSegmentAddress = 0x02
+	ihexStartSegmentAddress    = 0x03
+	ihexExtendedLinearAddress  = 0x04
+	ihexStartLinearAddress     = 0x05
+)
+
+var ihexRecordTypeNames = scalar.UintMapSymStr{
+	ihexData:                   "data",
+	ihexEndOfFile:              "end_of_file",
+	ihexExtendedSegmentAddress: "extended_segment_address",
+	ihexStartSegmentAddress:    "start_segment_address",
+	ihexExtendedLinearAddress:  "extended_linear_address",
+	ihexStartLinearAddress:     "start_linear_address",
+}
+
+// ihexAddress tracks the upper address bits set by extended address records
+type ihexAddress struct {
+	base uint64
+}
+
+// record returns the absolute address for data records
+func (a *ihexAddress) record(typ uint64, address uint64, data []byte) (uint64, error) {
+	switch typ {
+	case ihexData:
+		return a.base + address, nil
+	case ihexEndOfFile:
+		return 0, nil
+	case ihexExtendedSegmentAddress, ihexExtendedLinearAddress:
+		if len(data) != 2 {
+			return 0, fmt.Errorf("%s record with %d data bytes", ihexRecordTypeNames[typ], len(data))
+		}
+		a.base = uint64(binary.BigEndian.Uint16(data))
+		if typ == ihexExtendedSegmentAddress {
+			a.base <<= 4
+		} else {
+			a.base <<= 16
+		}
+		return 0, nil
+	case ihexStartSegmentAddress, ihexStartLinearAddress:
+		if len(data) != 4 {
+			return 0, fmt.Errorf("%s record with %d data bytes", ihexRecordTypeNames[typ], len(data))
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unknown record type %d", typ)
+	}
+}
+
+func ihexChecksum(b []byte) uint64 {
+	return -byteSum(b) & 0xff
+}
+
+func decodeIHEX(d *decode.D) any {
+	if d.End() {
+		d.Fatalf("no records")
+	}
+
+	var chunks []chunk
+	var a ihexAddress
+	seenEOF := false
+
+	d.FieldArray("records", func(d *decode.D) {
+		for !d.End() && !seenEOF {
+			d.FieldStruct("record", func(d *decode.D) {
+				d.FieldUTF8("start_code", 1, d.StrAssert(":"))
+				byteCount := fieldHex(d, "byte_count", 2)
+				address := fieldHex(d, "address", 4, scalar.UintHex)
+				typ := fieldHex(d, "type", 2, ihexRecordTypeNames)
+				data := fieldHexBytes(d, "data", int(byteCount))
+				sum := ihexChecksum(append([]byte{byte(byteCount), byte(address >> 8), byte(address), byte(typ)}, data...))
+				fieldHex(d, "checksum", 2, d.UintValidate(sum), scalar.UintHex)
+				fieldNewline(d)
+
+				absAddress, err := a.record(typ, address, data)
+				if err != nil {
+					d.Fatalf("%s", err)
+				}
+				seenEOF = typ == ihexEndOfFile
+				if typ == ihexData {
+					d.FieldValueUint("absolute_address", absAddress, scalar.UintHex)
+					chunks = append(chunks, chunk{address: absAddress, data: data})
+				}
+			})
+		}
+	})
+	fieldImage(d, chunks)
+
+	return nil
+}
+
+func parseIHEX(lines []string) ([]chunk, error) {
+	var chunks []chunk
+	var a ihexAddress
+
+	for i, l := range lines {
+		lineNr := i + 1
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		if !strings.HasPrefix(l, ":") {
+			return nil, fmt.Errorf("ihex: line %d: missing start code", lineNr)
+		}
+		b, err := hex.DecodeString(l[1:])
+		if err != nil {
+			return nil, fmt.Errorf("ihex: line %d: %w", lineNr, err)
+		}
+		if len(b) < 5 || len(b) != int(b[0])+5 {
+			return nil, fmt.Errorf("ihex: line %d: invalid record length", lineNr)
+		}
+		if ihexChecksum(b) != 0 {
+			return nil, fmt.Errorf("ihex: line %d: invalid checksum", lineNr)
+		}
+		typ := uint64(b[3])
+		data := b[4 : len(b)-1]
+		absAddress, err := a.record(typ, uint64(binary.BigEndian.Uint16(b[1:3])), data)
+		if err != nil {
+			return nil, fmt.Errorf("ihex: line %d: %w", lineNr, err)
+		}
+		if typ == ihexEndOfFile {
+			break
+		}
+		if typ == ihexData {
+			chunks = append(chunks, chunk{address: absAddress, data: data})
+		}
+	}
+
+	return chunks, nil
+}
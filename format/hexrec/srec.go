@@ -0,0 +1,175 @@
+package hexrec
+
+// https://en.wikipedia.org/wiki/SREC_(file_format)
+// https://linux.die.net/man/5/srec
+
+import (
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed srec.md
+var srecFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.SREC,
+		&decode.Format{
+			Description: "Motorola S-record",
+			Extensions:  []string{"srec", "s19", "s28", "s37", "mot"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeSREC,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(srecFS)
+	interp.RegisterFunc0("srec_to_binary", func(_ *interp.Interp, c any) any {
+		return transform(c, parseSREC)
+	})
+}
+
+var srecRecordTypeNames = scalar.UintMapSymStr{
+	0: "header",
+	1: "data_16",
+	2: "data_24",
+	3: "data_32",
+	5: "count_16",
+	6: "count_24",
+	7: "start_32",
+	8: "start_24",
+	9: "start_16",
+}
+
+// address size in bytes per record type
+var srecAddressSizes = map[uint64]int{
+	0: 2,
+	1: 2,
+	2: 3,
+	3: 4,
+	5: 2,
+	6: 3,
+	7: 4,
+	8: 3,
+	9: 2,
+}
+
+func srecIsData(typ uint64) bool  { return typ >= 1 && typ <= 3 }
+func srecIsCount(typ uint64) bool { return typ == 5 || typ == 6 }
+func srecIsStart(typ uint64) bool { return typ >= 7 && typ <= 9 }
+
+func srecChecksum(b []byte) uint64 {
+	return ^byteSum(b) & 0xff
+}
+
+func decodeSREC(d *decode.D) any {
+	if d.End() {
+		d.Fatalf("no records")
+	}
+
+	var chunks []chunk
+	dataRecords := uint64(0)
+	seenStart := false
+
+	d.FieldArray("records", func(d *decode.D) {
+		for !d.End() && !seenStart {
+			d.FieldStruct("record", func(d *decode.D) {
+				d.FieldUTF8("start_code", 1, d.StrAssert("S"))
+				typ := d.FieldUintFn("type", func(d *decode.D) uint64 {
+					s := d.UTF8(1)
+					v, err := strconv.ParseUint(s, 10, 64)
+					if err != nil {
+						d.Fatalf("type: invalid digit %q", s)
+					}
+					return v
+				}, srecRecordTypeNames)
+				addressSize, ok := srecAddressSizes[typ]
+				if !ok {
+					d.Fatalf("unknown record type %d", typ)
+				}
+				byteCount := fieldHex(d, "byte_count", 2)
+				if int(byteCount) < addressSize+1 {
+					d.Fatalf("byte count %d too small for address and checksum", byteCount)
+				}
+				var addressSms []scalar.UintMapper
+				if srecIsCount(typ) {
+					addressSms = append(addressSms, d.UintValidate(dataRecords))
+				} else {
+					addressSms = append(addressSms, scalar.UintHex)
+				}
+				address := fieldHex(d, "address", addressSize*2, addressSms...)
+				data := fieldHexBytes(d, "data", int(byteCount)-addressSize-1)
+				sumBytes := []byte{byte(byteCount)}
+				for i := addressSize - 1; i >= 0; i-- {
+					sumBytes = append(sumBytes, byte(address>>(i*8)))
+				}
+				sum := srecChecksum(append(sumBytes, data...))
+				fieldHex(d, "checksum", 2, d.UintValidate(sum), scalar.UintHex)
+				fieldNewline(d)
+
+				switch {
+				case typ == 0:
+					d.FieldValueStr("header", strings.TrimRight(string(data), "\x00"))
+				case srecIsData(typ):
+					dataRecords++
+					chunks = append(chunks, chunk{address: address, data: data})
+				case srecIsStart(typ):
+					seenStart = true
+				}
+			})
+		}
+	})
+	fieldImage(d, chunks)
+
+	return nil
+}
+
+func parseSREC(lines []string) ([]chunk, error) {
+	var chunks []chunk
+
+	for i, l := range lines {
+		lineNr := i + 1
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		if len(l) < 2 || l[0] != 'S' {
+			return nil, fmt.Errorf("srec: line %d: missing start code", lineNr)
+		}
+		typ := uint64(l[1] - '0')
+		addressSize, ok := srecAddressSizes[typ]
+		if !ok {
+			return nil, fmt.Errorf("srec: line %d: unknown record type %q", lineNr, l[1])
+		}
+		b, err := hex.DecodeString(l[2:])
+		if err != nil {
+			return nil, fmt.Errorf("srec: line %d: %w", lineNr, err)
+		}
+		if len(b) < addressSize+2 || len(b) != int(b[0])+1 {
+			return nil, fmt.Errorf("srec: line %d: invalid record length", lineNr)
+		}
+		if srecChecksum(b[:len(b)-1]) != uint64(b[len(b)-1]) {
+			return nil, fmt.Errorf("srec: line %d: invalid checksum", lineNr)
+		}
+		if srecIsStart(typ) {
+			break
+		}
+		if srecIsData(typ) {
+			var address uint64
+			for _, v := range b[1 : 1+addressSize] {
+				address = address<<8 | uint64(v)
+			}
+			chunks = append(chunks, chunk{address: address, data: b[1+addressSize : len(b)-1]})
+		}
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,236 @@
+package i2c
+
+// https://www.nxp.com/docs/en/user-guide/UM10204.pdf
+// https://sigrok.org/wiki/File_format:Sigrok/v2
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed i2c_capture.md
+var i2cCaptureFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.I2C_Capture,
+		&decode.Format{
+			Description:  "I2C bus capture from logic analyzer samples",
+			DecodeFn:     decodeI2CCapture,
+			DefaultInArg: format.I2C_Capture_In{SCL: 0, SDA: 1, Unitsize: 1},
+		})
+	interp.RegisterFS(i2cCaptureFS)
+}
+
+const (
+	segmentIdle = iota
+	segmentStart
+	segmentBit
+	segmentStop
+)
+
+// segment is a sample index range. Bits span from a SCL falling edge to the next
+// and the bit value is SDA at the SCL rising edge in between.
+type segment struct {
+	kind  int
+	start int64
+	stop  int64
+	value int
+}
+
+var addressNames = scalar.UintMapSymStr{
+	0x30: "ddc_segment",
+	0x37: "ddc_ci",
+	0x50: "ddc_edid",
+}
+
+var directionNames = scalar.UintMapSymStr{
+	0: "write",
+	1: "read",
+}
+
+func findSegments(bs []byte, unitsize int, scl int, sda int) []segment {
+	nSamples := int64(len(bs) / unitsize)
+	channel := func(i int64, ch int) bool {
+		return bs[i*int64(unitsize)+int64(ch/8)]&(1<<(ch%8)) != 0
+	}
+
+	var segs []segment
+	cur := segment{kind: segmentIdle}
+	next := func(i int64, kind int) {
+		if i > cur.start {
+			cur.stop = i
+			segs = append(segs, cur)
+		}
+		cur = segment{kind: kind, start: i, value: -1}
+	}
+
+	prevSCL, prevSDA := channel(0, scl), channel(0, sda)
+	for i := int64(1); i < nSamples; i++ {
+		curSCL, curSDA := channel(i, scl), channel(i, sda)
+		switch {
+		case prevSCL && curSCL && prevSDA && !curSDA:
+			// SCL rise before a repeated start is part of the condition
+			if cur.kind == segmentBit {
+				cur.kind = segmentStart
+			} else {
+				next(i, segmentStart)
+			}
+		case prevSCL && curSCL && !prevSDA && curSDA:
+			if cur.kind == segmentIdle {
+				break
+			}
+			// SCL rise before a stop is part of the condition
+			if cur.kind == segmentBit {
+				cur.kind = segmentStop
+			} else {
+				next(i, segmentStop)
+			}
+			next(i+1, segmentIdle)
+		case prevSCL && !curSCL:
+			if cur.kind != segmentIdle {
+				next(i, segmentBit)
+			}
+		case !prevSCL && curSCL:
+			if cur.kind == segmentBit && curSDA {
+				cur.value = 1
+			} else if cur.kind == segmentBit {
+				cur.value = 0
+			}
+		}
+		prevSCL, prevSDA = curSCL, curSDA
+	}
+	next(nSamples, segmentIdle)
+
+	return segs
+}
+
+func decodeI2CCapture(d *decode.D) any {
+	var ci format.I2C_Capture_In
+	d.ArgAs(&ci)
+
+	if ci.Unitsize < 1 {
+		d.Fatalf("invalid unitsize %d", ci.Unitsize)
+	}
+	for _, ch := range []int{ci.SCL, ci.SDA} {
+		if ch < 0 || ch >= ci.Unitsize*8 {
+			d.Fatalf("channel %d outside of %d channels", ch, ci.Unitsize*8)
+		}
+	}
+	nSamples := d.BitsLeft() / 8 / int64(ci.Unitsize)
+	if nSamples < 2 {
+		d.Fatalf("too few samples")
+	}
+	sampleBits := int64(ci.Unitsize) * 8
+
+	segs := findSegments(d.PeekBytes(int(nSamples)*ci.Unitsize), ci.Unitsize, ci.SCL, ci.SDA)
+	if len(segs) == 1 {
+		d.Fatalf("no i2c start condition found")
+	}
+
+	fieldSamples := func(d *decode.D, name string, segs []segment) {
+		d.SeekAbs(segs[0].start * sampleBits)
+		d.FieldRawLen(name, (segs[len(segs)-1].stop-segs[0].start)*sampleBits)
+	}
+	// MSB first bits as a field covering their samples
+	fieldBits := func(d *decode.D, name string, segs []segment, sms ...scalar.UintMapper) uint64 {
+		var v uint64
+		for _, s := range segs {
+			v <<= 1
+			if s.value == 1 {
+				v |= 1
+			}
+		}
+		d.SeekAbs(segs[0].start * sampleBits)
+		return d.FieldUintFn(name, func(d *decode.D) uint64 {
+			d.SeekAbs(segs[len(segs)-1].stop * sampleBits)
+			return v
+		}, sms...)
+	}
+	// acknowledge is SDA pulled low
+	fieldAck := func(d *decode.D, s segment) {
+		d.SeekAbs(s.start * sampleBits)
+		d.FieldBoolFn("ack", func(d *decode.D) bool {
+			d.SeekAbs(s.stop * sampleBits)
+			return s.value == 0
+		})
+	}
+
+	var trailingIdle []segment
+	if last := segs[len(segs)-1]; last.kind == segmentIdle {
+		trailingIdle = segs[len(segs)-1:]
+		segs = segs[:len(segs)-1]
+	}
+
+	i := 0
+	d.FieldArray("transactions", func(d *decode.D) {
+		for i < len(segs) {
+			transactionStart := i
+			d.FieldStruct("transaction", func(d *decode.D) {
+				if segs[i].kind == segmentIdle {
+					fieldSamples(d, "bus_idle", segs[i:i+1])
+					i++
+				}
+				d.FieldArray("messages", func(d *decode.D) {
+					for i < len(segs) && segs[i].kind == segmentStart {
+						startSeg := segs[i : i+1]
+						i++
+						bitsStart := i
+						for i < len(segs) && segs[i].kind == segmentBit {
+							i++
+						}
+						bits := segs[bitsStart:i]
+
+						d.FieldStruct("message", func(d *decode.D) {
+							fieldSamples(d, "start", startSeg)
+							if len(bits) < 9 {
+								if len(bits) > 0 {
+									fieldSamples(d, "incomplete", bits)
+								}
+								return
+							}
+							fieldBits(d, "address", bits[0:7], addressNames, scalar.UintHex)
+							fieldBits(d, "direction", bits[7:8], directionNames)
+							fieldAck(d, bits[8])
+
+							var payload []byte
+							j := 9
+							d.FieldArray("data", func(d *decode.D) {
+								for ; j+9 <= len(bits); j += 9 {
+									d.FieldStruct("byte", func(d *decode.D) {
+										payload = append(payload, byte(fieldBits(d, "value", bits[j:j+8], scalar.UintHex)))
+										fieldAck(d, bits[j+8])
+									})
+								}
+							})
+							if j < len(bits) {
+								fieldSamples(d, "incomplete", bits[j:])
+							}
+							if len(payload) > 0 {
+								d.FieldRootBitBuf("payload", bitio.NewBitReader(payload, -1))
+							}
+						})
+					}
+				})
+				if i < len(segs) && segs[i].kind == segmentStop {
+					fieldSamples(d, "stop", segs[i:i+1])
+					i++
+				}
+			})
+			if i == transactionStart {
+				d.Fatalf("unexpected segment at sample %d", segs[i].start)
+			}
+		}
+	})
+	if trailingIdle != nil {
+		fieldSamples(d, "bus_idle", trailingIdle)
+	}
+	d.SeekAbs(nSamples * sampleBits)
+
+	return nil
+}
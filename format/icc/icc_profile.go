@@ -4,36 +4,149 @@ package icc
 // https://www.color.org/icc32.pdf
 
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed icc_profile.md
+var iccProfileFS embed.FS
+
 func init() {
 	interp.RegisterFormat(
 		format.ICC_Profile,
 		&decode.Format{
 			Description: "International Color Consortium profile",
+			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    iccProfileDecode,
+			Extensions:  []string{"icc", "icm"},
 		})
+	interp.RegisterFS(iccProfileFS)
+}
+
+var deviceClassNames = scalar.StrMapDescription{
+	"scnr": "Input device",
+	"mntr": "Display device",
+	"prtr": "Output device",
+	"link": "DeviceLink",
+	"spac": "ColorSpace",
+	"abst": "Abstract",
+	"nmcl": "NamedColor",
+}
+
+var renderingIntentNames = scalar.UintMapSymStr{
+	0: "perceptual",
+	1: "media_relative_colorimetric",
+	2: "saturation",
+	3: "icc_absolute_colorimetric",
+}
+
+var phosphorColorantNames = scalar.UintMapSymStr{
+	0: "unknown",
+	1: "itu_r_bt_709_2",
+	2: "smpte_rp145",
+	3: "ebu_tech_3213_e",
+	4: "p22",
+	5: "p3",
+	6: "itu_r_bt_2020",
+}
+
+// s15Fixed16Number
+func fieldS15Fixed16(d *decode.D, name string) float64 {
+	return d.FieldFltFn(name, func(d *decode.D) float64 { return float64(d.S32()) / 0x10000 })
+}
+
+// u16Fixed16Number
+func fieldU16Fixed16(d *decode.D, name string) float64 {
+	return d.FieldFP32(name)
+}
+
+func fieldXYZNumber(d *decode.D) {
+	fieldS15Fixed16(d, "x")
+	fieldS15Fixed16(d, "y")
+	fieldS15Fixed16(d, "z")
 }
 
 func xyzType(_ int64, d *decode.D) {
-	d.FieldFP32("x")
-	d.FieldFP32("y")
-	d.FieldFP32("z")
+	// usually one but can be an array
+	if d.BitsLeft() == 12*8 {
+		fieldXYZNumber(d)
+		return
+	}
+	d.FieldStructArrayLoop("numbers", "number", func() bool { return d.BitsLeft() >= 12*8 }, fieldXYZNumber)
+}
+
+func curvType(_ int64, d *decode.D) {
+	count := d.FieldU32("count")
+	switch count {
+	case 0:
+		// identity response
+	case 1:
+		// u8Fixed8Number
+		d.FieldFltFn("gamma", func(d *decode.D) float64 { return float64(d.U16()) / 0x100 })
+	default:
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				d.FieldU16("entry")
+			}
+		})
+	}
+}
+
+func chrmType(_ int64, d *decode.D) {
+	numberOfChannels := d.FieldU16("number_of_channels")
+	d.FieldU16("phosphor_colorant_type", phosphorColorantNames)
+	d.FieldArray("channels", func(d *decode.D) {
+		for i := uint64(0); i < numberOfChannels; i++ {
+			d.FieldStruct("channel", func(d *decode.D) {
+				fieldU16Fixed16(d, "x")
+				fieldU16Fixed16(d, "y")
+			})
+		}
+	})
+}
+
+func sf32Type(_ int64, d *decode.D) {
+	d.FieldArray("values", func(d *decode.D) {
+		for d.BitsLeft() >= 32 {
+			fieldS15Fixed16(d, "value")
+		}
+	})
+}
+
+func sigType(_ int64, d *decode.D) {
+	d.FieldUTF8NullFixedLen("value", 4, scalar.ActualTrimSpace)
 }
 
 func textType(_ int64, d *decode.D) {
 	d.FieldUTF8NullFixedLen("text", int(d.BitsLeft()/8))
 }
 
+// number of parameters per function type
+var paraFunctionParameters = map[uint64][]string{
+	0: {"g"},
+	1: {"g", "a", "b"},
+	2: {"g", "a", "b", "c"},
+	3: {"g", "a", "b", "c", "d"},
+	4: {"g", "a", "b", "c", "d", "e", "f"},
+}
+
 func paraType(_ int64, d *decode.D) {
-	d.FieldU32("reserved0")
-	d.FieldU16("function_type")
+	functionType := d.FieldU16("function_type")
 	d.FieldU16("reserved1")
-	d.FieldRawLen("parameters", d.BitsLeft())
+	names, ok := paraFunctionParameters[functionType]
+	if !ok {
+		d.FieldRawLen("parameters", d.BitsLeft())
+		return
+	}
+	d.FieldStruct("parameters", func(d *decode.D) {
+		for _, name := range names {
+			fieldS15Fixed16(d, name)
+		}
+	})
 }
 
 func descType(_ int64, d *decode.D) {
@@ -75,6 +188,10 @@ var typeToDecode = map[string]func(tagStart int64, d *decode.D){
 	"para": paraType,
 	"desc": descType,
 	"mluc": multiLocalizedUnicodeType,
+	"curv": curvType,
+	"chrm": chrmType,
+	"sf32": sf32Type,
+	"sig":  sigType,
 }
 
 func decodeBCDU8(d *decode.D) uint64 {
@@ -115,7 +232,7 @@ func iccProfileDecode(d *decode.D) any {
 			d.FieldUintFn("version_major", decodeBCDU8)
 			d.FieldUintFn("version_minor", decodeBCDU8)
 			d.FieldU16("version_reserved")
-			d.FieldUTF8NullFixedLen("device_class_signature", 4, scalar.ActualTrimSpace)
+			d.FieldUTF8NullFixedLen("device_class_signature", 4, scalar.ActualTrimSpace, deviceClassNames)
 			d.FieldUTF8NullFixedLen("color_space", 4, scalar.ActualTrimSpace)
 			d.FieldUTF8NullFixedLen("connection_space", 4, scalar.ActualTrimSpace)
 			d.FieldStruct("timestamp", func(d *decode.D) {
@@ -127,16 +244,16 @@ func iccProfileDecode(d *decode.D) any {
 				d.FieldU16("seconds")
 
 			})
-			d.FieldUTF8NullFixedLen("file_signature", 4, scalar.ActualTrimSpace)
+			d.FieldUTF8NullFixedLen("file_signature", 4, scalar.ActualTrimSpace, d.StrAssert("acsp"))
 			d.FieldUTF8NullFixedLen("primary_platform", 4, scalar.ActualTrimSpace)
 			d.FieldU32("flags")
 			d.FieldUTF8NullFixedLen("device_manufacturer", 4, scalar.ActualTrimSpace)
 			d.FieldUTF8NullFixedLen("device_model", 4, scalar.ActualTrimSpace)
 			d.FieldUTF8NullFixedLen("device_attribute", 8, scalar.ActualTrimSpace)
-			d.FieldUTF8NullFixedLen("render_intent", 4, scalar.ActualTrimSpace)
-			d.FieldUTF8NullFixedLen("xyz_illuminant", 12, scalar.ActualTrimSpace)
+			d.FieldU32("render_intent", renderingIntentNames)
+			d.FieldStruct("xyz_illuminant", fieldXYZNumber)
 			d.FieldUTF8NullFixedLen("profile_creator_signature", 4, scalar.ActualTrimSpace)
-			d.FieldUTF8NullFixedLen("profile_id", 16, scalar.ActualTrimSpace)
+			d.FieldRawLen("profile_id", 16*8)
 			d.FieldRawLen("reserved", 28*8, d.BitBufIsZero())
 		})
 
@@ -493,6 +493,7 @@ var IPv4ProtocolMap = scalar.UintMap{
 
 const (
 	UDPPortDomain = 53
+	UDPPortHTTPS  = 443
 	UDPPortMDNS   = 5353
 )
 
@@ -837,7 +838,7 @@ var UDPPortMap = scalar.UintMap{
 	440:           {Sym: "sgcp", Description: "sgcp"},
 	441:           {Sym: "decvms-sysmgt", Description: "decvms-sysmgt"},
 	442:           {Sym: "cvc_hostd", Description: "cvc_hostd"},
-	443:           {Sym: "https", Description: "http protocol over TLS/SSL"},
+	UDPPortHTTPS:  {Sym: "https", Description: "http protocol over TLS/SSL"},
 	444:           {Sym: "snpp", Description: "Simple Network Paging Protocol"},
 	445:           {Sym: "microsoft-ds", Description: "Microsoft-DS"},
 	446:           {Sym: "ddm-rdb", Description: "DDM-RDB"},
@@ -68,7 +68,7 @@ func decodeIPv4(d *decode.D) any {
 	d.FieldU2("ecn")
 	totalLength := d.FieldU16("total_length")
 	d.FieldU16("identification")
-	d.FieldU1("reserved")
+	d.FieldUintReserved("reserved", 1)
 	d.FieldBool("dont_fragment")
 	moreFragments := d.FieldBool("more_fragments")
 	fragmentOffset := d.FieldU13("fragment_offset")
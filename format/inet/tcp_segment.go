@@ -50,7 +50,7 @@ func decodeTCP(d *decode.D) any {
 	d.FieldU32("sequence_number")
 	d.FieldU32("acknowledgment_number")
 	dataOffset := d.FieldU4("data_offset")
-	d.FieldU3("reserved")
+	d.FieldUintReserved("reserved", 3)
 	d.FieldBool("ns")
 	d.FieldBool("cwr")
 	d.FieldBool("ece")
@@ -0,0 +1,492 @@
+package java
+
+// https://docs.oracle.com/javase/specs/jvms/se21/html/jvms-4.html
+
+import (
+	"embed"
+	"fmt"
+	"math"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed java_class.md
+var javaClassFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Java_Class,
+		&decode.Format{
+			Description: "Java class file",
+			Extensions:  []string{"class"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    javaClassDecode,
+		})
+	interp.RegisterFS(javaClassFS)
+}
+
+const classMagic = 0xcafe_babe
+
+// first version is JDK 1.0.2/1.1, later major versions are one per java release
+const (
+	majorVersionFirst = 45
+	majorVersionMax   = 100
+)
+
+var majorVersionNames = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	switch {
+	case s.Actual < majorVersionFirst:
+	case s.Actual <= 48:
+		s.Description = fmt.Sprintf("Java 1.%d", s.Actual-44)
+	default:
+		s.Description = fmt.Sprintf("Java %d", s.Actual-44)
+	}
+	return s, nil
+})
+
+const (
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+var constantTagNames = scalar.UintMapSymStr{
+	constantUtf8:               "utf8",
+	constantInteger:            "integer",
+	constantFloat:              "float",
+	constantLong:               "long",
+	constantDouble:             "double",
+	constantClass:              "class",
+	constantString:             "string",
+	constantFieldref:           "fieldref",
+	constantMethodref:          "methodref",
+	constantInterfaceMethodref: "interface_methodref",
+	constantNameAndType:        "name_and_type",
+	constantMethodHandle:       "method_handle",
+	constantMethodType:         "method_type",
+	constantDynamic:            "dynamic",
+	constantInvokeDynamic:      "invoke_dynamic",
+	constantModule:             "module",
+	constantPackage:            "package",
+}
+
+var referenceKindNames = scalar.UintMapSymStr{
+	1: "get_field",
+	2: "get_static",
+	3: "put_field",
+	4: "put_static",
+	5: "invoke_virtual",
+	6: "invoke_static",
+	7: "invoke_special",
+	8: "new_invoke_special",
+	9: "invoke_interface",
+}
+
+// access flags from most significant bit, empty is unused
+var classAccessFlags = [16]string{
+	"module", "enum", "annotation", "synthetic", "", "abstract", "interface", "",
+	"", "", "super", "final", "", "", "", "public",
+}
+
+var fieldAccessFlags = [16]string{
+	"", "enum", "", "synthetic", "", "", "", "",
+	"transient", "volatile", "", "final", "static", "protected", "private", "public",
+}
+
+var methodAccessFlags = [16]string{
+	"", "", "", "synthetic", "strict", "abstract", "", "native",
+	"varargs", "bridge", "synchronized", "final", "static", "protected", "private", "public",
+}
+
+var innerClassAccessFlags = [16]string{
+	"", "enum", "annotation", "synthetic", "", "abstract", "interface", "",
+	"", "", "", "final", "static", "protected", "private", "public",
+}
+
+type constant struct {
+	tag uint64
+	a   uint64
+	b   uint64
+	str string
+}
+
+// constantPool is indexed from 1, long and double takes two entries
+type constantPool []constant
+
+// max depth when resolving, guards against reference cycles
+const maxResolveDepth = 5
+
+func (cp constantPool) resolve(i uint64, depth int) string {
+	if i == 0 || i >= uint64(len(cp)) || depth > maxResolveDepth {
+		return ""
+	}
+	c := cp[i]
+	switch c.tag {
+	case constantUtf8:
+		return c.str
+	case constantInteger:
+		return fmt.Sprintf("%d", int32(c.a))
+	case constantFloat:
+		return fmt.Sprintf("%v", math.Float32frombits(uint32(c.a)))
+	case constantLong:
+		return fmt.Sprintf("%d", int64(c.a<<32|c.b))
+	case constantDouble:
+		return fmt.Sprintf("%v", math.Float64frombits(c.a<<32|c.b))
+	case constantClass,
+		constantString,
+		constantMethodType,
+		constantModule,
+		constantPackage:
+		return cp.resolve(c.a, depth+1)
+	case constantFieldref,
+		constantMethodref,
+		constantInterfaceMethodref:
+		return cp.resolve(c.a, depth+1) + "." + cp.resolve(c.b, depth+1)
+	case constantNameAndType:
+		return cp.resolve(c.a, depth+1) + ":" + cp.resolve(c.b, depth+1)
+	case constantMethodHandle:
+		return cp.resolve(c.b, depth+1)
+	case constantDynamic,
+		constantInvokeDynamic:
+		return fmt.Sprintf("#%d:%s", c.a, cp.resolve(c.b, depth+1))
+	default:
+		return ""
+	}
+}
+
+func (cp constantPool) tag(i uint64) uint64 {
+	if i >= uint64(len(cp)) {
+		return 0
+	}
+	return cp[i].tag
+}
+
+// MapUint resolves constant pool index to a string
+func (cp constantPool) MapUint(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual != 0 && s.Actual < uint64(len(cp)) {
+		s.Sym = cp.resolve(s.Actual, 0)
+	}
+	return s, nil
+}
+
+// modified UTF-8, null is two bytes and supplementary characters are surrogate pairs
+func decodeModifiedUTF8(b []byte) string {
+	var r []rune
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c&0x80 == 0:
+			r = append(r, rune(c))
+			i++
+		case c&0xe0 == 0xc0 && i+1 < len(b):
+			r = append(r, rune(c&0x1f)<<6|rune(b[i+1]&0x3f))
+			i += 2
+		case c&0xf0 == 0xe0 && i+2 < len(b):
+			r = append(r, rune(c&0x0f)<<12|rune(b[i+1]&0x3f)<<6|rune(b[i+2]&0x3f))
+			i += 3
+		default:
+			r = append(r, 0xfffd)
+			i++
+		}
+	}
+	for i := 0; i+1 < len(r); i++ {
+		if r[i] >= 0xd800 && r[i] < 0xdc00 && r[i+1] >= 0xdc00 && r[i+1] < 0xe000 {
+			r[i] = 0x10000 + (r[i]-0xd800)<<10 + (r[i+1] - 0xdc00)
+			r = append(r[:i+1], r[i+2:]...)
+		}
+	}
+	return string(r)
+}
+
+func readConstantPool(d *decode.D, count uint64) constantPool {
+	cp := make(constantPool, count)
+	for i := uint64(1); i < count; i++ {
+		c := constant{tag: d.U8()}
+		switch c.tag {
+		case constantUtf8:
+			c.str = decodeModifiedUTF8(d.BytesLen(int(d.U16())))
+		case constantInteger,
+			constantFloat:
+			c.a = d.U32()
+		case constantLong,
+			constantDouble:
+			c.a = d.U32()
+			c.b = d.U32()
+		case constantClass,
+			constantString,
+			constantMethodType,
+			constantModule,
+			constantPackage:
+			c.a = d.U16()
+		case constantFieldref,
+			constantMethodref,
+			constantInterfaceMethodref,
+			constantNameAndType,
+			constantDynamic,
+			constantInvokeDynamic:
+			c.a = d.U16()
+			c.b = d.U16()
+		case constantMethodHandle:
+			c.a = d.U8()
+			c.b = d.U16()
+		default:
+			d.Fatalf("unknown constant pool tag %d at index %d", c.tag, i)
+		}
+		cp[i] = c
+		if c.tag == constantLong || c.tag == constantDouble {
+			i++
+		}
+	}
+	return cp
+}
+
+func decodeConstantPool(d *decode.D, cp constantPool) {
+	for i := uint64(1); i < uint64(len(cp)); i++ {
+		tag := cp[i].tag
+		d.FieldStruct("constant", func(d *decode.D) {
+			d.FieldValueUint("index", i)
+			d.FieldU8("tag", constantTagNames)
+			switch tag {
+			case constantUtf8:
+				length := d.FieldU16("length")
+				d.FieldStrFn("value", func(d *decode.D) string { return decodeModifiedUTF8(d.BytesLen(int(length))) })
+			case constantInteger:
+				d.FieldS32("value")
+			case constantFloat:
+				d.FieldF32("value")
+			case constantLong:
+				d.FieldS64("value")
+			case constantDouble:
+				d.FieldF64("value")
+			case constantClass,
+				constantModule,
+				constantPackage:
+				d.FieldU16("name_index", cp)
+			case constantString:
+				d.FieldU16("string_index", cp)
+			case constantMethodType:
+				d.FieldU16("descriptor_index", cp)
+			case constantFieldref,
+				constantMethodref,
+				constantInterfaceMethodref:
+				d.FieldU16("class_index", cp)
+				d.FieldU16("name_and_type_index", cp)
+			case constantNameAndType:
+				d.FieldU16("name_index", cp)
+				d.FieldU16("descriptor_index", cp)
+			case constantMethodHandle:
+				d.FieldU8("reference_kind", referenceKindNames)
+				d.FieldU16("reference_index", cp)
+			case constantDynamic,
+				constantInvokeDynamic:
+				d.FieldU16("bootstrap_method_attr_index")
+				d.FieldU16("name_and_type_index", cp)
+			}
+		})
+		if tag == constantLong || tag == constantDouble {
+			i++
+		}
+	}
+}
+
+func decodeAccessFlags(d *decode.D, flags [16]string) {
+	d.FieldStruct("access_flags", func(d *decode.D) {
+		unused := 0
+		for i := 0; i < len(flags); {
+			if flags[i] != "" {
+				d.FieldBool(flags[i])
+				i++
+				continue
+			}
+			n := 1
+			for i+n < len(flags) && flags[i+n] == "" {
+				n++
+			}
+			d.FieldU(fmt.Sprintf("unused%d", unused), n)
+			unused++
+			i += n
+		}
+	})
+}
+
+func decodeAttributes(d *decode.D, cp constantPool) {
+	count := d.FieldU16("attributes_count")
+	d.FieldArray("attributes", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("attribute", func(d *decode.D) {
+				nameIndex := d.FieldU16("attribute_name_index", cp)
+				name := cp.resolve(nameIndex, 0)
+				if cp.tag(nameIndex) != constantUtf8 {
+					name = ""
+				}
+				length := d.FieldU32("attribute_length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					decodeAttribute(d, cp, name)
+				})
+			})
+		}
+	})
+}
+
+func decodeAttribute(d *decode.D, cp constantPool, name string) {
+	switch name {
+	case "ConstantValue":
+		d.FieldU16("constantvalue_index", cp)
+	case "Code":
+		d.FieldU16("max_stack")
+		d.FieldU16("max_locals")
+		codeLength := d.FieldU32("code_length")
+		d.FieldRawLen("code", int64(codeLength)*8)
+		exceptionTableLength := d.FieldU16("exception_table_length")
+		d.FieldArray("exception_table", func(d *decode.D) {
+			for i := uint64(0); i < exceptionTableLength; i++ {
+				d.FieldStruct("exception", func(d *decode.D) {
+					d.FieldU16("start_pc")
+					d.FieldU16("end_pc")
+					d.FieldU16("handler_pc")
+					d.FieldU16("catch_type", cp)
+				})
+			}
+		})
+		decodeAttributes(d, cp)
+	case "Exceptions":
+		n := d.FieldU16("number_of_exceptions")
+		d.FieldArray("exception_index_table", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldU16("exception_index", cp)
+			}
+		})
+	case "InnerClasses":
+		n := d.FieldU16("number_of_classes")
+		d.FieldArray("classes", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldStruct("class", func(d *decode.D) {
+					d.FieldU16("inner_class_info_index", cp)
+					d.FieldU16("outer_class_info_index", cp)
+					d.FieldU16("inner_name_index", cp)
+					decodeAccessFlags(d, innerClassAccessFlags)
+				})
+			}
+		})
+	case "EnclosingMethod":
+		d.FieldU16("class_index", cp)
+		d.FieldU16("method_index", cp)
+	case "Signature":
+		d.FieldU16("signature_index", cp)
+	case "SourceFile":
+		d.FieldU16("sourcefile_index", cp)
+	case "LineNumberTable":
+		n := d.FieldU16("line_number_table_length")
+		d.FieldArray("line_number_table", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldStruct("line_number", func(d *decode.D) {
+					d.FieldU16("start_pc")
+					d.FieldU16("line_number")
+				})
+			}
+		})
+	case "LocalVariableTable", "LocalVariableTypeTable":
+		n := d.FieldU16("local_variable_table_length")
+		d.FieldArray("local_variable_table", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldStruct("local_variable", func(d *decode.D) {
+					d.FieldU16("start_pc")
+					d.FieldU16("length")
+					d.FieldU16("name_index", cp)
+					if name == "LocalVariableTable" {
+						d.FieldU16("descriptor_index", cp)
+					} else {
+						d.FieldU16("signature_index", cp)
+					}
+					d.FieldU16("index")
+				})
+			}
+		})
+	case "BootstrapMethods":
+		n := d.FieldU16("num_bootstrap_methods")
+		d.FieldArray("bootstrap_methods", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldStruct("bootstrap_method", func(d *decode.D) {
+					d.FieldU16("bootstrap_method_ref", cp)
+					numArguments := d.FieldU16("num_bootstrap_arguments")
+					d.FieldArray("bootstrap_arguments", func(d *decode.D) {
+						for j := uint64(0); j < numArguments; j++ {
+							d.FieldU16("bootstrap_argument", cp)
+						}
+					})
+				})
+			}
+		})
+	case "NestHost":
+		d.FieldU16("host_class_index", cp)
+	case "NestMembers", "PermittedSubclasses":
+		n := d.FieldU16("number_of_classes")
+		d.FieldArray("classes", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldU16("class", cp)
+			}
+		})
+	default:
+		d.FieldRawLen("info", d.BitsLeft())
+	}
+}
+
+func decodeMembers(d *decode.D, cp constantPool, name string, flags [16]string) {
+	count := d.FieldU16(name + "s_count")
+	d.FieldArray(name+"s", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct(name, func(d *decode.D) {
+				decodeAccessFlags(d, flags)
+				d.FieldU16("name_index", cp)
+				d.FieldU16("descriptor_index", cp)
+				decodeAttributes(d, cp)
+			})
+		}
+	})
+}
+
+func javaClassDecode(d *decode.D) any {
+	d.FieldU32("magic", d.UintAssert(classMagic), scalar.UintHex)
+	d.FieldU16("minor_version")
+	// also makes sure to not overlap with mach-o fat binaries that has same magic
+	d.FieldU16("major_version", d.UintAssertRange(majorVersionFirst, majorVersionMax), majorVersionNames)
+	count := d.FieldU16("constant_pool_count")
+
+	// first pass to be able to resolve forward references
+	poolPos := d.Pos()
+	cp := readConstantPool(d, count)
+	d.SeekAbs(poolPos)
+
+	d.FieldArray("constant_pool", func(d *decode.D) { decodeConstantPool(d, cp) })
+	decodeAccessFlags(d, classAccessFlags)
+	d.FieldU16("this_class", cp)
+	d.FieldU16("super_class", cp)
+	interfacesCount := d.FieldU16("interfaces_count")
+	d.FieldArray("interfaces", func(d *decode.D) {
+		for i := uint64(0); i < interfacesCount; i++ {
+			d.FieldU16("interface", cp)
+		}
+	})
+	decodeMembers(d, cp, "field", fieldAccessFlags)
+	decodeMembers(d, cp, "method", methodAccessFlags)
+	decodeAttributes(d, cp)
+
+	return nil
+}
@@ -0,0 +1,198 @@
+#!/usr/bin/env python3
+# generates a class file similar to what javac would produce for:
+#
+# public class Hello implements Runnable {
+#     static final long BIG = 1099511627776L;
+#     static final double PI = 3.14;
+#     public static void main(String[] args) throws Exception {
+#         System.out.println("Hello");
+#         Runnable r = () -> {};
+#     }
+#     public void run() {}
+# }
+import pathlib
+import struct
+
+here = pathlib.Path(__file__).parent
+
+
+class Pool:
+    def __init__(self):
+        self.entries = []
+        self.index = {}
+
+    def add(self, key, b, slots=1):
+        if key in self.index:
+            return self.index[key]
+        i = sum(s for _, s in self.entries) + 1
+        self.entries.append((b, slots))
+        self.index[key] = i
+        return i
+
+    def utf8(self, s):
+        b = s.encode("utf-8")
+        return self.add(("utf8", s), struct.pack(">BH", 1, len(b)) + b)
+
+    def integer(self, v):
+        return self.add(("int", v), struct.pack(">Bi", 3, v))
+
+    def float(self, v):
+        return self.add(("float", v), struct.pack(">Bf", 4, v))
+
+    def long(self, v):
+        return self.add(("long", v), struct.pack(">Bq", 5, v), 2)
+
+    def double(self, v):
+        return self.add(("double", v), struct.pack(">Bd", 6, v), 2)
+
+    def cls(self, name):
+        return self.add(("class", name), struct.pack(">BH", 7, self.utf8(name)))
+
+    def string(self, s):
+        return self.add(("string", s), struct.pack(">BH", 8, self.utf8(s)))
+
+    def name_and_type(self, name, desc):
+        return self.add(("nat", name, desc), struct.pack(">BHH", 12, self.utf8(name), self.utf8(desc)))
+
+    def ref(self, tag, cls, name, desc):
+        return self.add(("ref", tag, cls, name, desc), struct.pack(">BHH", tag, self.cls(cls), self.name_and_type(name, desc)))
+
+    def method_handle(self, kind, tag, cls, name, desc):
+        return self.add(("mh", kind, cls, name, desc), struct.pack(">BBH", 15, kind, self.ref(tag, cls, name, desc)))
+
+    def method_type(self, desc):
+        return self.add(("mt", desc), struct.pack(">BH", 16, self.utf8(desc)))
+
+    def invoke_dynamic(self, bsm, name, desc):
+        return self.add(("indy", bsm, name, desc), struct.pack(">BHH", 18, bsm, self.name_and_type(name, desc)))
+
+    def bytes(self):
+        return struct.pack(">H", sum(s for _, s in self.entries) + 1) + b"".join(b for b, _ in self.entries)
+
+
+cp = Pool()
+
+
+def attribute(name, data):
+    return struct.pack(">HI", cp.utf8(name), len(data)) + data
+
+
+def attributes(attrs):
+    return struct.pack(">H", len(attrs)) + b"".join(attrs)
+
+
+def code(max_stack, max_locals, insns, exceptions, attrs):
+    return attribute(
+        "Code",
+        struct.pack(">HHI", max_stack, max_locals, len(insns))
+        + insns
+        + struct.pack(">H", len(exceptions))
+        + b"".join(struct.pack(">HHHH", *e) for e in exceptions)
+        + attributes(attrs),
+    )
+
+
+def line_numbers(lines):
+    return attribute("LineNumberTable", struct.pack(">H", len(lines)) + b"".join(struct.pack(">HH", *l) for l in lines))
+
+
+def member(flags, name, desc, attrs):
+    return struct.pack(">HHH", flags, cp.utf8(name), cp.utf8(desc)) + attributes(attrs)
+
+
+object_init = cp.ref(10, "java/lang/Object", "<init>", "()V")
+system_out = cp.ref(9, "java/lang/System", "out", "Ljava/io/PrintStream;")
+hello = cp.string("Hello")
+println = cp.ref(10, "java/io/PrintStream", "println", "(Ljava/lang/String;)V")
+metafactory = cp.method_handle(
+    6,
+    10,
+    "java/lang/invoke/LambdaMetafactory",
+    "metafactory",
+    "(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/invoke/MethodType;"
+    "Ljava/lang/invoke/MethodType;Ljava/lang/invoke/MethodHandle;Ljava/lang/invoke/MethodType;)"
+    "Ljava/lang/invoke/CallSite;",
+)
+run_type = cp.method_type("()V")
+lambda_impl = cp.method_handle(6, 10, "Hello", "lambda$main$0", "()V")
+indy = cp.invoke_dynamic(0, "run", "()Ljava/lang/Runnable;")
+this_class = cp.cls("Hello")
+super_class = cp.cls("java/lang/Object")
+runnable = cp.cls("java/lang/Runnable")
+exception = cp.cls("java/lang/Exception")
+big = cp.long(1099511627776)
+pi = cp.double(3.14)
+answer = cp.integer(-42)
+half = cp.float(0.5)
+
+fields = [
+    member(0x0018, "BIG", "J", [attribute("ConstantValue", struct.pack(">H", big))]),
+    member(0x0018, "PI", "D", [attribute("ConstantValue", struct.pack(">H", pi))]),
+    member(0x001A, "ANSWER", "I", [attribute("ConstantValue", struct.pack(">H", answer))]),
+    member(0x0002, "half", "F", []),
+]
+
+methods = [
+    member(
+        0x0001,
+        "<init>",
+        "()V",
+        [code(1, 1, bytes([0x2A, 0xB7]) + struct.pack(">H", object_init) + bytes([0xB1]), [], [line_numbers([(0, 1)])])],
+    ),
+    member(
+        0x0009,
+        "main",
+        "([Ljava/lang/String;)V",
+        [
+            code(
+                2,
+                2,
+                bytes([0xB2])
+                + struct.pack(">H", system_out)
+                + bytes([0x12, hello, 0xB6])
+                + struct.pack(">H", println)
+                + bytes([0xBA])
+                + struct.pack(">HH", indy, 0)
+                + bytes([0x4C, 0xB1]),
+                [(0, 8, 16, exception)],
+                [line_numbers([(0, 5), (8, 6), (14, 7)])],
+            ),
+            attribute("Exceptions", struct.pack(">HH", 1, exception)),
+        ],
+    ),
+    member(0x0001, "run", "()V", [code(0, 1, bytes([0xB1]), [], [line_numbers([(0, 9)])])]),
+    member(0x100A, "lambda$main$0", "()V", [code(0, 0, bytes([0xB1]), [], [line_numbers([(0, 6)])])]),
+]
+
+class_attrs = [
+    attribute("SourceFile", struct.pack(">H", cp.utf8("Hello.java"))),
+    attribute(
+        "InnerClasses",
+        struct.pack(
+            ">HHHHH",
+            1,
+            cp.cls("java/lang/invoke/MethodHandles$Lookup"),
+            cp.cls("java/lang/invoke/MethodHandles"),
+            cp.utf8("Lookup"),
+            0x0019,
+        ),
+    ),
+    attribute(
+        "BootstrapMethods",
+        struct.pack(">HHHHHH", 1, metafactory, 3, run_type, lambda_impl, run_type),
+    ),
+    attribute("Custom", b"\x01\x02\x03"),
+]
+
+# constant pool has to be complete before it's written
+body = (
+    struct.pack(">HHH", 0x0021, this_class, super_class)
+    + struct.pack(">HH", 1, runnable)
+    + struct.pack(">H", len(fields))
+    + b"".join(fields)
+    + struct.pack(">H", len(methods))
+    + b"".join(methods)
+    + attributes(class_attrs)
+)
+
+(here / "Hello.class").write_bytes(struct.pack(">IHH", 0xCAFEBABE, 0, 52) + cp.bytes() + body)
@@ -22,6 +22,8 @@ func init() {
 		format.JPEG,
 		&decode.Format{
 			Description: "Joint Photographic Experts Group file",
+			Extensions:  []string{"jpg", "jpeg"},
+			MIMETypes:   []string{"image/jpeg"},
 			Groups:      []*decode.Group{format.Probe, format.Image},
 			DecodeFn:    jpegDecode,
 			Dependencies: []decode.Dependency{
@@ -24,6 +24,8 @@ func init() {
 		format.JSON,
 		&decode.Format{
 			Description: "JavaScript Object Notation",
+			Extensions:  []string{"json"},
+			MIMETypes:   []string{"application/json"},
 			ProbeOrder:  format.ProbeOrderTextJSON,
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeJSON,
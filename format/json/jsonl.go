@@ -19,6 +19,8 @@ func init() {
 		format.JSONL,
 		&decode.Format{
 			Description: "JavaScript Object Notation Lines",
+			Extensions:  []string{"jsonl", "ndjson"},
+			MIMETypes:   []string{"application/jsonl"},
 			ProbeOrder:  format.ProbeOrderTextFuzzy,
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeJSONL,
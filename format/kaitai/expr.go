@@ -0,0 +1,148 @@
+package kaitai
+
+// Evaluates a small subset of Kaitai Struct expressions, integer literals,
+// references to integer attributes and + - * / % with parentheses.
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type exprParser struct {
+	s   string
+	pos int
+	env map[string]int64
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *exprParser) term() (int64, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("expected )")
+		}
+		p.pos++
+		return v, nil
+	case c == '-':
+		p.pos++
+		v, err := p.term()
+		return -v, err
+	case c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.s) && (isIdentRune(rune(p.s[p.pos]))) {
+			p.pos++
+		}
+		return strconv.ParseInt(p.s[start:p.pos], 0, 64)
+	case isIdentRune(rune(c)):
+		start := p.pos
+		for p.pos < len(p.s) && isIdentRune(rune(p.s[p.pos])) {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		v, ok := p.env[name]
+		if !ok {
+			return 0, fmt.Errorf("%s: not a previous integer attribute", name)
+		}
+		return v, nil
+	default:
+		return 0, fmt.Errorf("unexpected %q", string(c))
+	}
+}
+
+func (p *exprParser) mul() (int64, error) {
+	l, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			l *= r
+		default:
+			if r == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			if op == '/' {
+				l /= r
+			} else {
+				l %= r
+			}
+		}
+	}
+}
+
+func (p *exprParser) expr() (int64, error) {
+	l, err := p.mul()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.mul()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			l += r
+		} else {
+			l -= r
+		}
+	}
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// evalExpr evaluates v that is an integer or an expression string
+func evalExpr(v any, env map[string]int64) (int64, error) {
+	if n, ok := v.(int); ok {
+		return int64(n), nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("expected integer or expression got %T", v)
+	}
+	p := &exprParser{s: s, env: env}
+	n, err := p.expr()
+	if err != nil {
+		return 0, fmt.Errorf("%q: %w", s, err)
+	}
+	if p.peek() != 0 {
+		return 0, fmt.Errorf("%q: unexpected %q", s, p.s[p.pos:])
+	}
+	return n, nil
+}
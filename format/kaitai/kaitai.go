@@ -0,0 +1,235 @@
+package kaitai
+
+// Interprets a subset of Kaitai Struct definitions
+// https://doc.kaitai.io/user_guide.html
+
+import (
+	"embed"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+//go:embed kaitai.md
+var kaitaiFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Kaitai,
+		&decode.Format{
+			Description:  "Kaitai Struct definition interpreter (subset)",
+			DecodeFn:     decodeKaitai,
+			DefaultInArg: format.Kaitai_In{},
+		})
+	interp.RegisterFS(kaitaiFS)
+}
+
+var primitiveRe = regexp.MustCompile(`^([usf])([1248])(be|le)?$`)
+
+func isUTF8(name string) bool {
+	switch strings.ToUpper(name) {
+	case "", "UTF-8", "UTF8", "ASCII":
+		return true
+	}
+	return false
+}
+
+func textEncoding(d *decode.D, name string) encoding.Encoding {
+	if isUTF8(name) {
+		return decode.UTF8BOM
+	}
+	switch strings.ToUpper(name) {
+	case "UTF-16LE":
+		return decode.UTF16LE
+	case "UTF-16BE":
+		return decode.UTF16BE
+	case "ISO-8859-1", "ISO8859-1", "LATIN1":
+		return charmap.ISO8859_1
+	default:
+		d.Fatalf("unsupported encoding %q", name)
+		panic("unreachable")
+	}
+}
+
+func decodePrimitive(d *decode.D, t *ksyType, a ksyAttr, name string, m []string, env map[string]int64) {
+	nBits := 8
+	if n, err := strconv.Atoi(m[2]); err == nil {
+		nBits = n * 8
+	}
+	endianName := m[3]
+	if endianName == "" {
+		endianName = t.endian()
+	}
+	var endian decode.Endian
+	switch endianName {
+	case "le":
+		endian = decode.LittleEndian
+	case "be":
+		endian = decode.BigEndian
+	default:
+		if nBits > 8 {
+			d.Fatalf("%s: %s: no endian", name, a.Type)
+		}
+		endian = decode.BigEndian
+	}
+
+	var enum map[int64]string
+	if a.Enum != "" {
+		enum = t.lookupEnum(a.Enum)
+		if enum == nil {
+			d.Fatalf("%s: enum %s not found", name, a.Enum)
+		}
+		if m[1] == "f" {
+			d.Fatalf("%s: enum on float", name)
+		}
+	}
+
+	switch m[1] {
+	case "u":
+		var sms []scalar.UintMapper
+		if enum != nil {
+			um := scalar.UintMapSymStr{}
+			for k, v := range enum {
+				um[uint64(k)] = v
+			}
+			sms = append(sms, um)
+		}
+		env[name] = int64(d.FieldUE(name, nBits, endian, sms...))
+	case "s":
+		var sms []scalar.SintMapper
+		if enum != nil {
+			sms = append(sms, scalar.SintMapSymStr(enum))
+		}
+		env[name] = d.FieldSE(name, nBits, endian, sms...)
+	case "f":
+		if nBits != 32 && nBits != 64 {
+			d.Fatalf("%s: %s: unsupported float size", name, a.Type)
+		}
+		d.FieldFE(name, nBits, endian)
+	}
+}
+
+func decodeAttrValue(d *decode.D, t *ksyType, a ksyAttr, name string, env map[string]int64) {
+	size := int64(-1)
+	if a.Size != nil {
+		n, err := evalExpr(a.Size, env)
+		if err != nil {
+			d.Fatalf("%s: size: %s", name, err)
+		}
+		if n < 0 {
+			d.Fatalf("%s: size: negative %d", name, n)
+		}
+		size = n
+	}
+	if a.SizeEOS {
+		size = d.BitsLeft() / 8
+	}
+
+	if a.Contents != nil {
+		d.FieldRawLen(name, int64(len(a.Contents))*8, d.AssertBitBuf(a.Contents))
+		return
+	}
+
+	encodingName := a.Encoding
+	if encodingName == "" {
+		encodingName = t.encoding()
+	}
+
+	switch a.Type {
+	case "":
+		if size == -1 {
+			d.Fatalf("%s: raw bytes without size or size-eos", name)
+		}
+		d.FieldRawLen(name, size*8)
+		return
+	case "str":
+		if size == -1 {
+			d.Fatalf("%s: str without size or size-eos", name)
+		}
+		d.FieldStr(name, int(size), textEncoding(d, encodingName))
+		return
+	case "strz":
+		if !isUTF8(encodingName) {
+			d.Fatalf("%s: strz only supports UTF-8 and ASCII", name)
+		}
+		if size != -1 {
+			d.FieldUTF8NullFixedLen(name, int(size))
+		} else {
+			d.FieldUTF8Null(name)
+		}
+		return
+	}
+
+	if m := primitiveRe.FindStringSubmatch(a.Type); m != nil {
+		decodePrimitive(d, t, a, name, m, env)
+		return
+	}
+
+	ut := t.lookupType(a.Type)
+	if ut == nil {
+		d.Fatalf("%s: type %s not found", name, a.Type)
+	}
+	if size != -1 {
+		d.FramedFn(size*8, func(d *decode.D) {
+			d.FieldStruct(name, func(d *decode.D) { decodeType(d, ut) })
+		})
+	} else {
+		d.FieldStruct(name, func(d *decode.D) { decodeType(d, ut) })
+	}
+}
+
+func decodeType(d *decode.D, t *ksyType) {
+	// integer attributes that can be referenced by later expressions
+	env := map[string]int64{}
+
+	for _, a := range t.Seq {
+		switch a.Repeat {
+		case "":
+			decodeAttrValue(d, t, a, a.ID, env)
+		case "eos":
+			d.FieldArray(a.ID, func(d *decode.D) {
+				for !d.End() {
+					p := d.Pos()
+					decodeAttrValue(d, t, a, a.ID, map[string]int64{})
+					if d.Pos() == p {
+						d.Fatalf("%s: repeat eos did not advance", a.ID)
+					}
+				}
+			})
+		case "expr":
+			n, err := evalExpr(a.RepeatExpr, env)
+			if err != nil {
+				d.Fatalf("%s: repeat-expr: %s", a.ID, err)
+			}
+			d.FieldArray(a.ID, func(d *decode.D) {
+				for i := int64(0); i < n; i++ {
+					decodeAttrValue(d, t, a, a.ID, map[string]int64{})
+				}
+			})
+		}
+	}
+}
+
+func decodeKaitai(d *decode.D) any {
+	var ki format.Kaitai_In
+	d.ArgAs(&ki)
+
+	if ki.Ksy == "" {
+		d.Fatalf("no definition, use -o ksy=@file.ksy")
+	}
+	t, err := parseKsy(ki.Ksy)
+	if err != nil {
+		d.Fatalf("ksy: %s", err)
+	}
+
+	decodeType(d, t)
+
+	return nil
+}
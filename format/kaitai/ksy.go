@@ -0,0 +1,354 @@
+package kaitai
+
+// Parses the subset of Kaitai Struct YAML that is supported
+// https://doc.kaitai.io/ksy_reference.html
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ksyMeta struct {
+	ID       string
+	Endian   string
+	Encoding string
+}
+
+type ksyAttr struct {
+	ID         string
+	Type       string
+	Size       any
+	SizeEOS    bool
+	Contents   []byte
+	Encoding   string
+	Enum       string
+	Repeat     string
+	RepeatExpr any
+}
+
+type ksyType struct {
+	Name   string
+	Parent *ksyType
+	Meta   ksyMeta
+	Seq    []ksyAttr
+	Types  map[string]*ksyType
+	Enums  map[string]map[int64]string
+}
+
+func (t *ksyType) lookupType(name string) *ksyType {
+	for s := t; s != nil; s = s.Parent {
+		if ut, ok := s.Types[name]; ok {
+			return ut
+		}
+	}
+	return nil
+}
+
+func (t *ksyType) lookupEnum(name string) map[int64]string {
+	for s := t; s != nil; s = s.Parent {
+		if e, ok := s.Enums[name]; ok {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *ksyType) endian() string {
+	for s := t; s != nil; s = s.Parent {
+		if s.Meta.Endian != "" {
+			return s.Meta.Endian
+		}
+	}
+	return ""
+}
+
+func (t *ksyType) encoding() string {
+	for s := t; s != nil; s = s.Parent {
+		if s.Meta.Encoding != "" {
+			return s.Meta.Encoding
+		}
+	}
+	return ""
+}
+
+// keys that only document and can be ignored
+var docKeys = []string{"doc", "doc-ref", "-orig-id", "-webide-representation"}
+
+func checkKeys(what string, m map[string]any, allowed ...string) error {
+	var unsupported []string
+	for k := range m {
+		if !slices.Contains(allowed, k) && !slices.Contains(docKeys, k) {
+			unsupported = append(unsupported, k)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("%s: unsupported keys: %s", what, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+func toStringMap(what string, v any) (map[string]any, error) {
+	switch v := v.(type) {
+	case nil:
+		return map[string]any{}, nil
+	case map[string]any:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("%s: expected a map got %T", what, v)
+	}
+}
+
+func getString(what string, m map[string]any, key string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %s: expected a string got %T", what, key, v)
+	}
+	return s, nil
+}
+
+func toInt64(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(v, 0, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func parseContents(what string, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []any:
+		var bs []byte
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				bs = append(bs, s...)
+				continue
+			}
+			n, ok := toInt64(e)
+			if !ok || n < 0 || n > 255 {
+				return nil, fmt.Errorf("%s: contents: invalid byte %v", what, e)
+			}
+			bs = append(bs, byte(n))
+		}
+		return bs, nil
+	default:
+		return nil, fmt.Errorf("%s: contents: expected string or array got %T", what, v)
+	}
+}
+
+func parseAttr(what string, v any) (ksyAttr, error) {
+	m, err := toStringMap(what, v)
+	if err != nil {
+		return ksyAttr{}, err
+	}
+	if err := checkKeys(what, m,
+		"id", "type", "size", "size-eos", "contents", "encoding", "enum", "repeat", "repeat-expr",
+	); err != nil {
+		return ksyAttr{}, err
+	}
+
+	var a ksyAttr
+	if a.ID, err = getString(what, m, "id"); err != nil {
+		return ksyAttr{}, err
+	}
+	if a.ID == "" {
+		return ksyAttr{}, fmt.Errorf("%s: missing id", what)
+	}
+	what = what + ": " + a.ID
+	if t, ok := m["type"]; ok {
+		if _, ok := t.(string); !ok {
+			return ksyAttr{}, fmt.Errorf("%s: type: only type names are supported, got %T", what, t)
+		}
+	}
+	if a.Type, err = getString(what, m, "type"); err != nil {
+		return ksyAttr{}, err
+	}
+	a.Size = m["size"]
+	if se, ok := m["size-eos"]; ok {
+		b, ok := se.(bool)
+		if !ok {
+			return ksyAttr{}, fmt.Errorf("%s: size-eos: expected a boolean got %T", what, se)
+		}
+		a.SizeEOS = b
+	}
+	if c, ok := m["contents"]; ok {
+		if a.Contents, err = parseContents(what, c); err != nil {
+			return ksyAttr{}, err
+		}
+	}
+	if a.Encoding, err = getString(what, m, "encoding"); err != nil {
+		return ksyAttr{}, err
+	}
+	if a.Enum, err = getString(what, m, "enum"); err != nil {
+		return ksyAttr{}, err
+	}
+	if a.Repeat, err = getString(what, m, "repeat"); err != nil {
+		return ksyAttr{}, err
+	}
+	switch a.Repeat {
+	case "", "eos":
+	case "expr":
+		a.RepeatExpr = m["repeat-expr"]
+		if a.RepeatExpr == nil {
+			return ksyAttr{}, fmt.Errorf("%s: repeat expr without repeat-expr", what)
+		}
+	default:
+		return ksyAttr{}, fmt.Errorf("%s: repeat: unsupported %q", what, a.Repeat)
+	}
+
+	return a, nil
+}
+
+func parseEnum(what string, v any) (map[int64]string, error) {
+	e := map[int64]string{}
+	add := func(k any, v any) error {
+		n, ok := toInt64(k)
+		if !ok {
+			return fmt.Errorf("%s: invalid enum value %v", what, k)
+		}
+		switch v := v.(type) {
+		case string:
+			e[n] = v
+		case map[string]any:
+			id, err := getString(what, v, "id")
+			if err != nil {
+				return err
+			}
+			e[n] = id
+		default:
+			return fmt.Errorf("%s: %v: expected a string or map got %T", what, k, v)
+		}
+		return nil
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, ev := range v {
+			if err := add(k, ev); err != nil {
+				return nil, err
+			}
+		}
+	case map[any]any:
+		for k, ev := range v {
+			if err := add(k, ev); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s: expected a map got %T", what, v)
+	}
+
+	return e, nil
+}
+
+func parseType(name string, parent *ksyType, v any) (*ksyType, error) {
+	m, err := toStringMap(name, v)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeys(name, m, "meta", "seq", "types", "enums"); err != nil {
+		return nil, err
+	}
+
+	t := &ksyType{
+		Name:   name,
+		Parent: parent,
+		Types:  map[string]*ksyType{},
+		Enums:  map[string]map[int64]string{},
+	}
+
+	if mv, ok := m["meta"]; ok {
+		mm, err := toStringMap(name+": meta", mv)
+		if err != nil {
+			return nil, err
+		}
+		// other meta keys like title, license etc are only informative
+		if t.Meta.ID, err = getString(name+": meta", mm, "id"); err != nil {
+			return nil, err
+		}
+		if t.Meta.Endian, err = getString(name+": meta", mm, "endian"); err != nil {
+			return nil, err
+		}
+		switch t.Meta.Endian {
+		case "", "le", "be":
+		default:
+			return nil, fmt.Errorf("%s: meta: endian: unsupported %q", name, t.Meta.Endian)
+		}
+		if t.Meta.Encoding, err = getString(name+": meta", mm, "encoding"); err != nil {
+			return nil, err
+		}
+		if _, ok := mm["imports"]; ok {
+			return nil, fmt.Errorf("%s: meta: imports is not supported", name)
+		}
+	}
+
+	if sv, ok := m["seq"]; ok {
+		seq, ok := sv.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: seq: expected an array got %T", name, sv)
+		}
+		for i, av := range seq {
+			a, err := parseAttr(fmt.Sprintf("%s: seq[%d]", name, i), av)
+			if err != nil {
+				return nil, err
+			}
+			t.Seq = append(t.Seq, a)
+		}
+	}
+
+	if tv, ok := m["types"]; ok {
+		tm, err := toStringMap(name+": types", tv)
+		if err != nil {
+			return nil, err
+		}
+		for tn, tv := range tm {
+			ut, err := parseType(tn, t, tv)
+			if err != nil {
+				return nil, err
+			}
+			t.Types[tn] = ut
+		}
+	}
+
+	if ev, ok := m["enums"]; ok {
+		em, err := toStringMap(name+": enums", ev)
+		if err != nil {
+			return nil, err
+		}
+		for en, ev := range em {
+			e, err := parseEnum(name+": enums: "+en, ev)
+			if err != nil {
+				return nil, err
+			}
+			t.Enums[en] = e
+		}
+	}
+
+	return t, nil
+}
+
+func parseKsy(s string) (*ksyType, error) {
+	var v any
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return parseType("root", nil, v)
+}
@@ -0,0 +1,228 @@
+package lz4
+
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+
+import (
+	"embed"
+	"encoding/binary"
+
+	"github.com/wader/fq/format"
+	lz4dec "github.com/wader/fq/internal/lz4"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed lz4.md
+var lz4FS embed.FS
+
+var probeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.LZ4,
+		&decode.Format{
+			Description: "LZ4 frame compression",
+			Extensions:  []string{"lz4"},
+			MIMETypes:   []string{"application/x-lz4"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    lz4Decode,
+			DefaultInArg: format.LZ4_In{
+				Uncompress: true,
+			},
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(lz4FS)
+}
+
+var magicNames = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	switch {
+	case s.Actual == lz4dec.FrameMagic:
+		s.Sym = "frame"
+	case s.Actual == lz4dec.LegacyFrameMagic:
+		s.Sym = "legacy_frame"
+	case s.Actual&lz4dec.SkippableMask == lz4dec.SkippableMagic:
+		s.Sym = "skippable_frame"
+	}
+	return s, nil
+})
+
+var blockMaxSizeNames = scalar.UintMapSymUint{
+	4: 64 * 1024,
+	5: 256 * 1024,
+	6: 1024 * 1024,
+	7: 4 * 1024 * 1024,
+}
+
+func peekU32LE(d *decode.D) uint32 {
+	return binary.LittleEndian.Uint32(d.PeekBytes(4))
+}
+
+func decodeFrame(d *decode.D, li format.LZ4_In) ([]byte, bool) {
+	d.FieldU32("magic", magicNames, scalar.UintHex)
+
+	var blockChecksum bool
+	var contentSize bool
+	var contentChecksum bool
+	var dictionaryID bool
+	d.FieldStruct("frame_descriptor", func(d *decode.D) {
+		descriptorPos := d.Pos()
+		d.FieldStruct("flg", func(d *decode.D) {
+			version := d.FieldU2("version")
+			if version != 1 {
+				d.Fatalf("unsupported frame version %d", version)
+			}
+			d.FieldBool("block_independence")
+			blockChecksum = d.FieldBool("block_checksum")
+			contentSize = d.FieldBool("content_size")
+			contentChecksum = d.FieldBool("content_checksum")
+			d.FieldU1("reserved")
+			dictionaryID = d.FieldBool("dictionary_id")
+		})
+		d.FieldStruct("bd", func(d *decode.D) {
+			d.FieldU1("reserved0")
+			d.FieldU3("block_max_size", blockMaxSizeNames, scalar.UintUnit("bytes"))
+			d.FieldU4("reserved1")
+		})
+		if contentSize {
+			d.FieldU64("content_size")
+		}
+		if dictionaryID {
+			d.FieldU32("dictionary_id", scalar.UintHex)
+		}
+		sum := checksum.XXH32(d.BytesRange(descriptorPos, int(d.Pos()-descriptorPos)/8), 0)
+		d.FieldU8("header_checksum", d.UintValidate(uint64(sum>>8)&0xff), scalar.UintHex)
+	})
+
+	uncompress := li.Uncompress && !dictionaryID
+	var content []byte
+	d.FieldArray("blocks", func(d *decode.D) {
+		for {
+			if peekU32LE(d) == 0 {
+				break
+			}
+			d.FieldStruct("block", func(d *decode.D) {
+				header := d.FieldU32("header", scalar.UintHex)
+				uncompressed := header&0x8000_0000 != 0
+				size := int64(header & 0x7fff_ffff)
+				d.FieldValueBool("uncompressed", uncompressed)
+				d.FieldValueUint("size", uint64(size))
+				dataPos := d.Pos()
+				d.FieldRawLen("data", size*8)
+				if uncompress {
+					b := d.BytesRange(dataPos, int(size))
+					if uncompressed {
+						content = append(content, b...)
+					} else {
+						var err error
+						if content, err = lz4dec.DecompressBlock(content, b); err != nil {
+							d.Fatalf("decompress: %s", err)
+						}
+					}
+				}
+				if blockChecksum {
+					d.FieldU32("block_checksum", d.UintValidate(uint64(checksum.XXH32(d.BytesRange(dataPos, int(size)), 0))), scalar.UintHex)
+				}
+			})
+		}
+	})
+	d.FieldU32("end_mark", d.UintAssert(0))
+	if contentChecksum {
+		if uncompress {
+			d.FieldU32("content_checksum", d.UintValidate(uint64(checksum.XXH32(content, 0))), scalar.UintHex)
+		} else {
+			d.FieldU32("content_checksum", scalar.UintHex)
+		}
+	}
+
+	return content, uncompress
+}
+
+func decodeLegacyFrame(d *decode.D, li format.LZ4_In) ([]byte, bool) {
+	d.FieldU32("magic", magicNames, scalar.UintHex)
+
+	var content []byte
+	d.FieldArray("blocks", func(d *decode.D) {
+		for !d.End() {
+			// legacy frames have no end mark, ends at end of input or next frame
+			next := peekU32LE(d)
+			if next == lz4dec.LegacyFrameMagic || next == lz4dec.FrameMagic {
+				break
+			}
+			d.FieldStruct("block", func(d *decode.D) {
+				size := int64(d.FieldU32("size"))
+				dataPos := d.Pos()
+				d.FieldRawLen("data", size*8)
+				if li.Uncompress {
+					var err error
+					if content, err = lz4dec.DecompressBlock(content, d.BytesRange(dataPos, int(size))); err != nil {
+						d.Fatalf("decompress: %s", err)
+					}
+				}
+			})
+		}
+	})
+
+	return content, li.Uncompress
+}
+
+func lz4Decode(d *decode.D) any {
+	var li format.LZ4_In
+	d.ArgAs(&li)
+
+	d.Endian = decode.LittleEndian
+
+	frames := 0
+	var brs []bitio.ReadAtSeeker
+	d.FieldArray("frames", func(d *decode.D) {
+		for !d.End() {
+			magic := peekU32LE(d)
+			var frameFn func(d *decode.D, li format.LZ4_In) ([]byte, bool)
+			switch {
+			case magic == lz4dec.FrameMagic:
+				frameFn = decodeFrame
+			case magic == lz4dec.LegacyFrameMagic:
+				frameFn = decodeLegacyFrame
+			case magic&lz4dec.SkippableMask == lz4dec.SkippableMagic:
+				d.FieldStruct("frame", func(d *decode.D) {
+					d.FieldU32("magic", magicNames, scalar.UintHex)
+					size := d.FieldU32("frame_size")
+					d.FieldRawLen("user_data", int64(size)*8)
+				})
+			default:
+				d.Fatalf("unknown frame magic %08x", magic)
+			}
+			if frameFn != nil {
+				d.FieldStruct("frame", func(d *decode.D) {
+					if content, ok := frameFn(d, li); ok {
+						brs = append(brs, bitio.NewBitReader(content, -1))
+					}
+				})
+			}
+			frames++
+		}
+	})
+
+	if frames == 0 {
+		d.Fatalf("no frames found")
+	}
+	if len(brs) == 0 {
+		return nil
+	}
+
+	cbr, err := bitio.NewMultiReader(brs...)
+	if err != nil {
+		d.IOPanic(err, "frames", "NewMultiReader")
+	}
+	dv, _, _ := d.TryFieldFormatBitBuf("uncompressed", cbr, &probeGroup, format.Probe_In{})
+	if dv == nil {
+		d.FieldRootBitBuf("uncompressed", cbr)
+	}
+
+	return nil
+}
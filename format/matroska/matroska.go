@@ -14,6 +14,7 @@ package matroska
 import (
 	"embed"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/wader/fq/format"
@@ -56,6 +57,8 @@ func init() {
 		format.Matroska,
 		&decode.Format{
 			Description: "Matroska file",
+			Extensions:  []string{"mkv", "mka", "webm"},
+			MIMETypes:   []string{"video/x-matroska", "video/webm"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    matroskaDecode,
 			DefaultInArg: format.Matroska_In{
@@ -252,10 +255,32 @@ type block struct {
 	simple bool
 }
 
+// element start and data start as absolute bit positions
+type element struct {
+	id      ebml.ID
+	name    string
+	dataPos int64
+}
+
+// positionRef is a SeekPosition, CueClusterPosition or CueRelativePosition to be
+// resolved into the element it points to when all elements are known
+type positionRef struct {
+	d          *decode.D
+	pos        int64
+	clusterPos int64 // if >= 0 pos is relative to the data of the cluster at this position
+	validIDs   []ebml.ID
+}
+
 type decodeContext struct {
-	currentTrack *track
-	tracks       []*track
-	blocks       []block
+	currentTrack      *track
+	tracks            []*track
+	blocks            []block
+	elements          map[int64]element
+	segmentDataPos    int64
+	currentSeekID     ebml.ID
+	currentSeekRef    *positionRef
+	currentClusterPos int64
+	positionRefs      []*positionRef
 }
 
 func decodeMaster(d *decode.D, bitsLimit int64, elm *ebml.Master, unknownSize bool, dc *decodeContext) {
@@ -282,6 +307,7 @@ func decodeMaster(d *decode.D, bitsLimit int64, elm *ebml.Master, unknownSize bo
 			d.FieldStruct("element", func(d *decode.D) {
 				var childElm ebml.Element
 				childElm = &ebml.Unknown{}
+				elementPos := d.Pos()
 
 				tagID := d.FieldUintFn("id", decodeRawVint, scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
 					n := s.Actual
@@ -303,9 +329,15 @@ func decodeMaster(d *decode.D, bitsLimit int64, elm *ebml.Master, unknownSize bo
 				}))
 				d.FieldValueStr("type", childElm.GetType())
 
-				if tagID == ebml_matroska.TrackEntryID {
+				switch tagID {
+				case ebml_matroska.TrackEntryID:
 					dc.currentTrack = &track{}
 					dc.tracks = append(dc.tracks, dc.currentTrack)
+				case ebml_matroska.SeekID:
+					dc.currentSeekID = 0
+					dc.currentSeekRef = nil
+				case ebml_matroska.CueTrackPositionsID:
+					dc.currentClusterPos = -1
 				}
 
 				const maxStringTagSize = 100 * 1024 * 1024
@@ -317,6 +349,15 @@ func decodeMaster(d *decode.D, bitsLimit int64, elm *ebml.Master, unknownSize bo
 					tagSize = uint64(d.BitsLeft() / 8)
 				}
 
+				if tagID == ebml_matroska.SegmentID {
+					dc.segmentDataPos = d.Pos()
+				}
+				dc.elements[elementPos] = element{
+					id:      ebml.ID(tagID),
+					name:    childElm.GetName(),
+					dataPos: d.Pos(),
+				}
+
 				// assert sane tag size
 				// TODO: strings are limited for now because they are read into memory
 				switch childElm.(type) {
@@ -365,8 +406,31 @@ func decodeMaster(d *decode.D, bitsLimit int64, elm *ebml.Master, unknownSize bo
 						}))
 					}
 					v := d.FieldU("value", int(tagSize)*8, sm...)
-					if dc.currentTrack != nil && tagID == ebml_matroska.TrackNumberID {
+					switch {
+					case dc.currentTrack != nil && tagID == ebml_matroska.TrackNumberID:
 						dc.currentTrack.number = int(v)
+					case tagID == ebml_matroska.SeekPositionID:
+						r := &positionRef{d: d, pos: dc.segmentDataPos + int64(v)*8, clusterPos: -1}
+						if dc.currentSeekID != 0 {
+							r.validIDs = []ebml.ID{dc.currentSeekID}
+						}
+						dc.currentSeekRef = r
+						dc.positionRefs = append(dc.positionRefs, r)
+					case tagID == ebml_matroska.CueClusterPositionID:
+						dc.currentClusterPos = dc.segmentDataPos + int64(v)*8
+						dc.positionRefs = append(dc.positionRefs, &positionRef{
+							d:          d,
+							pos:        dc.currentClusterPos,
+							clusterPos: -1,
+							validIDs:   []ebml.ID{ebml_matroska.ClusterID},
+						})
+					case tagID == ebml_matroska.CueRelativePositionID && dc.currentClusterPos >= 0:
+						dc.positionRefs = append(dc.positionRefs, &positionRef{
+							d:          d,
+							pos:        int64(v) * 8,
+							clusterPos: dc.currentClusterPos,
+							validIDs:   []ebml.ID{ebml_matroska.SimpleBlockID, ebml_matroska.BlockGroupID},
+						})
 					}
 				case *ebml.Float:
 					d.FieldF("value", int(tagSize)*8)
@@ -418,6 +482,14 @@ func decodeMaster(d *decode.D, bitsLimit int64, elm *ebml.Master, unknownSize bo
 						d.SeekRel(int64(tagSize) * 8)
 					case ebml_matroska.FileDataID:
 						d.FieldFormatOrRawLen("value", int64(tagSize)*8, &imageGroup, nil)
+					case ebml_matroska.SeekIDID:
+						if tagSize <= 8 {
+							dc.currentSeekID = ebml.ID(d.PeekUintBits(int(tagSize) * 8))
+							if dc.currentSeekRef != nil {
+								dc.currentSeekRef.validIDs = []ebml.ID{dc.currentSeekID}
+							}
+						}
+						d.FieldRawLen("value", int64(tagSize)*8)
 					default:
 						d.FieldRawLen("value", int64(tagSize)*8)
 					}
@@ -438,9 +510,30 @@ func matroskaDecode(d *decode.D) any {
 	if d.PeekUintBits(32) != ebmlHeaderID {
 		d.Errorf("no EBML header found")
 	}
-	dc := &decodeContext{tracks: []*track{}}
+	dc := &decodeContext{
+		tracks:            []*track{},
+		elements:          map[int64]element{},
+		currentClusterPos: -1,
+	}
 	decodeMaster(d, d.BitsLeft(), ebml_matroska.RootElement, false, dc)
 
+	for _, r := range dc.positionRefs {
+		pos := r.pos
+		if r.clusterPos >= 0 {
+			c, ok := dc.elements[r.clusterPos]
+			if !ok {
+				continue
+			}
+			pos += c.dataPos
+		}
+		r.d.FieldValueUint("position", uint64(pos/8), scalar.UintHex)
+		e, ok := dc.elements[pos]
+		if ok {
+			r.d.FieldValueStr("target", e.name)
+		}
+		r.d.FieldValueBool("target_valid", ok && (r.validIDs == nil || slices.Contains(r.validIDs, e.id)))
+	}
+
 	trackNumberToTrack := map[int]*track{}
 	for _, t := range dc.tracks {
 		trackNumberToTrack[t.number] = t
@@ -502,7 +595,14 @@ func matroskaDecode(d *decode.D) any {
 			}
 			t.formatInArg = format.HEVC_AU_In{LengthSize: hevcDcrOut.LengthSize}
 		case "V_AV1":
-			t.parentD.FieldFormatRange("value", t.codecPrivatePos, t.codecPrivateTagSize, &av1CCRGroup, nil)
+			_, v := t.parentD.FieldFormatRange("value", t.codecPrivatePos, t.codecPrivateTagSize, &av1CCRGroup, nil)
+			av1CCROut, ok := v.(format.AV1_Sequence_Header_State)
+			if !ok {
+				panic(fmt.Sprintf("expected AV1CCROut got %#+v", v))
+			}
+			if av1CCROut.HasSequenceHeader {
+				t.formatInArg = av1CCROut
+			}
 		case "V_VP9":
 			t.parentD.FieldFormatRange("value", t.codecPrivatePos, t.codecPrivateTagSize, &vp9CFMGroup, nil)
 		default:
@@ -0,0 +1,181 @@
+package matter
+
+// Matter Core Specification, Appendix A: Tag-length-value (TLV) Encoding Format
+// https://csa-iot.org/developer-resource/specifications-download-request/
+// https://github.com/project-chip/connectedhomeip/blob/master/src/lib/core/TLVTypes.h
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed matter_tlv.jq
+//go:embed matter_tlv.md
+var matterTLVFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Matter_TLV,
+		&decode.Format{
+			Description: "Matter TLV encoding",
+			DecodeFn:    decodeMatterTLV,
+			Functions:   []string{"torepr"},
+		})
+	interp.RegisterFS(matterTLVFS)
+}
+
+const (
+	tagAnonymous          = 0
+	tagContextSpecific    = 1
+	tagCommonProfile2     = 2
+	tagCommonProfile4     = 3
+	tagImplicitProfile2   = 4
+	tagImplicitProfile4   = 5
+	tagFullyQualified6    = 6
+	tagFullyQualified8    = 7
+	maxContainerNestDepth = 64
+)
+
+var tagControlNames = scalar.UintMapSymStr{
+	tagAnonymous:        "anonymous",
+	tagContextSpecific:  "context_specific",
+	tagCommonProfile2:   "common_profile_2",
+	tagCommonProfile4:   "common_profile_4",
+	tagImplicitProfile2: "implicit_profile_2",
+	tagImplicitProfile4: "implicit_profile_4",
+	tagFullyQualified6:  "fully_qualified_6",
+	tagFullyQualified8:  "fully_qualified_8",
+}
+
+const (
+	typeSigned1        = 0x00
+	typeSigned8        = 0x03
+	typeUnsigned1      = 0x04
+	typeUnsigned8      = 0x07
+	typeFalse          = 0x08
+	typeTrue           = 0x09
+	typeFloat32        = 0x0a
+	typeFloat64        = 0x0b
+	typeUTF8String1    = 0x0c
+	typeUTF8String8    = 0x0f
+	typeOctetString1   = 0x10
+	typeOctetString8   = 0x13
+	typeNull           = 0x14
+	typeStructure      = 0x15
+	typeArray          = 0x16
+	typeList           = 0x17
+	typeEndOfContainer = 0x18
+)
+
+var elementTypeNames = scalar.UintMapSymStr{
+	0x00:               "signed_int_1",
+	0x01:               "signed_int_2",
+	0x02:               "signed_int_4",
+	0x03:               "signed_int_8",
+	0x04:               "unsigned_int_1",
+	0x05:               "unsigned_int_2",
+	0x06:               "unsigned_int_4",
+	0x07:               "unsigned_int_8",
+	typeFalse:          "false",
+	typeTrue:           "true",
+	typeFloat32:        "float32",
+	typeFloat64:        "float64",
+	0x0c:               "utf8_string_1",
+	0x0d:               "utf8_string_2",
+	0x0e:               "utf8_string_4",
+	0x0f:               "utf8_string_8",
+	0x10:               "octet_string_1",
+	0x11:               "octet_string_2",
+	0x12:               "octet_string_4",
+	0x13:               "octet_string_8",
+	typeNull:           "null",
+	typeStructure:      "structure",
+	typeArray:          "array",
+	typeList:           "list",
+	typeEndOfContainer: "end_of_container",
+}
+
+func decodeTag(d *decode.D, tagControl uint64) {
+	switch tagControl {
+	case tagContextSpecific:
+		d.FieldU8("tag")
+	case tagCommonProfile2, tagImplicitProfile2:
+		d.FieldU16("tag")
+	case tagCommonProfile4, tagImplicitProfile4:
+		d.FieldU32("tag")
+	case tagFullyQualified6:
+		d.FieldU16("vendor_id", scalar.UintHex)
+		d.FieldU16("profile_number", scalar.UintHex)
+		d.FieldU16("tag")
+	case tagFullyQualified8:
+		d.FieldU16("vendor_id", scalar.UintHex)
+		d.FieldU16("profile_number", scalar.UintHex)
+		d.FieldU32("tag")
+	}
+}
+
+// returns true if element is end of container
+func decodeElement(d *decode.D, depth int) bool {
+	if depth > maxContainerNestDepth {
+		d.Fatalf("max container nesting depth %d reached", maxContainerNestDepth)
+	}
+
+	var tagControl, elementType uint64
+	d.FieldStruct("control", func(d *decode.D) {
+		tagControl = d.FieldU3("tag_control", tagControlNames)
+		elementType = d.FieldU5("element_type", elementTypeNames)
+	})
+	decodeTag(d, tagControl)
+
+	switch {
+	case elementType >= typeSigned1 && elementType <= typeSigned8:
+		d.FieldS("value", 8<<(elementType-typeSigned1))
+	case elementType >= typeUnsigned1 && elementType <= typeUnsigned8:
+		d.FieldU("value", 8<<(elementType-typeUnsigned1))
+	case elementType == typeFalse:
+		d.FieldValueBool("value", false)
+	case elementType == typeTrue:
+		d.FieldValueBool("value", true)
+	case elementType == typeFloat32:
+		d.FieldF32("value")
+	case elementType == typeFloat64:
+		d.FieldF64("value")
+	case elementType >= typeUTF8String1 && elementType <= typeUTF8String8:
+		length := d.FieldU("length", 8<<(elementType-typeUTF8String1))
+		d.FieldUTF8("value", int(length))
+	case elementType >= typeOctetString1 && elementType <= typeOctetString8:
+		length := d.FieldU("length", 8<<(elementType-typeOctetString1))
+		d.FieldRawLen("value", int64(length)*8)
+	case elementType == typeNull:
+		d.FieldValueAny("value", nil)
+	case elementType == typeStructure, elementType == typeArray, elementType == typeList:
+		d.FieldArray("elements", func(d *decode.D) {
+			for {
+				end := false
+				d.FieldStruct("element", func(d *decode.D) { end = decodeElement(d, depth+1) })
+				if end {
+					break
+				}
+			}
+		})
+	case elementType == typeEndOfContainer:
+		if depth == 0 {
+			d.Fatalf("end of container outside container")
+		}
+		return true
+	default:
+		d.Fatalf("unknown element type %d", elementType)
+	}
+
+	return false
+}
+
+func decodeMatterTLV(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+	decodeElement(d, 0)
+	return nil
+}
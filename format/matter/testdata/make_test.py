@@ -0,0 +1,112 @@
+#!/usr/bin/env python3
+# generates matter tlv test files, see Matter Core Specification Appendix A
+import struct
+
+ANONYMOUS, CONTEXT, COMMON2, COMMON4, IMPLICIT2, IMPLICIT4, FQ6, FQ8 = range(8)
+
+
+def tag(control, t):
+    if control == ANONYMOUS:
+        return b""
+    if control == CONTEXT:
+        return struct.pack("<B", t)
+    if control in (COMMON2, IMPLICIT2):
+        return struct.pack("<H", t)
+    if control in (COMMON4, IMPLICIT4):
+        return struct.pack("<I", t)
+    vendor, profile, n = t
+    if control == FQ6:
+        return struct.pack("<HHH", vendor, profile, n)
+    return struct.pack("<HHI", vendor, profile, n)
+
+
+def elm(control, t, element_type, value=b""):
+    return bytes([control << 5 | element_type]) + tag(control, t) + value
+
+
+def sint(control, t, n, size):
+    i = {1: 0, 2: 1, 4: 2, 8: 3}[size]
+    return elm(control, t, 0x00 + i, n.to_bytes(size, "little", signed=True))
+
+
+def uint(control, t, n, size):
+    i = {1: 0, 2: 1, 4: 2, 8: 3}[size]
+    return elm(control, t, 0x04 + i, n.to_bytes(size, "little"))
+
+
+def utf8(control, t, s, lsize=1):
+    i = {1: 0, 2: 1, 4: 2, 8: 3}[lsize]
+    b = s.encode("utf-8")
+    return elm(control, t, 0x0C + i, len(b).to_bytes(lsize, "little") + b)
+
+
+def octets(control, t, b, lsize=1):
+    i = {1: 0, 2: 1, 4: 2, 8: 3}[lsize]
+    return elm(control, t, 0x10 + i, len(b).to_bytes(lsize, "little") + b)
+
+
+def container(control, t, element_type, elements):
+    return elm(control, t, element_type, b"".join(elements) + bytes([0x18]))
+
+
+def structure(control, t, *elements):
+    return container(control, t, 0x15, elements)
+
+
+def array(control, t, *elements):
+    return container(control, t, 0x16, elements)
+
+
+def tlv_list(control, t, *elements):
+    return container(control, t, 0x17, elements)
+
+
+types = structure(
+    ANONYMOUS,
+    None,
+    sint(CONTEXT, 0, -1, 1),
+    sint(CONTEXT, 1, -1000, 2),
+    sint(CONTEXT, 2, -100000, 4),
+    sint(CONTEXT, 3, -10000000000, 8),
+    uint(CONTEXT, 4, 255, 1),
+    uint(CONTEXT, 5, 1000, 2),
+    uint(CONTEXT, 6, 100000, 4),
+    uint(CONTEXT, 7, 10000000000, 8),
+    elm(CONTEXT, 8, 0x08),
+    elm(CONTEXT, 9, 0x09),
+    elm(CONTEXT, 10, 0x0A, struct.pack("<f", 1.5)),
+    elm(CONTEXT, 11, 0x0B, struct.pack("<d", -2.25)),
+    utf8(CONTEXT, 12, "hello"),
+    utf8(CONTEXT, 13, "åäö", 2),
+    octets(CONTEXT, 14, bytes([0xDE, 0xAD, 0xBE, 0xEF])),
+    octets(CONTEXT, 15, b"", 4),
+    elm(CONTEXT, 16, 0x14),
+    array(CONTEXT, 17, uint(ANONYMOUS, None, 1, 1), uint(ANONYMOUS, None, 2, 1), uint(ANONYMOUS, None, 3, 1)),
+    tlv_list(CONTEXT, 18, uint(CONTEXT, 1, 1, 1), utf8(CONTEXT, 2, "a")),
+    structure(CONTEXT, 19),
+    uint(COMMON2, 1, 2, 1),
+    uint(COMMON4, 100000, 3, 1),
+    uint(IMPLICIT2, 2, 4, 1),
+    uint(IMPLICIT4, 100000, 5, 1),
+    uint(FQ6, (0xFFF1, 0xDEED, 1), 6, 1),
+    uint(FQ8, (0xFFF1, 0xDEED, 100000), 7, 1),
+)
+
+# interaction model read request: attribute path list with one path
+# {0: [[2: 1, 3: 6, 4: 0]], 3: true, 255: 1}
+read_request = structure(
+    ANONYMOUS,
+    None,
+    array(
+        CONTEXT,
+        0,
+        tlv_list(ANONYMOUS, None, uint(CONTEXT, 2, 1, 1), uint(CONTEXT, 3, 6, 1), uint(CONTEXT, 4, 0, 1)),
+    ),
+    elm(CONTEXT, 3, 0x09),
+    uint(CONTEXT, 255, 1, 1),
+)
+
+open("types.tlv", "wb").write(types)
+open("read_request.tlv", "wb").write(read_request)
+# truncated, missing end of container
+open("truncated.tlv", "wb").write(read_request[:-1])
@@ -26,6 +26,8 @@ func init() {
 		format.MIDI,
 		&decode.Format{
 			Description: "Standard MIDI file",
+			Extensions:  []string{"mid", "midi"},
+			MIMETypes:   []string{"audio/midi"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeMIDI,
 		})
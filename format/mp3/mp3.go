@@ -20,6 +20,8 @@ func init() {
 		&decode.Format{
 			ProbeOrder:  format.ProbeOrderBinFuzzy, // after most others (silent samples and jpeg header can look like mp3 sync)
 			Description: "MP3 file",
+			Extensions:  []string{"mp3"},
+			MIMETypes:   []string{"audio/mpeg"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    mp3Decode,
 			DefaultInArg: format.MP3_In{
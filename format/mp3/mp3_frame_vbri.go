@@ -30,10 +30,8 @@ func mp3FrameTagVBRIDecode(d *decode.D) any {
 	d.FieldU16("scale_factor", scalar.UintDescription("Scale factor of TOC table entries"))
 	tocEntrySize := d.FieldU16("toc_entry_size", d.UintAssert(1, 2, 3, 4), scalar.UintDescription("Size per table entry"))
 	d.FieldU16("frame_per_entry", scalar.UintDescription("Frames per table entry"))
-	d.FieldArray("toc", func(d *decode.D) {
-		for i := 0; i < int(tocEntries); i++ {
-			d.FieldU("entry", int(tocEntrySize)*8)
-		}
+	d.FieldArrayLoopN("toc", int64(tocEntries), func(d *decode.D) {
+		d.FieldU("entry", int(tocEntrySize)*8)
 	})
 
 	return nil
@@ -29,6 +29,18 @@ var mediaTimeNames = scalar.SintMapDescription{
 	-1: "empty",
 }
 
+const (
+	ilocConstructionMethodFile       = 0
+	ilocConstructionMethodIdat       = 1
+	ilocConstructionMethodItemOffset = 2
+)
+
+var ilocConstructionMethodNames = scalar.UintMapSymStr{
+	ilocConstructionMethodFile:       "file",
+	ilocConstructionMethodIdat:       "idat",
+	ilocConstructionMethodItemOffset: "item",
+}
+
 var subTypeNames = scalar.StrMapDescription{
 	"alis": "Alias Data",
 	"camm": "Camera Metadata",
@@ -325,9 +337,41 @@ type trafBox struct {
 	moof           *moof
 }
 
+type metaItemExtent struct {
+	offset int64
+	length int64
+}
+
+type metaItemLocation struct {
+	id                 uint64
+	constructionMethod uint64
+	dataReferenceIndex uint64
+	baseOffset         int64
+	extents            []metaItemExtent
+}
+
+type metaItemInfo struct {
+	typ         string
+	name        string
+	contentType string
+}
+
+type metaProperty struct {
+	typ         string
+	formatInArg any
+}
+
 type metaBox struct {
-	subType string
-	keys    *keysBox
+	subType        string
+	keys           *keysBox
+	primaryItemID  uint64
+	itemInfos      map[uint64]metaItemInfo
+	itemLocations  []metaItemLocation
+	itemProperties map[uint64][]uint64 // item id -> 1-based ipco property indexes
+	properties     []metaProperty
+	idatPos        int64
+	idatLen        int64
+	hasIdat        bool
 }
 
 type keysBoxKey struct {
@@ -381,6 +425,12 @@ func decodeBoxFtyp(ctx *decodeContext, d *decode.D) {
 }
 
 func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
+	if ctx.isParent("ipco") {
+		if mb := ctx.currentMetaBox(); mb != nil {
+			mb.properties = append(mb.properties, metaProperty{typ: typ})
+		}
+	}
+
 	switch typ {
 	case "ftyp":
 		decodeBoxFtyp(ctx, d)
@@ -710,18 +760,14 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 		if !ok {
 			panic(fmt.Sprintf("expected AvcDcrOut got %#+v", v))
 		}
-		if t := ctx.currentTrack(); t != nil {
-			t.formatInArg = format.AVC_AU_In{LengthSize: avcDcrOut.LengthSize}
-		}
+		ctx.setFormatInArg(format.AVC_AU_In{LengthSize: avcDcrOut.LengthSize})
 	case "hvcC":
 		_, v := d.FieldFormat("descriptor", &hevcCDCRGroup, nil)
 		hevcDcrOut, ok := v.(format.HEVC_DCR_Out)
 		if !ok {
 			panic(fmt.Sprintf("expected HevcDcrOut got %#+v", v))
 		}
-		if t := ctx.currentTrack(); t != nil {
-			t.formatInArg = format.HEVC_AU_In{LengthSize: hevcDcrOut.LengthSize}
-		}
+		ctx.setFormatInArg(format.HEVC_AU_In{LengthSize: hevcDcrOut.LengthSize})
 	case "dfLa":
 		d.FieldU8("version")
 		d.FieldU24("flags")
@@ -738,7 +784,14 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 	case "dOps":
 		d.FieldFormat("descriptor", &opusPacketFrameGroup, nil)
 	case "av1C":
-		d.FieldFormat("descriptor", &av1CCRGroup, nil)
+		_, v := d.FieldFormat("descriptor", &av1CCRGroup, nil)
+		av1CCROut, ok := v.(format.AV1_Sequence_Header_State)
+		if !ok {
+			panic(fmt.Sprintf("expected AV1CCROut got %#+v", v))
+		}
+		if av1CCROut.HasSequenceHeader {
+			ctx.setFormatInArg(av1CCROut)
+		}
 	case "vpcC":
 		d.FieldU8("version")
 		d.FieldU24("flags")
@@ -946,7 +999,14 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 			// TODO: rename?
 			d.FieldU32("maybe_flags")
 		}
-		decodeBoxesWithParentData(ctx, d, &metaBox{})
+		mb := &metaBox{
+			itemInfos:      map[uint64]metaItemInfo{},
+			itemProperties: map[uint64][]uint64{},
+		}
+		decodeBoxesWithParentData(ctx, d, mb)
+		if len(mb.itemLocations) > 0 {
+			ctx.metaBoxes = append(ctx.metaBoxes, mb)
+		}
 	case "ilst":
 		if mb := ctx.currentMetaBox(); mb != nil && mb.keys != nil && len(mb.keys.keys) > 0 {
 			// meta box had a keys box
@@ -1154,8 +1214,7 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 		d.FieldU24("flags")
 		d.FieldU32("mfra_size")
 
-	case "iloc": // HEIC image
-		// TODO: item location
+	case "iloc": // HEIF item location
 		version := d.FieldU8("version")
 		d.FieldU24("flags")
 
@@ -1175,45 +1234,53 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 		} else {
 			itemCount = d.FieldU32("item_count")
 		}
+		mb := ctx.currentMetaBox()
 		d.FieldArray("items", func(d *decode.D) {
 			for i := uint64(0); i < itemCount; i++ {
 				d.FieldStruct("item", func(d *decode.D) {
+					var l metaItemLocation
 					switch version {
 					case 0, 1:
-						d.FieldU16("id")
+						l.id = d.FieldU16("id")
 					case 2:
-						d.FieldU32("id")
+						l.id = d.FieldU32("id")
 					}
 					switch version {
 					case 1, 2:
 						d.FieldU12("reserved")
-						d.FieldU4("construction_method")
+						l.constructionMethod = d.FieldU4("construction_method", ilocConstructionMethodNames)
 					}
-					d.FieldU16("data_reference_index")
-					d.FieldU("base_offset", int(baseOffsetSize)*8)
+					l.dataReferenceIndex = d.FieldU16("data_reference_index")
+					l.baseOffset = int64(d.FieldU("base_offset", int(baseOffsetSize)*8))
 					extentCount := d.FieldU16("extent_count")
 					d.FieldArray("extends", func(d *decode.D) {
 						for i := uint64(0); i < extentCount; i++ {
 							d.FieldStruct("extent", func(d *decode.D) {
 								if (version == 1 || version == 2) && indexSize > 0 {
-									d.FieldU("index", int(offsetSize)*8)
+									d.FieldU("index", int(indexSize)*8)
 								}
-								d.FieldU("offset", int(offsetSize)*8)
-								d.FieldU("length", int(lengthSize)*8)
+								offset := d.FieldU("offset", int(offsetSize)*8)
+								length := d.FieldU("length", int(lengthSize)*8)
+								l.extents = append(l.extents, metaItemExtent{offset: int64(offset), length: int64(length)})
 							})
 						}
 					})
+					if mb != nil {
+						mb.itemLocations = append(mb.itemLocations, l)
+					}
 				})
 			}
 		})
 	case "infe":
+		var itemID uint64
+		var info metaItemInfo
 		version := d.FieldU8("version")
 		d.FieldU24("flags")
 		if version == 0 || version == 1 {
-			d.FieldU16("item_id")
+			itemID = d.FieldU16("item_id")
 			d.FieldU16("item_protection_index")
-			d.FieldUTF8Null("item_name")
-			d.FieldUTF8Null("content_type")
+			info.name = d.FieldUTF8Null("item_name")
+			info.contentType = d.FieldUTF8Null("content_type")
 			if !d.End() {
 				d.FieldUTF8Null("content_encoding")
 			}
@@ -1229,16 +1296,16 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 		if version >= 2 {
 			switch version {
 			case 2:
-				d.FieldU16("item_id")
+				itemID = d.FieldU16("item_id")
 			case 3:
-				d.FieldU32("item_id")
+				itemID = d.FieldU32("item_id")
 			}
 			d.FieldU16("item_protection_index")
-			itemType := d.FieldUTF8("item_type", 4)
-			d.FieldUTF8Null("item_name")
-			switch itemType {
+			info.typ = d.FieldUTF8("item_type", 4)
+			info.name = d.FieldUTF8Null("item_name")
+			switch info.typ {
 			case "mime":
-				d.FieldUTF8Null("content_type")
+				info.contentType = d.FieldUTF8Null("content_type")
 				if !d.End() {
 					d.FieldUTF8Null("content_encoding")
 				}
@@ -1246,6 +1313,9 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 				d.FieldUTF8Null("item_uri_type")
 			}
 		}
+		if mb := ctx.currentMetaBox(); mb != nil {
+			mb.itemInfos[itemID] = info
+		}
 	case "iinf":
 		version := d.FieldU8("version")
 		d.FieldU24("flags")
@@ -1408,7 +1478,7 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 		}
 		entryCount := d.FieldU32("entry_count")
 
-		d.FieldStructNArray("entries", "entry", int64(entryCount), func(d *decode.D) {
+		d.FieldStructArrayLoopN("entries", "entry", int64(entryCount), func(d *decode.D) {
 			entryLen := defaultLength
 			if version == 1 {
 				if defaultLength == 0 {
@@ -1671,24 +1741,35 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 		version := d.FieldU8("version")
 		flags := d.FieldU24("flags")
 		entryCount := d.FieldU32("entry_count")
+		mb := ctx.currentMetaBox()
 		d.FieldArray("entries", func(d *decode.D) {
 			for i := uint64(0); i < entryCount; i++ {
 				d.FieldStruct("entry", func(d *decode.D) {
+					var itemID uint64
 					if version < 1 {
-						d.FieldU16("item_id")
+						itemID = d.FieldU16("item_id")
 					} else {
-						d.FieldU32("item_id")
+						itemID = d.FieldU32("item_id")
 					}
 					associationCount := d.FieldU8("association_count")
 					d.FieldArray("associations", func(d *decode.D) {
 						for j := uint64(0); j < associationCount; j++ {
 							d.FieldStruct("association", func(d *decode.D) {
 								d.FieldBool("essential")
+								var propertyIndex uint64
 								if flags&0b1 != 0 {
-									d.FieldU15("property_index")
+									propertyIndex = d.FieldU15("property_index")
 								} else {
-									d.FieldU7("item_id")
+									propertyIndex = d.FieldU7("property_index")
+								}
+								if mb == nil {
+									return
 								}
+								// 0 means no property, otherwise 1-based index into ipco
+								if propertyIndex > 0 && propertyIndex <= uint64(len(mb.properties)) {
+									d.FieldValueStr("property_type", mb.properties[propertyIndex-1].typ)
+								}
+								mb.itemProperties[itemID] = append(mb.itemProperties[itemID], propertyIndex)
 							})
 						}
 					})
@@ -1696,13 +1777,24 @@ func decodeBox(ctx *decodeContext, d *decode.D, typ string) {
 			}
 		})
 	case "pitm":
+		var itemID uint64
 		version := d.FieldU8("version")
 		d.FieldU24("flags")
 		if version == 0 {
-			d.FieldU16("item_id")
+			itemID = d.FieldU16("item_id")
 		} else {
-			d.FieldU32("item_id")
+			itemID = d.FieldU32("item_id")
+		}
+		if mb := ctx.currentMetaBox(); mb != nil {
+			mb.primaryItemID = itemID
 		}
+	case "idat":
+		if mb := ctx.currentMetaBox(); mb != nil {
+			mb.idatPos = d.Pos()
+			mb.idatLen = d.BitsLeft()
+			mb.hasIdat = true
+		}
+		d.FieldRawLen("data", d.BitsLeft())
 	case "iref":
 		version := d.FieldU8("version")
 		d.FieldU24("flags")
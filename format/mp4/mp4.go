@@ -24,6 +24,7 @@ import (
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/ranges"
 	"golang.org/x/exp/slices"
 )
 
@@ -36,6 +37,7 @@ var av1CCRGroup decode.Group
 var av1FrameGroup decode.Group
 var avcAUGroup decode.Group
 var avcDCRGroup decode.Group
+var exifGroup decode.Group
 var flacFrameGroup decode.Group
 var flacMetadatablocksGroup decode.Group
 var hevcAUGroup decode.Group
@@ -62,6 +64,8 @@ func init() {
 		format.MP4,
 		&decode.Format{
 			Description: "ISOBMFF, QuickTime and similar",
+			Extensions:  []string{"mp4", "m4a", "m4v", "mov"},
+			MIMETypes:   []string{"video/mp4", "audio/mp4", "video/quicktime"},
 			Groups: []*decode.Group{
 				format.Probe,
 				format.Image, // avif
@@ -77,6 +81,7 @@ func init() {
 				{Groups: []*decode.Group{format.AV1_Frame}, Out: &av1FrameGroup},
 				{Groups: []*decode.Group{format.AVC_AU}, Out: &avcAUGroup},
 				{Groups: []*decode.Group{format.AVC_DCR}, Out: &avcDCRGroup},
+				{Groups: []*decode.Group{format.Exif}, Out: &exifGroup},
 				{Groups: []*decode.Group{format.FLAC_Frame}, Out: &flacFrameGroup},
 				{Groups: []*decode.Group{format.FLAC_Metadatablocks}, Out: &flacMetadatablocksGroup},
 				{Groups: []*decode.Group{format.HEVC_AU}, Out: &hevcAUGroup},
@@ -158,9 +163,10 @@ type pathEntry struct {
 }
 
 type decodeContext struct {
-	opts   format.MP4_In
-	path   []pathEntry
-	tracks []*track
+	opts      format.MP4_In
+	path      []pathEntry
+	tracks    []*track
+	metaBoxes []*metaBox // meta boxes with item locations
 }
 
 func (ctx *decodeContext) isParent(typ string) bool {
@@ -206,6 +212,20 @@ func (ctx *decodeContext) currentMetaBox() *metaBox {
 	return t
 }
 
+// setFormatInArg sets decoder argument for current track samples or for items
+// associated with current item property
+func (ctx *decodeContext) setFormatInArg(arg any) {
+	if ctx.isParent("ipco") {
+		if mb := ctx.currentMetaBox(); mb != nil && len(mb.properties) > 0 {
+			mb.properties[len(mb.properties)-1].formatInArg = arg
+		}
+		return
+	}
+	if t := ctx.currentTrack(); t != nil {
+		t.formatInArg = arg
+	}
+}
+
 func (ctx *decodeContext) currentTrack() *track {
 	if t := ctx.currentTrakBox(); t != nil {
 		return t.track
@@ -452,6 +472,118 @@ func mp4Tracks(d *decode.D, ctx *decodeContext) {
 	})
 }
 
+func mp4Items(d *decode.D, ctx *decodeContext) {
+	decodeItemRange := func(d *decode.D, itemType string, firstBit int64, nBits int64, inArg any) {
+		d.RangeFn(firstBit, nBits, func(d *decode.D) {
+			if !ctx.opts.DecodeSamples {
+				d.FieldRawLen("data", d.BitsLeft())
+				return
+			}
+
+			switch itemType {
+			case "av01":
+				d.FieldFormatLen("data", nBits, &av1FrameGroup, inArg)
+			case "hvc1":
+				d.FieldFormatLen("data", nBits, &hevcAUGroup, inArg)
+			case "avc1":
+				d.FieldFormatLen("data", nBits, &avcAUGroup, inArg)
+			case "jpeg":
+				d.FieldFormatLen("data", nBits, &jpegGroup, inArg)
+			case "Exif":
+				d.FieldStruct("data", func(d *decode.D) {
+					// ISO/IEC 23008-12 A.2.1 exif_tiff_header_offset is number of bytes to tiff header
+					tiffHeaderOffset := d.FieldU32("exif_tiff_header_offset")
+					if tiffHeaderOffset > 0 {
+						d.FieldRawLen("prefix", int64(tiffHeaderOffset)*8)
+					}
+					d.FieldFormatOrRawLen("exif", d.BitsLeft(), &exifGroup, nil)
+				})
+			default:
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		})
+	}
+
+	d.FieldArray("items", func(d *decode.D) {
+		for _, mb := range ctx.metaBoxes {
+			for _, l := range mb.itemLocations {
+				d.FieldStruct("item", func(d *decode.D) {
+					info := mb.itemInfos[l.id]
+
+					d.FieldValueUint("id", l.id)
+					d.FieldValueStr("type", info.typ, dataFormatNames)
+					if info.name != "" {
+						d.FieldValueStr("name", info.name)
+					}
+					if info.contentType != "" {
+						d.FieldValueStr("content_type", info.contentType)
+					}
+					d.FieldValueBool("primary", l.id == mb.primaryItemID)
+
+					// use first associated property that has decoder arguments, ex: av1C or hvcC
+					var inArg any
+					for _, pi := range mb.itemProperties[l.id] {
+						if pi > 0 && pi <= uint64(len(mb.properties)) && mb.properties[pi-1].formatInArg != nil {
+							inArg = mb.properties[pi-1].formatInArg
+							break
+						}
+					}
+
+					if l.dataReferenceIndex != 0 {
+						// data is in some other file
+						return
+					}
+
+					var basePos int64
+					switch l.constructionMethod {
+					case ilocConstructionMethodFile:
+						basePos = l.baseOffset * 8
+					case ilocConstructionMethodIdat:
+						if !mb.hasIdat {
+							return
+						}
+						basePos = mb.idatPos + l.baseOffset*8
+					default:
+						// TODO: item offset construction
+						return
+					}
+
+					var extentRanges []ranges.Range
+					for _, e := range l.extents {
+						r := ranges.Range{Start: basePos + e.offset*8, Len: e.length * 8}
+						if e.length == 0 {
+							// zero length means rest of file or idat
+							end := d.Len()
+							if l.constructionMethod == ilocConstructionMethodIdat {
+								end = mb.idatPos + mb.idatLen
+							}
+							r.Len = end - r.Start
+						}
+						if r.Start < 0 || r.Len < 0 || r.Start+r.Len > d.Len() {
+							d.Errorf("item %d extent outside file", l.id)
+						}
+						extentRanges = append(extentRanges, r)
+					}
+
+					switch len(extentRanges) {
+					case 0:
+					case 1:
+						decodeItemRange(d, info.typ, extentRanges[0].Start, extentRanges[0].Len, inArg)
+					default:
+						d.FieldArray("extents", func(d *decode.D) {
+							for _, r := range extentRanges {
+								d.RangeFn(r.Start, r.Len, func(d *decode.D) {
+									d.FieldRawLen("extent", d.BitsLeft())
+								})
+							}
+						})
+					}
+				})
+			}
+		}
+	})
+}
+
 func mp4Decode(d *decode.D) any {
 	var mi format.MP4_In
 	d.ArgAs(&mi)
@@ -488,6 +620,9 @@ func mp4Decode(d *decode.D) any {
 	if len(ctx.tracks) > 0 {
 		mp4Tracks(d, ctx)
 	}
+	if len(ctx.metaBoxes) > 0 {
+		mp4Items(d, ctx)
+	}
 
 	return nil
 }
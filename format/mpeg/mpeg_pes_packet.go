@@ -181,6 +181,10 @@ func pesPacketDecode(d *decode.D) any {
 		}
 
 		dataLen := int64(length-headerDataLength-extensionLength) * 8
+		// zero length is allowed for video streams in transport streams and means rest of packet
+		if length == 0 {
+			dataLen = d.BitsLeft()
+		}
 
 		switch startCode {
 		case privateStream1:
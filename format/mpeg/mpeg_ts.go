@@ -1,34 +1,663 @@
 package mpeg
 
+// https://www.itu.int/rec/T-REC-H.222.0 Generic coding of moving pictures and associated audio information: Systems
+// https://en.wikipedia.org/wiki/MPEG_transport_stream
+// https://en.wikipedia.org/wiki/Program-specific_information
+
+// TODO: more PSI tables, SDT, NIT, EIT etc
+// TODO: PES streams without PAT/PMT
+
 import (
+	"embed"
+	"fmt"
+
 	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed mpeg_ts.md
+var mpegTSFS embed.FS
+
+var tsPESPacketGroup decode.Group
+var tsAVCAnnexBGroup decode.Group
+var tsHEVCAnnexBGroup decode.Group
+var tsADTSGroup decode.Group
+var tsMP3Group decode.Group
+
 func init() {
 	interp.RegisterFormat(
 		format.MPEG_TS,
 		&decode.Format{
 			ProbeOrder:  format.ProbeOrderBinFuzzy, // make sure to be after gif, both start with 0x47
 			Description: "MPEG Transport Stream",
+			Extensions:  []string{"ts", "m2ts"},
+			MIMETypes:   []string{"video/mp2t"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    tsDecode,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.MPEG_PES_Packet}, Out: &tsPESPacketGroup},
+				{Groups: []*decode.Group{format.AVC_Annexb}, Out: &tsAVCAnnexBGroup},
+				{Groups: []*decode.Group{format.HEVC_Annexb}, Out: &tsHEVCAnnexBGroup},
+				{Groups: []*decode.Group{format.ADTS}, Out: &tsADTSGroup},
+				{Groups: []*decode.Group{format.MP3}, Out: &tsMP3Group},
+			},
+		})
+	interp.RegisterFS(mpegTSFS)
+}
+
+const (
+	tsSyncByte = 0x47
+	// plain transport stream packet
+	tsPacketSize = 188
+	// BDAV (m2ts) packet with 4 byte extra header
+	tsM2TSPacketSize = 192
+)
+
+const (
+	tsPIDPAT  = 0x0000
+	tsPIDNull = 0x1fff
+)
+
+var tsPIDNames = scalar.UintMapSymStr{
+	tsPIDPAT:  "pat",
+	0x0001:    "cat",
+	0x0002:    "tsdt",
+	0x0003:    "ipmp",
+	0x0010:    "nit",
+	0x0011:    "sdt",
+	0x0012:    "eit",
+	0x0014:    "tdt",
+	tsPIDNull: "null",
+}
+
+var tsScramblingControlNames = scalar.UintMapSymStr{
+	0b00: "not_scrambled",
+	0b01: "reserved",
+	0b10: "even_key",
+	0b11: "odd_key",
+}
+
+var tsAdaptationFieldControlNames = scalar.UintMapSymStr{
+	0b00: "reserved",
+	0b01: "payload_only",
+	0b10: "adaptation_field_only",
+	0b11: "adaptation_field_and_payload",
+}
+
+const (
+	tsTableIDPAT = 0x00
+	tsTableIDPMT = 0x02
+)
+
+var tsTableIDNames = scalar.UintMap{
+	tsTableIDPAT: {Sym: "pat", Description: "Program association section"},
+	0x01:         {Sym: "cat", Description: "Conditional access section"},
+	tsTableIDPMT: {Sym: "pmt", Description: "Program map section"},
+	0x03:         {Sym: "tsdt", Description: "Transport stream description section"},
+	0x40:         {Sym: "nit", Description: "Network information section, actual network"},
+	0x41:         {Sym: "nit_other", Description: "Network information section, other network"},
+	0x42:         {Sym: "sdt", Description: "Service description section, actual transport stream"},
+	0x46:         {Sym: "sdt_other", Description: "Service description section, other transport stream"},
+	0x4e:         {Sym: "eit", Description: "Event information section, actual transport stream, present/following"},
+	0x70:         {Sym: "tdt", Description: "Time date section"},
+	0x73:         {Sym: "tot", Description: "Time offset section"},
+	0xfc:         {Sym: "splice_info", Description: "SCTE-35 splice info section"},
+	0xff:         {Sym: "stuffing"},
+}
+
+const (
+	tsStreamTypeMPEG1Audio = 0x03
+	tsStreamTypeMPEG2Audio = 0x04
+	tsStreamTypeADTS       = 0x0f
+	tsStreamTypeH264       = 0x1b
+	tsStreamTypeH265       = 0x24
+)
+
+var tsStreamTypeNames = scalar.UintMap{
+	0x01:                   {Sym: "mpeg1_video", Description: "ISO/IEC 11172-2 video"},
+	0x02:                   {Sym: "mpeg2_video", Description: "ISO/IEC 13818-2 video"},
+	tsStreamTypeMPEG1Audio: {Sym: "mpeg1_audio", Description: "ISO/IEC 11172-3 audio"},
+	tsStreamTypeMPEG2Audio: {Sym: "mpeg2_audio", Description: "ISO/IEC 13818-3 audio"},
+	0x05:                   {Sym: "private_sections", Description: "ITU-T H.222.0 private sections"},
+	0x06:                   {Sym: "pes_private_data", Description: "ITU-T H.222.0 PES packets containing private data"},
+	0x0d:                   {Sym: "dsm_cc", Description: "ISO/IEC 13818-6 DSM-CC"},
+	tsStreamTypeADTS:       {Sym: "adts_aac", Description: "ISO/IEC 13818-7 audio with ADTS transport syntax"},
+	0x10:                   {Sym: "mpeg4_video", Description: "ISO/IEC 14496-2 visual"},
+	0x11:                   {Sym: "latm_aac", Description: "ISO/IEC 14496-3 audio with LATM transport syntax"},
+	0x15:                   {Sym: "metadata", Description: "Metadata carried in PES packets"},
+	tsStreamTypeH264:       {Sym: "h264", Description: "ITU-T H.264 video"},
+	tsStreamTypeH265:       {Sym: "h265", Description: "ITU-T H.265 video"},
+	0x81:                   {Sym: "ac3", Description: "ATSC A/52 audio"},
+	0x86:                   {Sym: "scte35", Description: "SCTE-35 splice information"},
+	0x87:                   {Sym: "eac3", Description: "ATSC A/52 enhanced audio"},
+}
+
+const (
+	tsDescriptorRegistration   = 0x05
+	tsDescriptorISO639Language = 0x0a
+)
+
+var tsDescriptorTagNames = scalar.UintMapSymStr{
+	0x02:                       "video_stream",
+	0x03:                       "audio_stream",
+	0x04:                       "hierarchy",
+	tsDescriptorRegistration:   "registration",
+	0x06:                       "data_stream_alignment",
+	0x09:                       "ca",
+	tsDescriptorISO639Language: "iso_639_language",
+	0x0e:                       "maximum_bitrate",
+	0x1c:                       "mpeg4_audio",
+	0x26:                       "metadata",
+	0x28:                       "avc_video",
+	0x2a:                       "avc_timing_and_hrd",
+	0x38:                       "hevc_video",
+	0x48:                       "service",
+	0x52:                       "stream_identifier",
+	0x56:                       "teletext",
+	0x59:                       "subtitling",
+	0x6a:                       "ac3",
+	0x7a:                       "enhanced_ac3",
+	0x7c:                       "aac",
+}
+
+var tsAudioTypeNames = scalar.UintMapSymStr{
+	0x00: "undefined",
+	0x01: "clean_effects",
+	0x02: "hearing_impaired",
+	0x03: "visual_impaired_commentary",
+}
+
+// PES stream demuxed from transport stream packets with the same PID
+type tsStream struct {
+	pid        uint64
+	streamType uint64
+	packetsD   *decode.D
+	d          *decode.D
+	started    bool
+	pesBuf     []byte
+	esBuf      []byte
+}
+
+type tsContext struct {
+	pmtPIDs     map[uint64]bool
+	streams     map[uint64]*tsStream
+	streamOrder []*tsStream
+	// PSI section reassembly per PID
+	sectionBufs    map[uint64][]byte
+	sectionStarted map[uint64]bool
+	sectionsD      *decode.D
+	streamsD       *decode.D
+}
+
+func (tc *tsContext) pidMapper() scalar.UintFn {
+	return scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		if st, ok := tc.streams[s.Actual]; ok {
+			if ss, ok := tsStreamTypeNames[st.streamType]; ok {
+				s.Sym = ss.Sym
+			}
+			return s, nil
+		}
+		if tc.pmtPIDs[s.Actual] {
+			s.Sym = "pmt"
+			return s, nil
+		}
+		return tsPIDNames.MapUint(s)
+	})
+}
+
+func tsDecodeDescriptors(d *decode.D, length uint64) {
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		d.FieldArray("descriptors", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("descriptor", func(d *decode.D) {
+					tag := d.FieldU8("tag", tsDescriptorTagNames, scalar.UintHex)
+					l := d.FieldU8("length")
+					d.FramedFn(int64(l)*8, func(d *decode.D) {
+						switch tag {
+						case tsDescriptorRegistration:
+							d.FieldUTF8("format_identifier", 4)
+							if !d.End() {
+								d.FieldRawLen("additional_identification_info", d.BitsLeft())
+							}
+						case tsDescriptorISO639Language:
+							d.FieldArray("languages", func(d *decode.D) {
+								for !d.End() {
+									d.FieldStruct("language", func(d *decode.D) {
+										d.FieldUTF8("iso_639_language_code", 3)
+										d.FieldU8("audio_type", tsAudioTypeNames)
+									})
+								}
+							})
+						default:
+							d.FieldRawLen("data", d.BitsLeft())
+						}
+					})
+				})
+			}
 		})
+	})
 }
 
-// TODO: ts_packet
+func (tc *tsContext) decodeSection(d *decode.D, pid uint64) {
+	d.FieldValueUint("pid", pid, tc.pidMapper())
+	tableID := d.FieldU8("table_id", tsTableIDNames, scalar.UintHex)
+	syntaxIndicator := d.FieldBool("section_syntax_indicator")
+	d.FieldU1("private_indicator")
+	d.FieldU2("reserved0")
+	sectionLength := d.FieldU12("section_length")
+
+	d.FramedFn(int64(sectionLength)*8, func(d *decode.D) {
+		if !syntaxIndicator {
+			d.FieldRawLen("data", d.BitsLeft())
+			return
+		}
+
+		switch tableID {
+		case tsTableIDPAT:
+			d.FieldU16("transport_stream_id")
+		case tsTableIDPMT:
+			d.FieldU16("program_number")
+		default:
+			d.FieldU16("table_id_extension")
+		}
+		d.FieldU2("reserved1")
+		d.FieldU5("version_number")
+		d.FieldBool("current_next_indicator")
+		d.FieldU8("section_number")
+		d.FieldU8("last_section_number")
+
+		d.FramedFn(d.BitsLeft()-32, func(d *decode.D) {
+			switch tableID {
+			case tsTableIDPAT:
+				d.FieldArray("programs", func(d *decode.D) {
+					for !d.End() {
+						d.FieldStruct("program", func(d *decode.D) {
+							programNumber := d.FieldU16("program_number")
+							d.FieldU3("reserved")
+							if programNumber == 0 {
+								d.FieldU13("network_pid", scalar.UintHex)
+								return
+							}
+							pmtPID := d.FieldU13("program_map_pid", scalar.UintHex)
+							tc.pmtPIDs[pmtPID] = true
+						})
+					}
+				})
+			case tsTableIDPMT:
+				d.FieldU3("reserved2")
+				d.FieldU13("pcr_pid", tc.pidMapper(), scalar.UintHex)
+				d.FieldU4("reserved3")
+				programInfoLength := d.FieldU12("program_info_length")
+				tsDecodeDescriptors(d, programInfoLength)
+				d.FieldArray("streams", func(d *decode.D) {
+					for !d.End() {
+						d.FieldStruct("stream", func(d *decode.D) {
+							streamType := d.FieldU8("stream_type", tsStreamTypeNames, scalar.UintHex)
+							d.FieldU3("reserved0")
+							elementaryPID := d.FieldU13("elementary_pid", scalar.UintHex)
+							d.FieldU4("reserved1")
+							esInfoLength := d.FieldU12("es_info_length")
+							tsDecodeDescriptors(d, esInfoLength)
+							tc.addStream(elementaryPID, streamType)
+						})
+					}
+				})
+			default:
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		})
+
+		crcStart := d.Pos()
+		sectionCRC := &checksum.CRC{Bits: 32, Current: 0xffff_ffff, Table: checksum.Poly04c11db7Table}
+		d.Copy(sectionCRC, bitio.NewIOReader(d.BitBufRange(0, crcStart)))
+		d.FieldU32("crc", d.UintValidateBytes(sectionCRC.Sum(nil)), scalar.UintHex)
+	})
+}
+
+func (tc *tsContext) addStream(pid uint64, streamType uint64) {
+	// PMT is repeated, only add new streams
+	if _, ok := tc.streams[pid]; ok {
+		return
+	}
+	st := &tsStream{pid: pid, streamType: streamType}
+	st.d = tc.streamsD.FieldStructValue("stream")
+	st.d.FieldValueUint("pid", pid, scalar.UintHex)
+	st.d.FieldValueUint("stream_type", streamType, tsStreamTypeNames, scalar.UintHex)
+	st.packetsD = st.d.FieldArrayValue("packets")
+	tc.streams[pid] = st
+	tc.streamOrder = append(tc.streamOrder, st)
+}
+
+// feedSection appends transport packet payload to the section buffer for a PID and decodes
+// all complete sections. Sections can span multiple packets and a packet can contain
+// multiple sections.
+func (tc *tsContext) feedSection(d *decode.D, pid uint64, b []byte) {
+	buf := append(tc.sectionBufs[pid], b...)
+	for len(buf) > 0 {
+		// stuffing bytes after last section in packet
+		if buf[0] == 0xff {
+			buf = nil
+			tc.sectionStarted[pid] = false
+			break
+		}
+		if len(buf) < 3 {
+			break
+		}
+		l := 3 + (int(buf[1]&0x0f)<<8 | int(buf[2]))
+		if len(buf) < l {
+			break
+		}
+		tc.sectionsD.FieldStructRootBitBufFn("section", bitio.NewBitReader(buf[0:l], -1), func(d *decode.D) {
+			tc.decodeSection(d, pid)
+		})
+		buf = buf[l:]
+	}
+	tc.sectionBufs[pid] = buf
+}
+
+// pesLength returns total PES packet length in bytes or -1 if unbounded
+func pesLength(b []byte) int {
+	if len(b) < 6 {
+		return -1
+	}
+	l := int(b[4])<<8 | int(b[5])
+	if l == 0 {
+		return -1
+	}
+	return 6 + l
+}
+
+// pesPayload returns elementary stream data in a PES packet
+func pesPayload(b []byte) []byte {
+	if len(b) < 6 {
+		return nil
+	}
+	if l := pesLength(b); l != -1 && l < len(b) {
+		b = b[0:l]
+	}
+	streamID := b[3]
+	hasExtension := streamID == privateStream1 || (streamID >= 0xc0 && streamID <= 0xef)
+	if !hasExtension {
+		return b[6:]
+	}
+	if len(b) < 9 || len(b) < 9+int(b[8]) {
+		return nil
+	}
+	return b[9+int(b[8]):]
+}
+
+func (st *tsStream) flush() {
+	if len(st.pesBuf) == 0 {
+		return
+	}
+	br := bitio.NewBitReader(st.pesBuf, -1)
+	if dv, _, _ := st.packetsD.TryFieldFormatBitBuf("packet", br, &tsPESPacketGroup, nil); dv == nil {
+		st.packetsD.FieldRootBitBuf("packet", br)
+	}
+	st.esBuf = append(st.esBuf, pesPayload(st.pesBuf)...)
+	st.pesBuf = nil
+}
+
+func (st *tsStream) feed(payloadUnitStart bool, b []byte) {
+	if payloadUnitStart {
+		st.flush()
+		st.started = true
+	}
+	if !st.started {
+		return
+	}
+	st.pesBuf = append(st.pesBuf, b...)
+	// flush as soon as a bounded PES packet is complete
+	if l := pesLength(st.pesBuf); l != -1 && len(st.pesBuf) >= l {
+		st.pesBuf = st.pesBuf[0:l]
+		st.flush()
+		st.started = false
+	}
+}
+
+func (st *tsStream) decodeElementaryStream() {
+	if len(st.esBuf) == 0 {
+		return
+	}
+	var group *decode.Group
+	switch st.streamType {
+	case tsStreamTypeH264:
+		group = &tsAVCAnnexBGroup
+	case tsStreamTypeH265:
+		group = &tsHEVCAnnexBGroup
+	case tsStreamTypeADTS:
+		group = &tsADTSGroup
+	case tsStreamTypeMPEG1Audio, tsStreamTypeMPEG2Audio:
+		group = &tsMP3Group
+	}
+	br := bitio.NewBitReader(st.esBuf, -1)
+	if group != nil {
+		if dv, _, _ := st.d.TryFieldFormatBitBuf("data", br, group, nil); dv != nil {
+			return
+		}
+	}
+	st.d.FieldRootBitBuf("data", br)
+}
+
+// 90kHz base and 27MHz extension
+func tsFieldClockReference(d *decode.D, name string) {
+	base := d.FieldU33(name + "_base")
+	d.FieldU6(name + "_reserved")
+	extension := d.FieldU9(name + "_extension")
+	v := base*300 + extension
+	d.FieldValueUint(name, v, scalar.UintDescription(fmt.Sprintf("%.6fs", float64(v)/27_000_000)))
+}
+
+func tsDecodeAdaptationField(d *decode.D) {
+	length := d.FieldU8("length")
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		if length == 0 {
+			return
+		}
+		d.FieldBool("discontinuity_indicator")
+		d.FieldBool("random_access_indicator")
+		d.FieldBool("elementary_stream_priority_indicator")
+		pcrFlag := d.FieldBool("pcr_flag")
+		opcrFlag := d.FieldBool("opcr_flag")
+		splicingPointFlag := d.FieldBool("splicing_point_flag")
+		transportPrivateDataFlag := d.FieldBool("transport_private_data_flag")
+		extensionFlag := d.FieldBool("adaptation_field_extension_flag")
+		if pcrFlag {
+			tsFieldClockReference(d, "pcr")
+		}
+		if opcrFlag {
+			tsFieldClockReference(d, "opcr")
+		}
+		if splicingPointFlag {
+			d.FieldS8("splice_countdown")
+		}
+		if transportPrivateDataFlag {
+			l := d.FieldU8("transport_private_data_length")
+			d.FieldRawLen("transport_private_data", int64(l)*8)
+		}
+		if extensionFlag {
+			d.FieldStruct("extension", func(d *decode.D) {
+				l := d.FieldU8("length")
+				d.FramedFn(int64(l)*8, func(d *decode.D) {
+					if l == 0 {
+						return
+					}
+					ltwFlag := d.FieldBool("ltw_flag")
+					piecewiseRateFlag := d.FieldBool("piecewise_rate_flag")
+					seamlessSpliceFlag := d.FieldBool("seamless_splice_flag")
+					d.FieldU5("reserved")
+					if ltwFlag {
+						d.FieldBool("ltw_valid_flag")
+						d.FieldU15("ltw_offset")
+					}
+					if piecewiseRateFlag {
+						d.FieldU2("reserved0")
+						d.FieldU22("piecewise_rate")
+					}
+					if seamlessSpliceFlag {
+						d.FieldU4("splice_type")
+						dts0 := d.FieldU3("dts_next_au0")
+						d.FieldU1("marker_bit0")
+						dts1 := d.FieldU15("dts_next_au1")
+						d.FieldU1("marker_bit1")
+						dts2 := d.FieldU15("dts_next_au2")
+						d.FieldU1("marker_bit2")
+						d.FieldValueUint("dts_next_au", dts0<<30|dts1<<15|dts2)
+					}
+					if !d.End() {
+						d.FieldRawLen("reserved1", d.BitsLeft())
+					}
+				})
+			})
+		}
+		if !d.End() {
+			d.FieldRawLen("stuffing", d.BitsLeft())
+		}
+	})
+}
+
+func tsSyncAt(d *decode.D, pos int64, syncOffset int64) bool {
+	pos += syncOffset * 8
+	if pos+8 > d.Len() {
+		return false
+	}
+	var ok bool
+	d.SeekAbs(pos, func(d *decode.D) { ok = d.U8() == tsSyncByte })
+	return ok
+}
 
 func tsDecode(d *decode.D) any {
-	d.FieldU8("sync", d.UintAssert(0x47), scalar.UintHex)
-	d.FieldBool("transport_error_indicator")
-	d.FieldBool("payload_unit_start")
-	d.FieldBool("transport_priority")
-	d.FieldU13("pid")
-	d.FieldU2("transport_scrambling_control")
-	d.FieldU2("adaptation_field_control")
-	d.FieldU4("continuity_counter")
+	// detect packet size by looking for sync byte in first two packets
+	packetSize := int64(tsPacketSize)
+	syncOffset := int64(0)
+	switch {
+	case tsSyncAt(d, 0, 0):
+		if d.Len() > tsPacketSize*8 && !tsSyncAt(d, tsPacketSize*8, 0) {
+			d.Fatalf("no sync byte found for second packet")
+		}
+	case tsSyncAt(d, 0, 4) && tsSyncAt(d, tsM2TSPacketSize*8, 4):
+		packetSize = tsM2TSPacketSize
+		syncOffset = 4
+	default:
+		d.Fatalf("no sync byte found")
+	}
+
+	tc := &tsContext{
+		pmtPIDs:        map[uint64]bool{},
+		streams:        map[uint64]*tsStream{},
+		sectionBufs:    map[uint64][]byte{},
+		sectionStarted: map[uint64]bool{},
+	}
+	// last continuity counter per PID
+	continuityCounters := map[uint64]uint64{}
+
+	packetsD := d.FieldArrayValue("packets")
+	tc.sectionsD = d.FieldArrayValue("sections")
+	tc.streamsD = d.FieldArrayValue("streams")
+
+	for d.BitsLeft() >= packetSize*8 {
+		if !tsSyncAt(d, d.Pos(), syncOffset) {
+			// sync lost, skip to next position that looks like start of a packet and
+			// leave skipped bytes as a gap
+			pos := d.Pos() + 8
+			for ; pos+packetSize*8 <= d.Len(); pos += 8 {
+				if tsSyncAt(d, pos, syncOffset) &&
+					(pos+packetSize*8 >= d.Len() || tsSyncAt(d, pos+packetSize*8, syncOffset)) {
+					break
+				}
+			}
+			d.SeekAbs(pos)
+			continue
+		}
+
+		packetsD.FieldStruct("packet", func(d *decode.D) {
+			if packetSize == tsM2TSPacketSize {
+				d.FieldStruct("tp_extra_header", func(d *decode.D) {
+					d.FieldU2("copy_permission_indicator")
+					d.FieldU30("arrival_time_stamp")
+				})
+			}
+			d.FramedFn(tsPacketSize*8, func(d *decode.D) {
+				d.FieldU8("sync", d.UintAssert(tsSyncByte), scalar.UintHex)
+				transportError := d.FieldBool("transport_error_indicator")
+				payloadUnitStart := d.FieldBool("payload_unit_start")
+				d.FieldBool("transport_priority")
+				pid := d.FieldU13("pid", tc.pidMapper(), scalar.UintHex)
+				scramblingControl := d.FieldU2("transport_scrambling_control", tsScramblingControlNames)
+				adaptationFieldControl := d.FieldU2("adaptation_field_control", tsAdaptationFieldControlNames)
+				hasAdaptationField := adaptationFieldControl&0b10 != 0
+				hasPayload := adaptationFieldControl&0b01 != 0
+
+				// discontinuity_indicator is the first flag bit after adaptation field length
+				discontinuity := false
+				if hasAdaptationField {
+					v := d.PeekUintBits(4 + 16)
+					discontinuity = (v>>8)&0xff != 0 && v&0x80 != 0
+				}
+				var continuityCounterMappers []scalar.UintMapper
+				if last, ok := continuityCounters[pid]; ok && pid != tsPIDNull && !discontinuity {
+					if hasPayload {
+						// counter increments for each packet with payload, one duplicate is allowed
+						continuityCounterMappers = append(continuityCounterMappers, d.UintValidate((last+1)&0xf, last))
+					} else {
+						continuityCounterMappers = append(continuityCounterMappers, d.UintValidate(last))
+					}
+				}
+				continuityCounters[pid] = d.FieldU4("continuity_counter", continuityCounterMappers...)
+
+				if hasAdaptationField {
+					d.FieldStruct("adaptation_field", tsDecodeAdaptationField)
+				}
+				if !hasPayload || d.End() {
+					if !d.End() {
+						d.FieldRawLen("stuffing", d.BitsLeft())
+					}
+					return
+				}
+
+				// payload of scrambled or erroneous packets can't be demuxed
+				if transportError || scramblingControl != 0 || pid == tsPIDNull {
+					d.FieldRawLen("payload", d.BitsLeft())
+					return
+				}
+
+				isPSI := pid == tsPIDPAT || tc.pmtPIDs[pid]
+				if isPSI {
+					if payloadUnitStart {
+						pointerField := d.FieldU8("pointer_field")
+						if pointerField > 0 {
+							// end of section started in previous packet
+							if tc.sectionStarted[pid] {
+								tc.feedSection(d, pid, d.PeekBytes(int(pointerField)))
+							}
+							d.FieldRawLen("section_end", int64(pointerField)*8)
+						}
+						tc.sectionBufs[pid] = nil
+						tc.sectionStarted[pid] = true
+					}
+					if tc.sectionStarted[pid] {
+						tc.feedSection(d, pid, d.PeekBytes(int(d.BitsLeft()/8)))
+					}
+					d.FieldRawLen("payload", d.BitsLeft())
+					return
+				}
+
+				if st, ok := tc.streams[pid]; ok {
+					st.feed(payloadUnitStart, d.PeekBytes(int(d.BitsLeft()/8)))
+				}
+				d.FieldRawLen("payload", d.BitsLeft())
+			})
+		})
+	}
+
+	for _, st := range tc.streamOrder {
+		st.flush()
+		st.decodeElementaryStream()
+	}
 
 	return nil
 }
@@ -0,0 +1,156 @@
+#!/usr/bin/env python3
+# generates mpeg transport stream test files with a PAT, a PMT that spans two packets,
+# a H.264 stream in unbounded PES packets and an ADTS stream in bounded PES packets.
+import struct
+
+PMT_PID = 0x100
+VIDEO_PID = 0x101
+AUDIO_PID = 0x102
+NULL_PID = 0x1FFF
+
+
+def crc32_mpeg(b):
+    crc = 0xFFFFFFFF
+    for c in b:
+        crc ^= c << 24
+        for _ in range(8):
+            crc = (crc << 1) ^ 0x04C11DB7 if crc & 0x80000000 else crc << 1
+            crc &= 0xFFFFFFFF
+    return crc
+
+
+def section(table_id, table_id_extension, body):
+    # section_syntax_indicator=1, private_indicator=0, version 0, current_next_indicator=1
+    length = 5 + len(body) + 4
+    s = struct.pack(">BHHBBB", table_id, 0xB000 | length, table_id_extension, 0xC1, 0, 0) + body
+    return s + struct.pack(">I", crc32_mpeg(s))
+
+
+def descriptor(tag, data):
+    return bytes([tag, len(data)]) + data
+
+
+def pat():
+    return section(0x00, 1, struct.pack(">HH", 0, 0xE000 | 0x10) + struct.pack(">HH", 1, 0xE000 | PMT_PID))
+
+
+def pmt():
+    # large registration descriptor to make section span two packets
+    program_info = descriptor(0x05, b"HDMV" + bytes(range(150)))
+    video_info = descriptor(0x28, bytes([0x64, 0x00, 0x1F, 0x3F]))
+    audio_info = descriptor(0x0A, b"swe" + bytes([0x00]))
+    body = struct.pack(">HH", 0xE000 | VIDEO_PID, 0xF000 | len(program_info)) + program_info
+    body += struct.pack(">BHH", 0x1B, 0xE000 | VIDEO_PID, 0xF000 | len(video_info)) + video_info
+    body += struct.pack(">BHH", 0x0F, 0xE000 | AUDIO_PID, 0xF000 | len(audio_info)) + audio_info
+    return section(0x02, 1, body)
+
+
+def timestamp(prefix, ts):
+    return bytes(
+        [
+            prefix << 4 | ((ts >> 30) & 0x7) << 1 | 1,
+            (ts >> 22) & 0xFF,
+            ((ts >> 15) & 0x7F) << 1 | 1,
+            (ts >> 7) & 0xFF,
+            (ts & 0x7F) << 1 | 1,
+        ]
+    )
+
+
+def pes(stream_id, data, pts, bounded):
+    header = bytes([0x80, 0x80, 5]) + timestamp(0b0010, pts)
+    length = len(header) + len(data) if bounded else 0
+    return b"\x00\x00\x01" + bytes([stream_id]) + struct.pack(">H", length) + header + data
+
+
+def pcr_field(pcr):
+    base, ext = pcr // 300, pcr % 300
+    return struct.pack(">IH", base >> 1, (base & 1) << 15 | 0x7E00 | ext)
+
+
+counters = {}
+
+
+def packet(pid, payload=b"", pusi=False, af=None, cc=None):
+    if cc is None:
+        cc = counters.get(pid, 15)
+        if payload:
+            cc = (cc + 1) & 0xF
+    counters[pid] = cc
+    afc = (0b10 if af is not None else 0) | (0b01 if payload else 0)
+    header = struct.pack(">BHB", 0x47, pusi << 14 | pid, afc << 4 | cc)
+    if af is not None:
+        room = 188 - 4 - 1 - len(payload)
+        if room > 0 and not af:
+            af = b"\x00"  # no flags
+        af = af + b"\xff" * (room - len(af))
+        header += bytes([len(af)]) + af
+    p = header + payload
+    assert len(p) == 188, len(p)
+    return p
+
+
+def packetize(pid, data, pcr=None):
+    # split PES packet into transport packets, last packet is padded with adaptation field stuffing
+    out = []
+    first = True
+    while data:
+        af = None
+        if first and pcr is not None:
+            af = bytes([0x50]) + pcr_field(pcr)  # random_access_indicator and pcr_flag
+        room = 184 - (1 + len(af) if af is not None else 0)
+        if len(data) < room:
+            # need adaptation field for stuffing
+            af = af if af is not None else b""
+        chunk = data[:room]
+        out.append(packet(pid, chunk, pusi=first, af=af))
+        data = data[len(chunk) :]
+        first = False
+    return out
+
+
+def psi_packets(pid, sec):
+    payload = b"\x00" + sec
+    out = []
+    first = True
+    while payload:
+        chunk = payload[:184]
+        payload = payload[184:]
+        chunk = chunk + b"\xff" * (184 - len(chunk))
+        out.append(packet(pid, chunk, pusi=first))
+        first = False
+    return out
+
+
+video = open("avc_annexb", "rb").read()
+audio = open("adts", "rb").read()
+# split audio at adts frame boundary
+frame_len = ((audio[3] & 0x3) << 11) | (audio[4] << 3) | (audio[5] >> 5)
+
+packets = []
+packets += psi_packets(0, pat())
+packets += psi_packets(PMT_PID, pmt())
+packets += packetize(VIDEO_PID, pes(0xE0, video[:1000], 90000, False), pcr=27000000)
+packets += packetize(AUDIO_PID, pes(0xC0, audio[:frame_len], 90000, True))
+packets.append(packet(NULL_PID, b"\xff" * 184))
+packets += packetize(VIDEO_PID, pes(0xE0, video[1000:], 93003, False), pcr=27090090)
+packets += packetize(AUDIO_PID, pes(0xC0, audio[frame_len:], 91920, True))
+
+open("mpeg_ts.ts", "wb").write(b"".join(packets))
+
+# bdav m2ts with 4 byte extra header
+open("mpeg_ts.m2ts", "wb").write(
+    b"".join(struct.pack(">I", 0x40000000 | i * 1000) + p for i, p in enumerate(packets[:4]))
+)
+
+# continuity counter error, duplicate packet, discontinuity indicator and lost sync
+counters.clear()
+errors = psi_packets(0, pat())
+errors += psi_packets(PMT_PID, pmt())
+errors.append(packet(VIDEO_PID, b"\xaa" * 184))
+errors.append(errors[-1])  # duplicate is allowed
+errors.append(packet(VIDEO_PID, b"\xbb" * 184, cc=5))  # counter error
+errors.append(packet(VIDEO_PID, b"\xcc" * 182, af=b"\x80", cc=9))  # discontinuity_indicator
+errors.append(b"garbage")
+errors.append(packet(VIDEO_PID, b"\xdd" * 184))
+open("mpeg_ts_errors.ts", "wb").write(b"".join(errors))
@@ -257,6 +257,7 @@ func decodeFileHeader(d *decode.D, nc *nesContext) {
 		d.FieldU4("submapper")
 		mapper2 := d.FieldU4("mapper2")
 		d.FieldValueUint("mapper", mapper0+(mapper1<<4)+(mapper2<<8))
+		d.FieldSources("mapper", "mapper0", "mapper1", "mapper2")
 
 		// byte 9
 		chrROMSize1 := d.FieldU4("chr_rom_size1")
@@ -0,0 +1,243 @@
+package nvme
+
+// https://nvmexpress.org/specifications/
+// NVM Express Base Specification 2.0, 5.17.2.1 Identify Controller data structure
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed nvme_id_ctrl.md
+var nvmeIDCtrlFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.NVMe_ID_Ctrl,
+		&decode.Format{
+			Description: "NVMe Identify Controller data structure",
+			DecodeFn:    decodeNVMeIDCtrl,
+		})
+	interp.RegisterFS(nvmeIDCtrlFS)
+}
+
+var controllerTypeNames = scalar.UintMapSymStr{
+	0: "not_reported",
+	1: "io",
+	2: "discovery",
+	3: "administrative",
+}
+
+var version = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual != 0 {
+		s.Sym = fmt.Sprintf("%d.%d.%d", s.Actual>>16, (s.Actual>>8)&0xff, s.Actual&0xff)
+	}
+	return s, nil
+})
+
+var kelvin = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual != 0 {
+		s.Description = fmt.Sprintf("%d °C", int64(s.Actual)-273)
+	}
+	return s, nil
+})
+
+func decodePowerState(d *decode.D) {
+	d.FieldU16("mp", scalar.UintDescription("Maximum power"))
+	d.FieldU8("reserved0")
+	d.FieldU6("reserved1")
+	d.FieldBool("nops", scalar.BoolDescription("Non-operational state"))
+	d.FieldU1("mxps", scalar.UintMapSymStr{0: "0.01 W", 1: "0.0001 W"}, scalar.UintDescription("Max power scale"))
+	d.FieldU32("enlat", unitDescription("µs"))
+	d.FieldU32("exlat", unitDescription("µs"))
+	d.FieldU3("reserved2")
+	d.FieldU5("rrt", scalar.UintDescription("Relative read throughput"))
+	d.FieldU3("reserved3")
+	d.FieldU5("rrl", scalar.UintDescription("Relative read latency"))
+	d.FieldU3("reserved4")
+	d.FieldU5("rwt", scalar.UintDescription("Relative write throughput"))
+	d.FieldU3("reserved5")
+	d.FieldU5("rwl", scalar.UintDescription("Relative write latency"))
+	d.FieldU16("idlp", scalar.UintDescription("Idle power"))
+	d.FieldU2("ips", scalar.UintMapSymStr{0: "not_reported", 1: "0.0001 W", 2: "0.01 W"}, scalar.UintDescription("Idle power scale"))
+	d.FieldU6("reserved6")
+	d.FieldU8("reserved7")
+	d.FieldU16("actp", scalar.UintDescription("Active power"))
+	d.FieldU2("aps", scalar.UintMapSymStr{0: "not_reported", 1: "0.0001 W", 2: "0.01 W"}, scalar.UintDescription("Active power scale"))
+	d.FieldU3("reserved8")
+	d.FieldU3("apw", scalar.UintDescription("Active power workload"))
+	d.FieldRawLen("reserved9", 9*8)
+}
+
+func decodeNVMeIDCtrl(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	if d.BitsLeft() < identifySize*8 {
+		d.Fatalf("less than %d bytes", identifySize)
+	}
+
+	d.FieldU16("vid", scalar.UintHex, scalar.UintDescription("PCI vendor ID"))
+	d.FieldU16("ssvid", scalar.UintHex, scalar.UintDescription("PCI subsystem vendor ID"))
+	d.FieldUTF8("sn", 20, scalar.ActualTrimSpace, scalar.StrDescription("Serial number"))
+	d.FieldUTF8("mn", 40, scalar.ActualTrimSpace, scalar.StrDescription("Model number"))
+	d.FieldUTF8("fr", 8, scalar.ActualTrimSpace, scalar.StrDescription("Firmware revision"))
+	d.FieldU8("rab", scalar.UintDescription("Recommended arbitration burst"))
+	d.FieldU24("ieee", scalar.UintHex, scalar.UintDescription("IEEE OUI identifier"))
+	d.FieldStruct("cmic", func(d *decode.D) {
+		d.FieldU4("reserved")
+		d.FieldBool("anars", scalar.BoolDescription("Asymmetric namespace access reporting"))
+		d.FieldBool("sriov", scalar.BoolDescription("Associated with SR-IOV virtual function"))
+		d.FieldBool("mctrs", scalar.BoolDescription("Multiple controllers"))
+		d.FieldBool("mports", scalar.BoolDescription("Multiple ports"))
+	})
+	d.FieldU8("mdts", scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		if s.Actual == 0 {
+			s.Description = "No limit"
+		} else {
+			s.Description = fmt.Sprintf("%d minimum memory pages", uint64(1)<<s.Actual)
+		}
+		return s, nil
+	}))
+	d.FieldU16("cntlid", scalar.UintDescription("Controller ID"))
+	d.FieldU32("ver", version, scalar.UintDescription("Version"))
+	d.FieldU32("rtd3r", unitDescription("µs"))
+	d.FieldU32("rtd3e", unitDescription("µs"))
+	d.FieldU32("oaes", scalar.UintHex, scalar.UintDescription("Optional asynchronous events supported"))
+	d.FieldU32("ctratt", scalar.UintHex, scalar.UintDescription("Controller attributes"))
+	d.FieldU16("rrls", scalar.UintHex, scalar.UintDescription("Read recovery levels supported"))
+	d.FieldRawLen("reserved0", 9*8)
+	d.FieldU8("cntrltype", controllerTypeNames)
+	d.FieldRawLen("fguid", 16*8, scalar.RawHex)
+	d.FieldU16("crdt1", unitDescription("100 ms"))
+	d.FieldU16("crdt2", unitDescription("100 ms"))
+	d.FieldU16("crdt3", unitDescription("100 ms"))
+	d.FieldRawLen("reserved1", 106*8)
+	d.FieldRawLen("nvme_mi_reserved", 16*8)
+
+	// little endian bit fields are decoded byte by byte
+	d.FieldStruct("oacs", func(d *decode.D) {
+		d.FieldBool("virtualization_management")
+		d.FieldBool("nvme_mi")
+		d.FieldBool("directives")
+		d.FieldBool("device_self_test")
+		d.FieldBool("namespace_management")
+		d.FieldBool("firmware")
+		d.FieldBool("format_nvm")
+		d.FieldBool("security")
+		d.FieldU5("reserved")
+		d.FieldBool("command_feature_lockdown")
+		d.FieldBool("get_lba_status")
+		d.FieldBool("doorbell_buffer_config")
+	})
+	d.FieldU8("acl", zerosBased, scalar.UintDescription("Abort command limit"))
+	d.FieldU8("aerl", zerosBased, scalar.UintDescription("Asynchronous event request limit"))
+	d.FieldStruct("frmw", func(d *decode.D) {
+		d.FieldU2("reserved")
+		d.FieldBool("multiple_update_detection")
+		d.FieldBool("activation_without_reset")
+		d.FieldU3("slots")
+		d.FieldBool("slot1_read_only")
+	})
+	d.FieldU8("lpa", scalar.UintHex, scalar.UintDescription("Log page attributes"))
+	d.FieldU8("elpe", zerosBased, scalar.UintDescription("Error log page entries"))
+	npss := d.FieldU8("npss", zerosBased, scalar.UintDescription("Number of power states support"))
+	d.FieldU8("avscc", scalar.UintHex, scalar.UintDescription("Admin vendor specific command configuration"))
+	d.FieldU8("apsta", scalar.UintHex, scalar.UintDescription("Autonomous power state transition attributes"))
+	d.FieldU16("wctemp", kelvin)
+	d.FieldU16("cctemp", kelvin)
+	d.FieldU16("mtfa", unitDescription("100 ms"))
+	d.FieldU32("hmpre", unitDescription("4 KiB"))
+	d.FieldU32("hmmin", unitDescription("4 KiB"))
+	d.FieldUBigInt("tnvmcap", 128, bytesSize)
+	d.FieldUBigInt("unvmcap", 128, bytesSize)
+	d.FieldU32("rpmbs", scalar.UintHex, scalar.UintDescription("Replay protected memory block support"))
+	d.FieldU16("edstt", unitDescription("minutes"))
+	d.FieldU8("dsto", scalar.UintDescription("Device self-test options"))
+	d.FieldU8("fwug", unitDescription("4 KiB"))
+	d.FieldU16("kas", unitDescription("100 ms"))
+	d.FieldU16("hctma", scalar.UintDescription("Host controlled thermal management attributes"))
+	d.FieldU16("mntmt", kelvin)
+	d.FieldU16("mxtmt", kelvin)
+	d.FieldU32("sanicap", scalar.UintHex, scalar.UintDescription("Sanitize capabilities"))
+	d.FieldU32("hmminds", unitDescription("4 KiB"))
+	d.FieldU16("hmmaxd", scalar.UintDescription("Host memory maximum descriptors entries"))
+	d.FieldU16("nsetidmax", scalar.UintDescription("NVM set identifier maximum"))
+	d.FieldU16("endgidmax", scalar.UintDescription("Endurance group identifier maximum"))
+	d.FieldU8("anatt", unitDescription("seconds"))
+	d.FieldU8("anacap", scalar.UintHex, scalar.UintDescription("Asymmetric namespace access capabilities"))
+	d.FieldU32("anagrpmax", scalar.UintDescription("ANA group identifier maximum"))
+	d.FieldU32("nanagrpid", scalar.UintDescription("Number of ANA group identifiers"))
+	d.FieldU32("pels", scalar.UintDescription("Persistent event log size"))
+	d.FieldU16("domainid", scalar.UintDescription("Domain identifier"))
+	d.FieldRawLen("reserved2", 10*8)
+	d.FieldUBigInt("megcap", 128, bytesSize)
+	d.FieldRawLen("reserved3", 128*8)
+
+	d.FieldStruct("sqes", func(d *decode.D) {
+		d.FieldU4("max", unitDescription("log2 bytes"))
+		d.FieldU4("required", unitDescription("log2 bytes"))
+	})
+	d.FieldStruct("cqes", func(d *decode.D) {
+		d.FieldU4("max", unitDescription("log2 bytes"))
+		d.FieldU4("required", unitDescription("log2 bytes"))
+	})
+	d.FieldU16("maxcmd", scalar.UintDescription("Maximum outstanding commands"))
+	d.FieldU32("nn", scalar.UintDescription("Number of namespaces"))
+	d.FieldStruct("oncs", func(d *decode.D) {
+		d.FieldBool("verify")
+		d.FieldBool("timestamp")
+		d.FieldBool("reservations")
+		d.FieldBool("save_select")
+		d.FieldBool("write_zeroes")
+		d.FieldBool("dataset_management")
+		d.FieldBool("write_uncorrectable")
+		d.FieldBool("compare")
+		d.FieldU7("reserved")
+		d.FieldBool("copy")
+	})
+	d.FieldU16("fuses", scalar.UintHex, scalar.UintDescription("Fused operation support"))
+	d.FieldU8("fna", scalar.UintHex, scalar.UintDescription("Format NVM attributes"))
+	d.FieldStruct("vwc", func(d *decode.D) {
+		d.FieldU5("reserved")
+		d.FieldU2("flush_behavior")
+		d.FieldBool("present")
+	})
+	d.FieldU16("awun", zerosBased, scalar.UintDescription("Atomic write unit normal"))
+	d.FieldU16("awupf", zerosBased, scalar.UintDescription("Atomic write unit power fail"))
+	d.FieldU8("icsvscc", scalar.UintHex, scalar.UintDescription("I/O command set vendor specific command configuration"))
+	d.FieldU8("nwpc", scalar.UintHex, scalar.UintDescription("Namespace write protection capabilities"))
+	d.FieldU16("acwu", zerosBased, scalar.UintDescription("Atomic compare & write unit"))
+	d.FieldU16("ocfs", scalar.UintHex, scalar.UintDescription("Optional copy formats supported"))
+	d.FieldU32("sgls", scalar.UintHex, scalar.UintDescription("SGL support"))
+	d.FieldU32("mnan", scalar.UintDescription("Maximum number of allowed namespaces"))
+	d.FieldUBigInt("maxdna", 128, bytesSize)
+	d.FieldU32("maxcna", scalar.UintDescription("Maximum configurable namespace attachments"))
+	d.FieldRawLen("reserved4", 204*8)
+	d.FieldUTF8NullFixedLen("subnqn", 256, scalar.StrDescription("NVM subsystem NVMe qualified name"))
+	d.FieldRawLen("reserved5", 768*8)
+
+	d.FieldU32("ioccsz", unitDescription("16 bytes"))
+	d.FieldU32("iorcsz", unitDescription("16 bytes"))
+	d.FieldU16("icdoff", unitDescription("16 bytes"))
+	d.FieldU8("fcatt", scalar.UintHex, scalar.UintDescription("Fabrics controller attributes"))
+	d.FieldU8("msdbd", scalar.UintDescription("Maximum SGL data block descriptors"))
+	d.FieldU16("ofcs", scalar.UintHex, scalar.UintDescription("Optional fabric commands support"))
+	d.FieldRawLen("reserved6", 242*8)
+
+	d.FieldArray("psd", func(d *decode.D) {
+		for i := uint64(0); i <= npss && i < 32; i++ {
+			d.FieldStruct("power_state", decodePowerState)
+		}
+	})
+	if n := 32 - min(npss+1, 32); n > 0 {
+		d.FieldRawLen("psd_unused", int64(n)*32*8)
+	}
+	d.FieldRawLen("vs", 1024*8)
+
+	return nil
+}
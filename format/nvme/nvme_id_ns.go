@@ -0,0 +1,177 @@
+package nvme
+
+// https://nvmexpress.org/specifications/
+// NVM Command Set Specification 1.0, 4.1.5.1 Identify Namespace data structure
+
+import (
+	"embed"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed nvme_id_ns.md
+var nvmeIDNSFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.NVMe_ID_NS,
+		&decode.Format{
+			Description: "NVMe Identify Namespace data structure",
+			DecodeFn:    decodeNVMeIDNS,
+		})
+	interp.RegisterFS(nvmeIDNSFS)
+}
+
+const (
+	lbafOffset = 128
+	lbafMax    = 64
+)
+
+var relativePerformanceNames = scalar.UintMapSymStr{
+	0: "best",
+	1: "better",
+	2: "good",
+	3: "degraded",
+}
+
+var protectionTypeNames = scalar.UintMapSymStr{
+	0: "disabled",
+	1: "type1",
+	2: "type2",
+	3: "type3",
+}
+
+func blocksSize(blockSize uint64) scalar.UintFn {
+	return scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		if blockSize != 0 {
+			s.Description = sizeDescription(float64(s.Actual) * float64(blockSize))
+		}
+		return s, nil
+	})
+}
+
+func decodeNVMeIDNS(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	if d.BitsLeft() < identifySize*8 {
+		d.Fatalf("less than %d bytes", identifySize)
+	}
+
+	// block counts are in the formatted LBA size which comes later
+	bs := d.PeekBytes(identifySize)
+	flbas := bs[26]
+	formatIndex := uint64(flbas&0xf) | uint64(flbas>>5&0x3)<<4
+	var blockSize uint64
+	if formatIndex < lbafMax {
+		lbaf := binary.LittleEndian.Uint32(bs[lbafOffset+formatIndex*4:])
+		if lbads := (lbaf >> 16) & 0xff; lbads >= 9 && lbads < 64 {
+			blockSize = 1 << lbads
+		}
+	}
+
+	d.FieldU64("nsze", blocksSize(blockSize))
+	d.FieldU64("ncap", blocksSize(blockSize))
+	d.FieldU64("nuse", blocksSize(blockSize))
+	d.FieldStruct("nsfeat", func(d *decode.D) {
+		d.FieldU3("reserved")
+		d.FieldBool("optperf")
+		d.FieldBool("uidreuse")
+		d.FieldBool("dae")
+		d.FieldBool("nsabp")
+		d.FieldBool("thinp")
+	})
+	nlbaf := d.FieldU8("nlbaf", zerosBased, scalar.UintDescription("Number of LBA formats"))
+	d.FieldStruct("flbas", func(d *decode.D) {
+		d.FieldU1("reserved")
+		d.FieldU2("format_index_high")
+		d.FieldBool("extended_metadata")
+		d.FieldU4("format_index_low")
+		d.FieldValueUint("format_index", formatIndex)
+	})
+	d.FieldStruct("mc", func(d *decode.D) {
+		d.FieldU6("reserved")
+		d.FieldBool("separate_buffer")
+		d.FieldBool("extended_lba")
+	})
+	d.FieldStruct("dpc", func(d *decode.D) {
+		d.FieldU3("reserved")
+		d.FieldBool("last_bytes")
+		d.FieldBool("first_bytes")
+		d.FieldBool("type3")
+		d.FieldBool("type2")
+		d.FieldBool("type1")
+	})
+	d.FieldStruct("dps", func(d *decode.D) {
+		d.FieldU4("reserved")
+		d.FieldBool("first_bytes")
+		d.FieldU3("type", protectionTypeNames)
+	})
+	d.FieldStruct("nmic", func(d *decode.D) {
+		d.FieldU7("reserved")
+		d.FieldBool("shared")
+	})
+	d.FieldU8("rescap", scalar.UintHex, scalar.UintDescription("Reservation capabilities"))
+	d.FieldStruct("fpi", func(d *decode.D) {
+		d.FieldBool("supported")
+		d.FieldU7("remaining", unitDescription("percent"))
+	})
+	d.FieldU8("dlfeat", scalar.UintHex, scalar.UintDescription("Deallocate logical block features"))
+	d.FieldU16("nawun", zerosBased, scalar.UintDescription("Namespace atomic write unit normal"))
+	d.FieldU16("nawupf", zerosBased, scalar.UintDescription("Namespace atomic write unit power fail"))
+	d.FieldU16("nacwu", zerosBased, scalar.UintDescription("Namespace atomic compare & write unit"))
+	d.FieldU16("nabsn", zerosBased, scalar.UintDescription("Namespace atomic boundary size normal"))
+	d.FieldU16("nabo", scalar.UintDescription("Namespace atomic boundary offset"))
+	d.FieldU16("nabspf", zerosBased, scalar.UintDescription("Namespace atomic boundary size power fail"))
+	d.FieldU16("noiob", scalar.UintDescription("Namespace optimal I/O boundary"))
+	d.FieldUBigInt("nvmcap", 128, bytesSize)
+	d.FieldU16("npwg", zerosBased, scalar.UintDescription("Namespace preferred write granularity"))
+	d.FieldU16("npwa", zerosBased, scalar.UintDescription("Namespace preferred write alignment"))
+	d.FieldU16("npdg", zerosBased, scalar.UintDescription("Namespace preferred deallocate granularity"))
+	d.FieldU16("npda", zerosBased, scalar.UintDescription("Namespace preferred deallocate alignment"))
+	d.FieldU16("nows", zerosBased, scalar.UintDescription("Namespace optimal write size"))
+	d.FieldU16("mssrl", scalar.UintDescription("Maximum single source range length"))
+	d.FieldU32("mcl", scalar.UintDescription("Maximum copy length"))
+	d.FieldU8("msrc", zerosBased, scalar.UintDescription("Maximum source range count"))
+	d.FieldU8("reserved0")
+	d.FieldU8("nulbaf", scalar.UintDescription("Number of unique capability LBA formats"))
+	d.FieldRawLen("reserved1", 9*8)
+	d.FieldU32("anagrpid", scalar.UintDescription("ANA group identifier"))
+	d.FieldRawLen("reserved2", 3*8)
+	d.FieldStruct("nsattr", func(d *decode.D) {
+		d.FieldU7("reserved")
+		d.FieldBool("write_protected")
+	})
+	d.FieldU16("nvmsetid", scalar.UintDescription("NVM set identifier"))
+	d.FieldU16("endgid", scalar.UintDescription("Endurance group identifier"))
+	d.FieldRawLen("nguid", 16*8, scalar.RawHex)
+	d.FieldRawLen("eui64", 8*8, scalar.RawHex)
+
+	nFormats := min(nlbaf+1, lbafMax)
+	d.FieldArray("lbaf", func(d *decode.D) {
+		for i := uint64(0); i < nFormats; i++ {
+			d.FieldStruct("format", func(d *decode.D) {
+				d.FieldU16("ms", unitDescription("bytes"))
+				d.FieldU8("lbads", scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+					if s.Actual < 64 {
+						s.Description = fmt.Sprintf("%d bytes", uint64(1)<<s.Actual)
+					}
+					return s, nil
+				}))
+				d.FieldU6("reserved")
+				d.FieldU2("rp", relativePerformanceNames)
+				d.FieldValueBool("in_use", i == formatIndex)
+			})
+		}
+	})
+	if n := lbafMax - nFormats; n > 0 {
+		d.FieldRawLen("lbaf_unused", int64(n)*4*8)
+	}
+	d.FieldRawLen("vs", identifySize*8-d.Pos())
+
+	return nil
+}
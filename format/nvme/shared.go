@@ -0,0 +1,42 @@
+package nvme
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const identifySize = 4096
+
+// decimal units as used for drive capacities
+func sizeDescription(f float64) string {
+	units := []string{"bytes", "kB", "MB", "GB", "TB", "PB", "EB"}
+	i := 0
+	for ; f >= 1000 && i < len(units)-1; i++ {
+		f /= 1000
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", f, units[i])
+	}
+	return fmt.Sprintf("%.2f %s", f, units[i])
+}
+
+var bytesSize = scalar.BigIntFn(func(s scalar.BigInt) (scalar.BigInt, error) {
+	f, _ := new(big.Float).SetInt(s.Actual).Float64()
+	s.Description = sizeDescription(f)
+	return s, nil
+})
+
+func unitDescription(unit string) scalar.UintFn {
+	return scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		s.Description = unit
+		return s, nil
+	})
+}
+
+// 0's based values
+var zerosBased = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	s.Sym = s.Actual + 1
+	return s, nil
+})
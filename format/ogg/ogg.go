@@ -23,6 +23,8 @@ func init() {
 		format.Ogg,
 		&decode.Format{
 			Description: "OGG file",
+			Extensions:  []string{"ogg", "oga", "opus"},
+			MIMETypes:   []string{"audio/ogg"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeOgg,
 			Dependencies: []decode.Dependency{
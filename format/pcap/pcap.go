@@ -43,6 +43,8 @@ func init() {
 		format.PCAP,
 		&decode.Format{
 			Description: "PCAP packet capture",
+			Extensions:  []string{"pcap"},
+			MIMETypes:   []string{"application/vnd.tcpdump.pcap"},
 			Groups:      []*decode.Group{format.Probe},
 			Dependencies: []decode.Dependency{
 				{Groups: []*decode.Group{format.Link_Frame}, Out: &pcapLinkFrameGroup},
@@ -4,7 +4,9 @@ package pcap
 
 import (
 	"encoding/binary"
+	"math/big"
 	"net"
+	"time"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/inet/flowsdecoder"
@@ -22,6 +24,7 @@ func init() {
 		format.PCAPNG,
 		&decode.Format{
 			Description: "PCAPNG packet capture",
+			Extensions:  []string{"pcapng"},
 			RootArray:   true,
 			Groups:      []*decode.Group{format.Probe},
 			Dependencies: []decode.Dependency{
@@ -46,23 +49,28 @@ var ngEndianMap = scalar.UintMapSymStr{
 const (
 	blockTypeSectionHeader        = 0x0a0d0d0a
 	blockTypeInterfaceDescription = 0x00000001
+	blockTypePacket               = 0x00000002
+	blockTypeSimplePacket         = 0x00000003
 	blockTypeNameResolution       = 0x00000004
 	blockTypeInterfaceStatistics  = 0x00000005
 	blockTypeEnhancedPacketBlock  = 0x00000006
+	blockTypeDecryptionSecrets    = 0x0000000a
+	blockTypeCustom               = 0x00000bad
+	blockTypeCustomNoCopy         = 0x40000bad
 )
 
 // from https://pcapng.github.io/pcapng/draft-ietf-opsawg-pcapng.html#section_block_code_registry
 var blockTypeMap = scalar.UintMap{
 	blockTypeInterfaceDescription: {Sym: "interface_description"},
-	0x00000002:                    {Description: "Packet Block"},
-	0x00000003:                    {Description: "Simple Packet Block"},
+	blockTypePacket:               {Sym: "packet", Description: "Packet Block (obsolete)"},
+	blockTypeSimplePacket:         {Sym: "simple_packet"},
 	blockTypeNameResolution:       {Sym: "name_resolution"},
 	blockTypeInterfaceStatistics:  {Sym: "interface_statistics"},
 	blockTypeEnhancedPacketBlock:  {Sym: "enhanced_packet"},
 	0x00000007:                    {Description: "IRIG Timestamp Block"},
 	0x00000008:                    {Description: "ARINC 429 in AFDX Encapsulation Information Block"},
 	0x00000009:                    {Description: "systemd Journal Export Block"},
-	0x0000000a:                    {Description: "Decryption Secrets Block"},
+	blockTypeDecryptionSecrets:    {Sym: "decryption_secrets"},
 	0x00000101:                    {Description: "Hone Project Machine Info Block"},
 	0x00000102:                    {Description: "Hone Project Connection Event Block"},
 	0x00000201:                    {Description: "Sysdig Machine Info Block"},
@@ -78,14 +86,18 @@ var blockTypeMap = scalar.UintMap{
 	0x00000211:                    {Description: "Sysdig Process Info Block, version 5"},
 	0x00000212:                    {Description: "Sysdig Process Info Block, version 6"},
 	0x00000213:                    {Description: "Sysdig Process Info Block, version 7"},
-	0x00000bad:                    {Description: "Custom Block that rewriters can copy into new files"},
-	0x40000bad:                    {Description: "Custom Block that rewriters should not copy into new files"},
+	blockTypeCustom:               {Sym: "custom", Description: "Custom Block that rewriters can copy into new files"},
+	blockTypeCustomNoCopy:         {Sym: "custom_no_copy", Description: "Custom Block that rewriters should not copy into new files"},
 	blockTypeSectionHeader:        {Sym: "section_header"},
 }
 
 const (
-	optionEnd     = 0
-	optionComment = 1
+	optionEnd                = 0
+	optionComment            = 1
+	optionCustomUTF8         = 2988
+	optionCustomBinary       = 2989
+	optionCustomUTF8NoCopy   = 19372
+	optionCustomBinaryNoCopy = 19373
 
 	sectionHeaderOptionHardware = 2
 	sectionHeaderOptionOS       = 3
@@ -94,6 +106,7 @@ const (
 	interfaceDescriptionName        = 2
 	interfaceDescriptionDescription = 3
 	interfaceDescriptionIPv4addr    = 4
+	interfaceDescriptionIPv6addr    = 5
 	interfaceDescriptionMACaddr     = 6
 	interfaceDescriptionEUIaddr     = 7
 	interfaceDescriptionSpeed       = 8
@@ -103,10 +116,17 @@ const (
 	interfaceDescriptionOS          = 12
 	interfaceDescriptionFcslen      = 13
 	interfaceDescriptionTsoffset    = 14
+	interfaceDescriptionHardware    = 15
+	interfaceDescriptionTxspeed     = 16
+	interfaceDescriptionRxspeed     = 17
+	interfaceDescriptionIANATzname  = 18
 
 	enhancedPacketFlags     = 2
 	enhancedPacketHash      = 3
 	enhancedPacketDropcount = 4
+	enhancedPacketPacketID  = 5
+	enhancedPacketQueue     = 6
+	enhancedPacketVerdict   = 7
 
 	nameResolutionDNSName    = 2
 	nameResolutionDNSIP4addr = 3
@@ -121,20 +141,28 @@ const (
 	interfaceStatisticsUsrdeliv     = 8
 )
 
-var sectionHeaderOptionsMap = scalar.UintMap{
-	optionEnd:                   {Sym: "end", Description: "End of options"},
-	optionComment:               {Sym: "comment", Description: "Comment"},
+// adds options valid for all blocks
+func optionsMap(m scalar.UintMap) scalar.UintMap {
+	m[optionEnd] = scalar.Uint{Sym: "end", Description: "End of options"}
+	m[optionComment] = scalar.Uint{Sym: "comment", Description: "Comment"}
+	m[optionCustomUTF8] = scalar.Uint{Sym: "custom_utf8"}
+	m[optionCustomBinary] = scalar.Uint{Sym: "custom_binary"}
+	m[optionCustomUTF8NoCopy] = scalar.Uint{Sym: "custom_utf8_no_copy"}
+	m[optionCustomBinaryNoCopy] = scalar.Uint{Sym: "custom_binary_no_copy"}
+	return m
+}
+
+var sectionHeaderOptionsMap = optionsMap(scalar.UintMap{
 	sectionHeaderOptionHardware: {Sym: "hardware"},
 	sectionHeaderOptionOS:       {Sym: "os"},
 	sectionHeaderOptionUserAppl: {Sym: "userappl"},
-}
+})
 
-var interfaceDescriptionOptionsMap = scalar.UintMap{
-	optionEnd:                       {Sym: "end", Description: "End of options"},
-	optionComment:                   {Sym: "comment", Description: "Comment"},
+var interfaceDescriptionOptionsMap = optionsMap(scalar.UintMap{
 	interfaceDescriptionName:        {Sym: "name"},
 	interfaceDescriptionDescription: {Sym: "description"},
 	interfaceDescriptionIPv4addr:    {Sym: "ipv4addr"},
+	interfaceDescriptionIPv6addr:    {Sym: "ipv6addr"},
 	interfaceDescriptionMACaddr:     {Sym: "macaddr"},
 	interfaceDescriptionEUIaddr:     {Sym: "euiaddr"},
 	interfaceDescriptionSpeed:       {Sym: "speed"},
@@ -144,27 +172,28 @@ var interfaceDescriptionOptionsMap = scalar.UintMap{
 	interfaceDescriptionOS:          {Sym: "os"},
 	interfaceDescriptionFcslen:      {Sym: "fcslen"},
 	interfaceDescriptionTsoffset:    {Sym: "tsoffset"},
-}
+	interfaceDescriptionHardware:    {Sym: "hardware"},
+	interfaceDescriptionTxspeed:     {Sym: "txspeed"},
+	interfaceDescriptionRxspeed:     {Sym: "rxspeed"},
+	interfaceDescriptionIANATzname:  {Sym: "iana_tzname"},
+})
 
-var enhancedPacketOptionsMap = scalar.UintMap{
-	optionEnd:               {Sym: "end", Description: "End of options"},
-	optionComment:           {Sym: "comment", Description: "Comment"},
+var enhancedPacketOptionsMap = optionsMap(scalar.UintMap{
 	enhancedPacketFlags:     {Sym: "flags"},
 	enhancedPacketHash:      {Sym: "hash"},
 	enhancedPacketDropcount: {Sym: "dropcount"},
-}
+	enhancedPacketPacketID:  {Sym: "packetid"},
+	enhancedPacketQueue:     {Sym: "queue"},
+	enhancedPacketVerdict:   {Sym: "verdict"},
+})
 
-var nameResolutionOptionsMap = scalar.UintMap{
-	optionEnd:                {Sym: "end", Description: "End of options"},
-	optionComment:            {Sym: "comment", Description: "Comment"},
+var nameResolutionOptionsMap = optionsMap(scalar.UintMap{
 	nameResolutionDNSName:    {Sym: "dnsname"},
 	nameResolutionDNSIP4addr: {Sym: "dnsip4addr"},
 	nameResolutionDNSIP6addr: {Sym: "dnsip6addr"},
-}
+})
 
-var interfaceStatisticsOptionsMap = scalar.UintMap{
-	optionEnd:                       {Sym: "end", Description: "End of options"},
-	optionComment:                   {Sym: "comment", Description: "Comment"},
+var interfaceStatisticsOptionsMap = optionsMap(scalar.UintMap{
 	interfaceStatisticsStarttime:    {Sym: "starttime"},
 	interfaceStatisticsEndtime:      {Sym: "endtime"},
 	interfaceStatisticsIfRecv:       {Sym: "ifrecv"},
@@ -172,21 +201,81 @@ var interfaceStatisticsOptionsMap = scalar.UintMap{
 	interfaceStatisticsFilterAccept: {Sym: "filteraccept"},
 	interfaceStatisticsOSDrop:       {Sym: "osdrop"},
 	interfaceStatisticsUsrdeliv:     {Sym: "usrdeliv"},
-}
+})
+
+var genericOptionsMap = optionsMap(scalar.UintMap{})
 
 const (
-	nameResolutionRecordEnd  = 0x0000
-	nameResolutionRecordIpv4 = 0x0001
-	nameResolutionRecordIpv6 = 0x0002
+	nameResolutionRecordEnd   = 0x0000
+	nameResolutionRecordIpv4  = 0x0001
+	nameResolutionRecordIpv6  = 0x0002
+	nameResolutionRecordEUI48 = 0x0003
+	nameResolutionRecordEUI64 = 0x0004
 )
 
 var nameResolutionRecordMap = scalar.UintMapSymStr{
-	nameResolutionRecordEnd:  "end",
-	nameResolutionRecordIpv4: "ipv4",
-	nameResolutionRecordIpv6: "ipv6",
+	nameResolutionRecordEnd:   "end",
+	nameResolutionRecordIpv4:  "ipv4",
+	nameResolutionRecordIpv6:  "ipv6",
+	nameResolutionRecordEUI48: "eui48",
+	nameResolutionRecordEUI64: "eui64",
+}
+
+var packetDirectionMap = scalar.UintMapSymStr{
+	0: "not_available",
+	1: "inbound",
+	2: "outbound",
+}
+
+var packetReceptionTypeMap = scalar.UintMapSymStr{
+	0: "not_specified",
+	1: "unicast",
+	2: "multicast",
+	3: "broadcast",
+	4: "promiscuous",
+}
+
+var packetHashAlgorithmMap = scalar.UintMapSymStr{
+	0: "twos_complement",
+	1: "xor",
+	2: "crc32",
+	3: "md5",
+	4: "sha1",
+	5: "toeplitz",
+}
+
+var packetVerdictTypeMap = scalar.UintMapSymStr{
+	0: "hardware",
+	1: "linux_ebpf_tc",
+	2: "linux_ebpf_xdp",
 }
 
-func decoodeOptions(d *decode.D, opts scalar.UintMap) {
+var filterTypeMap = scalar.UintMapSymStr{
+	0: "libpcap",
+	1: "ebpf",
+}
+
+const (
+	secretsTypeTLSKeyLog   = 0x544c534b
+	secretsTypeSSHKeyLog   = 0x5353484b
+	secretsTypeWireGuard   = 0x57474b4c
+	secretsTypeZigBeeNWK   = 0x5a4e574b
+	secretsTypeZigBeeAPS   = 0x5a415053
+	secretsTypeOPCUAKeyLog = 0x55414b4c
+)
+
+var secretsTypeMap = scalar.UintMapSymStr{
+	secretsTypeTLSKeyLog:   "tls_key_log",
+	secretsTypeSSHKeyLog:   "ssh_key_log",
+	secretsTypeWireGuard:   "wireguard_key_log",
+	secretsTypeZigBeeNWK:   "zigbee_nwk_key",
+	secretsTypeZigBeeAPS:   "zigbee_aps_key",
+	secretsTypeOPCUAKeyLog: "opcua_key_log",
+}
+
+type optionFns map[uint64]func(d *decode.D)
+
+func decoodeOptions(d *decode.D, opts scalar.UintMap, fns optionFns) {
 	if d.BitsLeft() < 32 {
 		return
 	}
@@ -199,7 +288,22 @@ func decoodeOptions(d *decode.D, opts scalar.UintMap) {
 				seenEnd = true
 				return
 			}
-			d.FieldUTF8NullFixedLen("value", int(length))
+			d.FramedFn(int64(length)*8, func(d *decode.D) {
+				switch code {
+				case optionCustomUTF8, optionCustomUTF8NoCopy:
+					d.FieldU32("pen")
+					d.FieldUTF8("value", int(d.BitsLeft()/8))
+				case optionCustomBinary, optionCustomBinaryNoCopy:
+					d.FieldU32("pen")
+					d.FieldRawLen("value", d.BitsLeft())
+				default:
+					if fn, ok := fns[code]; ok {
+						fn(d)
+					} else {
+						d.FieldUTF8NullFixedLen("value", int(length))
+					}
+				}
+			})
 			d.FieldRawLen("padding", int64(d.AlignBits(32)))
 		})
 	}
@@ -213,54 +317,171 @@ var mapUToIPv4Sym = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
 	return s, nil
 })
 
+func fieldIPv6(d *decode.D, name string) {
+	d.FieldStrFn(name, func(d *decode.D) string { return net.IP(d.BytesLen(16)).String() })
+}
+
+func fieldHardwareAddr(d *decode.D, name string, nBytes int) {
+	d.FieldStrFn(name, func(d *decode.D) string { return net.HardwareAddr(d.BytesLen(nBytes)).String() })
+}
+
+func fieldU64Value(d *decode.D) { d.FieldU64("value") }
+
+// fields metadata from interface description block, returns false if unknown
+func fieldInterface(d *decode.D, dc *decodeContext, interfaceID uint64) (interfaceInfo, bool) {
+	if interfaceID >= uint64(len(dc.interfaces)) {
+		d.Errorf("unknown interface id %d", interfaceID)
+		return interfaceInfo{}, false
+	}
+	ii := dc.interfaces[interfaceID]
+	if ii.name != "" {
+		d.FieldValueStr("interface_name", ii.name)
+	}
+	d.FieldValueUint("link_type", uint64(ii.linkType), format.LinkTypeMap)
+	return ii, true
+}
+
+// timestamp in seconds using the interface timestamp resolution and offset
+func fieldInterfaceTimestamp(d *decode.D, dc *decodeContext, interfaceID uint64) {
+	tsHigh := d.FieldU32("timestamp_high")
+	tsLow := d.FieldU32("timestamp_low")
+	ii, ok := fieldInterface(d, dc, interfaceID)
+	if !ok {
+		return
+	}
+	t := ii.time(tsHigh<<32 | tsLow)
+	d.FieldValueFlt(
+		"timestamp",
+		float64(t.Unix())+float64(t.Nanosecond())/1e9,
+		scalar.FltDescription(t.UTC().Format(time.RFC3339Nano)),
+	)
+}
+
+func fieldPacket(d *decode.D, dc *decodeContext, linkType int, capturedLength uint64) {
+	bs := d.ReadAllBits(d.BitBufRange(d.Pos(), int64(capturedLength)*8))
+
+	if fn, ok := linkToDecodeFn[linkType]; ok {
+		// TODO: report decode errors
+		_ = fn(dc.flowDecoder, bs)
+	}
+
+	d.FieldFormatOrRawLen(
+		"packet",
+		int64(capturedLength)*8,
+		&pcapngLinkFrameGroup,
+		format.Link_Frame_In{
+			Type:           linkType,
+			IsLittleEndian: d.Endian == decode.LittleEndian,
+		},
+	)
+
+	d.FieldRawLen("padding", int64(d.AlignBits(32)))
+}
+
+func (dc *decodeContext) linkType(interfaceID uint64) int {
+	if interfaceID < uint64(len(dc.interfaces)) {
+		return dc.interfaces[interfaceID].linkType
+	}
+	return 0
+}
+
+var enhancedPacketOptionFns = optionFns{
+	enhancedPacketFlags: func(d *decode.D) {
+		flags := d.FieldU32("value", scalar.UintHex)
+		d.FieldValueUint("direction", flags&0b11, packetDirectionMap)
+		d.FieldValueUint("reception_type", (flags>>2)&0b111, packetReceptionTypeMap)
+		d.FieldValueUint("fcs_length", (flags>>5)&0b1111)
+		d.FieldValueUint("link_layer_errors", flags>>16, scalar.UintHex)
+	},
+	enhancedPacketHash: func(d *decode.D) {
+		d.FieldU8("algorithm", packetHashAlgorithmMap)
+		d.FieldRawLen("value", d.BitsLeft())
+	},
+	enhancedPacketDropcount: fieldU64Value,
+	enhancedPacketPacketID:  fieldU64Value,
+	enhancedPacketQueue:     func(d *decode.D) { d.FieldU32("value") },
+	enhancedPacketVerdict: func(d *decode.D) {
+		d.FieldU8("type", packetVerdictTypeMap)
+		d.FieldRawLen("value", d.BitsLeft())
+	},
+}
+
 var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
-	// TODO: SimplePacket
-	// TODO: Packet
 	blockTypeSectionHeader: func(d *decode.D, dc *decodeContext) {
 		d.FieldU32BE("byte_order_magic", ngEndianMap, scalar.UintHex)
 		d.FieldU16("major_version")
 		d.FieldU16("minor_version")
 		dc.sectionLength = d.FieldS64("section_length")
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, sectionHeaderOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, sectionHeaderOptionsMap, nil) })
 
 		dc.sectionHeaderFound = true
 	},
 	blockTypeInterfaceDescription: func(d *decode.D, dc *decodeContext) {
-		typ := d.FieldU16("link_type", format.LinkTypeMap)
+		// default resolution is microseconds
+		ii := interfaceInfo{tsresolExponent: 6}
+		ii.linkType = int(d.FieldU16("link_type", format.LinkTypeMap))
 		d.FieldU16("reserved")
 		d.FieldU32("snap_len")
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceDescriptionOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) {
+			decoodeOptions(d, interfaceDescriptionOptionsMap, optionFns{
+				interfaceDescriptionName: func(d *decode.D) {
+					ii.name = d.FieldUTF8NullFixedLen("value", int(d.BitsLeft()/8))
+				},
+				interfaceDescriptionIPv4addr: func(d *decode.D) {
+					d.FieldU32BE("address", mapUToIPv4Sym, scalar.UintHex)
+					d.FieldU32BE("netmask", mapUToIPv4Sym, scalar.UintHex)
+				},
+				interfaceDescriptionIPv6addr: func(d *decode.D) {
+					fieldIPv6(d, "address")
+					d.FieldU8("prefix_length")
+				},
+				interfaceDescriptionMACaddr: func(d *decode.D) { fieldHardwareAddr(d, "value", 6) },
+				interfaceDescriptionEUIaddr: func(d *decode.D) { fieldHardwareAddr(d, "value", 8) },
+				interfaceDescriptionSpeed:   fieldU64Value,
+				interfaceDescriptionTsresol: func(d *decode.D) {
+					// most significant bit selects negative power of 2 instead of 10
+					ii.tsresolBase2 = d.FieldU1("base", scalar.UintMapSymUint{0: 10, 1: 2}) == 1
+					ii.tsresolExponent = d.FieldU7("exponent")
+				},
+				interfaceDescriptionTzone: func(d *decode.D) { d.FieldS32("value") },
+				interfaceDescriptionFilter: func(d *decode.D) {
+					d.FieldU8("type", filterTypeMap)
+					d.FieldUTF8NullFixedLen("value", int(d.BitsLeft()/8))
+				},
+				interfaceDescriptionFcslen: func(d *decode.D) { d.FieldU8("value") },
+				interfaceDescriptionTsoffset: func(d *decode.D) {
+					ii.tsOffset = d.FieldS64("value")
+				},
+				interfaceDescriptionTxspeed: fieldU64Value,
+				interfaceDescriptionRxspeed: fieldU64Value,
+			})
+		})
 
-		dc.interfaceTypes[len(dc.interfaceTypes)] = int(typ)
+		dc.interfaces = append(dc.interfaces, ii)
 	},
 	blockTypeEnhancedPacketBlock: func(d *decode.D, dc *decodeContext) {
 		interfaceID := d.FieldU32("interface_id")
-		d.FieldU32("timestamp_high")
-		d.FieldU32("timestamp_low")
+		fieldInterfaceTimestamp(d, dc, interfaceID)
 		capturedLength := d.FieldU32("capture_packet_length")
 		d.FieldU32("original_packet_length")
-
-		bs := d.ReadAllBits(d.BitBufRange(d.Pos(), int64(capturedLength)*8))
-
-		linkType := dc.interfaceTypes[int(interfaceID)]
-
-		if fn, ok := linkToDecodeFn[linkType]; ok {
-			// TODO: report decode errors
-			_ = fn(dc.flowDecoder, bs)
-		}
-
-		d.FieldFormatOrRawLen(
-			"packet",
-			int64(capturedLength)*8,
-			&pcapngLinkFrameGroup,
-			format.Link_Frame_In{
-				Type:           linkType,
-				IsLittleEndian: d.Endian == decode.LittleEndian,
-			},
-		)
-
-		d.FieldRawLen("padding", int64(d.AlignBits(32)))
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, enhancedPacketOptionsMap) })
+		fieldPacket(d, dc, dc.linkType(interfaceID), capturedLength)
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, enhancedPacketOptionsMap, enhancedPacketOptionFns) })
+	},
+	blockTypeSimplePacket: func(d *decode.D, dc *decodeContext) {
+		// always for first interface and captured length is the smallest of original length and block data
+		fieldInterface(d, dc, 0)
+		originalLength := d.FieldU32("original_packet_length")
+		capturedLength := min(originalLength, uint64(d.BitsLeft()/8))
+		fieldPacket(d, dc, dc.linkType(0), capturedLength)
+	},
+	blockTypePacket: func(d *decode.D, dc *decodeContext) {
+		interfaceID := d.FieldU16("interface_id")
+		d.FieldU16("drops_count")
+		fieldInterfaceTimestamp(d, dc, interfaceID)
+		capturedLength := d.FieldU32("capture_packet_length")
+		d.FieldU32("original_packet_length")
+		fieldPacket(d, dc, dc.linkType(interfaceID), capturedLength)
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, enhancedPacketOptionsMap, enhancedPacketOptionFns) })
 	},
 	blockTypeNameResolution: func(d *decode.D, _ *decodeContext) {
 		seenEnd := false
@@ -277,28 +498,73 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 						switch typ {
 						case nameResolutionRecordIpv4:
 							d.FieldU32BE("address", mapUToIPv4Sym, scalar.UintHex)
-							d.FieldArray("entries", func(d *decode.D) {
-								for !d.End() {
-									d.FieldUTF8Null("string")
-								}
-							})
+						case nameResolutionRecordIpv6:
+							fieldIPv6(d, "address")
+						case nameResolutionRecordEUI48:
+							fieldHardwareAddr(d, "address", 6)
+						case nameResolutionRecordEUI64:
+							fieldHardwareAddr(d, "address", 8)
 						default:
 							d.FieldUTF8NullFixedLen("value", int(d.BitsLeft()/8))
+							return
 						}
+						d.FieldArray("entries", func(d *decode.D) {
+							for !d.End() {
+								d.FieldUTF8Null("string")
+							}
+						})
 					})
 					d.FieldRawLen("padding", int64(d.AlignBits(32)))
 				})
 			}
 		})
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, nameResolutionOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) {
+			decoodeOptions(d, nameResolutionOptionsMap, optionFns{
+				nameResolutionDNSIP4addr: func(d *decode.D) { d.FieldU32BE("value", mapUToIPv4Sym, scalar.UintHex) },
+				nameResolutionDNSIP6addr: func(d *decode.D) { fieldIPv6(d, "value") },
+			})
+		})
+	},
+	blockTypeInterfaceStatistics: func(d *decode.D, dc *decodeContext) {
+		interfaceID := d.FieldU32("interface_id")
+		fieldInterfaceTimestamp(d, dc, interfaceID)
+		fieldTimestamp := func(d *decode.D) {
+			d.FieldU32("timestamp_high")
+			d.FieldU32("timestamp_low")
+		}
+		d.FieldArray("options", func(d *decode.D) {
+			decoodeOptions(d, interfaceStatisticsOptionsMap, optionFns{
+				interfaceStatisticsStarttime:    fieldTimestamp,
+				interfaceStatisticsEndtime:      fieldTimestamp,
+				interfaceStatisticsIfRecv:       fieldU64Value,
+				interfaceStatisticsIfDrop:       fieldU64Value,
+				interfaceStatisticsFilterAccept: fieldU64Value,
+				interfaceStatisticsOSDrop:       fieldU64Value,
+				interfaceStatisticsUsrdeliv:     fieldU64Value,
+			})
+		})
 	},
-	blockTypeInterfaceStatistics: func(d *decode.D, _ *decodeContext) {
-		d.FieldU32("interface_id")
-		d.FieldU32("timestamp_high")
-		d.FieldU32("timestamp_low")
+	blockTypeDecryptionSecrets: func(d *decode.D, _ *decodeContext) {
+		typ := d.FieldU32("secrets_type", secretsTypeMap, scalar.UintHex)
+		length := d.FieldU32("secrets_length")
+		switch typ {
+		case secretsTypeTLSKeyLog, secretsTypeSSHKeyLog, secretsTypeWireGuard, secretsTypeOPCUAKeyLog:
+			d.FieldUTF8("secrets", int(length))
+		default:
+			d.FieldRawLen("secrets", int64(length)*8)
+		}
 		d.FieldRawLen("padding", int64(d.AlignBits(32)))
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceStatisticsOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, genericOptionsMap, nil) })
 	},
+	blockTypeCustom: decodeCustomBlock,
+	// same layout but should not be copied by rewriters
+	blockTypeCustomNoCopy: decodeCustomBlock,
+}
+
+// custom data and options can only be parsed if the private enterprise number is known
+func decodeCustomBlock(d *decode.D, _ *decodeContext) {
+	d.FieldU32("pen")
+	d.FieldRawLen("data", d.BitsLeft())
 }
 
 func decodeBlock(d *decode.D, dc *decodeContext) {
@@ -348,11 +614,31 @@ func decodeSection(d *decode.D, dc *decodeContext) {
 	})
 }
 
+type interfaceInfo struct {
+	linkType        int
+	name            string
+	tsresolBase2    bool
+	tsresolExponent uint64
+	tsOffset        int64
+}
+
+// timestamp units to time
+func (ii interfaceInfo) time(ts uint64) time.Time {
+	base := int64(10)
+	if ii.tsresolBase2 {
+		base = 2
+	}
+	unitsPerSec := new(big.Int).Exp(big.NewInt(base), new(big.Int).SetUint64(ii.tsresolExponent), nil)
+	sec, rem := new(big.Int).QuoRem(new(big.Int).SetUint64(ts), unitsPerSec, new(big.Int))
+	nsec := rem.Mul(rem, big.NewInt(1e9)).Quo(rem, unitsPerSec)
+	return time.Unix(sec.Int64()+ii.tsOffset, nsec.Int64())
+}
+
 type decodeContext struct {
 	endian             decode.Endian
 	sectionLength      int64
 	sectionHeaderFound bool
-	interfaceTypes     map[int]int
+	interfaces         []interfaceInfo
 	flowDecoder        *flowsdecoder.Decoder
 }
 
@@ -361,8 +647,7 @@ func decodePcapng(d *decode.D) any {
 	for !d.End() {
 		fd := flowsdecoder.New(flowsdecoder.DecoderOptions{CheckTCPOptions: false})
 		dc := decodeContext{
-			interfaceTypes: map[int]int{},
-			flowDecoder:    fd,
+			flowDecoder: fd,
 		}
 
 		d.FieldStruct("section", func(d *decode.D) {
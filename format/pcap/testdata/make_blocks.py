@@ -0,0 +1,177 @@
+#!/usr/bin/env python3
+# generates a little endian pcapng with all standard block types and typed options
+import struct
+
+
+def pad4(b):
+    return b + b"\x00" * (-len(b) % 4)
+
+
+def option(code, value):
+    return struct.pack("<HH", code, len(value)) + pad4(value)
+
+
+def options(*opts):
+    if not opts:
+        return b""
+    return b"".join(opts) + struct.pack("<HH", 0, 0)
+
+
+def block(typ, body):
+    body = pad4(body)
+    length = 12 + len(body)
+    return struct.pack("<II", typ, length) + body + struct.pack("<I", length)
+
+
+def checksum(b):
+    if len(b) % 2:
+        b += b"\x00"
+    s = sum(struct.unpack(">%dH" % (len(b) // 2), b))
+    while s >> 16:
+        s = (s & 0xFFFF) + (s >> 16)
+    return ~s & 0xFFFF
+
+
+def ipv4_udp(src, dst, sport, dport, data):
+    udp = struct.pack(">HHHH", sport, dport, 8 + len(data), 0) + data
+    ip = struct.pack(">BBHHHBBH4s4s", 0x45, 0, 20 + len(udp), 0, 0x4000, 64, 17, 0, bytes(src), bytes(dst))
+    ip = ip[:10] + struct.pack(">H", checksum(ip)) + ip[12:]
+    return ip + udp
+
+
+def ethernet(dst, src, payload):
+    return bytes(dst) + bytes(src) + struct.pack(">H", 0x0800) + payload
+
+
+mac_a = [0x02, 0x00, 0x00, 0x00, 0x00, 0x01]
+mac_b = [0x02, 0x00, 0x00, 0x00, 0x00, 0x02]
+ip_a = [192, 168, 0, 1]
+ip_b = [192, 168, 0, 2]
+
+eth_packet = ethernet(mac_b, mac_a, ipv4_udp(ip_a, ip_b, 1234, 9, b"hello"))
+raw_packet = ipv4_udp([10, 0, 0, 1], [10, 0, 0, 2], 1234, 9, b"tunnel")
+
+PEN = 32473  # example enterprise number from RFC 5612
+
+out = b""
+# section header, length unknown
+out += block(
+    0x0A0D0D0A,
+    struct.pack("<IHHq", 0x1A2B3C4D, 1, 0, -1)
+    + options(
+        option(1, b"test capture"),
+        option(2, b"test hardware"),
+        option(3, b"test os"),
+        option(4, b"make_blocks.py"),
+        option(2988, struct.pack("<I", PEN) + b"custom text"),
+    ),
+)
+# interface 0, ethernet with nanosecond resolution
+out += block(
+    0x00000001,
+    struct.pack("<HHI", 1, 0, 65535)
+    + options(
+        option(2, b"eth0"),
+        option(3, b"test ethernet"),
+        option(4, bytes(ip_a) + bytes([255, 255, 255, 0])),
+        option(5, bytes.fromhex("20010db8000000000000000000000001") + bytes([64])),
+        option(6, bytes(mac_a)),
+        option(7, bytes.fromhex("0200000000000001")),
+        option(8, struct.pack("<Q", 1000000000)),
+        option(9, bytes([9])),
+        option(11, b"\x00udp port 9"),
+        option(12, b"test os"),
+        option(13, bytes([4])),
+        option(15, b"test nic"),
+        option(16, struct.pack("<Q", 100000000)),
+        option(17, struct.pack("<Q", 200000000)),
+        option(18, b"Europe/Stockholm"),
+    ),
+)
+# interface 1, raw ip with 2^-20 resolution and offset
+out += block(
+    0x00000001,
+    struct.pack("<HHI", 101, 0, 65535)
+    + options(
+        option(2, b"tun0"),
+        option(9, bytes([0x80 | 20])),
+        option(14, struct.pack("<q", 1700000000)),
+    ),
+)
+# name resolution
+out += block(
+    0x00000004,
+    option(1, bytes(ip_a) + b"a.example\x00alias.example\x00")
+    + option(2, bytes.fromhex("20010db8000000000000000000000001") + b"a6.example\x00")
+    + option(3, bytes(mac_b) + b"b.example\x00")
+    + struct.pack("<HH", 0, 0)
+    + options(
+        option(2, b"dns.example"),
+        option(3, bytes([192, 168, 0, 53])),
+        option(4, bytes.fromhex("20010db8000000000000000000000053")),
+    ),
+)
+# enhanced packet on interface 0 with comments and typed options
+ts_ns = 1700000000_123456789
+out += block(
+    0x00000006,
+    struct.pack("<IIIII", 0, ts_ns >> 32, ts_ns & 0xFFFFFFFF, len(eth_packet), len(eth_packet))
+    + pad4(eth_packet)
+    + options(
+        option(1, b"first comment"),
+        option(1, b"second comment"),
+        # outbound, unicast, 4 byte fcs, crc error
+        option(2, struct.pack("<I", 2 | 1 << 2 | 4 << 5 | 1 << 24)),
+        option(3, bytes([2]) + bytes.fromhex("deadbeef")),
+        option(4, struct.pack("<Q", 3)),
+        option(5, struct.pack("<Q", 0x0102030405060708)),
+        option(6, struct.pack("<I", 1)),
+        option(7, bytes([1]) + struct.pack("<Q", 2)),
+        option(2989, struct.pack("<I", PEN) + b"\x01\x02\x03"),
+    ),
+)
+# enhanced packet on interface 1, 1.5 seconds plus offset
+ts = 3 << 19
+out += block(
+    0x00000006,
+    struct.pack("<IIIII", 1, ts >> 32, ts & 0xFFFFFFFF, len(raw_packet), len(raw_packet))
+    + pad4(raw_packet)
+    + options(option(1, b"tunnel packet")),
+)
+# simple packet, always interface 0
+out += block(0x00000003, struct.pack("<I", len(eth_packet)) + pad4(eth_packet))
+# obsolete packet block
+ts_ns += 1000
+out += block(
+    0x00000002,
+    struct.pack("<HHIIII", 0, 0, ts_ns >> 32, ts_ns & 0xFFFFFFFF, len(eth_packet), len(eth_packet))
+    + pad4(eth_packet)
+    + options(option(1, b"obsolete packet block")),
+)
+# tls key log decryption secrets
+secrets = b"CLIENT_RANDOM 00 11\n"
+out += block(
+    0x0000000A,
+    struct.pack("<II", 0x544C534B, len(secrets)) + pad4(secrets) + options(option(1, b"keys")),
+)
+# custom block
+out += block(0x00000BAD, struct.pack("<I", PEN) + b"custom data")
+# interface statistics for interface 0
+start_ns = 1700000000_000000000
+end_ns = 1700000001_000000000
+out += block(
+    0x00000005,
+    struct.pack("<III", 0, end_ns >> 32, end_ns & 0xFFFFFFFF)
+    + options(
+        option(1, b"counters"),
+        option(2, struct.pack("<II", start_ns >> 32, start_ns & 0xFFFFFFFF)),
+        option(3, struct.pack("<II", end_ns >> 32, end_ns & 0xFFFFFFFF)),
+        option(4, struct.pack("<Q", 3)),
+        option(5, struct.pack("<Q", 1)),
+        option(6, struct.pack("<Q", 2)),
+        option(7, struct.pack("<Q", 0)),
+        option(8, struct.pack("<Q", 2)),
+    ),
+)
+
+open("blocks.pcapng", "wb").write(out)
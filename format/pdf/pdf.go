@@ -0,0 +1,653 @@
+package pdf
+
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf
+//
+// Objects are decoded in file order, xref tables and trailers are collected separately.
+// Whitespace and comments following a token are included in the token field.
+
+// TODO: LZWDecode, follow xref instead of scanning for objects?
+
+import (
+	"bytes"
+	"embed"
+	"regexp"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed pdf.jq
+//go:embed pdf.md
+var pdfFS embed.FS
+
+var probeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.PDF,
+		&decode.Format{
+			Description: "Portable Document Format",
+			Extensions:  []string{"pdf"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodePDF,
+			Functions:   []string{"torepr"},
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(pdfFS)
+}
+
+// decoded values used to look up stream lengths, filters etc
+type pdfName string
+type pdfDict map[string]any
+type pdfRef struct {
+	number     int64
+	generation int64
+}
+
+const ws = `[\x00\t\n\f\r ]`
+
+var objectHeaderRe = regexp.MustCompile(`^(\d+)` + ws + `+(\d+)` + ws + `+obj`)
+var objectHeaderAllRe = regexp.MustCompile(`(\d+)` + ws + `+(\d+)` + ws + `+obj`)
+var objectIntRe = regexp.MustCompile(`^\d+` + ws + `+\d+` + ws + `+obj` + ws + `*(\d+)`)
+var refRe = regexp.MustCompile(`^\d+` + ws + `+\d+` + ws + `+R(?:[\x00\t\n\f\r ()<>\[\]{}/%]|$)`)
+
+var xrefTableTypeNames = scalar.StrMapSymStr{
+	"f": "free",
+	"n": "in_use",
+}
+
+var xrefStreamTypeNames = scalar.UintMapSymStr{
+	0: "free",
+	1: "in_use",
+	2: "compressed",
+}
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isRegular(c byte) bool { return !isWhitespace(c) && !isDelimiter(c) }
+
+func peekByte(d *decode.D) (byte, bool) {
+	if d.BitsLeft() < 8 {
+		return 0, false
+	}
+	return byte(d.PeekUintBits(8)), true
+}
+
+func hasPrefix(d *decode.D, s string) bool { return d.TryHasBytes([]byte(s)) }
+
+func skipWhitespace(d *decode.D) {
+	for {
+		c, ok := peekByte(d)
+		if !ok || !isWhitespace(c) {
+			return
+		}
+		d.SeekRel(8)
+	}
+}
+
+func skipWhitespaceComments(d *decode.D) {
+	for {
+		skipWhitespace(d)
+		if c, ok := peekByte(d); !ok || c != '%' {
+			return
+		}
+		readLine(d)
+	}
+}
+
+// readLine reads until end of line, line ending is not included
+func readLine(d *decode.D) []byte {
+	var b []byte
+	for {
+		c, ok := peekByte(d)
+		if !ok || c == '\r' || c == '\n' {
+			return b
+		}
+		b = append(b, c)
+		d.SeekRel(8)
+	}
+}
+
+func readRegular(d *decode.D) string {
+	var b []byte
+	for {
+		c, ok := peekByte(d)
+		if !ok || !isRegular(c) {
+			return string(b)
+		}
+		b = append(b, c)
+		d.SeekRel(8)
+	}
+}
+
+func peekRegular(d *decode.D) string {
+	b := d.PeekBytes(int(min(d.BitsLeft()/8, 64)))
+	for i, c := range b {
+		if !isRegular(c) {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func readInt(d *decode.D) int64 {
+	s := readRegular(d)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		d.Fatalf("invalid integer %q", s)
+	}
+	skipWhitespaceComments(d)
+	return n
+}
+
+func fieldKeyword(d *decode.D, name string, keyword string) {
+	d.FieldStrFn(name, func(d *decode.D) string {
+		s := d.UTF8(len(keyword))
+		if s != keyword {
+			d.Fatalf("expected %q found %q", keyword, s)
+		}
+		skipWhitespaceComments(d)
+		return s
+	})
+}
+
+func fieldName(d *decode.D, name string) string {
+	return d.FieldStrFn(name, func(d *decode.D) string {
+		d.SeekRel(8)
+		s := decodeName(readRegular(d))
+		skipWhitespaceComments(d)
+		return s
+	})
+}
+
+// fieldValue adds a field for any value, dictionaries, arrays and references are structs
+func fieldValue(d *decode.D, name string) any {
+	c, ok := peekByte(d)
+	if !ok {
+		d.Fatalf("unexpected end of value")
+	}
+
+	switch {
+	case hasPrefix(d, "<<"):
+		var dict pdfDict
+		d.FieldStruct(name, func(d *decode.D) { dict = decodeDict(d) })
+		return dict
+	case c == '[':
+		var arr []any
+		d.FieldStruct(name, func(d *decode.D) { arr = decodeArray(d) })
+		return arr
+	case c == '/':
+		return pdfName(fieldName(d, name))
+	case c == '(':
+		return d.FieldStrFn(name, func(d *decode.D) string {
+			s := decodeLiteralString(d)
+			skipWhitespaceComments(d)
+			return s
+		})
+	case c == '<':
+		return d.FieldStrFn(name, func(d *decode.D) string {
+			s := decodeHexString(d)
+			skipWhitespaceComments(d)
+			return s
+		})
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		if refRe.Match(d.PeekBytes(int(min(d.BitsLeft()/8, 64)))) {
+			var ref pdfRef
+			d.FieldStruct(name, func(d *decode.D) {
+				ref.number = d.FieldSintFn("object_number", readInt)
+				ref.generation = d.FieldSintFn("generation", readInt)
+				fieldKeyword(d, "r", "R")
+			})
+			return ref
+		}
+		s := peekRegular(d)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return d.FieldSintFn(name, func(d *decode.D) int64 {
+				d.SeekRel(int64(len(s)) * 8)
+				skipWhitespaceComments(d)
+				return n
+			})
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			d.Fatalf("invalid number %q", s)
+		}
+		return d.FieldFltFn(name, func(d *decode.D) float64 {
+			d.SeekRel(int64(len(s)) * 8)
+			skipWhitespaceComments(d)
+			return f
+		})
+	}
+
+	switch s := peekRegular(d); s {
+	case "true", "false":
+		return d.FieldBoolFn(name, func(d *decode.D) bool {
+			d.SeekRel(int64(len(s)) * 8)
+			skipWhitespaceComments(d)
+			return s == "true"
+		})
+	case "null":
+		return d.FieldAnyFn(name, func(d *decode.D) any {
+			d.SeekRel(int64(len(s)) * 8)
+			skipWhitespaceComments(d)
+			return nil
+		})
+	default:
+		d.Fatalf("unknown token %q", s)
+	}
+
+	panic("unreachable")
+}
+
+func decodeDict(d *decode.D) pdfDict {
+	dict := pdfDict{}
+	fieldKeyword(d, "start", "<<")
+	d.FieldArray("pairs", func(d *decode.D) {
+		for !hasPrefix(d, ">>") {
+			if c, ok := peekByte(d); !ok || c != '/' {
+				d.Fatalf("expected dictionary key")
+			}
+			d.FieldStruct("pair", func(d *decode.D) {
+				key := fieldName(d, "key")
+				dict[key] = fieldValue(d, "value")
+			})
+		}
+	})
+	fieldKeyword(d, "end", ">>")
+	return dict
+}
+
+func decodeArray(d *decode.D) []any {
+	var arr []any
+	fieldKeyword(d, "start", "[")
+	d.FieldArray("values", func(d *decode.D) {
+		for !hasPrefix(d, "]") {
+			arr = append(arr, fieldValue(d, "value"))
+		}
+	})
+	fieldKeyword(d, "end", "]")
+	return arr
+}
+
+type decoder struct {
+	buf           []byte
+	objectOffsets map[pdfRef]int
+}
+
+// resolveInt resolves indirect integers, usually stream lengths that are written after the stream
+func (p *decoder) resolveInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case pdfRef:
+		if p.objectOffsets == nil {
+			p.objectOffsets = map[pdfRef]int{}
+			for _, m := range objectHeaderAllRe.FindAllSubmatchIndex(p.buf, -1) {
+				num, _ := strconv.ParseInt(string(p.buf[m[2]:m[3]]), 10, 64)
+				gen, _ := strconv.ParseInt(string(p.buf[m[4]:m[5]]), 10, 64)
+				p.objectOffsets[pdfRef{number: num, generation: gen}] = m[0]
+			}
+		}
+		off, ok := p.objectOffsets[v]
+		if !ok {
+			return 0, false
+		}
+		m := objectIntRe.FindSubmatch(p.buf[off:min(off+64, len(p.buf))])
+		if m == nil {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(string(m[1]), 10, 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func hasEndstream(b []byte) bool {
+	switch {
+	case bytes.HasPrefix(b, []byte("\r\n")):
+		b = b[2:]
+	case bytes.HasPrefix(b, []byte("\n")), bytes.HasPrefix(b, []byte("\r")):
+		b = b[1:]
+	}
+	return bytes.HasPrefix(b, []byte("endstream"))
+}
+
+// streamLength uses /Length if it looks correct otherwise searches for endstream
+func (p *decoder) streamLength(dict pdfDict, start int) int {
+	if n, ok := p.resolveInt(dict["Length"]); ok && n >= 0 && n <= int64(len(p.buf)-start) {
+		if hasEndstream(p.buf[start+int(n):]) {
+			return int(n)
+		}
+	}
+	i := bytes.Index(p.buf[start:], []byte("endstream"))
+	if i == -1 {
+		return -1
+	}
+	if i > 0 && p.buf[start+i-1] == '\n' {
+		i--
+	}
+	if i > 0 && p.buf[start+i-1] == '\r' {
+		i--
+	}
+	return i
+}
+
+func (p *decoder) decodeStream(d *decode.D, dict pdfDict) {
+	d.FieldStrFn("stream", func(d *decode.D) string {
+		s := d.UTF8(len("stream"))
+		// should be CRLF or LF but CR only is seen in the wild
+		switch {
+		case hasPrefix(d, "\r\n"):
+			d.SeekRel(16)
+		case hasPrefix(d, "\n"), hasPrefix(d, "\r"):
+			d.SeekRel(8)
+		}
+		return s
+	})
+
+	length := p.streamLength(dict, int(d.Pos()/8))
+	if length == -1 {
+		d.Fatalf("failed to find endstream")
+	}
+	dataLen := int64(length) * 8
+
+	filters, parms := streamFilters(dict)
+	decoded, applied, err := applyFilters(d.BytesRange(d.Pos(), length), filters, parms)
+	typ, _ := dict["Type"].(pdfName)
+	subtype, _ := dict["Subtype"].(pdfName)
+	// images without an image codec filter are raw samples
+	probe := subtype != "Image" || applied < len(filters)
+	switch {
+	case err != nil:
+		d.FieldRawLen("data", dataLen)
+	case applied == 0 && typ != "XRef" && typ != "ObjStm":
+		// no filters or only image codec filters like DCTDecode, data is probably a file
+		if probe {
+			d.FieldFormatOrRawLen("data", dataLen, &probeGroup, format.Probe_In{})
+		} else {
+			d.FieldRawLen("data", dataLen)
+		}
+	default:
+		d.FieldRawLen("data", dataLen)
+		br := bitio.NewBitReader(decoded, -1)
+		switch typ {
+		case "XRef":
+			d.FieldStructRootBitBufFn("decoded", br, func(d *decode.D) { decodeXRefStream(d, dict) })
+		case "ObjStm":
+			d.FieldStructRootBitBufFn("decoded", br, func(d *decode.D) { decodeObjectStream(d, dict) })
+		default:
+			var dv *decode.Value
+			if probe {
+				dv, _, _ = d.TryFieldFormatBitBuf("decoded", br, &probeGroup, format.Probe_In{})
+			}
+			if dv == nil {
+				d.FieldRootBitBuf("decoded", br)
+			}
+		}
+	}
+
+	d.FieldStrFn("endstream", func(d *decode.D) string {
+		skipWhitespace(d)
+		s := d.UTF8(len("endstream"))
+		if s != "endstream" {
+			d.Fatalf("expected endstream found %q", s)
+		}
+		skipWhitespaceComments(d)
+		return s
+	})
+}
+
+func (p *decoder) decodeObject(d *decode.D) {
+	d.FieldSintFn("object_number", readInt)
+	d.FieldSintFn("generation", readInt)
+	fieldKeyword(d, "obj", "obj")
+	v := fieldValue(d, "value")
+	if dict, ok := v.(pdfDict); ok && hasPrefix(d, "stream") {
+		p.decodeStream(d, dict)
+	}
+	// some writers skip endobj
+	if hasPrefix(d, "endobj") {
+		fieldKeyword(d, "endobj", "endobj")
+	}
+}
+
+func decodeXRefTable(d *decode.D) {
+	fieldKeyword(d, "xref", "xref")
+	d.FieldArray("subsections", func(d *decode.D) {
+		for {
+			if c, ok := peekByte(d); !ok || c < '0' || c > '9' {
+				break
+			}
+			d.FieldStruct("subsection", func(d *decode.D) {
+				first := d.FieldSintFn("first_object", readInt)
+				count := d.FieldSintFn("count", readInt)
+				d.FieldArray("entries", func(d *decode.D) {
+					for i := int64(0); i < count; i++ {
+						d.FieldStruct("entry", func(d *decode.D) {
+							d.FieldValueSint("object_number", first+i)
+							// entry is fixed width "nnnnnnnnnn ggggg t" and two byte end of line
+							offsetName := "offset"
+							if b := d.PeekBytes(18); b[17] == 'f' {
+								offsetName = "next_free_object"
+							}
+							d.FieldSintFn(offsetName, func(d *decode.D) int64 { return xrefTableInt(d, 10) })
+							d.FieldSintFn("generation", func(d *decode.D) int64 { return xrefTableInt(d, 5) })
+							d.FieldStrFn("type", func(d *decode.D) string {
+								s := d.UTF8(1)
+								skipWhitespace(d)
+								return s
+							}, xrefTableTypeNames)
+						})
+					}
+				})
+			})
+		}
+	})
+}
+
+func xrefTableInt(d *decode.D, nDigits int) int64 {
+	s := d.UTF8(nDigits)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		d.Fatalf("invalid xref table integer %q", s)
+	}
+	skipWhitespace(d)
+	return n
+}
+
+func decodeXRefStream(d *decode.D, dict pdfDict) {
+	var widths []int64
+	w, _ := dict["W"].([]any)
+	for _, v := range w {
+		n, _ := v.(int64)
+		if n < 0 || n > 8 {
+			d.Fatalf("invalid field width %d", n)
+		}
+		widths = append(widths, n)
+	}
+	if len(widths) != 3 || widths[0]+widths[1]+widths[2] == 0 {
+		d.Fatalf("invalid field widths %v", w)
+	}
+	var index []int64
+	if is, ok := dict["Index"].([]any); ok {
+		for _, v := range is {
+			n, _ := v.(int64)
+			index = append(index, n)
+		}
+	} else {
+		size, _ := dict["Size"].(int64)
+		index = []int64{0, size}
+	}
+
+	d.FieldArray("subsections", func(d *decode.D) {
+		for i := 0; i+1 < len(index); i += 2 {
+			first, count := index[i], index[i+1]
+			d.FieldStruct("subsection", func(d *decode.D) {
+				d.FieldValueSint("first_object", first)
+				d.FieldValueSint("count", count)
+				d.FieldArray("entries", func(d *decode.D) {
+					for j := int64(0); j < count; j++ {
+						d.FieldStruct("entry", func(d *decode.D) {
+							d.FieldValueSint("object_number", first+j)
+							// type defaults to 1 if not present
+							typ := uint64(1)
+							if widths[0] > 0 {
+								typ = d.FieldU("type", int(widths[0])*8, xrefStreamTypeNames)
+							} else {
+								d.FieldValueUint("type", typ, xrefStreamTypeNames)
+							}
+							names := [2]string{"field2", "field3"}
+							switch typ {
+							case 0:
+								names = [2]string{"next_free_object", "generation"}
+							case 1:
+								names = [2]string{"offset", "generation"}
+							case 2:
+								names = [2]string{"object_stream_number", "index"}
+							}
+							for k, n := range names {
+								if widths[k+1] > 0 {
+									d.FieldU(n, int(widths[k+1])*8)
+								}
+							}
+						})
+					}
+				})
+			})
+		}
+	})
+}
+
+func decodeObjectStream(d *decode.D, dict pdfDict) {
+	n, _ := dict["N"].(int64)
+	first, _ := dict["First"].(int64)
+	type entry struct{ number, offset int64 }
+	var entries []entry
+	d.FieldArray("index", func(d *decode.D) {
+		for i := int64(0); i < n; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				num := d.FieldSintFn("object_number", readInt)
+				off := d.FieldSintFn("offset", readInt)
+				entries = append(entries, entry{number: num, offset: off})
+			})
+		}
+	})
+	d.FieldArray("objects", func(d *decode.D) {
+		for _, e := range entries {
+			d.SeekAbs((first + e.offset) * 8)
+			d.FieldStruct("object", func(d *decode.D) {
+				d.FieldValueSint("object_number", e.number)
+				fieldValue(d, "value")
+			})
+		}
+	})
+}
+
+func (p *decoder) decodeTrailer(d *decode.D) {
+	if hasPrefix(d, "xref") {
+		d.FieldStruct("xref_table", decodeXRefTable)
+	}
+	if hasPrefix(d, "trailer") {
+		fieldKeyword(d, "trailer", "trailer")
+		fieldValue(d, "dictionary")
+	}
+	if hasPrefix(d, "startxref") {
+		fieldKeyword(d, "startxref", "startxref")
+		d.FieldSintFn("offset", func(d *decode.D) int64 {
+			s := readRegular(d)
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				d.Fatalf("invalid startxref offset %q", s)
+			}
+			// don't skip comments, %%EOF is a comment
+			skipWhitespace(d)
+			return n
+		})
+	}
+	if hasPrefix(d, "%%EOF") {
+		d.FieldStrFn("eof", func(d *decode.D) string {
+			s := d.UTF8(len("%%EOF"))
+			skipWhitespace(d)
+			return s
+		})
+	}
+}
+
+func decodePDF(d *decode.D) any {
+	p := &decoder{buf: d.BytesRange(0, int(d.Len()/8))}
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("magic", 5, d.StrAssert("%PDF-"))
+		d.FieldStrFn("version", func(d *decode.D) string {
+			s := readRegular(d)
+			skipWhitespace(d)
+			return s
+		})
+		// comment with high bytes to indicate binary content
+		if hasPrefix(d, "%") {
+			d.FieldStrFn("comment", func(d *decode.D) string {
+				d.SeekRel(8)
+				s := decodeLatin1(readLine(d))
+				skipWhitespace(d)
+				return s
+			})
+		}
+	})
+
+	var trailerPositions []int64
+	d.FieldArray("objects", func(d *decode.D) {
+		for !d.End() {
+			pos := int(d.Pos() / 8)
+			b := p.buf[pos:]
+			switch {
+			case objectHeaderRe.Match(b[:min(len(b), 64)]):
+				d.FieldStruct("object", p.decodeObject)
+			case bytes.HasPrefix(b, []byte("xref")),
+				bytes.HasPrefix(b, []byte("trailer")),
+				bytes.HasPrefix(b, []byte("startxref")):
+				trailerPositions = append(trailerPositions, d.Pos())
+				i := bytes.Index(b, []byte("%%EOF"))
+				if i == -1 {
+					d.SeekAbs(d.Len())
+					break
+				}
+				d.SeekRel(int64(i+len("%%EOF")) * 8)
+				skipWhitespace(d)
+			default:
+				// unknown line, will end up as a gap
+				readLine(d)
+				skipWhitespaceComments(d)
+			}
+		}
+	})
+
+	d.FieldArray("trailers", func(d *decode.D) {
+		for _, pos := range trailerPositions {
+			d.SeekAbs(pos)
+			d.FieldStruct("trailer", p.decodeTrailer)
+		}
+	})
+
+	return nil
+}
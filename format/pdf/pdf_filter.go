@@ -0,0 +1,236 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// image codec filters, decoded data is an image file that can be probed
+var imageFilters = map[pdfName]bool{
+	"DCTDecode":      true,
+	"DCT":            true,
+	"JPXDecode":      true,
+	"JBIG2Decode":    true,
+	"CCITTFaxDecode": true,
+	"CCF":            true,
+}
+
+// streamFilters returns filter names and decode parameters, both can be a single value or an array
+func streamFilters(dict pdfDict) ([]pdfName, []pdfDict) {
+	filter := dict["Filter"]
+	parms := dict["DecodeParms"]
+
+	var filters []pdfName
+	var filterParms []pdfDict
+	switch f := filter.(type) {
+	case pdfName:
+		filters = []pdfName{f}
+		p, _ := parms.(pdfDict)
+		filterParms = []pdfDict{p}
+	case []any:
+		ps, _ := parms.([]any)
+		for i, v := range f {
+			n, _ := v.(pdfName)
+			filters = append(filters, n)
+			var p pdfDict
+			if i < len(ps) {
+				p, _ = ps[i].(pdfDict)
+			}
+			filterParms = append(filterParms, p)
+		}
+	}
+
+	return filters, filterParms
+}
+
+// applyFilters returns decoded data and number of filters applied, stops at first image codec filter
+func applyFilters(b []byte, filters []pdfName, parms []pdfDict) ([]byte, int, error) {
+	for i, f := range filters {
+		if imageFilters[f] {
+			return b, i, nil
+		}
+		var err error
+		switch f {
+		case "FlateDecode", "Fl":
+			b, err = flateDecode(b)
+			if err == nil {
+				b, err = predictorDecode(b, parms[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			b, err = asciiHexDecode(b)
+		case "ASCII85Decode", "A85":
+			b, err = ascii85Decode(b)
+		case "RunLengthDecode", "RL":
+			b, err = runLengthDecode(b)
+		default:
+			err = fmt.Errorf("unsupported filter %s", f)
+		}
+		if err != nil {
+			return nil, i, err
+		}
+	}
+	return b, len(filters), nil
+}
+
+func flateDecode(b []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	d, err := io.ReadAll(zr)
+	// truncated streams are common, use what could be inflated
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return d, nil
+}
+
+func asciiHexDecode(b []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range b {
+		if c == '>' {
+			break
+		}
+		if !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func ascii85Decode(b []byte) ([]byte, error) {
+	b = bytes.TrimPrefix(bytes.TrimLeft(b, "\x00\t\n\f\r "), []byte("<~"))
+	if i := bytes.Index(b, []byte("~>")); i != -1 {
+		b = b[:i]
+	}
+	d := make([]byte, len(b)*4)
+	n, _, err := ascii85.Decode(d, b, true)
+	if err != nil {
+		return nil, err
+	}
+	return d[:n], nil
+}
+
+func runLengthDecode(b []byte) ([]byte, error) {
+	var d []byte
+	for i := 0; i < len(b); {
+		l := int(b[i])
+		i++
+		switch {
+		case l == 128:
+			return d, nil
+		case l < 128:
+			if i+l+1 > len(b) {
+				return nil, fmt.Errorf("run length literal outside data")
+			}
+			d = append(d, b[i:i+l+1]...)
+			i += l + 1
+		default:
+			if i >= len(b) {
+				return nil, fmt.Errorf("run length repeat outside data")
+			}
+			d = append(d, bytes.Repeat(b[i:i+1], 257-l)...)
+			i++
+		}
+	}
+	return d, nil
+}
+
+func parmInt(parms pdfDict, key string, def int) int {
+	if n, ok := parms[key].(int64); ok {
+		return int(n)
+	}
+	return def
+}
+
+// predictorDecode undoes TIFF or PNG prediction
+func predictorDecode(b []byte, parms pdfDict) ([]byte, error) {
+	predictor := parmInt(parms, "Predictor", 1)
+	if predictor == 1 {
+		return b, nil
+	}
+	colors := parmInt(parms, "Colors", 1)
+	bpc := parmInt(parms, "BitsPerComponent", 8)
+	columns := parmInt(parms, "Columns", 1)
+	if colors < 1 || colors > 32 || bpc < 1 || bpc > 16 || columns < 1 || columns > len(b)*8 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+	bpp := max(1, colors*bpc/8)
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	switch {
+	case predictor == 2:
+		if bpc != 8 {
+			return nil, fmt.Errorf("unsupported TIFF predictor bits per component %d", bpc)
+		}
+		d := append([]byte{}, b...)
+		for r := 0; r+rowLen <= len(d); r += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				d[r+i] += d[r+i-bpp]
+			}
+		}
+		return d, nil
+	case predictor >= 10:
+		// each row starts with a PNG filter type byte
+		var d []byte
+		prev := make([]byte, rowLen)
+		for r := 0; r+1+rowLen <= len(b); r += 1 + rowLen {
+			filterType := b[r]
+			row := append([]byte{}, b[r+1:r+1+rowLen]...)
+			for i := range row {
+				var left, upLeft byte
+				if i >= bpp {
+					left = row[i-bpp]
+					upLeft = prev[i-bpp]
+				}
+				up := prev[i]
+				switch filterType {
+				case 0:
+				case 1:
+					row[i] += left
+				case 2:
+					row[i] += up
+				case 3:
+					row[i] += byte((int(left) + int(up)) / 2)
+				case 4:
+					row[i] += paeth(left, up, upLeft)
+				default:
+					return nil, fmt.Errorf("unknown PNG filter type %d", filterType)
+				}
+			}
+			d = append(d, row...)
+			prev = row
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("unknown predictor %d", predictor)
+	}
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+package pdf
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/wader/fq/pkg/decode"
+)
+
+// decodeLatin1 is used for PDFDocEncoding which is close enough to latin1 for printable characters
+func decodeLatin1(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		sb.WriteRune(rune(c))
+	}
+	return sb.String()
+}
+
+// decodeText decodes text strings that are UTF-16BE or UTF-8 if they start with a BOM otherwise PDFDocEncoding
+func decodeText(b []byte) string {
+	switch {
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		b = b[2:]
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = uint16(b[i*2])<<8 | uint16(b[i*2+1])
+		}
+		return string(utf16.Decode(u))
+	case len(b) >= 3 && b[0] == 0xef && b[1] == 0xbb && b[2] == 0xbf:
+		return string(b[3:])
+	default:
+		return decodeLatin1(b)
+	}
+}
+
+// decodeName decodes #xx escapes
+func decodeName(s string) string {
+	if !strings.Contains(s, "#") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func decodeLiteralString(d *decode.D) string {
+	d.SeekRel(8)
+	var b []byte
+	depth := 1
+	for {
+		c := byte(d.U8())
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return decodeText(b)
+			}
+		case '\\':
+			c = byte(d.U8())
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// line continuation
+				if c == '\r' && hasPrefix(d, "\n") {
+					d.SeekRel(8)
+				}
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				// up to 3 octal digits
+				n := int(c - '0')
+				for i := 0; i < 2; i++ {
+					o, ok := peekByte(d)
+					if !ok || o < '0' || o > '7' {
+						break
+					}
+					n = n*8 + int(o-'0')
+					d.SeekRel(8)
+				}
+				c = byte(n)
+			}
+		}
+		b = append(b, c)
+	}
+}
+
+// decodeHexString returns hex digits as is unless it's a UTF-16 text string
+func decodeHexString(d *decode.D) string {
+	d.SeekRel(8)
+	var digits []byte
+	for {
+		c := byte(d.U8())
+		if c == '>' {
+			break
+		}
+		if !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b, err := hex.DecodeString(string(digits))
+	if err != nil {
+		d.Fatalf("invalid hex string: %s", err)
+	}
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		return decodeText(b)
+	}
+	return string(digits)
+}
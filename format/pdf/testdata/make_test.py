@@ -0,0 +1,116 @@
+#!/usr/bin/env python3
+# generates a pdf with a classic xref table and an incremental update using an
+# object stream and a xref stream, has an embedded png file and a jpeg image
+import base64
+import pathlib
+import struct
+import zlib
+
+here = pathlib.Path(__file__).parent
+png = (here / "../../png/testdata/4x4.png").read_bytes()
+jpeg = (here / "../../jpeg/testdata/4x4.jpg").read_bytes()
+
+content = b"BT /F1 24 Tf 72 720 Td (Hello) Tj ET\nq 32 0 0 32 72 660 cm /Im1 Do Q\n"
+metadata = b"""<?xml version="1.0"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/"><dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">Hello</dc:title></x:xmpmeta>
+"""
+content_z = zlib.compress(content)
+
+
+def stream(dict_, data):
+    return b"<<" + dict_ + b" >>\nstream\r\n" + data + b"\r\nendstream"
+
+
+objects = {
+    1: b"<< /Type /Catalog /Pages 2 0 R /Metadata 9 0 R\n"
+    b"   /Names << /EmbeddedFiles << /Names [(hello.png) 7 0 R] >> >> >>",
+    2: b"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+    3: b"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792]\n"
+    b"   /Resources << /Font << /F1 5 0 R >> /XObject << /Im1 6 0 R >> >>\n"
+    b"   /Contents 4 0 R >>",
+    # length is an indirect object written after the stream
+    4: stream(b" /Length 10 0 R /Filter /FlateDecode", content_z),
+    5: b"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+    6: stream(
+        b" /Type /XObject /Subtype /Image /Width 4 /Height 4 /ColorSpace /DeviceRGB"
+        b" /BitsPerComponent 8 /Filter /DCTDecode /Length %d" % len(jpeg),
+        jpeg,
+    ),
+    7: b"<< /Type /Filespec /F (hello.png) /UF <FEFF00680065006C006C006F002E0070006E0067> /EF << /F 8 0 R >> >>",
+    8: stream(
+        b" /Type /EmbeddedFile /Subtype /image#2Fpng /Params << /Size %d >> /Filter /FlateDecode /Length %d"
+        % (len(png), len(zlib.compress(png))),
+        zlib.compress(png),
+    ),
+    9: stream(
+        b" /Type /Metadata /Subtype /XML /Filter [/ASCII85Decode /FlateDecode] /Length %d"
+        % len(base64.a85encode(zlib.compress(metadata), adobe=True)),
+        base64.a85encode(zlib.compress(metadata), adobe=True),
+    ),
+    10: b"%d" % len(content_z),
+    11: b"<< /Title (Hello \\(world\\)\\n\\101) /Producer <FEFF00660071>\n"
+    b"   /CreationDate (D:20240101000000Z) /Trapped false /Rating 4.5 /Nothing null >>",
+}
+
+out = b"%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"
+offsets = {}
+for num, body in objects.items():
+    offsets[num] = len(out)
+    out += b"%d 0 obj\n" % num + body + b"\nendobj\n"
+    if num == 5:
+        out += b"% comment between objects\n"
+
+xref_offset = len(out)
+out += b"xref\n0 %d\n" % (len(objects) + 1)
+out += b"0000000000 65535 f\r\n"
+for num in objects:
+    out += b"%010d 00000 n\r\n" % offsets[num]
+out += b"trailer\n<< /Size %d /Root 1 0 R /Info 11 0 R\n" % (len(objects) + 1)
+out += b"   /ID [<0123456789abcdef0123456789abcdef> <0123456789abcdef0123456789abcdef>] >>\n"
+out += b"startxref\n%d\n%%%%EOF\n" % xref_offset
+
+# incremental update with object 13 and 14 compressed in object stream 12
+compressed = [(13, b"<< /Type /Example /Updated true /Array [1 -2 +3 .5 /Name#20With#20Space] >>"), (14, b"42")]
+header = b""
+body = b""
+for num, o in compressed:
+    header += b"%d %d " % (num, len(body))
+    body += o + b"\n"
+objstm = header + body
+offsets[12] = len(out)
+out += (
+    b"12 0 obj\n"
+    + stream(
+        b" /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d"
+        % (len(compressed), len(header), len(zlib.compress(objstm))),
+        zlib.compress(objstm),
+    )
+    + b"\nendobj\n"
+)
+
+# xref stream using png up prediction, type 1 byte, offset 2 bytes, generation/index 1 byte
+xref_stream_offset = len(out)
+rows = [
+    struct.pack(">BHB", 1, offsets[12], 0),
+    struct.pack(">BHB", 2, 12, 0),
+    struct.pack(">BHB", 2, 12, 1),
+    struct.pack(">BHB", 1, xref_stream_offset, 0),
+]
+predicted = b""
+prev = bytes(4)
+for r in rows:
+    predicted += b"\x02" + bytes((a - b) & 0xFF for a, b in zip(r, prev))
+    prev = r
+xref_z = zlib.compress(predicted)
+out += (
+    b"15 0 obj\n"
+    + stream(
+        b" /Type /XRef /Size 16 /Index [12 4] /W [1 2 1] /Root 1 0 R /Info 11 0 R /Prev %d"
+        b" /DecodeParms << /Predictor 12 /Columns 4 >> /Filter /FlateDecode /Length %d" % (xref_offset, len(xref_z)),
+        xref_z,
+    )
+    + b"\nendobj\n"
+)
+out += b"startxref\n%d\n%%%%EOF\n" % xref_stream_offset
+
+(here / "test.pdf").write_bytes(out)
@@ -0,0 +1,415 @@
+package pe
+
+// https://learn.microsoft.com/en-us/windows/win32/debug/pe-format
+
+import (
+	"embed"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed pe.md
+var peFS embed.FS
+
+var probeGroup decode.Group
+var xmlGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.PE,
+		&decode.Format{
+			Description: "Portable Executable",
+			Extensions:  []string{"exe", "dll", "sys", "efi"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    peDecode,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+				{Groups: []*decode.Group{format.XML}, Out: &xmlGroup},
+			},
+		})
+	interp.RegisterFS(peFS)
+}
+
+const (
+	dosHeaderSize  = 64
+	coffHeaderSize = 20
+)
+
+const (
+	optionalHeaderPE32     = 0x10b
+	optionalHeaderPE32Plus = 0x20b
+)
+
+var optionalHeaderMagicNames = scalar.UintMapSymStr{
+	0x107:                  "rom",
+	optionalHeaderPE32:     "pe32",
+	optionalHeaderPE32Plus: "pe32+",
+}
+
+var machineNames = scalar.UintMapSymStr{
+	0x0000: "unknown",
+	0x014c: "i386",
+	0x0166: "r4000",
+	0x01a2: "sh3",
+	0x01a6: "sh4",
+	0x01c0: "arm",
+	0x01c2: "thumb",
+	0x01c4: "armnt",
+	0x01f0: "powerpc",
+	0x0200: "ia64",
+	0x0ebc: "ebc",
+	0x5032: "riscv32",
+	0x5064: "riscv64",
+	0x5128: "riscv128",
+	0x6232: "loongarch32",
+	0x6264: "loongarch64",
+	0x8664: "amd64",
+	0xa641: "arm64ec",
+	0xaa64: "arm64",
+}
+
+var subsystemNames = scalar.UintMapSymStr{
+	0:  "unknown",
+	1:  "native",
+	2:  "windows_gui",
+	3:  "windows_cui",
+	5:  "os2_cui",
+	7:  "posix_cui",
+	8:  "native_windows",
+	9:  "windows_ce_gui",
+	10: "efi_application",
+	11: "efi_boot_service_driver",
+	12: "efi_runtime_driver",
+	13: "efi_rom",
+	14: "xbox",
+	16: "windows_boot_application",
+}
+
+const dataDirectoryResourceTable = 2
+
+var dataDirectoryNames = []string{
+	"export_table",
+	"import_table",
+	"resource_table",
+	"exception_table",
+	"certificate_table",
+	"base_relocation_table",
+	"debug",
+	"architecture",
+	"global_ptr",
+	"tls_table",
+	"load_config_table",
+	"bound_import",
+	"iat",
+	"delay_import_descriptor",
+	"clr_runtime_header",
+	"reserved",
+}
+
+type section struct {
+	virtualAddress uint64
+	rawOffset      int64 // in bits
+	rawSize        int64 // in bits
+}
+
+type peContext struct {
+	sections     []section
+	resourceRVA  uint64
+	resourceSize uint64
+}
+
+// rvaToOffset returns file offset in bits for a relative virtual address
+func (pc *peContext) rvaToOffset(rva uint64, size uint64) (int64, bool) {
+	for _, s := range pc.sections {
+		if rva < s.virtualAddress {
+			continue
+		}
+		o := int64(rva-s.virtualAddress) * 8
+		if o+int64(size)*8 <= s.rawSize {
+			return s.rawOffset + o, true
+		}
+	}
+	return 0, false
+}
+
+func peDecodeCOFFCharacteristics(d *decode.D) {
+	// little endian so first byte has the low bits
+	d.FieldBool("bytes_reversed_lo")
+	d.FieldBool("reserved")
+	d.FieldBool("large_address_aware")
+	d.FieldBool("aggressive_ws_trim")
+	d.FieldBool("local_syms_stripped")
+	d.FieldBool("line_nums_stripped")
+	d.FieldBool("executable_image")
+	d.FieldBool("relocs_stripped")
+	d.FieldBool("bytes_reversed_hi")
+	d.FieldBool("up_system_only")
+	d.FieldBool("dll")
+	d.FieldBool("system")
+	d.FieldBool("net_run_from_swap")
+	d.FieldBool("removable_run_from_swap")
+	d.FieldBool("debug_stripped")
+	d.FieldBool("machine_32bit")
+}
+
+func peDecodeDLLCharacteristics(d *decode.D) {
+	d.FieldBool("force_integrity")
+	d.FieldBool("dynamic_base")
+	d.FieldBool("high_entropy_va")
+	d.FieldU5("reserved")
+	d.FieldBool("terminal_server_aware")
+	d.FieldBool("guard_cf")
+	d.FieldBool("wdm_driver")
+	d.FieldBool("appcontainer")
+	d.FieldBool("no_bind")
+	d.FieldBool("no_seh")
+	d.FieldBool("no_isolation")
+	d.FieldBool("nx_compat")
+}
+
+var sectionAlignment = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual > 0 {
+		s.Sym = uint64(1) << (s.Actual - 1)
+	}
+	return s, nil
+})
+
+func peDecodeSectionCharacteristics(d *decode.D) {
+	d.FieldBool("cnt_uninitialized_data")
+	d.FieldBool("cnt_initialized_data")
+	d.FieldBool("cnt_code")
+	d.FieldU1("reserved0")
+	d.FieldBool("type_no_pad")
+	d.FieldU3("reserved1")
+	d.FieldBool("gprel")
+	d.FieldU2("reserved2")
+	d.FieldBool("lnk_comdat")
+	d.FieldBool("lnk_remove")
+	d.FieldU1("reserved3")
+	d.FieldBool("lnk_info")
+	d.FieldBool("lnk_other")
+	d.FieldU4("align", sectionAlignment)
+	d.FieldBool("mem_preload")
+	d.FieldBool("mem_locked")
+	d.FieldBool("mem_16bit")
+	d.FieldU1("reserved4")
+	d.FieldBool("mem_write")
+	d.FieldBool("mem_read")
+	d.FieldBool("mem_execute")
+	d.FieldBool("mem_shared")
+	d.FieldBool("mem_not_paged")
+	d.FieldBool("mem_not_cached")
+	d.FieldBool("mem_discardable")
+	d.FieldBool("lnk_nreloc_ovfl")
+}
+
+func peDecodeDOSHeader(d *decode.D) int64 {
+	d.FieldUTF8("e_magic", 2, d.StrAssert("MZ"))
+	d.FieldU16("e_cblp")
+	d.FieldU16("e_cp")
+	d.FieldU16("e_crlc")
+	d.FieldU16("e_cparhdr")
+	d.FieldU16("e_minalloc")
+	d.FieldU16("e_maxalloc")
+	d.FieldU16("e_ss", scalar.UintHex)
+	d.FieldU16("e_sp", scalar.UintHex)
+	d.FieldU16("e_csum", scalar.UintHex)
+	d.FieldU16("e_ip", scalar.UintHex)
+	d.FieldU16("e_cs", scalar.UintHex)
+	d.FieldU16("e_lfarlc", scalar.UintHex)
+	d.FieldU16("e_ovno")
+	d.FieldRawLen("e_res", 4*16)
+	d.FieldU16("e_oemid")
+	d.FieldU16("e_oeminfo")
+	d.FieldRawLen("e_res2", 10*16)
+	return int64(d.FieldU32("e_lfanew", scalar.UintHex))
+}
+
+func peDecodeOptionalHeader(d *decode.D, pc *peContext) {
+	magic := d.FieldU16("magic", optionalHeaderMagicNames, scalar.UintHex)
+	var addrBits int
+	switch magic {
+	case optionalHeaderPE32:
+		addrBits = 32
+	case optionalHeaderPE32Plus:
+		addrBits = 64
+	default:
+		d.Fatalf("unknown optional header magic 0x%x", magic)
+	}
+
+	d.FieldU8("major_linker_version")
+	d.FieldU8("minor_linker_version")
+	d.FieldU32("size_of_code")
+	d.FieldU32("size_of_initialized_data")
+	d.FieldU32("size_of_uninitialized_data")
+	d.FieldU32("address_of_entry_point", scalar.UintHex)
+	d.FieldU32("base_of_code", scalar.UintHex)
+	if addrBits == 32 {
+		d.FieldU32("base_of_data", scalar.UintHex)
+	}
+	d.FieldU("image_base", addrBits, scalar.UintHex)
+	d.FieldU32("section_alignment")
+	d.FieldU32("file_alignment")
+	d.FieldU16("major_operating_system_version")
+	d.FieldU16("minor_operating_system_version")
+	d.FieldU16("major_image_version")
+	d.FieldU16("minor_image_version")
+	d.FieldU16("major_subsystem_version")
+	d.FieldU16("minor_subsystem_version")
+	d.FieldU32("win32_version_value")
+	d.FieldU32("size_of_image")
+	d.FieldU32("size_of_headers")
+	d.FieldU32("checksum", scalar.UintHex)
+	d.FieldU16("subsystem", subsystemNames)
+	d.FieldStruct("dll_characteristics", peDecodeDLLCharacteristics)
+	d.FieldU("size_of_stack_reserve", addrBits)
+	d.FieldU("size_of_stack_commit", addrBits)
+	d.FieldU("size_of_heap_reserve", addrBits)
+	d.FieldU("size_of_heap_commit", addrBits)
+	d.FieldU32("loader_flags", scalar.UintHex)
+	numberOfRVAAndSizes := int(d.FieldU32("number_of_rva_and_sizes"))
+
+	d.FieldStruct("data_directories", func(d *decode.D) {
+		for i := 0; i < numberOfRVAAndSizes && d.BitsLeft() >= 8*8; i++ {
+			name := "unknown"
+			if i < len(dataDirectoryNames) {
+				name = dataDirectoryNames[i]
+			}
+			d.FieldStruct(name, func(d *decode.D) {
+				// certificate table address is a file offset, others are relative virtual addresses
+				address := d.FieldU32("virtual_address", scalar.UintHex)
+				size := d.FieldU32("size")
+				if i == dataDirectoryResourceTable {
+					pc.resourceRVA = address
+					pc.resourceSize = size
+				}
+			})
+		}
+	})
+}
+
+func peReadSectionHeaders(d *decode.D, pc *peContext, n int) {
+	for i := 0; i < n; i++ {
+		d.SeekRel(8 * 8) // name
+		d.U32()          // virtual size
+		virtualAddress := d.U32()
+		rawSize := d.U32()
+		rawOffset := d.U32()
+		d.SeekRel(16 * 8) // relocations, line numbers and characteristics
+		pc.sections = append(pc.sections, section{
+			virtualAddress: virtualAddress,
+			rawOffset:      int64(rawOffset) * 8,
+			rawSize:        int64(rawSize) * 8,
+		})
+	}
+}
+
+func peDecodeSectionHeader(d *decode.D, pc *peContext, s section) {
+	d.FieldUTF8NullFixedLen("name", 8)
+	d.FieldU32("virtual_size")
+	d.FieldU32("virtual_address", scalar.UintHex)
+	d.FieldU32("size_of_raw_data")
+	d.FieldU32("pointer_to_raw_data", scalar.UintHex)
+	d.FieldU32("pointer_to_relocations", scalar.UintHex)
+	d.FieldU32("pointer_to_linenumbers", scalar.UintHex)
+	d.FieldU16("number_of_relocations")
+	d.FieldU16("number_of_linenumbers")
+	d.FieldStruct("characteristics", peDecodeSectionCharacteristics)
+
+	if s.rawSize == 0 {
+		// uninitialized data, occupies no space in file
+		return
+	}
+	if s.rawOffset+s.rawSize > d.Len() {
+		d.Errorf("section raw data outside of file")
+		return
+	}
+
+	d.SeekAbs(s.rawOffset)
+	resourceOffset, resourceOk := pc.rvaToOffset(pc.resourceRVA, pc.resourceSize)
+	if pc.resourceSize == 0 || !resourceOk || resourceOffset < s.rawOffset || resourceOffset >= s.rawOffset+s.rawSize {
+		d.FieldRawLen("data", s.rawSize)
+		return
+	}
+	if n := resourceOffset - s.rawOffset; n > 0 {
+		d.FieldRawLen("data", n)
+	}
+	// resource tree entries point to anywhere in the section so gaps are left as is
+	d.SeekAbs(resourceOffset)
+	d.FieldStruct("resources", func(d *decode.D) {
+		rc := &resourceContext{base: resourceOffset, seen: map[int64]bool{resourceOffset: true}}
+		peDecodeResourceDirectory(d, pc, rc, 0, 0)
+	})
+}
+
+func peDecode(d *decode.D) any {
+	var pc peContext
+
+	d.Endian = decode.LittleEndian
+
+	if d.BitsLeft() < dosHeaderSize*8 {
+		d.Fatalf("too short for DOS header")
+	}
+	var peOffset int64
+	d.FieldStruct("dos_header", func(d *decode.D) {
+		peOffset = peDecodeDOSHeader(d) * 8
+	})
+	if peOffset < dosHeaderSize*8 || peOffset+(4+coffHeaderSize)*8 > d.Len() {
+		d.Fatalf("invalid PE header offset %d", peOffset/8)
+	}
+	if n := peOffset - d.Pos(); n > 0 {
+		d.FieldRawLen("dos_stub", n)
+	}
+
+	d.SeekAbs(peOffset)
+	d.FieldRawLen("signature", 4*8, d.AssertBitBuf([]byte("PE\x00\x00")))
+
+	var numberOfSections int
+	var sizeOfOptionalHeader int64
+	d.FieldStruct("coff_header", func(d *decode.D) {
+		d.FieldU16("machine", machineNames, scalar.UintHex)
+		numberOfSections = int(d.FieldU16("number_of_sections"))
+		d.FieldU32("time_date_stamp", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+		d.FieldU32("pointer_to_symbol_table", scalar.UintHex)
+		d.FieldU32("number_of_symbols")
+		sizeOfOptionalHeader = int64(d.FieldU16("size_of_optional_header"))
+		d.FieldStruct("characteristics", peDecodeCOFFCharacteristics)
+	})
+
+	if sizeOfOptionalHeader > 0 {
+		d.FramedFn(sizeOfOptionalHeader*8, func(d *decode.D) {
+			d.FieldStruct("optional_header", func(d *decode.D) {
+				peDecodeOptionalHeader(d, &pc)
+			})
+		})
+	}
+
+	sectionHeadersOffset := d.Pos()
+	peReadSectionHeaders(d, &pc, numberOfSections)
+
+	d.SeekAbs(sectionHeadersOffset)
+	d.FieldArray("section_headers", func(d *decode.D) {
+		for i, s := range pc.sections {
+			d.SeekAbs(sectionHeadersOffset + int64(i)*40*8)
+			d.FieldStruct("section_header", func(d *decode.D) {
+				peDecodeSectionHeader(d, &pc, s)
+			})
+		}
+	})
+
+	// data appended after the last section, ex: installer payload or signature
+	var end int64
+	for _, s := range pc.sections {
+		end = max(end, s.rawOffset+s.rawSize)
+	}
+	if end > 0 && end < d.Len() {
+		d.SeekAbs(end)
+		d.FieldFormatOrRawLen("overlay", d.BitsLeft(), &probeGroup, format.Probe_In{})
+	}
+
+	return nil
+}
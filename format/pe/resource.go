@@ -0,0 +1,188 @@
+package pe
+
+// https://learn.microsoft.com/en-us/windows/win32/debug/pe-format#the-rsrc-section
+// https://learn.microsoft.com/en-us/windows/win32/menurc/resource-types
+
+import (
+	"encoding/binary"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	rtRCData   = 10
+	rtVersion  = 16
+	rtManifest = 24
+)
+
+var resourceTypeNames = scalar.UintMapSymStr{
+	1:          "cursor",
+	2:          "bitmap",
+	3:          "icon",
+	4:          "menu",
+	5:          "dialog",
+	6:          "string",
+	7:          "fontdir",
+	8:          "font",
+	9:          "accelerator",
+	rtRCData:   "rcdata",
+	11:         "messagetable",
+	12:         "group_cursor",
+	14:         "group_icon",
+	rtVersion:  "version",
+	17:         "dlginclude",
+	19:         "plugplay",
+	20:         "vxd",
+	21:         "anicursor",
+	22:         "aniicon",
+	23:         "html",
+	rtManifest: "manifest",
+}
+
+var languageNames = scalar.UintMapDescription{
+	0x0000: "Neutral",
+	0x0400: "Process default",
+	0x0404: "Chinese (Taiwan)",
+	0x0407: "German (Germany)",
+	0x0409: "English (United States)",
+	0x040a: "Spanish (Traditional sort)",
+	0x040c: "French (France)",
+	0x0410: "Italian (Italy)",
+	0x0411: "Japanese (Japan)",
+	0x0412: "Korean (Korea)",
+	0x0413: "Dutch (Netherlands)",
+	0x0415: "Polish (Poland)",
+	0x0416: "Portuguese (Brazil)",
+	0x0419: "Russian (Russia)",
+	0x041d: "Swedish (Sweden)",
+	0x0800: "System default",
+	0x0804: "Chinese (PRC)",
+	0x0809: "English (United Kingdom)",
+	0x0c0a: "Spanish (Spain)",
+}
+
+var codePageNames = scalar.UintMapDescription{
+	0:     "Default",
+	932:   "Japanese (Shift-JIS)",
+	936:   "Simplified Chinese (GBK)",
+	949:   "Korean",
+	950:   "Traditional Chinese (Big5)",
+	1200:  "Unicode (UTF-16LE)",
+	1250:  "Central European (Windows-1250)",
+	1251:  "Cyrillic (Windows-1251)",
+	1252:  "Western European (Windows-1252)",
+	65001: "Unicode (UTF-8)",
+}
+
+// directory nesting is type, name and language but allow some more
+const maxResourceLevel = 8
+
+type resourceContext struct {
+	base int64 // start of resource directory in bits
+	seen map[int64]bool
+}
+
+// high bit of name and offset says if it is a string name or subdirectory
+func peekHighBit(d *decode.D) bool {
+	return binary.LittleEndian.Uint32(d.PeekBytes(4))&0x8000_0000 != 0
+}
+
+func peDecodeResourceDirectory(d *decode.D, pc *peContext, rc *resourceContext, level int, typ uint64) {
+	if level > maxResourceLevel {
+		d.Fatalf("resource directory nested too deep")
+	}
+
+	d.FieldU32("characteristics", scalar.UintHex)
+	d.FieldU32("time_date_stamp")
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	numberOfNamedEntries := d.FieldU16("number_of_named_entries")
+	numberOfIDEntries := d.FieldU16("number_of_id_entries")
+
+	d.FieldArray("entries", func(d *decode.D) {
+		for i := uint64(0); i < numberOfNamedEntries+numberOfIDEntries; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				entryTyp := typ
+				if peekHighBit(d) {
+					nameOffset := int64(d.FieldU32("name_offset", scalar.UintHex) & 0x7fff_ffff)
+					namePos := rc.base + nameOffset*8
+					d.RangeFn(namePos, d.Len()-namePos, func(d *decode.D) {
+						nameLength := d.FieldU16("name_length")
+						d.FieldUTF16LE("name", int(nameLength)*2)
+					})
+				} else {
+					var sms []scalar.UintMapper
+					switch level {
+					case 0:
+						sms = append(sms, resourceTypeNames)
+					case 2:
+						sms = append(sms, languageNames, scalar.UintHex)
+					}
+					id := d.FieldU32("id", sms...)
+					if level == 0 {
+						entryTyp = id
+					}
+				}
+
+				if peekHighBit(d) {
+					offset := int64(d.FieldU32("offset", scalar.UintHex) & 0x7fff_ffff)
+					dirPos := rc.base + offset*8
+					if rc.seen[dirPos] {
+						d.Fatalf("resource directory loop at offset %d", offset)
+					}
+					rc.seen[dirPos] = true
+					d.RangeFn(dirPos, d.Len()-dirPos, func(d *decode.D) {
+						d.FieldStruct("directory", func(d *decode.D) {
+							peDecodeResourceDirectory(d, pc, rc, level+1, entryTyp)
+						})
+					})
+				} else {
+					offset := int64(d.FieldU32("offset", scalar.UintHex))
+					// not limited to the entry size as data is decoded using nested ranges
+					dataEntryPos := rc.base + offset*8
+					d.RangeFn(dataEntryPos, d.Len()-dataEntryPos, func(d *decode.D) {
+						d.FieldStruct("data_entry", func(d *decode.D) {
+							peDecodeResourceDataEntry(d, pc, entryTyp)
+						})
+					})
+				}
+			})
+		}
+	})
+}
+
+func peDecodeResourceDataEntry(d *decode.D, pc *peContext, typ uint64) {
+	dataRVA := d.FieldU32("data_rva", scalar.UintHex)
+	size := d.FieldU32("size")
+	d.FieldU32("code_page", codePageNames)
+	d.FieldU32("reserved")
+
+	if size == 0 {
+		return
+	}
+	dataPos, ok := pc.rvaToOffset(dataRVA, size)
+	if !ok {
+		d.Errorf("resource data at 0x%x size %d not in a section", dataRVA, size)
+		return
+	}
+	d.RangeFn(dataPos, int64(size)*8, func(d *decode.D) {
+		switch typ {
+		case rtVersion:
+			d.FieldStruct("data", func(d *decode.D) {
+				peDecodeVersionInfoBlock(d, dataPos)
+			})
+		case rtManifest:
+			d.FieldFormatOrRawLen("data", d.BitsLeft(), &xmlGroup, nil)
+		default:
+			// rcdata and custom types are usually some embedded file, ex: firmware or monitor EDID/INF,
+			// other standard types are not probed as ex: icon bitmaps can look like mp3 frames
+			if _, ok := resourceTypeNames[typ]; ok && typ != rtRCData {
+				d.FieldRawLen("data", d.BitsLeft())
+			} else {
+				d.FieldFormatOrRawLen("data", d.BitsLeft(), &probeGroup, format.Probe_In{})
+			}
+		}
+	})
+}
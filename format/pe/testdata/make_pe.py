@@ -0,0 +1,178 @@
+# Make minimal PE images with the resources from test.res (llvm-rc output).
+# No linker needed, the .text section is just "xor eax, eax; ret".
+# Usage: python3 make_pe.py test.res
+
+import struct
+import sys
+
+FILE_ALIGN = 0x200
+SECTION_ALIGN = 0x1000
+TIMESTAMP = 1717200000
+
+DOS_STUB = (
+    bytes.fromhex("0e1fba0e00b409cd21b8014ccd21")
+    + b"This program cannot be run in DOS mode.\r\r\n$"
+)
+
+
+def align(n, a):
+    return (n + a - 1) // a * a
+
+
+def read_res_id(b, o):
+    if struct.unpack_from("<H", b, o)[0] == 0xFFFF:
+        return struct.unpack_from("<H", b, o + 2)[0], o + 4
+    s = ""
+    while True:
+        c = struct.unpack_from("<H", b, o)[0]
+        o += 2
+        if c == 0:
+            return s, o
+        s += chr(c)
+
+
+def read_res(path):
+    b = open(path, "rb").read()
+    o = 0
+    resources = []
+    while o < len(b):
+        data_size, header_size = struct.unpack_from("<II", b, o)
+        typ, p = read_res_id(b, o + 8)
+        name, p = read_res_id(b, p)
+        p = align(p, 4)
+        _, _, lang, _, _ = struct.unpack_from("<IHHII", b, p)
+        data = b[o + header_size : o + header_size + data_size]
+        if data_size > 0:
+            resources.append((typ, name, lang, data))
+        o = align(o + header_size + data_size, 4)
+    return resources
+
+
+def sort_key(k):
+    # named entries first sorted by name, then ids in ascending order
+    return (0, k.upper(), 0) if isinstance(k, str) else (1, "", k)
+
+
+def build_rsrc(resources, rva):
+    tree = {}
+    for typ, name, lang, data in resources:
+        tree.setdefault(typ, {}).setdefault(name, {})[lang] = data
+
+    # directories breadth first, then data entries, strings and data
+    dirs = []
+
+    def add_dir(node, level):
+        dirs.append((node, level))
+
+    add_dir(tree, 0)
+    i = 0
+    while i < len(dirs):
+        node, level = dirs[i]
+        if level < 2:
+            for k in sorted(node, key=sort_key):
+                add_dir(node[k], level + 1)
+        i += 1
+
+    dir_offsets = []
+    o = 0
+    for node, _ in dirs:
+        dir_offsets.append(o)
+        o += 16 + 8 * len(node)
+    data_entries_offset = o
+    n_data = sum(len(node) for node, level in dirs if level == 2)
+    o += 16 * n_data
+
+    strings = {}
+    for node, _ in dirs:
+        for k in node:
+            if isinstance(k, str) and k not in strings:
+                strings[k] = o
+                o += 2 + 2 * len(k)
+    o = align(o, 8)
+
+    out = bytearray(o)
+    for k, so in strings.items():
+        struct.pack_into("<H", out, so, len(k))
+        out[so + 2 : so + 2 + 2 * len(k)] = k.encode("utf-16-le")
+
+    child_index = 1
+    data_index = 0
+    for (node, level), do in zip(dirs, dir_offsets):
+        keys = sorted(node, key=sort_key)
+        n_named = sum(isinstance(k, str) for k in keys)
+        struct.pack_into("<IIHHHH", out, do, 0, 0, 0, 0, n_named, len(keys) - n_named)
+        for j, k in enumerate(keys):
+            name = strings[k] | 0x80000000 if isinstance(k, str) else k
+            if level < 2:
+                offset = dir_offsets[child_index] | 0x80000000
+                child_index += 1
+            else:
+                data = node[k]
+                offset = data_entries_offset + 16 * data_index
+                data_index += 1
+                struct.pack_into("<IIII", out, offset, rva + len(out), len(data), 0, 0)
+                out += data + bytes(align(len(data), 8) - len(data))
+            struct.pack_into("<II", out, do + 16 + 8 * j, name, offset)
+
+    return bytes(out)
+
+
+def build_pe(resources, machine, pe32plus):
+    text = bytes.fromhex("31c0c3")
+    text_rva = SECTION_ALIGN
+    rsrc_rva = 2 * SECTION_ALIGN
+    rsrc = build_rsrc(resources, rsrc_rva)
+
+    e_lfanew = align(64 + len(DOS_STUB), 8)
+    optional_header_size = (112 if pe32plus else 96) + 16 * 8
+    headers_size = align(e_lfanew + 4 + 20 + optional_header_size + 2 * 40, FILE_ALIGN)
+    text_raw_size = align(len(text), FILE_ALIGN)
+    rsrc_raw_size = align(len(rsrc), FILE_ALIGN)
+    image_size = rsrc_rva + align(len(rsrc), SECTION_ALIGN)
+
+    dos_header = struct.pack(
+        "<2s13H8s2H20sI",
+        b"MZ", 0x90, 3, 0, 4, 0, 0xFFFF, 0, 0xB8, 0, 0, 0, 0x40, 0,
+        bytes(8), 0, 0, bytes(20), e_lfanew,
+    )
+    out = bytearray(dos_header + DOS_STUB)
+    out += bytes(e_lfanew - len(out))
+
+    characteristics = 0x0002 | 0x0020 if pe32plus else 0x0002 | 0x0100
+    out += b"PE\0\0"
+    out += struct.pack(
+        "<HHIIIHH", machine, 2, TIMESTAMP, 0, 0, optional_header_size, characteristics
+    )
+
+    if pe32plus:
+        out += struct.pack("<HBBIIIII", 0x20B, 14, 0, text_raw_size, rsrc_raw_size, 0, text_rva, text_rva)
+        out += struct.pack("<QII", 0x140000000, SECTION_ALIGN, FILE_ALIGN)
+    else:
+        out += struct.pack("<HBBIIIIII", 0x10B, 14, 0, text_raw_size, rsrc_raw_size, 0, text_rva, text_rva, rsrc_rva)
+        out += struct.pack("<III", 0x400000, SECTION_ALIGN, FILE_ALIGN)
+    out += struct.pack("<HHHHHHIIIIHH", 6, 0, 1, 2, 6, 0, 0, image_size, headers_size, 0, 3, 0x8160 if pe32plus else 0x8140)
+    if pe32plus:
+        out += struct.pack("<QQQQ", 0x100000, 0x1000, 0x100000, 0x1000)
+    else:
+        out += struct.pack("<IIII", 0x100000, 0x1000, 0x100000, 0x1000)
+    out += struct.pack("<II", 0, 16)
+    for i in range(16):
+        out += struct.pack("<II", rsrc_rva, len(rsrc)) if i == 2 else bytes(8)
+
+    out += struct.pack("<8sIIIIIIHHI", b".text", len(text), text_rva, text_raw_size, headers_size, 0, 0, 0, 0, 0x60000020)
+    out += struct.pack("<8sIIIIIIHHI", b".rsrc", len(rsrc), rsrc_rva, rsrc_raw_size, headers_size + text_raw_size, 0, 0, 0, 0, 0x40000040)
+    out += bytes(headers_size - len(out))
+    out += text + bytes(text_raw_size - len(text))
+    out += rsrc + bytes(rsrc_raw_size - len(rsrc))
+
+    return bytes(out)
+
+
+def main():
+    resources = read_res(sys.argv[1])
+    open("test_amd64.exe", "wb").write(build_pe(resources, 0x8664, True))
+    open("test_386.exe", "wb").write(build_pe(resources, 0x14C, False))
+
+
+if __name__ == "__main__":
+    main()
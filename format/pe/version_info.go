@@ -0,0 +1,130 @@
+package pe
+
+// https://learn.microsoft.com/en-us/windows/win32/menurc/vs-versioninfo
+// https://learn.microsoft.com/en-us/windows/win32/api/verrsrc/ns-verrsrc-vs_fixedfileinfo
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	versionInfoKey       = "VS_VERSION_INFO"
+	versionTranslation   = "Translation"
+	versionValueTypeText = 1
+	versionBlockHeadSize = 6
+	fixedFileInfoSize    = 52
+)
+
+var versionValueTypeNames = scalar.UintMapSymStr{
+	0:                    "binary",
+	versionValueTypeText: "text",
+}
+
+var fileOSNames = scalar.UintMapSymStr{
+	0x00000000: "unknown",
+	0x00000001: "windows16",
+	0x00000004: "windows32",
+	0x00010000: "dos",
+	0x00010001: "dos_windows16",
+	0x00010004: "dos_windows32",
+	0x00040000: "nt",
+	0x00040004: "nt_windows32",
+}
+
+var fileTypeNames = scalar.UintMapSymStr{
+	0: "unknown",
+	1: "app",
+	2: "dll",
+	3: "drv",
+	4: "font",
+	5: "vxd",
+	7: "static_lib",
+}
+
+func peDecodeFixedFileInfo(d *decode.D) {
+	d.FieldU32("signature", d.UintAssert(0xfeef04bd), scalar.UintHex)
+	d.FieldU32("struc_version", scalar.UintHex)
+	fileVersionMS := d.FieldU32("file_version_ms", scalar.UintHex)
+	fileVersionLS := d.FieldU32("file_version_ls", scalar.UintHex)
+	productVersionMS := d.FieldU32("product_version_ms", scalar.UintHex)
+	productVersionLS := d.FieldU32("product_version_ls", scalar.UintHex)
+	d.FieldU32("file_flags_mask", scalar.UintHex)
+	d.FieldU32("file_flags", scalar.UintHex)
+	d.FieldU32("file_os", fileOSNames, scalar.UintHex)
+	d.FieldU32("file_type", fileTypeNames)
+	d.FieldU32("file_subtype")
+	d.FieldU32("file_date_ms", scalar.UintHex)
+	d.FieldU32("file_date_ls", scalar.UintHex)
+
+	versionStr := func(ms, ls uint64) string {
+		return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+	}
+	d.FieldValueStr("file_version", versionStr(fileVersionMS, fileVersionLS))
+	d.FieldValueStr("product_version", versionStr(productVersionMS, productVersionLS))
+}
+
+// blocks and values are 32 bit aligned relative to start of resource data
+func peVersionInfoPadding(d *decode.D, base int64, name string) {
+	if n := (4 - ((d.Pos()-base)/8)%4) % 4; n > 0 && n*8 <= d.BitsLeft() {
+		d.FieldRawLen(name, n*8)
+	}
+}
+
+// peDecodeVersionInfoBlock decodes VS_VERSIONINFO and its StringFileInfo, StringTable,
+// String, VarFileInfo and Var children which all share the same block layout
+func peDecodeVersionInfoBlock(d *decode.D, base int64) {
+	length := d.FieldU16("length")
+	valueLength := d.FieldU16("value_length")
+	typ := d.FieldU16("type", versionValueTypeNames)
+	if length < versionBlockHeadSize {
+		d.Fatalf("block length %d less than header size", length)
+	}
+
+	d.FramedFn(int64(length-versionBlockHeadSize)*8, func(d *decode.D) {
+		key := d.FieldUTF16LENull("key")
+		peVersionInfoPadding(d, base, "padding0")
+
+		if valueLength > 0 {
+			switch {
+			case key == versionInfoKey:
+				if valueLength != fixedFileInfoSize {
+					d.Fatalf("fixed file info length %d != %d", valueLength, fixedFileInfoSize)
+				}
+				d.FieldStruct("value", peDecodeFixedFileInfo)
+			case typ == versionValueTypeText:
+				// length is in words but some tools use bytes, is always last in the block
+				n := min(int64(valueLength)*2, d.BitsLeft()/8)
+				d.FieldUTF16LE("value", int(n), scalar.StrActualTrim("\x00"))
+			case key == versionTranslation:
+				d.FramedFn(int64(valueLength)*8, func(d *decode.D) {
+					d.FieldArray("value", func(d *decode.D) {
+						for d.BitsLeft() >= 32 {
+							d.FieldStruct("translation", func(d *decode.D) {
+								d.FieldU16("language", languageNames, scalar.UintHex)
+								d.FieldU16("code_page", codePageNames)
+							})
+						}
+					})
+				})
+			default:
+				d.FieldRawLen("value", int64(valueLength)*8)
+			}
+		}
+
+		peVersionInfoPadding(d, base, "padding1")
+		if d.BitsLeft() < versionBlockHeadSize*8 {
+			return
+		}
+		d.FieldArray("children", func(d *decode.D) {
+			for d.BitsLeft() >= versionBlockHeadSize*8 {
+				d.FieldStruct("child", func(d *decode.D) {
+					peDecodeVersionInfoBlock(d, base)
+				})
+				peVersionInfoPadding(d, base, "padding")
+			}
+		})
+	})
+}
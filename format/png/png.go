@@ -23,6 +23,8 @@ func init() {
 		format.PNG,
 		&decode.Format{
 			Description: "Portable Network Graphics file",
+			Extensions:  []string{"png"},
+			MIMETypes:   []string{"image/png"},
 			Groups:      []*decode.Group{format.Probe, format.Image},
 			DecodeFn:    pngDecode,
 			Dependencies: []decode.Dependency{
@@ -165,17 +167,17 @@ func pngDecode(d *decode.D) any {
 					d.FieldU16("b")
 				}
 			case "gAMA":
-				d.FieldU32("value")
+				d.FieldU32("value", scalar.UintFixedPointDecimal(5))
 			case "cHRM":
-				df := func(d *decode.D) float64 { return float64(d.U32()) / 1000.0 }
-				d.FieldFltFn("white_point_x", df)
-				d.FieldFltFn("white_point_y", df)
-				d.FieldFltFn("red_x", df)
-				d.FieldFltFn("red_y", df)
-				d.FieldFltFn("green_x", df)
-				d.FieldFltFn("green_y", df)
-				d.FieldFltFn("blue_x", df)
-				d.FieldFltFn("blue_y", df)
+				// values are times 100000
+				d.FieldU32("white_point_x", scalar.UintFixedPointDecimal(5))
+				d.FieldU32("white_point_y", scalar.UintFixedPointDecimal(5))
+				d.FieldU32("red_x", scalar.UintFixedPointDecimal(5))
+				d.FieldU32("red_y", scalar.UintFixedPointDecimal(5))
+				d.FieldU32("green_x", scalar.UintFixedPointDecimal(5))
+				d.FieldU32("green_y", scalar.UintFixedPointDecimal(5))
+				d.FieldU32("blue_x", scalar.UintFixedPointDecimal(5))
+				d.FieldU32("blue_y", scalar.UintFixedPointDecimal(5))
 			case "eXIf":
 				d.FieldFormatLen("exif", d.BitsLeft(), &exifGroup, nil)
 			case "acTL":
@@ -0,0 +1,354 @@
+package protobuf
+
+// https://github.com/protocolbuffers/protobuf/blob/main/src/google/protobuf/descriptor.proto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wader/fq/format"
+)
+
+// FieldDescriptorProto.Type to protobuf field type
+var descriptorTypes = map[uint64]int{
+	1:  format.ProtoBufTypeDouble,
+	2:  format.ProtoBufTypeFloat,
+	3:  format.ProtoBufTypeInt64,
+	4:  format.ProtoBufTypeUInt64,
+	5:  format.ProtoBufTypeInt32,
+	6:  format.ProtoBufTypeFixed64,
+	7:  format.ProtoBufTypeFixed32,
+	8:  format.ProtoBufTypeBool,
+	9:  format.ProtoBufTypeString,
+	10: format.ProtoBufTypeMessage, // group, has no length so will not be decoded
+	11: format.ProtoBufTypeMessage,
+	12: format.ProtoBufTypeBytes,
+	13: format.ProtoBufTypeUInt32,
+	14: format.ProtoBufTypeEnum,
+	15: format.ProtoBufTypeSFixed32,
+	16: format.ProtoBufTypeSFixed64,
+	17: format.ProtoBufTypeSInt32,
+	18: format.ProtoBufTypeSInt64,
+}
+
+var errTruncated = errors.New("truncated")
+
+type wireReader struct {
+	b []byte
+}
+
+func (r *wireReader) varint() (uint64, error) {
+	var v uint64
+	for i := 0; i < 10; i++ {
+		if len(r.b) == 0 {
+			return 0, errTruncated
+		}
+		c := r.b[0]
+		r.b = r.b[1:]
+		v |= uint64(c&0x7f) << (7 * i)
+		if c&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("varint too long")
+}
+
+func (r *wireReader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)) {
+		return nil, errTruncated
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b, nil
+}
+
+// next reads next field, value is set for varint and fixed wire types and b for length delimited
+func (r *wireReader) next() (fieldNumber uint64, wireType uint64, value uint64, b []byte, err error) {
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	fieldNumber = key >> 3
+	wireType = key & 0x7
+	if fieldNumber == 0 || fieldNumber > maxFieldNumber {
+		return 0, 0, 0, nil, fmt.Errorf("invalid field number %d", fieldNumber)
+	}
+
+	switch wireType {
+	case wireTypeVarint:
+		value, err = r.varint()
+	case wireType64Bit:
+		if b, err = r.bytes(8); err == nil {
+			for i := 7; i >= 0; i-- {
+				value = value<<8 | uint64(b[i])
+			}
+		}
+	case wireTypeLengthDelimited:
+		var n uint64
+		if n, err = r.varint(); err == nil {
+			b, err = r.bytes(n)
+		}
+	case wireType32Bit:
+		if b, err = r.bytes(4); err == nil {
+			for i := 3; i >= 0; i-- {
+				value = value<<8 | uint64(b[i])
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported wire type %d", wireType)
+	}
+
+	return fieldNumber, wireType, value, b, err
+}
+
+// isMessage checks if b can be fully parsed as message without groups
+func isMessage(b []byte) bool {
+	r := &wireReader{b: b}
+	for len(r.b) > 0 {
+		if _, _, _, _, err := r.next(); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+type descriptorField struct {
+	name     string
+	number   uint64
+	typ      uint64
+	typeName string
+}
+
+type descriptorMessage struct {
+	fields []descriptorField
+}
+
+type descriptorSet struct {
+	messages     map[string]*descriptorMessage // keyed by fully qualified name with leading "."
+	enums        map[string]map[uint64]string
+	firstMessage string // first message in last file, the one protoc was asked to compile
+}
+
+func parseDescriptorSet(b []byte) (*descriptorSet, error) {
+	ds := &descriptorSet{
+		messages: map[string]*descriptorMessage{},
+		enums:    map[string]map[uint64]string{},
+	}
+
+	// FileDescriptorSet
+	r := &wireReader{b: b}
+	for len(r.b) > 0 {
+		fn, wt, _, fb, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if fn != 1 || wt != wireTypeLengthDelimited {
+			continue
+		}
+		if err := ds.parseFile(fb); err != nil {
+			return nil, err
+		}
+	}
+
+	return ds, nil
+}
+
+func (ds *descriptorSet) parseFile(b []byte) error {
+	// FileDescriptorProto, package is before messages in protoc output but don't depend on it
+	var pkg string
+	var messages, enums [][]byte
+	r := &wireReader{b: b}
+	for len(r.b) > 0 {
+		fn, wt, _, fb, err := r.next()
+		if err != nil {
+			return err
+		}
+		if wt != wireTypeLengthDelimited {
+			continue
+		}
+		switch fn {
+		case 2:
+			pkg = string(fb)
+		case 4:
+			messages = append(messages, fb)
+		case 5:
+			enums = append(enums, fb)
+		}
+	}
+
+	scope := ""
+	if pkg != "" {
+		scope = "." + pkg
+	}
+	for i, mb := range messages {
+		name, err := ds.parseMessage(scope, mb)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			ds.firstMessage = name
+		}
+	}
+	for _, eb := range enums {
+		if err := ds.parseEnum(scope, eb); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ds *descriptorSet) parseMessage(scope string, b []byte) (string, error) {
+	// DescriptorProto
+	var name string
+	var fields, nested, enums [][]byte
+	r := &wireReader{b: b}
+	for len(r.b) > 0 {
+		fn, wt, _, fb, err := r.next()
+		if err != nil {
+			return "", err
+		}
+		if wt != wireTypeLengthDelimited {
+			continue
+		}
+		switch fn {
+		case 1:
+			name = string(fb)
+		case 2:
+			fields = append(fields, fb)
+		case 3:
+			nested = append(nested, fb)
+		case 4:
+			enums = append(enums, fb)
+		}
+	}
+
+	fullName := scope + "." + name
+	m := &descriptorMessage{}
+	for _, fb := range fields {
+		f, err := parseField(fb)
+		if err != nil {
+			return "", err
+		}
+		m.fields = append(m.fields, f)
+	}
+	ds.messages[fullName] = m
+
+	for _, nb := range nested {
+		if _, err := ds.parseMessage(fullName, nb); err != nil {
+			return "", err
+		}
+	}
+	for _, eb := range enums {
+		if err := ds.parseEnum(fullName, eb); err != nil {
+			return "", err
+		}
+	}
+
+	return fullName, nil
+}
+
+func parseField(b []byte) (descriptorField, error) {
+	// FieldDescriptorProto
+	var f descriptorField
+	r := &wireReader{b: b}
+	for len(r.b) > 0 {
+		fn, _, v, fb, err := r.next()
+		if err != nil {
+			return f, err
+		}
+		switch fn {
+		case 1:
+			f.name = string(fb)
+		case 3:
+			f.number = v
+		case 5:
+			f.typ = v
+		case 6:
+			f.typeName = string(fb)
+		}
+	}
+	return f, nil
+}
+
+func (ds *descriptorSet) parseEnum(scope string, b []byte) error {
+	// EnumDescriptorProto and EnumValueDescriptorProto
+	var name string
+	values := map[uint64]string{}
+	r := &wireReader{b: b}
+	for len(r.b) > 0 {
+		fn, _, _, fb, err := r.next()
+		if err != nil {
+			return err
+		}
+		switch fn {
+		case 1:
+			name = string(fb)
+		case 2:
+			var valueName string
+			var valueNumber uint64
+			vr := &wireReader{b: fb}
+			for len(vr.b) > 0 {
+				vfn, _, vv, vfb, err := vr.next()
+				if err != nil {
+					return err
+				}
+				switch vfn {
+				case 1:
+					valueName = string(vfb)
+				case 2:
+					valueNumber = vv
+				}
+			}
+			values[valueNumber] = valueName
+		}
+	}
+	ds.enums[scope+"."+name] = values
+
+	return nil
+}
+
+// message resolves a message type to a protobuf message, name can be with or without leading "."
+func (ds *descriptorSet) message(name string) (format.ProtoBufMessage, error) {
+	if name == "" {
+		name = ds.firstMessage
+	}
+	if !strings.HasPrefix(name, ".") {
+		name = "." + name
+	}
+	if _, ok := ds.messages[name]; !ok {
+		return nil, fmt.Errorf("message type %q not found", strings.TrimPrefix(name, "."))
+	}
+	return ds.resolve(name, map[string]format.ProtoBufMessage{}), nil
+}
+
+// resolve uses seen to share message maps so that recursive messages work
+func (ds *descriptorSet) resolve(name string, seen map[string]format.ProtoBufMessage) format.ProtoBufMessage {
+	if pbm, ok := seen[name]; ok {
+		return pbm
+	}
+	pbm := format.ProtoBufMessage{}
+	seen[name] = pbm
+
+	m, ok := ds.messages[name]
+	if !ok {
+		return pbm
+	}
+	for _, f := range m.fields {
+		typ, ok := descriptorTypes[f.typ]
+		if !ok {
+			continue
+		}
+		pbf := format.ProtoBufField{Type: typ, Name: f.name}
+		switch typ {
+		case format.ProtoBufTypeMessage:
+			pbf.Message = ds.resolve(f.typeName, seen)
+		case format.ProtoBufTypeEnum:
+			pbf.Enums = ds.enums[f.typeName]
+		}
+		pbm[int(f.number)] = pbf
+	}
+
+	return pbm
+}
@@ -4,6 +4,9 @@ package protobuf
 
 import (
 	"embed"
+	"math"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/internal/mathx"
@@ -19,8 +22,9 @@ func init() {
 	interp.RegisterFormat(
 		format.Protobuf,
 		&decode.Format{
-			Description: "Protobuf",
-			DecodeFn:    protobufDecode,
+			Description:  "Protobuf",
+			DecodeFn:     protobufDecode,
+			DefaultInArg: format.Protobuf_In{},
 		})
 	interp.RegisterFS(protobufFS)
 }
@@ -29,17 +33,89 @@ const (
 	wireTypeVarint          = 0
 	wireType64Bit           = 1
 	wireTypeLengthDelimited = 2
+	wireTypeStartGroup      = 3
+	wireTypeEndGroup        = 4
 	wireType32Bit           = 5
 )
 
+const maxFieldNumber = 1<<29 - 1
+
 var wireTypeNames = scalar.UintMapSymStr{
-	0: "varint",
-	1: "64bit",
-	2: "length_delimited",
-	5: "32bit",
+	wireTypeVarint:          "varint",
+	wireType64Bit:           "64bit",
+	wireTypeLengthDelimited: "length_delimited",
+	wireTypeStartGroup:      "start_group",
+	wireTypeEndGroup:        "end_group",
+	wireType32Bit:           "32bit",
+}
+
+// packedWireTypes is the wire type used for each element of a packed repeated field
+var packedWireTypes = map[int]uint64{
+	format.ProtoBufTypeInt32:    wireTypeVarint,
+	format.ProtoBufTypeInt64:    wireTypeVarint,
+	format.ProtoBufTypeUInt32:   wireTypeVarint,
+	format.ProtoBufTypeUInt64:   wireTypeVarint,
+	format.ProtoBufTypeSInt32:   wireTypeVarint,
+	format.ProtoBufTypeSInt64:   wireTypeVarint,
+	format.ProtoBufTypeBool:     wireTypeVarint,
+	format.ProtoBufTypeEnum:     wireTypeVarint,
+	format.ProtoBufTypeFixed64:  wireType64Bit,
+	format.ProtoBufTypeSFixed64: wireType64Bit,
+	format.ProtoBufTypeDouble:   wireType64Bit,
+	format.ProtoBufTypeFixed32:  wireType32Bit,
+	format.ProtoBufTypeSFixed32: wireType32Bit,
+	format.ProtoBufTypeFloat:    wireType32Bit,
 }
 
-func protobufDecodeField(d *decode.D, pbm *format.ProtoBufMessage) {
+// isPrintable is used to guess if a length delimited value without schema is a string
+func isPrintable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// protobufFieldValue adds value fields for a scalar wire value based on schema type
+func protobufFieldValue(d *decode.D, pbf format.ProtoBufField, value uint64) {
+	switch pbf.Type {
+	case format.ProtoBufTypeInt32, format.ProtoBufTypeInt64,
+		format.ProtoBufTypeSFixed64:
+		v := mathx.TwosComplement(64, value)
+		d.FieldValueSint("value", v)
+		if len(pbf.Enums) > 0 {
+			d.FieldValueStr("enum", pbf.Enums[uint64(v)])
+		}
+	case format.ProtoBufTypeUInt32, format.ProtoBufTypeUInt64,
+		format.ProtoBufTypeFixed64, format.ProtoBufTypeFixed32:
+		d.FieldValueUint("value", value)
+		if len(pbf.Enums) > 0 {
+			d.FieldValueStr("enum", pbf.Enums[value])
+		}
+	case format.ProtoBufTypeSInt32, format.ProtoBufTypeSInt64:
+		v := mathx.ZigZag[uint64, int64](value)
+		d.FieldValueSint("value", v)
+		if len(pbf.Enums) > 0 {
+			d.FieldValueStr("enum", pbf.Enums[uint64(v)])
+		}
+	case format.ProtoBufTypeSFixed32:
+		d.FieldValueSint("value", mathx.TwosComplement(32, value))
+	case format.ProtoBufTypeBool:
+		d.FieldValueBool("value", value != 0)
+	case format.ProtoBufTypeEnum:
+		d.FieldValueStr("enum", pbf.Enums[value])
+	case format.ProtoBufTypeDouble:
+		d.FieldValueFlt("value", math.Float64frombits(value))
+	case format.ProtoBufTypeFloat:
+		d.FieldValueFlt("value", float64(math.Float32frombits(uint32(value))))
+	}
+}
+
+func protobufDecodeField(d *decode.D, pbm format.ProtoBufMessage) {
 	d.FieldStruct("field", func(d *decode.D) {
 		keyN := d.FieldULEB128("key_n")
 		fieldNumber := keyN >> 3
@@ -54,75 +130,90 @@ func protobufDecodeField(d *decode.D, pbm *format.ProtoBufMessage) {
 		case wireTypeVarint:
 			value = d.FieldULEB128("wire_value")
 		case wireType64Bit:
-			value = d.FieldU64("wire_value")
+			value = d.FieldU64LE("wire_value")
 		case wireTypeLengthDelimited:
 			length = d.FieldULEB128("length")
 			valuePos = d.Pos()
 			d.FieldRawLen("wire_value", int64(length)*8)
+		case wireTypeStartGroup, wireTypeEndGroup:
+			// group fields follows as normal fields until end group
 		case wireType32Bit:
-			value = d.FieldU32("wire_value")
+			value = d.FieldU32LE("wire_value")
+		default:
+			d.Fatalf("unknown wire type %d", wireType)
 		}
 
-		if pbm != nil {
-			if pbf, ok := (*pbm)[int(fieldNumber)]; ok {
-				d.FieldValueStr("name", pbf.Name)
-				d.FieldValueStr("type", format.ProtoBufTypeNames[uint64(pbf.Type)])
-
-				switch pbf.Type {
-				case format.ProtoBufTypeInt32, format.ProtoBufTypeInt64:
-					v := mathx.ZigZag[uint64, int64](value)
-					d.FieldValueSint("value", v)
-					if len(pbf.Enums) > 0 {
-						d.FieldValueStr("enum", pbf.Enums[uint64(v)])
-					}
-				case format.ProtoBufTypeUInt32, format.ProtoBufTypeUInt64:
-					d.FieldValueUint("value", value)
-					if len(pbf.Enums) > 0 {
-						d.FieldValueStr("enum", pbf.Enums[value])
-					}
-				case format.ProtoBufTypeSInt32, format.ProtoBufTypeSInt64:
-					// TODO: correct? 32 different?
-					v := mathx.TwosComplement(64, value)
-					d.FieldValueSint("value", v)
-					if len(pbf.Enums) > 0 {
-						d.FieldValueStr("enum", pbf.Enums[uint64(v)])
-					}
-				case format.ProtoBufTypeBool:
-					d.FieldValueBool("value", value != 0)
-				case format.ProtoBufTypeEnum:
-					d.FieldValueStr("enum", pbf.Enums[value])
-				case format.ProtoBufTypeFixed64:
-					// TODO:
-				case format.ProtoBufTypeSFixed64:
-					// TODO:
-				case format.ProtoBufTypeDouble:
-					// TODO:
-				case format.ProtoBufTypeString:
-					d.SeekAbs(valuePos)
-					d.FieldUTF8("value", int(length))
-				case format.ProtoBufTypeBytes:
-					d.SeekAbs(valuePos)
-					d.FieldRawLen("value", int64(length)*8)
-				case format.ProtoBufTypeMessage:
-					// TODO: test
-					d.FramedFn(int64(length)*8, func(d *decode.D) {
-						protobufDecodeFields(d, &pbf.Message)
-					})
-				case format.ProtoBufTypePackedRepeated:
-					// TODO:
-				case format.ProtoBufTypeFixed32:
-					// TODO:
-				case format.ProtoBufTypeSFixed32:
-					// TODO:
-				case format.ProtoBufTypeFloat:
-					// TODO:
-				}
+		pbf, ok := pbm[int(fieldNumber)]
+		if !ok {
+			// no schema, guess if length delimited is a string or a sub message
+			if wireType != wireTypeLengthDelimited || length == 0 {
+				return
+			}
+			endPos := d.Pos()
+			b := d.BytesRange(valuePos, int(length))
+			switch {
+			case isPrintable(b):
+				d.SeekAbs(valuePos)
+				d.FieldUTF8("value", int(length))
+			case isMessage(b):
+				d.SeekAbs(valuePos)
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					protobufDecodeFields(d, nil)
+				})
+			}
+			d.SeekAbs(endPos)
+			return
+		}
+
+		d.FieldValueStr("name", pbf.Name)
+		d.FieldValueStr("type", format.ProtoBufTypeNames[uint64(pbf.Type)])
+
+		if wireType != wireTypeLengthDelimited {
+			protobufFieldValue(d, pbf, value)
+			return
+		}
+
+		endPos := d.Pos()
+		d.SeekAbs(valuePos)
+		switch pbf.Type {
+		case format.ProtoBufTypeString:
+			d.FieldUTF8("value", int(length))
+		case format.ProtoBufTypeBytes:
+			d.FieldRawLen("value", int64(length)*8)
+		case format.ProtoBufTypeMessage:
+			d.FramedFn(int64(length)*8, func(d *decode.D) {
+				protobufDecodeFields(d, pbf.Message)
+			})
+		default:
+			// repeated scalar types are packed, default in proto3
+			elementWireType, ok := packedWireTypes[pbf.Type]
+			if !ok {
+				break
 			}
+			d.FramedFn(int64(length)*8, func(d *decode.D) {
+				d.FieldArray("values", func(d *decode.D) {
+					for d.BitsLeft() > 0 {
+						d.FieldStruct("value", func(d *decode.D) {
+							var v uint64
+							switch elementWireType {
+							case wireTypeVarint:
+								v = d.FieldULEB128("wire_value")
+							case wireType64Bit:
+								v = d.FieldU64LE("wire_value")
+							case wireType32Bit:
+								v = d.FieldU32LE("wire_value")
+							}
+							protobufFieldValue(d, pbf, v)
+						})
+					}
+				})
+			})
 		}
+		d.SeekAbs(endPos)
 	})
 }
 
-func protobufDecodeFields(d *decode.D, pbm *format.ProtoBufMessage) {
+func protobufDecodeFields(d *decode.D, pbm format.ProtoBufMessage) {
 	d.FieldArray("fields", func(d *decode.D) {
 		for d.BitsLeft() > 0 {
 			protobufDecodeField(d, pbm)
@@ -134,7 +225,18 @@ func protobufDecode(d *decode.D) any {
 	var pbi format.Protobuf_In
 	d.ArgAs(&pbi)
 
-	protobufDecodeFields(d, &pbi.Message)
+	pbm := pbi.Message
+	if pbi.DescriptorSet != "" {
+		ds, err := parseDescriptorSet([]byte(pbi.DescriptorSet))
+		if err != nil {
+			d.Fatalf("failed to parse descriptor set: %s", err)
+		}
+		if pbm, err = ds.message(pbi.MessageType); err != nil {
+			d.Fatalf("%s", err)
+		}
+	}
+
+	protobufDecodeFields(d, pbm)
 
 	return nil
 }
@@ -0,0 +1,129 @@
+#!/usr/bin/env python3
+# generates test.pb, a FileDescriptorSet for test.proto, same as
+# protoc --descriptor_set_out=test.pb test.proto
+# and test.bin, a fqtest.Test message with some unknown fields
+import struct
+
+
+def varint(v):
+    v &= (1 << 64) - 1
+    b = b""
+    while True:
+        c = v & 0x7F
+        v >>= 7
+        if v:
+            b += bytes([c | 0x80])
+        else:
+            return b + bytes([c])
+
+
+def zigzag(v):
+    return (v << 1) ^ (v >> 63)
+
+
+def key(n, wt):
+    return varint(n << 3 | wt)
+
+
+def f_varint(n, v):
+    return key(n, 0) + varint(v)
+
+
+def f_bytes(n, b):
+    if isinstance(b, str):
+        b = b.encode()
+    return key(n, 2) + varint(len(b)) + b
+
+
+def f_fixed32(n, b):
+    return key(n, 5) + b
+
+
+def f_fixed64(n, b):
+    return key(n, 1) + b
+
+
+# descriptor.proto FieldDescriptorProto types
+TYPES = {
+    "double": 1, "float": 2, "int64": 3, "uint64": 4, "int32": 5,
+    "fixed64": 6, "fixed32": 7, "bool": 8, "string": 9, "message": 11,
+    "bytes": 12, "uint32": 13, "enum": 14, "sfixed32": 15, "sfixed64": 16,
+    "sint32": 17, "sint64": 18,
+}
+
+
+def field_desc(name, number, typ, repeated=False, type_name=None):
+    b = f_bytes(1, name) + f_varint(3, number) + f_varint(4, 3 if repeated else 1)
+    b += f_varint(5, TYPES[typ])
+    if type_name:
+        b += f_bytes(6, type_name)
+    b += f_bytes(10, name)  # json_name
+    return b
+
+
+def message_desc(name, fields):
+    return f_bytes(1, name) + b"".join(f_bytes(2, field_desc(*f)) for f in fields)
+
+
+def enum_desc(name, values):
+    return f_bytes(1, name) + b"".join(
+        f_bytes(2, f_bytes(1, n) + f_varint(2, v)) for n, v in values
+    )
+
+
+point = message_desc("Point", [("x", 1, "sint32"), ("y", 2, "sint32")])
+test = message_desc("Test", [
+    ("i32", 1, "int32"),
+    ("i64", 2, "int64"),
+    ("u32", 3, "uint32"),
+    ("s64", 4, "sint64"),
+    ("flag", 5, "bool"),
+    ("color", 6, "enum", False, ".fqtest.Color"),
+    ("f32", 7, "fixed32"),
+    ("sf64", 8, "sfixed64"),
+    ("fl", 9, "float"),
+    ("db", 10, "double"),
+    ("name", 11, "string"),
+    ("data", 12, "bytes"),
+    ("point", 13, "message", False, ".fqtest.Point"),
+    ("packed", 14, "int32", True),
+    ("children", 15, "message", True, ".fqtest.Test"),
+    ("tags", 16, "string", True),
+])
+color = enum_desc("Color", [("RED", 0), ("GREEN", 1), ("BLUE", 2)])
+file_desc = (
+    f_bytes(1, "test.proto")
+    + f_bytes(2, "fqtest")
+    + f_bytes(4, point)
+    + f_bytes(4, test)
+    + f_bytes(5, color)
+    + f_bytes(12, "proto3")
+)
+with open("test.pb", "wb") as f:
+    f.write(f_bytes(1, file_desc))
+
+child = f_varint(1, 1) + f_bytes(11, "child")
+msg = (
+    f_varint(1, -2)
+    + f_varint(2, 1 << 40)
+    + f_varint(3, 300)
+    + f_varint(4, zigzag(-3))
+    + f_varint(5, 1)
+    + f_varint(6, 2)
+    + f_fixed32(7, struct.pack("<I", 0xDEADBEEF))
+    + f_fixed64(8, struct.pack("<q", -5))
+    + f_fixed32(9, struct.pack("<f", 1.5))
+    + f_fixed64(10, struct.pack("<d", -0.25))
+    + f_bytes(11, "hello")
+    + f_bytes(12, b"\x00\x01\x02\xff")
+    + f_bytes(13, f_varint(1, zigzag(-1)) + f_varint(2, zigzag(2)))
+    + f_bytes(14, varint(1) + varint(-1 & 0xFFFFFFFFFFFFFFFF) + varint(150))
+    + f_bytes(15, child)
+    + f_bytes(16, "a")
+    + f_bytes(16, "b")
+    # unknown fields, guessed as sub message and string
+    + f_bytes(100, f_varint(1, 42) + f_bytes(2, "nested"))
+    + f_bytes(101, "unknown")
+)
+with open("test.bin", "wb") as f:
+    f.write(msg)
@@ -0,0 +1,150 @@
+package quic
+
+// https://www.rfc-editor.org/rfc/rfc9114 HTTP/3
+// https://www.rfc-editor.org/rfc/rfc9218 Extensible Prioritization Scheme for HTTP
+// https://www.rfc-editor.org/rfc/rfc9297 HTTP Datagrams and the Capsule Protocol
+
+// TODO: QPACK field sections
+
+import (
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed http3.md
+var http3FS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.HTTP3,
+		&decode.Format{
+			Description:  "HTTP/3 stream frames",
+			DecodeFn:     decodeHTTP3,
+			DefaultInArg: format.HTTP3_In{UniStream: false},
+		})
+	interp.RegisterFS(http3FS)
+}
+
+const (
+	streamTypeControl      = 0x00
+	streamTypePush         = 0x01
+	streamTypeQPACKEncoder = 0x02
+	streamTypeQPACKDecoder = 0x03
+)
+
+var streamTypeNames = scalar.UintMapSymStr{
+	streamTypeControl:      "control",
+	streamTypePush:         "push",
+	streamTypeQPACKEncoder: "qpack_encoder",
+	streamTypeQPACKDecoder: "qpack_decoder",
+}
+
+const (
+	frameTypeData                  = 0x00
+	frameTypeHeaders               = 0x01
+	frameTypeCancelPush            = 0x03
+	frameTypeSettings              = 0x04
+	frameTypePushPromise           = 0x05
+	frameTypeGoaway                = 0x07
+	frameTypeMaxPushID             = 0x0d
+	frameTypePriorityUpdateRequest = 0xf0700
+	frameTypePriorityUpdatePush    = 0xf0701
+)
+
+// reserved types and settings used to exercise unknown value handling, 0x1f * N + 0x21
+func isReserved(v uint64) bool { return v >= 0x21 && (v-0x21)%0x1f == 0 }
+
+func reservedMapper(m scalar.UintMapSymStr) scalar.UintFn {
+	return scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		if sym, ok := m[s.Actual]; ok {
+			s.Sym = sym
+		} else if isReserved(s.Actual) {
+			s.Sym = "reserved"
+		}
+		return s, nil
+	})
+}
+
+var frameTypeNames = reservedMapper(scalar.UintMapSymStr{
+	frameTypeData:                  "data",
+	frameTypeHeaders:               "headers",
+	frameTypeCancelPush:            "cancel_push",
+	frameTypeSettings:              "settings",
+	frameTypePushPromise:           "push_promise",
+	frameTypeGoaway:                "goaway",
+	frameTypeMaxPushID:             "max_push_id",
+	frameTypePriorityUpdateRequest: "priority_update_request",
+	frameTypePriorityUpdatePush:    "priority_update_push",
+})
+
+var settingNames = reservedMapper(scalar.UintMapSymStr{
+	0x01: "qpack_max_table_capacity",
+	0x06: "max_field_section_size",
+	0x07: "qpack_blocked_streams",
+	0x08: "enable_connect_protocol",
+	0x33: "h3_datagram",
+})
+
+func decodeHTTP3Frame(d *decode.D) {
+	typ := fieldVarint(d, "type", frameTypeNames, scalar.UintHex)
+	length := fieldVarint(d, "length")
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		switch typ {
+		case frameTypeData:
+			d.FieldRawLen("data", d.BitsLeft())
+		case frameTypeHeaders:
+			d.FieldRawLen("encoded_field_section", d.BitsLeft())
+		case frameTypeCancelPush, frameTypeMaxPushID:
+			fieldVarint(d, "push_id")
+		case frameTypeSettings:
+			d.FieldArray("settings", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("setting", func(d *decode.D) {
+						fieldVarint(d, "identifier", settingNames, scalar.UintHex)
+						fieldVarint(d, "value")
+					})
+				}
+			})
+		case frameTypePushPromise:
+			fieldVarint(d, "push_id")
+			d.FieldRawLen("encoded_field_section", d.BitsLeft())
+		case frameTypeGoaway:
+			// stream id from server and push id from client
+			fieldVarint(d, "id")
+		case frameTypePriorityUpdateRequest, frameTypePriorityUpdatePush:
+			fieldVarint(d, "prioritized_element_id")
+			d.FieldUTF8("priority_field_value", int(d.BitsLeft()/8))
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeHTTP3(d *decode.D) any {
+	var hi format.HTTP3_In
+	d.ArgAs(&hi)
+
+	if hi.UniStream {
+		streamType := fieldVarint(d, "stream_type", reservedMapper(streamTypeNames), scalar.UintHex)
+		switch {
+		case streamType == streamTypePush:
+			fieldVarint(d, "push_id")
+		case streamType != streamTypeControl:
+			// qpack instructions and unknown streams are not frames
+			d.FieldRawLen("data", d.BitsLeft())
+			return nil
+		}
+	}
+
+	d.FieldArray("frames", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("frame", decodeHTTP3Frame)
+		}
+	})
+
+	return nil
+}
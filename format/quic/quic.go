@@ -0,0 +1,353 @@
+package quic
+
+// https://www.rfc-editor.org/rfc/rfc9000 QUIC: A UDP-Based Multiplexed and Secure Transport
+// https://www.rfc-editor.org/rfc/rfc9001 Using TLS to Secure QUIC
+// https://www.rfc-editor.org/rfc/rfc9369 QUIC Version 2
+
+// TODO: packet payload decryption, only header protection is removed
+// TODO: chacha20 header protection
+
+import (
+	"crypto/aes"
+	"crypto/sha256"
+	"embed"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+	"golang.org/x/crypto/hkdf"
+)
+
+//go:embed quic.md
+var quicFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.QUIC,
+		&decode.Format{
+			Description: "QUIC packets",
+			Groups:      []*decode.Group{format.UDP_Payload},
+			DecodeFn:    decodeQUIC,
+			DefaultInArg: format.QUIC_In{
+				HpKey:      "",
+				DcidLength: 8,
+			},
+		})
+	interp.RegisterFS(quicFS)
+}
+
+const (
+	version1                  = 0x00000001
+	version2                  = 0x6b3343cf
+	versionVersionNegotiation = 0x00000000
+)
+
+var versionNames = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	switch {
+	case s.Actual == version1:
+		s.Sym = "v1"
+	case s.Actual == version2:
+		s.Sym = "v2"
+	case s.Actual == versionVersionNegotiation:
+		s.Sym = "version_negotiation"
+	case s.Actual>>8 == 0xff0000:
+		s.Sym = "draft"
+	case s.Actual&0x0f0f0f0f == 0x0a0a0a0a:
+		// reserved versions used to exercise version negotiation
+		s.Sym = "reserved"
+	}
+	return s, nil
+})
+
+const (
+	headerFormShort = 0
+	headerFormLong  = 1
+)
+
+var headerFormNames = scalar.UintMapSymStr{
+	headerFormShort: "short",
+	headerFormLong:  "long",
+}
+
+const (
+	packetTypeInitial = iota
+	packetType0RTT
+	packetTypeHandshake
+	packetTypeRetry
+)
+
+var packetTypeNames = map[uint64]string{
+	packetTypeInitial:   "initial",
+	packetType0RTT:      "0rtt",
+	packetTypeHandshake: "handshake",
+	packetTypeRetry:     "retry",
+}
+
+// version 2 uses different long packet type values
+func packetType(version uint64, bits uint64) uint64 {
+	if version == version2 {
+		return (bits + 3) % 4
+	}
+	return bits
+}
+
+func packetTypeMapper(version uint64) scalar.UintFn {
+	return scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		s.Sym = packetTypeNames[packetType(version, s.Actual)]
+		return s, nil
+	})
+}
+
+// https://www.rfc-editor.org/rfc/rfc9001#section-5.2
+// https://www.rfc-editor.org/rfc/rfc9369#section-3.3.1
+var initialSalts = map[uint64][]byte{
+	version1: {0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a},
+	version2: {0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9},
+}
+
+var hpLabels = map[uint64]string{
+	version1: "quic hp",
+	version2: "quicv2 hp",
+}
+
+const (
+	sampleLength       = 16
+	retryIntegrityTag  = 16
+	maxConnectionIDLen = 20
+)
+
+// https://www.rfc-editor.org/rfc/rfc8446#section-7.1
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	fullLabel := "tls13 " + label
+	info := make([]byte, 0, 4+len(fullLabel))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, 0) // empty context
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, secret, info), out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// header protection key for client initial packets is derived from the destination connection id
+func clientInitialHPKey(version uint64, dcid []byte) []byte {
+	salt, ok := initialSalts[version]
+	if !ok {
+		return nil
+	}
+	initialSecret := hkdf.Extract(sha256.New, dcid, salt)
+	clientSecret := hkdfExpandLabel(initialSecret, "client in", sha256.Size)
+	return hkdfExpandLabel(clientSecret, hpLabels[version], 16)
+}
+
+// https://www.rfc-editor.org/rfc/rfc9001#section-5.4
+func headerProtectionMask(d *decode.D, hpKey []byte, pnOffset int64, end int64) []byte {
+	if hpKey == nil {
+		return nil
+	}
+	samplePos := pnOffset + 4*8
+	if samplePos+sampleLength*8 > end {
+		return nil
+	}
+	block, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return nil
+	}
+	mask := make([]byte, sampleLength)
+	block.Encrypt(mask, d.BytesRange(samplePos, sampleLength))
+	return mask
+}
+
+func varint(d *decode.D) uint64 {
+	n := d.U2()
+	return d.U(int(8<<n) - 2)
+}
+
+func fieldVarint(d *decode.D, name string, sms ...scalar.UintMapper) uint64 {
+	return d.FieldUintFn(name, varint, sms...)
+}
+
+type quicDecoder struct {
+	hpKey      []byte
+	dcidLength int
+	isServer   bool
+}
+
+// scans long header to find version, packet type and offset to packet number
+func scanLongHeader(d *decode.D) (version uint64, typ uint64, pnOffset int64, end int64) {
+	typeBits := d.U8() >> 4 & 0b11
+	version = d.U32()
+	d.SeekRel(int64(d.U8()) * 8)
+	d.SeekRel(int64(d.U8()) * 8)
+	typ = packetType(version, typeBits)
+	if version == versionVersionNegotiation || typ == packetTypeRetry {
+		return version, typ, 0, d.Len()
+	}
+	if typ == packetTypeInitial {
+		d.SeekRel(int64(varint(d)) * 8)
+	}
+	length := varint(d)
+	return version, typ, d.Pos(), d.Pos() + int64(length)*8
+}
+
+func decodePacketNumber(d *decode.D, mask []byte, pnLength int) {
+	if mask == nil {
+		d.FieldRawLen("protected_payload", d.BitsLeft())
+		return
+	}
+	pn := d.PeekBytes(pnLength)
+	var unmasked uint64
+	for i, b := range pn {
+		unmasked = unmasked<<8 | uint64(b^mask[1+i])
+	}
+	d.FieldU("packet_number", pnLength*8, scalar.UintActual(unmasked))
+	d.FieldRawLen("protected_payload", d.BitsLeft())
+}
+
+func (qd *quicDecoder) decodeLongHeaderPacket(d *decode.D) {
+	start := d.Pos()
+	var version, typ uint64
+	var pnOffset, end int64
+	d.SeekAbs(start, func(d *decode.D) { version, typ, pnOffset, end = scanLongHeader(d) })
+	if end > d.Len() {
+		d.Fatalf("packet length outside datagram")
+	}
+
+	var mask []byte
+	hasPacketNumber := version != versionVersionNegotiation && typ != packetTypeRetry
+	if hasPacketNumber {
+		var hpKey []byte
+		switch {
+		case typ == packetTypeInitial && !qd.isServer:
+			var dcid []byte
+			d.SeekAbs(start+5*8, func(d *decode.D) { dcid = d.BytesLen(int(d.U8())) })
+			hpKey = clientInitialHPKey(version, dcid)
+		case typ != packetTypeInitial:
+			hpKey = qd.hpKey
+		}
+		mask = headerProtectionMask(d, hpKey, pnOffset, end)
+	}
+	var firstByte uint64
+	if mask != nil {
+		firstByte = d.PeekUintBits(8) ^ uint64(mask[0]&0x0f)
+	}
+
+	d.FieldU1("header_form", headerFormNames)
+	if version == versionVersionNegotiation {
+		d.FieldU7("unused")
+	} else {
+		d.FieldU1("fixed_bit")
+		d.FieldU2("long_packet_type", packetTypeMapper(version))
+		switch {
+		case !hasPacketNumber:
+			d.FieldU4("unused")
+		case mask != nil:
+			d.FieldU2("reserved_bits", scalar.UintActual(firstByte>>2&0b11))
+			d.FieldU2("packet_number_length", scalar.UintActual(firstByte&0b11+1))
+		default:
+			d.FieldU4("protected_bits")
+		}
+	}
+	d.FieldU32("version", versionNames, scalar.UintHex)
+	dcidLength := d.FieldU8("destination_connection_id_length")
+	d.FieldRawLen("destination_connection_id", int64(dcidLength)*8, scalar.RawHex)
+	scidLength := d.FieldU8("source_connection_id_length")
+	d.FieldRawLen("source_connection_id", int64(scidLength)*8, scalar.RawHex)
+
+	switch {
+	case version == versionVersionNegotiation:
+		d.FieldArray("supported_versions", func(d *decode.D) {
+			for !d.End() {
+				d.FieldU32("version", versionNames, scalar.UintHex)
+			}
+		})
+		return
+	case typ == packetTypeRetry:
+		d.FieldRawLen("retry_token", d.BitsLeft()-retryIntegrityTag*8)
+		d.FieldRawLen("retry_integrity_tag", retryIntegrityTag*8, scalar.RawHex)
+		return
+	case typ == packetTypeInitial:
+		tokenLength := fieldVarint(d, "token_length")
+		d.FieldRawLen("token", int64(tokenLength)*8)
+	}
+	fieldVarint(d, "length")
+	d.FramedFn(end-d.Pos(), func(d *decode.D) {
+		decodePacketNumber(d, mask, int(firstByte&0b11+1))
+	})
+}
+
+func (qd *quicDecoder) decodeShortHeaderPacket(d *decode.D) {
+	pnOffset := d.Pos() + int64(1+qd.dcidLength)*8
+	mask := headerProtectionMask(d, qd.hpKey, pnOffset, d.Len())
+	var firstByte uint64
+	if mask != nil {
+		firstByte = d.PeekUintBits(8) ^ uint64(mask[0]&0x1f)
+	}
+
+	d.FieldU1("header_form", headerFormNames)
+	d.FieldU1("fixed_bit")
+	d.FieldU1("spin_bit")
+	if mask != nil {
+		d.FieldU2("reserved_bits", scalar.UintActual(firstByte>>3&0b11))
+		d.FieldU1("key_phase", scalar.UintActual(firstByte>>2&0b1))
+		d.FieldU2("packet_number_length", scalar.UintActual(firstByte&0b11+1))
+	} else {
+		d.FieldU5("protected_bits")
+	}
+	d.FieldRawLen("destination_connection_id", int64(qd.dcidLength)*8, scalar.RawHex)
+	decodePacketNumber(d, mask, int(firstByte&0b11+1))
+}
+
+func decodeQUIC(d *decode.D) any {
+	var qi format.QUIC_In
+	var upi format.UDP_Payload_In
+	d.ArgAs(&qi)
+	qd := &quicDecoder{dcidLength: qi.DcidLength}
+	if d.ArgAs(&upi) {
+		upi.MustIsPort(d.Fatalf, format.UDPPortHTTPS)
+		// packets from the server side uses keys derived from a connection id not known here
+		qd.isServer = upi.SourcePort == format.UDPPortHTTPS
+	}
+	if qd.dcidLength < 0 || qd.dcidLength > maxConnectionIDLen {
+		d.Fatalf("invalid destination connection id length %d", qd.dcidLength)
+	}
+	if qi.HpKey != "" {
+		hpKey, err := hex.DecodeString(qi.HpKey)
+		if err != nil {
+			d.Fatalf("hp_key: %s", err)
+		}
+		qd.hpKey = hpKey
+	}
+
+	// first packet has to have fixed bit set, version negotiation might not but is long header
+	if d.PeekUintBits(2) == 0b00 {
+		d.Fatalf("fixed bit not set")
+	}
+
+	d.FieldArray("packets", func(d *decode.D) {
+		for !d.End() {
+			// coalesced packets can be followed by padding
+			if d.PeekUintBits(2) == 0b00 {
+				break
+			}
+			d.FieldStruct("packet", func(d *decode.D) {
+				if d.PeekUintBits(1) == headerFormLong {
+					qd.decodeLongHeaderPacket(d)
+				} else {
+					qd.decodeShortHeaderPacket(d)
+				}
+			})
+		}
+	})
+	if !d.End() {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+#!/usr/bin/env python3
+# generates quic test captures, payloads are not real encrypted data but header
+# protection is applied as described in RFC 9001 so it can be removed again.
+# requires openssl for AES-ECB.
+import hashlib
+import hmac
+import struct
+import subprocess
+
+V1 = 0x00000001
+V2 = 0x6B3343CF
+SALTS = {
+    V1: bytes.fromhex("38762cf7f55934b34d179ae6a4c80cadccbb7f0a"),
+    V2: bytes.fromhex("0dede3def700a6db819381be6e269dcbf9bd2ed9"),
+}
+HP_LABELS = {V1: b"quic hp", V2: b"quicv2 hp"}
+# long packet type bits per version
+TYPES = {
+    V1: {"initial": 0, "0rtt": 1, "handshake": 2, "retry": 3},
+    V2: {"initial": 1, "0rtt": 2, "handshake": 3, "retry": 0},
+}
+# header protection key used for non-initial packets, pass as hp_key option
+HP_KEY = bytes.fromhex("000102030405060708090a0b0c0d0e0f")
+
+
+def hkdf_extract(salt, ikm):
+    return hmac.new(salt, ikm, hashlib.sha256).digest()
+
+
+def hkdf_expand_label(secret, label, length):
+    full = b"tls13 " + label
+    info = struct.pack(">HB", length, len(full)) + full + b"\x00"
+    out, t, i = b"", b"", 1
+    while len(out) < length:
+        t = hmac.new(secret, t + info + bytes([i]), hashlib.sha256).digest()
+        out += t
+        i += 1
+    return out[:length]
+
+
+def client_initial_hp_key(version, dcid):
+    initial_secret = hkdf_extract(SALTS[version], dcid)
+    client_secret = hkdf_expand_label(initial_secret, b"client in", 32)
+    return hkdf_expand_label(client_secret, HP_LABELS[version], 16)
+
+
+# RFC 9001 Appendix A.1
+assert client_initial_hp_key(V1, bytes.fromhex("8394c8f03e515708")).hex() == "9f50449e04a0e810283a1e9933adedd2"
+
+
+def aes_ecb(key, block):
+    return subprocess.run(
+        ["openssl", "enc", "-aes-%d-ecb" % (len(key) * 8), "-nopad", "-K", key.hex()],
+        input=block,
+        capture_output=True,
+        check=True,
+    ).stdout
+
+
+def varint(n):
+    if n < 1 << 6:
+        return bytes([n])
+    if n < 1 << 14:
+        return struct.pack(">H", 0x4000 | n)
+    if n < 1 << 30:
+        return struct.pack(">I", 0x80000000 | n)
+    return struct.pack(">Q", 0xC000000000000000 | n)
+
+
+def payload(n, seed):
+    # stand-in for encrypted payload
+    out = b""
+    while len(out) < n:
+        out += hashlib.sha256(seed + bytes([len(out) & 0xFF])).digest()
+    return out[:n]
+
+
+def protect(packet, pn_offset, pn_length, hp_key, first_byte_mask):
+    sample = packet[pn_offset + 4 : pn_offset + 4 + 16]
+    mask = aes_ecb(hp_key, sample)
+    b = bytearray(packet)
+    b[0] ^= mask[0] & first_byte_mask
+    for i in range(pn_length):
+        b[pn_offset + i] ^= mask[1 + i]
+    return bytes(b)
+
+
+def long_packet(version, typ, dcid, scid, pn, pn_length, payload_length, hp_key, token=b""):
+    first = 0xC0 | TYPES.get(version, TYPES[V1])[typ] << 4 | (pn_length - 1)
+    header = bytes([first]) + struct.pack(">I", version)
+    header += bytes([len(dcid)]) + dcid + bytes([len(scid)]) + scid
+    if typ == "initial":
+        header += varint(len(token)) + token
+    header += varint(pn_length + payload_length)
+    pn_offset = len(header)
+    packet = header + pn.to_bytes(pn_length, "big") + payload(payload_length, dcid + bytes([pn & 0xFF]))
+    if hp_key is None:
+        return packet
+    return protect(packet, pn_offset, pn_length, hp_key, 0x0F)
+
+
+def short_packet(dcid, pn, pn_length, payload_length, key_phase=0, spin=0):
+    first = 0x40 | spin << 5 | key_phase << 2 | (pn_length - 1)
+    packet = bytes([first]) + dcid + pn.to_bytes(pn_length, "big") + payload(payload_length, dcid + bytes([pn & 0xFF]))
+    return protect(packet, 1 + len(dcid), pn_length, HP_KEY, 0x1F)
+
+
+def version_negotiation(dcid, scid, versions):
+    return bytes([0x80 | 0x2A]) + struct.pack(">I", 0) + bytes([len(dcid)]) + dcid + bytes([len(scid)]) + scid + b"".join(struct.pack(">I", v) for v in versions)
+
+
+def retry(dcid, scid, token):
+    first = 0xC0 | TYPES[V1]["retry"] << 4
+    return bytes([first]) + struct.pack(">I", V1) + bytes([len(dcid)]) + dcid + bytes([len(scid)]) + scid + token + payload(16, b"tag")
+
+
+def checksum(b):
+    if len(b) % 2:
+        b += b"\x00"
+    s = sum(struct.unpack(">%dH" % (len(b) // 2), b))
+    while s >> 16:
+        s = (s & 0xFFFF) + (s >> 16)
+    return ~s & 0xFFFF
+
+
+def ipv4_udp(src, dst, sport, dport, data):
+    udp = struct.pack(">HHHH", sport, dport, 8 + len(data), 0) + data
+    ip = struct.pack(">BBHHHBBH4s4s", 0x45, 0, 20 + len(udp), 0, 0x4000, 64, 17, 0, bytes(src), bytes(dst))
+    ip = ip[:10] + struct.pack(">H", checksum(ip)) + ip[12:]
+    return ip + udp
+
+
+def pcap(packets):
+    # LINKTYPE_RAW
+    out = struct.pack("<IHHiIII", 0xA1B2C3D4, 2, 4, 0, 0, 65535, 101)
+    for i, p in enumerate(packets):
+        out += struct.pack("<IIII", 1700000000, i * 1000, len(p), len(p)) + p
+    return out
+
+
+client = [192, 168, 0, 1]
+server = [192, 168, 0, 2]
+cport = 50000
+odcid = bytes.fromhex("8394c8f03e515708")
+cscid = bytes.fromhex("c5c6c7c8")
+sscid = bytes.fromhex("f0f1f2f3f4f5f6f7")
+
+
+def c2s(data):
+    return ipv4_udp(client, server, cport, 443, data)
+
+
+def s2c(data):
+    return ipv4_udp(server, client, 443, cport, data)
+
+
+# client initial padded to 1200 bytes and protected with keys derived from the original dcid
+client_initial = long_packet(V1, "initial", odcid, cscid, 2, 4, 1200 - 26, client_initial_hp_key(V1, odcid))
+# server initial and handshake coalesced, server initial keys are derived from the original dcid that
+# is not part of the packet so header protection is not removed, handshake uses HP_KEY
+server_flight = long_packet(V1, "initial", cscid, sscid, 0, 2, 100, None) + long_packet(
+    V1, "handshake", cscid, sscid, 0, 2, 200, HP_KEY
+)
+# client handshake followed by non-quic padding
+client_handshake = long_packet(V1, "handshake", sscid, cscid, 1, 1, 50, HP_KEY) + bytes(20)
+# 1-RTT packets with 8 byte dcid
+client_short = short_packet(sscid, 3, 2, 40, key_phase=0, spin=1)
+server_short = short_packet(cscid + sscid, 0x1234, 3, 40, key_phase=1)
+
+open("quic.pcap", "wb").write(
+    pcap(
+        [
+            c2s(client_initial),
+            s2c(server_flight),
+            c2s(client_handshake),
+            c2s(client_short),
+        ]
+    )
+)
+
+# version negotiation, retry and version 2
+open("quic_version.pcap", "wb").write(
+    pcap(
+        [
+            c2s(long_packet(0x1A2A3A4A, "initial", odcid, cscid, 0, 1, 1200 - 23, None)),
+            s2c(version_negotiation(cscid, odcid, [V1, V2, 0x0A1A2A3A])),
+            c2s(long_packet(V1, "initial", odcid, cscid, 0, 1, 1200 - 23, client_initial_hp_key(V1, odcid))),
+            s2c(retry(cscid, sscid, b"retry token")),
+            c2s(long_packet(V2, "initial", sscid, cscid, 1, 2, 1200 - 27, client_initial_hp_key(V2, sscid), token=b"retry token")),
+            c2s(long_packet(V2, "handshake", sscid, cscid, 2, 2, 50, HP_KEY)),
+        ]
+    )
+)
+
+# 1-RTT packet with 12 byte dcid, decode with -o dcid_length=12
+open("short_dcid12", "wb").write(server_short)
+
+
+def h3_frame(typ, data):
+    return varint(typ) + varint(len(data)) + data
+
+
+# http/3 control stream with settings, goaway and priority update
+open("http3_control", "wb").write(
+    varint(0x00)
+    + h3_frame(
+        0x04,
+        varint(0x01) + varint(0)
+        + varint(0x06) + varint(16384)
+        + varint(0x07) + varint(0)
+        + varint(0x33) + varint(1)
+        + varint(0x1F * 2 + 0x21) + varint(1234),
+    )
+    + h3_frame(0x0F0700, varint(0) + b"u=1, i")
+    + h3_frame(0x1F * 3 + 0x21, b"grease")
+    + h3_frame(0x0D, varint(10))
+    + h3_frame(0x07, varint(4))
+)
+# http/3 request stream, qpack encoded field section is not decoded
+open("http3_request", "wb").write(h3_frame(0x01, bytes.fromhex("0000d1d7508aa0e41d139d09b8f01e07")) + h3_frame(0x00, b"hello"))
+# http/3 push stream
+open("http3_push", "wb").write(varint(0x01) + varint(3) + h3_frame(0x01, bytes.fromhex("0000d9")) + h3_frame(0x00, b"pushed"))
+# qpack encoder stream with set dynamic table capacity instruction
+open("http3_qpack_encoder", "wb").write(varint(0x02) + bytes.fromhex("3fe11f"))
@@ -0,0 +1,453 @@
+package rar
+
+// https://www.rarlab.com/technote.htm
+
+import (
+	"bytes"
+	"embed"
+	"hash/crc32"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed rar.md
+var rarFS embed.FS
+
+var probeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.RAR,
+		&decode.Format{
+			Description: "RAR archive (version 5)",
+			Extensions:  []string{"rar"},
+			MIMETypes:   []string{"application/vnd.rar"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    rarDecode,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(rarFS)
+}
+
+var (
+	rar5Signature = []byte("Rar!\x1a\x07\x01\x00")
+	rar4Signature = []byte("Rar!\x1a\x07\x00")
+)
+
+const (
+	headerTypeMain       = 1
+	headerTypeFile       = 2
+	headerTypeService    = 3
+	headerTypeEncryption = 4
+	headerTypeEnd        = 5
+)
+
+var headerTypeNames = scalar.UintMapSymStr{
+	headerTypeMain:       "main",
+	headerTypeFile:       "file",
+	headerTypeService:    "service",
+	headerTypeEncryption: "encryption",
+	headerTypeEnd:        "end",
+}
+
+const (
+	headerFlagExtraArea = 0x01
+	headerFlagDataArea  = 0x02
+	headerFlagSplitPrev = 0x08
+	headerFlagSplitNext = 0x10
+)
+
+const (
+	fileFlagDirectory   = 0x01
+	fileFlagTime        = 0x02
+	fileFlagCRC32       = 0x04
+	fileFlagUnknownSize = 0x08
+)
+
+const compressionMethodStore = 0
+
+var compressionMethodNames = scalar.UintMapSymStr{
+	compressionMethodStore: "store",
+	1:                      "fastest",
+	2:                      "fast",
+	3:                      "normal",
+	4:                      "good",
+	5:                      "best",
+}
+
+var hostOSNames = scalar.UintMapSymStr{
+	0: "windows",
+	1: "unix",
+}
+
+const (
+	mainExtraLocator  = 1
+	mainExtraMetadata = 2
+)
+
+var mainExtraTypeNames = scalar.UintMapSymStr{
+	mainExtraLocator:  "locator",
+	mainExtraMetadata: "metadata",
+}
+
+const (
+	fileExtraEncryption  = 1
+	fileExtraHash        = 2
+	fileExtraTime        = 3
+	fileExtraVersion     = 4
+	fileExtraRedirection = 5
+	fileExtraOwner       = 6
+	fileExtraServiceData = 7
+)
+
+var fileExtraTypeNames = scalar.UintMapSymStr{
+	fileExtraEncryption:  "encryption",
+	fileExtraHash:        "hash",
+	fileExtraTime:        "time",
+	fileExtraVersion:     "version",
+	fileExtraRedirection: "redirection",
+	fileExtraOwner:       "owner",
+	fileExtraServiceData: "service_data",
+}
+
+var hashTypeNames = scalar.UintMapSymStr{
+	0: "blake2sp",
+}
+
+var redirectionTypeNames = scalar.UintMapSymStr{
+	1: "unix_symlink",
+	2: "windows_symlink",
+	3: "windows_junction",
+	4: "hard_link",
+	5: "file_copy",
+}
+
+const (
+	saltLength       = 16
+	ivLength         = 16
+	checkValueLength = 12
+)
+
+// vint is little endian base 128 with high bit as continuation, same as ULEB128
+func fieldVint(d *decode.D, name string, sms ...scalar.UintMapper) uint64 {
+	return d.FieldULEB128(name, sms...)
+}
+
+// fieldFlags decodes a vint with flags and adds a bool per known flag bit
+func fieldFlags(d *decode.D, name string, bits map[uint64]string) uint64 {
+	var v uint64
+	d.FieldStruct(name, func(d *decode.D) {
+		v = fieldVint(d, "value", scalar.UintHex)
+		for bit := uint64(1); bit <= 0x80; bit <<= 1 {
+			if n, ok := bits[bit]; ok {
+				d.FieldValueBool(n, v&bit != 0)
+			}
+		}
+	})
+	return v
+}
+
+var headerFlagNames = map[uint64]string{
+	headerFlagExtraArea: "extra_area",
+	headerFlagDataArea:  "data_area",
+	0x04:                "skip_if_unknown",
+	headerFlagSplitPrev: "split_before",
+	headerFlagSplitNext: "split_after",
+	0x20:                "child",
+	0x40:                "inherited",
+}
+
+var archiveFlagNames = map[uint64]string{
+	0x01: "volume",
+	0x02: "volume_number",
+	0x04: "solid",
+	0x08: "recovery_record",
+	0x10: "locked",
+}
+
+var fileFlagNames = map[uint64]string{
+	fileFlagDirectory:   "directory",
+	fileFlagTime:        "time",
+	fileFlagCRC32:       "crc32",
+	fileFlagUnknownSize: "unknown_unpacked_size",
+}
+
+func fieldExtraRecords(d *decode.D, typeNames scalar.UintMapSymStr, fn func(d *decode.D, typ uint64)) {
+	d.FieldArray("extra_records", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("record", func(d *decode.D) {
+				size := fieldVint(d, "size")
+				d.FramedFn(int64(size)*8, func(d *decode.D) {
+					typ := fieldVint(d, "type", typeNames)
+					fn(d, typ)
+					if !d.End() {
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+}
+
+type fileHeader struct {
+	compressionMethod uint64
+	encrypted         bool
+}
+
+func decodeFileHeader(d *decode.D, fh *fileHeader) {
+	fileFlags := fieldFlags(d, "file_flags", fileFlagNames)
+	fieldVint(d, "unpacked_size")
+	fieldVint(d, "attributes", scalar.UintHex)
+	if fileFlags&fileFlagTime != 0 {
+		d.FieldU32("mtime", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+	}
+	if fileFlags&fileFlagCRC32 != 0 {
+		d.FieldU32("data_crc32", scalar.UintHex)
+	}
+	d.FieldStruct("compression_info", func(d *decode.D) {
+		v := fieldVint(d, "value", scalar.UintHex)
+		d.FieldValueUint("version", v&0x3f)
+		d.FieldValueBool("solid", v&0x40 != 0)
+		fh.compressionMethod = (v >> 7) & 0x7
+		d.FieldValueUint("method", fh.compressionMethod, compressionMethodNames)
+		// 128KB << n
+		d.FieldValueUint("dictionary_size", 128*1024<<((v>>10)&0xf))
+	})
+	fieldVint(d, "host_os", hostOSNames)
+	nameLength := fieldVint(d, "name_length")
+	d.FieldUTF8("name", int(nameLength))
+}
+
+func decodeFileExtra(d *decode.D, typ uint64, fh *fileHeader) {
+	switch typ {
+	case fileExtraEncryption:
+		fh.encrypted = true
+		fieldVint(d, "version")
+		flags := fieldFlags(d, "flags", map[uint64]string{
+			0x01: "password_check",
+			0x02: "tweaked_checksums",
+		})
+		d.FieldU8("kdf_count")
+		d.FieldRawLen("salt", saltLength*8)
+		d.FieldRawLen("iv", ivLength*8)
+		if flags&0x01 != 0 {
+			d.FieldRawLen("check_value", checkValueLength*8)
+		}
+	case fileExtraHash:
+		fieldVint(d, "hash_type", hashTypeNames)
+		d.FieldRawLen("hash", d.BitsLeft())
+	case fileExtraTime:
+		flags := fieldFlags(d, "flags", map[uint64]string{
+			0x01: "unix_time",
+			0x02: "mtime",
+			0x04: "ctime",
+			0x08: "atime",
+			0x10: "unix_time_ns",
+		})
+		unixTime := flags&0x01 != 0
+		for _, t := range []struct {
+			bit  uint64
+			name string
+		}{
+			{0x02, "mtime"},
+			{0x04, "ctime"},
+			{0x08, "atime"},
+		} {
+			if flags&t.bit == 0 {
+				continue
+			}
+			if unixTime {
+				d.FieldU32(t.name, scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+			} else {
+				d.FieldU64(t.name, scalar.UintActualWindowsFileTimeDescription(time.RFC3339))
+			}
+		}
+		if unixTime && flags&0x10 != 0 {
+			for _, t := range []struct {
+				bit  uint64
+				name string
+			}{
+				{0x02, "mtime_ns"},
+				{0x04, "ctime_ns"},
+				{0x08, "atime_ns"},
+			} {
+				if flags&t.bit != 0 {
+					d.FieldU32(t.name)
+				}
+			}
+		}
+	case fileExtraVersion:
+		fieldVint(d, "flags", scalar.UintHex)
+		fieldVint(d, "version")
+	case fileExtraRedirection:
+		fieldVint(d, "redirection_type", redirectionTypeNames)
+		fieldFlags(d, "flags", map[uint64]string{
+			0x01: "directory",
+		})
+		nameLength := fieldVint(d, "name_length")
+		d.FieldUTF8("name", int(nameLength))
+	case fileExtraOwner:
+		flags := fieldFlags(d, "flags", map[uint64]string{
+			0x01: "user_name",
+			0x02: "group_name",
+			0x04: "user_id",
+			0x08: "group_id",
+		})
+		if flags&0x01 != 0 {
+			l := fieldVint(d, "user_name_length")
+			d.FieldUTF8("user_name", int(l))
+		}
+		if flags&0x02 != 0 {
+			l := fieldVint(d, "group_name_length")
+			d.FieldUTF8("group_name", int(l))
+		}
+		if flags&0x04 != 0 {
+			fieldVint(d, "user_id")
+		}
+		if flags&0x08 != 0 {
+			fieldVint(d, "group_id")
+		}
+	}
+}
+
+func decodeMainExtra(d *decode.D, typ uint64) {
+	switch typ {
+	case mainExtraLocator:
+		flags := fieldFlags(d, "flags", map[uint64]string{
+			0x01: "quick_open",
+			0x02: "recovery_record",
+		})
+		if flags&0x01 != 0 {
+			fieldVint(d, "quick_open_offset")
+		}
+		if flags&0x02 != 0 {
+			fieldVint(d, "recovery_record_offset")
+		}
+	}
+}
+
+func decodeBlock(d *decode.D) uint64 {
+	var headerType uint64
+
+	headerCRCPos := d.Pos()
+	d.SeekRel(32)
+	headerSizeStart := d.Pos()
+	headerSize := d.ULEB128()
+	headerEnd := d.Pos() + int64(headerSize)*8
+	d.SeekAbs(headerCRCPos)
+
+	headerCRC := crc32.NewIEEE()
+	if headerEnd <= d.Len() {
+		d.Copy(headerCRC, bitio.NewIOReader(d.BitBufRange(headerSizeStart, headerEnd-headerSizeStart)))
+		d.FieldU32("header_crc", d.UintValidateBytes(headerCRC.Sum(nil)), scalar.UintHex)
+	} else {
+		d.FieldU32("header_crc", scalar.UintHex)
+	}
+	fieldVint(d, "header_size")
+
+	var extraAreaSize uint64
+	var dataSize uint64
+	var headerFlags uint64
+	var fh fileHeader
+
+	d.FramedFn(headerEnd-d.Pos(), func(d *decode.D) {
+		headerType = fieldVint(d, "header_type", headerTypeNames)
+		headerFlags = fieldFlags(d, "header_flags", headerFlagNames)
+		if headerFlags&headerFlagExtraArea != 0 {
+			extraAreaSize = fieldVint(d, "extra_area_size")
+		}
+		if headerFlags&headerFlagDataArea != 0 {
+			dataSize = fieldVint(d, "data_size")
+		}
+
+		extraStart := d.Len() - int64(extraAreaSize)*8
+
+		switch headerType {
+		case headerTypeMain:
+			archiveFlags := fieldFlags(d, "archive_flags", archiveFlagNames)
+			if archiveFlags&0x02 != 0 {
+				fieldVint(d, "volume_number")
+			}
+		case headerTypeFile, headerTypeService:
+			decodeFileHeader(d, &fh)
+		case headerTypeEncryption:
+			fieldVint(d, "encryption_version")
+			flags := fieldFlags(d, "encryption_flags", map[uint64]string{
+				0x01: "password_check",
+			})
+			d.FieldU8("kdf_count")
+			d.FieldRawLen("salt", saltLength*8)
+			if flags&0x01 != 0 {
+				d.FieldRawLen("check_value", checkValueLength*8)
+			}
+		case headerTypeEnd:
+			fieldFlags(d, "end_of_archive_flags", map[uint64]string{
+				0x01: "not_last_volume",
+			})
+		}
+
+		if d.Pos() < extraStart {
+			d.FieldRawLen("unknown", extraStart-d.Pos())
+		}
+		d.SeekAbs(extraStart)
+
+		if extraAreaSize > 0 {
+			d.FramedFn(int64(extraAreaSize)*8, func(d *decode.D) {
+				switch headerType {
+				case headerTypeMain:
+					fieldExtraRecords(d, mainExtraTypeNames, decodeMainExtra)
+				case headerTypeFile, headerTypeService:
+					fieldExtraRecords(d, fileExtraTypeNames, func(d *decode.D, typ uint64) {
+						decodeFileExtra(d, typ, &fh)
+					})
+				default:
+					d.FieldRawLen("extra_area", d.BitsLeft())
+				}
+			})
+		}
+	})
+
+	if dataSize > 0 {
+		split := headerFlags&(headerFlagSplitPrev|headerFlagSplitNext) != 0
+		if headerType == headerTypeFile &&
+			fh.compressionMethod == compressionMethodStore &&
+			!fh.encrypted &&
+			!split {
+			d.FieldFormatOrRawLen("data", int64(dataSize)*8, &probeGroup, format.Probe_In{})
+		} else {
+			d.FieldRawLen("data", int64(dataSize)*8)
+		}
+	}
+
+	return headerType
+}
+
+func rarDecode(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	if d.BitsLeft() >= int64(len(rar4Signature))*8 && bytes.Equal(d.PeekBytes(len(rar4Signature)), rar4Signature) {
+		d.Fatalf("RAR 4.x and older not supported")
+	}
+	d.FieldRawLen("signature", int64(len(rar5Signature))*8, d.AssertBitBuf(rar5Signature))
+
+	d.FieldArray("blocks", func(d *decode.D) {
+		for !d.End() {
+			var headerType uint64
+			d.FieldStruct("block", func(d *decode.D) {
+				headerType = decodeBlock(d)
+			})
+			if headerType == headerTypeEnd {
+				break
+			}
+		}
+	})
+
+	return nil
+}
@@ -15,6 +15,8 @@ func init() {
 		&decode.Format{
 			ProbeOrder:  format.ProbeOrderBinFuzzy,
 			Description: "Audio Interchange File Format",
+			Extensions:  []string{"aif", "aiff"},
+			MIMETypes:   []string{"audio/aiff"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    aiffDecode,
 		})
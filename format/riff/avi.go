@@ -39,6 +39,8 @@ func init() {
 		format.AVI,
 		&decode.Format{
 			Description: "Audio Video Interleaved",
+			Extensions:  []string{"avi"},
+			MIMETypes:   []string{"video/x-msvideo"},
 			DecodeFn:    aviDecode,
 			DefaultInArg: format.AVI_In{
 				DecodeSamples:        true,
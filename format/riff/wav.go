@@ -23,8 +23,11 @@ func init() {
 		&decode.Format{
 			ProbeOrder:  format.ProbeOrderBinFuzzy, // after most others (overlap some with webp)
 			Description: "WAV file",
+			Extensions:  []string{"wav"},
+			MIMETypes:   []string{"audio/wav"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    wavDecode,
+			Enums:       map[string]any{"audio_format": format.WAVTagNames},
 			Dependencies: []decode.Dependency{
 				{Groups: []*decode.Group{format.ID3v2}, Out: &wavHeaderGroup},
 				{Groups: []*decode.Group{format.ID3v1, format.ID3v11}, Out: &wavFooterGroup},
@@ -89,7 +92,7 @@ func wavDecode(d *decode.D) any {
 			case "fmt":
 				audioFormat := d.FieldU16("audio_format", format.WAVTagNames)
 				d.FieldU16("num_channels")
-				d.FieldU32("sample_rate")
+				d.FieldU32("sample_rate", scalar.UintUnit("Hz"), scalar.UintPrefixSI)
 				d.FieldU32("byte_rate")
 				d.FieldU16("block_align")
 				d.FieldU16("bits_per_sample")
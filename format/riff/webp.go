@@ -19,6 +19,8 @@ func init() {
 		format.WebP,
 		&decode.Format{
 			Description: "WebP image",
+			Extensions:  []string{"webp"},
+			MIMETypes:   []string{"image/webp"},
 			Groups:      []*decode.Group{format.Probe, format.Image},
 			DecodeFn:    webpDecode,
 			Dependencies: []decode.Dependency{
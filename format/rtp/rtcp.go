@@ -0,0 +1,308 @@
+package rtp
+
+// https://datatracker.ietf.org/doc/html/rfc3550#section-6 RTCP
+// https://datatracker.ietf.org/doc/html/rfc3611 RTCP Extended Reports (XR)
+// https://datatracker.ietf.org/doc/html/rfc4585 Extended RTP Profile for RTCP-Based Feedback (RTP/AVPF)
+// https://datatracker.ietf.org/doc/html/rfc5104 Codec Control Messages in the RTP Audio-Visual Profile with Feedback (AVPF)
+// https://datatracker.ietf.org/doc/html/draft-alvestrand-rmcat-remb-03 RTCP message for Receiver Estimated Maximum Bitrate
+
+import (
+	"embed"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed rtcp.md
+var rtcpFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.RTCP,
+		&decode.Format{
+			Description: "RTP Control Protocol packets",
+			DecodeFn:    decodeRTCP,
+			RootArray:   true,
+		})
+	interp.RegisterFS(rtcpFS)
+}
+
+const (
+	rtcpTypeSR    = 200
+	rtcpTypeRR    = 201
+	rtcpTypeSDES  = 202
+	rtcpTypeBYE   = 203
+	rtcpTypeAPP   = 204
+	rtcpTypeRTPFB = 205
+	rtcpTypePSFB  = 206
+	rtcpTypeXR    = 207
+)
+
+var rtcpTypeNames = scalar.UintMap{
+	rtcpTypeSR:    {Sym: "sr", Description: "Sender report"},
+	rtcpTypeRR:    {Sym: "rr", Description: "Receiver report"},
+	rtcpTypeSDES:  {Sym: "sdes", Description: "Source description"},
+	rtcpTypeBYE:   {Sym: "bye", Description: "Goodbye"},
+	rtcpTypeAPP:   {Sym: "app", Description: "Application-defined"},
+	rtcpTypeRTPFB: {Sym: "rtpfb", Description: "Generic RTP feedback"},
+	rtcpTypePSFB:  {Sym: "psfb", Description: "Payload-specific feedback"},
+	rtcpTypeXR:    {Sym: "xr", Description: "Extended report"},
+}
+
+const sdesItemEnd = 0
+
+var sdesItemNames = scalar.UintMapSymStr{
+	sdesItemEnd: "end",
+	1:           "cname",
+	2:           "name",
+	3:           "email",
+	4:           "phone",
+	5:           "loc",
+	6:           "tool",
+	7:           "note",
+	8:           "priv",
+}
+
+const (
+	rtpfbNACK = 1
+)
+
+var rtpfbFMTNames = scalar.UintMapSymStr{
+	rtpfbNACK: "nack",
+	3:         "tmmbr",
+	4:         "tmmbn",
+	15:        "transport_cc",
+}
+
+const (
+	psfbPLI = 1
+	psfbFIR = 4
+	psfbAFB = 15
+)
+
+var psfbFMTNames = scalar.UintMapSymStr{
+	psfbPLI: "pli",
+	2:       "sli",
+	3:       "rpsi",
+	psfbFIR: "fir",
+	5:       "tstr",
+	6:       "tstn",
+	7:       "vbcm",
+	psfbAFB: "afb",
+}
+
+var xrBlockTypeNames = scalar.UintMapSymStr{
+	1: "loss_rle",
+	2: "duplicate_rle",
+	3: "packet_receipt_times",
+	4: "receiver_reference_time",
+	5: "dlrr",
+	6: "statistics_summary",
+	7: "voip_metrics",
+}
+
+var ntpEpochDate = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func decodeReportBlocks(d *decode.D, count uint64) {
+	d.FieldArray("report_blocks", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("report_block", func(d *decode.D) {
+				d.FieldU32("ssrc", scalar.UintHex)
+				d.FieldU8("fraction_lost")
+				d.FieldS24("cumulative_lost")
+				d.FieldU32("extended_highest_sequence_number")
+				d.FieldU32("interarrival_jitter")
+				d.FieldU32("last_sr")
+				d.FieldU32("delay_since_last_sr")
+			})
+		}
+	})
+}
+
+func decodeRTCPFeedback(d *decode.D, typ uint64, feedbackType uint64) {
+	d.FieldU32("sender_ssrc", scalar.UintHex)
+	d.FieldU32("media_ssrc", scalar.UintHex)
+	switch {
+	case typ == rtcpTypeRTPFB && feedbackType == rtpfbNACK:
+		d.FieldArray("nacks", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("nack", func(d *decode.D) {
+					d.FieldU16("pid")
+					d.FieldU16("blp", scalar.UintBin)
+				})
+			}
+		})
+	case typ == rtcpTypePSFB && feedbackType == psfbPLI:
+		// no feedback control information
+	case typ == rtcpTypePSFB && feedbackType == psfbFIR:
+		d.FieldArray("entries", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldU32("ssrc", scalar.UintHex)
+					d.FieldU8("sequence_number")
+					d.FieldU24("reserved")
+				})
+			}
+		})
+	case typ == rtcpTypePSFB && feedbackType == psfbAFB && d.BitsLeft() >= 32 && string(d.PeekBytes(4)) == "REMB":
+		d.FieldStruct("remb", func(d *decode.D) {
+			d.FieldUTF8("identifier", 4)
+			numSSRC := d.FieldU8("num_ssrc")
+			exp := d.FieldU6("exponent")
+			mantissa := d.FieldU18("mantissa")
+			d.FieldValueUint("bitrate", mantissa<<exp)
+			d.FieldArray("ssrcs", func(d *decode.D) {
+				for i := uint64(0); i < numSSRC; i++ {
+					d.FieldU32("ssrc", scalar.UintHex)
+				}
+			})
+		})
+	default:
+		d.FieldRawLen("fci", d.BitsLeft())
+	}
+}
+
+func decodeRTCPPacket(d *decode.D) {
+	var typ, count uint64
+	var padding bool
+	var length uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU2("version", d.UintAssert(2))
+		padding = d.FieldBool("padding")
+		// reception report count, source count or feedback message type depending on packet type
+		typ = d.PeekUintBits(8+5) & 0xff
+		switch typ {
+		case rtcpTypeRTPFB:
+			count = d.FieldU5("fmt", rtpfbFMTNames)
+		case rtcpTypePSFB:
+			count = d.FieldU5("fmt", psfbFMTNames)
+		case rtcpTypeAPP:
+			count = d.FieldU5("subtype")
+		default:
+			count = d.FieldU5("count")
+		}
+		d.FieldU8("packet_type", rtcpTypeNames)
+		// length in 32-bit words minus one
+		length = d.FieldU16("length")
+	})
+
+	bodyLen := int64(length) * 32
+	paddingCount := uint64(0)
+	if padding && length > 0 {
+		d.RangeFn(d.Pos()+bodyLen-8, 8, func(d *decode.D) { paddingCount = d.U8() })
+		if paddingCount == 0 || int64(paddingCount)*8 > bodyLen {
+			d.Fatalf("invalid padding count %d", paddingCount)
+		}
+	}
+
+	d.FramedFn(bodyLen-int64(paddingCount)*8, func(d *decode.D) {
+		switch typ {
+		case rtcpTypeSR:
+			d.FieldU32("ssrc", scalar.UintHex)
+			d.FieldStruct("sender_info", func(d *decode.D) {
+				d.FieldU32("ntp_timestamp_msw", scalar.UintActualDateDescription(ntpEpochDate, time.Second, time.RFC3339))
+				d.FieldU32("ntp_timestamp_lsw")
+				d.FieldU32("rtp_timestamp")
+				d.FieldU32("packet_count")
+				d.FieldU32("octet_count")
+			})
+			decodeReportBlocks(d, count)
+			if !d.End() {
+				d.FieldRawLen("profile_extension", d.BitsLeft())
+			}
+		case rtcpTypeRR:
+			d.FieldU32("ssrc", scalar.UintHex)
+			decodeReportBlocks(d, count)
+			if !d.End() {
+				d.FieldRawLen("profile_extension", d.BitsLeft())
+			}
+		case rtcpTypeSDES:
+			d.FieldArray("chunks", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("chunk", func(d *decode.D) {
+						chunkStart := d.Pos()
+						d.FieldU32("ssrc", scalar.UintHex)
+						d.FieldArray("items", func(d *decode.D) {
+							for {
+								end := false
+								d.FieldStruct("item", func(d *decode.D) {
+									typ := d.FieldU8("type", sdesItemNames)
+									if typ == sdesItemEnd {
+										end = true
+										return
+									}
+									l := d.FieldU8("length")
+									if typ == 8 {
+										prefixLen := d.FieldU8("prefix_length")
+										if prefixLen+1 > l {
+											d.Fatalf("priv prefix length %d larger than item length %d", prefixLen, l)
+										}
+										d.FieldUTF8("prefix", int(prefixLen))
+										d.FieldUTF8("value", int(l-1-prefixLen))
+										return
+									}
+									d.FieldUTF8("value", int(l))
+								})
+								if end {
+									break
+								}
+							}
+						})
+						// chunks are padded with null octets to 32-bit boundary
+						padLen := (32 - (d.Pos()-chunkStart)%32) % 32
+						d.FieldRawLen("padding", padLen)
+					})
+				}
+			})
+		case rtcpTypeBYE:
+			d.FieldArray("ssrcs", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldU32("ssrc", scalar.UintHex)
+				}
+			})
+			if !d.End() {
+				l := d.FieldU8("reason_length")
+				d.FieldUTF8("reason", int(l))
+				d.FieldRawLen("padding", d.BitsLeft())
+			}
+		case rtcpTypeAPP:
+			d.FieldU32("ssrc", scalar.UintHex)
+			d.FieldUTF8("name", 4)
+			d.FieldRawLen("data", d.BitsLeft())
+		case rtcpTypeRTPFB, rtcpTypePSFB:
+			decodeRTCPFeedback(d, typ, count)
+		case rtcpTypeXR:
+			d.FieldU32("ssrc", scalar.UintHex)
+			d.FieldArray("report_blocks", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("report_block", func(d *decode.D) {
+						d.FieldU8("block_type", xrBlockTypeNames)
+						d.FieldU8("type_specific")
+						// length in 32-bit words minus one (excluding header)
+						l := d.FieldU16("block_length")
+						d.FieldRawLen("data", int64(l)*32)
+					})
+				}
+			})
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+
+	if paddingCount > 0 {
+		d.FieldRawLen("padding", int64(paddingCount-1)*8)
+		d.FieldU8("padding_count")
+	}
+}
+
+func decodeRTCP(d *decode.D) any {
+	// compound packet
+	for !d.End() {
+		d.FieldStruct("packet", decodeRTCPPacket)
+	}
+
+	return nil
+}
@@ -0,0 +1,364 @@
+package rtp
+
+// https://datatracker.ietf.org/doc/html/rfc3550 RTP: A Transport Protocol for Real-Time Applications
+// https://datatracker.ietf.org/doc/html/rfc8285 A General Mechanism for RTP Header Extensions
+// https://datatracker.ietf.org/doc/html/rfc2250 RTP Payload Format for MPEG1/MPEG2 Video
+// https://datatracker.ietf.org/doc/html/rfc3640 RTP Payload Format for Transport of MPEG-4 Elementary Streams
+// https://datatracker.ietf.org/doc/html/rfc6184 RTP Payload Format for H.264 Video
+// https://datatracker.ietf.org/doc/html/rfc7587 RTP Payload Format for the Opus Speech and Audio Codec
+// https://datatracker.ietf.org/doc/html/rfc7798 RTP Payload Format for High Efficiency Video Coding (HEVC)
+
+// TODO: reassemble fragmented NAL units across packets
+// TODO: more payload formats, VP8, VP9, AV1 etc
+
+import (
+	"embed"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed rtp.md
+var rtpFS embed.FS
+
+var rtpAVCNALUGroup decode.Group
+var rtpHEVCNALUGroup decode.Group
+var rtpOpusPacketGroup decode.Group
+var rtpMP3FrameGroup decode.Group
+var rtpAACFrameGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.RTP,
+		&decode.Format{
+			Description:  "Real-time Transport Protocol packet",
+			DecodeFn:     decodeRTP,
+			DefaultInArg: format.RTP_In{SDP: ""},
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.AVC_NALU}, Out: &rtpAVCNALUGroup},
+				{Groups: []*decode.Group{format.HEVC_NALU}, Out: &rtpHEVCNALUGroup},
+				{Groups: []*decode.Group{format.Opus_Packet}, Out: &rtpOpusPacketGroup},
+				{Groups: []*decode.Group{format.MP3_Frame}, Out: &rtpMP3FrameGroup},
+				{Groups: []*decode.Group{format.AAC_Frame}, Out: &rtpAACFrameGroup},
+			},
+		})
+	interp.RegisterFS(rtpFS)
+}
+
+const (
+	extensionProfileOneByte = 0xbede
+	// 0x100 in top 12 bits followed by 4 application specific bits
+	extensionProfileTwoByte     = 0x1000
+	extensionProfileTwoByteMask = 0xfff0
+)
+
+func payloadTypeMapper(codecs map[uint64]codec) scalar.UintFn {
+	return scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		c, ok := codecs[s.Actual]
+		if !ok {
+			c, ok = staticPayloadTypes[s.Actual]
+		}
+		if ok {
+			s.Sym = c.encoding
+			s.Description = c.String()
+		}
+		return s, nil
+	})
+}
+
+func decodeHeaderExtension(d *decode.D) {
+	profile := d.FieldU16("profile", scalar.UintHex)
+	length := d.FieldU16("length")
+	d.FramedFn(int64(length)*32, func(d *decode.D) {
+		switch {
+		case profile == extensionProfileOneByte:
+			d.FieldArray("elements", func(d *decode.D) {
+				for !d.End() {
+					// padding between elements
+					if d.PeekUintBits(8) == 0 {
+						d.FieldU8("padding")
+						continue
+					}
+					stop := false
+					d.FieldStruct("element", func(d *decode.D) {
+						id := d.FieldU4("id")
+						// id 15 is reserved and means stop processing
+						if id == 15 {
+							stop = true
+							return
+						}
+						// length is number of data bytes minus one
+						l := d.FieldU4("length")
+						d.FieldRawLen("data", int64(l+1)*8)
+					})
+					if stop {
+						break
+					}
+				}
+			})
+		case profile&extensionProfileTwoByteMask == extensionProfileTwoByte:
+			d.FieldArray("elements", func(d *decode.D) {
+				for !d.End() {
+					if d.PeekUintBits(8) == 0 {
+						d.FieldU8("padding")
+						continue
+					}
+					d.FieldStruct("element", func(d *decode.D) {
+						d.FieldU8("id")
+						l := d.FieldU8("length")
+						d.FieldRawLen("data", int64(l)*8)
+					})
+				}
+			})
+		}
+		if !d.End() {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+var h264NALTypeNames = scalar.UintMapSymStr{
+	24: "stap_a",
+	25: "stap_b",
+	26: "mtap16",
+	27: "mtap24",
+	28: "fu_a",
+	29: "fu_b",
+}
+
+const (
+	h264STAPA = 24
+	h264FUA   = 28
+)
+
+func decodeH264Payload(d *decode.D) {
+	typ := d.PeekUintBits(8) & 0x1f
+	if typ >= 1 && typ <= 23 {
+		// single NAL unit
+		d.FieldFormatOrRawLen("payload", d.BitsLeft(), &rtpAVCNALUGroup, nil)
+		return
+	}
+
+	d.FieldStruct("payload", func(d *decode.D) {
+		d.FieldStruct("header", func(d *decode.D) {
+			d.FieldU1("forbidden_zero_bit")
+			d.FieldU2("nal_ref_idc")
+			d.FieldU5("type", h264NALTypeNames)
+		})
+		switch typ {
+		case h264STAPA:
+			d.FieldArray("nalus", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("nalu", func(d *decode.D) {
+						size := d.FieldU16("size")
+						d.FieldFormatOrRawLen("nalu", int64(size)*8, &rtpAVCNALUGroup, nil)
+					})
+				}
+			})
+		case h264FUA:
+			d.FieldStruct("fu_header", func(d *decode.D) {
+				d.FieldBool("start")
+				d.FieldBool("end")
+				d.FieldU1("reserved")
+				d.FieldU5("type")
+			})
+			d.FieldRawLen("fragment", d.BitsLeft())
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+var h265NALTypeNames = scalar.UintMapSymStr{
+	48: "aggregation_packet",
+	49: "fragmentation_unit",
+	50: "paci",
+}
+
+const (
+	h265AP = 48
+	h265FU = 49
+)
+
+func decodeH265Payload(d *decode.D) {
+	typ := (d.PeekUintBits(8) >> 1) & 0x3f
+	if typ < 48 {
+		// single NAL unit
+		d.FieldFormatOrRawLen("payload", d.BitsLeft(), &rtpHEVCNALUGroup, nil)
+		return
+	}
+
+	d.FieldStruct("payload", func(d *decode.D) {
+		d.FieldStruct("header", func(d *decode.D) {
+			d.FieldU1("forbidden_zero_bit")
+			d.FieldU6("type", h265NALTypeNames)
+			d.FieldU6("layer_id")
+			d.FieldU3("tid")
+		})
+		switch typ {
+		case h265AP:
+			d.FieldArray("nalus", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("nalu", func(d *decode.D) {
+						size := d.FieldU16("size")
+						d.FieldFormatOrRawLen("nalu", int64(size)*8, &rtpHEVCNALUGroup, nil)
+					})
+				}
+			})
+		case h265FU:
+			d.FieldStruct("fu_header", func(d *decode.D) {
+				d.FieldBool("start")
+				d.FieldBool("end")
+				d.FieldU6("type")
+			})
+			d.FieldRawLen("fragment", d.BitsLeft())
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeMPAPayload(d *decode.D) {
+	d.FieldStruct("payload", func(d *decode.D) {
+		d.FieldU16("mbz")
+		fragmentOffset := d.FieldU16("fragment_offset")
+		if fragmentOffset != 0 {
+			d.FieldRawLen("fragment", d.BitsLeft())
+			return
+		}
+		d.FieldArray("frames", func(d *decode.D) {
+			for !d.End() {
+				d.FieldFormat("frame", &rtpMP3FrameGroup, nil)
+			}
+		})
+	})
+}
+
+func fmtpUint(c codec, name string) int {
+	n, _ := strconv.Atoi(c.fmtp[name])
+	return n
+}
+
+// uses sizelength, indexlength and indexdeltalength to decode AU headers and
+// object type from the audio specific config to decode AAC frames
+func decodeMPEG4GenericPayload(d *decode.D, c codec) {
+	sizeLength := fmtpUint(c, "sizelength")
+	indexLength := fmtpUint(c, "indexlength")
+	indexDeltaLength := fmtpUint(c, "indexdeltalength")
+	if sizeLength == 0 {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+
+	// first 5 bits of AudioSpecificConfig is the object type
+	objectType := -1
+	if config, err := hex.DecodeString(c.fmtp["config"]); err == nil && len(config) > 0 {
+		objectType = int(config[0] >> 3)
+	}
+
+	d.FieldStruct("payload", func(d *decode.D) {
+		var sizes []uint64
+		auHeadersLength := d.FieldU16("au_headers_length")
+		d.FramedFn(int64(auHeadersLength), func(d *decode.D) {
+			d.FieldArray("au_headers", func(d *decode.D) {
+				for i := 0; !d.End(); i++ {
+					d.FieldStruct("au_header", func(d *decode.D) {
+						sizes = append(sizes, d.FieldU("size", sizeLength))
+						if i == 0 {
+							d.FieldU("index", indexLength)
+						} else {
+							d.FieldU("index_delta", indexDeltaLength)
+						}
+					})
+				}
+			})
+		})
+		d.FieldRawLen("padding", int64(d.AlignBits(8)))
+		d.FieldArray("access_units", func(d *decode.D) {
+			for _, size := range sizes {
+				if objectType == -1 {
+					d.FieldRawLen("access_unit", int64(size)*8)
+					continue
+				}
+				d.FieldFormatOrRawLen("access_unit", int64(size)*8, &rtpAACFrameGroup, format.AAC_Frame_In{ObjectType: objectType})
+			}
+		})
+	})
+}
+
+func decodeRTP(d *decode.D) any {
+	var ri format.RTP_In
+	d.ArgAs(&ri)
+
+	codecs := map[uint64]codec{}
+	if ri.SDP != "" {
+		var err error
+		codecs, err = parseSDP(ri.SDP)
+		if err != nil {
+			d.Fatalf("failed to parse sdp: %s", err)
+		}
+	}
+
+	var padding, extension bool
+	var payloadType uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU2("version", d.UintAssert(2))
+		padding = d.FieldBool("padding")
+		extension = d.FieldBool("extension")
+		csrcCount := d.FieldU4("csrc_count")
+		d.FieldBool("marker")
+		payloadType = d.FieldU7("payload_type", payloadTypeMapper(codecs))
+		d.FieldU16("sequence_number")
+		d.FieldU32("timestamp")
+		d.FieldU32("ssrc", scalar.UintHex)
+		d.FieldArray("csrcs", func(d *decode.D) {
+			for i := uint64(0); i < csrcCount; i++ {
+				d.FieldU32("csrc", scalar.UintHex)
+			}
+		})
+	})
+	if extension {
+		d.FieldStruct("header_extension", decodeHeaderExtension)
+	}
+
+	paddingCount := uint64(0)
+	if padding {
+		// last byte of packet is number of padding bytes including itself
+		d.SeekAbs(d.Len()-8, func(d *decode.D) { paddingCount = d.U8() })
+		if paddingCount == 0 || int64(paddingCount)*8 > d.BitsLeft() {
+			d.Fatalf("invalid padding count %d", paddingCount)
+		}
+	}
+
+	d.FramedFn(d.BitsLeft()-int64(paddingCount)*8, func(d *decode.D) {
+		c, ok := codecs[payloadType]
+		if !ok {
+			c = staticPayloadTypes[payloadType]
+		}
+		switch c.encoding {
+		case "h264":
+			decodeH264Payload(d)
+		case "h265":
+			decodeH265Payload(d)
+		case "opus":
+			d.FieldFormatOrRawLen("payload", d.BitsLeft(), &rtpOpusPacketGroup, nil)
+		case "mpa":
+			decodeMPAPayload(d)
+		case "mpeg4-generic":
+			decodeMPEG4GenericPayload(d, c)
+		default:
+			d.FieldRawLen("payload", d.BitsLeft())
+		}
+	})
+
+	if padding {
+		d.FieldRawLen("padding", int64(paddingCount-1)*8)
+		d.FieldU8("padding_count")
+	}
+
+	return nil
+}
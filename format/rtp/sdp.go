@@ -0,0 +1,122 @@
+package rtp
+
+// https://datatracker.ietf.org/doc/html/rfc8866 SDP: Session Description Protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type codec struct {
+	encoding  string // lower case encoding name
+	clockRate uint64
+	channels  uint64
+	fmtp      map[string]string // lower case parameter names
+}
+
+func (c codec) String() string {
+	s := fmt.Sprintf("%s/%d", c.encoding, c.clockRate)
+	if c.channels != 0 {
+		s += fmt.Sprintf("/%d", c.channels)
+	}
+	return s
+}
+
+// https://datatracker.ietf.org/doc/html/rfc3551#section-6
+var staticPayloadTypes = map[uint64]codec{
+	0:  {encoding: "pcmu", clockRate: 8000, channels: 1},
+	3:  {encoding: "gsm", clockRate: 8000, channels: 1},
+	4:  {encoding: "g723", clockRate: 8000, channels: 1},
+	5:  {encoding: "dvi4", clockRate: 8000, channels: 1},
+	6:  {encoding: "dvi4", clockRate: 16000, channels: 1},
+	7:  {encoding: "lpc", clockRate: 8000, channels: 1},
+	8:  {encoding: "pcma", clockRate: 8000, channels: 1},
+	9:  {encoding: "g722", clockRate: 8000, channels: 1},
+	10: {encoding: "l16", clockRate: 44100, channels: 2},
+	11: {encoding: "l16", clockRate: 44100, channels: 1},
+	12: {encoding: "qcelp", clockRate: 8000, channels: 1},
+	13: {encoding: "cn", clockRate: 8000, channels: 1},
+	14: {encoding: "mpa", clockRate: 90000},
+	15: {encoding: "g728", clockRate: 8000, channels: 1},
+	16: {encoding: "dvi4", clockRate: 11025, channels: 1},
+	17: {encoding: "dvi4", clockRate: 22050, channels: 1},
+	18: {encoding: "g729", clockRate: 8000, channels: 1},
+	25: {encoding: "celb", clockRate: 90000},
+	26: {encoding: "jpeg", clockRate: 90000},
+	28: {encoding: "nv", clockRate: 90000},
+	31: {encoding: "h261", clockRate: 90000},
+	32: {encoding: "mpv", clockRate: 90000},
+	33: {encoding: "mp2t", clockRate: 90000},
+	34: {encoding: "h263", clockRate: 90000},
+}
+
+// parseSDP returns payload type to codec mappings from a=rtpmap and a=fmtp attributes.
+// Payload types are assumed to be unique across media descriptions.
+func parseSDP(s string) (map[uint64]codec, error) {
+	codecs := map[uint64]codec{}
+	fmtps := map[uint64]map[string]string{}
+
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimRight(l, "\r")
+		attr, ok := strings.CutPrefix(l, "a=")
+		if !ok {
+			continue
+		}
+		name, value, ok := strings.Cut(attr, ":")
+		if !ok || (name != "rtpmap" && name != "fmtp") {
+			continue
+		}
+		ptStr, params, ok := strings.Cut(value, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s attribute %q", name, l)
+		}
+		pt, err := strconv.ParseUint(ptStr, 10, 7)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s payload type %q", name, ptStr)
+		}
+
+		switch name {
+		case "rtpmap":
+			// <encoding name>/<clock rate>[/<encoding parameters>]
+			parts := strings.Split(strings.TrimSpace(params), "/")
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("invalid rtpmap attribute %q", l)
+			}
+			c := codec{encoding: strings.ToLower(parts[0])}
+			if c.clockRate, err = strconv.ParseUint(parts[1], 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid rtpmap clock rate %q", parts[1])
+			}
+			if len(parts) > 2 {
+				if c.channels, err = strconv.ParseUint(parts[2], 10, 32); err != nil {
+					return nil, fmt.Errorf("invalid rtpmap channels %q", parts[2])
+				}
+			}
+			codecs[pt] = c
+		case "fmtp":
+			m := map[string]string{}
+			for _, p := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if k == "" {
+					continue
+				}
+				m[strings.ToLower(k)] = v
+			}
+			fmtps[pt] = m
+		}
+	}
+
+	for pt, m := range fmtps {
+		c, ok := codecs[pt]
+		if !ok {
+			c, ok = staticPayloadTypes[pt]
+		}
+		if !ok {
+			continue
+		}
+		c.fmtp = m
+		codecs[pt] = c
+	}
+
+	return codecs, nil
+}
@@ -0,0 +1,182 @@
+#!/usr/bin/env python3
+# generates rtp and rtcp test packets, payloads are taken from other format test files
+import re
+import struct
+
+SSRC = 0x11223344
+
+
+def annexb_nalus(path):
+    # trailing zero byte of 4 byte start codes ends up at end of previous nal
+    b = open(path, "rb").read()
+    return [n.rstrip(b"\x00") for n in re.split(b"\x00\x00\x01", b) if n.rstrip(b"\x00")]
+
+
+def rtp(pt, seq, ts, payload, marker=0, csrcs=(), extension=None, padding=0):
+    first = 2 << 6 | (1 << 5 if padding else 0) | (1 << 4 if extension else 0) | len(csrcs)
+    h = struct.pack(">BBHII", first, marker << 7 | pt, seq, ts, SSRC)
+    h += b"".join(struct.pack(">I", c) for c in csrcs)
+    if extension:
+        profile, data = extension
+        data += b"\x00" * (-len(data) % 4)
+        h += struct.pack(">HH", profile, len(data) // 4) + data
+    p = b""
+    if padding:
+        p = b"\x00" * (padding - 1) + bytes([padding])
+    return h + payload + p
+
+
+avc = annexb_nalus("../../mpeg/testdata/avc_annexb")
+avc_sps, avc_pps, avc_idr = avc[0], avc[1], avc[3]
+hevc = annexb_nalus("../../mpeg/testdata/hevc_annexb")
+hevc_vps, hevc_sps, hevc_pps, hevc_idr = hevc[0], hevc[1], hevc[2], hevc[4]
+
+open("session.sdp", "w").write(
+    "v=0\r\n"
+    "o=- 0 0 IN IP4 127.0.0.1\r\n"
+    "s=test\r\n"
+    "c=IN IP4 127.0.0.1\r\n"
+    "t=0 0\r\n"
+    "m=audio 5004 RTP/AVP 0 14 97 111\r\n"
+    "a=rtpmap:97 MPEG4-GENERIC/44100/2\r\n"
+    "a=fmtp:97 streamtype=5;profile-level-id=15;mode=AAC-hbr;sizeLength=13;indexLength=3;indexDeltaLength=3;config=1210\r\n"
+    "a=rtpmap:111 opus/48000/2\r\n"
+    "m=video 5006 RTP/AVP 96 98\r\n"
+    "a=rtpmap:96 H264/90000\r\n"
+    "a=fmtp:96 packetization-mode=1\r\n"
+    "a=rtpmap:98 H265/90000\r\n"
+)
+
+open("h264_single.rtp", "wb").write(rtp(96, 1, 0, avc_sps))
+open("h264_stap_a.rtp", "wb").write(
+    rtp(96, 2, 0, bytes([0x78]) + b"".join(struct.pack(">H", len(n)) + n for n in [avc_sps, avc_pps]))
+)
+# first fragment of idr slice
+fu_indicator = (avc_idr[0] & 0xE0) | 28
+fu_header = 0x80 | (avc_idr[0] & 0x1F)
+open("h264_fu_a.rtp", "wb").write(rtp(96, 3, 0, bytes([fu_indicator, fu_header]) + avc_idr[1:101]))
+
+ap_header = struct.pack(">H", 48 << 9 | 1)
+open("h265_ap.rtp", "wb").write(
+    rtp(98, 1, 0, ap_header + b"".join(struct.pack(">H", len(n)) + n for n in [hevc_vps, hevc_sps, hevc_pps]))
+)
+# last fragment of idr
+idr_type = (hevc_idr[0] >> 1) & 0x3F
+fu_payload_header = struct.pack(">H", 49 << 9 | 1)
+open("h265_fu.rtp", "wb").write(
+    rtp(98, 2, 0, fu_payload_header + bytes([0x40 | idr_type]) + hevc_idr[-100:], marker=1)
+)
+
+# opus with csrc, one-byte header extension (ssrc audio level and padding) and padding
+opus = open("../../opus/testdata/opus-audio", "rb").read()
+open("opus.rtp", "wb").write(
+    rtp(
+        111,
+        1,
+        960,
+        opus,
+        csrcs=[0xAABBCCDD],
+        extension=(0xBEDE, bytes([0x10, 0x85, 0x00, 0x21, 0x01, 0x02])),
+        padding=4,
+    )
+)
+
+# two-byte header extension
+open("pcmu.rtp", "wb").write(
+    rtp(0, 1, 160, bytes([0xFF] * 160), extension=(0x1000, bytes([0x01, 0x02, 0xAB, 0xCD, 0x00, 0x02, 0x00]))),
+)
+
+aac = open("../../mpeg/testdata/aac_frame", "rb").read()
+au_headers = struct.pack(">HH", 16, len(aac) << 3)
+open("aac.rtp", "wb").write(rtp(97, 1, 1024, au_headers + aac, marker=1))
+
+mp3 = open("../../mpeg/testdata/mp3-frame-128000br-2ch-44100hz", "rb").read()
+open("mpa.rtp", "wb").write(rtp(14, 1, 0, struct.pack(">HH", 0, 0) + mp3))
+
+
+def rtcp(typ, count, body, padding=0):
+    if padding:
+        body += b"\x00" * (padding - 1) + bytes([padding])
+    assert len(body) % 4 == 0
+    return struct.pack(">BBH", 2 << 6 | (1 << 5 if padding else 0) | count, typ, len(body) // 4) + body
+
+
+def report_block(ssrc):
+    return struct.pack(">IB", ssrc, 10) + (-3 & 0xFFFFFF).to_bytes(3, "big") + struct.pack(">IIII", 1000, 20, 0x11112222, 65536)
+
+
+def sdes_chunk(ssrc, items):
+    b = struct.pack(">I", ssrc)
+    for typ, value in items:
+        b += bytes([typ, len(value)]) + value
+    b += b"\x00"
+    return b + b"\x00" * (-len(b) % 4)
+
+
+sr = rtcp(
+    200,
+    1,
+    struct.pack(">IIIIII", SSRC, 3913056000, 0x80000000, 90000, 10, 1000) + report_block(0x55667788),
+)
+sdes = rtcp(
+    202,
+    2,
+    sdes_chunk(SSRC, [(1, b"user@example.com"), (6, b"make_test.py")])
+    + sdes_chunk(0x55667788, [(1, b"other"), (8, bytes([3]) + b"pfxvalue")]),
+)
+reason = b"done"
+bye_body = struct.pack(">I", SSRC) + bytes([len(reason)]) + reason
+bye_body += b"\x00" * (-len(bye_body) % 4)
+bye = rtcp(203, 1, bye_body)
+open("sr_sdes_bye.rtcp", "wb").write(sr + sdes + bye)
+
+rr = rtcp(201, 1, struct.pack(">I", 0x55667788) + report_block(SSRC), padding=4)
+nack = rtcp(205, 1, struct.pack(">IIHH", 0x55667788, SSRC, 100, 0b101))
+pli = rtcp(206, 1, struct.pack(">II", 0x55667788, SSRC))
+fir = rtcp(206, 4, struct.pack(">IIIB", 0x55667788, 0, SSRC, 7) + b"\x00\x00\x00")
+# 1.5 mbit/s
+remb = rtcp(
+    206,
+    15,
+    struct.pack(">II", 0x55667788, 0) + b"REMB" + bytes([1]) + (3 << 18 | 187500).to_bytes(3, "big") + struct.pack(">I", SSRC),
+)
+xr = rtcp(207, 0, struct.pack(">I", 0x55667788) + struct.pack(">BBHII", 4, 0, 2, 3913056000, 0))
+app = rtcp(204, 1, struct.pack(">I", 0x55667788) + b"TEST" + b"\x01\x02\x03\x04")
+open("feedback.rtcp", "wb").write(rr + nack + pli + fir + remb + xr + app)
+
+
+def checksum(b):
+    if len(b) % 2:
+        b += b"\x00"
+    s = sum(struct.unpack(">%dH" % (len(b) // 2), b))
+    while s >> 16:
+        s = (s & 0xFFFF) + (s >> 16)
+    return ~s & 0xFFFF
+
+
+def ipv4_udp(src, dst, sport, dport, data):
+    udp = struct.pack(">HHHH", sport, dport, 8 + len(data), 0) + data
+    ip = struct.pack(">BBHHHBBH4s4s", 0x45, 0, 20 + len(udp), 0, 0x4000, 64, 17, 0, bytes(src), bytes(dst))
+    ip = ip[:10] + struct.pack(">H", checksum(ip)) + ip[12:]
+    return ip + udp
+
+
+def pcap(packets):
+    # LINKTYPE_RAW
+    out = struct.pack("<IHHiIII", 0xA1B2C3D4, 2, 4, 0, 0, 65535, 101)
+    for i, p in enumerate(packets):
+        out += struct.pack("<IIII", 1700000000, i * 1000, len(p), len(p)) + p
+    return out
+
+
+a = [192, 168, 0, 1]
+b = [192, 168, 0, 2]
+open("session.pcap", "wb").write(
+    pcap(
+        [
+            ipv4_udp(a, b, 5006, 5006, open("h264_stap_a.rtp", "rb").read()),
+            ipv4_udp(a, b, 5006, 5006, open("h264_fu_a.rtp", "rb").read()),
+            ipv4_udp(a, b, 5007, 5007, sr + sdes),
+        ]
+    )
+)
@@ -0,0 +1,761 @@
+package sevenzip
+
+// https://py7zr.readthedocs.io/en/latest/archive_format.html
+// https://github.com/ip7z/7zip/blob/main/DOC/7zFormat.txt
+
+import (
+	"embed"
+	"hash/crc32"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed sevenzip.md
+var sevenZipFS embed.FS
+
+var probeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.Seven_Zip,
+		&decode.Format{
+			Description: "7z archive",
+			Extensions:  []string{"7z"},
+			MIMETypes:   []string{"application/x-7z-compressed"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    sevenZipDecode,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(sevenZipFS)
+}
+
+var signature = []byte("7z\xbc\xaf\x27\x1c")
+
+const signatureHeaderSize = 32
+
+const (
+	propertyEnd                   = 0x00
+	propertyHeader                = 0x01
+	propertyArchiveProperties     = 0x02
+	propertyAdditionalStreamsInfo = 0x03
+	propertyMainStreamsInfo       = 0x04
+	propertyFilesInfo             = 0x05
+	propertyPackInfo              = 0x06
+	propertyUnpackInfo            = 0x07
+	propertySubStreamsInfo        = 0x08
+	propertySize                  = 0x09
+	propertyCRC                   = 0x0a
+	propertyFolder                = 0x0b
+	propertyCodersUnpackSize      = 0x0c
+	propertyNumUnpackStream       = 0x0d
+	propertyEmptyStream           = 0x0e
+	propertyEmptyFile             = 0x0f
+	propertyAnti                  = 0x10
+	propertyName                  = 0x11
+	propertyCTime                 = 0x12
+	propertyATime                 = 0x13
+	propertyMTime                 = 0x14
+	propertyWinAttributes         = 0x15
+	propertyComment               = 0x16
+	propertyEncodedHeader         = 0x17
+	propertyStartPos              = 0x18
+	propertyDummy                 = 0x19
+)
+
+var propertyNames = scalar.UintMapSymStr{
+	propertyEnd:                   "end",
+	propertyHeader:                "header",
+	propertyArchiveProperties:     "archive_properties",
+	propertyAdditionalStreamsInfo: "additional_streams_info",
+	propertyMainStreamsInfo:       "main_streams_info",
+	propertyFilesInfo:             "files_info",
+	propertyPackInfo:              "pack_info",
+	propertyUnpackInfo:            "unpack_info",
+	propertySubStreamsInfo:        "substreams_info",
+	propertySize:                  "size",
+	propertyCRC:                   "crc",
+	propertyFolder:                "folder",
+	propertyCodersUnpackSize:      "coders_unpack_size",
+	propertyNumUnpackStream:       "num_unpack_stream",
+	propertyEmptyStream:           "empty_stream",
+	propertyEmptyFile:             "empty_file",
+	propertyAnti:                  "anti",
+	propertyName:                  "name",
+	propertyCTime:                 "ctime",
+	propertyATime:                 "atime",
+	propertyMTime:                 "mtime",
+	propertyWinAttributes:         "win_attributes",
+	propertyComment:               "comment",
+	propertyEncodedHeader:         "encoded_header",
+	propertyStartPos:              "start_pos",
+	propertyDummy:                 "dummy",
+}
+
+const codecCopy = 0x00
+
+var codecNames = scalar.UintMap{
+	codecCopy:  {Sym: "copy"},
+	0x03:       {Sym: "delta"},
+	0x04:       {Sym: "bcj_x86", Description: "x86 branch converter"},
+	0x05:       {Sym: "bcj_ppc", Description: "PowerPC branch converter"},
+	0x06:       {Sym: "bcj_ia64", Description: "IA64 branch converter"},
+	0x07:       {Sym: "bcj_arm", Description: "ARM branch converter"},
+	0x08:       {Sym: "bcj_armt", Description: "ARM Thumb branch converter"},
+	0x09:       {Sym: "bcj_sparc", Description: "SPARC branch converter"},
+	0x0a:       {Sym: "bcj_arm64", Description: "ARM64 branch converter"},
+	0x21:       {Sym: "lzma2"},
+	0x030101:   {Sym: "lzma"},
+	0x03030103: {Sym: "bcj", Description: "x86 branch converter"},
+	0x0303011b: {Sym: "bcj2", Description: "x86 branch converter 2"},
+	0x03030205: {Sym: "ppc", Description: "PowerPC branch converter"},
+	0x03030401: {Sym: "ia64", Description: "IA64 branch converter"},
+	0x03030501: {Sym: "arm", Description: "ARM branch converter"},
+	0x03030701: {Sym: "armt", Description: "ARM Thumb branch converter"},
+	0x03030805: {Sym: "sparc", Description: "SPARC branch converter"},
+	0x030401:   {Sym: "ppmd"},
+	0x040108:   {Sym: "deflate"},
+	0x040109:   {Sym: "deflate64"},
+	0x040202:   {Sym: "bzip2"},
+	0x04f71101: {Sym: "zstd"},
+	0x04f71102: {Sym: "brotli"},
+	0x04f71104: {Sym: "lz4"},
+	0x06f10701: {Sym: "aes", Description: "7zAES (AES-256 + SHA-256)"},
+}
+
+// windows file attribute flags
+const (
+	fileAttributeDirectory = 0x10
+	// high 16 bits are unix mode
+	fileAttributeUnixExtension = 0x8000
+)
+
+// number is 1-9 bytes where number of leading one bits in first byte is number of extra
+// little endian bytes and rest of first byte is the most significant bits
+func number(d *decode.D) uint64 {
+	first := d.U8()
+	var v uint64
+	mask := uint64(0x80)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			return v | (first&(mask-1))<<(8*i)
+		}
+		v |= d.U8() << (8 * i)
+		mask >>= 1
+	}
+	return v
+}
+
+func fieldNumber(d *decode.D, name string, sms ...scalar.UintMapper) uint64 {
+	return d.FieldUintFn(name, number, sms...)
+}
+
+type coder struct {
+	id            uint64
+	numInStreams  uint64
+	numOutStreams uint64
+}
+
+type folder struct {
+	coders           []coder
+	numPackStreams   uint64
+	numOutStreams    uint64
+	finalOutStream   uint64 // out stream not bound to a coder in stream
+	unpackSize       uint64 // size of final out stream
+	numUnpackStreams uint64
+	hasCRC           bool
+}
+
+func (f folder) isCopy() bool {
+	return len(f.coders) == 1 && f.coders[0].id == codecCopy && f.numPackStreams == 1
+}
+
+type streamsInfo struct {
+	packPos          uint64
+	packSizes        []uint64
+	folders          []folder
+	subStreamSizes   [][]uint64 // unpack stream sizes per folder
+	hasSubStreamInfo bool
+}
+
+type file struct {
+	name        string
+	emptyStream bool
+	emptyFile   bool
+	attributes  uint64
+	hasAttrs    bool
+}
+
+type decodeContext struct {
+	mainStreams    *streamsInfo
+	encodedStreams *streamsInfo
+	files          []file
+}
+
+// counts are untrusted, each entry needs at least one bit so larger counts are invalid
+func checkCount(d *decode.D, name string, n uint64) {
+	if n > uint64(d.BitsLeft()) {
+		d.Fatalf("%s %d larger than data left", name, n)
+	}
+}
+
+// bit vector of n bits, most significant bit first, padded to byte
+func fieldBitVector(d *decode.D, name string, n uint64) []bool {
+	checkCount(d, name, n)
+	bs := make([]bool, n)
+	d.FieldArray(name, func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			bs[i] = d.FieldBool("bit")
+		}
+	})
+	if n%8 != 0 {
+		d.FieldU("padding", int(8-n%8), d.UintValidate(0))
+	}
+	return bs
+}
+
+// bit vector prefixed by an all defined byte
+func fieldDefinedVector(d *decode.D, n uint64) []bool {
+	allDefined := d.FieldU8("all_defined")
+	if allDefined != 0 {
+		checkCount(d, "defined", n)
+		bs := make([]bool, n)
+		for i := range bs {
+			bs[i] = true
+		}
+		return bs
+	}
+	return fieldBitVector(d, "defined", n)
+}
+
+func fieldDigests(d *decode.D, n uint64) []bool {
+	defined := fieldDefinedVector(d, n)
+	d.FieldArray("digests", func(d *decode.D) {
+		for _, def := range defined {
+			if def {
+				d.FieldU32("crc", scalar.UintHex)
+			}
+		}
+	})
+	return defined
+}
+
+func fieldPropertyID(d *decode.D) uint64 {
+	return fieldNumber(d, "property_id", propertyNames)
+}
+
+// fieldProperties decodes properties until end property, each property is a struct named
+// after its property id
+func fieldProperties(d *decode.D, fn func(d *decode.D, id uint64)) {
+	for {
+		id := d.PeekUintBits(8)
+		if id == propertyEnd {
+			d.FieldU8("end", propertyNames)
+			return
+		}
+		name, ok := propertyNames[id]
+		if !ok {
+			name = "unknown"
+		}
+		d.FieldStruct(name, func(d *decode.D) {
+			fieldPropertyID(d)
+			fn(d, id)
+		})
+	}
+}
+
+func decodePackInfo(d *decode.D, si *streamsInfo) {
+	si.packPos = fieldNumber(d, "pack_pos")
+	numPackStreams := fieldNumber(d, "num_pack_streams")
+	fieldProperties(d, func(d *decode.D, id uint64) {
+		switch id {
+		case propertySize:
+			d.FieldArray("sizes", func(d *decode.D) {
+				for i := uint64(0); i < numPackStreams; i++ {
+					si.packSizes = append(si.packSizes, fieldNumber(d, "size"))
+				}
+			})
+		case propertyCRC:
+			fieldDigests(d, numPackStreams)
+		default:
+			d.Fatalf("unknown pack info property %d", id)
+		}
+	})
+}
+
+func decodeFolder(d *decode.D) folder {
+	var f folder
+	var totalInStreams uint64
+	var totalOutStreams uint64
+	numCoders := fieldNumber(d, "num_coders")
+	d.FieldArray("coders", func(d *decode.D) {
+		for i := uint64(0); i < numCoders; i++ {
+			d.FieldStruct("coder", func(d *decode.D) {
+				c := coder{numInStreams: 1, numOutStreams: 1}
+				d.FieldU2("reserved")
+				hasAttributes := d.FieldBool("has_attributes")
+				isComplex := d.FieldBool("is_complex")
+				idSize := d.FieldU4("id_size")
+				c.id = d.FieldUE("id", int(idSize)*8, decode.BigEndian, codecNames, scalar.UintHex)
+				if isComplex {
+					c.numInStreams = fieldNumber(d, "num_in_streams")
+					c.numOutStreams = fieldNumber(d, "num_out_streams")
+				}
+				if hasAttributes {
+					propertiesSize := fieldNumber(d, "properties_size")
+					d.FieldRawLen("properties", int64(propertiesSize)*8)
+				}
+				totalInStreams += c.numInStreams
+				totalOutStreams += c.numOutStreams
+				f.coders = append(f.coders, c)
+			})
+		}
+	})
+
+	numBindPairs := totalOutStreams - 1
+	boundOutStreams := map[uint64]bool{}
+	d.FieldArray("bind_pairs", func(d *decode.D) {
+		for i := uint64(0); i < numBindPairs; i++ {
+			d.FieldStruct("bind_pair", func(d *decode.D) {
+				fieldNumber(d, "in_index")
+				boundOutStreams[fieldNumber(d, "out_index")] = true
+			})
+		}
+	})
+
+	f.numPackStreams = totalInStreams - numBindPairs
+	if f.numPackStreams > 1 {
+		d.FieldArray("pack_stream_indexes", func(d *decode.D) {
+			for i := uint64(0); i < f.numPackStreams; i++ {
+				fieldNumber(d, "index")
+			}
+		})
+	}
+
+	f.numOutStreams = totalOutStreams
+	f.numUnpackStreams = 1
+	for i := uint64(0); i < totalOutStreams; i++ {
+		if !boundOutStreams[i] {
+			f.finalOutStream = i
+			break
+		}
+	}
+
+	return f
+}
+
+func decodeUnpackInfo(d *decode.D, si *streamsInfo) {
+	fieldProperties(d, func(d *decode.D, id uint64) {
+		switch id {
+		case propertyFolder:
+			numFolders := fieldNumber(d, "num_folders")
+			external := d.FieldU8("external")
+			if external != 0 {
+				fieldNumber(d, "data_stream_index")
+				// folders are in some additional stream, not supported
+				return
+			}
+			d.FieldArray("folders", func(d *decode.D) {
+				for i := uint64(0); i < numFolders; i++ {
+					d.FieldStruct("folder", func(d *decode.D) {
+						si.folders = append(si.folders, decodeFolder(d))
+					})
+				}
+			})
+		case propertyCodersUnpackSize:
+			d.FieldArray("folders", func(d *decode.D) {
+				for i := range si.folders {
+					f := &si.folders[i]
+					d.FieldArray("unpack_sizes", func(d *decode.D) {
+						for j := uint64(0); j < f.numOutStreams; j++ {
+							size := fieldNumber(d, "size")
+							if j == f.finalOutStream {
+								f.unpackSize = size
+							}
+						}
+					})
+				}
+			})
+		case propertyCRC:
+			defined := fieldDigests(d, uint64(len(si.folders)))
+			for i, def := range defined {
+				si.folders[i].hasCRC = def
+			}
+		default:
+			d.Fatalf("unknown unpack info property %d", id)
+		}
+	})
+}
+
+func decodeSubStreamsInfo(d *decode.D, si *streamsInfo) {
+	si.hasSubStreamInfo = true
+	sizesDecoded := false
+
+	fieldProperties(d, func(d *decode.D, id uint64) {
+		switch id {
+		case propertyNumUnpackStream:
+			d.FieldArray("num_unpack_streams", func(d *decode.D) {
+				for i := range si.folders {
+					si.folders[i].numUnpackStreams = fieldNumber(d, "num_unpack_stream")
+				}
+			})
+		case propertySize:
+			sizesDecoded = true
+			d.FieldArray("folders", func(d *decode.D) {
+				for _, f := range si.folders {
+					if f.numUnpackStreams == 0 {
+						si.subStreamSizes = append(si.subStreamSizes, nil)
+						continue
+					}
+					// last size is implicit, folder size minus the others
+					var sizes []uint64
+					var sum uint64
+					d.FieldArray("sizes", func(d *decode.D) {
+						for j := uint64(0); j < f.numUnpackStreams-1; j++ {
+							s := fieldNumber(d, "size")
+							sizes = append(sizes, s)
+							sum += s
+						}
+					})
+					sizes = append(sizes, f.unpackSize-sum)
+					si.subStreamSizes = append(si.subStreamSizes, sizes)
+				}
+			})
+		case propertyCRC:
+			var n uint64
+			for _, f := range si.folders {
+				if f.numUnpackStreams != 1 || !f.hasCRC {
+					n += f.numUnpackStreams
+				}
+			}
+			fieldDigests(d, n)
+		default:
+			d.Fatalf("unknown substreams info property %d", id)
+		}
+	})
+
+	if !sizesDecoded {
+		for _, f := range si.folders {
+			if f.numUnpackStreams == 1 {
+				si.subStreamSizes = append(si.subStreamSizes, []uint64{f.unpackSize})
+			} else {
+				si.subStreamSizes = append(si.subStreamSizes, nil)
+			}
+		}
+	}
+}
+
+func decodeStreamsInfo(d *decode.D) *streamsInfo {
+	si := &streamsInfo{}
+	fieldProperties(d, func(d *decode.D, id uint64) {
+		switch id {
+		case propertyPackInfo:
+			decodePackInfo(d, si)
+		case propertyUnpackInfo:
+			decodeUnpackInfo(d, si)
+		case propertySubStreamsInfo:
+			decodeSubStreamsInfo(d, si)
+		default:
+			d.Fatalf("unknown streams info property %d", id)
+		}
+	})
+
+	if !si.hasSubStreamInfo {
+		for _, f := range si.folders {
+			si.subStreamSizes = append(si.subStreamSizes, []uint64{f.unpackSize})
+		}
+	}
+
+	return si
+}
+
+func decodeFilesInfo(d *decode.D, ctx *decodeContext) {
+	numFiles := fieldNumber(d, "num_files")
+	checkCount(d, "num_files", numFiles)
+	files := make([]file, numFiles)
+	var emptyStreams []uint64 // file indexes with empty stream
+
+	d.FieldArray("properties", func(d *decode.D) {
+		for {
+			id := d.PeekUintBits(8)
+			if id == propertyEnd {
+				d.FieldU8("end", propertyNames)
+				return
+			}
+			d.FieldStruct("property", func(d *decode.D) {
+				fieldPropertyID(d)
+				size := fieldNumber(d, "size")
+				d.FramedFn(int64(size)*8, func(d *decode.D) {
+					switch id {
+					case propertyEmptyStream:
+						bs := fieldBitVector(d, "empty_streams", numFiles)
+						for i, b := range bs {
+							files[i].emptyStream = b
+							if b {
+								emptyStreams = append(emptyStreams, uint64(i))
+							}
+						}
+					case propertyEmptyFile, propertyAnti:
+						name := "empty_files"
+						if id == propertyAnti {
+							name = "anti"
+						}
+						bs := fieldBitVector(d, name, uint64(len(emptyStreams)))
+						if id == propertyEmptyFile {
+							for i, b := range bs {
+								files[emptyStreams[i]].emptyFile = b
+							}
+						}
+					case propertyName:
+						external := d.FieldU8("external")
+						if external != 0 {
+							fieldNumber(d, "data_index")
+							return
+						}
+						d.FieldArray("names", func(d *decode.D) {
+							for i := uint64(0); i < numFiles && !d.End(); i++ {
+								files[i].name = d.FieldUTF16LENull("name")
+							}
+						})
+					case propertyCTime, propertyATime, propertyMTime:
+						defined := fieldDefinedVector(d, numFiles)
+						external := d.FieldU8("external")
+						if external != 0 {
+							fieldNumber(d, "data_index")
+							return
+						}
+						d.FieldArray("times", func(d *decode.D) {
+							for _, def := range defined {
+								if def {
+									d.FieldU64("time", scalar.UintActualWindowsFileTimeDescription(time.RFC3339))
+								}
+							}
+						})
+					case propertyWinAttributes:
+						defined := fieldDefinedVector(d, numFiles)
+						external := d.FieldU8("external")
+						if external != 0 {
+							fieldNumber(d, "data_index")
+							return
+						}
+						d.FieldArray("attributes", func(d *decode.D) {
+							for i, def := range defined {
+								if def {
+									files[i].attributes = d.FieldU32("attribute", scalar.UintHex)
+									files[i].hasAttrs = true
+								}
+							}
+						})
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+					if !d.End() {
+						d.FieldRawLen("unknown", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+
+	ctx.files = files
+}
+
+func decodeHeader(d *decode.D, ctx *decodeContext) {
+	id := fieldPropertyID(d)
+	switch id {
+	case propertyHeader:
+		fieldProperties(d, func(d *decode.D, id uint64) {
+			switch id {
+			case propertyArchiveProperties:
+				d.FieldArray("properties", func(d *decode.D) {
+					for d.PeekUintBits(8) != propertyEnd {
+						d.FieldStruct("property", func(d *decode.D) {
+							fieldPropertyID(d)
+							size := fieldNumber(d, "size")
+							d.FieldRawLen("data", int64(size)*8)
+						})
+					}
+				})
+				d.FieldU8("end", propertyNames)
+			case propertyAdditionalStreamsInfo:
+				decodeStreamsInfo(d)
+			case propertyMainStreamsInfo:
+				ctx.mainStreams = decodeStreamsInfo(d)
+			case propertyFilesInfo:
+				decodeFilesInfo(d, ctx)
+			default:
+				d.Fatalf("unknown header property %d", id)
+			}
+		})
+	case propertyEncodedHeader:
+		// header is packed (usually LZMA) and described by streams info
+		fieldProperties(d, func(d *decode.D, id uint64) {
+			switch id {
+			case propertyPackInfo:
+				if ctx.encodedStreams == nil {
+					ctx.encodedStreams = &streamsInfo{}
+				}
+				decodePackInfo(d, ctx.encodedStreams)
+			case propertyUnpackInfo:
+				if ctx.encodedStreams == nil {
+					ctx.encodedStreams = &streamsInfo{}
+				}
+				decodeUnpackInfo(d, ctx.encodedStreams)
+			default:
+				d.Fatalf("unknown encoded header property %d", id)
+			}
+		})
+	default:
+		d.Fatalf("unknown header type %d", id)
+	}
+}
+
+// packStreamRanges returns bit ranges for each pack stream
+func packStreamRanges(si *streamsInfo) [][2]int64 {
+	var rs [][2]int64
+	pos := int64(signatureHeaderSize+si.packPos) * 8
+	for _, s := range si.packSizes {
+		rs = append(rs, [2]int64{pos, int64(s) * 8})
+		pos += int64(s) * 8
+	}
+	return rs
+}
+
+func fieldPackedStreams(d *decode.D, name string, elementName string, si *streamsInfo) {
+	d.FieldArray(name, func(d *decode.D) {
+		for _, r := range packStreamRanges(si) {
+			if r[0]+r[1] > d.Len() {
+				d.Errorf("packed stream outside file")
+			}
+			d.RangeFn(r[0], r[1], func(d *decode.D) {
+				d.FieldRawLen(elementName, d.BitsLeft())
+			})
+		}
+	})
+}
+
+func fieldFiles(d *decode.D, ctx *decodeContext) {
+	si := ctx.mainStreams
+	if si == nil {
+		si = &streamsInfo{}
+	}
+	packRanges := packStreamRanges(si)
+
+	folderIndex := 0
+	subStreamIndex := 0
+	packStreamIndex := 0
+	var folderOffset int64
+
+	// advance to next folder with unpack streams
+	nextFolder := func() {
+		for folderIndex < len(si.folders) &&
+			subStreamIndex >= len(si.subStreamSizes[folderIndex]) {
+			packStreamIndex += int(si.folders[folderIndex].numPackStreams)
+			folderIndex++
+			subStreamIndex = 0
+			folderOffset = 0
+		}
+	}
+
+	d.FieldArray("files", func(d *decode.D) {
+		for _, f := range ctx.files {
+			d.FieldStruct("file", func(d *decode.D) {
+				d.FieldValueStr("name", f.name)
+				isDir := f.emptyStream && !f.emptyFile
+				if f.hasAttrs {
+					isDir = f.attributes&fileAttributeDirectory != 0
+					if f.attributes&fileAttributeUnixExtension != 0 {
+						d.FieldValueUint("unix_mode", f.attributes>>16, scalar.UintOct)
+					}
+				}
+				d.FieldValueBool("directory", isDir)
+
+				if f.emptyStream {
+					d.FieldValueUint("size", 0)
+					return
+				}
+
+				nextFolder()
+				if folderIndex >= len(si.folders) {
+					d.Errorf("file stream outside folders")
+				}
+				fo := si.folders[folderIndex]
+				size := si.subStreamSizes[folderIndex][subStreamIndex]
+
+				d.FieldValueUint("size", size)
+				d.FieldValueUint("folder", uint64(folderIndex))
+
+				// data for copy (stored) folders can be referenced directly
+				if fo.isCopy() && packStreamIndex < len(packRanges) {
+					start := packRanges[packStreamIndex][0] + folderOffset
+					if start+int64(size)*8 > d.Len() {
+						d.Errorf("file data outside file")
+					}
+					d.RangeFn(start, int64(size)*8, func(d *decode.D) {
+						d.FieldFormatOrRawLen("data", d.BitsLeft(), &probeGroup, format.Probe_In{})
+					})
+				}
+
+				folderOffset += int64(size) * 8
+				subStreamIndex++
+			})
+		}
+	})
+}
+
+func sevenZipDecode(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	var nextHeaderOffset uint64
+	var nextHeaderSize uint64
+
+	d.FieldStruct("signature_header", func(d *decode.D) {
+		d.FieldRawLen("signature", int64(len(signature))*8, d.AssertBitBuf(signature))
+		d.FieldStruct("version", func(d *decode.D) {
+			d.FieldU8("major")
+			d.FieldU8("minor")
+		})
+
+		startHeaderCRC := crc32.NewIEEE()
+		d.Copy(startHeaderCRC, bitio.NewIOReader(d.BitBufRange(d.Pos()+32, 20*8)))
+		d.FieldU32("start_header_crc", d.UintValidateBytes(startHeaderCRC.Sum(nil)), scalar.UintHex)
+		nextHeaderOffset = d.FieldU64("next_header_offset")
+		nextHeaderSize = d.FieldU64("next_header_size")
+
+		nextHeaderPos := int64(signatureHeaderSize+nextHeaderOffset) * 8
+		if nextHeaderPos+int64(nextHeaderSize)*8 > d.Len() {
+			d.FieldU32("next_header_crc", scalar.UintHex)
+			d.Fatalf("next header outside file")
+		}
+		nextHeaderCRC := crc32.NewIEEE()
+		d.Copy(nextHeaderCRC, bitio.NewIOReader(d.BitBufRange(nextHeaderPos, int64(nextHeaderSize)*8)))
+		d.FieldU32("next_header_crc", d.UintValidateBytes(nextHeaderCRC.Sum(nil)), scalar.UintHex)
+	})
+
+	ctx := &decodeContext{}
+
+	d.SeekAbs(int64(signatureHeaderSize+nextHeaderOffset) * 8)
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FramedFn(int64(nextHeaderSize)*8, func(d *decode.D) {
+			decodeHeader(d, ctx)
+		})
+	})
+
+	if ctx.encodedStreams != nil {
+		fieldPackedStreams(d, "packed_headers", "packed_header", ctx.encodedStreams)
+	}
+	if ctx.mainStreams != nil {
+		fieldPackedStreams(d, "packed_streams", "packed_stream", ctx.mainStreams)
+	}
+	if ctx.files != nil {
+		fieldFiles(d, ctx)
+	}
+
+	return nil
+}
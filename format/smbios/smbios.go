@@ -0,0 +1,443 @@
+package smbios
+
+// https://www.dmtf.org/sites/default/files/standards/documents/DSP0134_3.6.0.pdf
+
+import (
+	"bytes"
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed smbios.md
+var smbiosFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.SMBIOS,
+		&decode.Format{
+			Description: "System Management BIOS (SMBIOS/DMI) tables",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeSMBIOS,
+		})
+	interp.RegisterFS(smbiosFS)
+}
+
+const (
+	typeBIOS         = 0
+	typeSystem       = 1
+	typeBaseboard    = 2
+	typeMemoryDevice = 17
+	typeEndOfTable   = 127
+)
+
+var typeNames = scalar.UintMapSymStr{
+	0:   "bios",
+	1:   "system",
+	2:   "baseboard",
+	3:   "chassis",
+	4:   "processor",
+	5:   "memory_controller",
+	6:   "memory_module",
+	7:   "cache",
+	8:   "port_connector",
+	9:   "system_slots",
+	10:  "on_board_devices",
+	11:  "oem_strings",
+	12:  "system_configuration_options",
+	13:  "bios_language",
+	14:  "group_associations",
+	15:  "system_event_log",
+	16:  "physical_memory_array",
+	17:  "memory_device",
+	18:  "memory_error_32bit",
+	19:  "memory_array_mapped_address",
+	20:  "memory_device_mapped_address",
+	21:  "built_in_pointing_device",
+	22:  "portable_battery",
+	23:  "system_reset",
+	24:  "hardware_security",
+	25:  "system_power_controls",
+	26:  "voltage_probe",
+	27:  "cooling_device",
+	28:  "temperature_probe",
+	29:  "electrical_current_probe",
+	30:  "out_of_band_remote_access",
+	31:  "boot_integrity_services",
+	32:  "system_boot",
+	33:  "memory_error_64bit",
+	34:  "management_device",
+	35:  "management_device_component",
+	36:  "management_device_threshold_data",
+	37:  "memory_channel",
+	38:  "ipmi_device",
+	39:  "system_power_supply",
+	40:  "additional_information",
+	41:  "onboard_devices_extended",
+	42:  "management_controller_host_interface",
+	43:  "tpm_device",
+	44:  "processor_additional_information",
+	45:  "firmware_inventory_information",
+	46:  "string_property",
+	126: "inactive",
+	127: "end_of_table",
+}
+
+var wakeUpTypeNames = scalar.UintMapSymStr{
+	0: "reserved",
+	1: "other",
+	2: "unknown",
+	3: "apm_timer",
+	4: "modem_ring",
+	5: "lan_remote",
+	6: "power_switch",
+	7: "pci_pme",
+	8: "ac_power_restored",
+}
+
+var boardTypeNames = scalar.UintMapSymStr{
+	1:  "unknown",
+	2:  "other",
+	3:  "server_blade",
+	4:  "connectivity_switch",
+	5:  "system_management_module",
+	6:  "processor_module",
+	7:  "io_module",
+	8:  "memory_module",
+	9:  "daughter_board",
+	10: "motherboard",
+	11: "processor_memory_module",
+	12: "processor_io_module",
+	13: "interconnect_board",
+}
+
+var memoryFormFactorNames = scalar.UintMapSymStr{
+	1:  "other",
+	2:  "unknown",
+	3:  "simm",
+	4:  "sip",
+	5:  "chip",
+	6:  "dip",
+	7:  "zip",
+	8:  "proprietary_card",
+	9:  "dimm",
+	10: "tsop",
+	11: "row_of_chips",
+	12: "rimm",
+	13: "sodimm",
+	14: "srimm",
+	15: "fb_dimm",
+	16: "die",
+}
+
+var memoryTypeNames = scalar.UintMapSymStr{
+	1:  "other",
+	2:  "unknown",
+	3:  "dram",
+	4:  "edram",
+	5:  "vram",
+	6:  "sram",
+	7:  "ram",
+	8:  "rom",
+	9:  "flash",
+	10: "eeprom",
+	11: "feprom",
+	12: "eprom",
+	13: "cdram",
+	14: "3dram",
+	15: "sdram",
+	16: "sgram",
+	17: "rdram",
+	18: "ddr",
+	19: "ddr2",
+	20: "ddr2_fb_dimm",
+	24: "ddr3",
+	25: "fbd2",
+	26: "ddr4",
+	27: "lpddr",
+	28: "lpddr2",
+	29: "lpddr3",
+	30: "lpddr4",
+	31: "logical_non_volatile_device",
+	32: "hbm",
+	33: "hbm2",
+	34: "ddr5",
+	35: "lpddr5",
+	36: "hbm3",
+}
+
+// string number to string in structure string set, 0 means no string
+type stringSet []string
+
+func (m stringSet) MapUint(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual >= 1 && s.Actual <= uint64(len(m)) {
+		s.Sym = m[s.Actual-1]
+	}
+	return s, nil
+}
+
+// checksum byte that makes all bytes sum to zero
+func checksum(bs []byte, checksumIndex int) uint64 {
+	var sum byte
+	for i, b := range bs {
+		if i != checksumIndex {
+			sum += b
+		}
+	}
+	return uint64(-sum)
+}
+
+// decodes entry point and returns structure table offset and length in bytes
+func decodeEntryPoint32(d *decode.D) (int64, int64) {
+	epBytes := d.PeekBytes(0x1f)
+	d.FieldUTF8("anchor", 4, d.StrAssert("_SM_"))
+	d.FieldU8("checksum", d.UintValidate(checksum(epBytes, 4)), scalar.UintHex)
+	d.FieldU8("length")
+	d.FieldU8("major_version")
+	d.FieldU8("minor_version")
+	d.FieldU16("max_structure_size")
+	d.FieldU8("entry_point_revision")
+	d.FieldRawLen("formatted_area", 5*8)
+	d.FieldUTF8("intermediate_anchor", 5, d.StrAssert("_DMI_"))
+	d.FieldU8("intermediate_checksum", d.UintValidate(checksum(epBytes[0x10:0x1f], 5)), scalar.UintHex)
+	tableLength := d.FieldU16("structure_table_length")
+	tableAddress := d.FieldU32("structure_table_address", scalar.UintHex)
+	d.FieldU16("number_of_structures")
+	d.FieldU8("bcd_revision", scalar.UintHex)
+
+	return int64(tableAddress), int64(tableLength)
+}
+
+func decodeEntryPoint64(d *decode.D) (int64, int64) {
+	epBytes := d.PeekBytes(0x18)
+	d.FieldUTF8("anchor", 5, d.StrAssert("_SM3_"))
+	d.FieldU8("checksum", d.UintValidate(checksum(epBytes, 5)), scalar.UintHex)
+	d.FieldU8("length")
+	d.FieldU8("major_version")
+	d.FieldU8("minor_version")
+	d.FieldU8("docrev")
+	d.FieldU8("entry_point_revision")
+	d.FieldU8("reserved")
+	tableMaxSize := d.FieldU32("structure_table_max_size")
+	tableAddress := d.FieldU64("structure_table_address", scalar.UintHex)
+
+	return int64(tableAddress), int64(tableMaxSize)
+}
+
+// reads string set following the formatted area, ends with double null
+func peekStrings(d *decode.D, pos int64) ([]string, int64) {
+	var ss []string
+	var n int64
+	skip := (pos - d.Pos()) / 8
+	if skip*8 > d.BitsLeft() {
+		d.Fatalf("structure extends past end of table")
+	}
+	bs := d.PeekBytes(int(d.BitsLeft() / 8))[skip:]
+	for {
+		i := bytes.IndexByte(bs[n:], 0)
+		if i == -1 {
+			d.Fatalf("unterminated string set")
+		}
+		if i == 0 {
+			break
+		}
+		ss = append(ss, string(bs[n:n+int64(i)]))
+		n += int64(i) + 1
+	}
+	// at least two nulls even without strings
+	if len(ss) == 0 {
+		n++
+	}
+	return ss, n + 1
+}
+
+func decodeStructure(d *decode.D) uint64 {
+	start := d.Pos()
+	typ := d.FieldU8("type", typeNames)
+	length := int64(d.FieldU8("length"))
+	d.FieldU16("handle", scalar.UintHex)
+	if length < 4 {
+		d.Fatalf("structure length %d is less than header length", length)
+	}
+	ss, ssLen := peekStrings(d, start+length*8)
+	strs := stringSet(ss)
+
+	d.FramedFn((length-4)*8, func(d *decode.D) {
+		// fields are decoded only if present, older versions have shorter structures
+		has := func(offset int64) bool { return offset < length }
+
+		switch typ {
+		case typeBIOS:
+			d.FieldU8("vendor", strs)
+			d.FieldU8("bios_version", strs)
+			d.FieldU16("bios_starting_address_segment", scalar.UintHex)
+			d.FieldU8("bios_release_date", strs)
+			d.FieldU8("bios_rom_size", scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+				if s.Actual == 0xff {
+					s.Description = "See extended_bios_rom_size"
+				} else {
+					s.Sym = (s.Actual + 1) * 64 * 1024
+				}
+				return s, nil
+			}))
+			d.FieldU64("bios_characteristics", scalar.UintHex)
+			if has(0x12) {
+				d.FieldRawLen("bios_characteristics_extension", min(2, length-0x12)*8)
+			}
+			if has(0x14) {
+				d.FieldU8("system_bios_major_release")
+				d.FieldU8("system_bios_minor_release")
+				d.FieldU8("embedded_controller_firmware_major_release")
+				d.FieldU8("embedded_controller_firmware_minor_release")
+			}
+			if has(0x18) {
+				d.FieldU16("extended_bios_rom_size")
+			}
+		case typeSystem:
+			d.FieldU8("manufacturer", strs)
+			d.FieldU8("product_name", strs)
+			d.FieldU8("version", strs)
+			d.FieldU8("serial_number", strs)
+			if has(0x08) {
+				d.FieldRawLen("uuid", 16*8, scalar.RawUUID)
+				d.FieldU8("wake_up_type", wakeUpTypeNames)
+			}
+			if has(0x19) {
+				d.FieldU8("sku_number", strs)
+				d.FieldU8("family", strs)
+			}
+		case typeBaseboard:
+			d.FieldU8("manufacturer", strs)
+			d.FieldU8("product", strs)
+			d.FieldU8("version", strs)
+			d.FieldU8("serial_number", strs)
+			if has(0x08) {
+				d.FieldU8("asset_tag", strs)
+			}
+			if has(0x09) {
+				d.FieldU8("feature_flags", scalar.UintHex)
+			}
+			if has(0x0a) {
+				d.FieldU8("location_in_chassis", strs)
+			}
+			if has(0x0b) {
+				d.FieldU16("chassis_handle", scalar.UintHex)
+			}
+			if has(0x0d) {
+				d.FieldU8("board_type", boardTypeNames)
+			}
+			if has(0x0e) {
+				n := d.FieldU8("number_of_contained_object_handles")
+				d.FieldArray("contained_object_handles", func(d *decode.D) {
+					for i := uint64(0); i < n; i++ {
+						d.FieldU16("handle", scalar.UintHex)
+					}
+				})
+			}
+		case typeMemoryDevice:
+			d.FieldU16("physical_memory_array_handle", scalar.UintHex)
+			d.FieldU16("memory_error_information_handle", scalar.UintHex)
+			d.FieldU16("total_width")
+			d.FieldU16("data_width")
+			d.FieldU16("size", scalar.UintMapDescription{
+				0:      "No device installed",
+				0xffff: "Unknown",
+				0x7fff: "See extended_size",
+			})
+			d.FieldU8("form_factor", memoryFormFactorNames)
+			d.FieldU8("device_set")
+			d.FieldU8("device_locator", strs)
+			d.FieldU8("bank_locator", strs)
+			d.FieldU8("memory_type", memoryTypeNames)
+			d.FieldU16("type_detail", scalar.UintHex)
+			if has(0x15) {
+				d.FieldU16("speed")
+			}
+			if has(0x17) {
+				d.FieldU8("manufacturer", strs)
+				d.FieldU8("serial_number", strs)
+				d.FieldU8("asset_tag", strs)
+				d.FieldU8("part_number", strs)
+			}
+			if has(0x1b) {
+				d.FieldU8("attributes", scalar.UintHex)
+			}
+			if has(0x1c) {
+				d.FieldU32("extended_size")
+				d.FieldU16("configured_memory_speed")
+			}
+			if has(0x22) {
+				d.FieldU16("minimum_voltage")
+				d.FieldU16("maximum_voltage")
+				d.FieldU16("configured_voltage")
+			}
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+
+	d.FramedFn(ssLen*8, func(d *decode.D) {
+		d.FieldArray("strings", func(d *decode.D) {
+			for range ss {
+				d.FieldUTF8Null("string")
+			}
+		})
+		d.FieldRawLen("terminator", d.BitsLeft())
+	})
+
+	return typ
+}
+
+func decodeStructures(d *decode.D) {
+	seenEnd := false
+	d.FieldStructArrayLoop("structures", "structure", func() bool { return !seenEnd && !d.End() }, func(d *decode.D) {
+		seenEnd = decodeStructure(d) == typeEndOfTable
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unused", d.BitsLeft())
+	}
+}
+
+func decodeSMBIOS(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	var tableAddress, tableLength int64
+	hasEntryPoint := true
+	switch {
+	case bytes.HasPrefix(d.PeekBytes(5), []byte("_SM3_")):
+		d.FieldStruct("entry_point", func(d *decode.D) { tableAddress, tableLength = decodeEntryPoint64(d) })
+	case bytes.HasPrefix(d.PeekBytes(4), []byte("_SM_")):
+		d.FieldStruct("entry_point", func(d *decode.D) { tableAddress, tableLength = decodeEntryPoint32(d) })
+	default:
+		var pi format.Probe_In
+		if d.ArgAs(&pi) {
+			d.Fatalf("no _SM_ or _SM3_ entry point anchor found")
+		}
+		hasEntryPoint = false
+	}
+
+	if !hasEntryPoint {
+		// structure table only, ex: /sys/firmware/dmi/tables/DMI
+		decodeStructures(d)
+		return nil
+	}
+
+	// dmidecode --dump-bin files have the table at the address in the entry point
+	// while sysfs smbios_entry_point has only the entry point
+	if tableAddress*8 < d.Len() && tableAddress*8 >= d.Pos() {
+		if tableAddress*8 > d.Pos() {
+			d.FieldRawLen("padding", tableAddress*8-d.Pos())
+		}
+		tableLength = min(tableLength, d.BitsLeft()/8)
+		d.FramedFn(tableLength*8, decodeStructures)
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
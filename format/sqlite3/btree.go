@@ -0,0 +1,448 @@
+package sqlite3
+
+// first pass working on page bytes that walks freelist and b-trees to know the
+// kind of each page and validate cells and records before they are decoded
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf16"
+)
+
+const (
+	kindUnknown = iota
+	kindBTree
+	kindOverflow
+	kindFreelistTrunk
+	kindFreelistLeaf
+	kindPointerMap
+	kindLockByte
+)
+
+const (
+	pageTypeIndexInterior = 0x02
+	pageTypeTableInterior = 0x05
+	pageTypeIndexLeaf     = 0x0a
+	pageTypeTableLeaf     = 0x0d
+)
+
+const (
+	textEncodingUTF8    = 1
+	textEncodingUTF16LE = 2
+	textEncodingUTF16BE = 3
+)
+
+const schemaTreeName = "sqlite_schema"
+
+// byte offset of lock-byte page, only exist in databases larger than 1GB
+const lockByteOffset = 1073741824
+
+type cellInfo struct {
+	offset       int
+	localSize    int
+	overflowPage uint32
+	payload      []byte // whole payload including overflow, nil if not valid
+	values       []any  // record values if payload is a valid record
+	recordOK     bool
+}
+
+type freeblock struct {
+	offset int
+	size   int
+}
+
+type btreePage struct {
+	typ              byte
+	headerOffset     int
+	cellContentStart int
+	cells            []cellInfo
+	freeblocks       []freeblock
+}
+
+func (p *btreePage) isInterior() bool {
+	return p.typ == pageTypeIndexInterior || p.typ == pageTypeTableInterior
+}
+
+type pageInfo struct {
+	kind  int
+	tree  string
+	btree *btreePage
+}
+
+type dbContext struct {
+	pageSize   int
+	usableSize int
+	pageCount  int
+	encoding   uint64
+	readPage   func(n int) []byte
+	pages      []pageInfo // indexed by page number, 0 is unused
+}
+
+// readVarint returns value and length, length is 0 if truncated
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func serialTypeSize(st uint64) (int, error) {
+	switch {
+	case st <= 4:
+		return [...]int{0, 1, 2, 3, 4}[st], nil
+	case st == 5:
+		return 6, nil
+	case st == 6, st == 7:
+		return 8, nil
+	case st == 8, st == 9:
+		return 0, nil
+	case st == 10, st == 11:
+		return 0, fmt.Errorf("reserved serial type %d", st)
+	default:
+		return int(st-12) / 2, nil
+	}
+}
+
+func (c *dbContext) decodeText(b []byte) string {
+	if c.encoding == textEncodingUTF8 {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		if c.encoding == textEncodingUTF16LE {
+			u[i] = binary.LittleEndian.Uint16(b[i*2:])
+		} else {
+			u[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+// parseRecord returns values as nil, int64, float64, string or []byte
+func (c *dbContext) parseRecord(b []byte) ([]any, error) {
+	headerSize, n := readVarint(b)
+	if n == 0 || headerSize < uint64(n) || headerSize > uint64(len(b)) {
+		return nil, errors.New("invalid record header size")
+	}
+	var serialTypes []uint64
+	for p := n; p < int(headerSize); {
+		st, n := readVarint(b[p:headerSize])
+		if n == 0 {
+			return nil, errors.New("truncated serial type")
+		}
+		serialTypes = append(serialTypes, st)
+		p += n
+	}
+
+	var values []any
+	p := int(headerSize)
+	for _, st := range serialTypes {
+		size, err := serialTypeSize(st)
+		if err != nil {
+			return nil, err
+		}
+		if p+size > len(b) {
+			return nil, errors.New("record values larger than payload")
+		}
+		v := b[p : p+size]
+		switch {
+		case st == 0:
+			values = append(values, nil)
+		case st <= 6:
+			// sign extend big endian two's complement
+			i := int64(int8(v[0]))
+			for _, x := range v[1:] {
+				i = i<<8 | int64(x)
+			}
+			values = append(values, i)
+		case st == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case st == 8, st == 9:
+			values = append(values, int64(st-8))
+		case st%2 == 0:
+			values = append(values, v)
+		default:
+			values = append(values, c.decodeText(v))
+		}
+		p += size
+	}
+	if p != len(b) {
+		return nil, fmt.Errorf("record size %d does not match payload size %d", p, len(b))
+	}
+
+	return values, nil
+}
+
+// localPayloadSize returns number of payload bytes stored on the b-tree page
+func (c *dbContext) localPayloadSize(payloadSize uint64, table bool) int {
+	u := uint64(c.usableSize)
+	x := u - 35
+	if !table {
+		x = (u-12)*64/255 - 23
+	}
+	if payloadSize <= x {
+		return int(payloadSize)
+	}
+	m := (u-12)*32/255 - 23
+	k := m + (payloadSize-m)%(u-4)
+	if k <= x {
+		return int(k)
+	}
+	return int(m)
+}
+
+func (c *dbContext) validPage(n int) bool {
+	return n >= 1 && n <= c.pageCount
+}
+
+// mark page if not already known, returns false if already known
+func (c *dbContext) mark(n int, kind int, tree string) bool {
+	if !c.validPage(n) || c.pages[n].kind != kindUnknown {
+		return false
+	}
+	c.pages[n] = pageInfo{kind: kind, tree: tree}
+	return true
+}
+
+// readPayload assembles payload following the overflow page chain
+func (c *dbContext) readPayload(local []byte, payloadSize uint64, overflowPage uint32, tree string) ([]byte, error) {
+	if payloadSize > uint64(c.pageCount)*uint64(c.usableSize) {
+		return nil, errors.New("payload larger than database")
+	}
+	payload := append([]byte{}, local...)
+	for n := int(overflowPage); n != 0 && uint64(len(payload)) < payloadSize; {
+		if !c.mark(n, kindOverflow, tree) {
+			return nil, fmt.Errorf("invalid or already used overflow page %d", n)
+		}
+		b := c.readPage(n)
+		next := int(binary.BigEndian.Uint32(b))
+		size := min(uint64(c.usableSize-4), payloadSize-uint64(len(payload)))
+		payload = append(payload, b[4:4+size]...)
+		n = next
+	}
+	if uint64(len(payload)) != payloadSize {
+		return nil, errors.New("truncated overflow chain")
+	}
+	return payload, nil
+}
+
+func (c *dbContext) parseCell(b []byte, typ byte, offset int, tree string) (cellInfo, error) {
+	ci := cellInfo{offset: offset}
+	if offset >= c.usableSize {
+		return ci, fmt.Errorf("cell offset %d outside page", offset)
+	}
+	p := offset
+	b = b[:c.usableSize]
+	if typ == pageTypeIndexInterior || typ == pageTypeTableInterior {
+		p += 4
+	}
+	if p > len(b) {
+		return ci, errors.New("truncated cell")
+	}
+	if typ == pageTypeTableInterior {
+		if _, n := readVarint(b[p:]); n == 0 {
+			return ci, errors.New("truncated rowid")
+		}
+		return ci, nil
+	}
+	payloadSize, n := readVarint(b[p:])
+	if n == 0 {
+		return ci, errors.New("truncated payload size")
+	}
+	p += n
+	if typ == pageTypeTableLeaf {
+		if _, n = readVarint(b[p:]); n == 0 {
+			return ci, errors.New("truncated rowid")
+		}
+		p += n
+	}
+	ci.localSize = c.localPayloadSize(payloadSize, typ == pageTypeTableLeaf)
+	end := p + ci.localSize
+	if uint64(ci.localSize) < payloadSize {
+		end += 4
+	}
+	if end > len(b) {
+		return ci, errors.New("cell payload outside page")
+	}
+	local := b[p : p+ci.localSize]
+	if uint64(ci.localSize) < payloadSize {
+		ci.overflowPage = binary.BigEndian.Uint32(b[p+ci.localSize:])
+	}
+	payload, err := c.readPayload(local, payloadSize, ci.overflowPage, tree)
+	if err != nil {
+		return ci, nil
+	}
+	ci.payload = payload
+	if values, err := c.parseRecord(payload); err == nil {
+		ci.values = values
+		ci.recordOK = true
+	}
+
+	return ci, nil
+}
+
+func (c *dbContext) parseBTreePage(n int, tree string) (*btreePage, error) {
+	b := c.readPage(n)[:c.usableSize]
+	bp := &btreePage{}
+	if n == 1 {
+		bp.headerOffset = headerSize
+	}
+	h := bp.headerOffset
+	if h+12 > len(b) {
+		return nil, errors.New("page too small")
+	}
+	bp.typ = b[h]
+	switch bp.typ {
+	case pageTypeIndexInterior, pageTypeTableInterior, pageTypeIndexLeaf, pageTypeTableLeaf:
+	default:
+		return nil, fmt.Errorf("invalid page type %d", bp.typ)
+	}
+	firstFreeblock := int(binary.BigEndian.Uint16(b[h+1:]))
+	cellCount := int(binary.BigEndian.Uint16(b[h+3:]))
+	bp.cellContentStart = int(binary.BigEndian.Uint16(b[h+5:]))
+	if bp.cellContentStart == 0 {
+		bp.cellContentStart = 65536
+	}
+	pointersStart := h + 8
+	if bp.isInterior() {
+		pointersStart += 4
+	}
+	pointersEnd := pointersStart + cellCount*2
+	if pointersEnd > len(b) || pointersEnd > bp.cellContentStart {
+		return nil, fmt.Errorf("cell count %d too large for page", cellCount)
+	}
+
+	for o := firstFreeblock; o != 0; {
+		if o < pointersEnd || o+4 > len(b) {
+			return nil, fmt.Errorf("invalid freeblock offset %d", o)
+		}
+		size := int(binary.BigEndian.Uint16(b[o+2:]))
+		if size < 4 || o+size > len(b) {
+			return nil, fmt.Errorf("invalid freeblock size %d", size)
+		}
+		bp.freeblocks = append(bp.freeblocks, freeblock{offset: o, size: size})
+		next := int(binary.BigEndian.Uint16(b[o:]))
+		if next != 0 && next <= o+size {
+			return nil, fmt.Errorf("freeblock offset %d not increasing", next)
+		}
+		o = next
+	}
+
+	for i := 0; i < cellCount; i++ {
+		offset := int(binary.BigEndian.Uint16(b[pointersStart+i*2:]))
+		if offset < pointersEnd {
+			continue
+		}
+		ci, err := c.parseCell(b, bp.typ, offset, tree)
+		if err != nil {
+			continue
+		}
+		bp.cells = append(bp.cells, ci)
+	}
+
+	return bp, nil
+}
+
+type schemaEntry struct {
+	name     string
+	rootPage int
+}
+
+// walkTree marks all pages of a b-tree and returns schema entries if it is the schema tree
+func (c *dbContext) walkTree(root int, tree string) []schemaEntry {
+	var entries []schemaEntry
+	stack := []int{root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !c.mark(n, kindBTree, tree) {
+			continue
+		}
+		bp, err := c.parseBTreePage(n, tree)
+		if err != nil {
+			c.pages[n] = pageInfo{}
+			continue
+		}
+		c.pages[n].btree = bp
+
+		b := c.readPage(n)
+		for _, ci := range bp.cells {
+			if bp.isInterior() {
+				stack = append(stack, int(binary.BigEndian.Uint32(b[ci.offset:])))
+			}
+			// type, name, tbl_name, rootpage, sql
+			if tree == schemaTreeName && bp.typ == pageTypeTableLeaf && ci.recordOK && len(ci.values) >= 4 {
+				name, _ := ci.values[1].(string)
+				rootPage, _ := ci.values[3].(int64)
+				if rootPage > 0 {
+					entries = append(entries, schemaEntry{name: name, rootPage: int(rootPage)})
+				}
+			}
+		}
+		if bp.isInterior() {
+			stack = append(stack, int(binary.BigEndian.Uint32(b[bp.headerOffset+8:])))
+		}
+	}
+	return entries
+}
+
+func (c *dbContext) walkFreelist(firstTrunk int) {
+	for n := firstTrunk; n != 0; {
+		if !c.mark(n, kindFreelistTrunk, "") {
+			return
+		}
+		b := c.readPage(n)
+		next := int(binary.BigEndian.Uint32(b))
+		leafCount := min(int(binary.BigEndian.Uint32(b[4:])), (c.usableSize-8)/4)
+		for i := 0; i < leafCount; i++ {
+			c.mark(int(binary.BigEndian.Uint32(b[8+i*4:])), kindFreelistLeaf, "")
+		}
+		n = next
+	}
+}
+
+// pointerMapPages returns pointer map page numbers, first is page 2 followed by
+// one after each run of pages it has entries for
+func (c *dbContext) pointerMapPages() []int {
+	var pages []int
+	for n := 2; n <= c.pageCount; n += c.usableSize/5 + 1 {
+		pages = append(pages, n)
+	}
+	return pages
+}
+
+func (c *dbContext) walk(firstFreelistTrunk int, autoVacuum bool) {
+	c.mark(lockByteOffset/c.pageSize+1, kindLockByte, "")
+	if autoVacuum {
+		for _, n := range c.pointerMapPages() {
+			c.mark(n, kindPointerMap, "")
+		}
+	}
+
+	for _, e := range c.walkTree(1, schemaTreeName) {
+		c.walkTree(e.rootPage, e.name)
+	}
+	c.walkFreelist(firstFreelistTrunk)
+
+	// not referenced pages, ex: in a damaged database, that still look like b-tree pages
+	for n := 1; n <= c.pageCount; n++ {
+		if c.pages[n].kind != kindUnknown {
+			continue
+		}
+		if bp, err := c.parseBTreePage(n, ""); err == nil {
+			c.pages[n] = pageInfo{kind: kindBTree, btree: bp}
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package sqlite3
+
+// https://www.sqlite.org/fileformat.html
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed sqlite3.md
+var sqlite3FS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.SQLite3,
+		&decode.Format{
+			Description: "SQLite 3 database",
+			Extensions:  []string{"sqlite", "sqlite3", "db"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    sqlite3Decode,
+		})
+	interp.RegisterFS(sqlite3FS)
+}
+
+const (
+	headerSize = 100
+	magic      = "SQLite format 3\x00"
+)
+
+var pageTypeNames = scalar.UintMapSymStr{
+	pageTypeIndexInterior: "index_interior",
+	pageTypeTableInterior: "table_interior",
+	pageTypeIndexLeaf:     "index_leaf",
+	pageTypeTableLeaf:     "table_leaf",
+}
+
+var pageKindNames = map[int]string{
+	kindUnknown:       "unknown",
+	kindOverflow:      "overflow",
+	kindFreelistTrunk: "freelist_trunk",
+	kindFreelistLeaf:  "freelist_leaf",
+	kindPointerMap:    "pointer_map",
+	kindLockByte:      "lock_byte",
+}
+
+var fileFormatVersionNames = scalar.UintMapSymStr{
+	1: "legacy",
+	2: "wal",
+}
+
+var textEncodingNames = scalar.UintMapSymStr{
+	textEncodingUTF8:    "utf8",
+	textEncodingUTF16LE: "utf16le",
+	textEncodingUTF16BE: "utf16be",
+}
+
+var pointerMapTypeNames = scalar.UintMapSymStr{
+	1: "root_page",
+	2: "free_page",
+	3: "overflow1",
+	4: "overflow2",
+	5: "btree",
+}
+
+var serialTypeNames = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	switch {
+	case s.Actual <= 9:
+		s.Sym = [...]string{"null", "int8", "int16", "int24", "int32", "int48", "int64", "float64", "zero", "one"}[s.Actual]
+	case s.Actual <= 11:
+		s.Sym = "reserved"
+	case s.Actual%2 == 0:
+		s.Sym = "blob"
+		s.Description = fmt.Sprintf("%d bytes", (s.Actual-12)/2)
+	default:
+		s.Sym = "text"
+		s.Description = fmt.Sprintf("%d bytes", (s.Actual-13)/2)
+	}
+	return s, nil
+})
+
+var versionNumber = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	s.Description = fmt.Sprintf("%d.%d.%d", s.Actual/1000000, s.Actual/1000%1000, s.Actual%1000)
+	return s, nil
+})
+
+func varintFn(d *decode.D) uint64 {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		b := d.U8()
+		v = v<<7 | b&0x7f
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	return v<<8 | d.U8()
+}
+
+func fieldVarint(d *decode.D, name string, sms ...scalar.UintMapper) uint64 {
+	return d.FieldUintFn(name, varintFn, sms...)
+}
+
+func decodeValue(d *decode.D, serialType uint64, encoding uint64) {
+	switch {
+	case serialType == 0:
+		d.FieldValueAny("value", nil)
+	case serialType == 1:
+		d.FieldS8("value")
+	case serialType == 2:
+		d.FieldS16("value")
+	case serialType == 3:
+		d.FieldS24("value")
+	case serialType == 4:
+		d.FieldS32("value")
+	case serialType == 5:
+		d.FieldS48("value")
+	case serialType == 6:
+		d.FieldS64("value")
+	case serialType == 7:
+		d.FieldF64("value")
+	case serialType == 8, serialType == 9:
+		d.FieldValueSint("value", int64(serialType-8))
+	case serialType%2 == 0:
+		d.FieldRawLen("value", int64(serialType-12)/2*8)
+	default:
+		n := int(serialType-13) / 2
+		switch encoding {
+		case textEncodingUTF16LE:
+			d.FieldUTF16LE("value", n)
+		case textEncodingUTF16BE:
+			d.FieldUTF16BE("value", n)
+		default:
+			d.FieldUTF8("value", n)
+		}
+	}
+}
+
+func decodeRecord(d *decode.D, encoding uint64) {
+	start := d.Pos()
+	headerSize := fieldVarint(d, "header_size")
+	var serialTypes []uint64
+	d.FieldArray("serial_types", func(d *decode.D) {
+		for uint64(d.Pos()-start)/8 < headerSize {
+			serialTypes = append(serialTypes, fieldVarint(d, "serial_type", serialTypeNames))
+		}
+	})
+	d.FieldArray("values", func(d *decode.D) {
+		for _, st := range serialTypes {
+			decodeValue(d, st, encoding)
+		}
+	})
+}
+
+func decodeCell(d *decode.D, c *dbContext, typ byte, ci cellInfo) {
+	if typ == pageTypeIndexInterior || typ == pageTypeTableInterior {
+		d.FieldU32("left_child")
+	}
+	if typ == pageTypeTableInterior {
+		d.FieldSintFn("rowid", func(d *decode.D) int64 { return int64(varintFn(d)) })
+		return
+	}
+	fieldVarint(d, "payload_size")
+	if typ == pageTypeTableLeaf {
+		d.FieldSintFn("rowid", func(d *decode.D) int64 { return int64(varintFn(d)) })
+	}
+
+	if ci.overflowPage == 0 {
+		if ci.recordOK {
+			d.FramedFn(int64(ci.localSize)*8, func(d *decode.D) {
+				d.FieldStruct("payload", func(d *decode.D) { decodeRecord(d, c.encoding) })
+			})
+		} else {
+			d.FieldRawLen("payload", int64(ci.localSize)*8)
+		}
+		return
+	}
+
+	// payload continues on overflow pages, decode record from the assembled payload
+	d.FieldRawLen("local_payload", int64(ci.localSize)*8)
+	d.FieldU32("overflow_page")
+	if ci.recordOK {
+		d.FieldStructRootBitBufFn("payload", bitio.NewBitReader(ci.payload, -1), func(d *decode.D) {
+			decodeRecord(d, c.encoding)
+		})
+	}
+}
+
+func decodeBTreePage(d *decode.D, c *dbContext, pageStart int64, bp *btreePage) {
+	d.SeekAbs(pageStart + int64(bp.headerOffset)*8)
+	d.FieldU8("type", pageTypeNames)
+	d.FieldU16("first_freeblock")
+	cellCount := int(d.FieldU16("cell_count"))
+	d.FieldU16("cell_content_start")
+	d.FieldU8("fragmented_free_bytes")
+	if bp.isInterior() {
+		d.FieldU32("right_pointer")
+	}
+	d.FieldArray("cell_pointers", func(d *decode.D) {
+		for i := 0; i < cellCount; i++ {
+			d.FieldU16("cell_pointer")
+		}
+	})
+	if n := pageStart + int64(bp.cellContentStart)*8 - d.Pos(); n > 0 && bp.cellContentStart <= c.usableSize {
+		d.FieldRawLen("unallocated", n)
+	}
+
+	if len(bp.freeblocks) > 0 {
+		d.FieldArray("freeblocks", func(d *decode.D) {
+			for _, fb := range bp.freeblocks {
+				d.SeekAbs(pageStart + int64(fb.offset)*8)
+				d.FieldStruct("freeblock", func(d *decode.D) {
+					d.FieldU16("next_freeblock")
+					d.FieldU16("size")
+					d.FieldRawLen("data", int64(fb.size-4)*8)
+				})
+			}
+		})
+	}
+
+	d.FieldArray("cells", func(d *decode.D) {
+		for _, ci := range bp.cells {
+			d.SeekAbs(pageStart + int64(ci.offset)*8)
+			d.FieldStruct("cell", func(d *decode.D) { decodeCell(d, c, bp.typ, ci) })
+		}
+	})
+}
+
+func decodePage(d *decode.D, c *dbContext, n int, pageStart int64) {
+	pi := c.pages[n]
+	d.FieldValueUint("number", uint64(n))
+	if pi.kind != kindBTree {
+		d.FieldValueStr("type", pageKindNames[pi.kind])
+	}
+	if pi.tree != "" {
+		d.FieldValueStr("tree", pi.tree)
+	}
+
+	d.FramedFn(int64(c.usableSize)*8-(d.Pos()-pageStart), func(d *decode.D) {
+		switch pi.kind {
+		case kindBTree:
+			decodeBTreePage(d, c, pageStart, pi.btree)
+		case kindOverflow:
+			d.FieldU32("next_page")
+			d.FieldRawLen("data", d.BitsLeft())
+		case kindFreelistTrunk:
+			d.FieldU32("next_trunk_page")
+			leafCount := d.FieldU32("leaf_page_count")
+			d.FieldArray("leaf_pages", func(d *decode.D) {
+				for i := uint64(0); i < leafCount && d.BitsLeft() >= 32; i++ {
+					d.FieldU32("leaf_page")
+				}
+			})
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("unused", d.BitsLeft())
+			}
+		case kindPointerMap:
+			d.FieldArray("entries", func(d *decode.D) {
+				for p := n + 1; p <= c.pageCount && d.BitsLeft() >= 5*8; p++ {
+					d.FieldStruct("entry", func(d *decode.D) {
+						d.FieldValueUint("page", uint64(p))
+						d.FieldU8("type", pointerMapTypeNames)
+						d.FieldU32("parent_page")
+					})
+				}
+			})
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("unused", d.BitsLeft())
+			}
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+
+	if reserved := c.pageSize - c.usableSize; reserved > 0 {
+		d.SeekAbs(pageStart + int64(c.usableSize)*8)
+		d.FieldRawLen("reserved", int64(reserved)*8)
+	}
+}
+
+func sqlite3Decode(d *decode.D) any {
+	var c dbContext
+	var firstFreelistTrunk int
+	var autoVacuum bool
+
+	d.Endian = decode.BigEndian
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("magic", 16, d.StrAssert(magic))
+		c.pageSize = int(d.FieldU16("page_size", scalar.UintMapSymUint{1: 65536}))
+		if c.pageSize == 1 {
+			c.pageSize = 65536
+		}
+		if c.pageSize < 512 || c.pageSize&(c.pageSize-1) != 0 {
+			d.Fatalf("invalid page size %d", c.pageSize)
+		}
+		d.FieldU8("write_version", fileFormatVersionNames)
+		d.FieldU8("read_version", fileFormatVersionNames)
+		reservedSpace := int(d.FieldU8("reserved_space"))
+		c.usableSize = c.pageSize - reservedSpace
+		if c.usableSize < 480 {
+			d.Fatalf("usable size %d too small", c.usableSize)
+		}
+		d.FieldU8("max_payload_fraction", d.UintValidate(64))
+		d.FieldU8("min_payload_fraction", d.UintValidate(32))
+		d.FieldU8("leaf_payload_fraction", d.UintValidate(32))
+		changeCounter := d.FieldU32("file_change_counter")
+		databaseSize := int(d.FieldU32("database_size"))
+		firstFreelistTrunk = int(d.FieldU32("first_freelist_trunk_page"))
+		d.FieldU32("freelist_page_count")
+		d.FieldU32("schema_cookie")
+		d.FieldU32("schema_format")
+		d.FieldU32("default_page_cache_size")
+		autoVacuum = d.FieldU32("largest_root_btree_page") != 0
+		c.encoding = d.FieldU32("text_encoding", textEncodingNames)
+		d.FieldU32("user_version")
+		d.FieldU32("incremental_vacuum")
+		d.FieldU32("application_id", scalar.UintHex)
+		d.FieldRawLen("reserved", 20*8)
+		versionValidFor := d.FieldU32("version_valid_for")
+		d.FieldU32("sqlite_version_number", versionNumber)
+
+		// header database size is only valid if written by a version that knows about it
+		filePages := int(d.Len() / 8 / int64(c.pageSize))
+		c.pageCount = filePages
+		if databaseSize != 0 && versionValidFor == changeCounter {
+			c.pageCount = min(databaseSize, filePages)
+		}
+	})
+
+	c.readPage = func(n int) []byte {
+		return d.BytesRange(int64(n-1)*int64(c.pageSize)*8, c.pageSize)
+	}
+	c.pages = make([]pageInfo, c.pageCount+1)
+	c.walk(firstFreelistTrunk, autoVacuum)
+
+	d.FieldArray("pages", func(d *decode.D) {
+		for n := 1; n <= c.pageCount; n++ {
+			pageStart := int64(n-1) * int64(c.pageSize) * 8
+			if n == 1 {
+				d.SeekAbs(headerSize * 8)
+			} else {
+				d.SeekAbs(pageStart)
+			}
+			d.FieldStruct("page", func(d *decode.D) { decodePage(d, &c, n, pageStart) })
+		}
+	})
+
+	return nil
+}
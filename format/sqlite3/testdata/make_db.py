@@ -0,0 +1,57 @@
+# Make SQLite test databases.
+# Usage: python3 make_db.py
+
+import os
+import sqlite3
+
+
+def connect(path, pragmas):
+    if os.path.exists(path):
+        os.remove(path)
+    db = sqlite3.connect(path)
+    for p in pragmas:
+        db.execute(p)
+    return db
+
+
+def main():
+    # multi level b-trees, index, overflow pages and freelist
+    db = connect("test.db", ["PRAGMA page_size = 1024"])
+    db.execute(
+        "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, score REAL, avatar BLOB, note TEXT)"
+    )
+    db.execute("CREATE INDEX users_name ON users (name)")
+    db.execute("CREATE TABLE log (id INTEGER PRIMARY KEY, message TEXT)")
+    ints = [0, 1, -1, 127, 1000, -100000, 8388608, 2**31, 2**40, -(2**62), None]
+    for i in range(60):
+        db.execute(
+            "INSERT INTO users (name, age, score, avatar, note) VALUES (?, ?, ?, ?, ?)",
+            (
+                "user%02d" % i,
+                ints[i % len(ints)],
+                i * 1.5 if i % 3 else None,
+                bytes(range(i % 8)) if i % 4 else None,
+                "note %d" % i if i % 5 else None,
+            ),
+        )
+    db.execute("UPDATE users SET note = ? WHERE id = 7", ("long note " * 300,))
+    for i in range(200):
+        db.execute("INSERT INTO log (message) VALUES (?)", ("log message %d" % i,))
+    db.commit()
+    db.execute("DELETE FROM log WHERE id > 20")
+    db.commit()
+    db.close()
+
+    # auto vacuum has pointer map pages, text in utf16le
+    db = connect(
+        "autovacuum.db",
+        ["PRAGMA page_size = 512", "PRAGMA auto_vacuum = FULL", "PRAGMA encoding = 'UTF-16le'"],
+    )
+    db.execute("CREATE TABLE t (a TEXT, b INTEGER)")
+    db.execute("INSERT INTO t VALUES ('hello', 1), ('world', 2), (?, 3)", ("x" * 600,))
+    db.commit()
+    db.close()
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,467 @@
+package squashfs
+
+// https://dr-emann.github.io/squashfs/squashfs.html
+// https://github.com/plougher/squashfs-tools/blob/master/squashfs-tools/squashfs_fs.h
+
+import (
+	"bytes"
+	"compress/zlib"
+	"embed"
+	"io"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed squashfs.md
+var squashfsFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.SquashFS,
+		&decode.Format{
+			Description: "SquashFS filesystem",
+			Groups:      []*decode.Group{format.Probe, format.Filesystem},
+			DecodeFn:    decodeSquashFS,
+		})
+	interp.RegisterFS(squashfsFS)
+}
+
+const (
+	magic             = 0x73717368 // "hsqs" little endian
+	superblockSize    = 96
+	metadataBlockSize = 8192
+	noTable           = 0xffff_ffff_ffff_ffff
+	noFragment        = 0xffff_ffff
+)
+
+const (
+	flagCompressorOptions = 0x400
+)
+
+const (
+	compressionGzip = 1
+	compressionLZMA = 2
+	compressionLZO  = 3
+	compressionXZ   = 4
+	compressionLZ4  = 5
+	compressionZstd = 6
+)
+
+var compressionNames = scalar.UintMapSymStr{
+	compressionGzip: "gzip",
+	compressionLZMA: "lzma",
+	compressionLZO:  "lzo",
+	compressionXZ:   "xz",
+	compressionLZ4:  "lz4",
+	compressionZstd: "zstd",
+}
+
+const (
+	inodeBasicDirectory    = 1
+	inodeBasicFile         = 2
+	inodeBasicSymlink      = 3
+	inodeBasicBlockDevice  = 4
+	inodeBasicCharDevice   = 5
+	inodeBasicFIFO         = 6
+	inodeBasicSocket       = 7
+	inodeExtendedDirectory = 8
+	inodeExtendedFile      = 9
+	inodeExtendedSymlink   = 10
+	inodeExtendedBlockDev  = 11
+	inodeExtendedCharDev   = 12
+	inodeExtendedFIFO      = 13
+	inodeExtendedSocket    = 14
+)
+
+var inodeTypeNames = scalar.UintMapSymStr{
+	inodeBasicDirectory:    "basic_directory",
+	inodeBasicFile:         "basic_file",
+	inodeBasicSymlink:      "basic_symlink",
+	inodeBasicBlockDevice:  "basic_block_device",
+	inodeBasicCharDevice:   "basic_char_device",
+	inodeBasicFIFO:         "basic_fifo",
+	inodeBasicSocket:       "basic_socket",
+	inodeExtendedDirectory: "extended_directory",
+	inodeExtendedFile:      "extended_file",
+	inodeExtendedSymlink:   "extended_symlink",
+	inodeExtendedBlockDev:  "extended_block_device",
+	inodeExtendedCharDev:   "extended_char_device",
+	inodeExtendedFIFO:      "extended_fifo",
+	inodeExtendedSocket:    "extended_socket",
+}
+
+// data and fragment block sizes has bit 24 set if stored uncompressed
+var blockSizeDescription = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual&(1<<24) != 0 {
+		s.Description = "uncompressed"
+	}
+	return s, nil
+})
+
+type superblock struct {
+	inodeCount          uint64
+	blockSize           uint64
+	fragmentCount       uint64
+	compression         uint64
+	flags               uint64
+	idCount             uint64
+	bytesUsed           uint64
+	idTableStart        uint64
+	xattrIDTableStart   uint64
+	inodeTableStart     uint64
+	directoryTableStart uint64
+	fragmentTableStart  uint64
+	exportTableStart    uint64
+}
+
+func decodeFlags(d *decode.D) {
+	// little endian so first byte has the low bits
+	d.FieldBool("exportable")
+	d.FieldBool("duplicates")
+	d.FieldBool("always_fragments")
+	d.FieldBool("no_fragments")
+	d.FieldBool("uncompressed_fragments")
+	d.FieldBool("check")
+	d.FieldBool("uncompressed_data")
+	d.FieldBool("uncompressed_inodes")
+	d.FieldU4("unused")
+	d.FieldBool("uncompressed_ids")
+	d.FieldBool("compressor_options")
+	d.FieldBool("no_xattrs")
+	d.FieldBool("uncompressed_xattrs")
+}
+
+func decodeSuperblock(d *decode.D) superblock {
+	var sb superblock
+	d.FieldU32("magic", d.UintAssert(magic), scalar.UintHex)
+	sb.inodeCount = d.FieldU32("inode_count")
+	d.FieldU32("modification_time", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+	sb.blockSize = d.FieldU32("block_size")
+	sb.fragmentCount = d.FieldU32("fragment_entry_count")
+	sb.compression = d.FieldU16("compression_id", compressionNames)
+	blockLog := d.FieldU16("block_log")
+	if blockLog >= 32 || sb.blockSize != 1<<blockLog {
+		d.Fatalf("block size %d does not match block log %d", sb.blockSize, blockLog)
+	}
+	d.SeekRel(0, func(d *decode.D) { sb.flags = d.U16() })
+	d.FieldStruct("flags", decodeFlags)
+	sb.idCount = d.FieldU16("id_count")
+	d.FieldU16("version_major", d.UintAssert(4))
+	d.FieldU16("version_minor")
+	d.FieldStruct("root_inode_ref", decodeInodeRef)
+	sb.bytesUsed = d.FieldU64("bytes_used")
+	sb.idTableStart = d.FieldU64("id_table_start", scalar.UintHex)
+	sb.xattrIDTableStart = d.FieldU64("xattr_id_table_start", scalar.UintHex)
+	sb.inodeTableStart = d.FieldU64("inode_table_start", scalar.UintHex)
+	sb.directoryTableStart = d.FieldU64("directory_table_start", scalar.UintHex)
+	sb.fragmentTableStart = d.FieldU64("fragment_table_start", scalar.UintHex)
+	sb.exportTableStart = d.FieldU64("export_table_start", scalar.UintHex)
+
+	return sb
+}
+
+// inode reference is offset to metadata block in inode table and offset into the uncompressed block
+func decodeInodeRef(d *decode.D) {
+	d.FieldU16("offset")
+	d.FieldU32("block_start", scalar.UintHex)
+	d.FieldU16("unused")
+}
+
+func u64At(d *decode.D, pos uint64) uint64 {
+	var v uint64
+	d.SeekAbs(int64(pos)*8, func(d *decode.D) { v = d.U64() })
+	return v
+}
+
+// decodeMetadataBlock decodes a metadata block and appends the uncompressed content to buf,
+// returns false if compression is not supported
+func decodeMetadataBlock(d *decode.D, compression uint64, buf *bytes.Buffer) bool {
+	supported := true
+	d.FieldStruct("block", func(d *decode.D) {
+		// high bit set means uncompressed
+		header := d.FieldU16("header", scalar.UintHex)
+		uncompressed := header&0x8000 != 0
+		size := int64(header & 0x7fff)
+		d.FieldValueBool("uncompressed", uncompressed)
+		d.FieldValueUint("size", uint64(size))
+		if size == 0 || size > metadataBlockSize {
+			d.Fatalf("invalid metadata block size %d", size)
+		}
+		data := d.BytesRange(d.Pos(), int(size))
+		d.FieldRawLen("data", size*8)
+
+		switch {
+		case uncompressed:
+			buf.Write(data)
+		case compression == compressionGzip:
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				d.Fatalf("metadata block: %s", err)
+			}
+			if _, err := io.Copy(buf, zr); err != nil {
+				d.Fatalf("metadata block: %s", err)
+			}
+		default:
+			supported = false
+		}
+	})
+	return supported
+}
+
+// decodeMetadataBlocks decodes metadata blocks between start and end and returns the
+// uncompressed content, returns nil if compression is not supported
+func decodeMetadataBlocks(d *decode.D, start int64, end int64, compression uint64) []byte {
+	buf := &bytes.Buffer{}
+	supported := true
+
+	d.SeekAbs(start * 8)
+	d.FieldArray("blocks", func(d *decode.D) {
+		for d.Pos() < end*8 {
+			if !decodeMetadataBlock(d, compression, buf) {
+				supported = false
+			}
+		}
+	})
+
+	if !supported {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func decodeInode(d *decode.D, blockSize uint64) {
+	typ := d.FieldU16("type", inodeTypeNames)
+	d.FieldU16("permissions", scalar.UintOct)
+	d.FieldU16("uid_index")
+	d.FieldU16("gid_index")
+	d.FieldU32("modification_time", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+	d.FieldU32("inode_number")
+
+	blockSizes := func(fileSize uint64, fragment uint64) {
+		// tail end is in a fragment if there is one
+		n := fileSize / blockSize
+		if fragment == noFragment && fileSize%blockSize != 0 {
+			n++
+		}
+		d.FieldArray("block_sizes", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldU32("size", blockSizeDescription)
+			}
+		})
+	}
+
+	switch typ {
+	case inodeBasicDirectory:
+		d.FieldU32("block_start", scalar.UintHex)
+		d.FieldU32("link_count")
+		d.FieldU16("file_size")
+		d.FieldU16("block_offset")
+		d.FieldU32("parent_inode_number")
+	case inodeExtendedDirectory:
+		d.FieldU32("link_count")
+		d.FieldU32("file_size")
+		d.FieldU32("block_start", scalar.UintHex)
+		d.FieldU32("parent_inode_number")
+		indexCount := d.FieldU16("index_count")
+		d.FieldU16("block_offset")
+		d.FieldU32("xattr_index", scalar.UintHex)
+		d.FieldArray("index", func(d *decode.D) {
+			for i := uint64(0); i < indexCount; i++ {
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldU32("index")
+					d.FieldU32("start", scalar.UintHex)
+					nameSize := d.FieldU32("name_size")
+					d.FieldUTF8("name", int(nameSize)+1)
+				})
+			}
+		})
+	case inodeBasicFile:
+		d.FieldU32("blocks_start", scalar.UintHex)
+		fragment := d.FieldU32("fragment_index", scalar.UintMapSymStr{noFragment: "none"})
+		d.FieldU32("block_offset")
+		fileSize := d.FieldU32("file_size")
+		blockSizes(fileSize, fragment)
+	case inodeExtendedFile:
+		d.FieldU64("blocks_start", scalar.UintHex)
+		fileSize := d.FieldU64("file_size")
+		d.FieldU64("sparse")
+		d.FieldU32("link_count")
+		fragment := d.FieldU32("fragment_index", scalar.UintMapSymStr{noFragment: "none"})
+		d.FieldU32("block_offset")
+		d.FieldU32("xattr_index", scalar.UintHex)
+		blockSizes(fileSize, fragment)
+	case inodeBasicSymlink, inodeExtendedSymlink:
+		d.FieldU32("link_count")
+		targetSize := d.FieldU32("target_size")
+		d.FieldUTF8("target", int(targetSize))
+		if typ == inodeExtendedSymlink {
+			d.FieldU32("xattr_index", scalar.UintHex)
+		}
+	case inodeBasicBlockDevice, inodeBasicCharDevice, inodeExtendedBlockDev, inodeExtendedCharDev:
+		d.FieldU32("link_count")
+		d.FieldU32("device", scalar.UintHex)
+		if typ == inodeExtendedBlockDev || typ == inodeExtendedCharDev {
+			d.FieldU32("xattr_index", scalar.UintHex)
+		}
+	case inodeBasicFIFO, inodeBasicSocket, inodeExtendedFIFO, inodeExtendedSocket:
+		d.FieldU32("link_count")
+		if typ == inodeExtendedFIFO || typ == inodeExtendedSocket {
+			d.FieldU32("xattr_index", scalar.UintHex)
+		}
+	default:
+		d.Fatalf("unknown inode type %d", typ)
+	}
+}
+
+// directory listings are a header followed by up to 256 entries, a directory can have more than one header
+func decodeDirectory(d *decode.D) {
+	var count uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		// number of entries minus one
+		count = d.FieldU32("count")
+		d.FieldU32("start", scalar.UintHex)
+		d.FieldU32("inode_number")
+	})
+	d.FieldArray("entries", func(d *decode.D) {
+		for i := uint64(0); i <= count; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldU16("offset")
+				d.FieldS16("inode_offset")
+				d.FieldU16("type", inodeTypeNames)
+				// name length minus one
+				nameSize := d.FieldU16("name_size")
+				d.FieldUTF8("name", int(nameSize)+1)
+			})
+		}
+	})
+}
+
+// lookup tables are an array of metadata block positions, the blocks are stored before the array
+func decodeLookupTable(d *decode.D, start uint64, count uint64, entrySize uint64, compression uint64, fn func(d *decode.D)) {
+	blockCount := (count*entrySize + metadataBlockSize - 1) / metadataBlockSize
+	if blockCount == 0 {
+		return
+	}
+	firstBlock := u64At(d, start)
+	if firstBlock >= start {
+		d.Fatalf("lookup table first block after table start")
+	}
+
+	buf := decodeMetadataBlocks(d, int64(firstBlock), int64(start), compression)
+	d.FieldArray("lookup", func(d *decode.D) {
+		for i := uint64(0); i < blockCount; i++ {
+			d.FieldU64("position", scalar.UintHex)
+		}
+	})
+	if buf != nil {
+		d.FieldArrayRootBitBufFn("entries", bitio.NewBitReader(buf, -1), func(d *decode.D) {
+			d.Endian = decode.LittleEndian
+			for i := uint64(0); i < count; i++ {
+				fn(d)
+			}
+		})
+	}
+}
+
+func decodeSquashFS(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	var sb superblock
+	d.FieldStruct("superblock", func(d *decode.D) { sb = decodeSuperblock(d) })
+	if sb.bytesUsed > uint64(d.Len()/8) {
+		d.Fatalf("bytes used %d larger than file", sb.bytesUsed)
+	}
+
+	if sb.flags&flagCompressorOptions != 0 {
+		d.FieldStruct("compressor_options", func(d *decode.D) {
+			// always stored uncompressed, only gzip options are decoded
+			buf := &bytes.Buffer{}
+			decodeMetadataBlock(d, sb.compression, buf)
+			if sb.compression == compressionGzip && buf.Len() == 8 {
+				d.FieldStructRootBitBufFn("options", bitio.NewBitReader(buf.Bytes(), -1), func(d *decode.D) {
+					d.Endian = decode.LittleEndian
+					d.FieldU32("compression_level")
+					d.FieldU16("window_size")
+					d.FieldU16("strategies", scalar.UintHex)
+				})
+			}
+		})
+	}
+
+	// file data blocks and fragments
+	if dataLen := int64(sb.inodeTableStart)*8 - d.Pos(); dataLen > 0 {
+		d.FieldRawLen("data", dataLen)
+	}
+
+	// directory table ends where the next table starts, lookup tables has their blocks before the lookup array
+	tableEnd := sb.bytesUsed
+	lookupTables := []uint64{sb.fragmentTableStart, sb.exportTableStart, sb.idTableStart, sb.xattrIDTableStart}
+	for _, start := range lookupTables {
+		if start == noTable {
+			continue
+		}
+		tableEnd = min(tableEnd, start)
+		if start+8 <= sb.bytesUsed {
+			if p := u64At(d, start); p > sb.directoryTableStart {
+				tableEnd = min(tableEnd, p)
+			}
+		}
+	}
+
+	d.FieldStruct("inode_table", func(d *decode.D) {
+		buf := decodeMetadataBlocks(d, int64(sb.inodeTableStart), int64(sb.directoryTableStart), sb.compression)
+		if buf == nil {
+			return
+		}
+		d.FieldArrayRootBitBufFn("inodes", bitio.NewBitReader(buf, -1), func(d *decode.D) {
+			d.Endian = decode.LittleEndian
+			for i := uint64(0); i < sb.inodeCount && !d.End(); i++ {
+				d.FieldStruct("inode", func(d *decode.D) { decodeInode(d, sb.blockSize) })
+			}
+		})
+	})
+
+	d.FieldStruct("directory_table", func(d *decode.D) {
+		buf := decodeMetadataBlocks(d, int64(sb.directoryTableStart), int64(tableEnd), sb.compression)
+		if buf == nil {
+			return
+		}
+		d.FieldArrayRootBitBufFn("directories", bitio.NewBitReader(buf, -1), func(d *decode.D) {
+			d.Endian = decode.LittleEndian
+			for !d.End() {
+				d.FieldStruct("directory", decodeDirectory)
+			}
+		})
+	})
+
+	if sb.fragmentTableStart != noTable && sb.fragmentCount > 0 {
+		d.FieldStruct("fragment_table", func(d *decode.D) {
+			decodeLookupTable(d, sb.fragmentTableStart, sb.fragmentCount, 16, sb.compression, func(d *decode.D) {
+				d.FieldStruct("fragment", func(d *decode.D) {
+					d.FieldU64("start", scalar.UintHex)
+					d.FieldU32("size", blockSizeDescription)
+					d.FieldU32("unused")
+				})
+			})
+		})
+	}
+	if sb.exportTableStart != noTable {
+		d.FieldStruct("export_table", func(d *decode.D) {
+			decodeLookupTable(d, sb.exportTableStart, sb.inodeCount, 8, sb.compression, func(d *decode.D) {
+				d.FieldStruct("inode_ref", decodeInodeRef)
+			})
+		})
+	}
+	d.FieldStruct("id_table", func(d *decode.D) {
+		decodeLookupTable(d, sb.idTableStart, sb.idCount, 4, sb.compression, func(d *decode.D) {
+			d.FieldU32("id")
+		})
+	})
+
+	return nil
+}
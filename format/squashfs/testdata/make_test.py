@@ -0,0 +1,132 @@
+#!/usr/bin/env python3
+# generates a small gzip compressed squashfs 4.0 image
+import pathlib
+import struct
+import zlib
+
+here = pathlib.Path(__file__).parent
+
+BLOCK_SIZE = 4096
+MTIME = 1700000000
+NO_TABLE = 0xFFFFFFFFFFFFFFFF
+
+
+def metadata_block(b):
+    c = zlib.compress(b, 9)
+    if len(c) < len(b):
+        return struct.pack("<H", len(c)) + c
+    return struct.pack("<H", 0x8000 | len(b)) + b
+
+
+hello = b"hello squashfs\n"
+nested = b"nested file\n"
+big = bytes(i * 7 % 251 for i in range(5000))
+
+# data block for first block of big.bin, tails are stored in a fragment
+out = bytearray(96)
+big_block = zlib.compress(big[:BLOCK_SIZE], 9)
+big_start = len(out)
+out += big_block
+fragment = hello + nested + big[BLOCK_SIZE:]
+fragment_c = zlib.compress(fragment, 9)
+fragment_start = len(out)
+out += fragment_c
+
+
+def inode_header(typ, perm, number):
+    return struct.pack("<HHHHII", typ, perm, 0, 0, MTIME, number)
+
+
+def basic_file(number, blocks_start, frag_offset, size, block_sizes):
+    return (
+        inode_header(2, 0o644, number)
+        + struct.pack("<IIII", blocks_start, 0, frag_offset, size)
+        + b"".join(struct.pack("<I", s) for s in block_sizes)
+    )
+
+
+def basic_symlink(number, target):
+    return inode_header(3, 0o777, number) + struct.pack("<II", 1, len(target)) + target
+
+
+def basic_dir(number, link_count, file_size, block_offset, parent):
+    return inode_header(1, 0o755, number) + struct.pack(
+        "<IIHHI", 0, link_count, file_size, block_offset, parent
+    )
+
+
+# inode numbers, children are written before their parent directory
+inodes = [
+    (1, "hello.txt", 2, lambda: basic_file(1, 0, 0, len(hello), [])),
+    (2, "big.bin", 2, lambda: basic_file(2, big_start, len(hello) + len(nested), len(big), [len(big_block)])),
+    (3, "link", 3, lambda: basic_symlink(3, b"hello.txt")),
+    (4, "nested.txt", 2, lambda: basic_file(4, 0, len(hello), len(nested), [])),
+]
+sizes = {n: len(f()) for n, _, _, f in inodes}
+sizes[5] = 32
+sizes[6] = 32
+offsets = {}
+pos = 0
+for n in [1, 2, 3, 4, 5, 6]:
+    offsets[n] = pos
+    pos += sizes[n]
+
+
+def listing(entries):
+    # entries is list of (inode number, type, name) sorted by name
+    base = entries[0][0]
+    b = struct.pack("<III", len(entries) - 1, 0, base)
+    for n, typ, name in entries:
+        b += struct.pack("<HhHH", offsets[n], n - base, typ, len(name) - 1) + name
+    return b
+
+
+dir_listing = listing([(4, 2, b"nested.txt")])
+root_listing = listing([(2, 2, b"big.bin"), (5, 1, b"dir"), (1, 2, b"hello.txt"), (3, 3, b"link")])
+directory_table = dir_listing + root_listing
+
+inode_table = b"".join(f() for _, _, _, f in inodes)
+inode_table += basic_dir(5, 2, len(dir_listing) + 3, 0, 6)
+inode_table += basic_dir(6, 3, len(root_listing) + 3, len(dir_listing), 7)
+
+inode_table_start = len(out)
+out += metadata_block(inode_table)
+directory_table_start = len(out)
+out += metadata_block(directory_table)
+
+fragment_block_pos = len(out)
+out += metadata_block(struct.pack("<QII", fragment_start, len(fragment_c), 0))
+fragment_table_start = len(out)
+out += struct.pack("<Q", fragment_block_pos)
+
+id_block_pos = len(out)
+out += metadata_block(struct.pack("<I", 0))
+id_table_start = len(out)
+out += struct.pack("<Q", id_block_pos)
+
+bytes_used = len(out)
+flags = 0x200 | 0x40  # no xattrs, duplicates
+out[0:96] = struct.pack(
+    "<IIIIIHHHHHHQQQQQQQQ",
+    0x73717368,
+    6,
+    MTIME,
+    BLOCK_SIZE,
+    1,
+    1,
+    12,
+    flags,
+    1,
+    4,
+    0,
+    offsets[6],
+    bytes_used,
+    id_table_start,
+    NO_TABLE,
+    inode_table_start,
+    directory_table_start,
+    fragment_table_start,
+    NO_TABLE,
+)
+out += bytes(-len(out) % 4096)
+(here / "test.squashfs").write_bytes(out)
@@ -20,6 +20,8 @@ func init() {
 		format.TAR,
 		&decode.Format{
 			Description: "Tar archive",
+			Extensions:  []string{"tar"},
+			MIMETypes:   []string{"application/x-tar"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    tarDecode,
 			Dependencies: []decode.Dependency{
@@ -9,6 +9,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/wader/fq/internal/bitiox"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/interp"
 	"golang.org/x/text/encoding"
@@ -43,6 +44,35 @@ func init() {
 		return buf.String()
 	})
 
+	interp.RegisterFunc0("from_bitstring", func(_ *interp.Interp, c string) any {
+		// allow grouping, ex: "0101 1100" or "0101_1100"
+		s := strings.NewReplacer(" ", "", "_", "", "\n", "", "\t", "").Replace(c)
+		if i := strings.IndexFunc(s, func(r rune) bool { return r != '0' && r != '1' }); i != -1 {
+			return fmt.Errorf("invalid bit string character %q", s[i])
+		}
+		b, nBits := bitio.BytesFromBitString(s)
+		bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(b, nBits), 1, 0)
+		if err != nil {
+			return err
+		}
+		return bb
+	})
+	interp.RegisterFunc0("to_bitstring", func(_ *interp.Interp, c any) any {
+		br, err := interp.ToBitReader(c)
+		if err != nil {
+			return err
+		}
+		nBits, err := bitiox.Len(br)
+		if err != nil {
+			return err
+		}
+		b := make([]byte, bitio.BitsByteCount(nBits))
+		if _, err := bitio.ReadAtFull(br, b, nBits, 0); err != nil {
+			return err
+		}
+		return bitio.BitStringFromBytes(b, nBits)
+	})
+
 	// TODO: other encodings and share?
 	base64Encoding := func(enc string) *base64.Encoding {
 		switch enc {
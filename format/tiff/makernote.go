@@ -0,0 +1,356 @@
+package tiff
+
+// https://exiftool.org/TagNames/Canon.html
+// https://exiftool.org/TagNames/Nikon.html
+// https://exiftool.org/TagNames/Sony.html
+// https://exiftool.org/makernote_types.html
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var canonTagNames = scalar.UintMapSymStr{
+	0x0001: "CanonCameraSettings",
+	0x0002: "CanonFocalLength",
+	0x0003: "CanonFlashInfo",
+	0x0004: "CanonShotInfo",
+	0x0005: "CanonPanorama",
+	0x0006: "CanonImageType",
+	0x0007: "CanonFirmwareVersion",
+	0x0008: "FileNumber",
+	0x0009: "OwnerName",
+	0x000c: "SerialNumber",
+	0x000d: "CanonCameraInfo",
+	0x000e: "CanonFileLength",
+	0x000f: "CustomFunctions",
+	0x0010: "CanonModelID",
+	0x0011: "MovieInfo",
+	0x0012: "CanonAFInfo",
+	0x0013: "ThumbnailImageValidArea",
+	0x0015: "SerialNumberFormat",
+	0x001a: "SuperMacro",
+	0x001c: "DateStampMode",
+	0x001d: "MyColors",
+	0x001e: "FirmwareRevision",
+	0x0023: "Categories",
+	0x0024: "FaceDetect1",
+	0x0025: "FaceDetect2",
+	0x0026: "CanonAFInfo2",
+	0x0027: "ContrastInfo",
+	0x0028: "ImageUniqueID",
+	0x0029: "WBInfo",
+	0x002f: "FaceDetect3",
+	0x0035: "TimeInfo",
+	0x0038: "BatteryType",
+	0x003c: "AFInfo3",
+	0x0081: "RawDataOffset",
+	0x0083: "OriginalDecisionDataOffset",
+	0x0090: "CustomFunctions1D",
+	0x0091: "PersonalFunctions",
+	0x0092: "PersonalFunctionValues",
+	0x0093: "CanonFileInfo",
+	0x0094: "AFPointsInFocus1D",
+	0x0095: "LensModel",
+	0x0096: "InternalSerialNumber",
+	0x0097: "DustRemovalData",
+	0x0098: "CropInfo",
+	0x0099: "CustomFunctions2",
+	0x009a: "AspectInfo",
+	0x00a0: "ProcessingInfo",
+	0x00a1: "ToneCurveTable",
+	0x00a2: "SharpnessTable",
+	0x00a3: "SharpnessFreqTable",
+	0x00a4: "WhiteBalanceTable",
+	0x00a9: "ColorBalance",
+	0x00aa: "MeasuredColor",
+	0x00ae: "ColorTemperature",
+	0x00b0: "CanonFlags",
+	0x00b1: "ModifiedInfo",
+	0x00b2: "ToneCurveMatching",
+	0x00b3: "WhiteBalanceMatching",
+	0x00b4: "ColorSpace",
+	0x00b6: "PreviewImageInfo",
+	0x00d0: "VRDOffset",
+	0x00e0: "SensorInfo",
+	0x4001: "ColorData",
+	0x4002: "CRWParam",
+	0x4003: "ColorInfo",
+	0x4005: "Flavor",
+	0x4008: "PictureStyleUserDef",
+	0x4009: "PictureStylePC",
+	0x4010: "CustomPictureStyleFileName",
+	0x4013: "AFMicroAdj",
+	0x4015: "VignettingCorr",
+	0x4016: "VignettingCorr2",
+	0x4018: "LightingOpt",
+	0x4019: "LensInfo",
+	0x4020: "AmbienceInfo",
+	0x4021: "MultiExp",
+	0x4024: "FilterInfo",
+	0x4025: "HDRInfo",
+	0x4028: "AFConfig",
+}
+
+var nikonTagNames = scalar.UintMapSymStr{
+	0x0001: "MakerNoteVersion",
+	0x0002: "ISO",
+	0x0003: "ColorMode",
+	0x0004: "Quality",
+	0x0005: "WhiteBalance",
+	0x0006: "Sharpness",
+	0x0007: "FocusMode",
+	0x0008: "FlashSetting",
+	0x0009: "FlashType",
+	0x000b: "WhiteBalanceFineTune",
+	0x000c: "WB_RBLevels",
+	0x000d: "ProgramShift",
+	0x000e: "ExposureDifference",
+	0x000f: "ISOSelection",
+	0x0010: "DataDump",
+	0x0011: "PreviewIFD",
+	0x0012: "FlashExposureComp",
+	0x0013: "ISOSetting",
+	0x0014: "ColorBalanceA",
+	0x0016: "ImageBoundary",
+	0x0017: "ExternalFlashExposureComp",
+	0x0018: "FlashExposureBracketValue",
+	0x0019: "ExposureBracketValue",
+	0x001a: "ImageProcessing",
+	0x001b: "CropHiSpeed",
+	0x001c: "ExposureTuning",
+	0x001d: "SerialNumber",
+	0x001e: "ColorSpace",
+	0x001f: "VRInfo",
+	0x0020: "ImageAuthentication",
+	0x0021: "FaceDetect",
+	0x0022: "ActiveD-Lighting",
+	0x0023: "PictureControlData",
+	0x0024: "WorldTime",
+	0x0025: "ISOInfo",
+	0x002a: "VignetteControl",
+	0x002b: "DistortInfo",
+	0x002c: "UnknownInfo",
+	0x0032: "UnknownInfo2",
+	0x0035: "HDRInfo",
+	0x0037: "MechanicalShutterCount",
+	0x0039: "LocationInfo",
+	0x003d: "BlackLevel",
+	0x003e: "ImageSizeRAW",
+	0x0045: "CropArea",
+	0x004e: "NikonSettings",
+	0x004f: "ColorTemperatureAuto",
+	0x0080: "ImageAdjustment",
+	0x0081: "ToneComp",
+	0x0082: "AuxiliaryLens",
+	0x0083: "LensType",
+	0x0084: "Lens",
+	0x0085: "ManualFocusDistance",
+	0x0086: "DigitalZoom",
+	0x0087: "FlashMode",
+	0x0088: "AFInfo",
+	0x0089: "ShootingMode",
+	0x008b: "LensFStops",
+	0x008c: "ContrastCurve",
+	0x008d: "ColorHue",
+	0x008f: "SceneMode",
+	0x0090: "LightSource",
+	0x0091: "ShotInfo",
+	0x0092: "HueAdjustment",
+	0x0093: "NEFCompression",
+	0x0094: "SaturationAdj",
+	0x0095: "NoiseReduction",
+	0x0096: "NEFLinearizationTable",
+	0x0097: "ColorBalance",
+	0x0098: "LensData",
+	0x0099: "RawImageCenter",
+	0x009a: "SensorPixelSize",
+	0x009c: "SceneAssist",
+	0x009d: "DateStampMode",
+	0x009e: "RetouchHistory",
+	0x00a0: "SerialNumber",
+	0x00a2: "ImageDataSize",
+	0x00a5: "ImageCount",
+	0x00a6: "DeletedImageCount",
+	0x00a7: "ShutterCount",
+	0x00a8: "FlashInfo",
+	0x00a9: "ImageOptimization",
+	0x00aa: "Saturation",
+	0x00ab: "VariProgram",
+	0x00ac: "ImageStabilization",
+	0x00ad: "AFResponse",
+	0x00b0: "MultiExposure",
+	0x00b1: "HighISONoiseReduction",
+	0x00b3: "ToningEffect",
+	0x00b6: "PowerUpTime",
+	0x00b7: "AFInfo2",
+	0x00b8: "FileInfo",
+	0x00b9: "AFTune",
+	0x00bb: "RetouchInfo",
+	0x00bd: "PictureControlData",
+	0x00c3: "BarometerInfo",
+	0x0e00: "PrintIM",
+	0x0e01: "NikonCaptureData",
+	0x0e09: "NikonCaptureVersion",
+	0x0e0e: "NikonCaptureOffsets",
+	0x0e10: "NikonScanIFD",
+	0x0e13: "NikonCaptureEditVersions",
+	0x0e1d: "NikonICCProfile",
+	0x0e1e: "NikonCaptureOutput",
+	0x0e22: "NEFBitDepth",
+}
+
+var sonyTagNames = scalar.UintMapSymStr{
+	0x0010: "CameraInfo",
+	0x0020: "FocusInfo",
+	0x0102: "Quality",
+	0x0104: "FlashExposureComp",
+	0x0105: "Teleconverter",
+	0x0112: "WhiteBalanceFineTune",
+	0x0114: "CameraSettings",
+	0x0115: "WhiteBalance",
+	0x0116: "ExtraInfo",
+	0x0e00: "PrintIM",
+	0x1000: "MultiBurstMode",
+	0x1001: "MultiBurstImageWidth",
+	0x1002: "MultiBurstImageHeight",
+	0x1003: "Panorama",
+	0x2001: "PreviewImage",
+	0x2002: "Rating",
+	0x2004: "Contrast",
+	0x2005: "Saturation",
+	0x2006: "Sharpness",
+	0x2007: "Brightness",
+	0x2008: "LongExposureNoiseReduction",
+	0x2009: "HighISONoiseReduction",
+	0x200a: "HDR",
+	0x200b: "MultiFrameNoiseReduction",
+	0x200e: "PictureEffect",
+	0x200f: "SoftSkinEffect",
+	0x2011: "VignettingCorrection",
+	0x2012: "LateralChromaticAberration",
+	0x2013: "DistortionCorrectionSetting",
+	0x2014: "WBShiftAB_GM",
+	0x2016: "AutoPortraitFramed",
+	0x2017: "FlashAction",
+	0x201a: "ElectronicFrontCurtainShutter",
+	0x201b: "FocusMode",
+	0x201c: "AFAreaModeSetting",
+	0x201d: "FlexibleSpotPosition",
+	0x201e: "AFPointSelected",
+	0x2020: "AFPointsUsed",
+	0x2021: "AFTracking",
+	0x2022: "FocalPlaneAFPointsUsed",
+	0x2023: "MultiFrameNREffect",
+	0x2026: "WBShiftAB_GM_Precise",
+	0x2027: "FocusLocation",
+	0x2028: "VariableLowPassFilter",
+	0x2029: "RAWFileType",
+	0x202b: "PrioritySetInAWB",
+	0x202c: "MeteringMode2",
+	0x202d: "ExposureStandardAdjustment",
+	0x202e: "Quality",
+	0x202f: "PixelShiftInfo",
+	0x2031: "SerialNumber",
+	0x2032: "Shadows",
+	0x2033: "Highlights",
+	0x2034: "Fade",
+	0x2035: "SharpnessRange",
+	0x2036: "Clarity",
+	0x2037: "FocusFrameSize",
+	0x2039: "JPEG-HEIFSwitch",
+	0x3000: "ShotInfo",
+	0xb000: "FileFormat",
+	0xb001: "SonyModelID",
+	0xb020: "CreativeStyle",
+	0xb021: "ColorTemperature",
+	0xb022: "ColorCompensationFilter",
+	0xb023: "SceneMode",
+	0xb024: "ZoneMatching",
+	0xb025: "DynamicRangeOptimizer",
+	0xb026: "ImageStabilization",
+	0xb027: "LensType",
+	0xb028: "MinoltaMakerNote",
+	0xb029: "ColorMode",
+	0xb02a: "LensSpec",
+	0xb02b: "FullImageSize",
+	0xb02c: "PreviewImageSize",
+	0xb040: "Macro",
+	0xb041: "ExposureMode",
+	0xb042: "FocusMode",
+	0xb043: "AFAreaMode",
+	0xb044: "AFIlluminator",
+	0xb047: "JPEGQuality",
+	0xb048: "FlashLevel",
+	0xb049: "ReleaseMode",
+	0xb04a: "SequenceNumber",
+	0xb04b: "Anti-Blur",
+	0xb04e: "FocusMode2",
+	0xb04f: "DynamicRangeOptimizer2",
+	0xb050: "HighISONoiseReduction2",
+	0xb052: "IntelligentAuto",
+	0xb054: "WhiteBalance2",
+}
+
+var nikonMakerNoteHeader = []byte("Nikon\x00")
+var sonyMakerNoteHeaders = [][]byte{
+	[]byte("SONY DSC \x00\x00\x00"),
+	[]byte("SONY CAM \x00\x00\x00"),
+	[]byte("SONY MOBILE\x00"),
+	[]byte("VHAB     \x00\x00\x00"),
+}
+
+// decodeMakerNote decodes vendor IFD maker notes, returns false if make or maker note layout is not known
+func decodeMakerNote(d *decode.D, ctx *decodeContext, valueByteOffset int64, valueByteSize int64) bool {
+	const headerPeekLen = 12
+	if valueByteSize < headerPeekLen {
+		return false
+	}
+	header := d.BytesRange(valueByteOffset*8, headerPeekLen)
+	pos := d.Pos()
+	defer d.SeekAbs(pos)
+
+	switch {
+	case strings.HasPrefix(ctx.make, "Canon"):
+		// IFD without header, offsets relative to tiff header
+		d.FieldStruct("maker_note", func(d *decode.D) {
+			d.FieldValueStr("vendor", "canon")
+			d.SeekAbs(valueByteOffset * 8)
+			decodeIfd(d, ctx, &strips{}, canonTagNames)
+		})
+	case strings.HasPrefix(ctx.make, "NIKON") && bytes.HasPrefix(header, nikonMakerNoteHeader) && header[6] == 0x02:
+		// header, version and embedded tiff header, offsets relative to embedded tiff header
+		d.FieldStruct("maker_note", func(d *decode.D) {
+			d.FieldValueStr("vendor", "nikon")
+			d.SeekAbs(valueByteOffset * 8)
+			d.FieldUTF8NullFixedLen("header", len(nikonMakerNoteHeader))
+			d.FieldU16("version", scalar.UintHex)
+			d.FieldU16("reserved")
+			d.FieldStruct("tiff", func(d *decode.D) {
+				nikonCtx := *ctx
+				nikonCtx.base = uint64(d.Pos() / 8)
+				decodeTiffHeaderAndIfds(d, &nikonCtx, nikonTagNames)
+			})
+		})
+	case strings.HasPrefix(ctx.make, "SONY"):
+		d.FieldStruct("maker_note", func(d *decode.D) {
+			d.FieldValueStr("vendor", "sony")
+			d.SeekAbs(valueByteOffset * 8)
+			for _, h := range sonyMakerNoteHeaders {
+				if bytes.HasPrefix(header, h) {
+					d.FieldUTF8NullFixedLen("header", len(h))
+					break
+				}
+			}
+			// IFD offsets relative to tiff header
+			decodeIfd(d, ctx, &strips{}, sonyTagNames)
+		})
+	default:
+		return false
+	}
+
+	return true
+}
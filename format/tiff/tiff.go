@@ -16,6 +16,8 @@ func init() {
 		format.TIFF,
 		&decode.Format{
 			Description: "Tag Image File Format",
+			Extensions:  []string{"tif", "tiff"},
+			MIMETypes:   []string{"image/tiff"},
 			Groups:      []*decode.Group{format.Probe, format.Image},
 			DecodeFn:    tiffDecode,
 			Dependencies: []decode.Dependency{
@@ -71,7 +73,7 @@ func fieldRational(d *decode.D, name string) float64 {
 	d.FieldStruct(name, func(d *decode.D) {
 		numerator := d.FieldU32("numerator")
 		denominator := d.FieldU32("denominator")
-		v := float64(numerator) / float64(denominator)
+		v = float64(numerator) / float64(denominator)
 		d.FieldValueFlt("float", v)
 	})
 	return v
@@ -82,7 +84,7 @@ func fieldSRational(d *decode.D, name string) float64 {
 	d.FieldStruct(name, func(d *decode.D) {
 		numerator := d.FieldS32("numerator")
 		denominator := d.FieldS32("denominator")
-		v := float64(numerator) / float64(denominator)
+		v = float64(numerator) / float64(denominator)
 		d.FieldValueFlt("float", v)
 	})
 	return v
@@ -93,7 +95,33 @@ type strips struct {
 	byteCounts []int64
 }
 
-func decodeIfd(d *decode.D, s *strips, tagNames scalar.UintMapSymStr) int64 {
+// values needed to calculate decimal degree coordinates
+type gpsInfo struct {
+	latitudeRef  string
+	latitude     []float64
+	longitudeRef string
+	longitude    []float64
+}
+
+type decodeContext struct {
+	base uint64 // byte position of tiff header, offsets are relative to it
+	make string
+	gps  *gpsInfo // set while decoding GPS IFD
+}
+
+// degrees, minutes and seconds to decimal degrees, negative if south or west
+func gpsDecimalDegrees(dms []float64, ref string) (float64, bool) {
+	if len(dms) != 3 {
+		return 0, false
+	}
+	v := dms[0] + dms[1]/60 + dms[2]/3600
+	if ref == "S" || ref == "W" {
+		v = -v
+	}
+	return v, true
+}
+
+func decodeIfd(d *decode.D, ctx *decodeContext, s *strips, tagNames scalar.UintMapSymStr) int64 {
 	var nextIfdOffset int64
 
 	d.FieldStruct("ifd", func(d *decode.D) {
@@ -110,7 +138,7 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UintMapSymStr) int64 {
 						return
 					}
 
-					valueByteOffset := valueOrByteOffset
+					valueByteOffset := ctx.base + valueOrByteOffset
 					valueByteSize := typeByteSize[typ] * count
 					if valueByteSize <= 4 {
 						// if value fits in offset itself use offset to value_offset
@@ -121,14 +149,24 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UintMapSymStr) int64 {
 					case typ == LONG && (tag == ExifIFD || tag == GPSInfo):
 						ifdPos := valueOrByteOffset
 						pos := d.Pos()
-						d.SeekAbs(int64(ifdPos * 8))
+						d.SeekAbs(int64((ctx.base + ifdPos) * 8))
 
 						switch tag {
 						case ExifIFD:
 							// TODO: exif tag names?
-							decodeIfd(d, &strips{}, tiffTagNames)
+							decodeIfd(d, ctx, &strips{}, tiffTagNames)
 						case GPSInfo:
-							decodeIfd(d, &strips{}, gpsInfoTagNames)
+							gps := &gpsInfo{}
+							ctx.gps = gps
+							decodeIfd(d, ctx, &strips{}, gpsInfoTagNames)
+							ctx.gps = nil
+
+							if v, ok := gpsDecimalDegrees(gps.latitude, gps.latitudeRef); ok {
+								d.FieldValueFlt("latitude", v)
+							}
+							if v, ok := gpsDecimalDegrees(gps.longitude, gps.longitudeRef); ok {
+								d.FieldValueFlt("longitude", v)
+							}
 						}
 
 						d.SeekAbs(pos)
@@ -137,9 +175,10 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UintMapSymStr) int64 {
 						d.FieldArray("values", func(d *decode.D) {
 							switch {
 							case typ == UNDEFINED:
-								switch tag {
-								case InterColorProfile:
+								switch {
+								case tag == InterColorProfile:
 									d.FieldFormatRange("icc", int64(valueByteOffset)*8, int64(valueByteSize)*8, &tiffIccProfile, nil)
+								case tag == MakerNote && decodeMakerNote(d, ctx, int64(valueByteOffset), int64(valueByteSize)):
 								default:
 									d.RangeFn(int64(valueByteOffset*8), int64(valueByteSize*8), func(d *decode.D) {
 										d.FieldRawLen("value", d.BitsLeft())
@@ -147,7 +186,15 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UintMapSymStr) int64 {
 								}
 							case typ == ASCII:
 								d.RangeFn(int64(valueByteOffset*8), int64(valueByteSize*8), func(d *decode.D) {
-									d.FieldUTF8NullFixedLen("value", int(valueByteSize))
+									v := d.FieldUTF8NullFixedLen("value", int(valueByteSize))
+									switch {
+									case tag == Make && ctx.gps == nil:
+										ctx.make = v
+									case tag == GPSLatitudeRef && ctx.gps != nil:
+										ctx.gps.latitudeRef = v
+									case tag == GPSLongitudeRef && ctx.gps != nil:
+										ctx.gps.longitudeRef = v
+									}
 								})
 							case typ == BYTE:
 								d.RangeFn(int64(valueByteOffset*8), int64(valueByteSize*8), func(d *decode.D) {
@@ -179,7 +226,13 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UintMapSymStr) int64 {
 												s.byteCounts = append(s.byteCounts, int64(v*8))
 											}
 										case RATIONAL:
-											fieldRational(d, "value")
+											v := fieldRational(d, "value")
+											switch {
+											case tag == GPSLatitude && ctx.gps != nil:
+												ctx.gps.latitude = append(ctx.gps.latitude, v)
+											case tag == GPSLongitude && ctx.gps != nil:
+												ctx.gps.longitude = append(ctx.gps.longitude, v)
+											}
 										case SLONG:
 											d.FieldS32("value")
 										case SRATIONAL:
@@ -203,6 +256,12 @@ func decodeIfd(d *decode.D, s *strips, tagNames scalar.UintMapSymStr) int64 {
 }
 
 func tiffDecode(d *decode.D) any {
+	decodeTiffHeaderAndIfds(d, &decodeContext{}, tiffTagNames)
+
+	return nil
+}
+
+func decodeTiffHeaderAndIfds(d *decode.D, ctx *decodeContext, tagNames scalar.UintMapSymStr) {
 	endian := d.FieldU32("endian", endianNames, scalar.UintHex)
 
 	switch endian {
@@ -227,13 +286,13 @@ func tiffDecode(d *decode.D) any {
 
 	d.FieldArray("ifds", func(d *decode.D) {
 		// sanity check offset
-		for ifdOffset > 0 && ifdOffset*8 < d.Len() {
+		for ifdOffset > 0 && (int64(ctx.base)+ifdOffset)*8 < d.Len() {
 			if _, ok := ifdSeen[ifdOffset]; ok {
 				d.Fatalf("ifd loop detected for %d", ifdOffset)
 			}
 			ifdSeen[ifdOffset] = struct{}{}
-			d.SeekAbs(ifdOffset * 8)
-			ifdOffset = decodeIfd(d, s, tiffTagNames)
+			d.SeekAbs((int64(ctx.base) + ifdOffset) * 8)
+			ifdOffset = decodeIfd(d, ctx, s, tagNames)
 		}
 	})
 
@@ -248,6 +307,4 @@ func tiffDecode(d *decode.D) any {
 			}
 		})
 	}
-
-	return nil
 }
@@ -0,0 +1,61 @@
+package tls
+
+// https://github.com/salesforce/ja3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// fingerprint fields collected while decoding client or server hello
+type ja3 struct {
+	version      uint64
+	cipherSuits  []uint64
+	extensions   []uint64
+	groups       []uint64
+	pointFormats []uint64
+}
+
+// GREASE values are ignored, https://www.rfc-editor.org/rfc/rfc8701
+func isGREASE(v uint64) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func ja3Join(vs []uint64) string {
+	var ss []string
+	for _, v := range vs {
+		if isGREASE(v) {
+			continue
+		}
+		ss = append(ss, strconv.FormatUint(v, 10))
+	}
+	return strings.Join(ss, "-")
+}
+
+// client fingerprint: version,ciphers,extensions,groups,point_formats
+func (j *ja3) clientString() string {
+	return strings.Join([]string{
+		strconv.FormatUint(j.version, 10),
+		ja3Join(j.cipherSuits),
+		ja3Join(j.extensions),
+		ja3Join(j.groups),
+		ja3Join(j.pointFormats),
+	}, ",")
+}
+
+// server fingerprint (ja3s): version,cipher,extensions
+func (j *ja3) serverString() string {
+	return strings.Join([]string{
+		strconv.FormatUint(j.version, 10),
+		ja3Join(j.cipherSuits),
+		ja3Join(j.extensions),
+	}, ",")
+}
+
+func ja3Digest(s string) string {
+	//nolint:gosec
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
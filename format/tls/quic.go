@@ -0,0 +1,133 @@
+package tls
+
+// https://www.rfc-editor.org/rfc/rfc9001#section-8.2
+// https://www.rfc-editor.org/rfc/rfc9000#section-18
+
+import (
+	"net"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	quicTransportParameterOriginalDestinationConnectionID = 0x00
+	quicTransportParameterMaxIdleTimeout                  = 0x01
+	quicTransportParameterStatelessResetToken             = 0x02
+	quicTransportParameterMaxUDPPayloadSize               = 0x03
+	quicTransportParameterInitialMaxData                  = 0x04
+	quicTransportParameterInitialMaxStreamDataBidiLocal   = 0x05
+	quicTransportParameterInitialMaxStreamDataBidiRemote  = 0x06
+	quicTransportParameterInitialMaxStreamDataUni         = 0x07
+	quicTransportParameterInitialMaxStreamsBidi           = 0x08
+	quicTransportParameterInitialMaxStreamsUni            = 0x09
+	quicTransportParameterAckDelayExponent                = 0x0a
+	quicTransportParameterMaxAckDelay                     = 0x0b
+	quicTransportParameterDisableActiveMigration          = 0x0c
+	quicTransportParameterPreferredAddress                = 0x0d
+	quicTransportParameterActiveConnectionIDLimit         = 0x0e
+	quicTransportParameterInitialSourceConnectionID       = 0x0f
+	quicTransportParameterRetrySourceConnectionID         = 0x10
+	quicTransportParameterVersionInformation              = 0x11
+	quicTransportParameterMaxDatagramFrameSize            = 0x20
+	quicTransportParameterGreaseQUICBit                   = 0x2ab2
+)
+
+var quicTransportParameterMap = scalar.UintMapSymStr{
+	quicTransportParameterOriginalDestinationConnectionID: "original_destination_connection_id",
+	quicTransportParameterMaxIdleTimeout:                  "max_idle_timeout",
+	quicTransportParameterStatelessResetToken:             "stateless_reset_token",
+	quicTransportParameterMaxUDPPayloadSize:               "max_udp_payload_size",
+	quicTransportParameterInitialMaxData:                  "initial_max_data",
+	quicTransportParameterInitialMaxStreamDataBidiLocal:   "initial_max_stream_data_bidi_local",
+	quicTransportParameterInitialMaxStreamDataBidiRemote:  "initial_max_stream_data_bidi_remote",
+	quicTransportParameterInitialMaxStreamDataUni:         "initial_max_stream_data_uni",
+	quicTransportParameterInitialMaxStreamsBidi:           "initial_max_streams_bidi",
+	quicTransportParameterInitialMaxStreamsUni:            "initial_max_streams_uni",
+	quicTransportParameterAckDelayExponent:                "ack_delay_exponent",
+	quicTransportParameterMaxAckDelay:                     "max_ack_delay",
+	quicTransportParameterDisableActiveMigration:          "disable_active_migration",
+	quicTransportParameterPreferredAddress:                "preferred_address",
+	quicTransportParameterActiveConnectionIDLimit:         "active_connection_id_limit",
+	quicTransportParameterInitialSourceConnectionID:       "initial_source_connection_id",
+	quicTransportParameterRetrySourceConnectionID:         "retry_source_connection_id",
+	quicTransportParameterVersionInformation:              "version_information",
+	quicTransportParameterMaxDatagramFrameSize:            "max_datagram_frame_size",
+	quicTransportParameterGreaseQUICBit:                   "grease_quic_bit",
+}
+
+var quicTransportParameterNames = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if name, ok := quicTransportParameterMap[s.Actual]; ok {
+		s.Sym = name
+	} else if s.Actual >= 27 && (s.Actual-27)%31 == 0 {
+		// reserved to exercise unknown parameter handling, 31 * N + 27
+		s.Sym = "reserved"
+	}
+	return s, nil
+})
+
+func quicVarint(d *decode.D) uint64 {
+	n := d.U2()
+	return d.U(int(8<<n) - 2)
+}
+
+func fieldQUICVarint(d *decode.D, name string, sms ...scalar.UintMapper) uint64 {
+	return d.FieldUintFn(name, quicVarint, sms...)
+}
+
+func decodeQUICTransportParameters(d *decode.D) {
+	d.FieldArray("transport_parameters", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("transport_parameter", func(d *decode.D) {
+				id := fieldQUICVarint(d, "id", quicTransportParameterNames, scalar.UintHex)
+				length := fieldQUICVarint(d, "length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					switch id {
+					case quicTransportParameterOriginalDestinationConnectionID,
+						quicTransportParameterInitialSourceConnectionID,
+						quicTransportParameterRetrySourceConnectionID,
+						quicTransportParameterStatelessResetToken:
+						d.FieldRawLen("value", d.BitsLeft(), scalar.RawHex)
+					case quicTransportParameterDisableActiveMigration,
+						quicTransportParameterGreaseQUICBit:
+						// no value
+					case quicTransportParameterPreferredAddress:
+						d.FieldStruct("value", func(d *decode.D) {
+							d.FieldStrFn("ipv4_address", func(d *decode.D) string { return net.IP(d.BytesLen(4)).String() })
+							d.FieldU16("ipv4_port")
+							d.FieldStrFn("ipv6_address", func(d *decode.D) string { return net.IP(d.BytesLen(16)).String() })
+							d.FieldU16("ipv6_port")
+							connectionIDLength := d.FieldU8("connection_id_length")
+							d.FieldRawLen("connection_id", int64(connectionIDLength)*8, scalar.RawHex)
+							d.FieldRawLen("stateless_reset_token", 16*8, scalar.RawHex)
+						})
+					case quicTransportParameterVersionInformation:
+						d.FieldStruct("value", func(d *decode.D) {
+							d.FieldU32("chosen_version", scalar.UintHex)
+							d.FieldArray("available_versions", func(d *decode.D) {
+								for !d.End() {
+									d.FieldU32("version", scalar.UintHex)
+								}
+							})
+						})
+					case quicTransportParameterMaxIdleTimeout,
+						quicTransportParameterMaxUDPPayloadSize,
+						quicTransportParameterInitialMaxData,
+						quicTransportParameterInitialMaxStreamDataBidiLocal,
+						quicTransportParameterInitialMaxStreamDataBidiRemote,
+						quicTransportParameterInitialMaxStreamDataUni,
+						quicTransportParameterInitialMaxStreamsBidi,
+						quicTransportParameterInitialMaxStreamsUni,
+						quicTransportParameterAckDelayExponent,
+						quicTransportParameterMaxAckDelay,
+						quicTransportParameterActiveConnectionIDLimit,
+						quicTransportParameterMaxDatagramFrameSize:
+						fieldQUICVarint(d, "value")
+					default:
+						d.FieldRawLen("value", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,83 @@
+#!/usr/bin/env python3
+# generates a tls record with a client hello with a quic_transport_parameters extension
+# and GREASE values
+import struct
+
+
+def varint(n):
+    if n < 1 << 6:
+        return bytes([n])
+    if n < 1 << 14:
+        return struct.pack(">H", 0x4000 | n)
+    if n < 1 << 30:
+        return struct.pack(">I", 0x80000000 | n)
+    return struct.pack(">Q", 0xC000000000000000 | n)
+
+
+def param(pid, value):
+    return varint(pid) + varint(len(value)) + value
+
+
+params = b"".join(
+    [
+        param(0x01, varint(30000)),
+        param(0x03, varint(1472)),
+        param(0x04, varint(1048576)),
+        param(0x05, varint(262144)),
+        param(0x06, varint(262144)),
+        param(0x07, varint(262144)),
+        param(0x08, varint(100)),
+        param(0x09, varint(103)),
+        param(0x0A, varint(3)),
+        param(0x0B, varint(25)),
+        param(0x0C, b""),
+        param(0x0E, varint(4)),
+        param(0x0F, bytes.fromhex("c5c6c7c8")),
+        param(0x11, struct.pack(">III", 0x00000001, 0x6B3343CF, 0x00000001)),
+        param(0x20, varint(65535)),
+        param(0x2AB2, b""),
+        param(31 * 2 + 27, b"grease"),
+        # preferred address is only sent by servers but included to test decoding
+        param(
+            0x0D,
+            bytes([192, 168, 0, 3]) + struct.pack(">H", 443)
+            + bytes.fromhex("20010db8000000000000000000000003") + struct.pack(">H", 443)
+            + bytes([4]) + bytes.fromhex("d0d1d2d3")
+            + bytes(range(16)),
+        ),
+    ]
+)
+
+
+def ext(typ, data):
+    return struct.pack(">HH", typ, len(data)) + data
+
+
+server_name = b"example.com"
+extensions = b"".join(
+    [
+        # GREASE values are ignored by ja3
+        ext(0x1A1A, b""),
+        ext(0, struct.pack(">HBH", len(server_name) + 3, 0, len(server_name)) + server_name),
+        ext(16, struct.pack(">H", 3) + b"\x02h3"),
+        ext(10, struct.pack(">HHHH", 6, 0x2A2A, 29, 23)),
+        ext(11, b"\x01\x00"),
+        ext(43, b"\x02\x03\x04"),
+        ext(57, params),
+    ]
+)
+
+cipher_suites = struct.pack(">HHHH", 0x0A0A, 0x1301, 0x1302, 0x1303)
+body = (
+    struct.pack(">H", 0x0303)
+    + bytes(range(32))
+    + b"\x00"
+    + struct.pack(">H", len(cipher_suites))
+    + cipher_suites
+    + b"\x01\x00"
+    + struct.pack(">H", len(extensions))
+    + extensions
+)
+handshake = b"\x01" + len(body).to_bytes(3, "big") + body
+record = struct.pack(">BHH", 22, 0x0301, len(handshake)) + handshake
+open("quic_client_hello", "wb").write(record)
@@ -233,8 +233,9 @@ type tlsCtx struct {
 	clientCtx *tlsCtx
 }
 
-func decodeTLSExtension(d *decode.D) {
+func decodeTLSExtension(d *decode.D, j *ja3) {
 	typ := d.FieldU16("type", extensionNames)
+	j.extensions = append(j.extensions, typ)
 	length := d.FieldU16("length")
 	// server sometimes use empty extension to indicate things, ex: accept SNI
 	if length == 0 {
@@ -272,7 +273,7 @@ func decodeTLSExtension(d *decode.D) {
 			d.FieldArray("ex_points_formats", func(d *decode.D) {
 				d.FramedFn(int64(protocolsLength)*8, func(d *decode.D) {
 					for !d.End() {
-						d.FieldU8("ex_points_format", scalar.UintHex) // TODO: names
+						j.pointFormats = append(j.pointFormats, d.FieldU8("ex_points_format", scalar.UintHex)) // TODO: names
 					}
 				})
 			})
@@ -281,7 +282,7 @@ func decodeTLSExtension(d *decode.D) {
 			d.FieldArray("supported_groups", func(d *decode.D) {
 				d.FramedFn(int64(protocolsLength)*8, func(d *decode.D) {
 					for !d.End() {
-						d.FieldU16("supported_group", scalar.UintHex) // TODO: names
+						j.groups = append(j.groups, d.FieldU16("supported_group", scalar.UintHex)) // TODO: names
 					}
 				})
 			})
@@ -297,6 +298,8 @@ func decodeTLSExtension(d *decode.D) {
 					}
 				})
 			})
+		case extensionQuicTransportParameters:
+			decodeQUICTransportParameters(d)
 		default:
 			d.FieldRawLen("data", int64(length)*8)
 		}
@@ -314,6 +317,7 @@ func decodeTLSHandshake(d *decode.D, tc *tlsCtx) {
 		case handshakeMsgTypeClientHello,
 			handshakeMsgTypeServerHello:
 			tc.version = d.FieldU16("version", versionNames, scalar.UintHex)
+			j := &ja3{version: tc.version}
 			copy(tc.random[:], d.PeekBytes(32))
 			d.FieldStruct("random", func(d *decode.D) {
 				d.FieldU32("gmt_unix_time", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
@@ -325,12 +329,13 @@ func decodeTLSHandshake(d *decode.D, tc *tlsCtx) {
 
 			if msgType == handshakeMsgTypeServerHello {
 				tc.server.nextCipherSuit = d.FieldU16("cipher_suit", cipherNames, scalar.UintHex)
+				j.cipherSuits = append(j.cipherSuits, tc.server.nextCipherSuit)
 			} else {
 				cipherSuitLength := d.FieldU16("cipher_suits_length")
 				d.FramedFn(int64(cipherSuitLength)*8, func(d *decode.D) {
 					d.FieldArray("cipher_suits", func(d *decode.D) {
 						for !d.End() {
-							d.FieldU16("cipher_suit", cipherNames, scalar.UintHex)
+							j.cipherSuits = append(j.cipherSuits, d.FieldU16("cipher_suit", cipherNames, scalar.UintHex))
 						}
 					})
 				})
@@ -355,11 +360,21 @@ func decodeTLSHandshake(d *decode.D, tc *tlsCtx) {
 				d.FramedFn(int64(extensionsLength)*8, func(d *decode.D) {
 					d.FieldArray("extensions", func(d *decode.D) {
 						for !d.End() {
-							d.FieldStruct("extension", decodeTLSExtension)
+							d.FieldStruct("extension", func(d *decode.D) { decodeTLSExtension(d, j) })
 						}
 					})
 				})
 			}
+
+			if msgType == handshakeMsgTypeServerHello {
+				ja3s := j.serverString()
+				d.FieldValueStr("ja3s", ja3s)
+				d.FieldValueStr("ja3s_digest", ja3Digest(ja3s))
+			} else {
+				ja3 := j.clientString()
+				d.FieldValueStr("ja3", ja3)
+				d.FieldValueStr("ja3_digest", ja3Digest(ja3))
+			}
 		case handshakeMsgTypeCertificate:
 			certificatesLength := d.FieldU24("certificates_length")
 			d.FramedFn(int64(certificatesLength)*8, func(d *decode.D) {
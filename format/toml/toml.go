@@ -25,10 +25,12 @@ func init() {
 		format.TOML,
 		&decode.Format{
 			Description: "Tom's Obvious, Minimal Language",
+			Extensions:  []string{"toml"},
+			MIMETypes:   []string{"application/toml"},
 			ProbeOrder:  format.ProbeOrderTextFuzzy,
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeTOML,
-			Functions:   []string{"_todisplay"},
+			Functions:   []string{"_todisplay", "_encode"},
 		})
 	interp.RegisterFS(tomlFS)
 	interp.RegisterFunc0("to_toml", toTOML)
@@ -0,0 +1,304 @@
+package tpm
+
+// https://trustedcomputinggroup.org/resource/pc-client-specific-platform-firmware-profile-specification/
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed tpm_eventlog.md
+var tpmEventlogFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.TPM_Eventlog,
+		&decode.Format{
+			Description: "TPM measured boot event log",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeTPMEventlog,
+		})
+	interp.RegisterFS(tpmEventlogFS)
+}
+
+const sha1DigestLen = 20
+
+const (
+	evPostCode                   = 0x00000001
+	evNoAction                   = 0x00000003
+	evSeparator                  = 0x00000004
+	evAction                     = 0x00000005
+	evSCRTMVersion               = 0x00000008
+	evIPL                        = 0x0000000d
+	evEFIVariableDriverConfig    = 0x80000001
+	evEFIVariableBoot            = 0x80000002
+	evEFIBootServicesApplication = 0x80000003
+	evEFIBootServicesDriver      = 0x80000004
+	evEFIRuntimeServicesDriver   = 0x80000005
+	evEFIAction                  = 0x80000007
+	evEFIPlatformFirmwareBlob    = 0x80000008
+	evEFIHandoffTables           = 0x80000009
+	evEFIPlatformFirmwareBlob2   = 0x8000000a
+	evEFIVariableBoot2           = 0x8000000c
+	evEFIVariableAuthority       = 0x800000e0
+)
+
+var eventTypeNames = scalar.UintMapSymStr{
+	0x00000000:                   "ev_preboot_cert",
+	evPostCode:                   "ev_post_code",
+	0x00000002:                   "ev_unused",
+	evNoAction:                   "ev_no_action",
+	evSeparator:                  "ev_separator",
+	evAction:                     "ev_action",
+	0x00000006:                   "ev_event_tag",
+	0x00000007:                   "ev_s_crtm_contents",
+	evSCRTMVersion:               "ev_s_crtm_version",
+	0x00000009:                   "ev_cpu_microcode",
+	0x0000000a:                   "ev_platform_config_flags",
+	0x0000000b:                   "ev_table_of_devices",
+	0x0000000c:                   "ev_compact_hash",
+	evIPL:                        "ev_ipl",
+	0x0000000e:                   "ev_ipl_partition_data",
+	0x0000000f:                   "ev_nonhost_code",
+	0x00000010:                   "ev_nonhost_config",
+	0x00000011:                   "ev_nonhost_info",
+	0x00000012:                   "ev_omit_boot_device_events",
+	0x00000013:                   "ev_post_code2",
+	0x80000000:                   "ev_efi_event_base",
+	evEFIVariableDriverConfig:    "ev_efi_variable_driver_config",
+	evEFIVariableBoot:            "ev_efi_variable_boot",
+	evEFIBootServicesApplication: "ev_efi_boot_services_application",
+	evEFIBootServicesDriver:      "ev_efi_boot_services_driver",
+	evEFIRuntimeServicesDriver:   "ev_efi_runtime_services_driver",
+	0x80000006:                   "ev_efi_gpt_event",
+	evEFIAction:                  "ev_efi_action",
+	evEFIPlatformFirmwareBlob:    "ev_efi_platform_firmware_blob",
+	evEFIHandoffTables:           "ev_efi_handoff_tables",
+	evEFIPlatformFirmwareBlob2:   "ev_efi_platform_firmware_blob2",
+	0x8000000b:                   "ev_efi_handoff_tables2",
+	evEFIVariableBoot2:           "ev_efi_variable_boot2",
+	0x8000000d:                   "ev_efi_gpt_event2",
+	0x80000010:                   "ev_efi_hcrtm_event",
+	evEFIVariableAuthority:       "ev_efi_variable_authority",
+	0x800000e1:                   "ev_efi_spdm_firmware_blob",
+	0x800000e2:                   "ev_efi_spdm_firmware_config",
+	0x800000e3:                   "ev_efi_spdm_device_policy",
+	0x800000e4:                   "ev_efi_spdm_device_authority",
+}
+
+// TPM_ALG_ID
+var algorithmNames = scalar.UintMapSymStr{
+	0x0004: "sha1",
+	0x000b: "sha256",
+	0x000c: "sha384",
+	0x000d: "sha512",
+	0x0012: "sm3_256",
+	0x0027: "sha3_256",
+	0x0028: "sha3_384",
+	0x0029: "sha3_512",
+}
+
+// used if an algorithm is not listed in the spec id event
+var algorithmDigestLen = map[uint64]int{
+	0x0004: 20,
+	0x000b: 32,
+	0x000c: 48,
+	0x000d: 64,
+	0x0012: 32,
+	0x0027: 32,
+	0x0028: 48,
+	0x0029: 64,
+}
+
+var separatorNames = scalar.UintMapSymStr{
+	0x00000000: "normal",
+	0x00000001: "error",
+	0xffffffff: "error",
+}
+
+// GUIDs are stored with the first three fields little endian
+func guidString(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)
+}
+
+var rawGUID = scalar.BitBufFn(func(s scalar.BitBuf) (scalar.BitBuf, error) {
+	return scalar.RawSym(s, -1, guidString)
+})
+
+type guidMapDescription map[string]string
+
+func (m guidMapDescription) MapBitBuf(s scalar.BitBuf) (scalar.BitBuf, error) {
+	if g, ok := s.Sym.(string); ok {
+		s.Description = m[g]
+	}
+	return s, nil
+}
+
+var guidNames = guidMapDescription{
+	"8be4df61-93ca-11d2-aa0d-00e098032b8c": "efi_global_variable",
+	"d719b2cb-3d3a-4596-a3bc-dad00e67656f": "efi_image_security_database",
+	"605dab50-e046-4300-abb6-3dd810dd8b23": "shim_lock",
+	"eb9d2d30-2d88-11d3-9a16-0090273fc14d": "acpi_table",
+	"8868e871-e4f1-11d3-bc22-0080c73c8881": "acpi_20_table",
+	"eb9d2d31-2d88-11d3-9a16-0090273fc14d": "smbios_table",
+	"f2fd1544-9794-4a2c-992e-e5bbcf20e394": "smbios3_table",
+}
+
+type specIDEvent struct {
+	digestLens map[uint64]int
+}
+
+func decodeSpecIDEvent(d *decode.D) specIDEvent {
+	s := specIDEvent{digestLens: map[uint64]int{}}
+	d.FieldUTF8NullFixedLen("signature", 16)
+	d.FieldU32("platform_class")
+	d.FieldU8("spec_version_minor")
+	d.FieldU8("spec_version_major")
+	d.FieldU8("spec_errata")
+	d.FieldU8("uintn_size")
+	numberOfAlgorithms := d.FieldU32("number_of_algorithms")
+	d.FieldArray("digest_sizes", func(d *decode.D) {
+		for i := uint64(0); i < numberOfAlgorithms; i++ {
+			d.FieldStruct("digest_size", func(d *decode.D) {
+				algorithmID := d.FieldU16("algorithm_id", algorithmNames)
+				digestSize := d.FieldU16("digest_size")
+				s.digestLens[algorithmID] = int(digestSize)
+			})
+		}
+	})
+	vendorInfoSize := d.FieldU8("vendor_info_size")
+	d.FieldRawLen("vendor_info", int64(vendorInfoSize)*8)
+	return s
+}
+
+func decodeUEFIVariableData(d *decode.D) {
+	d.FieldRawLen("variable_name", 16*8, rawGUID, guidNames)
+	unicodeNameLength := d.FieldU64("unicode_name_length")
+	variableDataLength := d.FieldU64("variable_data_length")
+	d.FieldUTF16LE("unicode_name", int(unicodeNameLength)*2)
+	d.FieldRawLen("variable_data", int64(variableDataLength)*8)
+}
+
+func decodeDigests(d *decode.D, specID specIDEvent) {
+	count := d.FieldU32("digest_count")
+	d.FieldArray("digests", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("digest", func(d *decode.D) {
+				algorithmID := d.FieldU16("algorithm_id", algorithmNames)
+				digestLen, ok := specID.digestLens[algorithmID]
+				if !ok {
+					digestLen, ok = algorithmDigestLen[algorithmID]
+				}
+				if !ok {
+					d.Fatalf("unknown digest size for algorithm 0x%x", algorithmID)
+				}
+				d.FieldRawLen("digest", int64(digestLen)*8)
+			})
+		}
+	})
+}
+
+func decodeEvent(d *decode.D, eventType uint64, specID *specIDEvent) {
+	switch eventType {
+	case evNoAction:
+		bs := d.PeekBytes(int(min(16, d.BitsLeft()/8)))
+		switch {
+		case bytes.HasPrefix(bs, []byte("Spec ID Event03\x00")):
+			*specID = decodeSpecIDEvent(d)
+		case bytes.HasPrefix(bs, []byte("StartupLocality\x00")):
+			d.FieldUTF8NullFixedLen("signature", 16)
+			d.FieldU8("startup_locality")
+		}
+	case evSeparator:
+		if d.BitsLeft() == 32 {
+			d.FieldU32("value", separatorNames, scalar.UintHex)
+		}
+	case evAction, evEFIAction, evIPL, evPostCode:
+		d.FieldUTF8NullFixedLen("string", int(d.BitsLeft()/8))
+	case evSCRTMVersion:
+		d.FieldUTF16LENull("version")
+	case evEFIVariableDriverConfig, evEFIVariableBoot, evEFIVariableBoot2, evEFIVariableAuthority:
+		decodeUEFIVariableData(d)
+	case evEFIBootServicesApplication, evEFIBootServicesDriver, evEFIRuntimeServicesDriver:
+		d.FieldU64("image_location_in_memory", scalar.UintHex)
+		d.FieldU64("image_length_in_memory")
+		d.FieldU64("image_link_time_address", scalar.UintHex)
+		lengthOfDevicePath := d.FieldU64("length_of_device_path")
+		d.FieldRawLen("device_path", int64(lengthOfDevicePath)*8)
+	case evEFIPlatformFirmwareBlob:
+		d.FieldU64("blob_base", scalar.UintHex)
+		d.FieldU64("blob_length")
+	case evEFIPlatformFirmwareBlob2:
+		descriptionSize := d.FieldU8("blob_description_size")
+		d.FieldUTF8("blob_description", int(descriptionSize))
+		d.FieldU64("blob_base", scalar.UintHex)
+		d.FieldU64("blob_length")
+	case evEFIHandoffTables:
+		numberOfTables := d.FieldU64("number_of_tables")
+		d.FieldArray("tables", func(d *decode.D) {
+			for i := uint64(0); i < numberOfTables; i++ {
+				d.FieldStruct("table", func(d *decode.D) {
+					d.FieldRawLen("vendor_guid", 16*8, rawGUID, guidNames)
+					d.FieldU64("vendor_table", scalar.UintHex)
+				})
+			}
+		})
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeTPMEventlog(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	// only crypto agile logs has something like a magic so require it when probing,
+	// also nested probing without IsProbe set, ex: files in archives
+	var pi format.Probe_In
+	if d.ArgAs(&pi) {
+		bs := d.PeekBytes(32 + 16)
+		if binary.LittleEndian.Uint32(bs[0:]) != 0 ||
+			binary.LittleEndian.Uint32(bs[4:]) != evNoAction ||
+			!bytes.Equal(bs[8:28], make([]byte, sha1DigestLen)) ||
+			!bytes.HasPrefix(bs[32:], []byte("Spec ID Event")) {
+			d.Fatalf("no spec id event found")
+		}
+	}
+
+	// first event is always in the sha1 format, if it is a spec id event the rest
+	// of the log is in the crypto agile format with a digest per algorithm
+	var specID specIDEvent
+	d.FieldArray("events", func(d *decode.D) {
+		for !d.End() {
+			cryptoAgile := specID.digestLens != nil
+			d.FieldStruct("event", func(d *decode.D) {
+				d.FieldU32("pcr_index")
+				eventType := d.FieldU32("event_type", eventTypeNames)
+				if cryptoAgile {
+					decodeDigests(d, specID)
+				} else {
+					d.FieldRawLen("digest", sha1DigestLen*8)
+				}
+				eventSize := d.FieldU32("event_size")
+				d.FramedFn(int64(eventSize)*8, func(d *decode.D) {
+					d.FieldStruct("event", func(d *decode.D) { decodeEvent(d, eventType, &specID) })
+				})
+			})
+		}
+	})
+
+	return nil
+}
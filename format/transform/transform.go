@@ -0,0 +1,114 @@
+package transform
+
+// binary to binary transforms, ex: decompress or deobfuscate payloads so they
+// can be decoded
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/wader/fq/internal/lz4"
+	"github.com/wader/fq/internal/zstd"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+func init() {
+	interp.RegisterFunc0("inflate", func(_ *interp.Interp, c any) any {
+		return readerTransform(c, func(r io.Reader) (io.Reader, error) {
+			return flate.NewReader(r), nil
+		})
+	})
+	interp.RegisterFunc0("gunzip", func(_ *interp.Interp, c any) any {
+		return readerTransform(c, func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		})
+	})
+	interp.RegisterFunc0("unlz4", func(_ *interp.Interp, c any) any {
+		return bytesTransform(c, lz4.Decompress)
+	})
+	interp.RegisterFunc0("unzstd", func(_ *interp.Interp, c any) any {
+		return bytesTransform(c, zstd.Decompress)
+	})
+	interp.RegisterFunc1("xor", func(_ *interp.Interp, c any, key any) any {
+		// as binary array so that a number is a byte
+		kb, err := toBytes([]any{key})
+		if err != nil {
+			return err
+		}
+		if len(kb) == 0 {
+			return errors.New("xor: key is empty")
+		}
+		return bytesTransform(c, func(b []byte) ([]byte, error) {
+			for i := range b {
+				b[i] ^= kb[i%len(kb)]
+			}
+			return b, nil
+		})
+	})
+	interp.RegisterFunc1("rot", func(_ *interp.Interp, c any, n int) any {
+		return bytesTransform(c, func(b []byte) ([]byte, error) {
+			for i := range b {
+				b[i] += byte(n)
+			}
+			return b, nil
+		})
+	})
+	interp.RegisterFunc0("reverse_bits", func(_ *interp.Interp, c any) any {
+		return bytesTransform(c, func(b []byte) ([]byte, error) {
+			for i := range b {
+				b[i] = bits.Reverse8(b[i])
+			}
+			return b, nil
+		})
+	})
+}
+
+func toBytes(v any) ([]byte, error) {
+	br, err := interp.ToBitReader(v)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(bitio.NewIOReader(br))
+}
+
+func toBinary(b []byte) any {
+	bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(b, -1), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
+
+// fn is allowed to modify and return input bytes
+func bytesTransform(c any, fn func(b []byte) ([]byte, error)) any {
+	b, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	b, err = fn(b)
+	if err != nil {
+		return err
+	}
+	return toBinary(b)
+}
+
+func readerTransform(c any, fn func(r io.Reader) (io.Reader, error)) any {
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+	r, err := fn(bitio.NewIOReader(br))
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, r); err != nil {
+		return err
+	}
+	return toBinary(buf.Bytes())
+}
@@ -62,7 +62,7 @@ func decodeTZifHeader(d *decode.D, name string) tzifHeader {
 	d.FieldStruct(name, func(d *decode.D) {
 		h.magic = uint32(d.FieldU32("magic", scalar.UintHex, d.UintAssert(0x545a6966)))
 		h.ver = uint8(d.FieldU8("ver", d.UintAssert(0x00, 0x32, 0x33), scalar.UintHex, versionToSymMapper))
-		d.FieldRawLen("reserved", 15*8)
+		d.FieldRawReserved("reserved", 15*8)
 		h.isutcnt = uint32(d.FieldU32("isutcnt"))
 		h.isstdcnt = uint32(d.FieldU32("isstdcnt"))
 		h.leapcnt = uint32(d.FieldU32("leapcnt"))
@@ -0,0 +1,142 @@
+#!/usr/bin/env python3
+# generates a small UBI image with a volume table and an UBIFS volume, also
+# writes the UBIFS volume as a separate image
+import pathlib
+import struct
+import zlib
+
+here = pathlib.Path(__file__).parent
+
+PEB_SIZE = 8192
+VID_HDR_OFFSET = 64
+DATA_OFFSET = 128
+LEB_SIZE = PEB_SIZE - DATA_OFFSET
+LAYOUT_VOLUME_ID = 0x7FFFEFFF
+UBIFS_MAGIC = 0x06101831
+MTIME = 1700000000
+
+
+def crc(b):
+    # crc32 with initial value 0xffffffff and no final xor
+    return zlib.crc32(b) ^ 0xFFFFFFFF
+
+
+def ec_header(ec):
+    h = b"UBI#" + struct.pack(">B3xQIII32x", 1, ec, VID_HDR_OFFSET, DATA_OFFSET, 0x12345678)
+    return h + struct.pack(">I", crc(h))
+
+
+def vid_header(vol_id, lnum, sqnum):
+    h = b"UBI!" + struct.pack(
+        ">BBBBII4xIIII4xQ12x", 1, 1, 0, 0, vol_id, lnum, 0, 0, 0, 0, sqnum
+    )
+    return h + struct.pack(">I", crc(h))
+
+
+def peb(ec, vid=None, data=b""):
+    b = ec_header(ec)
+    b += b"\xff" * (VID_HDR_OFFSET - len(b))
+    if vid is not None:
+        b += vid
+    b += b"\xff" * (DATA_OFFSET - len(b))
+    b += data
+    return b + b"\xff" * (PEB_SIZE - len(b))
+
+
+def volume_table():
+    records = b""
+    for i in range(min(128, LEB_SIZE // 172)):
+        if i == 0:
+            name = b"rootfs"
+            r = struct.pack(">IIIBBH", 4, 1, 0, 1, 0, len(name)) + name.ljust(128, b"\0")
+            r += struct.pack(">B23x", 0)
+        else:
+            r = bytes(168)
+        records += r + struct.pack(">I", crc(r))
+    return records
+
+
+sqnum = 0
+
+
+def node(node_type, payload, group_type=0):
+    global sqnum
+    sqnum += 1
+    length = 24 + len(payload)
+    rest = struct.pack("<QIBB2x", sqnum, length, node_type, group_type) + payload
+    return struct.pack("<II", UBIFS_MAGIC, crc(rest)) + rest
+
+
+def align8(b):
+    return b + bytes(-len(b) % 8)
+
+
+def key(inum, typ, value=0):
+    return struct.pack("<II8x", inum, typ << 29 | value)
+
+
+def sb_node():
+    p = struct.pack(
+        "<2xBBIIIIIQIIIIIIIH2xIIQI",
+        0, 0, 0, 8, LEB_SIZE, 4, 4, LEB_SIZE, 1, 1, 1, 1, 8, 256, 4, 0, 0, 0, 0, 1000000000,
+    )
+    p += bytes(range(16))  # uuid
+    p += struct.pack("<I", 0) + bytes(64) + bytes(64) + struct.pack("<H", 0) + bytes(64)
+    return node(6, p + bytes(4096 - 24 - len(p)))
+
+
+def mst_node():
+    p = struct.pack(
+        "<QQIIIIIIIIQQQQQQIIIIIIIIIIII",
+        65, 1, 1, 3, 3, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 4,
+    )
+    p += bytes(64 * 3)
+    return node(7, p + bytes(512 - 24 - len(p)))
+
+
+def ino_node(inum, mode, size, nlink):
+    p = key(inum, 0)
+    p += struct.pack("<QQQQQIIIIIIIIIII4xIH26x", 1, size, MTIME, MTIME, MTIME, 0, 0, 0, nlink, 0, 0, mode, 0, 0, 0, 0, 0, 0)
+    return node(0, p)
+
+
+def dent_node(parent, inum, typ, name):
+    p = key(parent, 2, 0x1234)
+    p += struct.pack("<QBBHI", inum, 0, typ, len(name), 0) + name + b"\0"
+    return node(2, p)
+
+
+def data_node(inum, block, data):
+    p = key(inum, 1, block) + struct.pack("<IHH", len(data), 0, 0) + data
+    return node(1, p)
+
+
+def pad_node(pad_len):
+    return node(5, struct.pack("<I", pad_len)) + bytes(pad_len)
+
+
+hello = b"hello ubifs\n"
+journal = b"".join(
+    align8(n)
+    for n in [
+        ino_node(1, 0o40755, 160, 2),
+        dent_node(1, 65, 0, b"hello.txt"),
+        ino_node(65, 0o100644, len(hello), 1),
+        data_node(65, 0, hello),
+    ]
+)
+journal += pad_node(64 - 28)
+
+lebs = [sb_node(), mst_node(), mst_node(), journal]
+
+vtbl = volume_table()
+pebs = [
+    peb(1, vid_header(LAYOUT_VOLUME_ID, 0, 1), vtbl),
+    peb(1, vid_header(LAYOUT_VOLUME_ID, 1, 2), vtbl),
+]
+for lnum, leb in enumerate(lebs):
+    pebs.append(peb(1, vid_header(0, lnum, 3 + lnum), leb))
+pebs.append(peb(0))
+
+(here / "test.ubi").write_bytes(b"".join(pebs))
+(here / "test.ubifs").write_bytes(b"".join(leb + b"\xff" * (LEB_SIZE - len(leb)) for leb in lebs))
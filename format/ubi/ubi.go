@@ -0,0 +1,219 @@
+package ubi
+
+// https://github.com/torvalds/linux/blob/master/drivers/mtd/ubi/ubi-media.h
+// http://www.linux-mtd.infradead.org/doc/ubi.html
+
+import (
+	"embed"
+	"hash/crc32"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed ubi.md
+var ubiFS embed.FS
+
+var ubifsGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.UBI,
+		&decode.Format{
+			Description: "Unsorted Block Images",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeUBI,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.UBIFS}, Out: &ubifsGroup},
+			},
+		})
+	interp.RegisterFS(ubiFS)
+}
+
+const (
+	ecHeaderMagic  = "UBI#"
+	vidHeaderMagic = "UBI!"
+	ecHeaderSize   = 64
+	vidHeaderSize  = 64
+)
+
+const (
+	layoutVolumeID      = 0x7fffefff
+	volumeTableRecords  = 128
+	volumeTableRecordSz = 172
+)
+
+var dataMagicNames = scalar.UintMapSymStr{
+	ubifsMagicBE: "ubifs",
+}
+
+var volumeTypeNames = scalar.UintMapSymStr{
+	1: "dynamic",
+	2: "static",
+}
+
+var compatNames = scalar.UintMapSymStr{
+	0: "none",
+	1: "delete",
+	2: "read_only",
+	4: "preserve",
+	5: "reject",
+}
+
+var volumeIDNames = scalar.UintMapSymStr{
+	layoutVolumeID: "layout",
+}
+
+// UBI uses crc32 with initial value 0xffffffff and no final xor
+func ubiCRC32(b []byte) uint64 {
+	return uint64(crc32.ChecksumIEEE(b) ^ 0xffffffff)
+}
+
+func isErased(b []byte) bool {
+	for _, v := range b {
+		if v != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// PEB size is not stored so look for next erase counter header at power of two offsets
+func findPEBSize(d *decode.D, dataOffset int64) int64 {
+	fileLen := d.Len() / 8
+	for size := int64(1024); size < fileLen; size *= 2 {
+		if size <= dataOffset {
+			continue
+		}
+		if string(d.BytesRange(size*8, len(ecHeaderMagic))) == ecHeaderMagic {
+			return size
+		}
+	}
+	return fileLen
+}
+
+func decodeECHeader(d *decode.D) (vidHeaderOffset int64, dataOffset int64) {
+	start := d.Pos()
+	d.FieldUTF8("magic", 4, d.StrAssert(ecHeaderMagic))
+	d.FieldU8("version")
+	d.FieldRawLen("padding1", 3*8)
+	d.FieldU64("erase_counter")
+	vidHeaderOffset = int64(d.FieldU32("vid_header_offset"))
+	dataOffset = int64(d.FieldU32("data_offset"))
+	d.FieldU32("image_seq", scalar.UintHex)
+	d.FieldRawLen("padding2", 32*8)
+	d.FieldU32("header_crc", d.UintValidate(ubiCRC32(d.BytesRange(start, ecHeaderSize-4))), scalar.UintHex)
+	return vidHeaderOffset, dataOffset
+}
+
+type vidHeader struct {
+	volumeID uint64
+	dataPad  uint64
+}
+
+func decodeVIDHeader(d *decode.D) vidHeader {
+	var vh vidHeader
+	start := d.Pos()
+	d.FieldUTF8("magic", 4, d.StrAssert(vidHeaderMagic))
+	d.FieldU8("version")
+	d.FieldU8("volume_type", volumeTypeNames)
+	d.FieldU8("copy_flag")
+	d.FieldU8("compat", compatNames)
+	vh.volumeID = d.FieldU32("volume_id", volumeIDNames)
+	d.FieldU32("lnum")
+	d.FieldRawLen("padding1", 4*8)
+	d.FieldU32("data_size")
+	d.FieldU32("used_ebs")
+	vh.dataPad = d.FieldU32("data_pad")
+	d.FieldU32("data_crc", scalar.UintHex)
+	d.FieldRawLen("padding2", 4*8)
+	d.FieldU64("sqnum")
+	d.FieldRawLen("padding3", 12*8)
+	d.FieldU32("header_crc", d.UintValidate(ubiCRC32(d.BytesRange(start, vidHeaderSize-4))), scalar.UintHex)
+	return vh
+}
+
+func decodeVolumeTable(d *decode.D) {
+	d.FieldArray("volume_table", func(d *decode.D) {
+		for i := 0; i < volumeTableRecords && d.BitsLeft() >= volumeTableRecordSz*8; i++ {
+			// skip unused records, they are all zero except crc
+			if d.PeekUintBits(32) == 0 {
+				d.SeekRel(volumeTableRecordSz * 8)
+				continue
+			}
+			d.FieldStruct("record", func(d *decode.D) {
+				start := d.Pos()
+				d.FieldValueUint("volume_id", uint64(i))
+				d.FieldU32("reserved_pebs")
+				d.FieldU32("alignment")
+				d.FieldU32("data_pad")
+				d.FieldU8("volume_type", volumeTypeNames)
+				d.FieldU8("update_marker")
+				nameLen := d.FieldU16("name_len")
+				if nameLen > 127 {
+					d.Fatalf("name too long %d", nameLen)
+				}
+				d.FieldUTF8NullFixedLen("name", 128)
+				d.FieldU8("flags")
+				d.FieldRawLen("padding", 23*8)
+				d.FieldU32("crc", d.UintValidate(ubiCRC32(d.BytesRange(start, volumeTableRecordSz-4))), scalar.UintHex)
+			})
+		}
+	})
+}
+
+func decodePEB(d *decode.D) {
+	var vidHeaderOffset, dataOffset int64
+	d.FieldStruct("ec_header", func(d *decode.D) { vidHeaderOffset, dataOffset = decodeECHeader(d) })
+	pebStart := d.Pos() - ecHeaderSize*8
+	if vidHeaderOffset < ecHeaderSize || dataOffset < vidHeaderOffset+vidHeaderSize || pebStart+dataOffset*8 > d.Len() {
+		d.Fatalf("invalid header offsets")
+	}
+
+	// PEB without volume identifier header is unused
+	if isErased(d.BytesRange(pebStart+vidHeaderOffset*8, vidHeaderSize)) {
+		return
+	}
+	var vh vidHeader
+	d.SeekAbs(pebStart + vidHeaderOffset*8)
+	d.FieldStruct("vid_header", func(d *decode.D) { vh = decodeVIDHeader(d) })
+
+	d.SeekAbs(pebStart + dataOffset*8)
+	dataLen := d.BitsLeft() - int64(vh.dataPad)*8
+	if dataLen < 0 {
+		d.Fatalf("data pad larger than PEB")
+	}
+	d.FramedFn(dataLen, func(d *decode.D) {
+		switch {
+		case vh.volumeID == layoutVolumeID:
+			decodeVolumeTable(d)
+		case d.BitsLeft() >= 32 && d.PeekUintBits(32) == ubifsMagicBE:
+			d.FieldFormatOrRawLenTag("data", d.BitsLeft(), &ubifsGroup, nil, 32, dataMagicNames, scalar.UintHex)
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeUBI(d *decode.D) any {
+	d.Endian = decode.BigEndian
+
+	if string(d.PeekBytes(len(ecHeaderMagic))) != ecHeaderMagic {
+		d.Fatalf("no erase counter header magic")
+	}
+	var dataOffset int64
+	d.SeekAbs(20*8, func(d *decode.D) { dataOffset = int64(d.U32()) })
+	pebSize := findPEBSize(d, dataOffset)
+
+	d.FieldArray("pebs", func(d *decode.D) {
+		for !d.End() {
+			d.FramedFn(min(pebSize*8, d.BitsLeft()), func(d *decode.D) {
+				d.FieldStruct("peb", decodePEB)
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,295 @@
+package ubi
+
+// https://github.com/torvalds/linux/blob/master/fs/ubifs/ubifs-media.h
+// http://www.linux-mtd.infradead.org/doc/ubifs.html
+
+import (
+	"embed"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed ubifs.md
+var ubifsFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.UBIFS,
+		&decode.Format{
+			Description: "UBI file system",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeUBIFS,
+		})
+	interp.RegisterFS(ubifsFS)
+}
+
+const (
+	ubifsMagic   = 0x06101831
+	ubifsMagicBE = 0x31181006 // magic as big endian, used when peeking
+	// nodes are 8 byte aligned
+	ubifsAlign            = 8
+	ubifsCommonHeaderSize = 24
+)
+
+const (
+	nodeInode       = 0
+	nodeData        = 1
+	nodeDirEntry    = 2
+	nodeXattrEntry  = 3
+	nodeTruncation  = 4
+	nodePadding     = 5
+	nodeSuperblock  = 6
+	nodeMaster      = 7
+	nodeReference   = 8
+	nodeIndex       = 9
+	nodeCommitStart = 10
+	nodeOrphan      = 11
+	nodeAuth        = 12
+	nodeSignature   = 13
+)
+
+var nodeTypeNames = scalar.UintMapSymStr{
+	nodeInode:       "inode",
+	nodeData:        "data",
+	nodeDirEntry:    "dir_entry",
+	nodeXattrEntry:  "xattr_entry",
+	nodeTruncation:  "truncation",
+	nodePadding:     "padding",
+	nodeSuperblock:  "superblock",
+	nodeMaster:      "master",
+	nodeReference:   "reference",
+	nodeIndex:       "index",
+	nodeCommitStart: "commit_start",
+	nodeOrphan:      "orphan",
+	nodeAuth:        "auth",
+	nodeSignature:   "signature",
+}
+
+var groupTypeNames = scalar.UintMapSymStr{
+	0: "no_node_group",
+	1: "in_node_group",
+	2: "last_of_node_group",
+}
+
+var keyTypeNames = scalar.UintMapSymStr{
+	0: "inode",
+	1: "data",
+	2: "dir_entry",
+	3: "xattr_entry",
+}
+
+var comprTypeNames = scalar.UintMapSymStr{
+	0: "none",
+	1: "lzo",
+	2: "zlib",
+	3: "zstd",
+}
+
+var inodeTypeNames = scalar.UintMapSymStr{
+	0: "regular",
+	1: "directory",
+	2: "symlink",
+	3: "block_device",
+	4: "char_device",
+	5: "fifo",
+	6: "socket",
+}
+
+var keyHashNames = scalar.UintMapSymStr{
+	0: "r5",
+	1: "test",
+}
+
+// simple key format is inode number and a 32 bit value with key type in the top 3 bits
+func decodeKey(d *decode.D) {
+	d.FieldStruct("key", func(d *decode.D) {
+		d.FieldU32("inode_number")
+		v := d.FieldU32("value", scalar.UintHex)
+		d.FieldValueUint("type", v>>29, keyTypeNames)
+		d.FieldRawLen("unused", 8*8)
+	})
+}
+
+func decodeSuperblockNode(d *decode.D) {
+	d.FieldRawLen("padding", 2*8)
+	d.FieldU8("key_hash", keyHashNames)
+	d.FieldU8("key_format")
+	d.FieldU32("flags", scalar.UintHex)
+	d.FieldU32("min_io_size")
+	d.FieldU32("leb_size")
+	d.FieldU32("leb_count")
+	d.FieldU32("max_leb_count")
+	d.FieldU64("max_bud_bytes")
+	d.FieldU32("log_lebs")
+	d.FieldU32("lpt_lebs")
+	d.FieldU32("orphan_lebs")
+	d.FieldU32("journal_head_count")
+	d.FieldU32("fanout")
+	d.FieldU32("lsave_count")
+	d.FieldU32("format_version")
+	d.FieldU16("default_compression", comprTypeNames)
+	d.FieldRawLen("padding1", 2*8)
+	d.FieldU32("reserved_pool_uid")
+	d.FieldU32("reserved_pool_gid")
+	d.FieldU64("reserved_pool_size")
+	d.FieldU32("time_granularity")
+	d.FieldRawLen("uuid", 16*8)
+	d.FieldU32("ro_compat_version")
+	d.FieldRawLen("hmac", 64*8)
+	d.FieldRawLen("hmac_wkm", 64*8)
+	d.FieldU16("hash_algo")
+	d.FieldRawLen("hash_master", 64*8)
+	d.FieldRawLen("padding2", d.BitsLeft())
+}
+
+func decodeMasterNode(d *decode.D) {
+	d.FieldU64("highest_inode_number")
+	d.FieldU64("commit_number")
+	d.FieldU32("flags", scalar.UintHex)
+	d.FieldU32("log_lnum")
+	d.FieldU32("root_lnum")
+	d.FieldU32("root_offset")
+	d.FieldU32("root_len")
+	d.FieldU32("gc_lnum")
+	d.FieldU32("index_head_lnum")
+	d.FieldU32("index_head_offset")
+	d.FieldU64("index_size")
+	d.FieldU64("total_free")
+	d.FieldU64("total_dirty")
+	d.FieldU64("total_used")
+	d.FieldU64("total_dead")
+	d.FieldU64("total_dark")
+	d.FieldU32("lpt_lnum")
+	d.FieldU32("lpt_offset")
+	d.FieldU32("nhead_lnum")
+	d.FieldU32("nhead_offset")
+	d.FieldU32("ltab_lnum")
+	d.FieldU32("ltab_offset")
+	d.FieldU32("lsave_lnum")
+	d.FieldU32("lsave_offset")
+	d.FieldU32("lscan_lnum")
+	d.FieldU32("empty_lebs")
+	d.FieldU32("index_lebs")
+	d.FieldU32("leb_count")
+	d.FieldRawLen("hash_root_index", 64*8)
+	d.FieldRawLen("hash_lpt", 64*8)
+	d.FieldRawLen("hmac", 64*8)
+	d.FieldRawLen("padding", d.BitsLeft())
+}
+
+func decodeInodeNode(d *decode.D) {
+	decodeKey(d)
+	d.FieldU64("creation_sqnum")
+	d.FieldU64("size")
+	d.FieldU64("atime_sec", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+	d.FieldU64("ctime_sec", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+	d.FieldU64("mtime_sec", scalar.UintActualUnixTimeDescription(time.Second, time.RFC3339))
+	d.FieldU32("atime_nsec")
+	d.FieldU32("ctime_nsec")
+	d.FieldU32("mtime_nsec")
+	d.FieldU32("nlink")
+	d.FieldU32("uid")
+	d.FieldU32("gid")
+	d.FieldU32("mode", scalar.UintOct)
+	d.FieldU32("flags", scalar.UintHex)
+	dataLen := d.FieldU32("data_len")
+	d.FieldU32("xattr_count")
+	d.FieldU32("xattr_size")
+	d.FieldRawLen("padding1", 4*8)
+	d.FieldU32("xattr_names")
+	d.FieldU16("compression", comprTypeNames)
+	d.FieldRawLen("padding2", 26*8)
+	if dataLen > 0 {
+		d.FieldRawLen("data", int64(dataLen)*8)
+	}
+}
+
+func decodeNode(d *decode.D) {
+	var nodeType uint64
+	start := d.Pos()
+	// len is after magic, crc and sqnum
+	var nodeLen int64
+	d.SeekRel(16*8, func(d *decode.D) { nodeLen = int64(d.U32()) })
+	if nodeLen < ubifsCommonHeaderSize || start+nodeLen*8 > d.Len() {
+		d.Fatalf("invalid node length %d", nodeLen)
+	}
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU32("magic", d.UintAssert(ubifsMagic), scalar.UintHex)
+		// crc is of the node after magic and crc
+		d.FieldU32("crc", d.UintValidate(ubiCRC32(d.BytesRange(start+8*8, int(nodeLen)-8))), scalar.UintHex)
+		d.FieldU64("sqnum")
+		d.FieldU32("len")
+		nodeType = d.FieldU8("node_type", nodeTypeNames)
+		d.FieldU8("group_type", groupTypeNames)
+		d.FieldRawLen("padding", 2*8)
+	})
+
+	d.FramedFn(start+nodeLen*8-d.Pos(), func(d *decode.D) {
+		switch nodeType {
+		case nodeSuperblock:
+			decodeSuperblockNode(d)
+		case nodeMaster:
+			decodeMasterNode(d)
+		case nodeInode:
+			decodeInodeNode(d)
+		case nodeData:
+			decodeKey(d)
+			d.FieldU32("size")
+			d.FieldU16("compression", comprTypeNames)
+			d.FieldU16("compressed_size")
+		case nodeDirEntry, nodeXattrEntry:
+			decodeKey(d)
+			d.FieldU64("inode_number")
+			d.FieldU8("padding1")
+			d.FieldU8("type", inodeTypeNames)
+			nameLen := d.FieldU16("name_len")
+			d.FieldU32("cookie", scalar.UintHex)
+			d.FieldUTF8("name", int(nameLen))
+			d.FieldU8("null")
+		case nodeReference:
+			d.FieldU32("lnum")
+			d.FieldU32("offset")
+			d.FieldU32("journal_head")
+		case nodePadding:
+			d.FieldU32("pad_len")
+		case nodeCommitStart:
+			d.FieldU64("commit_number")
+		}
+		if !d.End() {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeUBIFS(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	if d.PeekUintBits(32) != ubifsMagicBE {
+		d.Fatalf("no node magic")
+	}
+
+	d.FieldArray("nodes", func(d *decode.D) {
+		for !d.End() {
+			if d.BitsLeft() < ubifsCommonHeaderSize*8 || d.PeekUintBits(32) != ubifsMagicBE {
+				// unused space is erased, look for next node
+				n, _, err := d.TryPeekFind(32, ubifsAlign*8, -1, func(v uint64) bool { return v == ubifsMagic })
+				if err != nil || n == -1 {
+					d.FieldRawLen("unused", d.BitsLeft())
+					break
+				}
+				d.FieldRawLen("unused", n)
+			}
+			d.FieldStruct("node", decodeNode)
+			if padding := min(int64(d.AlignBits(ubifsAlign*8)), d.BitsLeft()); padding > 0 {
+				d.FieldRawLen("padding", padding)
+			}
+		}
+	})
+
+	return nil
+}
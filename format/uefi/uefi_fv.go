@@ -0,0 +1,444 @@
+package uefi
+
+// https://uefi.org/specs/PI/1.8/V3_Design_Discussion.html
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed uefi_fv.md
+var uefiFS embed.FS
+
+var probeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.UEFI_FV,
+		&decode.Format{
+			Description: "UEFI firmware volume",
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    decodeUEFIFV,
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(uefiFS)
+}
+
+const (
+	fvHeaderMinLen    = 56
+	fvSignatureOffset = 40
+)
+
+var fvSignature = []byte("_FVH")
+
+// GUIDs are stored with the first three fields little endian
+func guidString(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)
+}
+
+var rawGUID = scalar.BitBufFn(func(s scalar.BitBuf) (scalar.BitBuf, error) {
+	return scalar.RawSym(s, -1, guidString)
+})
+
+type guidMapDescription map[string]string
+
+func (m guidMapDescription) MapBitBuf(s scalar.BitBuf) (scalar.BitBuf, error) {
+	if g, ok := s.Sym.(string); ok {
+		s.Description = m[g]
+	}
+	return s, nil
+}
+
+const (
+	guidCapsule              = "3b6686bd-0d76-4030-b70e-b5519e2fc5a0"
+	guidFMPCapsule           = "6dcbd5ed-e82d-4c44-bda1-7194199ad92a"
+	guidLZMACustomDecompress = "ee4e5898-3914-4259-9d6e-dc7bd79403cf"
+)
+
+var guidNames = guidMapDescription{
+	"7a9354d9-0468-444a-81ce-0bf617d890df": "firmware_file_system",
+	"8c8ce578-8a3d-4f1c-9935-896185c32dd3": "firmware_file_system2",
+	"5473c07a-3dcb-4dca-bd6f-1e9689e7349a": "firmware_file_system3",
+	"fff12b8d-7696-4c8b-a985-2747075b4f50": "system_nv_data_fv",
+	guidCapsule:                            "capsule",
+	guidFMPCapsule:                         "fmp_capsule",
+	"1ba0062e-c779-4582-8566-336ae8f78f09": "volume_top_file",
+	"7bb28b99-61bb-11d5-9a5d-0090273fc14d": "default_bmp_logo",
+	guidLZMACustomDecompress:               "lzma_custom_decompress",
+	"a31280ad-481e-41b6-95e8-127f4c984779": "tiano_custom_decompress",
+	"3d532050-5cda-4fd0-879e-0f7f630d5afb": "brotli_custom_decompress",
+	"fc1bcdb0-7d31-49aa-936a-a4600d9dd083": "crc32_guided_section_extraction",
+}
+
+func fieldGUID(d *decode.D, name string) string {
+	v := d.FieldScalarRawLen(name, 16*8, rawGUID, guidNames)
+	s, _ := v.Sym.(string)
+	return s
+}
+
+const (
+	fileTypeRaw = 0x01
+	fileTypePad = 0xf0
+)
+
+var fileTypeNames = scalar.UintMapSymStr{
+	0x01: "raw",
+	0x02: "freeform",
+	0x03: "security_core",
+	0x04: "pei_core",
+	0x05: "dxe_core",
+	0x06: "peim",
+	0x07: "driver",
+	0x08: "combined_peim_driver",
+	0x09: "application",
+	0x0a: "mm",
+	0x0b: "firmware_volume_image",
+	0x0c: "combined_mm_dxe",
+	0x0d: "mm_core",
+	0x0e: "mm_standalone",
+	0x0f: "mm_core_standalone",
+	0xf0: "ffs_pad",
+}
+
+const (
+	sectionTypeCompression         = 0x01
+	sectionTypeGUIDDefined         = 0x02
+	sectionTypeDisposable          = 0x03
+	sectionTypePE32                = 0x10
+	sectionTypePIC                 = 0x11
+	sectionTypeTE                  = 0x12
+	sectionTypeDXEDepex            = 0x13
+	sectionTypeVersion             = 0x14
+	sectionTypeUserInterface       = 0x15
+	sectionTypeCompatibility16     = 0x16
+	sectionTypeFirmwareVolumeImage = 0x17
+	sectionTypeFreeformSubtypeGUID = 0x18
+	sectionTypeRaw                 = 0x19
+	sectionTypePEIDepex            = 0x1b
+	sectionTypeMMDepex             = 0x1c
+)
+
+var sectionTypeNames = scalar.UintMapSymStr{
+	sectionTypeCompression:         "compression",
+	sectionTypeGUIDDefined:         "guid_defined",
+	sectionTypeDisposable:          "disposable",
+	sectionTypePE32:                "pe32",
+	sectionTypePIC:                 "pic",
+	sectionTypeTE:                  "te",
+	sectionTypeDXEDepex:            "dxe_depex",
+	sectionTypeVersion:             "version",
+	sectionTypeUserInterface:       "user_interface",
+	sectionTypeCompatibility16:     "compatibility16",
+	sectionTypeFirmwareVolumeImage: "firmware_volume_image",
+	sectionTypeFreeformSubtypeGUID: "freeform_subtype_guid",
+	sectionTypeRaw:                 "raw",
+	sectionTypePEIDepex:            "pei_depex",
+	sectionTypeMMDepex:             "mm_depex",
+}
+
+var compressionTypeNames = scalar.UintMapSymStr{
+	0: "not_compressed",
+	1: "standard",
+}
+
+// sum of uint16 values that makes header sum to zero
+func checksum16(bs []byte, checksumIndex int) uint64 {
+	var sum uint16
+	for i := 0; i+1 < len(bs); i += 2 {
+		if i != checksumIndex {
+			sum += binary.LittleEndian.Uint16(bs[i:])
+		}
+	}
+	return uint64(-sum)
+}
+
+// sum of bytes that makes all bytes sum to zero, skipped indexes are treated as zero
+func checksum8(bs []byte, skipIndexes ...int) uint64 {
+	var sum byte
+	for i, b := range bs {
+		skip := false
+		for _, si := range skipIndexes {
+			if i == si {
+				skip = true
+			}
+		}
+		if !skip {
+			sum += b
+		}
+	}
+	return uint64(-sum)
+}
+
+func fieldPadding(d *decode.D, start int64, align int64) {
+	if n := (align - ((d.Pos()-start)/8)%align) % align; n > 0 && n*8 <= d.BitsLeft() {
+		d.FieldRawLen("padding", n*8)
+	}
+}
+
+// data that might be a known format, ex: logo images or nested blobs
+func fieldProbeData(d *decode.D, name string, nBits int64) {
+	d.FieldFormatOrRawLen(name, nBits, &probeGroup, format.Probe_In{})
+}
+
+func decodeSections(d *decode.D) {
+	start := d.Pos()
+	d.FieldArray("sections", func(d *decode.D) {
+		for {
+			fieldPadding(d, start, 4)
+			if d.BitsLeft() < 4*8 {
+				break
+			}
+			d.FieldStruct("section", decodeSection)
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+func decodeSection(d *decode.D) {
+	start := d.Pos()
+	size := d.FieldU24("size")
+	typ := d.FieldU8("type", sectionTypeNames)
+	if size == 0xffffff {
+		size = d.FieldU32("extended_size")
+	}
+	headerLen := (d.Pos() - start) / 8
+	if int64(size) < headerLen {
+		d.Fatalf("section size %d is less than header size %d", size, headerLen)
+	}
+
+	d.FramedFn((int64(size)-headerLen)*8, func(d *decode.D) {
+		switch typ {
+		case sectionTypeCompression:
+			d.FieldU32("uncompressed_length")
+			compressionType := d.FieldU8("compression_type", compressionTypeNames)
+			if compressionType == 0 {
+				decodeSections(d)
+			} else {
+				d.FieldRawLen("compressed", d.BitsLeft())
+			}
+		case sectionTypeGUIDDefined:
+			guid := fieldGUID(d, "section_definition_guid")
+			dataOffset := int64(d.FieldU16("data_offset"))
+			attributes := d.FieldU16("attributes", scalar.UintHex)
+			if n := dataOffset - (d.Pos()-start)/8; n > 0 {
+				d.FieldRawLen("header_data", n*8)
+			}
+			// processing required means the data is encoded somehow, ex: compressed
+			if attributes&0x1 == 0 {
+				decodeSections(d)
+			} else {
+				if guid == guidLZMACustomDecompress {
+					d.FieldRawLen("compressed", d.BitsLeft())
+				} else {
+					d.FieldRawLen("data", d.BitsLeft())
+				}
+			}
+		case sectionTypeUserInterface:
+			d.FieldUTF16LENull("file_name")
+		case sectionTypeVersion:
+			d.FieldU16("build_number")
+			d.FieldUTF16LENull("version_string")
+		case sectionTypeFirmwareVolumeImage:
+			d.FieldStruct("volume", decodeVolume)
+		case sectionTypeFreeformSubtypeGUID:
+			fieldGUID(d, "sub_type_guid")
+			fieldProbeData(d, "data", d.BitsLeft())
+		case sectionTypeRaw,
+			sectionTypePE32,
+			sectionTypePIC,
+			sectionTypeTE,
+			sectionTypeCompatibility16:
+			fieldProbeData(d, "data", d.BitsLeft())
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeFile(d *decode.D) {
+	headerBytes := d.PeekBytes(min(32, int(d.BitsLeft()/8)))
+	start := d.Pos()
+	fieldGUID(d, "name")
+	headerChecksumValue := d.FieldScalarU8("header_checksum", scalar.UintHex)
+	d.FieldU8("file_checksum", scalar.UintHex)
+	typ := d.FieldU8("type", fileTypeNames)
+	attributes := d.FieldU8("attributes", scalar.UintHex)
+	size := d.FieldU24("size")
+	d.FieldU8("state", scalar.UintHex)
+	// large file attribute
+	if attributes&0x1 != 0 {
+		size = d.FieldU64("extended_size")
+	}
+	headerLen := (d.Pos() - start) / 8
+	if int64(size) < headerLen {
+		d.Fatalf("file size %d is less than header size %d", size, headerLen)
+	}
+	// header checksum is calculated with file checksum and state as zero
+	expected := checksum8(headerBytes[0:headerLen], 0x10, 0x11, 0x17)
+	if headerChecksumValue.Actual == expected {
+		headerChecksumValue.Description = "valid"
+	} else {
+		headerChecksumValue.Description = "invalid"
+	}
+	d.Constraint(headerChecksumValue.Actual == expected, "header_checksum 0x%x == 0x%x", headerChecksumValue.Actual, expected)
+
+	d.FramedFn((int64(size)-headerLen)*8, func(d *decode.D) {
+		switch typ {
+		case fileTypeRaw:
+			fieldProbeData(d, "data", d.BitsLeft())
+		case fileTypePad:
+			d.FieldRawLen("data", d.BitsLeft())
+		default:
+			decodeSections(d)
+		}
+	})
+}
+
+func decodeVolume(d *decode.D) {
+	start := d.Pos()
+	headerLen := int64(binary.LittleEndian.Uint16(d.PeekBytes(fvHeaderMinLen)[48:]))
+	if headerLen < fvHeaderMinLen || headerLen*8 > d.BitsLeft() {
+		d.Fatalf("invalid header length %d", headerLen)
+	}
+	headerBytes := d.PeekBytes(int(headerLen))
+
+	var fvLength uint64
+	var extHeaderOffset int64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldRawLen("zero_vector", 16*8)
+		fieldGUID(d, "file_system_guid")
+		fvLength = d.FieldU64("fv_length")
+		d.FieldUTF8("signature", 4, d.StrAssert(string(fvSignature)))
+		d.FieldU32("attributes", scalar.UintHex)
+		d.FieldU16("header_length")
+		expected := checksum16(headerBytes, 50)
+		checksum := d.FieldU16("checksum", d.UintValidate(expected), scalar.UintHex)
+		d.Constraint(checksum == expected, "checksum 0x%x == 0x%x", checksum, expected)
+		extHeaderOffset = int64(d.FieldU16("ext_header_offset"))
+		d.FieldU8("reserved")
+		d.FieldU8("revision")
+		d.FieldArray("block_map", func(d *decode.D) {
+			for {
+				var numBlocks, length uint64
+				d.FieldStruct("block", func(d *decode.D) {
+					numBlocks = d.FieldU32("num_blocks")
+					length = d.FieldU32("length")
+				})
+				if numBlocks == 0 && length == 0 {
+					break
+				}
+			}
+		})
+	})
+	if fvLength*8 > uint64(d.BitsLeft()+(d.Pos()-start)) {
+		d.Fatalf("fv_length %d larger than input", fvLength)
+	}
+
+	d.FramedFn(int64(fvLength)*8-(d.Pos()-start), func(d *decode.D) {
+		if extHeaderOffset != 0 {
+			d.SeekAbs(start + extHeaderOffset*8)
+			d.FieldStruct("ext_header", func(d *decode.D) {
+				fieldGUID(d, "fv_name")
+				extHeaderSize := int64(d.FieldU32("ext_header_size"))
+				if extHeaderSize > 20 {
+					d.FieldRawLen("entries", (extHeaderSize-20)*8)
+				}
+			})
+		}
+
+		d.FieldArray("files", func(d *decode.D) {
+			for {
+				fieldPadding(d, start, 8)
+				if d.BitsLeft() < 24*8 {
+					break
+				}
+				// erased flash is all ones, pad files can have all ones name so check whole header
+				if bytes.Equal(d.PeekBytes(24), bytes.Repeat([]byte{0xff}, 24)) {
+					break
+				}
+				d.FieldStruct("file", decodeFile)
+			}
+		})
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("free_space", d.BitsLeft())
+		}
+	})
+}
+
+// firmware volume header signature positions aligned to 16 bytes
+func findVolumes(bs []byte) []int64 {
+	var offsets []int64
+	for i := fvSignatureOffset; i+4 <= len(bs); {
+		j := bytes.Index(bs[i:], fvSignature)
+		if j == -1 {
+			break
+		}
+		pos := i + j - fvSignatureOffset
+		if pos%16 == 0 && pos+fvHeaderMinLen <= len(bs) {
+			fvLength := binary.LittleEndian.Uint64(bs[pos+32:])
+			if fvLength >= fvHeaderMinLen && fvLength <= uint64(len(bs)-pos) {
+				offsets = append(offsets, int64(pos))
+				i = pos + int(fvLength) + fvSignatureOffset
+				continue
+			}
+		}
+		i += j + 1
+	}
+	return offsets
+}
+
+func decodeUEFIFV(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	var pi format.Probe_In
+	isProbe := d.ArgAs(&pi)
+	if isProbe && !bytes.Equal(d.PeekBytes(fvSignatureOffset + 4)[fvSignatureOffset:], fvSignature) {
+		d.Fatalf("no firmware volume signature found")
+	}
+
+	if g := guidString(d.PeekBytes(16)); g == guidCapsule || g == guidFMPCapsule {
+		d.FieldStruct("capsule_header", func(d *decode.D) {
+			fieldGUID(d, "capsule_guid")
+			headerSize := int64(d.FieldU32("header_size"))
+			d.FieldU32("flags", scalar.UintHex)
+			d.FieldU32("capsule_image_size")
+			if n := headerSize - 28; n > 0 {
+				d.FieldRawLen("header_data", n*8)
+			}
+		})
+	}
+
+	// volumes can be anywhere in flash images and capsules
+	start := d.Pos()
+	offsets := findVolumes(d.PeekBytes(int(d.BitsLeft() / 8)))
+	if len(offsets) == 0 {
+		d.Fatalf("no firmware volume found")
+	}
+
+	d.FieldArray("volumes", func(d *decode.D) {
+		for _, o := range offsets {
+			d.SeekAbs(start + o*8)
+			d.FieldStruct("volume", decodeVolume)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,537 @@
+package usb
+
+// https://www.usb.org/document-library/device-class-definition-hid-111
+// https://www.usb.org/document-library/hid-usage-tables-15
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed hid_report_desc.md
+var hidReportDescFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.HID_Report_Desc,
+		&decode.Format{
+			Description: "USB HID report descriptor",
+			DecodeFn:    decodeHIDReportDesc,
+			RootArray:   true,
+			RootName:    "items",
+		})
+	interp.RegisterFS(hidReportDescFS)
+}
+
+const (
+	itemTypeMain     = 0
+	itemTypeGlobal   = 1
+	itemTypeLocal    = 2
+	itemTypeReserved = 3
+)
+
+var itemTypeNames = scalar.UintMapSymStr{
+	itemTypeMain:     "main",
+	itemTypeGlobal:   "global",
+	itemTypeLocal:    "local",
+	itemTypeReserved: "reserved",
+}
+
+const longItemPrefix = 0xfe
+
+const (
+	mainTagInput         = 0x8
+	mainTagOutput        = 0x9
+	mainTagCollection    = 0xa
+	mainTagFeature       = 0xb
+	mainTagEndCollection = 0xc
+)
+
+const (
+	globalTagUsagePage       = 0x0
+	globalTagLogicalMinimum  = 0x1
+	globalTagLogicalMaximum  = 0x2
+	globalTagPhysicalMinimum = 0x3
+	globalTagPhysicalMaximum = 0x4
+	globalTagUnitExponent    = 0x5
+	globalTagUnit            = 0x6
+	globalTagPush            = 0xa
+	globalTagPop             = 0xb
+)
+
+const (
+	localTagUsage        = 0x0
+	localTagUsageMinimum = 0x1
+	localTagUsageMaximum = 0x2
+	localTagDelimiter    = 0xa
+)
+
+var tagNames = map[uint64]scalar.UintMapSymStr{
+	itemTypeMain: {
+		mainTagInput:         "input",
+		mainTagOutput:        "output",
+		mainTagCollection:    "collection",
+		mainTagFeature:       "feature",
+		mainTagEndCollection: "end_collection",
+	},
+	itemTypeGlobal: {
+		globalTagUsagePage:       "usage_page",
+		globalTagLogicalMinimum:  "logical_minimum",
+		globalTagLogicalMaximum:  "logical_maximum",
+		globalTagPhysicalMinimum: "physical_minimum",
+		globalTagPhysicalMaximum: "physical_maximum",
+		globalTagUnitExponent:    "unit_exponent",
+		globalTagUnit:            "unit",
+		0x7:                      "report_size",
+		0x8:                      "report_id",
+		0x9:                      "report_count",
+		globalTagPush:            "push",
+		globalTagPop:             "pop",
+	},
+	itemTypeLocal: {
+		localTagUsage:        "usage",
+		localTagUsageMinimum: "usage_minimum",
+		localTagUsageMaximum: "usage_maximum",
+		0x3:                  "designator_index",
+		0x4:                  "designator_minimum",
+		0x5:                  "designator_maximum",
+		0x7:                  "string_index",
+		0x8:                  "string_minimum",
+		0x9:                  "string_maximum",
+		localTagDelimiter:    "delimiter",
+	},
+}
+
+var itemSizeBytes = [4]int{0, 1, 2, 4}
+
+var collectionTypeNames = scalar.UintMapSymStr{
+	0x00: "physical",
+	0x01: "application",
+	0x02: "logical",
+	0x03: "report",
+	0x04: "named_array",
+	0x05: "usage_switch",
+	0x06: "usage_modifier",
+}
+
+var delimiterNames = scalar.UintMapSymStr{
+	0: "close",
+	1: "open",
+}
+
+const (
+	usagePageGenericDesktop = 0x01
+	usagePageKeyboard       = 0x07
+	usagePageLED            = 0x08
+	usagePageButton         = 0x09
+	usagePageOrdinal        = 0x0a
+	usagePageConsumer       = 0x0c
+	usagePageDigitizers     = 0x0d
+	usagePageFIDO           = 0xf1d0
+)
+
+var usagePageNames = scalar.UintMapSymStr{
+	usagePageGenericDesktop: "generic_desktop",
+	0x02:                    "simulation_controls",
+	0x03:                    "vr_controls",
+	0x04:                    "sport_controls",
+	0x05:                    "game_controls",
+	0x06:                    "generic_device_controls",
+	usagePageKeyboard:       "keyboard",
+	usagePageLED:            "led",
+	usagePageButton:         "button",
+	usagePageOrdinal:        "ordinal",
+	0x0b:                    "telephony_device",
+	usagePageConsumer:       "consumer",
+	usagePageDigitizers:     "digitizers",
+	0x0e:                    "haptics",
+	0x0f:                    "physical_input_device",
+	0x10:                    "unicode",
+	0x11:                    "soc",
+	0x12:                    "eye_and_head_trackers",
+	0x14:                    "auxiliary_display",
+	0x20:                    "sensors",
+	0x40:                    "medical_instrument",
+	0x41:                    "braille_display",
+	0x59:                    "lighting_and_illumination",
+	0x80:                    "monitor",
+	0x81:                    "monitor_enumerated",
+	0x82:                    "vesa_virtual_controls",
+	0x84:                    "power",
+	0x85:                    "battery_system",
+	0x8c:                    "barcode_scanner",
+	0x8d:                    "scales",
+	0x8e:                    "magnetic_stripe_reader",
+	0x90:                    "camera_control",
+	0x91:                    "arcade",
+	0x92:                    "gaming_device",
+	usagePageFIDO:           "fido_alliance",
+}
+
+// 0xff00-0xffff are vendor defined
+var usagePageMapper = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	if s.Actual >= 0xff00 && s.Actual <= 0xffff {
+		s.Sym = "vendor_defined"
+		return s, nil
+	}
+	return usagePageNames.MapUint(s)
+})
+
+var keyboardUsageNames = func() scalar.UintMapSymStr {
+	m := scalar.UintMapSymStr{
+		0x00: "reserved",
+		0x01: "error_roll_over",
+		0x02: "post_fail",
+		0x03: "error_undefined",
+		0x28: "enter",
+		0x29: "escape",
+		0x2a: "backspace",
+		0x2b: "tab",
+		0x2c: "space",
+		0x2d: "minus",
+		0x2e: "equal",
+		0x2f: "left_bracket",
+		0x30: "right_bracket",
+		0x31: "backslash",
+		0x32: "non_us_hash",
+		0x33: "semicolon",
+		0x34: "apostrophe",
+		0x35: "grave_accent",
+		0x36: "comma",
+		0x37: "period",
+		0x38: "slash",
+		0x39: "caps_lock",
+		0x46: "print_screen",
+		0x47: "scroll_lock",
+		0x48: "pause",
+		0x49: "insert",
+		0x4a: "home",
+		0x4b: "page_up",
+		0x4c: "delete",
+		0x4d: "end",
+		0x4e: "page_down",
+		0x4f: "right_arrow",
+		0x50: "left_arrow",
+		0x51: "down_arrow",
+		0x52: "up_arrow",
+		0x53: "num_lock",
+		0x65: "application",
+		0x66: "power",
+		0xe0: "left_control",
+		0xe1: "left_shift",
+		0xe2: "left_alt",
+		0xe3: "left_gui",
+		0xe4: "right_control",
+		0xe5: "right_shift",
+		0xe6: "right_alt",
+		0xe7: "right_gui",
+	}
+	for i := uint64(0); i < 26; i++ {
+		m[0x04+i] = string(rune('a' + i))
+	}
+	for i := uint64(0); i < 10; i++ {
+		m[0x1e+i] = fmt.Sprintf("%d", (i+1)%10)
+	}
+	for i := uint64(0); i < 12; i++ {
+		m[0x3a+i] = fmt.Sprintf("f%d", i+1)
+	}
+	return m
+}()
+
+var usageNames = map[uint64]scalar.UintMapSymStr{
+	usagePageGenericDesktop: {
+		0x01: "pointer",
+		0x02: "mouse",
+		0x04: "joystick",
+		0x05: "gamepad",
+		0x06: "keyboard",
+		0x07: "keypad",
+		0x08: "multi_axis_controller",
+		0x09: "tablet_pc_system_controls",
+		0x0a: "water_cooling_device",
+		0x0b: "computer_chassis_device",
+		0x0c: "wireless_radio_controls",
+		0x0d: "portable_device_control",
+		0x0e: "system_multi_axis_controller",
+		0x0f: "spatial_controller",
+		0x10: "assistive_control",
+		0x30: "x",
+		0x31: "y",
+		0x32: "z",
+		0x33: "rx",
+		0x34: "ry",
+		0x35: "rz",
+		0x36: "slider",
+		0x37: "dial",
+		0x38: "wheel",
+		0x39: "hat_switch",
+		0x3a: "counted_buffer",
+		0x3b: "byte_count",
+		0x3c: "motion_wakeup",
+		0x3d: "start",
+		0x3e: "select",
+		0x40: "vx",
+		0x41: "vy",
+		0x42: "vz",
+		0x43: "vbrx",
+		0x44: "vbry",
+		0x45: "vbrz",
+		0x46: "vno",
+		0x47: "feature_notification",
+		0x48: "resolution_multiplier",
+		0x80: "system_control",
+		0x81: "system_power_down",
+		0x82: "system_sleep",
+		0x83: "system_wake_up",
+		0x84: "system_context_menu",
+		0x85: "system_main_menu",
+		0x86: "system_app_menu",
+		0x90: "dpad_up",
+		0x91: "dpad_down",
+		0x92: "dpad_right",
+		0x93: "dpad_left",
+	},
+	usagePageKeyboard: keyboardUsageNames,
+	usagePageLED: {
+		0x01: "num_lock",
+		0x02: "caps_lock",
+		0x03: "scroll_lock",
+		0x04: "compose",
+		0x05: "kana",
+		0x06: "power",
+		0x07: "shift",
+	},
+	usagePageConsumer: {
+		0x01:  "consumer_control",
+		0x02:  "numeric_key_pad",
+		0x30:  "power",
+		0x31:  "reset",
+		0x32:  "sleep",
+		0x40:  "menu",
+		0x6f:  "display_brightness_increment",
+		0x70:  "display_brightness_decrement",
+		0xb0:  "play",
+		0xb1:  "pause",
+		0xb2:  "record",
+		0xb3:  "fast_forward",
+		0xb4:  "rewind",
+		0xb5:  "scan_next_track",
+		0xb6:  "scan_previous_track",
+		0xb7:  "stop",
+		0xb8:  "eject",
+		0xcd:  "play_pause",
+		0xe0:  "volume",
+		0xe2:  "mute",
+		0xe9:  "volume_increment",
+		0xea:  "volume_decrement",
+		0x183: "al_consumer_control_configuration",
+		0x18a: "al_email_reader",
+		0x192: "al_calculator",
+		0x194: "al_local_machine_browser",
+		0x221: "ac_search",
+		0x223: "ac_home",
+		0x224: "ac_back",
+		0x225: "ac_forward",
+		0x226: "ac_stop",
+		0x227: "ac_refresh",
+		0x22a: "ac_bookmarks",
+		0x238: "ac_pan",
+	},
+	usagePageDigitizers: {
+		0x01: "digitizer",
+		0x02: "pen",
+		0x04: "touch_screen",
+		0x05: "touch_pad",
+		0x20: "stylus",
+		0x22: "finger",
+		0x30: "tip_pressure",
+		0x32: "in_range",
+		0x33: "touch",
+		0x3c: "invert",
+		0x42: "tip_switch",
+		0x44: "barrel_switch",
+		0x45: "eraser",
+		0x47: "confidence",
+		0x48: "width",
+		0x49: "height",
+		0x51: "contact_identifier",
+		0x54: "contact_count",
+		0x55: "contact_count_maximum",
+		0x56: "scan_time",
+	},
+	usagePageFIDO: {
+		0x01: "u2f_authenticator_device",
+		0x20: "input_report_data",
+		0x21: "output_report_data",
+	},
+}
+
+// usage ids are only meaningful together with the current usage page
+func usageMapper(usagePage uint64) scalar.UintMapper {
+	return scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+		switch usagePage {
+		case usagePageButton:
+			if s.Actual == 0 {
+				s.Sym = "no_button"
+			} else {
+				s.Sym = fmt.Sprintf("button_%d", s.Actual)
+			}
+		case usagePageOrdinal:
+			s.Sym = fmt.Sprintf("instance_%d", s.Actual)
+		default:
+			return usageNames[usagePage].MapUint(s)
+		}
+		return s, nil
+	})
+}
+
+// input, output and feature flags, bit set means the second alternative in the spec, ex: constant instead of data
+func decodeMainItemFlags(d *decode.D, tag uint64, size int) {
+	d.FieldStruct("data", func(d *decode.D) {
+		if size >= 1 {
+			if tag == mainTagInput {
+				d.FieldBool("reserved")
+			} else {
+				d.FieldBool("volatile")
+			}
+			d.FieldBool("null_state")
+			d.FieldBool("no_preferred")
+			d.FieldBool("nonlinear")
+			d.FieldBool("wrap")
+			d.FieldBool("relative")
+			d.FieldBool("variable")
+			d.FieldBool("constant")
+		}
+		if size >= 2 {
+			d.FieldU7("reserved1")
+			d.FieldBool("buffered_bytes")
+		}
+		if size >= 4 {
+			d.FieldU16("reserved2")
+		}
+	})
+}
+
+type hidReportState struct {
+	usagePage uint64
+	stack     []uint64
+}
+
+func decodeItem(d *decode.D, state *hidReportState) {
+	if d.PeekBytes(1)[0] == longItemPrefix {
+		d.FieldU8("prefix", scalar.UintHex)
+		dataSize := d.FieldU8("data_size")
+		d.FieldU8("long_item_tag", scalar.UintHex)
+		d.FieldRawLen("data", int64(dataSize)*8)
+		return
+	}
+
+	prefix := uint64(d.PeekBytes(1)[0])
+	typ := (prefix >> 2) & 0x3
+	tag := d.FieldU4("tag", tagNames[typ])
+	d.FieldU2("type", itemTypeNames)
+	size := itemSizeBytes[d.FieldU2("size", scalar.UintMapDescription{3: "4 bytes"})]
+	if size > 0 {
+		decodeItemData(d, state, typ, tag, size)
+	}
+
+	if typ == itemTypeGlobal {
+		switch tag {
+		case globalTagPush:
+			state.stack = append(state.stack, state.usagePage)
+		case globalTagPop:
+			if len(state.stack) > 0 {
+				state.usagePage = state.stack[len(state.stack)-1]
+				state.stack = state.stack[:len(state.stack)-1]
+			}
+		}
+	}
+}
+
+func decodeItemData(d *decode.D, state *hidReportState, typ uint64, tag uint64, size int) {
+	switch typ {
+	case itemTypeMain:
+		switch tag {
+		case mainTagInput, mainTagOutput, mainTagFeature:
+			decodeMainItemFlags(d, tag, size)
+		case mainTagCollection:
+			d.FieldU("data", size*8, collectionTypeNames)
+		default:
+			d.FieldU("data", size*8)
+		}
+	case itemTypeGlobal:
+		switch tag {
+		case globalTagUsagePage:
+			state.usagePage = d.FieldU("data", size*8, usagePageMapper)
+		case globalTagLogicalMinimum, globalTagLogicalMaximum,
+			globalTagPhysicalMinimum, globalTagPhysicalMaximum,
+			globalTagUnitExponent:
+			d.FieldS("data", size*8)
+		case globalTagUnit:
+			d.FieldU("data", size*8, scalar.UintHex)
+		default:
+			d.FieldU("data", size*8)
+		}
+	case itemTypeLocal:
+		switch tag {
+		case localTagUsage, localTagUsageMinimum, localTagUsageMaximum:
+			if size == 4 {
+				// extended usage with usage page in the high 16 bits
+				d.FieldStruct("data", func(d *decode.D) {
+					bs := d.PeekBytes(4)
+					usagePage := uint64(bs[2]) | uint64(bs[3])<<8
+					d.FieldU16("usage_id", usageMapper(usagePage))
+					d.FieldU16("usage_page", usagePageMapper)
+				})
+			} else {
+				d.FieldU("data", size*8, usageMapper(state.usagePage))
+			}
+		case localTagDelimiter:
+			d.FieldU("data", size*8, delimiterNames)
+		default:
+			d.FieldU("data", size*8)
+		}
+	default:
+		d.FieldRawLen("data", int64(size)*8)
+	}
+}
+
+func isItem(d *decode.D, typ uint64, tag uint64) bool {
+	prefix := uint64(d.PeekBytes(1)[0])
+	return prefix != longItemPrefix && prefix>>4 == tag && (prefix>>2)&0x3 == typ
+}
+
+// items in a collection are nested until the matching end collection item
+func decodeElement(d *decode.D, state *hidReportState) {
+	if !isItem(d, itemTypeMain, mainTagCollection) {
+		d.FieldStruct("item", func(d *decode.D) { decodeItem(d, state) })
+		return
+	}
+	d.FieldStruct("collection", func(d *decode.D) {
+		decodeItem(d, state)
+		d.FieldArray("items", func(d *decode.D) {
+			for !d.End() && !isItem(d, itemTypeMain, mainTagEndCollection) {
+				decodeElement(d, state)
+			}
+		})
+		if !d.End() {
+			d.FieldStruct("end_collection", func(d *decode.D) { decodeItem(d, state) })
+		}
+	})
+}
+
+func decodeHIDReportDesc(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	state := &hidReportState{}
+	for !d.End() {
+		decodeElement(d, state)
+	}
+
+	return nil
+}
@@ -0,0 +1,514 @@
+package usb
+
+// https://www.usb.org/document-library/usb-20-specification
+// https://www.usb.org/document-library/device-class-definition-hid-111
+// https://www.usb.org/defined-class-codes
+
+import (
+	"embed"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed usb_descriptors.md
+var usbFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.USB_Descriptors,
+		&decode.Format{
+			Description: "USB descriptors",
+			DecodeFn:    decodeUSBDescriptors,
+			RootArray:   true,
+			RootName:    "descriptors",
+		})
+	interp.RegisterFS(usbFS)
+}
+
+const (
+	descriptorTypeDevice                   = 0x01
+	descriptorTypeConfiguration            = 0x02
+	descriptorTypeString                   = 0x03
+	descriptorTypeInterface                = 0x04
+	descriptorTypeEndpoint                 = 0x05
+	descriptorTypeDeviceQualifier          = 0x06
+	descriptorTypeOtherSpeedConfig         = 0x07
+	descriptorTypeInterfacePower           = 0x08
+	descriptorTypeOTG                      = 0x09
+	descriptorTypeDebug                    = 0x0a
+	descriptorTypeInterfaceAssociation     = 0x0b
+	descriptorTypeBOS                      = 0x0f
+	descriptorTypeDeviceCapability         = 0x10
+	descriptorTypeHID                      = 0x21
+	descriptorTypeReport                   = 0x22
+	descriptorTypePhysical                 = 0x23
+	descriptorTypeCSInterface              = 0x24
+	descriptorTypeCSEndpoint               = 0x25
+	descriptorTypeHub                      = 0x29
+	descriptorTypeSuperSpeedHub            = 0x2a
+	descriptorTypeSSEndpointCompanion      = 0x30
+	descriptorTypeSSPIsocEndpointCompanion = 0x31
+)
+
+var descriptorTypeNames = scalar.UintMapSymStr{
+	descriptorTypeDevice:                   "device",
+	descriptorTypeConfiguration:            "configuration",
+	descriptorTypeString:                   "string",
+	descriptorTypeInterface:                "interface",
+	descriptorTypeEndpoint:                 "endpoint",
+	descriptorTypeDeviceQualifier:          "device_qualifier",
+	descriptorTypeOtherSpeedConfig:         "other_speed_configuration",
+	descriptorTypeInterfacePower:           "interface_power",
+	descriptorTypeOTG:                      "otg",
+	descriptorTypeDebug:                    "debug",
+	descriptorTypeInterfaceAssociation:     "interface_association",
+	descriptorTypeBOS:                      "bos",
+	descriptorTypeDeviceCapability:         "device_capability",
+	descriptorTypeHID:                      "hid",
+	descriptorTypeReport:                   "report",
+	descriptorTypePhysical:                 "physical",
+	descriptorTypeCSInterface:              "cs_interface",
+	descriptorTypeCSEndpoint:               "cs_endpoint",
+	descriptorTypeHub:                      "hub",
+	descriptorTypeSuperSpeedHub:            "superspeed_hub",
+	descriptorTypeSSEndpointCompanion:      "ss_endpoint_companion",
+	descriptorTypeSSPIsocEndpointCompanion: "ssp_isoc_endpoint_companion",
+}
+
+const (
+	classPerInterface = 0x00
+	classHID          = 0x03
+)
+
+var classNames = scalar.UintMapSymStr{
+	0x00: "per_interface",
+	0x01: "audio",
+	0x02: "cdc",
+	0x03: "hid",
+	0x05: "physical",
+	0x06: "image",
+	0x07: "printer",
+	0x08: "mass_storage",
+	0x09: "hub",
+	0x0a: "cdc_data",
+	0x0b: "smart_card",
+	0x0d: "content_security",
+	0x0e: "video",
+	0x0f: "personal_healthcare",
+	0x10: "audio_video",
+	0x11: "billboard",
+	0x12: "type_c_bridge",
+	0x13: "bulk_display",
+	0x14: "mctp",
+	0x3c: "i3c",
+	0xdc: "diagnostic",
+	0xe0: "wireless_controller",
+	0xef: "miscellaneous",
+	0xfe: "application_specific",
+	0xff: "vendor_specific",
+}
+
+// subclass codes per class
+var subclassNames = map[uint64]scalar.UintMapSymStr{
+	0x01: {0x01: "audio_control", 0x02: "audio_streaming", 0x03: "midi_streaming"},
+	0x02: {
+		0x01: "direct_line",
+		0x02: "acm",
+		0x03: "telephone",
+		0x04: "multi_channel",
+		0x05: "capi",
+		0x06: "ethernet",
+		0x07: "atm",
+		0x08: "wireless_handset",
+		0x09: "device_management",
+		0x0a: "mobile_direct_line",
+		0x0b: "obex",
+		0x0c: "ethernet_emulation",
+		0x0d: "ncm",
+		0x0e: "mbim",
+	},
+	0x03: {0x00: "none", 0x01: "boot_interface"},
+	0x06: {0x01: "still_image"},
+	0x07: {0x01: "printer"},
+	0x08: {
+		0x00: "scsi_not_reported",
+		0x01: "rbc",
+		0x02: "mmc5",
+		0x04: "ufi",
+		0x06: "scsi",
+		0x07: "lsd_fs",
+		0x08: "ieee_1667",
+		0xff: "vendor_specific",
+	},
+	0x0e: {0x01: "video_control", 0x02: "video_streaming", 0x03: "video_interface_collection"},
+	0xdc: {0x01: "reprogrammable", 0x02: "trace", 0x03: "dfx", 0x07: "dvc_trace", 0x08: "miscellaneous"},
+	0xe0: {0x01: "radio_frequency", 0x02: "wireless_usb"},
+	0xef: {0x01: "sync", 0x02: "common", 0x03: "cable_based", 0x04: "rndis", 0x05: "usb3_vision", 0x06: "step", 0x07: "command_interface"},
+	0xfe: {0x01: "dfu", 0x02: "irda_bridge", 0x03: "test_and_measurement"},
+}
+
+// protocol codes per class and subclass
+var protocolNames = map[[2]uint64]scalar.UintMapSymStr{
+	{0x01, 0x01}: {0x00: "uac1", 0x20: "uac2", 0x30: "uac3"},
+	{0x01, 0x02}: {0x00: "uac1", 0x20: "uac2", 0x30: "uac3"},
+	{0x02, 0x02}: {0x00: "none", 0x01: "at_v250", 0x02: "at_pcca101", 0x07: "at_cdma", 0xfe: "external", 0xff: "vendor_specific"},
+	{0x03, 0x00}: {0x00: "none"},
+	{0x03, 0x01}: {0x00: "none", 0x01: "keyboard", 0x02: "mouse"},
+	{0x08, 0x06}: {0x00: "cbi_with_interrupt", 0x01: "cbi_without_interrupt", 0x50: "bulk_only", 0x62: "uas", 0xff: "vendor_specific"},
+	{0x09, 0x00}: {0x00: "full_speed", 0x01: "high_speed_single_tt", 0x02: "high_speed_multiple_tt", 0x03: "superspeed"},
+	{0xe0, 0x01}: {0x01: "bluetooth", 0x02: "uwb_radio_control", 0x03: "rndis", 0x04: "bluetooth_amp"},
+	{0xef, 0x02}: {0x01: "interface_association", 0x02: "wire_adapter_multifunction"},
+	{0xfe, 0x01}: {0x01: "runtime", 0x02: "dfu_mode"},
+	{0xfe, 0x03}: {0x00: "usbtmc", 0x01: "usb488"},
+}
+
+var endpointDirectionNames = scalar.UintMapSymStr{
+	0: "out",
+	1: "in",
+}
+
+var transferTypeNames = scalar.UintMapSymStr{
+	0: "control",
+	1: "isochronous",
+	2: "bulk",
+	3: "interrupt",
+}
+
+var synchronizationTypeNames = scalar.UintMapSymStr{
+	0: "none",
+	1: "asynchronous",
+	2: "adaptive",
+	3: "synchronous",
+}
+
+var usageTypeNames = scalar.UintMapSymStr{
+	0: "data",
+	1: "feedback",
+	2: "implicit_feedback",
+	3: "reserved",
+}
+
+var hidCountryCodeNames = scalar.UintMapSymStr{
+	0:  "not_supported",
+	1:  "arabic",
+	2:  "belgian",
+	3:  "canadian_bilingual",
+	4:  "canadian_french",
+	5:  "czech_republic",
+	6:  "danish",
+	7:  "finnish",
+	8:  "french",
+	9:  "german",
+	10: "greek",
+	11: "hebrew",
+	12: "hungary",
+	13: "international_iso",
+	14: "italian",
+	15: "japan_katakana",
+	16: "korean",
+	17: "latin_american",
+	18: "netherlands_dutch",
+	19: "norwegian",
+	20: "persian_farsi",
+	21: "poland",
+	22: "portuguese",
+	23: "russia",
+	24: "slovakia",
+	25: "spanish",
+	26: "swedish",
+	27: "swiss_french",
+	28: "swiss_german",
+	29: "switzerland",
+	30: "taiwan",
+	31: "turkish_q",
+	32: "uk",
+	33: "us",
+	34: "yugoslavia",
+	35: "turkish_f",
+}
+
+const (
+	capabilityTypeUSB20Extension = 0x02
+	capabilityTypeSuperSpeed     = 0x03
+	capabilityTypeContainerID    = 0x04
+	capabilityTypePlatform       = 0x05
+)
+
+var capabilityTypeNames = scalar.UintMapSymStr{
+	0x01:                         "wireless_usb",
+	capabilityTypeUSB20Extension: "usb_2_0_extension",
+	capabilityTypeSuperSpeed:     "superspeed_usb",
+	capabilityTypeContainerID:    "container_id",
+	capabilityTypePlatform:       "platform",
+	0x06:                         "power_delivery",
+	0x07:                         "battery_info",
+	0x08:                         "pd_consumer_port",
+	0x09:                         "pd_provider_port",
+	0x0a:                         "superspeed_plus",
+	0x0b:                         "precision_time_measurement",
+	0x0c:                         "wireless_usb_ext",
+	0x0d:                         "billboard",
+	0x0e:                         "authentication",
+	0x0f:                         "billboard_ex",
+	0x10:                         "configuration_summary",
+}
+
+var platformCapabilityNames = uuidMapDescription{
+	"3408b638-09a9-47a0-8bfd-a0768815b665": "WebUSB",
+	"d8dd60df-4589-4cc7-9cd2-659d9e648a9f": "Microsoft OS 2.0",
+}
+
+// binary coded decimal version, ex: 0x0210 is 2.10
+var bcdVersion = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	s.Description = fmt.Sprintf("%x.%02x", s.Actual>>8, s.Actual&0xff)
+	s.DisplayFormat = scalar.NumberHex
+	return s, nil
+})
+
+// bMaxPower is in 2 mA units
+var maxPowerMilliAmpere = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	s.Description = fmt.Sprintf("%d mA", s.Actual*2)
+	return s, nil
+})
+
+// UUIDs are stored with the first three fields little endian
+func uuidString(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)
+}
+
+var rawUUID = scalar.BitBufFn(func(s scalar.BitBuf) (scalar.BitBuf, error) {
+	return scalar.RawSym(s, -1, uuidString)
+})
+
+type uuidMapDescription map[string]string
+
+func (m uuidMapDescription) MapBitBuf(s scalar.BitBuf) (scalar.BitBuf, error) {
+	if u, ok := s.Sym.(string); ok {
+		s.Description = m[u]
+	}
+	return s, nil
+}
+
+func fieldClass(d *decode.D, prefix string) (uint64, uint64) {
+	class := d.FieldU8(prefix+"class", classNames)
+	subclass := d.FieldU8(prefix+"subclass", subclassNames[class])
+	d.FieldU8(prefix+"protocol", protocolNames[[2]uint64{class, subclass}])
+	return class, subclass
+}
+
+func decodeConfigurationAttributes(d *decode.D) {
+	d.FieldStruct("attributes", func(d *decode.D) {
+		d.FieldBool("reserved_one")
+		d.FieldBool("self_powered")
+		d.FieldBool("remote_wakeup")
+		d.FieldBool("battery_powered")
+		d.FieldU4("reserved")
+	})
+}
+
+func decodeDevice(d *decode.D) {
+	d.FieldU16("bcd_usb", bcdVersion)
+	fieldClass(d, "device_")
+	d.FieldU8("max_packet_size0")
+	d.FieldU16("id_vendor", scalar.UintHex)
+	d.FieldU16("id_product", scalar.UintHex)
+	d.FieldU16("bcd_device", bcdVersion)
+	d.FieldU8("manufacturer_index")
+	d.FieldU8("product_index")
+	d.FieldU8("serial_number_index")
+	d.FieldU8("num_configurations")
+}
+
+func decodeDeviceQualifier(d *decode.D) {
+	d.FieldU16("bcd_usb", bcdVersion)
+	fieldClass(d, "device_")
+	d.FieldU8("max_packet_size0")
+	d.FieldU8("num_configurations")
+	d.FieldU8("reserved")
+}
+
+func decodeInterface(d *decode.D) uint64 {
+	d.FieldU8("interface_number")
+	d.FieldU8("alternate_setting")
+	d.FieldU8("num_endpoints")
+	class, _ := fieldClass(d, "interface_")
+	d.FieldU8("interface_index")
+	return class
+}
+
+func decodeInterfaceAssociation(d *decode.D) {
+	d.FieldU8("first_interface")
+	d.FieldU8("interface_count")
+	fieldClass(d, "function_")
+	d.FieldU8("function_index")
+}
+
+func decodeEndpoint(d *decode.D) {
+	d.FieldStruct("endpoint_address", func(d *decode.D) {
+		d.FieldU1("direction", endpointDirectionNames)
+		d.FieldU3("reserved")
+		d.FieldU4("number")
+	})
+	d.FieldStruct("attributes", func(d *decode.D) {
+		d.FieldU2("reserved")
+		d.FieldU2("usage_type", usageTypeNames)
+		d.FieldU2("synchronization_type", synchronizationTypeNames)
+		d.FieldU2("transfer_type", transferTypeNames)
+	})
+	d.FieldU16("max_packet_size")
+	d.FieldU8("interval")
+	// audio class 1.0 endpoints has two extra bytes
+	if d.BitsLeft() >= 16 {
+		d.FieldU8("refresh")
+		d.FieldU8("synch_address", scalar.UintHex)
+	}
+}
+
+func decodeHID(d *decode.D) {
+	d.FieldU16("bcd_hid", bcdVersion)
+	d.FieldU8("country_code", hidCountryCodeNames)
+	numDescriptors := d.FieldU8("num_descriptors")
+	d.FieldArray("class_descriptors", func(d *decode.D) {
+		for i := uint64(0); i < numDescriptors; i++ {
+			d.FieldStruct("class_descriptor", func(d *decode.D) {
+				d.FieldU8("descriptor_type", descriptorTypeNames)
+				d.FieldU16("descriptor_length")
+			})
+		}
+	})
+}
+
+func decodeDeviceCapability(d *decode.D) {
+	switch d.FieldU8("capability_type", capabilityTypeNames) {
+	case capabilityTypeUSB20Extension:
+		d.FieldU32("attributes", scalar.UintHex)
+	case capabilityTypeSuperSpeed:
+		d.FieldU8("attributes", scalar.UintHex)
+		d.FieldU16("speeds_supported", scalar.UintHex)
+		d.FieldU8("functionality_support")
+		d.FieldU8("u1_device_exit_latency")
+		d.FieldU16("u2_device_exit_latency")
+	case capabilityTypeContainerID:
+		d.FieldU8("reserved")
+		d.FieldRawLen("container_id", 16*8, rawUUID)
+	case capabilityTypePlatform:
+		d.FieldU8("reserved")
+		d.FieldRawLen("platform_capability_uuid", 16*8, rawUUID, platformCapabilityNames)
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+// first string descriptor (index 0) is a list of supported language ids
+func isLanguageIDs(bs []byte) bool {
+	if len(bs) == 0 || len(bs)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(bs); i += 2 {
+		// primary language id is in the low 10 bits and sub language in the high 6 bits
+		if binary.LittleEndian.Uint16(bs[i:]) < 0x0400 {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeUSBDescriptors(d *decode.D) any {
+	d.Endian = decode.LittleEndian
+
+	seenString := false
+	var interfaceClass uint64
+
+	var decodeDescriptors func(d *decode.D)
+	decodeDescriptor := func(d *decode.D) {
+		length := int64(d.PeekBytes(1)[0])
+		if length < 2 {
+			d.Fatalf("invalid descriptor length %d", length)
+		}
+		if length*8 > d.BitsLeft() {
+			d.Fatalf("descriptor length %d is larger than input", length)
+		}
+		var totalLength int64
+		d.FramedFn(length*8, func(d *decode.D) {
+			d.FieldU8("length")
+			typ := d.FieldU8("descriptor_type", descriptorTypeNames)
+
+			switch typ {
+			case descriptorTypeDevice:
+				decodeDevice(d)
+			case descriptorTypeDeviceQualifier:
+				decodeDeviceQualifier(d)
+			case descriptorTypeConfiguration, descriptorTypeOtherSpeedConfig:
+				totalLength = int64(d.FieldU16("total_length"))
+				d.FieldU8("num_interfaces")
+				d.FieldU8("configuration_value")
+				d.FieldU8("configuration_index")
+				decodeConfigurationAttributes(d)
+				d.FieldU8("max_power", maxPowerMilliAmpere)
+			case descriptorTypeString:
+				bs := d.PeekBytes(int(d.BitsLeft() / 8))
+				if !seenString && isLanguageIDs(bs) {
+					d.FieldArray("language_ids", func(d *decode.D) {
+						for !d.End() {
+							d.FieldU16("language_id", scalar.UintHex)
+						}
+					})
+				} else {
+					d.FieldUTF16LE("string", int(d.BitsLeft()/8))
+				}
+				seenString = true
+			case descriptorTypeInterface:
+				interfaceClass = decodeInterface(d)
+			case descriptorTypeEndpoint:
+				decodeEndpoint(d)
+			case descriptorTypeInterfaceAssociation:
+				decodeInterfaceAssociation(d)
+			case descriptorTypeHID:
+				// same type is used by other classes for functional descriptors, ex: DFU
+				if interfaceClass == classHID || interfaceClass == classPerInterface {
+					decodeHID(d)
+				}
+			case descriptorTypeBOS:
+				totalLength = int64(d.FieldU16("total_length"))
+				d.FieldU8("num_device_caps")
+			case descriptorTypeDeviceCapability:
+				decodeDeviceCapability(d)
+			case descriptorTypeSSEndpointCompanion:
+				d.FieldU8("max_burst")
+				d.FieldU8("attributes", scalar.UintHex)
+				d.FieldU16("bytes_per_interval")
+			}
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		})
+
+		// configuration and BOS descriptors are followed by descriptors that belong to them
+		if n := totalLength - length; n > 0 {
+			d.FramedFn(min(n*8, d.BitsLeft()), func(d *decode.D) {
+				d.FieldArray("descriptors", decodeDescriptors)
+			})
+		}
+	}
+	decodeDescriptors = func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("descriptor", decodeDescriptor)
+		}
+	}
+
+	decodeDescriptors(d)
+
+	return nil
+}
@@ -21,8 +21,13 @@ func init() {
 		format.WASM,
 		&decode.Format{
 			Description: "WebAssembly Binary Format",
+			Extensions:  []string{"wasm"},
+			MIMETypes:   []string{"application/wasm"},
 			DecodeFn:    decodeWASM,
 			Groups:      []*decode.Group{format.Probe},
+			DefaultInArg: format.WASM_In{
+				DecodeInstructions: true,
+			},
 		})
 	interp.RegisterFS(wasmFS)
 }
@@ -469,27 +474,32 @@ func decodeElemKind(d *decode.D, name string) {
 //	code    ::= size:u32 code:func          => code              (if size = ||func||)
 //	func    ::= (t*)*:vec(locals) e:expr    => concat((t*)*),e   (if |concat((t*)*)| < 2^32)
 //	locals  ::= n:u32 t:valtype             => t^n
-func decodeCodeSection(d *decode.D) {
+func decodeCodeSection(d *decode.D, wi format.WASM_In) {
 	decodeVec(d, "code", func(d *decode.D) {
-		decodeCode(d, "code")
+		decodeCode(d, "code", wi)
 	})
 }
 
-func decodeCode(d *decode.D, name string) {
+func decodeCode(d *decode.D, name string, wi format.WASM_In) {
 	d.FieldStruct(name, func(d *decode.D) {
 		size := fieldU32(d, "size")
 		d.FramedFn(int64(size)*8, func(d *decode.D) {
-			decodeFunc(d, "code")
+			decodeFunc(d, "code", wi)
 		})
 	})
 }
 
-func decodeFunc(d *decode.D, name string) {
+func decodeFunc(d *decode.D, name string, wi format.WASM_In) {
 	d.FieldStruct(name, func(d *decode.D) {
 		decodeVec(d, "t", func(d *decode.D) {
 			decodeLocals(d, "t")
 		})
-		decodeExpr(d, "e")
+		if wi.DecodeInstructions {
+			decodeExpr(d, "e")
+		} else {
+			// instructions are the rest of the function body
+			d.FieldRawLen("e", d.BitsLeft())
+		}
 	})
 }
 
@@ -538,7 +548,7 @@ func decodeDataCountSection(d *decode.D) {
 	fieldU32(d, "n")
 }
 
-func decodeWASMModule(d *decode.D) {
+func decodeWASMModule(d *decode.D, wi format.WASM_In) {
 	d.FieldRawLen("magic", 4*8, d.AssertBitBuf([]byte("\x00asm")))
 	d.FieldU32("version")
 	d.FieldArray("sections", func(d *decode.D) {
@@ -572,7 +582,7 @@ func decodeWASMModule(d *decode.D) {
 					case sectionIDElement:
 						d.FieldStruct("element", decodeElementSection)
 					case sectionIDCode:
-						d.FieldStruct("content", decodeCodeSection)
+						d.FieldStruct("content", func(d *decode.D) { decodeCodeSection(d, wi) })
 					case sectionIDData:
 						d.FieldStruct("content", decodeDataSection)
 					case sectionIDDataCount:
@@ -595,6 +605,9 @@ const (
 )
 
 func decodeWASM(d *decode.D) any {
+	var wi format.WASM_In
+	d.ArgAs(&wi)
+
 	d.Endian = decode.LittleEndian
 
 	// delayed initialization to break initialization reference cycle
@@ -604,7 +617,7 @@ func decodeWASM(d *decode.D) any {
 		instrMap[opcodeIf] = instructionInfo{mnemonic: "if", f: decodeIf}
 	})
 
-	decodeWASMModule(d)
+	decodeWASMModule(d, wi)
 
 	return nil
 }
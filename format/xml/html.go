@@ -22,6 +22,8 @@ func init() {
 		format.HTML,
 		&decode.Format{
 			Description: "HyperText Markup Language",
+			Extensions:  []string{"html", "htm"},
+			MIMETypes:   []string{"text/html"},
 			ProbeOrder:  format.ProbeOrderTextFuzzy,
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeHTML,
@@ -40,6 +40,8 @@ func init() {
 		format.XML,
 		&decode.Format{
 			Description: "Extensible Markup Language",
+			Extensions:  []string{"xml"},
+			MIMETypes:   []string{"application/xml", "text/xml"},
 			ProbeOrder:  format.ProbeOrderTextFuzzy,
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeXML,
@@ -24,10 +24,12 @@ func init() {
 		format.YAML,
 		&decode.Format{
 			Description: "YAML Ain't Markup Language",
+			Extensions:  []string{"yaml", "yml"},
+			MIMETypes:   []string{"application/yaml"},
 			ProbeOrder:  format.ProbeOrderTextFuzzy,
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    decodeYAML,
-			Functions:   []string{"_todisplay"},
+			Functions:   []string{"_todisplay", "_encode"},
 		})
 	interp.RegisterFS(yamlFS)
 	interp.RegisterFunc0("to_yaml", toYAML)
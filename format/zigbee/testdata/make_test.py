@@ -0,0 +1,112 @@
+#!/usr/bin/env python3
+# generates zigbee zcl frame test files, see Zigbee Cluster Library Specification
+import struct
+
+GLOBAL, CLUSTER_SPECIFIC = 0, 1
+CLIENT_TO_SERVER, SERVER_TO_CLIENT = 0, 1
+
+
+def frame(frame_type, direction, seq, command_id, payload=b"", manufacturer_code=None, disable_default_response=False):
+    fc = frame_type | direction << 3 | disable_default_response << 4
+    header = b""
+    if manufacturer_code is not None:
+        fc |= 1 << 2
+        header = struct.pack("<H", manufacturer_code)
+    return bytes([fc]) + header + bytes([seq, command_id]) + payload
+
+
+def u16(n):
+    return struct.pack("<H", n)
+
+
+def attr(attribute_id, data_type, value):
+    return u16(attribute_id) + bytes([data_type]) + value
+
+
+def char_string(s):
+    b = s.encode("utf-8")
+    return bytes([len(b)]) + b
+
+
+files = {
+    # basic cluster, read manufacturer name, model identifier, date code and an unsupported attribute
+    "read_attributes.zcl": frame(GLOBAL, CLIENT_TO_SERVER, 1, 0x00, u16(0x0004) + u16(0x0005) + u16(0x0006) + u16(0x4000)),
+    "read_attributes_response.zcl": frame(
+        GLOBAL,
+        SERVER_TO_CLIENT,
+        1,
+        0x01,
+        u16(0x0004) + b"\x00" + bytes([0x42]) + char_string("fq")
+        + u16(0x0005) + b"\x00" + bytes([0x42]) + char_string("test")
+        + u16(0x0006) + b"\x00" + bytes([0x42]) + char_string("20231114")
+        + u16(0x4000) + b"\x86",
+        disable_default_response=True,
+    ),
+    # one attribute per data type
+    "types.zcl": frame(
+        GLOBAL,
+        SERVER_TO_CLIENT,
+        2,
+        0x0A,
+        attr(0x0000, 0x10, b"\x01")
+        + attr(0x0001, 0x08, b"\xab")
+        + attr(0x0002, 0x1A, b"\x01\x02\x03")
+        + attr(0x0003, 0x21, u16(1000))
+        + attr(0x0004, 0x25, (1 << 40).to_bytes(6, "little"))
+        + attr(0x0005, 0x29, struct.pack("<h", -1000))
+        + attr(0x0006, 0x2A, (-100000).to_bytes(3, "little", signed=True))
+        + attr(0x0007, 0x30, b"\x02")
+        + attr(0x0008, 0x31, u16(0x1234))
+        + attr(0x0009, 0x38, struct.pack("<e", 1.5))
+        + attr(0x000A, 0x39, struct.pack("<f", -2.25))
+        + attr(0x000B, 0x3A, struct.pack("<d", 3.125))
+        + attr(0x000C, 0x41, bytes([3, 1, 2, 3]))
+        + attr(0x000D, 0x42, b"\xff")
+        + attr(0x000E, 0x43, u16(2) + b"\xca\xfe")
+        + attr(0x000F, 0x44, u16(4) + "åä".encode("utf-8"))
+        + attr(0x0010, 0x48, bytes([0x20]) + u16(3) + bytes([1, 2, 3]))
+        + attr(0x0011, 0x4C, u16(2) + bytes([0x20, 7]) + bytes([0x42]) + char_string("s"))
+        + attr(0x0012, 0xE0, bytes([12, 30, 15, 50]))
+        + attr(0x0013, 0xE1, bytes([123, 11, 14, 2]))
+        + attr(0x0014, 0xE2, struct.pack("<I", 753_000_000))
+        + attr(0x0015, 0xE8, u16(0x0006))
+        + attr(0x0016, 0xE9, u16(0x4003))
+        + attr(0x0017, 0xEA, struct.pack("<I", 0x00C00001))
+        + attr(0x0018, 0xF0, struct.pack("<Q", 0x00124B0001020304))
+        + attr(0x0019, 0xF1, bytes(range(16)))
+        + attr(0x001A, 0x00, b"")
+        + attr(0x001B, 0xFF, b""),
+    ),
+    # temperature measurement, report at least every 300 seconds or on 0.5 degree change
+    # and timeout for received reports
+    "configure_reporting.zcl": frame(
+        GLOBAL,
+        CLIENT_TO_SERVER,
+        3,
+        0x06,
+        b"\x00" + u16(0x0000) + bytes([0x29]) + u16(10) + u16(300) + struct.pack("<h", 50)
+        + b"\x00" + u16(0x0001) + bytes([0x18]) + u16(1) + u16(60)
+        + b"\x01" + u16(0x0002) + u16(600),
+    ),
+    "configure_reporting_response.zcl": frame(GLOBAL, SERVER_TO_CLIENT, 3, 0x07, b"\x00"),
+    "write_attributes_response.zcl": frame(GLOBAL, SERVER_TO_CLIENT, 4, 0x04, b"\x88" + u16(0x0004)),
+    "default_response.zcl": frame(GLOBAL, SERVER_TO_CLIENT, 5, 0x0B, bytes([0x02, 0x00]), disable_default_response=True),
+    "discover_attributes_extended_response.zcl": frame(
+        GLOBAL,
+        SERVER_TO_CLIENT,
+        6,
+        0x16,
+        b"\x01" + u16(0x0000) + bytes([0x10, 0b101]) + u16(0x4003) + bytes([0x30, 0b011]),
+    ),
+    "discover_commands_received_response.zcl": frame(GLOBAL, SERVER_TO_CLIENT, 7, 0x12, b"\x01" + bytes([0x00, 0x01, 0x02, 0x40])),
+    # on/off cluster toggle
+    "on_off_toggle.zcl": frame(CLUSTER_SPECIFIC, CLIENT_TO_SERVER, 8, 0x02),
+    # level control move to level with on/off, level 128 transition time 10
+    "move_to_level.zcl": frame(CLUSTER_SPECIFIC, CLIENT_TO_SERVER, 9, 0x04, bytes([128]) + u16(10)),
+    # manufacturer specific global command
+    "manufacturer_specific.zcl": frame(GLOBAL, CLIENT_TO_SERVER, 10, 0x00, u16(0x0001), manufacturer_code=0x115F),
+}
+
+for name, data in files.items():
+    with open(name, "wb") as f:
+        f.write(data)
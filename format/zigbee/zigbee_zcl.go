@@ -0,0 +1,602 @@
+package zigbee
+
+// Zigbee Cluster Library Specification, Revision 8
+// https://csa-iot.org/developer-resource/specifications-download-request/
+// https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-zbee-zcl.c
+
+import (
+	"embed"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed zigbee_zcl.md
+var zigbeeZCLFS embed.FS
+
+func init() {
+	interp.RegisterFormat(
+		format.Zigbee_ZCL,
+		&decode.Format{
+			Description:  "Zigbee Cluster Library frame",
+			DecodeFn:     decodeZigbeeZCL,
+			DefaultInArg: format.Zigbee_ZCL_In{ClusterID: -1},
+		})
+	interp.RegisterFS(zigbeeZCLFS)
+}
+
+const (
+	frameTypeGlobal          = 0
+	frameTypeClusterSpecific = 1
+)
+
+var frameTypeNames = scalar.UintMapSymStr{
+	frameTypeGlobal:          "global",
+	frameTypeClusterSpecific: "cluster_specific",
+}
+
+const (
+	directionClientToServer = 0
+	directionServerToClient = 1
+)
+
+var directionNames = scalar.UintMapSymStr{
+	directionClientToServer: "client_to_server",
+	directionServerToClient: "server_to_client",
+}
+
+const (
+	cmdReadAttributes                     = 0x00
+	cmdReadAttributesResponse             = 0x01
+	cmdWriteAttributes                    = 0x02
+	cmdWriteAttributesUndivided           = 0x03
+	cmdWriteAttributesResponse            = 0x04
+	cmdWriteAttributesNoResponse          = 0x05
+	cmdConfigureReporting                 = 0x06
+	cmdConfigureReportingResponse         = 0x07
+	cmdReadReportingConfiguration         = 0x08
+	cmdReadReportingConfigurationResponse = 0x09
+	cmdReportAttributes                   = 0x0a
+	cmdDefaultResponse                    = 0x0b
+	cmdDiscoverAttributes                 = 0x0c
+	cmdDiscoverAttributesResponse         = 0x0d
+	cmdDiscoverCommandsReceived           = 0x11
+	cmdDiscoverCommandsReceivedResponse   = 0x12
+	cmdDiscoverCommandsGenerated          = 0x13
+	cmdDiscoverCommandsGeneratedResponse  = 0x14
+	cmdDiscoverAttributesExtended         = 0x15
+	cmdDiscoverAttributesExtendedResponse = 0x16
+)
+
+var globalCommandNames = scalar.UintMapSymStr{
+	cmdReadAttributes:                     "read_attributes",
+	cmdReadAttributesResponse:             "read_attributes_response",
+	cmdWriteAttributes:                    "write_attributes",
+	cmdWriteAttributesUndivided:           "write_attributes_undivided",
+	cmdWriteAttributesResponse:            "write_attributes_response",
+	cmdWriteAttributesNoResponse:          "write_attributes_no_response",
+	cmdConfigureReporting:                 "configure_reporting",
+	cmdConfigureReportingResponse:         "configure_reporting_response",
+	cmdReadReportingConfiguration:         "read_reporting_configuration",
+	cmdReadReportingConfigurationResponse: "read_reporting_configuration_response",
+	cmdReportAttributes:                   "report_attributes",
+	cmdDefaultResponse:                    "default_response",
+	cmdDiscoverAttributes:                 "discover_attributes",
+	cmdDiscoverAttributesResponse:         "discover_attributes_response",
+	0x0e:                                  "read_attributes_structured",
+	0x0f:                                  "write_attributes_structured",
+	0x10:                                  "write_attributes_structured_response",
+	cmdDiscoverCommandsReceived:           "discover_commands_received",
+	cmdDiscoverCommandsReceivedResponse:   "discover_commands_received_response",
+	cmdDiscoverCommandsGenerated:          "discover_commands_generated",
+	cmdDiscoverCommandsGeneratedResponse:  "discover_commands_generated_response",
+	cmdDiscoverAttributesExtended:         "discover_attributes_extended",
+	cmdDiscoverAttributesExtendedResponse: "discover_attributes_extended_response",
+}
+
+var clusterNames = scalar.SintMapSymStr{
+	0x0000: "basic",
+	0x0001: "power_configuration",
+	0x0002: "device_temperature_configuration",
+	0x0003: "identify",
+	0x0004: "groups",
+	0x0005: "scenes",
+	0x0006: "on_off",
+	0x0007: "on_off_switch_configuration",
+	0x0008: "level_control",
+	0x000a: "time",
+	0x0019: "ota_upgrade",
+	0x0020: "poll_control",
+	0x0101: "door_lock",
+	0x0102: "window_covering",
+	0x0201: "thermostat",
+	0x0202: "fan_control",
+	0x0300: "color_control",
+	0x0400: "illuminance_measurement",
+	0x0402: "temperature_measurement",
+	0x0403: "pressure_measurement",
+	0x0405: "relative_humidity_measurement",
+	0x0406: "occupancy_sensing",
+	0x0500: "ias_zone",
+	0x0502: "ias_wd",
+	0x0702: "metering",
+	0x0b04: "electrical_measurement",
+}
+
+// client to server cluster specific commands
+var clusterCommandNames = map[int64]scalar.UintMapSymStr{
+	0x0000: {
+		0x00: "reset_to_factory_defaults",
+	},
+	0x0003: {
+		0x00: "identify",
+		0x01: "identify_query",
+		0x40: "trigger_effect",
+	},
+	0x0004: {
+		0x00: "add_group",
+		0x01: "view_group",
+		0x02: "get_group_membership",
+		0x03: "remove_group",
+		0x04: "remove_all_groups",
+		0x05: "add_group_if_identifying",
+	},
+	0x0006: {
+		0x00: "off",
+		0x01: "on",
+		0x02: "toggle",
+		0x40: "off_with_effect",
+		0x41: "on_with_recall_global_scene",
+		0x42: "on_with_timed_off",
+	},
+	0x0008: {
+		0x00: "move_to_level",
+		0x01: "move",
+		0x02: "step",
+		0x03: "stop",
+		0x04: "move_to_level_with_on_off",
+		0x05: "move_with_on_off",
+		0x06: "step_with_on_off",
+		0x07: "stop_with_on_off",
+	},
+	0x0300: {
+		0x00: "move_to_hue",
+		0x01: "move_hue",
+		0x02: "step_hue",
+		0x03: "move_to_saturation",
+		0x04: "move_saturation",
+		0x05: "step_saturation",
+		0x06: "move_to_hue_and_saturation",
+		0x07: "move_to_color",
+		0x08: "move_color",
+		0x09: "step_color",
+		0x0a: "move_to_color_temperature",
+	},
+}
+
+const statusSuccess = 0x00
+
+var statusNames = scalar.UintMapSymStr{
+	statusSuccess: "success",
+	0x01:          "failure",
+	0x7e:          "not_authorized",
+	0x80:          "malformed_command",
+	0x81:          "unsup_command",
+	0x85:          "invalid_field",
+	0x86:          "unsupported_attribute",
+	0x87:          "invalid_value",
+	0x88:          "read_only",
+	0x89:          "insufficient_space",
+	0x8b:          "not_found",
+	0x8c:          "unreportable_attribute",
+	0x8d:          "invalid_data_type",
+	0x8e:          "invalid_selector",
+	0x94:          "timeout",
+	0x95:          "abort",
+	0x96:          "invalid_image",
+	0x97:          "wait_for_data",
+	0x98:          "no_image_available",
+	0x99:          "require_more_image",
+	0x9a:          "notification_pending",
+	0xc3:          "unsupported_cluster",
+}
+
+var reportDirectionNames = scalar.UintMapSymStr{
+	0: "reported",
+	1: "received",
+}
+
+const (
+	typeNoData        = 0x00
+	typeData8         = 0x08
+	typeData64        = 0x0f
+	typeBool          = 0x10
+	typeBitmap8       = 0x18
+	typeBitmap64      = 0x1f
+	typeUint8         = 0x20
+	typeUint64        = 0x27
+	typeInt8          = 0x28
+	typeInt64         = 0x2f
+	typeEnum8         = 0x30
+	typeEnum16        = 0x31
+	typeSemiFloat     = 0x38
+	typeFloat         = 0x39
+	typeDouble        = 0x3a
+	typeOctetString   = 0x41
+	typeCharString    = 0x42
+	typeLongOctetStr  = 0x43
+	typeLongCharStr   = 0x44
+	typeArray         = 0x48
+	typeStructure     = 0x4c
+	typeSet           = 0x50
+	typeBag           = 0x51
+	typeTimeOfDay     = 0xe0
+	typeDate          = 0xe1
+	typeUTCTime       = 0xe2
+	typeClusterID     = 0xe8
+	typeAttributeID   = 0xe9
+	typeBACnetOID     = 0xea
+	typeIEEEAddress   = 0xf0
+	typeSecurityKey   = 0xf1
+	typeUnknown       = 0xff
+	maxDataTypeDepth  = 16
+	invalidLength8    = 0xff
+	invalidLength16   = 0xffff
+	securityKeyLength = 16
+)
+
+var dataTypeNames = scalar.UintMapSymStr{
+	typeNoData:       "nodata",
+	0x08:             "data8",
+	0x09:             "data16",
+	0x0a:             "data24",
+	0x0b:             "data32",
+	0x0c:             "data40",
+	0x0d:             "data48",
+	0x0e:             "data56",
+	0x0f:             "data64",
+	typeBool:         "bool",
+	0x18:             "bitmap8",
+	0x19:             "bitmap16",
+	0x1a:             "bitmap24",
+	0x1b:             "bitmap32",
+	0x1c:             "bitmap40",
+	0x1d:             "bitmap48",
+	0x1e:             "bitmap56",
+	0x1f:             "bitmap64",
+	0x20:             "uint8",
+	0x21:             "uint16",
+	0x22:             "uint24",
+	0x23:             "uint32",
+	0x24:             "uint40",
+	0x25:             "uint48",
+	0x26:             "uint56",
+	0x27:             "uint64",
+	0x28:             "int8",
+	0x29:             "int16",
+	0x2a:             "int24",
+	0x2b:             "int32",
+	0x2c:             "int40",
+	0x2d:             "int48",
+	0x2e:             "int56",
+	0x2f:             "int64",
+	typeEnum8:        "enum8",
+	typeEnum16:       "enum16",
+	typeSemiFloat:    "semi_float",
+	typeFloat:        "float",
+	typeDouble:       "double",
+	typeOctetString:  "octet_string",
+	typeCharString:   "char_string",
+	typeLongOctetStr: "long_octet_string",
+	typeLongCharStr:  "long_char_string",
+	typeArray:        "array",
+	typeStructure:    "structure",
+	typeSet:          "set",
+	typeBag:          "bag",
+	typeTimeOfDay:    "time_of_day",
+	typeDate:         "date",
+	typeUTCTime:      "utc_time",
+	typeClusterID:    "cluster_id",
+	typeAttributeID:  "attribute_id",
+	typeBACnetOID:    "bacnet_oid",
+	typeIEEEAddress:  "ieee_address",
+	typeSecurityKey:  "security_key",
+	typeUnknown:      "unknown",
+}
+
+// utc_time is seconds since 2000-01-01 00:00:00 UTC
+var utcTimeEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// analog data types has a reportable change field when configuring reporting
+func isAnalogDataType(t uint64) bool {
+	return (t >= typeUint8 && t <= typeInt64) ||
+		(t >= typeSemiFloat && t <= typeDouble) ||
+		(t >= typeTimeOfDay && t <= typeUTCTime)
+}
+
+func decodeDataValue(d *decode.D, name string, dataType uint64, depth int) {
+	if depth > maxDataTypeDepth {
+		d.Fatalf("max data type nesting depth %d reached", maxDataTypeDepth)
+	}
+
+	switch {
+	case dataType == typeNoData, dataType == typeUnknown:
+		// no value
+	case dataType >= typeData8 && dataType <= typeData64:
+		d.FieldRawLen(name, int64(dataType-typeData8+1)*8)
+	case dataType == typeBool:
+		d.FieldU8(name, scalar.UintMapSymBool{0: false, 1: true})
+	case dataType >= typeBitmap8 && dataType <= typeBitmap64:
+		d.FieldU(name, int(dataType-typeBitmap8+1)*8, scalar.UintHex)
+	case dataType >= typeUint8 && dataType <= typeUint64:
+		d.FieldU(name, int(dataType-typeUint8+1)*8)
+	case dataType >= typeInt8 && dataType <= typeInt64:
+		d.FieldS(name, int(dataType-typeInt8+1)*8)
+	case dataType == typeEnum8:
+		d.FieldU8(name)
+	case dataType == typeEnum16:
+		d.FieldU16(name)
+	case dataType == typeSemiFloat:
+		d.FieldF16(name)
+	case dataType == typeFloat:
+		d.FieldF32(name)
+	case dataType == typeDouble:
+		d.FieldF64(name)
+	case dataType == typeOctetString, dataType == typeCharString,
+		dataType == typeLongOctetStr, dataType == typeLongCharStr:
+		d.FieldStruct(name, func(d *decode.D) {
+			var length uint64
+			invalid := false
+			if dataType == typeOctetString || dataType == typeCharString {
+				length = d.FieldU8("length")
+				invalid = length == invalidLength8
+			} else {
+				length = d.FieldU16("length")
+				invalid = length == invalidLength16
+			}
+			if invalid {
+				return
+			}
+			if dataType == typeCharString || dataType == typeLongCharStr {
+				d.FieldUTF8("value", int(length))
+			} else {
+				d.FieldRawLen("value", int64(length)*8)
+			}
+		})
+	case dataType == typeArray, dataType == typeSet, dataType == typeBag:
+		d.FieldStruct(name, func(d *decode.D) {
+			elementType := d.FieldU8("element_type", dataTypeNames, scalar.UintHex)
+			count := d.FieldU16("count")
+			if count == invalidLength16 {
+				return
+			}
+			d.FieldArray("elements", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					decodeDataValue(d, "element", elementType, depth+1)
+				}
+			})
+		})
+	case dataType == typeStructure:
+		d.FieldStruct(name, func(d *decode.D) {
+			count := d.FieldU16("count")
+			if count == invalidLength16 {
+				return
+			}
+			d.FieldArray("elements", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("element", func(d *decode.D) {
+						elementType := d.FieldU8("data_type", dataTypeNames, scalar.UintHex)
+						decodeDataValue(d, "value", elementType, depth+1)
+					})
+				}
+			})
+		})
+	case dataType == typeTimeOfDay:
+		d.FieldStruct(name, func(d *decode.D) {
+			d.FieldU8("hours")
+			d.FieldU8("minutes")
+			d.FieldU8("seconds")
+			d.FieldU8("hundredths")
+		})
+	case dataType == typeDate:
+		d.FieldStruct(name, func(d *decode.D) {
+			d.FieldU8("year", scalar.UintActualAdd(1900))
+			d.FieldU8("month")
+			d.FieldU8("day_of_month")
+			d.FieldU8("day_of_week")
+		})
+	case dataType == typeUTCTime:
+		d.FieldU32(name, scalar.UintActualDateDescription(utcTimeEpoch, time.Second, time.RFC3339))
+	case dataType == typeClusterID:
+		d.FieldU16(name, scalar.UintHex)
+	case dataType == typeAttributeID:
+		d.FieldU16(name, scalar.UintHex)
+	case dataType == typeBACnetOID:
+		d.FieldU32(name, scalar.UintHex)
+	case dataType == typeIEEEAddress:
+		d.FieldU64(name, scalar.UintHex)
+	case dataType == typeSecurityKey:
+		d.FieldRawLen(name, securityKeyLength*8, scalar.RawHex)
+	default:
+		d.Fatalf("unknown data type %d", dataType)
+	}
+}
+
+func fieldDataTypeValue(d *decode.D) {
+	dataType := d.FieldU8("data_type", dataTypeNames, scalar.UintHex)
+	decodeDataValue(d, "value", dataType, 0)
+}
+
+func fieldRecords(d *decode.D, fn func(d *decode.D)) {
+	d.FieldArray("records", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("record", fn)
+		}
+	})
+}
+
+func decodeReportingConfiguration(d *decode.D) {
+	direction := d.FieldU8("direction", reportDirectionNames)
+	d.FieldU16("attribute_id", scalar.UintHex)
+	if direction != 0 {
+		d.FieldU16("timeout_period")
+		return
+	}
+	dataType := d.FieldU8("data_type", dataTypeNames, scalar.UintHex)
+	d.FieldU16("minimum_reporting_interval")
+	d.FieldU16("maximum_reporting_interval")
+	if isAnalogDataType(dataType) {
+		decodeDataValue(d, "reportable_change", dataType, 0)
+	}
+}
+
+func decodeGlobalCommand(d *decode.D, commandID uint64) bool {
+	switch commandID {
+	case cmdReadAttributes:
+		d.FieldArray("attribute_ids", func(d *decode.D) {
+			for !d.End() {
+				d.FieldU16("attribute_id", scalar.UintHex)
+			}
+		})
+	case cmdReadAttributesResponse:
+		fieldRecords(d, func(d *decode.D) {
+			d.FieldU16("attribute_id", scalar.UintHex)
+			if d.FieldU8("status", statusNames, scalar.UintHex) == statusSuccess {
+				fieldDataTypeValue(d)
+			}
+		})
+	case cmdWriteAttributes, cmdWriteAttributesUndivided, cmdWriteAttributesNoResponse, cmdReportAttributes:
+		fieldRecords(d, func(d *decode.D) {
+			d.FieldU16("attribute_id", scalar.UintHex)
+			fieldDataTypeValue(d)
+		})
+	case cmdWriteAttributesResponse:
+		// a single success status is sent without attribute id
+		fieldRecords(d, func(d *decode.D) {
+			d.FieldU8("status", statusNames, scalar.UintHex)
+			if !d.End() {
+				d.FieldU16("attribute_id", scalar.UintHex)
+			}
+		})
+	case cmdConfigureReporting:
+		fieldRecords(d, decodeReportingConfiguration)
+	case cmdConfigureReportingResponse:
+		// a single success status is sent without direction and attribute id
+		fieldRecords(d, func(d *decode.D) {
+			d.FieldU8("status", statusNames, scalar.UintHex)
+			if !d.End() {
+				d.FieldU8("direction", reportDirectionNames)
+				d.FieldU16("attribute_id", scalar.UintHex)
+			}
+		})
+	case cmdReadReportingConfiguration:
+		fieldRecords(d, func(d *decode.D) {
+			d.FieldU8("direction", reportDirectionNames)
+			d.FieldU16("attribute_id", scalar.UintHex)
+		})
+	case cmdReadReportingConfigurationResponse:
+		fieldRecords(d, func(d *decode.D) {
+			if d.FieldU8("status", statusNames, scalar.UintHex) == statusSuccess {
+				decodeReportingConfiguration(d)
+				return
+			}
+			d.FieldU8("direction", reportDirectionNames)
+			d.FieldU16("attribute_id", scalar.UintHex)
+		})
+	case cmdDefaultResponse:
+		d.FieldU8("command_id", scalar.UintHex)
+		d.FieldU8("status", statusNames, scalar.UintHex)
+	case cmdDiscoverAttributes, cmdDiscoverAttributesExtended:
+		d.FieldU16("start_attribute_id", scalar.UintHex)
+		d.FieldU8("maximum_attribute_ids")
+	case cmdDiscoverAttributesResponse:
+		d.FieldU8("discovery_complete", scalar.UintMapSymBool{0: false, 1: true})
+		fieldRecords(d, func(d *decode.D) {
+			d.FieldU16("attribute_id", scalar.UintHex)
+			d.FieldU8("data_type", dataTypeNames, scalar.UintHex)
+		})
+	case cmdDiscoverAttributesExtendedResponse:
+		d.FieldU8("discovery_complete", scalar.UintMapSymBool{0: false, 1: true})
+		fieldRecords(d, func(d *decode.D) {
+			d.FieldU16("attribute_id", scalar.UintHex)
+			d.FieldU8("data_type", dataTypeNames, scalar.UintHex)
+			d.FieldStruct("access_control", func(d *decode.D) {
+				d.FieldU5("reserved")
+				d.FieldBool("reportable")
+				d.FieldBool("writeable")
+				d.FieldBool("readable")
+			})
+		})
+	case cmdDiscoverCommandsReceived, cmdDiscoverCommandsGenerated:
+		d.FieldU8("start_command_id", scalar.UintHex)
+		d.FieldU8("maximum_command_ids")
+	case cmdDiscoverCommandsReceivedResponse, cmdDiscoverCommandsGeneratedResponse:
+		d.FieldU8("discovery_complete", scalar.UintMapSymBool{0: false, 1: true})
+		d.FieldArray("command_ids", func(d *decode.D) {
+			for !d.End() {
+				d.FieldU8("command_id", scalar.UintHex)
+			}
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+func decodeZigbeeZCL(d *decode.D) any {
+	var zi format.Zigbee_ZCL_In
+	d.ArgAs(&zi)
+
+	d.Endian = decode.LittleEndian
+
+	var frameType uint64
+	var manufacturerSpecific bool
+	var direction uint64
+	d.FieldStruct("frame_control", func(d *decode.D) {
+		d.FieldU3("reserved")
+		d.FieldBool("disable_default_response")
+		direction = d.FieldU1("direction", directionNames)
+		manufacturerSpecific = d.FieldBool("manufacturer_specific")
+		frameType = d.FieldU2("frame_type", frameTypeNames)
+	})
+	if frameType != frameTypeGlobal && frameType != frameTypeClusterSpecific {
+		d.Fatalf("unknown frame type %d", frameType)
+	}
+	if manufacturerSpecific {
+		d.FieldU16("manufacturer_code", scalar.UintHex)
+	}
+	d.FieldU8("transaction_sequence_number")
+
+	if zi.ClusterID >= 0 {
+		d.FieldValueSint("cluster_id", int64(zi.ClusterID), clusterNames)
+	}
+
+	// manufacturer specific commands has manufacturer defined command ids
+	var commandNames scalar.UintMapSymStr
+	switch {
+	case manufacturerSpecific:
+	case frameType == frameTypeGlobal:
+		commandNames = globalCommandNames
+	case direction == directionClientToServer:
+		commandNames = clusterCommandNames[int64(zi.ClusterID)]
+	}
+	commandID := d.FieldU8("command_id", commandNames, scalar.UintHex)
+
+	if d.BitsLeft() == 0 {
+		return nil
+	}
+	if frameType == frameTypeGlobal && !manufacturerSpecific {
+		d.FieldStruct("payload", func(d *decode.D) {
+			if !decodeGlobalCommand(d, commandID) {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		})
+	} else {
+		d.FieldRawLen("payload", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -26,6 +26,8 @@ func init() {
 		format.Zip,
 		&decode.Format{
 			Description: "ZIP archive",
+			Extensions:  []string{"zip", "jar", "apk"},
+			MIMETypes:   []string{"application/zip"},
 			Groups:      []*decode.Group{format.Probe},
 			DecodeFn:    zipDecode,
 			DefaultInArg: format.Zip_In{
@@ -54,6 +56,7 @@ const (
 	compressionMethodIBMTERSE                  = 18
 	compressionMethodIBMLZ77z                  = 19
 	compressionMethodPPMd                      = 98
+	compressionMethodAEx                       = 99
 )
 
 var compressionMethodMap = scalar.UintMapSymStr{
@@ -72,6 +75,7 @@ var compressionMethodMap = scalar.UintMapSymStr{
 	compressionMethodIBMTERSE:                  "ibmterse",
 	compressionMethodIBMLZ77z:                  "ibmlz77z",
 	compressionMethodPPMd:                      "pp_md",
+	compressionMethodAEx:                       "aex_encrypted",
 }
 
 var (
@@ -88,8 +92,34 @@ var (
 const (
 	headerTagZip64ExtendedInformation = 0x001
 	headerTagExtendedTimestamp        = 0x5455
+	headerTagAExEncryption            = 0x9901
 )
 
+// values in headers that means the ZIP64 extended information extra field value should be used
+const (
+	zip64Size16 = 0xffff
+	zip64Size32 = 0xffff_ffff
+)
+
+const aexAuthenticationCodeLength = 10
+
+var aexVendorVersionMap = scalar.UintMapSymStr{
+	1: "ae_1",
+	2: "ae_2",
+}
+
+var aexStrengthMap = scalar.UintMap{
+	1: {Sym: "aes_128", Description: "128-bit AES"},
+	2: {Sym: "aes_192", Description: "192-bit AES"},
+	3: {Sym: "aes_256", Description: "256-bit AES"},
+}
+
+var aexSaltLength = map[uint64]int{
+	1: 8,
+	2: 12,
+	3: 16,
+}
+
 var headerTagMap = scalar.UintMapDescription{
 	headerTagZip64ExtendedInformation: "ZIP64 extended information extra field",
 	0x0007:                            "AV Info",
@@ -130,6 +160,7 @@ var headerTagMap = scalar.UintMapDescription{
 	0x7855:                     "Info-ZIP Unix (new)",
 	0x7875:                     "UNIX UID/GID",
 	0xfb4a:                     "SMS/QDOS",
+	headerTagAExEncryption:     "AE-x encryption structure",
 }
 
 // "MS-DOS uses year values relative to 1980 and 2 second precision."
@@ -146,10 +177,7 @@ func fieldMSDOSTime(d *decode.D) (int, int, int) {
 	second := (fatTime >> 0) & 0b1_1111
 	minute := (fatTime >> 5) & 0b11_1111
 	hour := (fatTime >> (5 + 6)) & 0b1_1111
-	d.FieldValueUint("second", second, scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
-		s.Sym = s.Actual * 2
-		return s, nil
-	}))
+	d.FieldValueUint("second", second, scalar.UintScale(2))
 	d.FieldValueUint("minute", minute)
 	d.FieldValueUint("hour", hour)
 
@@ -167,10 +195,7 @@ func fieldMSDOSDate(d *decode.D) (int, int, int) {
 	year := (fatDate >> (5 + 4)) & 0b111_1111
 	d.FieldValueUint("day", day)
 	d.FieldValueUint("month", month)
-	d.FieldValueUint("year", year, scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
-		s.Sym = s.Actual + 1980
-		return s, nil
-	}))
+	d.FieldValueUint("year", year, scalar.UintOffset(1980))
 
 	return int(day), int(month), int(year)
 }
@@ -223,33 +248,88 @@ type zip64ExtendedInformation struct {
 	diskNumberWhereFileStartsPresent bool
 }
 
-func fieldTagZip64ExtendedInformation(d *decode.D) zip64ExtendedInformation {
+// zip64Needed is which header values are zip64Size* and should be in the ZIP64 extended information
+type zip64Needed struct {
+	uncompressedSize          bool
+	compressedSize            bool
+	localFileOffset           bool
+	diskNumberWhereFileStarts bool
+}
+
+func (zn zip64Needed) size() int64 {
+	var n int64
+	for _, b := range []bool{zn.uncompressedSize, zn.compressedSize, zn.localFileOffset} {
+		if b {
+			n += 8
+		}
+	}
+	if zn.diskNumberWhereFileStarts {
+		n += 4
+	}
+	return n
+}
+
+func fieldTagZip64ExtendedInformation(d *decode.D, zn zip64Needed) zip64ExtendedInformation {
 	zi := zip64ExtendedInformation{}
 
-	zi.uncompressedSize = d.FieldU64("uncompressed_size")
-	zi.uncompressedSizePresent = true
-	// TODO: spec says these should be here but real zip64 seems to not have them? optional?
-	if !d.End() {
+	// Fields should only be present if the corresponding header value is zip64Size*, but some
+	// writers include all fields or fields in other combinations, so fallback to reading them
+	// in order if the size does not match
+	if zn.size() != d.BitsLeft()/8 {
+		zn = zip64Needed{
+			uncompressedSize:          d.BitsLeft() >= 8*8,
+			compressedSize:            d.BitsLeft() >= 16*8,
+			localFileOffset:           d.BitsLeft() >= 24*8,
+			diskNumberWhereFileStarts: d.BitsLeft() >= 28*8,
+		}
+	}
+
+	if zn.uncompressedSize {
+		zi.uncompressedSize = d.FieldU64("uncompressed_size")
+		zi.uncompressedSizePresent = true
+	}
+	if zn.compressedSize {
 		zi.compressedSize = d.FieldU64("compressed_size")
 		zi.compressedSizePresent = true
 	}
-	if !d.End() {
+	if zn.localFileOffset {
 		zi.localFileOffset = d.FieldU64("relative_offset_of_local_file_header")
 		zi.localFileOffsetPresent = true
 	}
-	if !d.End() {
+	if zn.diskNumberWhereFileStarts {
 		zi.diskNumberWhereFileStarts = d.FieldU32("disk_number_where_file_starts")
 		zi.diskNumberWhereFileStartsPresent = true
 	}
+	if !d.End() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
 	return zi
 }
 
+type aexEncryption struct {
+	strength          uint64
+	compressionMethod uint64
+}
+
+// https://www.winzip.com/en/support/aes-encryption/
+func fieldTagAExEncryption(d *decode.D) aexEncryption {
+	var ae aexEncryption
+	d.FieldU16("vendor_version", aexVendorVersionMap)
+	d.FieldUTF8("vendor_id", 2)
+	ae.strength = d.FieldU8("strength", aexStrengthMap)
+	ae.compressionMethod = d.FieldU16("compression_method", compressionMethodMap)
+	return ae
+}
+
 type extraFields struct {
 	zip64ExtendedInformation        zip64ExtendedInformation
 	zip64ExtendedInformationPresent bool
+	aexEncryption                   aexEncryption
+	aexEncryptionPresent            bool
 }
 
-func fieldsExtraFields(d *decode.D) extraFields {
+func fieldsExtraFields(d *decode.D, zn zip64Needed) extraFields {
 	ef := extraFields{}
 
 	for !d.End() {
@@ -259,10 +339,13 @@ func fieldsExtraFields(d *decode.D) extraFields {
 			d.FramedFn(int64(size)*8, func(d *decode.D) {
 				switch tag {
 				case headerTagZip64ExtendedInformation:
-					ef.zip64ExtendedInformation = fieldTagZip64ExtendedInformation(d)
+					ef.zip64ExtendedInformation = fieldTagZip64ExtendedInformation(d, zn)
 					ef.zip64ExtendedInformationPresent = true
 				case headerTagExtendedTimestamp:
 					fieldExtendedTimestamp(d)
+				case headerTagAExEncryption:
+					ef.aexEncryption = fieldTagAExEncryption(d)
+					ef.aexEncryptionPresent = true
 				default:
 					d.FieldRawLen("data", int64(size)*8)
 				}
@@ -272,6 +355,53 @@ func fieldsExtraFields(d *decode.D) extraFields {
 	return ef
 }
 
+type centralDirectoryEntry struct {
+	fileName          string
+	compressionMethod uint64
+	crc32             uint64
+	compressedSize    uint64
+	uncompressedSize  uint64
+	localFileOffset   uint64
+}
+
+type localFileEntry struct {
+	fileName          string
+	compressionMethod uint64
+	crc32             uint64
+	compressedSize    uint64
+	uncompressedSize  uint64
+}
+
+// central directory and local file header disagreeing can be used to make different
+// zip implementations see different content
+func fieldCentralDirectoryMismatches(d *decode.D, cd centralDirectoryEntry, lf localFileEntry) {
+	var mismatches []string
+	if cd.fileName != lf.fileName {
+		mismatches = append(mismatches, "file_name")
+	}
+	if cd.compressionMethod != lf.compressionMethod {
+		mismatches = append(mismatches, "compression_method")
+	}
+	if cd.crc32 != lf.crc32 {
+		mismatches = append(mismatches, "crc32_uncompressed")
+	}
+	if cd.compressedSize != lf.compressedSize {
+		mismatches = append(mismatches, "compressed_size")
+	}
+	if cd.uncompressedSize != lf.uncompressedSize {
+		mismatches = append(mismatches, "uncompressed_size")
+	}
+
+	d.FieldValueBool("central_directory_match", len(mismatches) == 0)
+	if len(mismatches) > 0 {
+		d.FieldArray("central_directory_mismatches", func(d *decode.D) {
+			for _, m := range mismatches {
+				d.FieldValueStr("field", m)
+			}
+		})
+	}
+}
+
 func zipDecode(d *decode.D) any {
 	var zi format.Zip_In
 	d.ArgAs(&zi)
@@ -348,7 +478,7 @@ func zipDecode(d *decode.D) any {
 		})
 	}
 
-	var localFileOffsets []uint64
+	var centralDirectoryEntries []centralDirectoryEntry
 
 	d.SeekAbs(int64(offsetCD) * 8)
 	d.FieldArray("central_directories", func(d *decode.D) {
@@ -375,32 +505,49 @@ func zipDecode(d *decode.D) any {
 						d.FieldBool("language_encoding")
 						d.FieldU3("unused1")
 					})
-					d.FieldU16("compression_method", compressionMethodMap)
+					var cde centralDirectoryEntry
+					cde.compressionMethod = d.FieldU16("compression_method", compressionMethodMap)
 					d.FieldStruct("last_modification", fieldTimeDate)
-					d.FieldU32("crc32_uncompressed", scalar.UintHex)
-					d.FieldU32("compressed_size")
-					d.FieldU32("uncompressed_size")
+					cde.crc32 = d.FieldU32("crc32_uncompressed", scalar.UintHex)
+					cde.compressedSize = d.FieldU32("compressed_size")
+					cde.uncompressedSize = d.FieldU32("uncompressed_size")
 					fileNameLength := d.FieldU16("file_name_length")
 					extraFieldLength := d.FieldU16("extra_field_length")
 					fileCommentLength := d.FieldU16("file_comment_length")
 					diskNrStart := d.FieldU16("disk_number_where_file_starts")
 					d.FieldU16("internal_file_attributes")
 					d.FieldU32("external_file_attributes")
-					localFileOffset := d.FieldU32("relative_offset_of_local_file_header")
-					d.FieldUTF8("file_name", int(fileNameLength))
+					cde.localFileOffset = d.FieldU32("relative_offset_of_local_file_header")
+					cde.fileName = d.FieldUTF8("file_name", int(fileNameLength))
 					d.FieldArray("extra_fields", func(d *decode.D) {
 						d.FramedFn(int64(extraFieldLength)*8, func(d *decode.D) {
-							ef := fieldsExtraFields(d)
-							if ef.zip64ExtendedInformationPresent &&
-								ef.zip64ExtendedInformation.localFileOffsetPresent {
-								localFileOffset = ef.zip64ExtendedInformation.localFileOffset
+							ef := fieldsExtraFields(d, zip64Needed{
+								uncompressedSize:          cde.uncompressedSize == zip64Size32,
+								compressedSize:            cde.compressedSize == zip64Size32,
+								localFileOffset:           cde.localFileOffset == zip64Size32,
+								diskNumberWhereFileStarts: diskNrStart == zip64Size16,
+							})
+							if ef.zip64ExtendedInformationPresent {
+								zi := ef.zip64ExtendedInformation
+								if zi.uncompressedSizePresent {
+									cde.uncompressedSize = zi.uncompressedSize
+								}
+								if zi.compressedSizePresent {
+									cde.compressedSize = zi.compressedSize
+								}
+								if zi.localFileOffsetPresent {
+									cde.localFileOffset = zi.localFileOffset
+								}
+								if zi.diskNumberWhereFileStartsPresent {
+									diskNrStart = zi.diskNumberWhereFileStarts
+								}
 							}
 						})
 					})
 					d.FieldUTF8("file_comment", int(fileCommentLength))
 
 					if diskNrStart == diskNr {
-						localFileOffsets = append(localFileOffsets, localFileOffset)
+						centralDirectoryEntries = append(centralDirectoryEntries, cde)
 					}
 				})
 			}
@@ -408,10 +555,12 @@ func zipDecode(d *decode.D) any {
 	})
 
 	d.FieldArray("local_files", func(d *decode.D) {
-		for _, o := range localFileOffsets {
-			d.SeekAbs(int64(o) * 8)
+		for _, cde := range centralDirectoryEntries {
+			d.SeekAbs(int64(cde.localFileOffset) * 8)
 			d.FieldStruct("local_file", func(d *decode.D) {
 				var hasDataDescriptor bool
+				var encrypted bool
+				var lfe localFileEntry
 				d.FieldRawLen("signature", 4*8, d.AssertBitBuf(localFileSignature))
 				d.FieldU16("version_needed")
 				d.FieldStruct("flags", func(d *decode.D) {
@@ -423,7 +572,7 @@ func zipDecode(d *decode.D) any {
 					hasDataDescriptor = d.FieldBool("data_descriptor")
 					d.FieldBool("compression0")
 					d.FieldBool("compression1")
-					d.FieldBool("encrypted")
+					encrypted = d.FieldBool("encrypted")
 
 					d.FieldU2("reserved0")
 					d.FieldBool("mask_header_values")
@@ -431,23 +580,39 @@ func zipDecode(d *decode.D) any {
 					d.FieldBool("language_encoding")
 					d.FieldU3("unused1")
 				})
-				compressionMethod := d.FieldU16("compression_method", compressionMethodMap)
+				lfe.compressionMethod = d.FieldU16("compression_method", compressionMethodMap)
 				d.FieldStruct("last_modification", fieldTimeDate)
-				d.FieldU32("crc32_uncompressed", scalar.UintHex)
-				compressedSizeBytes := d.FieldU32("compressed_size")
-				d.FieldU32("uncompressed_size")
+				lfe.crc32 = d.FieldU32("crc32_uncompressed", scalar.UintHex)
+				lfe.compressedSize = d.FieldU32("compressed_size")
+				lfe.uncompressedSize = d.FieldU32("uncompressed_size")
 				fileNameLength := d.FieldU16("file_name_length")
 				extraFieldLength := d.FieldU16("extra_field_length")
-				d.FieldUTF8("file_name", int(fileNameLength))
+				lfe.fileName = d.FieldUTF8("file_name", int(fileNameLength))
+				var ef extraFields
 				d.FieldArray("extra_fields", func(d *decode.D) {
 					d.FramedFn(int64(extraFieldLength)*8, func(d *decode.D) {
-						ef := fieldsExtraFields(d)
-						if ef.zip64ExtendedInformationPresent &&
-							ef.zip64ExtendedInformation.compressedSizePresent {
-							compressedSizeBytes = ef.zip64ExtendedInformation.compressedSize
+						// local header ZIP64 extended information should have both sizes
+						ef = fieldsExtraFields(d, zip64Needed{
+							uncompressedSize: true,
+							compressedSize:   true,
+						})
+						if ef.zip64ExtendedInformationPresent {
+							zi := ef.zip64ExtendedInformation
+							if zi.uncompressedSizePresent {
+								lfe.uncompressedSize = zi.uncompressedSize
+							}
+							if zi.compressedSizePresent {
+								lfe.compressedSize = zi.compressedSize
+							}
 						}
 					})
 				})
+
+				compressedSizeBytes := lfe.compressedSize
+				if hasDataDescriptor && compressedSizeBytes == 0 {
+					// sizes are in data descriptor after data, use central directory size
+					compressedSizeBytes = cde.compressedSize
+				}
 				compressedSize := int64(compressedSizeBytes) * 8
 				compressedStart := d.Pos()
 
@@ -456,12 +621,32 @@ func zipDecode(d *decode.D) any {
 					compressedLimit = d.BitsLeft()
 				}
 
-				if compressionMethod == compressionMethodNone {
+				switch {
+				case lfe.compressionMethod == compressionMethodAEx && ef.aexEncryptionPresent:
+					d.FieldStruct("encrypted", func(d *decode.D) {
+						saltLength, ok := aexSaltLength[ef.aexEncryption.strength]
+						if !ok {
+							d.FieldRawLen("data", compressedSize)
+							return
+						}
+						dataLength := compressedSize - int64(saltLength+2+aexAuthenticationCodeLength)*8
+						if dataLength < 0 {
+							d.FieldRawLen("data", compressedSize)
+							return
+						}
+						d.FieldRawLen("salt", int64(saltLength)*8)
+						d.FieldU16("password_verification", scalar.UintHex)
+						d.FieldRawLen("data", dataLength)
+						d.FieldRawLen("authentication_code", aexAuthenticationCodeLength*8)
+					})
+				case encrypted:
+					d.FieldRawLen("encrypted", compressedSize)
+				case lfe.compressionMethod == compressionMethodNone:
 					d.FieldFormatOrRawLen("uncompressed", compressedSize, &probeGroup, format.Probe_In{})
-				} else {
+				default:
 					var rFn func(r io.Reader) io.Reader
 					if zi.Uncompress {
-						switch compressionMethod {
+						switch lfe.compressionMethod {
 						case compressionMethodDeflated:
 							// bitio.NewIOReadSeeker implements io.ByteReader so that deflate don't do own
 							// buffering and might read more than needed messing up knowing compressed size
@@ -494,11 +679,19 @@ func zipDecode(d *decode.D) any {
 						if bytes.Equal(d.PeekBytes(4), dataIndicatorSignature) {
 							d.FieldRawLen("signature", 4*8, d.AssertBitBuf(dataIndicatorSignature))
 						}
-						d.FieldU32("crc32_uncompressed", scalar.UintHex)
-						d.FieldU32("compressed_size")
-						d.FieldU32("uncompressed_size")
+						lfe.crc32 = d.FieldU32("crc32_uncompressed", scalar.UintHex)
+						// ZIP64 data descriptor has 8 byte sizes
+						if ef.zip64ExtendedInformationPresent {
+							lfe.compressedSize = d.FieldU64("compressed_size")
+							lfe.uncompressedSize = d.FieldU64("uncompressed_size")
+						} else {
+							lfe.compressedSize = d.FieldU32("compressed_size")
+							lfe.uncompressedSize = d.FieldU32("uncompressed_size")
+						}
 					})
 				}
+
+				fieldCentralDirectoryMismatches(d, cde, lfe)
 			})
 		}
 	})
@@ -0,0 +1,268 @@
+package zstd
+
+// https://www.rfc-editor.org/rfc/rfc8878.html
+
+import (
+	"embed"
+	"encoding/binary"
+
+	"github.com/wader/fq/format"
+	zstddec "github.com/wader/fq/internal/zstd"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed zstd.md
+var zstdFS embed.FS
+
+var probeGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(
+		format.Zstd,
+		&decode.Format{
+			Description: "Zstandard compression",
+			Extensions:  []string{"zst", "zstd"},
+			MIMETypes:   []string{"application/zstd"},
+			Groups:      []*decode.Group{format.Probe},
+			DecodeFn:    zstdDecode,
+			DefaultInArg: format.Zstd_In{
+				Uncompress: true,
+			},
+			Dependencies: []decode.Dependency{
+				{Groups: []*decode.Group{format.Probe}, Out: &probeGroup},
+			},
+		})
+	interp.RegisterFS(zstdFS)
+}
+
+var magicNames = scalar.UintFn(func(s scalar.Uint) (scalar.Uint, error) {
+	switch {
+	case s.Actual == zstddec.FrameMagic:
+		s.Sym = "frame"
+	case s.Actual&zstddec.SkippableMask == zstddec.SkippableMagic:
+		s.Sym = "skippable_frame"
+	}
+	return s, nil
+})
+
+var blockTypeNames = scalar.UintMapSymStr{
+	zstddec.BlockTypeRaw:        "raw",
+	zstddec.BlockTypeRLE:        "rle",
+	zstddec.BlockTypeCompressed: "compressed",
+	zstddec.BlockTypeReserved:   "reserved",
+}
+
+var literalsBlockTypeNames = scalar.UintMapSymStr{
+	zstddec.LiteralsBlockTypeRaw:        "raw",
+	zstddec.LiteralsBlockTypeRLE:        "rle",
+	zstddec.LiteralsBlockTypeCompressed: "compressed",
+	zstddec.LiteralsBlockTypeTreeless:   "treeless",
+}
+
+var sequencesModeNames = scalar.UintMapSymStr{
+	zstddec.SequencesModePredefined: "predefined",
+	zstddec.SequencesModeRLE:        "rle",
+	zstddec.SequencesModeFSE:        "fse_compressed",
+	zstddec.SequencesModeRepeat:     "repeat",
+}
+
+func decodeCompressedBlock(d *decode.D) {
+	lh, err := zstddec.ParseLiteralsSectionHeader(d.PeekBytes(int(min(5, d.BitsLeft()/8))))
+	if err != nil {
+		d.Fatalf("literals section header: %s", err)
+	}
+	d.FieldStruct("literals_section", func(d *decode.D) {
+		d.FieldRawLen("header", int64(lh.Size)*8)
+		d.FieldValueUint("block_type", uint64(lh.BlockType), literalsBlockTypeNames)
+		d.FieldValueUint("size_format", uint64(lh.SizeFormat))
+		d.FieldValueUint("regenerated_size", uint64(lh.RegeneratedSize))
+		d.FieldValueUint("compressed_size", uint64(lh.CompressedSize))
+		d.FieldValueUint("streams", uint64(lh.NumberOfStreams))
+		switch lh.BlockType {
+		case zstddec.LiteralsBlockTypeRLE:
+			d.FieldU8("byte")
+		default:
+			d.FieldRawLen("data", int64(lh.CompressedSize)*8)
+		}
+	})
+
+	d.FieldStruct("sequences_section", func(d *decode.D) {
+		sequences := d.FieldUintFn("number_of_sequences", func(d *decode.D) uint64 {
+			b0 := d.U8()
+			switch {
+			case b0 < 128:
+				return b0
+			case b0 < 255:
+				return (b0-128)<<8 + d.U8()
+			default:
+				return d.U16() + 0x7f00
+			}
+		})
+		if sequences == 0 {
+			return
+		}
+		d.FieldStruct("compression_modes", func(d *decode.D) {
+			d.FieldU2("literals_lengths_mode", sequencesModeNames)
+			d.FieldU2("offsets_mode", sequencesModeNames)
+			d.FieldU2("match_lengths_mode", sequencesModeNames)
+			d.FieldU2("reserved")
+		})
+		d.FieldRawLen("data", d.BitsLeft())
+	})
+}
+
+func decodeFrame(d *decode.D, zi format.Zstd_In) bitio.ReaderAtSeeker {
+	framePos := d.Pos()
+
+	d.FieldU32("magic", magicNames, scalar.UintHex)
+	var singleSegment bool
+	var hasChecksum bool
+	var fcsFlag uint64
+	var didFlag uint64
+	d.FieldStruct("frame_header_descriptor", func(d *decode.D) {
+		fcsFlag = d.FieldU2("frame_content_size_flag")
+		singleSegment = d.FieldBool("single_segment")
+		d.FieldU1("unused")
+		d.FieldU1("reserved")
+		hasChecksum = d.FieldBool("content_checksum")
+		didFlag = d.FieldU2("dictionary_id_flag")
+	})
+	if !singleSegment {
+		d.FieldStruct("window_descriptor", func(d *decode.D) {
+			exponent := d.FieldU5("exponent")
+			mantissa := d.FieldU3("mantissa")
+			windowBase := uint64(1) << (10 + exponent)
+			d.FieldValueUint("window_size", windowBase+(windowBase/8)*mantissa)
+		})
+	}
+	var dictionaryID uint64
+	switch didFlag {
+	case 1:
+		dictionaryID = d.FieldU8("dictionary_id")
+	case 2:
+		dictionaryID = d.FieldU16("dictionary_id")
+	case 3:
+		dictionaryID = d.FieldU32("dictionary_id")
+	}
+	switch {
+	case fcsFlag == 0 && singleSegment:
+		d.FieldU8("frame_content_size")
+	case fcsFlag == 1:
+		d.FieldU16("frame_content_size", scalar.UintActualAdd(256))
+	case fcsFlag == 2:
+		d.FieldU32("frame_content_size")
+	case fcsFlag == 3:
+		d.FieldU64("frame_content_size")
+	}
+
+	d.FieldArray("blocks", func(d *decode.D) {
+		for {
+			last := false
+			d.FieldStruct("block", func(d *decode.D) {
+				header := d.FieldU24("header", scalar.UintHex)
+				last = header&1 != 0
+				blockType := (header >> 1) & 0x3
+				blockSize := int64(header >> 3)
+				d.FieldValueBool("last_block", last)
+				d.FieldValueUint("block_type", blockType, blockTypeNames)
+				d.FieldValueUint("block_size", uint64(blockSize))
+
+				switch blockType {
+				case zstddec.BlockTypeRaw:
+					d.FieldRawLen("data", blockSize*8)
+				case zstddec.BlockTypeRLE:
+					d.FieldU8("byte")
+				case zstddec.BlockTypeCompressed:
+					d.FramedFn(blockSize*8, decodeCompressedBlock)
+				default:
+					d.Fatalf("reserved block type")
+				}
+			})
+			if last {
+				break
+			}
+		}
+	})
+
+	var content []byte
+	decompressed := false
+	if zi.Uncompress && dictionaryID == 0 {
+		frameLen := (d.Pos() - framePos) / 8
+		if hasChecksum {
+			frameLen += 4
+		}
+		var err error
+		content, _, err = zstddec.DecompressFrame(nil, d.BytesRange(framePos, int(frameLen)))
+		if err != nil {
+			d.Fatalf("decompress: %s", err)
+		}
+		decompressed = true
+	}
+
+	if hasChecksum {
+		if decompressed {
+			d.FieldU32("content_checksum", d.UintValidate(checksum.XXH64(content, 0)&0xffff_ffff), scalar.UintHex)
+		} else {
+			d.FieldU32("content_checksum", scalar.UintHex)
+		}
+	}
+
+	if !decompressed {
+		return nil
+	}
+	return bitio.NewBitReader(content, -1)
+}
+
+func zstdDecode(d *decode.D) any {
+	var zi format.Zstd_In
+	d.ArgAs(&zi)
+
+	d.Endian = decode.LittleEndian
+
+	frames := 0
+	var brs []bitio.ReadAtSeeker
+	d.FieldArray("frames", func(d *decode.D) {
+		for !d.End() {
+			magic := binary.LittleEndian.Uint32(d.PeekBytes(4))
+			switch {
+			case magic == zstddec.FrameMagic:
+				d.FieldStruct("frame", func(d *decode.D) {
+					if br := decodeFrame(d, zi); br != nil {
+						brs = append(brs, br)
+					}
+				})
+			case magic&zstddec.SkippableMask == zstddec.SkippableMagic:
+				d.FieldStruct("frame", func(d *decode.D) {
+					d.FieldU32("magic", magicNames, scalar.UintHex)
+					size := d.FieldU32("frame_size")
+					d.FieldRawLen("user_data", int64(size)*8)
+				})
+			default:
+				d.Fatalf("unknown frame magic %08x", magic)
+			}
+			frames++
+		}
+	})
+
+	if frames == 0 {
+		d.Fatalf("no frames found")
+	}
+	if len(brs) == 0 {
+		return nil
+	}
+
+	cbr, err := bitio.NewMultiReader(brs...)
+	if err != nil {
+		d.IOPanic(err, "frames", "NewMultiReader")
+	}
+	dv, _, _ := d.TryFieldFormatBitBuf("uncompressed", cbr, &probeGroup, format.Probe_In{})
+	if dv == nil {
+		d.FieldRootBitBuf("uncompressed", cbr)
+	}
+
+	return nil
+}
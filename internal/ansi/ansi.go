@@ -128,10 +128,33 @@ var StringToCode = map[string]Code{
 
 var None Code
 
+// truecolor parses "#rrggbb" as 24-bit foreground color and "bg#rrggbb" as background
+func truecolor(s string) (Code, bool) {
+	set, reset := 38, 39
+	if strings.HasPrefix(s, "bg") {
+		s = s[2:]
+		set, reset = 48, 49
+	}
+	if len(s) != 7 || s[0] != '#' {
+		return Code{}, false
+	}
+	rgb, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return Code{}, false
+	}
+	return MakeCode(
+		[]int{set, 2, int(rgb >> 16 & 0xff), int(rgb >> 8 & 0xff), int(rgb & 0xff)},
+		[]int{reset},
+	), true
+}
+
 func FromString(s string) Code {
 	c := Code{}
 	for _, part := range strings.Split(s, "+") {
 		pc, ok := StringToCode[part]
+		if !ok {
+			pc, ok = truecolor(part)
+		}
 		if !ok {
 			continue
 		}
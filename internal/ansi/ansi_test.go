@@ -30,6 +30,26 @@ func TestW(t *testing.T) {
 	}
 }
 
+func TestFromStringTruecolor(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"#ff8000", "\x1b[38;2;255;128;0mtest\x1b[39m"},
+		{"bg#000010+bold", "\x1b[48;2;0;0;16;1mtest\x1b[49;22m"},
+		{"#ff80", "test"},
+		{"#gg0000", "test"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.s, func(t *testing.T) {
+			actual := ansi.FromString(tC.s).Wrap("test")
+			if tC.expected != actual {
+				t.Errorf("expected %q, got %q", tC.expected, actual)
+			}
+		})
+	}
+}
+
 func TestLen(t *testing.T) {
 	testCases := []struct {
 		s string
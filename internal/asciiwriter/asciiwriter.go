@@ -53,7 +53,11 @@ func (h *Writer) Write(p []byte) (n int, err error) {
 	for i := 0; i < len(p); i++ {
 		lineOffset := h.offset % h.width
 
-		s := []byte(h.fn(p[i]))
+		s := h.fn(p[i])
+		// grow if fn returns longer ansi sequences than assumed, +1 for newline
+		if n := h.bufOffset + len(s) + 1; n > len(h.buf) {
+			h.buf = append(h.buf, make([]byte, n-len(h.buf))...)
+		}
 		copy(h.buf[h.bufOffset:], s)
 		h.bufOffset += len(s)
 
@@ -9,11 +9,11 @@ import (
 type Writer struct {
 	w               io.Writer
 	width           int
+	group           int
 	startLineOffset int
 	fn              func(v byte) string
 	offset          int
 	buf             []byte
-	bufOffset       int
 }
 
 // for i in $(seq 0 255) ; do printf "%02x" $i ; done | while read -n 32 s ; do echo "\"$s\""+; done
@@ -40,64 +40,51 @@ func Pair(c byte) string {
 }
 
 func New(w io.Writer, width int, startLineOffset int, fn func(b byte) string) *Writer {
+	return NewGroup(w, width, 1, startLineOffset, fn)
+}
+
+// NewGroup is like New but only separates groups of group bytes with space
+func NewGroup(w io.Writer, width int, group int, startLineOffset int, fn func(b byte) string) *Writer {
 	return &Writer{
 		w:               w,
 		width:           width,
+		group:           max(1, group),
 		startLineOffset: startLineOffset,
 		fn:              fn,
 		offset:          0,
-		// TODO: ansi length? nicer reusable buffer?
-		buf: make([]byte, width*200+1), // worst case " " or "\n" + width*(XX "+ansi) + "\n"
+	}
+}
+
+func (h *Writer) appendSep(b []byte) []byte {
+	lineOffset := h.offset % h.width
+	switch {
+	case h.offset == 0:
+		return b
+	case lineOffset == 0:
+		return append(b, '\n')
+	case lineOffset%h.group == 0:
+		return append(b, ' ')
+	default:
+		return b
 	}
 }
 
 func (h *Writer) Write(p []byte) (n int, err error) {
+	b := h.buf[:0]
 	for h.offset < h.startLineOffset {
-		b := []byte("   ")
-		if h.offset%h.width == h.width-1 {
-			b = []byte("  \n")
-		}
-		if _, err := h.w.Write(b); err != nil {
-			return 0, err
-		}
+		b = h.appendSep(b)
+		b = append(b, "  "...)
 		h.offset++
 	}
-
-	if h.offset > h.startLineOffset {
-		if h.offset%h.width == 0 {
-			h.buf[0] = '\n'
-		} else {
-			h.buf[0] = ' '
-		}
-		h.bufOffset = 1
+	for _, c := range p {
+		b = h.appendSep(b)
+		b = append(b, h.fn(c)...)
+		h.offset++
 	}
+	h.buf = b
 
-	for i := 0; i < len(p); i++ {
-		lineOffset := h.offset % h.width
-		s := []byte(h.fn(p[i]))
-		copy(h.buf[h.bufOffset:], s)
-		h.bufOffset += len(s)
-		h.buf[h.bufOffset] = ' '
-		h.bufOffset++
-
-		var b []byte
-		switch {
-		case i < len(p)-1 && lineOffset == h.width-1:
-			h.buf[h.bufOffset-1] = '\n'
-			b = h.buf[:h.bufOffset]
-		case i == len(p)-1:
-			b = h.buf[:h.bufOffset-1]
-		}
-
-		// log.Printf("i=%d h.bufOffset=%d lineOffset=%d h.width-1=%d b=%q\n", i, h.bufOffset, lineOffset, h.width-1, b)
-		if b != nil {
-			if _, err := h.w.Write(b); err != nil {
-				return 0, err
-			}
-			h.bufOffset = 0
-		}
-
-		h.offset++
+	if _, err := h.w.Write(b); err != nil {
+		return 0, err
 	}
 
 	return len(p), nil
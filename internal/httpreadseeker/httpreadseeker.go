@@ -0,0 +1,142 @@
+package httpreadseeker
+
+// read seeker for a HTTP URL using range requests, falls back to reading
+// whole response body into memory if the server does not support ranges
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Reader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+	offset int64
+	// set if server does not support range requests
+	buf *bytes.Reader
+}
+
+func New(ctx context.Context, client *http.Client, url string) (*Reader, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &Reader{
+		ctx:    ctx,
+		client: client,
+		url:    url,
+	}
+
+	resp, err := r.get("bytes=0-0")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		size, err := contentRangeSize(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+		r.size = size
+	case http.StatusOK:
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.buf = bytes.NewReader(b)
+		r.size = int64(len(b))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// empty resource
+		r.size = 0
+	default:
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	return r, nil
+}
+
+// "bytes 0-0/1234" -> 1234
+func contentRangeSize(s string) (int64, error) {
+	_, size, ok := strings.Cut(s, "/")
+	if !ok || size == "*" {
+		return 0, fmt.Errorf("unknown size in content range %q", s)
+	}
+	return strconv.ParseInt(size, 10, 64)
+}
+
+func (r *Reader) get(rangeHeader string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", rangeHeader)
+	return r.client.Do(req)
+}
+
+func (r *Reader) Size() int64 { return r.size }
+
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.buf != nil {
+		if _, err := r.buf.Seek(r.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		n, err = r.buf.Read(p)
+		r.offset += int64(n)
+		return n, err
+	}
+
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := r.offset + int64(len(p)) - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+
+	resp, err := r.get(fmt.Sprintf("bytes=%d-%d", r.offset, end))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("range request: %s", resp.Status)
+	}
+
+	n, err = io.ReadFull(resp.Body, p[0:end-r.offset+1])
+	r.offset += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = abs
+	return abs, nil
+}
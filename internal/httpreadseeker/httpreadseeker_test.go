@@ -0,0 +1,85 @@
+package httpreadseeker_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wader/fq/internal/httpreadseeker"
+)
+
+func TestRead(t *testing.T) {
+	content := []byte("0123456789abcdef")
+
+	testCases := []struct {
+		name         string
+		handler      http.HandlerFunc
+		expectRanges bool
+	}{
+		{
+			name: "range",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			},
+			expectRanges: true,
+		},
+		{
+			name: "no range",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(content)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				tc.handler(w, r)
+			}))
+			defer ts.Close()
+
+			r, err := httpreadseeker.New(context.Background(), nil, ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Size() != int64(len(content)) {
+				t.Errorf("expected size %d, got %d", len(content), r.Size())
+			}
+
+			if _, err := r.Seek(10, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 4)
+			if _, err := io.ReadFull(r, b); err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "abcd" {
+				t.Errorf("expected abcd, got %q", b)
+			}
+
+			if _, err := r.Seek(-2, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rest) != "ef" {
+				t.Errorf("expected ef, got %q", rest)
+			}
+
+			expectedRequests := 1
+			if tc.expectRanges {
+				expectedRequests = 3
+			}
+			if requests != expectedRequests {
+				t.Errorf("expected %d requests, got %d", expectedRequests, requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package lz4
+
+// LZ4 frame and block decompression, block and content checksums are not
+// verified
+
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	FrameMagic       = 0x184d2204
+	LegacyFrameMagic = 0x184c2102
+	SkippableMask    = 0xfffffff0
+	SkippableMagic   = 0x184d2a50
+)
+
+var errTruncated = errors.New("lz4: truncated input")
+
+// DecompressBlock decompresses one block appending to dst, matches can
+// reference earlier data in dst so linked blocks are supported
+func DecompressBlock(dst []byte, src []byte) ([]byte, error) {
+	readLen := func(i int, l int) (int, int, error) {
+		if l != 15 {
+			return i, l, nil
+		}
+		for {
+			if i >= len(src) {
+				return 0, 0, errTruncated
+			}
+			b := src[i]
+			i++
+			l += int(b)
+			if b != 255 {
+				return i, l, nil
+			}
+		}
+	}
+
+	i := 0
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		var litLen int
+		var err error
+		if i, litLen, err = readLen(i, int(token>>4)); err != nil {
+			return nil, err
+		}
+		if i+litLen > len(src) {
+			return nil, errTruncated
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+		// last sequence has only literals
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errTruncated
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, fmt.Errorf("lz4: invalid match offset %d", offset)
+		}
+		var matchLen int
+		if i, matchLen, err = readLen(i, int(token&0xf)); err != nil {
+			return nil, err
+		}
+		matchLen += 4
+
+		// can overlap so copy byte by byte
+		start := len(dst) - offset
+		for j := 0; j < matchLen; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+
+	return dst, nil
+}
+
+func decompressFrame(dst []byte, src []byte) ([]byte, int, error) {
+	if len(src) < 7 {
+		return nil, 0, errTruncated
+	}
+	flg := src[4]
+	if flg>>6 != 1 {
+		return nil, 0, fmt.Errorf("lz4: unsupported frame version %d", flg>>6)
+	}
+	blockChecksum := flg&0x10 != 0
+	contentSize := flg&0x08 != 0
+	contentChecksum := flg&0x04 != 0
+	dictID := flg&0x01 != 0
+
+	// magic, FLG, BD and HC
+	i := 7
+	if contentSize {
+		i += 8
+	}
+	if dictID {
+		i += 4
+	}
+	for {
+		if i+4 > len(src) {
+			return nil, 0, errTruncated
+		}
+		size := binary.LittleEndian.Uint32(src[i:])
+		i += 4
+		if size == 0 {
+			break
+		}
+		uncompressed := size&0x80000000 != 0
+		n := int(size & 0x7fffffff)
+		if i+n > len(src) {
+			return nil, 0, errTruncated
+		}
+		if uncompressed {
+			dst = append(dst, src[i:i+n]...)
+		} else {
+			var err error
+			if dst, err = DecompressBlock(dst, src[i:i+n]); err != nil {
+				return nil, 0, err
+			}
+		}
+		i += n
+		if blockChecksum {
+			i += 4
+		}
+	}
+	if contentChecksum {
+		i += 4
+	}
+	if i > len(src) {
+		return nil, 0, errTruncated
+	}
+
+	return dst, i, nil
+}
+
+func decompressLegacyFrame(dst []byte, src []byte) ([]byte, int, error) {
+	i := 4
+	for i+4 <= len(src) {
+		n := int(binary.LittleEndian.Uint32(src[i:]))
+		// next frame
+		if uint32(n) == LegacyFrameMagic || uint32(n) == FrameMagic {
+			break
+		}
+		i += 4
+		if i+n > len(src) {
+			return nil, 0, errTruncated
+		}
+		var err error
+		if dst, err = DecompressBlock(dst, src[i:i+n]); err != nil {
+			return nil, 0, err
+		}
+		i += n
+	}
+	return dst, i, nil
+}
+
+// Decompress decompresses concatenated frames or a raw block if there is no
+// frame magic
+func Decompress(src []byte) ([]byte, error) {
+	if len(src) < 4 {
+		return DecompressBlock(nil, src)
+	}
+	magic := binary.LittleEndian.Uint32(src)
+	if magic != FrameMagic && magic != LegacyFrameMagic && magic&SkippableMask != SkippableMagic {
+		return DecompressBlock(nil, src)
+	}
+
+	var dst []byte
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return nil, errTruncated
+		}
+		var n int
+		var err error
+		magic := binary.LittleEndian.Uint32(src)
+		switch {
+		case magic == FrameMagic:
+			dst, n, err = decompressFrame(dst, src)
+		case magic == LegacyFrameMagic:
+			dst, n, err = decompressLegacyFrame(dst, src)
+		case magic&SkippableMask == SkippableMagic:
+			if len(src) < 8 {
+				return nil, errTruncated
+			}
+			n = 8 + int(binary.LittleEndian.Uint32(src[4:]))
+			if n > len(src) {
+				return nil, errTruncated
+			}
+		default:
+			return nil, fmt.Errorf("lz4: unknown frame magic %08x", magic)
+		}
+		if err != nil {
+			return nil, err
+		}
+		src = src[n:]
+	}
+
+	return dst, nil
+}
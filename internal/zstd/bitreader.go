@@ -0,0 +1,82 @@
+package zstd
+
+import (
+	"math/bits"
+)
+
+// forwardBitReader reads bits starting from least significant bit of the
+// first byte, used for FSE table descriptions
+type forwardBitReader struct {
+	src []byte
+	pos int
+}
+
+func (r *forwardBitReader) peek(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		p := r.pos + i
+		if p>>3 >= len(r.src) {
+			break
+		}
+		v |= uint64(r.src[p>>3]>>(p&7)&1) << i
+	}
+	return v
+}
+
+func (r *forwardBitReader) skip(n int) { r.pos += n }
+
+func (r *forwardBitReader) read(n int) uint64 {
+	v := r.peek(n)
+	r.skip(n)
+	return v
+}
+
+func (r *forwardBitReader) overflow() bool { return r.pos > len(r.src)*8 }
+
+// bytes consumed rounded up
+func (r *forwardBitReader) bytes() int { return (r.pos + 7) / 8 }
+
+// reverseBitReader reads bits backwards starting from the most significant bit
+// after the padding marker in the last byte, used for huffman and FSE
+// bitstreams. Bits before the start of the stream reads as zero.
+type reverseBitReader struct {
+	src []byte
+	pos int
+}
+
+func newReverseBitReader(src []byte) (*reverseBitReader, error) {
+	if len(src) == 0 {
+		return nil, errCorrupt("empty bitstream")
+	}
+	last := src[len(src)-1]
+	if last == 0 {
+		return nil, errCorrupt("bitstream missing end marker")
+	}
+	return &reverseBitReader{
+		src: src,
+		pos: (len(src)-1)*8 + bits.Len8(last) - 1,
+	}, nil
+}
+
+func (r *reverseBitReader) peek(n int) uint64 {
+	var v uint64
+	for i := r.pos - 1; i >= r.pos-n; i-- {
+		v <<= 1
+		if i >= 0 {
+			v |= uint64(r.src[i>>3] >> (i & 7) & 1)
+		}
+	}
+	return v
+}
+
+func (r *reverseBitReader) skip(n int) { r.pos -= n }
+
+func (r *reverseBitReader) read(n int) uint64 {
+	v := r.peek(n)
+	r.skip(n)
+	return v
+}
+
+func (r *reverseBitReader) overflow() bool { return r.pos < 0 }
+
+func (r *reverseBitReader) finished() bool { return r.pos == 0 }
@@ -0,0 +1,148 @@
+package zstd
+
+import (
+	"math/bits"
+)
+
+type fseEntry struct {
+	symbol uint8
+	nbBits uint8
+	base   uint16
+}
+
+type fseTable struct {
+	accuracyLog int
+	entries     []fseEntry
+}
+
+// read normalized probabilities from a FSE table description, returns
+// probabilities and accuracy log and number of bytes read
+func readFSEProbabilities(src []byte, maxAccuracyLog int, maxSymbol int) ([]int, int, int, error) {
+	r := &forwardBitReader{src: src}
+	accuracyLog := int(r.read(4)) + 5
+	if accuracyLog > maxAccuracyLog {
+		return nil, 0, 0, errCorrupt("FSE accuracy log too large")
+	}
+
+	remaining := (1 << accuracyLog) + 1
+	threshold := 1 << accuracyLog
+	nbBits := accuracyLog + 1
+	var probs []int
+
+	for remaining > 1 {
+		if len(probs) > maxSymbol {
+			return nil, 0, 0, errCorrupt("FSE too many symbols")
+		}
+
+		max := (2*threshold - 1) - remaining
+		var v int
+		low := int(r.peek(nbBits - 1))
+		if low < max {
+			v = low
+			r.skip(nbBits - 1)
+		} else {
+			v = int(r.read(nbBits))
+			if v >= threshold {
+				v -= max
+			}
+		}
+		prob := v - 1
+		if prob < 0 {
+			remaining += prob
+		} else {
+			remaining -= prob
+		}
+		probs = append(probs, prob)
+
+		if prob == 0 {
+			for {
+				repeat := int(r.read(2))
+				for i := 0; i < repeat; i++ {
+					probs = append(probs, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+
+		if r.overflow() {
+			return nil, 0, 0, errCorrupt("FSE table description truncated")
+		}
+	}
+	if remaining != 1 || len(probs) > maxSymbol+1 {
+		return nil, 0, 0, errCorrupt("FSE invalid probabilities")
+	}
+
+	return probs, accuracyLog, r.bytes(), nil
+}
+
+func buildFSETable(probs []int, accuracyLog int) (*fseTable, error) {
+	size := 1 << accuracyLog
+	entries := make([]fseEntry, size)
+	next := make([]int, len(probs))
+
+	high := size - 1
+	for s, p := range probs {
+		if p == -1 {
+			entries[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = p
+		}
+	}
+
+	mask := size - 1
+	step := (size >> 1) + (size >> 3) + 3
+	pos := 0
+	for s, p := range probs {
+		for i := 0; i < p; i++ {
+			entries[pos].symbol = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, errCorrupt("FSE invalid table spread")
+	}
+
+	for i := range entries {
+		s := entries[i].symbol
+		n := next[s]
+		next[s]++
+		nb := accuracyLog - (bits.Len(uint(n)) - 1)
+		entries[i].nbBits = uint8(nb)
+		entries[i].base = uint16((n << nb) - size)
+	}
+
+	return &fseTable{accuracyLog: accuracyLog, entries: entries}, nil
+}
+
+func rleFSETable(symbol uint8) *fseTable {
+	return &fseTable{accuracyLog: 0, entries: []fseEntry{{symbol: symbol}}}
+}
+
+type fseState struct {
+	t     *fseTable
+	state int
+}
+
+func (s *fseState) init(t *fseTable, r *reverseBitReader) {
+	s.t = t
+	s.state = int(r.read(t.accuracyLog))
+}
+
+func (s *fseState) symbol() uint8 { return s.t.entries[s.state].symbol }
+
+func (s *fseState) update(r *reverseBitReader) {
+	e := s.t.entries[s.state]
+	s.state = int(e.base) + int(r.read(int(e.nbBits)))
+}
@@ -0,0 +1,157 @@
+package zstd
+
+import (
+	"math/bits"
+)
+
+const (
+	huffmanMaxBits              = 11
+	huffmanMaxWeightAccuracyLog = 6
+)
+
+type huffmanEntry struct {
+	symbol uint8
+	nbBits uint8
+}
+
+type huffmanTable struct {
+	maxBits int
+	entries []huffmanEntry
+}
+
+// read a huffman tree description, returns table and number of bytes read
+func readHuffmanTable(src []byte) (*huffmanTable, int, error) {
+	if len(src) < 1 {
+		return nil, 0, errCorrupt("huffman tree description truncated")
+	}
+	header := int(src[0])
+	var weights []uint8
+	n := 1
+
+	if header < 128 {
+		// FSE compressed weights
+		if 1+header > len(src) {
+			return nil, 0, errCorrupt("huffman weights truncated")
+		}
+		ws := src[1 : 1+header]
+		probs, accuracyLog, tn, err := readFSEProbabilities(ws, huffmanMaxWeightAccuracyLog, 255)
+		if err != nil {
+			return nil, 0, err
+		}
+		t, err := buildFSETable(probs, accuracyLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		r, err := newReverseBitReader(ws[tn:])
+		if err != nil {
+			return nil, 0, err
+		}
+		var s1, s2 fseState
+		s1.init(t, r)
+		s2.init(t, r)
+		for {
+			if len(weights) > 255 {
+				return nil, 0, errCorrupt("huffman too many weights")
+			}
+			weights = append(weights, s1.symbol())
+			s1.update(r)
+			if r.overflow() {
+				weights = append(weights, s2.symbol())
+				break
+			}
+			weights = append(weights, s2.symbol())
+			s2.update(r)
+			if r.overflow() {
+				weights = append(weights, s1.symbol())
+				break
+			}
+		}
+		n += header
+	} else {
+		// direct representation, 4 bits per weight
+		count := header - 127
+		size := (count + 1) / 2
+		if 1+size > len(src) {
+			return nil, 0, errCorrupt("huffman weights truncated")
+		}
+		for i := 0; i < count; i++ {
+			b := src[1+i/2]
+			if i%2 == 0 {
+				weights = append(weights, b>>4)
+			} else {
+				weights = append(weights, b&0xf)
+			}
+		}
+		n += size
+	}
+
+	t, err := buildHuffmanTable(weights)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return t, n, nil
+}
+
+// build decoding table from weights, last weight is implied
+func buildHuffmanTable(weights []uint8) (*huffmanTable, error) {
+	if len(weights) > 255 {
+		return nil, errCorrupt("huffman too many weights")
+	}
+	total := 0
+	for _, w := range weights {
+		if w > huffmanMaxBits {
+			return nil, errCorrupt("huffman invalid weight")
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, errCorrupt("huffman all weights zero")
+	}
+	maxBits := bits.Len(uint(total))
+	if maxBits > huffmanMaxBits {
+		return nil, errCorrupt("huffman max bits too large")
+	}
+	left := (1 << maxBits) - total
+	if left&(left-1) != 0 {
+		return nil, errCorrupt("huffman implied weight not a power of two")
+	}
+	weights = append(weights, uint8(bits.Len(uint(left))))
+
+	// symbols are ordered by weight and then by symbol value, each symbol
+	// occupies 2^(weight-1) entries
+	entries := make([]huffmanEntry, 1<<maxBits)
+	pos := 0
+	for w := 1; w <= maxBits; w++ {
+		for s, sw := range weights {
+			if int(sw) != w {
+				continue
+			}
+			n := 1 << (w - 1)
+			for i := 0; i < n; i++ {
+				entries[pos] = huffmanEntry{symbol: uint8(s), nbBits: uint8(maxBits + 1 - w)}
+				pos++
+			}
+		}
+	}
+
+	return &huffmanTable{maxBits: maxBits, entries: entries}, nil
+}
+
+func (t *huffmanTable) decodeStream(dst []byte, src []byte, n int) ([]byte, error) {
+	r, err := newReverseBitReader(src)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		e := t.entries[r.peek(t.maxBits)]
+		dst = append(dst, e.symbol)
+		r.skip(int(e.nbBits))
+	}
+	if !r.finished() {
+		return nil, errCorrupt("huffman stream not fully consumed")
+	}
+	return dst, nil
+}
@@ -0,0 +1,632 @@
+package zstd
+
+// Zstandard frame decompression, dictionaries are not supported
+// https://www.rfc-editor.org/rfc/rfc8878.html
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/wader/fq/pkg/checksum"
+)
+
+const (
+	FrameMagic     = 0xfd2fb528
+	SkippableMask  = 0xfffffff0
+	SkippableMagic = 0x184d2a50
+)
+
+const (
+	BlockTypeRaw        = 0
+	BlockTypeRLE        = 1
+	BlockTypeCompressed = 2
+	BlockTypeReserved   = 3
+)
+
+const (
+	LiteralsBlockTypeRaw        = 0
+	LiteralsBlockTypeRLE        = 1
+	LiteralsBlockTypeCompressed = 2
+	LiteralsBlockTypeTreeless   = 3
+)
+
+const (
+	SequencesModePredefined = 0
+	SequencesModeRLE        = 1
+	SequencesModeFSE        = 2
+	SequencesModeRepeat     = 3
+)
+
+var errTruncated = errors.New("zstd: truncated input")
+
+func errCorrupt(s string) error { return fmt.Errorf("zstd: %s", s) }
+
+var literalsLengthBaselines = [36]struct {
+	baseline uint32
+	bits     uint8
+}{
+	{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0},
+	{8, 0}, {9, 0}, {10, 0}, {11, 0}, {12, 0}, {13, 0}, {14, 0}, {15, 0},
+	{16, 1}, {18, 1}, {20, 1}, {22, 1}, {24, 2}, {28, 2}, {32, 3}, {40, 3},
+	{48, 4}, {64, 6}, {128, 7}, {256, 8}, {512, 9}, {1024, 10}, {2048, 11}, {4096, 12},
+	{8192, 13}, {16384, 14}, {32768, 15}, {65536, 16},
+}
+
+var matchLengthBaselines = [53]struct {
+	baseline uint32
+	bits     uint8
+}{
+	{3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0}, {8, 0}, {9, 0}, {10, 0},
+	{11, 0}, {12, 0}, {13, 0}, {14, 0}, {15, 0}, {16, 0}, {17, 0}, {18, 0},
+	{19, 0}, {20, 0}, {21, 0}, {22, 0}, {23, 0}, {24, 0}, {25, 0}, {26, 0},
+	{27, 0}, {28, 0}, {29, 0}, {30, 0}, {31, 0}, {32, 0}, {33, 0}, {34, 0},
+	{35, 1}, {37, 1}, {39, 1}, {41, 1}, {43, 2}, {47, 2}, {51, 3}, {59, 3},
+	{67, 4}, {83, 4}, {99, 5}, {131, 7}, {259, 8}, {515, 9}, {1027, 10}, {2051, 11},
+	{4099, 12}, {8195, 13}, {16387, 14}, {32771, 15}, {65539, 16},
+}
+
+var (
+	literalsLengthDefaultProbs = []int{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	matchLengthDefaultProbs = []int{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	offsetDefaultProbs = []int{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+)
+
+func mustBuildFSETable(probs []int, accuracyLog int) *fseTable {
+	t, err := buildFSETable(probs, accuracyLog)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+var (
+	literalsLengthDefaultTable = mustBuildFSETable(literalsLengthDefaultProbs, 6)
+	matchLengthDefaultTable    = mustBuildFSETable(matchLengthDefaultProbs, 6)
+	offsetDefaultTable         = mustBuildFSETable(offsetDefaultProbs, 5)
+)
+
+// FrameHeader is a parsed frame header
+type FrameHeader struct {
+	Size               int
+	SingleSegment      bool
+	HasContentChecksum bool
+	DictionaryID       uint32
+	HasContentSize     bool
+	ContentSize        uint64
+	WindowSize         uint64
+}
+
+// ParseFrameHeader parses frame header including magic
+func ParseFrameHeader(src []byte) (FrameHeader, error) {
+	var h FrameHeader
+	if len(src) < 5 {
+		return h, errTruncated
+	}
+	if binary.LittleEndian.Uint32(src) != FrameMagic {
+		return h, errCorrupt("invalid frame magic")
+	}
+	fhd := src[4]
+	fcsFlag := fhd >> 6
+	h.SingleSegment = fhd&0x20 != 0
+	if fhd&0x08 != 0 {
+		return h, errCorrupt("reserved frame header bit set")
+	}
+	h.HasContentChecksum = fhd&0x04 != 0
+	didFlag := fhd & 0x03
+
+	i := 5
+	if !h.SingleSegment {
+		if i >= len(src) {
+			return h, errTruncated
+		}
+		wd := src[i]
+		exponent := uint64(wd >> 3)
+		mantissa := uint64(wd & 0x7)
+		windowBase := uint64(1) << (10 + exponent)
+		h.WindowSize = windowBase + (windowBase/8)*mantissa
+		i++
+	}
+
+	didSize := [4]int{0, 1, 2, 4}[didFlag]
+	if i+didSize > len(src) {
+		return h, errTruncated
+	}
+	for j := 0; j < didSize; j++ {
+		h.DictionaryID |= uint32(src[i+j]) << (8 * j)
+	}
+	i += didSize
+
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && h.SingleSegment {
+		fcsSize = 1
+	}
+	if i+fcsSize > len(src) {
+		return h, errTruncated
+	}
+	if fcsSize > 0 {
+		h.HasContentSize = true
+		for j := 0; j < fcsSize; j++ {
+			h.ContentSize |= uint64(src[i+j]) << (8 * j)
+		}
+		if fcsSize == 2 {
+			h.ContentSize += 256
+		}
+	}
+	i += fcsSize
+
+	if h.SingleSegment {
+		h.WindowSize = h.ContentSize
+	}
+	h.Size = i
+
+	return h, nil
+}
+
+type frameDecoder struct {
+	start         int
+	huffman       *huffmanTable
+	llTable       *fseTable
+	ofTable       *fseTable
+	mlTable       *fseTable
+	repeatOffsets [3]int
+}
+
+// DecompressFrame decompresses one frame appending to dst and returns the
+// number of bytes read from src. Content checksum is not verified.
+func DecompressFrame(dst []byte, src []byte) ([]byte, int, error) {
+	h, err := ParseFrameHeader(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	if h.DictionaryID != 0 {
+		return nil, 0, fmt.Errorf("zstd: dictionary %d not supported", h.DictionaryID)
+	}
+
+	fd := &frameDecoder{
+		start:         len(dst),
+		repeatOffsets: [3]int{1, 4, 8},
+	}
+	i := h.Size
+	for {
+		if i+3 > len(src) {
+			return nil, 0, errTruncated
+		}
+		bh := uint32(src[i]) | uint32(src[i+1])<<8 | uint32(src[i+2])<<16
+		i += 3
+		last := bh&1 != 0
+		blockType := (bh >> 1) & 0x3
+		blockSize := int(bh >> 3)
+
+		switch blockType {
+		case BlockTypeRaw:
+			if i+blockSize > len(src) {
+				return nil, 0, errTruncated
+			}
+			dst = append(dst, src[i:i+blockSize]...)
+			i += blockSize
+		case BlockTypeRLE:
+			if i+1 > len(src) {
+				return nil, 0, errTruncated
+			}
+			for j := 0; j < blockSize; j++ {
+				dst = append(dst, src[i])
+			}
+			i++
+		case BlockTypeCompressed:
+			if i+blockSize > len(src) {
+				return nil, 0, errTruncated
+			}
+			if dst, err = fd.decompressBlock(dst, src[i:i+blockSize]); err != nil {
+				return nil, 0, err
+			}
+			i += blockSize
+		default:
+			return nil, 0, errCorrupt("reserved block type")
+		}
+
+		if last {
+			break
+		}
+	}
+	if h.HasContentChecksum {
+		if i+4 > len(src) {
+			return nil, 0, errTruncated
+		}
+		i += 4
+	}
+	if h.HasContentSize && uint64(len(dst)-fd.start) != h.ContentSize {
+		return nil, 0, errCorrupt("content size mismatch")
+	}
+
+	return dst, i, nil
+}
+
+// Decompress decompresses concatenated frames and verifies content checksums,
+// skippable frames are ignored
+func Decompress(src []byte) ([]byte, error) {
+	var dst []byte
+	for len(src) > 0 {
+		if len(src) < 8 {
+			return nil, errTruncated
+		}
+		magic := binary.LittleEndian.Uint32(src)
+		switch {
+		case magic == FrameMagic:
+			start := len(dst)
+			var n int
+			var err error
+			if dst, n, err = DecompressFrame(dst, src); err != nil {
+				return nil, err
+			}
+			if src[4]&0x04 != 0 {
+				sum := binary.LittleEndian.Uint32(src[n-4:])
+				if uint32(checksum.XXH64(dst[start:], 0)) != sum {
+					return nil, errCorrupt("content checksum mismatch")
+				}
+			}
+			src = src[n:]
+		case magic&SkippableMask == SkippableMagic:
+			n := 8 + int(binary.LittleEndian.Uint32(src[4:]))
+			if n > len(src) {
+				return nil, errTruncated
+			}
+			src = src[n:]
+		default:
+			return nil, fmt.Errorf("zstd: unknown frame magic %08x", magic)
+		}
+	}
+
+	return dst, nil
+}
+
+func (fd *frameDecoder) decompressBlock(dst []byte, src []byte) ([]byte, error) {
+	literals, n, err := fd.decodeLiterals(src)
+	if err != nil {
+		return nil, err
+	}
+	return fd.decodeSequences(dst, literals, src[n:])
+}
+
+// LiteralsSectionHeader is a parsed literals section header
+type LiteralsSectionHeader struct {
+	Size            int
+	BlockType       int
+	SizeFormat      int
+	RegeneratedSize int
+	CompressedSize  int
+	NumberOfStreams int
+}
+
+// ParseLiteralsSectionHeader parses a literals section header
+func ParseLiteralsSectionHeader(src []byte) (LiteralsSectionHeader, error) {
+	var h LiteralsSectionHeader
+	if len(src) < 1 {
+		return h, errTruncated
+	}
+	h.BlockType = int(src[0] & 0x3)
+	h.SizeFormat = int(src[0]>>2) & 0x3
+
+	switch h.BlockType {
+	case LiteralsBlockTypeRaw, LiteralsBlockTypeRLE:
+		switch h.SizeFormat {
+		case 0, 2:
+			h.Size = 1
+			h.RegeneratedSize = int(src[0] >> 3)
+		case 1:
+			if len(src) < 2 {
+				return h, errTruncated
+			}
+			h.Size = 2
+			h.RegeneratedSize = int(src[0]>>4) | int(src[1])<<4
+		case 3:
+			if len(src) < 3 {
+				return h, errTruncated
+			}
+			h.Size = 3
+			h.RegeneratedSize = int(src[0]>>4) | int(src[1])<<4 | int(src[2])<<12
+		}
+		if h.BlockType == LiteralsBlockTypeRaw {
+			h.CompressedSize = h.RegeneratedSize
+		} else {
+			h.CompressedSize = 1
+		}
+		h.NumberOfStreams = 1
+	default:
+		var sizeBits int
+		switch h.SizeFormat {
+		case 0:
+			h.NumberOfStreams = 1
+			h.Size, sizeBits = 3, 10
+		case 1:
+			h.NumberOfStreams = 4
+			h.Size, sizeBits = 3, 10
+		case 2:
+			h.NumberOfStreams = 4
+			h.Size, sizeBits = 4, 14
+		case 3:
+			h.NumberOfStreams = 4
+			h.Size, sizeBits = 5, 18
+		}
+		if len(src) < h.Size {
+			return h, errTruncated
+		}
+		var v uint64
+		for j := 0; j < h.Size; j++ {
+			v |= uint64(src[j]) << (8 * j)
+		}
+		mask := uint64(1)<<sizeBits - 1
+		h.RegeneratedSize = int((v >> 4) & mask)
+		h.CompressedSize = int((v >> (4 + sizeBits)) & mask)
+	}
+
+	return h, nil
+}
+
+func (fd *frameDecoder) decodeLiterals(src []byte) ([]byte, int, error) {
+	h, err := ParseLiteralsSectionHeader(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	i := h.Size
+	if i+h.CompressedSize > len(src) {
+		return nil, 0, errTruncated
+	}
+	data := src[i : i+h.CompressedSize]
+	n := i + h.CompressedSize
+
+	switch h.BlockType {
+	case LiteralsBlockTypeRaw:
+		return data, n, nil
+	case LiteralsBlockTypeRLE:
+		literals := make([]byte, h.RegeneratedSize)
+		for j := range literals {
+			literals[j] = data[0]
+		}
+		return literals, n, nil
+	}
+
+	if h.BlockType == LiteralsBlockTypeCompressed {
+		t, tn, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		fd.huffman = t
+		data = data[tn:]
+	} else if fd.huffman == nil {
+		return nil, 0, errCorrupt("treeless literals without previous huffman table")
+	}
+
+	literals := make([]byte, 0, h.RegeneratedSize)
+	if h.NumberOfStreams == 1 {
+		if literals, err = fd.huffman.decodeStream(literals, data, h.RegeneratedSize); err != nil {
+			return nil, 0, err
+		}
+		return literals, n, nil
+	}
+
+	if len(data) < 6 {
+		return nil, 0, errTruncated
+	}
+	sizes := [4]int{
+		int(binary.LittleEndian.Uint16(data[0:])),
+		int(binary.LittleEndian.Uint16(data[2:])),
+		int(binary.LittleEndian.Uint16(data[4:])),
+	}
+	sizes[3] = len(data) - 6 - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 {
+		return nil, 0, errCorrupt("invalid jump table")
+	}
+	streamRegenerated := (h.RegeneratedSize + 3) / 4
+	data = data[6:]
+	for j, s := range sizes {
+		count := streamRegenerated
+		if j == 3 {
+			count = h.RegeneratedSize - 3*streamRegenerated
+		}
+		if count < 0 {
+			return nil, 0, errCorrupt("invalid regenerated size")
+		}
+		if literals, err = fd.huffman.decodeStream(literals, data[:s], count); err != nil {
+			return nil, 0, err
+		}
+		data = data[s:]
+	}
+
+	return literals, n, nil
+}
+
+// SequencesSectionHeader is a parsed sequences section header
+type SequencesSectionHeader struct {
+	Size               int
+	NumberOfSequences  int
+	LiteralsLengthMode int
+	OffsetsMode        int
+	MatchLengthMode    int
+}
+
+// ParseSequencesSectionHeader parses a sequences section header
+func ParseSequencesSectionHeader(src []byte) (SequencesSectionHeader, error) {
+	var h SequencesSectionHeader
+	if len(src) < 1 {
+		return h, errTruncated
+	}
+	b0 := int(src[0])
+	switch {
+	case b0 == 0:
+		h.Size = 1
+		return h, nil
+	case b0 < 128:
+		h.NumberOfSequences = b0
+		h.Size = 1
+	case b0 < 255:
+		if len(src) < 2 {
+			return h, errTruncated
+		}
+		h.NumberOfSequences = (b0-128)<<8 + int(src[1])
+		h.Size = 2
+	default:
+		if len(src) < 3 {
+			return h, errTruncated
+		}
+		h.NumberOfSequences = int(src[1]) + int(src[2])<<8 + 0x7f00
+		h.Size = 3
+	}
+	if h.Size >= len(src) {
+		return h, errTruncated
+	}
+	modes := src[h.Size]
+	h.LiteralsLengthMode = int(modes >> 6)
+	h.OffsetsMode = int(modes>>4) & 0x3
+	h.MatchLengthMode = int(modes>>2) & 0x3
+	h.Size++
+
+	return h, nil
+}
+
+func (fd *frameDecoder) readTable(src []byte, mode int, prev *fseTable, def *fseTable, maxAccuracyLog int, maxSymbol int) (*fseTable, int, error) {
+	switch mode {
+	case SequencesModePredefined:
+		return def, 0, nil
+	case SequencesModeRLE:
+		if len(src) < 1 {
+			return nil, 0, errTruncated
+		}
+		if int(src[0]) > maxSymbol {
+			return nil, 0, errCorrupt("invalid RLE symbol")
+		}
+		return rleFSETable(src[0]), 1, nil
+	case SequencesModeFSE:
+		probs, accuracyLog, n, err := readFSEProbabilities(src, maxAccuracyLog, maxSymbol)
+		if err != nil {
+			return nil, 0, err
+		}
+		t, err := buildFSETable(probs, accuracyLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		return t, n, nil
+	default:
+		if prev == nil {
+			return nil, 0, errCorrupt("repeat mode without previous table")
+		}
+		return prev, 0, nil
+	}
+}
+
+func (fd *frameDecoder) decodeSequences(dst []byte, literals []byte, src []byte) ([]byte, error) {
+	h, err := ParseSequencesSectionHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	if h.NumberOfSequences == 0 {
+		return append(dst, literals...), nil
+	}
+	i := h.Size
+
+	var n int
+	if fd.llTable, n, err = fd.readTable(src[i:], h.LiteralsLengthMode, fd.llTable, literalsLengthDefaultTable, 9, 35); err != nil {
+		return nil, err
+	}
+	i += n
+	if fd.ofTable, n, err = fd.readTable(src[i:], h.OffsetsMode, fd.ofTable, offsetDefaultTable, 8, 31); err != nil {
+		return nil, err
+	}
+	i += n
+	if fd.mlTable, n, err = fd.readTable(src[i:], h.MatchLengthMode, fd.mlTable, matchLengthDefaultTable, 9, 52); err != nil {
+		return nil, err
+	}
+	i += n
+
+	r, err := newReverseBitReader(src[i:])
+	if err != nil {
+		return nil, err
+	}
+	var llState, ofState, mlState fseState
+	llState.init(fd.llTable, r)
+	ofState.init(fd.ofTable, r)
+	mlState.init(fd.mlTable, r)
+
+	for s := 0; s < h.NumberOfSequences; s++ {
+		ofCode := int(ofState.symbol())
+		mlCode := int(mlState.symbol())
+		llCode := int(llState.symbol())
+		if ofCode > 31 || mlCode >= len(matchLengthBaselines) || llCode >= len(literalsLengthBaselines) {
+			return nil, errCorrupt("invalid sequence code")
+		}
+
+		ofValue := (1 << ofCode) + int(r.read(ofCode))
+		ml := matchLengthBaselines[mlCode]
+		matchLength := int(ml.baseline) + int(r.read(int(ml.bits)))
+		ll := literalsLengthBaselines[llCode]
+		literalsLength := int(ll.baseline) + int(r.read(int(ll.bits)))
+
+		var offset int
+		if ofValue > 3 {
+			offset = ofValue - 3
+			fd.repeatOffsets[2] = fd.repeatOffsets[1]
+			fd.repeatOffsets[1] = fd.repeatOffsets[0]
+			fd.repeatOffsets[0] = offset
+		} else {
+			idx := ofValue - 1
+			if literalsLength == 0 {
+				idx++
+			}
+			if idx == 0 {
+				offset = fd.repeatOffsets[0]
+			} else {
+				if idx == 3 {
+					offset = fd.repeatOffsets[0] - 1
+				} else {
+					offset = fd.repeatOffsets[idx]
+				}
+				if idx != 1 {
+					fd.repeatOffsets[2] = fd.repeatOffsets[1]
+				}
+				fd.repeatOffsets[1] = fd.repeatOffsets[0]
+				fd.repeatOffsets[0] = offset
+			}
+		}
+
+		if s != h.NumberOfSequences-1 {
+			llState.update(r)
+			mlState.update(r)
+			ofState.update(r)
+		}
+		if r.overflow() {
+			return nil, errCorrupt("sequences bitstream overflow")
+		}
+
+		if literalsLength > len(literals) {
+			return nil, errCorrupt("literals length larger than literals")
+		}
+		dst = append(dst, literals[:literalsLength]...)
+		literals = literals[literalsLength:]
+
+		if offset <= 0 || offset > len(dst)-fd.start {
+			return nil, fmt.Errorf("zstd: invalid match offset %d", offset)
+		}
+		// can overlap so copy byte by byte
+		start := len(dst) - offset
+		for j := 0; j < matchLength; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	if !r.finished() {
+		return nil, errCorrupt("sequences bitstream not fully consumed")
+	}
+
+	return append(dst, literals...), nil
+}
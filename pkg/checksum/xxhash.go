@@ -0,0 +1,121 @@
+package checksum
+
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	xxh32Prime1 uint32 = 2654435761
+	xxh32Prime2 uint32 = 2246822519
+	xxh32Prime3 uint32 = 3266489917
+	xxh32Prime4 uint32 = 668265263
+	xxh32Prime5 uint32 = 374761393
+
+	xxh64Prime1 uint64 = 11400714785074694791
+	xxh64Prime2 uint64 = 14029467366897019727
+	xxh64Prime3 uint64 = 1609587929392839161
+	xxh64Prime4 uint64 = 9650029242287828579
+	xxh64Prime5 uint64 = 2870177450012600261
+)
+
+func xxh32Round(acc uint32, v uint32) uint32 {
+	return bits.RotateLeft32(acc+v*xxh32Prime2, 13) * xxh32Prime1
+}
+
+// XXH32 returns the 32 bit xxHash of b
+func XXH32(b []byte, seed uint32) uint32 {
+	n := len(b)
+	var h uint32
+	if n >= 16 {
+		v1 := seed + xxh32Prime1 + xxh32Prime2
+		v2 := seed + xxh32Prime2
+		v3 := seed
+		v4 := seed - xxh32Prime1
+		for ; len(b) >= 16; b = b[16:] {
+			v1 = xxh32Round(v1, binary.LittleEndian.Uint32(b[0:]))
+			v2 = xxh32Round(v2, binary.LittleEndian.Uint32(b[4:]))
+			v3 = xxh32Round(v3, binary.LittleEndian.Uint32(b[8:]))
+			v4 = xxh32Round(v4, binary.LittleEndian.Uint32(b[12:]))
+		}
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) + bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = seed + xxh32Prime5
+	}
+	h += uint32(n)
+
+	for ; len(b) >= 4; b = b[4:] {
+		h += binary.LittleEndian.Uint32(b) * xxh32Prime3
+		h = bits.RotateLeft32(h, 17) * xxh32Prime4
+	}
+	for _, c := range b {
+		h += uint32(c) * xxh32Prime5
+		h = bits.RotateLeft32(h, 11) * xxh32Prime1
+	}
+
+	h ^= h >> 15
+	h *= xxh32Prime2
+	h ^= h >> 13
+	h *= xxh32Prime3
+	h ^= h >> 16
+
+	return h
+}
+
+func xxh64Round(acc uint64, v uint64) uint64 {
+	return bits.RotateLeft64(acc+v*xxh64Prime2, 31) * xxh64Prime1
+}
+
+func xxh64MergeRound(acc uint64, v uint64) uint64 {
+	return (acc^xxh64Round(0, v))*xxh64Prime1 + xxh64Prime4
+}
+
+// XXH64 returns the 64 bit xxHash of b
+func XXH64(b []byte, seed uint64) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		v1 := seed + xxh64Prime1 + xxh64Prime2
+		v2 := seed + xxh64Prime2
+		v3 := seed
+		v4 := seed - xxh64Prime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxh64Round(v1, binary.LittleEndian.Uint64(b[0:]))
+			v2 = xxh64Round(v2, binary.LittleEndian.Uint64(b[8:]))
+			v3 = xxh64Round(v3, binary.LittleEndian.Uint64(b[16:]))
+			v4 = xxh64Round(v4, binary.LittleEndian.Uint64(b[24:]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxh64MergeRound(h, v1)
+		h = xxh64MergeRound(h, v2)
+		h = xxh64MergeRound(h, v3)
+		h = xxh64MergeRound(h, v4)
+	} else {
+		h = seed + xxh64Prime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxh64Round(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxh64Prime1 + xxh64Prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxh64Prime1
+		h = bits.RotateLeft64(h, 23)*xxh64Prime2 + xxh64Prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxh64Prime5
+		h = bits.RotateLeft64(h, 11) * xxh64Prime1
+	}
+
+	h ^= h >> 33
+	h *= xxh64Prime2
+	h ^= h >> 29
+	h *= xxh64Prime3
+	h ^= h >> 32
+
+	return h
+}
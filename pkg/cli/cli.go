@@ -99,6 +99,14 @@ func (fd fdTerminal) IsTerminal() bool {
 	return term.IsTerminal(int(fd))
 }
 
+func (fd fdTerminal) MakeRaw() (func() error, error) {
+	state, err := term.MakeRaw(int(fd))
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return term.Restore(int(fd), state) }, nil
+}
+
 type stdinInput struct {
 	fdTerminal
 	fs.File
@@ -184,12 +192,14 @@ func (o *stdOS) Readline(opts interp.ReadlineOpts) (string, error) {
 	if o.rl == nil {
 		var err error
 
-		var historyFile string
-		cacheDir, err := os.UserCacheDir()
-		if err != nil {
-			return "", err
+		historyFile := opts.HistoryFile
+		if historyFile == "" {
+			cacheDir, err := os.UserCacheDir()
+			if err != nil {
+				return "", err
+			}
+			historyFile = filepath.Join(cacheDir, "fq/history")
 		}
-		historyFile = filepath.Join(cacheDir, "fq/history")
 		_ = os.MkdirAll(filepath.Dir(historyFile), 0700)
 
 		cfg := &readline.Config{
@@ -8,6 +8,8 @@ import (
 
 	"reflect"
 	"regexp"
+	"runtime"
+	"sync"
 
 	"github.com/wader/fq/internal/bitiox"
 	"github.com/wader/fq/internal/iox"
@@ -28,16 +30,48 @@ const (
 	LittleEndian
 )
 
+// ReservedCheck is how non-zero reserved fields are handled
+type ReservedCheck int
+
+const (
+	// ReservedCheckIgnore ignore non-zero reserved fields
+	ReservedCheckIgnore ReservedCheck = iota
+	// ReservedCheckWarn record a failed constraint for non-zero reserved fields
+	ReservedCheckWarn
+	// ReservedCheckError fail decode on non-zero reserved fields unless forced
+	ReservedCheckError
+)
+
 type Options struct {
-	Name        string
-	Description string
-	Force       bool
-	FillGaps    bool
-	IsRoot      bool
-	Range       ranges.Range // if zero use whole buffer
-	InArg       any
-	ParseOptsFn func(init any) any
-	ReadBuf     *[]byte
+	Name          string
+	Description   string
+	Force         bool
+	FillGaps      bool
+	IsRoot        bool
+	Range         ranges.Range // if zero use whole buffer
+	InArg         any
+	ParseOptsFn   func(init any) any
+	ReadBuf       *[]byte
+	ReservedCheck ReservedCheck
+	Parallel      bool          // decode independent ranges concurrently, see RangesFn
+	EventFn       func(e Event) // called while decoding, concurrently if Parallel is set
+}
+
+type EventKind int
+
+const (
+	EventOpen  EventKind = iota // struct, array or format root started
+	EventClose                  // struct, array or format root done
+	EventValue                  // scalar value added
+	EventError                  // format failed to decode
+)
+
+// Event is a decode progress event. Value ranges are relative to the buffer of
+// the format being decoded and value might not yet be attached to its parent.
+type Event struct {
+	Kind  EventKind
+	Value *Value
+	Err   error
 }
 
 // Decode try decode group and return first success and all other decoder errors
@@ -107,6 +141,7 @@ func decode(ctx context.Context, br bitio.ReaderAtSeeker, group *Group, opts Opt
 		d := newDecoder(ctx, f, cBR, opts)
 
 		d.inArgs = inArgs
+		d.event(EventOpen, d.Value, nil)
 
 		var decodeV any
 		r, rOk := recoverfn.Run(func() {
@@ -131,6 +166,7 @@ func decode(ctx context.Context, br bitio.ReaderAtSeeker, group *Group, opts Opt
 				Stacktrace: r,
 			}
 			formatsErr.Errs = append(formatsErr.Errs, formatErr)
+			d.event(EventError, d.Value, formatErr)
 
 			switch vv := d.Value.V.(type) {
 			case *Compound:
@@ -164,6 +200,7 @@ func decode(ctx context.Context, br bitio.ReaderAtSeeker, group *Group, opts Opt
 		if opts.IsRoot {
 			d.Value.postProcess()
 		}
+		d.event(EventClose, d.Value, nil)
 
 		if len(formatsErr.Errs) > 0 {
 			return d.Value, decodeV, formatsErr
@@ -790,8 +827,18 @@ func (d *D) SeekAbs(pos int64, fns ...func(d *D)) int64 {
 	return n
 }
 
+func (d *D) event(kind EventKind, v *Value, err error) {
+	if d.Options.EventFn == nil {
+		return
+	}
+	d.Options.EventFn(Event{Kind: kind, Value: v, Err: err})
+}
+
 func (d *D) AddChild(v *Value) {
 	v.Parent = d.Value
+	if _, ok := v.V.(*Compound); !ok {
+		d.event(EventValue, v, nil)
+	}
 
 	switch fv := d.Value.V.(type) {
 	case *Compound:
@@ -837,12 +884,23 @@ func (d *D) FieldMustGet(name string) *Value {
 	panic(fmt.Sprintf("%s not found in struct %s", name, d.Value.Name))
 }
 
+// FieldSources sets ranges of sibling fields srcNames as sources of field name.
+// Used for synthetic values assembled from bits in several places.
+func (d *D) FieldSources(name string, srcNames ...string) {
+	v := d.FieldMustGet(name)
+	for _, n := range srcNames {
+		v.Sources = append(v.Sources, d.FieldMustGet(n).Range)
+	}
+}
+
 // FieldArray decode array of fields. Will not be range sorted.
 func (d *D) FieldArray(name string, fn func(d *D)) *D {
 	c := &Compound{IsArray: true}
 	cd := d.fieldDecoder(name, d.bitBuf, c)
 	d.AddChild(cd.Value)
+	d.event(EventOpen, cd.Value, nil)
 	fn(cd)
+	d.event(EventClose, cd.Value, nil)
 	return cd
 }
 
@@ -856,7 +914,9 @@ func (d *D) FieldStruct(name string, fn func(d *D)) *D {
 	c := &Compound{IsArray: false}
 	cd := d.fieldDecoder(name, d.bitBuf, c)
 	d.AddChild(cd.Value)
+	d.event(EventOpen, cd.Value, nil)
 	fn(cd)
+	d.event(EventClose, cd.Value, nil)
 	return cd
 }
 
@@ -890,6 +950,30 @@ func (d *D) FieldArrayLoop(name string, condFn func() bool, fn func(d *D)) *D {
 	})
 }
 
+// FieldArrayLoopN decodes an array of exactly count elements. Fails if the
+// current frame ends before all elements have been decoded.
+func (d *D) FieldArrayLoopN(name string, count int64, fn func(d *D)) *D {
+	if count < 0 {
+		d.Fatalf("%s: negative count %d", name, count)
+	}
+	return d.FieldArray(name, func(d *D) {
+		for i := int64(0); i < count; i++ {
+			if d.End() {
+				d.Errorf("%s: expected %d elements, found %d", name, count, i)
+			}
+			fn(d)
+		}
+	})
+}
+
+// FieldStructArrayLoopN decodes an array of exactly count structs. Fails if the
+// current frame ends before all structs have been decoded.
+func (d *D) FieldStructArrayLoopN(name string, structName string, count int64, fn func(d *D)) *D {
+	return d.FieldArrayLoopN(name, count, func(d *D) {
+		d.FieldStruct(structName, fn)
+	})
+}
+
 func (d *D) FieldRangeFn(name string, firstBit int64, nBits int64, fn func() *Value) *Value {
 	v := fn()
 	v.Name = name
@@ -900,6 +984,75 @@ func (d *D) FieldRangeFn(name string, firstBit int64, nBits int64, fn func() *Va
 	return v
 }
 
+// Constraint records the result of checking an invariant between decoded fields,
+// ex: hblank >= hfp+hspw. Unlike Errorf it does not stop decoding, results can
+// be inspected using the validate function. Returns valid.
+func (d *D) Constraint(valid bool, format string, a ...any) bool {
+	d.Value.Constraints = append(d.Value.Constraints, Constraint{
+		Description: fmt.Sprintf(format, a...),
+		Valid:       valid,
+	})
+	return valid
+}
+
+// TryFieldStrPadded tries to add a field with a fixedBytes wide string using the
+// padded text convention pt. Records a constraint whether padding is well-formed.
+func (d *D) TryFieldStrPadded(name string, fixedBytes int, pt PaddedText, sms ...scalar.StrMapper) (string, error) {
+	wellFormed := false
+	s, err := d.TryFieldStrFn(name, func(d *D) (string, error) {
+		s, ok, err := d.tryTextPadded(fixedBytes, pt)
+		wellFormed = ok
+		return s, err
+	}, sms...)
+	if err != nil {
+		return "", err
+	}
+	d.Constraint(wellFormed, "%s is well-formed %s padded text", name, pt.Name)
+	return s, nil
+}
+
+// FieldStrPadded adds a field with a fixedBytes wide string using the padded
+// text convention pt. Adds a constraint if padding is not well-formed.
+func (d *D) FieldStrPadded(name string, fixedBytes int, pt PaddedText, sms ...scalar.StrMapper) string {
+	s, err := d.TryFieldStrPadded(name, fixedBytes, pt, sms...)
+	if err != nil {
+		d.IOPanic(err, name, "FieldStrPadded")
+	}
+	return s
+}
+
+func (d *D) checkReserved(name string, isZero bool) {
+	if isZero {
+		return
+	}
+	switch d.Options.ReservedCheck {
+	case ReservedCheckWarn:
+		d.Constraint(false, "%s not zero", name)
+	case ReservedCheckError:
+		d.Errorf("%s not zero", name)
+	}
+}
+
+// FieldUintReserved adds a nBits reserved unsigned integer field that should be zero.
+// A non-zero value is handled according to the reserved check decode option.
+func (d *D) FieldUintReserved(name string, nBits int, sms ...scalar.UintMapper) uint64 {
+	v := d.FieldU(name, nBits, sms...)
+	d.checkReserved(name, v == 0)
+	return v
+}
+
+// FieldRawReserved adds a nBits reserved raw field that should be all zero.
+// A non-zero value is handled according to the reserved check decode option.
+func (d *D) FieldRawReserved(name string, nBits int64, sms ...scalar.BitBufMapper) bitio.ReaderAtSeeker {
+	br := d.FieldRawLen(name, nBits, sms...)
+	z, err := isZero(br)
+	if err != nil {
+		d.IOPanic(err, name, "FieldRawReserved")
+	}
+	d.checkReserved(name, z)
+	return br
+}
+
 func (d *D) AssertPos(pos int64) {
 	if d.Pos() != pos {
 		panic(DecoderError{Reason: fmt.Sprintf("expected bits position %d", pos), Pos: d.Pos()})
@@ -968,15 +1121,95 @@ func (d *D) RangeFn(firstBit int64, nBits int64, fn func(d *D)) int64 {
 	return endPos - startPos
 }
 
+// RangesFn decode each range using fn like RangeFn and add fields in range order.
+// Position will not change. Ranges has to be decoded independently of each other
+// as fn is called concurrently if Options.Parallel is set.
+func (d *D) RangesFn(rs []ranges.Range, fn func(d *D)) {
+	if !d.Options.Parallel || len(rs) < 2 {
+		for _, r := range rs {
+			d.RangeFn(r.Start, r.Len, fn)
+		}
+		return
+	}
+
+	type rangeResult struct {
+		rd        *D
+		recoverV  any
+		recovered bool
+	}
+	results := make([]rangeResult, len(rs))
+
+	// read sequentially as underlying reader might not be safe to use concurrently
+	brs := make([]bitio.ReaderAtSeeker, len(rs))
+	for i, r := range rs {
+		buf := make([]byte, (r.Len+7)/8)
+		if _, err := bitio.ReadAtFull(d.bitBuf, buf, r.Len, r.Start); err != nil {
+			d.IOPanic(err, "", "RangesFn")
+		}
+		brs[i] = bitio.NewBitReader(buf, r.Len)
+	}
+
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i := range rs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			c := d.Value.V.(*Compound)
+			rd := &D{
+				Ctx:    d.Ctx,
+				Endian: d.Endian,
+				Value: &Value{
+					Name:       d.Value.Name,
+					V:          &Compound{IsArray: c.IsArray},
+					RootReader: brs[i],
+				},
+				Options: d.Options,
+				bitBuf:  brs[i],
+			}
+			results[i].rd = rd
+			r, ok := recoverfn.Run(func() { fn(rd) })
+			if !ok {
+				results[i].recoverV = r.RecoverV
+				results[i].recovered = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	// stitch in range order and move values to positions in the original buffer,
+	// stop at first failed range as a sequential decode would have
+	for i, res := range results {
+		for _, v := range res.rd.Value.V.(*Compound).Children {
+			_ = v.WalkRootPreOrder(func(wv *Value, _ *Value, _ int, _ int) error {
+				wv.Range.Start += rs[i].Start
+				wv.RootReader = d.bitBuf
+				return nil
+			})
+			d.AddChild(v)
+		}
+		d.Value.Constraints = append(d.Value.Constraints, res.rd.Value.Constraints...)
+		if res.recovered {
+			panic(res.recoverV)
+		}
+	}
+}
+
 func (d *D) Format(group *Group, inArg any) any {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		InArg:       inArg,
-		ParseOptsFn: d.Options.ParseOptsFn,
-		ReadBuf:     d.readBuf,
+		Force:         d.Options.Force,
+		FillGaps:      false,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
+		InArg:         inArg,
+		ParseOptsFn:   d.Options.ParseOptsFn,
+		ReadBuf:       d.readBuf,
+		ReservedCheck: d.Options.ReservedCheck,
+		Parallel:      d.Options.Parallel,
+		EventFn:       d.Options.EventFn,
 	})
 	if dv == nil || dv.Errors() != nil {
 		d.IOPanic(err, "", "Format: decode")
@@ -1000,14 +1233,17 @@ func (d *D) Format(group *Group, inArg any) any {
 
 func (d *D) TryFieldFormat(name string, group *Group, inArg any) (*Value, any, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		InArg:       inArg,
-		ParseOptsFn: d.Options.ParseOptsFn,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      false,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
+		InArg:         inArg,
+		ParseOptsFn:   d.Options.ParseOptsFn,
+		ReadBuf:       d.readBuf,
+		ReservedCheck: d.Options.ReservedCheck,
+		Parallel:      d.Options.Parallel,
+		EventFn:       d.Options.EventFn,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -1039,14 +1275,17 @@ func (d *D) FieldFormatOrRaw(name string, group *Group, inArg any) (*Value, any)
 
 func (d *D) TryFieldFormatLen(name string, nBits int64, group *Group, inArg any) (*Value, any, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: nBits},
-		InArg:       inArg,
-		ParseOptsFn: d.Options.ParseOptsFn,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      true,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: d.Pos(), Len: nBits},
+		InArg:         inArg,
+		ParseOptsFn:   d.Options.ParseOptsFn,
+		ReadBuf:       d.readBuf,
+		ReservedCheck: d.Options.ReservedCheck,
+		Parallel:      d.Options.Parallel,
+		EventFn:       d.Options.EventFn,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -1076,17 +1315,41 @@ func (d *D) FieldFormatOrRawLen(name string, nBits int64, group *Group, inArg an
 	return dv, v
 }
 
+// FieldFormatOrRawLenTag decodes nBits using group. On failure a struct is added
+// instead with the first tagBits as "tag" mapped using sms and the rest as raw
+// "data", so that unknown blocks are still minimally informative. If nBits is
+// shorter than tagBits a raw field is added.
+func (d *D) FieldFormatOrRawLenTag(name string, nBits int64, group *Group, inArg any, tagBits int, sms ...scalar.UintMapper) (*Value, any) {
+	dv, v, _ := d.TryFieldFormatLen(name, nBits, group, inArg)
+	if dv == nil {
+		if nBits < int64(tagBits) {
+			d.FieldRawLen(name, nBits)
+			return dv, v
+		}
+		d.FramedFn(nBits, func(d *D) {
+			d.FieldStruct(name, func(d *D) {
+				d.FieldU("tag", tagBits, sms...)
+				d.FieldRawLen("data", d.BitsLeft())
+			})
+		})
+	}
+	return dv, v
+}
+
 // TODO: return decooder?
 func (d *D) TryFieldFormatRange(name string, firstBit int64, nBits int64, group *Group, inArg any) (*Value, any, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: firstBit, Len: nBits},
-		InArg:       inArg,
-		ParseOptsFn: d.Options.ParseOptsFn,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      true,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: firstBit, Len: nBits},
+		InArg:         inArg,
+		ParseOptsFn:   d.Options.ParseOptsFn,
+		ReadBuf:       d.readBuf,
+		ReservedCheck: d.Options.ReservedCheck,
+		Parallel:      d.Options.Parallel,
+		EventFn:       d.Options.EventFn,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -1108,13 +1371,16 @@ func (d *D) FieldFormatRange(name string, firstBit int64, nBits int64, group *Gr
 
 func (d *D) TryFieldFormatBitBuf(name string, br bitio.ReaderAtSeeker, group *Group, inArg any) (*Value, any, error) {
 	dv, v, err := decode(d.Ctx, br, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      true,
-		InArg:       inArg,
-		ParseOptsFn: d.Options.ParseOptsFn,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      true,
+		IsRoot:        true,
+		InArg:         inArg,
+		ParseOptsFn:   d.Options.ParseOptsFn,
+		ReadBuf:       d.readBuf,
+		ReservedCheck: d.Options.ReservedCheck,
+		Parallel:      d.Options.Parallel,
+		EventFn:       d.Options.EventFn,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -1165,7 +1431,9 @@ func (d *D) FieldArrayRootBitBufFn(name string, br bitio.ReaderAtSeeker, fn func
 	cd := d.fieldDecoder(name, br, c)
 	cd.Value.IsRoot = true
 	d.AddChild(cd.Value)
+	d.event(EventOpen, cd.Value, nil)
 	fn(cd)
+	d.event(EventClose, cd.Value, nil)
 
 	cd.Value.postProcess()
 
@@ -1177,7 +1445,9 @@ func (d *D) FieldStructRootBitBufFn(name string, br bitio.ReaderAtSeeker, fn fun
 	cd := d.fieldDecoder(name, br, c)
 	cd.Value.IsRoot = true
 	d.AddChild(cd.Value)
+	d.event(EventOpen, cd.Value, nil)
 	fn(cd)
+	d.event(EventClose, cd.Value, nil)
 
 	cd.Value.postProcess()
 
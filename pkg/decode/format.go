@@ -23,6 +23,11 @@ type Format struct {
 	Dependencies       []Dependency
 	Functions          []string
 	SkipDecodeFunction bool
+	// file extensions without dot and MIME types used as hints to probe this format first
+	Extensions []string
+	MIMETypes  []string
+	// named symbol maps, ex scalar.UintMapSymStr, exposed to jq using enum
+	Enums map[string]any
 }
 
 func FormatFn(fn func(d *D) any) *Group {
@@ -129,6 +129,23 @@ var UTF16BOM = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
 var UTF16BE = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
 var UTF16LE = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
 
+// PaddedText describes a fixed width text convention where text is optionally
+// terminated by Terminator and the rest of the width is filled with Pad.
+type PaddedText struct {
+	Name     string
+	Encoding encoding.Encoding
+	// -1 if not terminated
+	Terminator int
+	Pad        byte
+	// if set all text bytes has to be valid
+	ValidByte func(b byte) bool
+}
+
+func printableASCII(b byte) bool { return b >= 0x20 && b <= 0x7e }
+
+// PaddedTextSpace is printable ASCII padded with 0x20, ex ar headers.
+var PaddedTextSpace = PaddedText{Name: "space", Encoding: encoding.Nop, Terminator: -1, Pad: 0x20, ValidByte: printableASCII}
+
 func (d *D) tryText(nBytes int, e encoding.Encoding) (string, error) {
 	if nBytes < 0 {
 		return "", fmt.Errorf("tryText nBytes must be >= 0 (%d)", nBytes)
@@ -221,6 +238,60 @@ func (d *D) tryTextNullLen(fixedBytes int, e encoding.Encoding) (string, error)
 	return e.NewDecoder().String(string(bs))
 }
 
+// read fixedBytes of text using the convention described by pt
+// returns text and if padding and text bytes are well-formed
+func (d *D) tryTextPadded(fixedBytes int, pt PaddedText) (string, bool, error) {
+	if fixedBytes < 0 {
+		return "", false, fmt.Errorf("tryTextPadded fixedBytes must be >= 0 (%d)", fixedBytes)
+	}
+	bytesLeft := d.BitsLeft() / 8
+	if int64(fixedBytes) > bytesLeft {
+		return "", false, fmt.Errorf("tryTextPadded fixedBytes %d outside, %d bytes left", fixedBytes, bytesLeft)
+	}
+
+	bs, err := d.TryBytesLen(fixedBytes)
+	if err != nil {
+		return "", false, err
+	}
+
+	var text []byte
+	wellFormed := true
+	termIndex := -1
+	if pt.Terminator != -1 {
+		termIndex = bytes.IndexByte(bs, byte(pt.Terminator))
+	}
+	if termIndex != -1 {
+		text = bs[:termIndex]
+		for _, b := range bs[termIndex+1:] {
+			if b != pt.Pad {
+				wellFormed = false
+				break
+			}
+		}
+	} else {
+		text = bytes.TrimRight(bs, string([]byte{pt.Pad}))
+		// padding without a terminator is malformed if one is expected
+		if pt.Terminator != -1 && len(text) != len(bs) {
+			wellFormed = false
+		}
+	}
+	if pt.ValidByte != nil {
+		for _, b := range text {
+			if !pt.ValidByte(b) {
+				wellFormed = false
+				break
+			}
+		}
+	}
+
+	s, err := pt.Encoding.NewDecoder().String(string(text))
+	if err != nil {
+		return "", false, err
+	}
+
+	return s, wellFormed, nil
+}
+
 // ov is what to treat as 1
 func (d *D) tryUnary(ov uint64) (uint64, error) {
 	p := d.Pos()
@@ -262,7 +333,8 @@ func (d *D) tryULEB128() (uint64, error) {
 
 	for {
 		b := d.U8()
-		if shift >= 63 && b != 0 {
+		// last byte of a 64 bit value can only have the lowest bit set, ex: negative protobuf int32/int64
+		if (shift == 63 && b > 1) || shift > 63 {
 			return 0, fmt.Errorf("overflow when reading unsigned leb128, shift %d >= 63", shift)
 		}
 		result |= (b & 0b01111111) << shift
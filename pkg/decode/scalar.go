@@ -10,16 +10,13 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
-func bitBufIsZero(s scalar.BitBuf, isValidate bool) (scalar.BitBuf, error) {
-	br := s.Actual
-
-	isZero := true
+func isZero(br bitio.ReaderAtSeeker) (bool, error) {
 	// TODO: shared
 	b := make([]byte, 32*1024)
 	bLen := int64(len(b)) * 8
 	brLen, err := bitiox.Len(br)
 	if err != nil {
-		return scalar.BitBuf{}, err
+		return false, err
 	}
 	brLeft := brLen
 	brPos := int64(0)
@@ -36,18 +33,27 @@ func bitBufIsZero(s scalar.BitBuf, isValidate bool) (scalar.BitBuf, error) {
 
 		n, err := bitio.ReadAtFull(br, b, rl, brPos)
 		if err != nil {
-			return s, err
+			return false, err
 		}
 		nb := int(bitio.BitsByteCount(n))
 
 		for i := 0; i < nb; i++ {
 			if b[i] != 0 {
-				isZero = false
-				break
+				return false, nil
 			}
 		}
 
 		brLeft -= n
+		brPos += n
+	}
+
+	return true, nil
+}
+
+func bitBufIsZero(s scalar.BitBuf, isValidate bool) (scalar.BitBuf, error) {
+	isZero, err := isZero(s.Actual)
+	if err != nil {
+		return s, err
 	}
 
 	if isZero {
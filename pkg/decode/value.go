@@ -18,6 +18,12 @@ type Compound struct {
 	IsArray     bool
 }
 
+// Constraint is the result of checking an invariant between decoded fields
+type Constraint struct {
+	Description string
+	Valid       bool
+}
+
 // TODO: Encoding, u16le, varint etc, encode?
 // TODO: Value/Compound interface? can have per type and save memory
 // TODO: Make some fields optional somehow? map/slice?
@@ -32,6 +38,8 @@ type Value struct {
 	Range       ranges.Range
 	Index       int  // index in parent array/struct
 	IsRoot      bool // TODO: rework?
+	Constraints []Constraint
+	Sources     []ranges.Range // ranges a synthetic value was assembled from
 }
 
 type WalkFn func(v *Value, rootV *Value, depth int, rootDepth int) error
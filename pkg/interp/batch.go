@@ -0,0 +1,201 @@
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"runtime"
+	"strings"
+
+	"github.com/wader/fq/internal/mapstruct"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/gojq"
+)
+
+// batch decode many files using a pool of workers, files are read into memory and
+// closed so that a large number of files can be decoded without running out of
+// file descriptors
+
+func init() {
+	RegisterIter1("_batch_decode", (*Interp)._batchDecode)
+}
+
+type batchDecodeOpts struct {
+	Workers    int
+	Format     string
+	DecodeOpts map[string]any
+}
+
+type batchResult struct {
+	filename string
+	v        any
+	err      error
+}
+
+// filenames from stdin separated by NUL if there is one, otherwise by newline
+func batchReadFilenames(r io.Reader) ([]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sep := byte('\n')
+	if bytes.IndexByte(b, 0) != -1 {
+		sep = 0
+	}
+	var names []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(nil, len(b)+1)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for s.Scan() {
+		if n := strings.TrimSuffix(s.Text(), "\r"); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names, s.Err()
+}
+
+func (i *Interp) batchFilenames(c []any) ([]string, error) {
+	var names []string
+	for _, v := range c {
+		if v == nil {
+			ns, err := batchReadFilenames(i.OS.Stdin())
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, ns...)
+			continue
+		}
+		n, err := toString(v)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsAny(n, "*?[") {
+			names = append(names, n)
+			continue
+		}
+		ms, err := fs.Glob(i.OS.FS(), n)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, ms...)
+	}
+	return names, nil
+}
+
+func (i *Interp) batchDecodeFile(filename string, opts batchDecodeOpts) (any, error) {
+	f, err := i.OS.FS().Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	bv, err := NewBinaryFromBitReader(bitio.NewBitReader(buf, -1), 8, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	m := maps.Clone(opts.DecodeOpts)
+	if m == nil {
+		m = map[string]any{}
+	}
+	if isProbe, _ := m["is_probe"].(bool); isProbe {
+		m["filename"] = filename
+	}
+	var dopts decodeOpts
+	if err := mapstruct.ToStruct(m, &dopts); err != nil {
+		return nil, err
+	}
+
+	v := i._decode(bv, opts.Format, dopts)
+	if err, ok := v.(error); ok {
+		// same as normal decode path, failed formats are error values with stacktraces
+		if ve, ok := err.(valueError); ok {
+			if _, ok := ve.v.(string); !ok {
+				return nil, fmt.Errorf("%s: failed to decode", opts.Format)
+			}
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// _batch_decode({workers: 0, format: "probe", decode_opts: {...}})
+// input is array of filenames or glob patterns, null to read filenames from stdin
+// outputs {filename: "...", value: <decode value>} or {filename: "...", error: "..."}
+// in input order
+func (i *Interp) _batchDecode(c []any, v map[string]any) gojq.Iter {
+	var opts batchDecodeOpts
+	if err := mapstruct.ToStruct(v, &opts); err != nil {
+		return gojq.NewIter(err)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	filenames, err := i.batchFilenames(c)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	ctx := i.EvalInstance.Ctx
+	results := make([]chan batchResult, len(filenames))
+	for j := range results {
+		results[j] = make(chan batchResult, 1)
+	}
+	// released when result is consumed to limit number of decoded values in memory
+	sem := make(chan struct{}, opts.Workers)
+	go func() {
+		for j, filename := range filenames {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				dv, err := i.batchDecodeFile(filename, opts)
+				results[j] <- batchResult{filename: filename, v: dv, err: err}
+			}()
+		}
+	}()
+
+	j := 0
+	return iterFn(func() (any, bool) {
+		if j >= len(results) {
+			return nil, false
+		}
+		var r batchResult
+		select {
+		case r = <-results[j]:
+		case <-ctx.Done():
+			j = len(results)
+			return ctx.Err(), true
+		}
+		<-sem
+		j++
+
+		if r.err != nil {
+			var pe *fs.PathError
+			if errors.As(r.err, &pe) {
+				r.err = pe.Err
+			}
+			return map[string]any{"filename": r.filename, "error": r.err.Error()}, true
+		}
+		return map[string]any{"filename": r.filename, "value": r.v}, true
+	})
+}
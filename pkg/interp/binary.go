@@ -7,12 +7,16 @@ import (
 	"io"
 	"io/fs"
 	"math/big"
+	"slices"
+	"strings"
 
 	"github.com/wader/fq/internal/aheadreadseeker"
 	"github.com/wader/fq/internal/bitiox"
 	"github.com/wader/fq/internal/ctxreadseeker"
 	"github.com/wader/fq/internal/gojqx"
+	"github.com/wader/fq/internal/httpreadseeker"
 	"github.com/wader/fq/internal/iox"
+	"github.com/wader/fq/internal/mapstruct"
 	"github.com/wader/fq/internal/progressreadseeker"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/ranges"
@@ -21,7 +25,8 @@ import (
 
 func init() {
 	RegisterFunc1("_tobits", (*Interp)._toBits)
-	RegisterFunc0("open", (*Interp)._open)
+	RegisterFunc0("tobinary", (*Interp)._toBinary)
+	RegisterFunc1("_open", (*Interp)._open)
 }
 
 type ToBinary interface {
@@ -152,6 +157,59 @@ type toBitsOpts struct {
 	Unit       int
 	KeepRange  bool
 	PadToUnits int
+	// right pad to a multiple of units or to a size in units using fill byte
+	AlignUnits int
+	Size       int
+	Fill       int
+}
+
+type toBinaryField struct {
+	Bits   int64  `mapstruct:"bits"`
+	Value  any    `mapstruct:"value"`
+	Endian string `mapstruct:"endian"`
+}
+
+// _toBinary builds a binary from an array of {bits: 4, value: 15, endian: "little"}
+// objects, endian is optional and defaults to big, and binaries, strings or byte arrays
+func (i *Interp) _toBinary(c any) any {
+	vs, ok := gojqx.Cast[[]any](c)
+	if !ok {
+		return gojqx.FuncTypeError{Name: "tobinary", V: c}
+	}
+
+	var rr []bitio.ReadAtSeeker
+	for idx, v := range vs {
+		var br bitio.ReaderAtSeeker
+		var err error
+		if m, ok := v.(map[string]any); ok {
+			var f toBinaryField
+			if err := mapstruct.ToStruct(m, &f); err != nil {
+				return err
+			}
+			switch f.Endian {
+			case "", "big", "little":
+			default:
+				return fmt.Errorf("tobinary: %d: endian should be big or little: %q", idx, f.Endian)
+			}
+			br, err = uintBitReader(f.Value, f.Bits, f.Endian == "little")
+		} else {
+			br, err = ToBitReader(v)
+		}
+		if err != nil {
+			return fmt.Errorf("tobinary: %d: %w", idx, err)
+		}
+		rr = append(rr, br)
+	}
+
+	mr, err := bitio.NewMultiReader(rr...)
+	if err != nil {
+		return err
+	}
+	bb, err := NewBinaryFromBitReader(mr, 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
 }
 
 // note is used to implement tobytes* also
@@ -171,7 +229,28 @@ func (i *Interp) _toBits(c any, opts toBitsOpts) any {
 	bv.unit = opts.Unit
 	bv.pad = (pad - bv.r.Len%pad) % pad
 
+	unitBits := int64(opts.Unit)
+	bitLen := bv.pad + bv.r.Len
+	var rightPad int64
+	if opts.AlignUnits > 0 {
+		align := unitBits * int64(opts.AlignUnits)
+		rightPad = (align - bitLen%align) % align
+	}
+	if opts.Size > 0 {
+		sizeBits := unitBits * int64(opts.Size)
+		if bitLen+rightPad > sizeBits {
+			return fmt.Errorf("%d bits does not fit in size of %d bits", bitLen+rightPad, sizeBits)
+		}
+		rightPad = sizeBits - bitLen
+	}
+	if opts.Fill < 0 || opts.Fill > 255 {
+		return fmt.Errorf("fill should be a byte value 0-255, got %d", opts.Fill)
+	}
+
 	if opts.KeepRange {
+		if rightPad != 0 {
+			return fmt.Errorf("can't keep range when padding to size or alignment")
+		}
 		return bv
 	}
 
@@ -179,6 +258,13 @@ func (i *Interp) _toBits(c any, opts toBitsOpts) any {
 	if err != nil {
 		return err
 	}
+	if rightPad != 0 {
+		fill := bytes.Repeat([]byte{byte(opts.Fill)}, int(bitio.BitsByteCount(rightPad)))
+		br, err = bitio.NewMultiReader(br, bitio.NewBitReader(fill, rightPad))
+		if err != nil {
+			return err
+		}
+	}
 	bb, err := NewBinaryFromBitReader(br, bv.unit, 0)
 	if err != nil {
 		return err
@@ -186,6 +272,27 @@ func (i *Interp) _toBits(c any, opts toBitsOpts) any {
 	return bb
 }
 
+// uintBitReader nBits reader with non-negative integer v, big-endian or byte
+// reversed if littleEndian
+func uintBitReader(v any, nBits int64, littleEndian bool) (bitio.ReaderAtSeeker, error) {
+	bi, err := toBigInt(v)
+	if err != nil {
+		return nil, err
+	}
+	if bi.Sign() < 0 || int64(bi.BitLen()) > nBits {
+		return nil, fmt.Errorf("%s does not fit in %d bits", bi, nBits)
+	}
+	bs := make([]byte, bitio.BitsByteCount(nBits))
+	bi.FillBytes(bs)
+	if littleEndian {
+		if nBits%8 != 0 {
+			return nil, fmt.Errorf("little-endian requires byte aligned bit length, got %d bits", nBits)
+		}
+		slices.Reverse(bs)
+	}
+	return bitiox.Range(bitio.NewBitReader(bs, -1), int64(len(bs))*8-nBits, nBits)
+}
+
 type openFile struct {
 	Binary
 	filename   string
@@ -204,9 +311,19 @@ func (of *openFile) ToBinary() (Binary, error) {
 	return NewBinaryFromBitReader(of.br, 8, 0)
 }
 
+type openOpts struct {
+	// start reading at byte offset
+	Offset int64
+	// read at most length bytes, 0 means to end of file
+	Length int64
+	// max number of bytes to read from non-seekable files like character
+	// devices, 0 means no limit
+	ReadLimit int64
+}
+
 // opens a file for reading from filesystem
 // TODO: when to close? when br loses all refs? need to use finalizer somehow?
-func (i *Interp) _open(c any) any {
+func (i *Interp) _open(c any, opts openOpts) any {
 	if i.EvalInstance.IsCompleting {
 		// TODO: have dummy values for each type for completion?
 		br, _ := NewBinaryFromBitReader(bitio.NewBitReader([]byte{}, -1), 8, 0)
@@ -226,6 +343,9 @@ func (i *Interp) _open(c any) any {
 		if err != nil {
 			return fmt.Errorf("%s: %w", path, err)
 		}
+		if isURL(path) {
+			return i.openURL(path)
+		}
 		f, err = i.OS.FS().Open(path)
 		if err != nil {
 			// path context added in jq error code
@@ -249,16 +369,50 @@ func (i *Interp) _open(c any) any {
 	// ctxreadseeker is used to make sure any io calls can be canceled
 	// TODO: ctxreadseeker might leak if the underlying call hangs forever
 
+	if opts.Offset < 0 || opts.Length < 0 {
+		f.Close()
+		return errors.New("offset and length can't be negative")
+	}
+
 	// a regular file should be seekable but fallback below to read whole file if not
-	if fFI.Mode().IsRegular() {
-		if rs, ok := f.(io.ReadSeeker); ok {
+	// procfs files like /proc/<pid>/mem are regular but have zero size so also read those
+	if fFI.Mode().IsRegular() && fFI.Size() > 0 {
+		if ra, ok := f.(io.ReaderAt); ok && (opts.Offset != 0 || opts.Length != 0) {
+			n := max(0, fFI.Size()-opts.Offset)
+			if opts.Length != 0 {
+				n = min(n, opts.Length)
+			}
+			fRS = ctxreadseeker.New(i.EvalInstance.Ctx, io.NewSectionReader(ra, opts.Offset, n))
+			bEnd = n
+		} else if rs, ok := f.(io.ReadSeeker); ok && opts.Offset == 0 && opts.Length == 0 {
 			fRS = ctxreadseeker.New(i.EvalInstance.Ctx, rs)
 			bEnd = fFI.Size()
 		}
 	}
 
 	if fRS == nil {
-		buf, err := io.ReadAll(ctxreadseeker.New(i.EvalInstance.Ctx, &iox.ReadErrSeeker{Reader: f}))
+		var r io.Reader = f
+		if opts.Offset != 0 {
+			// devices and procfs usually support seek, otherwise skip by reading
+			if s, ok := f.(io.Seeker); ok {
+				_, err = s.Seek(opts.Offset, io.SeekStart)
+			} else {
+				_, err = io.CopyN(io.Discard, f, opts.Offset)
+			}
+			if err != nil {
+				f.Close()
+				return err
+			}
+		}
+		limit := opts.ReadLimit
+		if opts.Length != 0 && (limit == 0 || opts.Length < limit) {
+			limit = opts.Length
+		}
+		if limit != 0 {
+			r = io.LimitReader(r, limit)
+		}
+
+		buf, err := io.ReadAll(ctxreadseeker.New(i.EvalInstance.Ctx, &iox.ReadErrSeeker{Reader: r}))
 		if err != nil {
 			f.Close()
 			return err
@@ -267,6 +421,31 @@ func (i *Interp) _open(c any) any {
 		bEnd = int64(len(buf))
 	}
 
+	return i.newOpenFile(path, fRS, bEnd)
+}
+
+func isURL(s string) bool {
+	for _, p := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// opens a HTTP(S) URL, reads are done using range requests if supported
+func (i *Interp) openURL(url string) any {
+	if strings.HasPrefix(url, "s3://") {
+		return errors.New("s3 URLs are not supported, use a presigned https URL")
+	}
+	rs, err := httpreadseeker.New(i.EvalInstance.Ctx, nil, url)
+	if err != nil {
+		return err
+	}
+	return i.newOpenFile(url, rs, rs.Size())
+}
+
+func (i *Interp) newOpenFile(path string, fRS io.ReadSeeker, bEnd int64) *openFile {
 	bbf := &openFile{
 		filename: path,
 	}
@@ -0,0 +1,65 @@
+package interp
+
+import (
+	"github.com/wader/fq/pkg/bitio"
+)
+
+func init() {
+	RegisterFunc2("bindiff", (*Interp).bindiff)
+}
+
+// byte level diff of two binaries compared at same offsets, outputs an array of
+// hunks of consecutive differing bytes as {offset, length, a, b}, if sizes differ
+// the bytes past the end of the shorter binary are in the last hunk
+func (i *Interp) bindiff(c any, a any, b any) any {
+	ab, err := toBytes(a)
+	if err != nil {
+		return err
+	}
+	bb, err := toBytes(b)
+	if err != nil {
+		return err
+	}
+
+	sub := func(buf []byte, start int, stop int) (any, error) {
+		start = min(start, len(buf))
+		stop = min(stop, len(buf))
+		return NewBinaryFromBitReader(bitio.NewBitReader(buf[start:stop], -1), 8, 0)
+	}
+	hunk := func(start int, stop int) (any, error) {
+		av, err := sub(ab, start, stop)
+		if err != nil {
+			return nil, err
+		}
+		bv, err := sub(bb, start, stop)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"offset": start,
+			"length": stop - start,
+			"a":      av,
+			"b":      bv,
+		}, nil
+	}
+
+	hunks := []any{}
+	n := max(len(ab), len(bb))
+	start := -1
+	for j := 0; j <= n; j++ {
+		differ := j < n && (j >= len(ab) || j >= len(bb) || ab[j] != bb[j])
+		switch {
+		case differ && start == -1:
+			start = j
+		case !differ && start != -1:
+			h, err := hunk(start, j)
+			if err != nil {
+				return err
+			}
+			hunks = append(hunks, h)
+			start = -1
+		}
+	}
+
+	return hunks
+}
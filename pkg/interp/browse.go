@@ -0,0 +1,585 @@
+package interp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wader/fq/internal/asciiwriter"
+	"github.com/wader/fq/internal/bitiox"
+	"github.com/wader/fq/internal/hexpairwriter"
+	"github.com/wader/fq/internal/mathx"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// full screen browser with a tree pane and a hexdump pane following the selected value.
+// If input is not a terminal keys are read from it and only the last screen is
+// rendered, used by tests.
+
+// RawTerminal can optionally be implemented by Input to support full screen modes
+type RawTerminal interface {
+	MakeRaw() (restore func() error, err error)
+}
+
+const browseHelp = "arrows/hjkl move, enter toggle, / search, n/N next/prev match, y copy path, q quit"
+
+type browseNode struct {
+	v        *decode.Value
+	parent   *browseNode
+	depth    int
+	expanded bool
+	children []*browseNode
+}
+
+func (n *browseNode) isCompound() bool {
+	dc, ok := n.v.V.(*decode.Compound)
+	return ok && len(dc.Children) > 0
+}
+
+func (n *browseNode) kids() []*browseNode {
+	dc, ok := n.v.V.(*decode.Compound)
+	if !ok || n.children != nil {
+		return n.children
+	}
+	for _, c := range dc.Children {
+		n.children = append(n.children, &browseNode{v: c, parent: n, depth: n.depth + 1})
+	}
+	return n.children
+}
+
+type browseKey struct {
+	r   rune
+	seq string // escape sequence without ESC, ex: "[A"
+}
+
+type browser struct {
+	opts     *Options
+	root     *browseNode
+	visible  []*browseNode
+	cursor   int
+	top      int
+	hexTop   int64
+	width    int
+	height   int
+	search   string
+	inSearch bool
+	status   string
+	copyFn   func(s string)
+}
+
+func newBrowser(v *decode.Value, opts *Options, width int, height int) *browser {
+	b := &browser{
+		opts:   opts,
+		root:   &browseNode{v: v, expanded: true},
+		width:  width,
+		height: height,
+		hexTop: -1,
+	}
+	b.updateVisible()
+	return b
+}
+
+func (b *browser) updateVisible() {
+	b.visible = b.visible[:0]
+	var walk func(n *browseNode)
+	walk = func(n *browseNode) {
+		b.visible = append(b.visible, n)
+		if !n.expanded {
+			return
+		}
+		for _, c := range n.kids() {
+			walk(c)
+		}
+	}
+	walk(b.root)
+	b.cursor = max(0, min(b.cursor, len(b.visible)-1))
+}
+
+func (b *browser) selected() *browseNode { return b.visible[b.cursor] }
+
+func (b *browser) paneHeight() int {
+	// title and status line
+	return max(1, b.height-2)
+}
+
+func (b *browser) selectNode(n *browseNode) {
+	for p := n.parent; p != nil; p = p.parent {
+		p.expanded = true
+	}
+	b.updateVisible()
+	for i, vn := range b.visible {
+		if vn == n {
+			b.cursor = i
+			break
+		}
+	}
+}
+
+// nodeFor returns node for value expanding and creating nodes as needed
+func (b *browser) nodeFor(v *decode.Value) *browseNode {
+	var path []*decode.Value
+	for pv := v; pv != nil && pv != b.root.v; pv = pv.Parent {
+		path = append(path, pv)
+	}
+	n := b.root
+	for i := len(path) - 1; i >= 0; i-- {
+		for _, c := range n.kids() {
+			if c.v == path[i] {
+				n = c
+				break
+			}
+		}
+	}
+	return n
+}
+
+func (b *browser) matches(v *decode.Value, lq string) bool {
+	if strings.Contains(strings.ToLower(v.Name), lq) {
+		return true
+	}
+	if s, ok := v.V.(scalar.Scalarable); ok {
+		return strings.Contains(strings.ToLower(previewScalar(s, b.opts)), lq)
+	}
+	return false
+}
+
+func (b *browser) findNext(backwards bool) {
+	if b.search == "" {
+		return
+	}
+	lq := strings.ToLower(b.search)
+	current := b.selected().v
+	var matches []*decode.Value
+	currentIndex := 0
+	currentMatches := false
+	_ = b.root.v.WalkPreOrder(func(v *decode.Value, _ *decode.Value, _ int, _ int) error {
+		isMatch := b.matches(v, lq)
+		if v == current {
+			currentIndex = len(matches)
+			currentMatches = isMatch
+		}
+		if isMatch {
+			matches = append(matches, v)
+		}
+		return nil
+	})
+	if len(matches) == 0 {
+		b.status = fmt.Sprintf("%s: not found", b.search)
+		return
+	}
+
+	i := currentIndex - 1
+	if !backwards {
+		i = currentIndex
+		if currentMatches {
+			i++
+		}
+	}
+	i = (i%len(matches) + len(matches)) % len(matches)
+	b.selectNode(b.nodeFor(matches[i]))
+	b.status = fmt.Sprintf("%s: %d/%d", b.search, i+1, len(matches))
+}
+
+// handle returns false when browser should quit
+func (b *browser) handle(k browseKey) bool {
+	if !b.inSearch && (k.r == 'q' || k.r == 0x03) {
+		return false
+	}
+	b.status = ""
+
+	if b.inSearch {
+		switch {
+		case k.r == '\r' || k.r == '\n':
+			b.inSearch = false
+			b.findNext(false)
+		case k.r == 0x1b || k.r == 0x03:
+			b.inSearch = false
+		case k.r == 0x7f || k.r == 0x08:
+			if len(b.search) > 0 {
+				_, size := utf8.DecodeLastRuneInString(b.search)
+				b.search = b.search[:len(b.search)-size]
+			}
+		case k.seq == "" && k.r >= ' ':
+			b.search += string(k.r)
+		}
+		return true
+	}
+
+	n := b.selected()
+	page := b.paneHeight()
+	switch {
+	case k.r == 'k' || k.seq == "[A":
+		b.cursor--
+	case k.r == 'j' || k.seq == "[B":
+		b.cursor++
+	case k.r == 'h' || k.seq == "[D":
+		if n.expanded && n.isCompound() {
+			n.expanded = false
+		} else if n.parent != nil {
+			b.selectNode(n.parent)
+		}
+	case k.r == 'l' || k.seq == "[C":
+		if !n.isCompound() {
+			break
+		}
+		if n.expanded {
+			b.cursor++
+		} else {
+			n.expanded = true
+		}
+	case k.r == '\r' || k.r == '\n' || k.r == ' ':
+		if n.isCompound() {
+			n.expanded = !n.expanded
+		}
+	case k.r == 'g' || k.seq == "[H" || k.seq == "[1~":
+		b.cursor = 0
+	case k.r == 'G' || k.seq == "[F" || k.seq == "[4~":
+		b.cursor = len(b.visible) - 1
+	case k.r == 0x02 || k.seq == "[5~":
+		b.cursor -= page
+	case k.r == 0x06 || k.seq == "[6~":
+		b.cursor += page
+	case k.r == '/':
+		b.inSearch = true
+		b.search = ""
+	case k.r == 'n':
+		b.findNext(false)
+	case k.r == 'N':
+		b.findNext(true)
+	case k.r == 'y':
+		p := valuePathExprDecorated(n.v, PlainDecorator)
+		if b.copyFn != nil {
+			b.copyFn(p)
+		}
+		b.status = "copied " + p
+	case k.r == '?':
+		b.status = browseHelp
+	}
+	b.updateVisible()
+
+	return true
+}
+
+func browseTruncate(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		r := []rune(s)
+		return string(r[0:width])
+	}
+	return s + indentStr(width-n)
+}
+
+func (b *browser) nodeLabel(n *browseNode) string {
+	v := n.v
+
+	marker := " "
+	if n.isCompound() {
+		switch {
+		case n.expanded && b.opts.Unicode:
+			marker = "▾"
+		case n.expanded:
+			marker = "-"
+		case b.opts.Unicode:
+			marker = "▸"
+		default:
+			marker = "+"
+		}
+	}
+
+	name := v.Name
+	if v.Parent != nil {
+		if dc, ok := v.Parent.V.(*decode.Compound); ok && dc.IsArray {
+			name = "[" + strconv.Itoa(v.Index) + "]"
+		}
+	}
+	if n == b.root {
+		name = valuePathExprDecorated(v, PlainDecorator)
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString(indentStr(n.depth * treeIndentWidth))
+	sb.WriteString(marker)
+	sb.WriteString(name)
+	switch vv := v.V.(type) {
+	case *decode.Compound:
+		if vv.IsArray {
+			fmt.Fprintf(sb, "[%d]:", len(vv.Children))
+		} else {
+			sb.WriteString("{}:")
+		}
+		if vv.Description != "" {
+			fmt.Fprintf(sb, " %s", vv.Description)
+		}
+	case scalar.Scalarable:
+		fmt.Fprintf(sb, ": %s", previewScalar(vv, b.opts))
+		if d := vv.ScalarDescription(); d != "" {
+			fmt.Fprintf(sb, " (%s)", d)
+		}
+	}
+	if v.Format != nil {
+		fmt.Fprintf(sb, " (%s)", v.Format.Name)
+	}
+	if v.Err != nil {
+		sb.WriteString(" error")
+	}
+
+	return sb.String()
+}
+
+func (b *browser) hexLines(n *browseNode, lineBytes int64, rows int) ([]string, error) {
+	deco := b.opts.Decorator
+	v := n.v
+
+	rs := []ranges.Range{v.InnerRange()}
+	if len(v.Sources) > 0 {
+		rs = v.Sources
+	}
+	if s, ok := v.V.(scalar.Scalarable); ok && s.ScalarFlags().IsSynthetic() && len(v.Sources) == 0 {
+		return []string{"synthetic"}, nil
+	}
+	sel := rs[0]
+	for _, r := range rs[1:] {
+		sel = ranges.MinMax(sel, r)
+	}
+
+	rootBitLen, err := bitiox.Len(v.RootReader)
+	if err != nil {
+		return nil, err
+	}
+	totalLines := (rootBitLen/8 + lineBytes - 1) / lineBytes
+	addrWidth := len(mathx.PadFormatInt(max(0, totalLines-1)*lineBytes, b.opts.Addrbase, true, 0))
+
+	// scroll only when selection start is outside of view
+	selLine := sel.Start / 8 / lineBytes
+	if b.hexTop < 0 || selLine < b.hexTop || selLine >= b.hexTop+int64(rows) {
+		b.hexTop = max(0, selLine-int64(rows)/4)
+	}
+
+	hexFn := dumpHighlightFn(b.hexTop*lineBytes, rs, func(c byte) string {
+		return deco.DumpHighlight.Wrap(deco.ByteColor(c).Wrap(hexpairwriter.Pair(c)))
+	}, func(c byte) string {
+		if b.opts.Color {
+			return deco.DumpContext.Wrap(hexpairwriter.Pair(c))
+		}
+		return "  "
+	})
+	asciiFn := dumpHighlightFn(b.hexTop*lineBytes, rs, func(c byte) string {
+		return deco.DumpHighlight.Wrap(deco.ByteColor(c).Wrap(asciiwriter.SafeASCII(c)))
+	}, func(c byte) string {
+		if b.opts.Color {
+			return deco.DumpContext.Wrap(asciiwriter.SafeASCII(c))
+		}
+		return " "
+	})
+
+	var lines []string
+	buf := make([]byte, lineBytes)
+	for l := b.hexTop; l < min(b.hexTop+int64(rows), totalLines); l++ {
+		start := l * lineBytes * 8
+		nBits := min(lineBytes*8, rootBitLen-start)
+		br, err := bitiox.Range(v.RootReader, start, nBits)
+		if err != nil {
+			return nil, err
+		}
+		nBytes := int(bitio.BitsByteCount(nBits))
+		if _, err := bitio.ReadFull(br, buf, nBits); err != nil {
+			return nil, err
+		}
+
+		hex := &strings.Builder{}
+		ascii := &strings.Builder{}
+		for i := 0; i < int(lineBytes); i++ {
+			if i > 0 {
+				hex.WriteByte(' ')
+			}
+			if i < nBytes {
+				hex.WriteString(hexFn(buf[i]))
+				ascii.WriteString(asciiFn(buf[i]))
+			} else {
+				hex.WriteString("  ")
+				ascii.WriteByte(' ')
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s%s%s%s%s",
+			deco.DumpAddr.Wrap(mathx.PadFormatInt(l*lineBytes, b.opts.Addrbase, true, addrWidth)),
+			deco.Column,
+			hex.String(),
+			deco.Column,
+			ascii.String(),
+		))
+	}
+
+	return lines, nil
+}
+
+func (b *browser) render() ([]string, error) {
+	deco := b.opts.Decorator
+	rows := b.paneHeight()
+
+	// keep cursor in view
+	if b.cursor < b.top {
+		b.top = b.cursor
+	} else if b.cursor >= b.top+rows {
+		b.top = b.cursor - rows + 1
+	}
+
+	lineBytes := int64(16)
+	if b.width < 120 {
+		lineBytes = 8
+	}
+	// addr, hex and ascii columns, addr width is approximated
+	hexWidth := 8 + 1 + int(lineBytes)*3 - 1 + 1 + int(lineBytes)
+	treeWidth := max(10, b.width-hexWidth-utf8.RuneCountInString(deco.Column))
+
+	n := b.selected()
+	hex, err := b.hexLines(n, lineBytes, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	title := valuePathExprDecorated(b.root.v, PlainDecorator)
+	if b.root.v.Format != nil {
+		title += " (" + b.root.v.Format.Name + ")"
+	}
+
+	lines := []string{deco.DumpHeader.Wrap(browseTruncate("fq browse "+title, b.width))}
+	for i := 0; i < rows; i++ {
+		tree := indentStr(treeWidth)
+		if vi := b.top + i; vi < len(b.visible) {
+			vn := b.visible[vi]
+			cursor := " "
+			if vi == b.cursor && !b.opts.Color {
+				cursor = "*"
+			}
+			tree = browseTruncate(cursor+b.nodeLabel(vn), treeWidth)
+			if vi == b.cursor && b.opts.Color {
+				tree = deco.DumpHighlight.Wrap(tree)
+			}
+		}
+		h := ""
+		if i < len(hex) {
+			h = hex[i]
+		}
+		lines = append(lines, tree+deco.Column+h)
+	}
+
+	var status string
+	switch {
+	case b.inSearch:
+		status = "/" + b.search
+	case b.status != "":
+		status = b.status
+	default:
+		status = valuePathExprDecorated(n.v, PlainDecorator) + " " +
+			mathx.BitRange(n.v.InnerRange()).StringByteBits(b.opts.Addrbase) + " (? for help)"
+	}
+	lines = append(lines, browseTruncate(status, b.width))
+
+	return lines, nil
+}
+
+func readBrowseKey(r *bufio.Reader) (browseKey, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return browseKey{}, err
+	}
+	// escape sequences are assumed to arrive in one read, lone escape otherwise
+	if c != 0x1b || r.Buffered() == 0 {
+		return browseKey{r: c}, nil
+	}
+	sb := &strings.Builder{}
+	for r.Buffered() > 0 {
+		sc, _, err := r.ReadRune()
+		if err != nil {
+			return browseKey{}, err
+		}
+		sb.WriteRune(sc)
+		if sb.Len() > 1 && (sc >= 'A' && sc <= 'Z' || sc == '~') {
+			break
+		}
+	}
+	return browseKey{seq: sb.String()}, nil
+}
+
+func browse(v *decode.Value, in Input, out Output, opts *Options) error {
+	width, height := out.Size()
+	if width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	b := newBrowser(v, opts, width, height)
+
+	rt, isRaw := in.(RawTerminal)
+	isRaw = isRaw && in.IsTerminal()
+	if isRaw {
+		restore, err := rt.MakeRaw()
+		if err != nil {
+			return err
+		}
+		// alternative screen and hide cursor
+		fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+		defer func() {
+			fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+			_ = restore()
+		}()
+		b.copyFn = func(s string) {
+			// OSC 52 set clipboard
+			fmt.Fprintf(out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(s)))
+		}
+	}
+
+	draw := func(eol string) error {
+		if isRaw {
+			b.width, b.height = out.Size()
+			if b.width <= 0 || b.height <= 0 {
+				b.width, b.height = width, height
+			}
+		}
+		lines, err := b.render()
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(out)
+		if isRaw {
+			fmt.Fprint(bw, "\x1b[H")
+		}
+		for i, l := range lines {
+			fmt.Fprint(bw, l, eol)
+			if !isRaw || i < len(lines)-1 {
+				fmt.Fprint(bw, "\n")
+			}
+		}
+		return bw.Flush()
+	}
+
+	r := bufio.NewReader(in)
+	for {
+		if isRaw {
+			if err := draw("\x1b[K\r"); err != nil {
+				return err
+			}
+		}
+		k, err := readBrowseKey(r)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		if !b.handle(k) {
+			break
+		}
+	}
+	if !isRaw {
+		return draw("")
+	}
+
+	return nil
+}
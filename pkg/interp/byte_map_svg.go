@@ -0,0 +1,169 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/wader/fq/internal/mathx"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// SVG with one cell per byte colored by the value owning it. Owners are leaf
+// values or values at max depth, bytes owned by more than one value are outlined
+// as overlaps and gap fields filled by the decoder are gray.
+
+const (
+	byteMapCell       = 14
+	byteMapAddrWidth  = 80
+	byteMapLegendGap  = 24
+	byteMapLegendLine = 16
+)
+
+type byteMapOwner struct {
+	path  string
+	color string
+	gap   bool
+}
+
+func byteMapColor(i int) string {
+	// golden angle to spread out hues of neighboring owners
+	return fmt.Sprintf("hsl(%d, 70%%, 70%%)", (i*137)%360)
+}
+
+func byteMapSVG(v *decode.Value, w io.Writer, opts *Options) error {
+	innerRange := v.InnerRange()
+	startByte := innerRange.Start / 8
+	stopByte := (innerRange.Stop() + 7) / 8
+	byteOwner := make([]int, stopByte-startByte)
+	byteOverlap := make([]bool, stopByte-startByte)
+	// bits used in each byte so that bit fields sharing a byte are not overlaps
+	byteBits := make([]uint8, stopByte-startByte)
+	for i := range byteOwner {
+		byteOwner[i] = -1
+	}
+
+	var owners []byteMapOwner
+	hasOverlap := false
+
+	if err := v.WalkPreOrder(func(wv *decode.Value, _ *decode.Value, depth int, _ int) error {
+		if wv.RootReader != v.RootReader {
+			return decode.ErrWalkSkipChildren
+		}
+		isGap := false
+		switch vv := wv.V.(type) {
+		case *decode.Compound:
+			if (opts.Depth == 0 || depth < opts.Depth) && len(vv.Children) > 0 {
+				return nil
+			}
+		case scalar.Scalarable:
+			if vv.ScalarFlags().IsSynthetic() {
+				return nil
+			}
+			isGap = vv.ScalarFlags().IsGap()
+		}
+
+		r := wv.InnerRange()
+		if r.Len == 0 {
+			return decode.ErrWalkSkipChildren
+		}
+
+		color := byteMapColor(len(owners))
+		if isGap {
+			color = "#ccc"
+		}
+		owner := len(owners)
+		owners = append(owners, byteMapOwner{
+			path:  valuePathExprDecorated(wv, PlainDecorator),
+			color: color,
+			gap:   isGap,
+		})
+
+		for b := max(r.Start/8, startByte); b < min((r.Stop()+7)/8, stopByte); b++ {
+			i := b - startByte
+			var bits uint8
+			for bit := max(r.Start, b*8); bit < min(r.Stop(), b*8+8); bit++ {
+				bits |= 0x80 >> (bit - b*8)
+			}
+			if byteBits[i]&bits != 0 {
+				byteOverlap[i] = true
+				hasOverlap = true
+			}
+			byteBits[i] |= bits
+			if byteOwner[i] == -1 {
+				byteOwner[i] = owner
+			}
+		}
+
+		return decode.ErrWalkSkipChildren
+	}); err != nil {
+		return err
+	}
+
+	lineBytes := int64(opts.LineBytes)
+	lines := (stopByte - (startByte/lineBytes)*lineBytes + lineBytes - 1) / lineBytes
+	gridWidth := byteMapAddrWidth + int(lineBytes)*byteMapCell
+	legendX := gridWidth + byteMapLegendGap
+	legendLines := len(owners)
+	if hasOverlap {
+		legendLines++
+	}
+	width := legendX + 400
+	height := max(int(lines)*byteMapCell, legendLines*byteMapLegendLine) + byteMapCell
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="11">`+"\n", width, height)
+
+	lineStart := (startByte / lineBytes) * lineBytes
+	for l := int64(0); l < lines; l++ {
+		fmt.Fprintf(bw, `<text x="0" y="%d">%s</text>`+"\n",
+			int(l)*byteMapCell+byteMapCell-3,
+			mathx.PadFormatInt(lineStart+l*lineBytes, opts.Addrbase, true, 0),
+		)
+	}
+	for i, owner := range byteOwner {
+		b := startByte + int64(i)
+		x := byteMapAddrWidth + int((b-lineStart)%lineBytes)*byteMapCell
+		y := int((b-lineStart)/lineBytes) * byteMapCell
+		color := "#fff"
+		title := "none"
+		if owner != -1 {
+			color = owners[owner].color
+			title = owners[owner].path
+		}
+		stroke := `stroke="#fff"`
+		if byteOverlap[i] {
+			stroke = `stroke="red" stroke-width="2"`
+			title += " (overlap)"
+		}
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" %s><title>%s %s</title></rect>`+"\n",
+			x, y, byteMapCell, byteMapCell, color, stroke,
+			mathx.PadFormatInt(b, opts.Addrbase, true, 0), html.EscapeString(title),
+		)
+	}
+
+	ly := 0
+	legend := func(color string, stroke string, text string) {
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" %s/><text x="%d" y="%d">%s</text>`+"\n",
+			legendX, ly, byteMapCell-2, byteMapCell-2, color, stroke,
+			legendX+byteMapCell+4, ly+byteMapCell-4, html.EscapeString(text),
+		)
+		ly += byteMapLegendLine
+	}
+	for _, o := range owners {
+		text := o.path
+		if o.gap {
+			text += " (gap)"
+		}
+		legend(o.color, "", text)
+	}
+	if hasOverlap {
+		legend("#fff", `stroke="red" stroke-width="2"`, "overlap")
+	}
+
+	fmt.Fprint(bw, "</svg>\n")
+
+	return bw.Flush()
+}
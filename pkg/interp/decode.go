@@ -2,15 +2,24 @@ package interp
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math/big"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/copystructure"
 	"github.com/wader/fq/internal/bitiox"
+	"github.com/wader/fq/internal/ctxreadseeker"
 	"github.com/wader/fq/internal/gojqx"
 	"github.com/wader/fq/internal/iox"
 	"github.com/wader/fq/internal/mapstruct"
@@ -25,6 +34,11 @@ func init() {
 	RegisterFunc0("_registry", (*Interp)._registry)
 	RegisterFunc1("_tovalue", (*Interp)._toValue)
 	RegisterFunc2("_decode", (*Interp)._decode)
+	RegisterFunc0("_validate", (*Interp)._validate)
+	RegisterFunc0("_probe_scores", (*Interp)._probeScores)
+	RegisterFunc1("_carve", (*Interp)._carve)
+	RegisterIter1("_stream_decode", (*Interp)._streamDecode)
+	RegisterFunc1("_patch", (*Interp)._patch)
 }
 
 // TODO: redo/rename
@@ -36,6 +50,28 @@ type DecodeValue interface {
 	DecodeValue() *decode.Value
 }
 
+// enumToMap converts a symbol map like scalar.UintMapSymStr to a map from
+// actual value as string to symbolic value, or description if there is no symbol
+func enumToMap(m any) map[string]any {
+	em := map[string]any{}
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map {
+		return em
+	}
+	iter := rv.MapRange()
+	for iter.Next() {
+		v := iter.Value().Interface()
+		if s, ok := v.(scalar.Scalarable); ok {
+			v = s.ScalarSym()
+			if v == nil {
+				v = s.ScalarDescription()
+			}
+		}
+		em[fmt.Sprint(iter.Key().Interface())] = v
+	}
+	return em
+}
+
 func (i *Interp) _registry(c any) any {
 	uniqueFormats := map[string]*decode.Format{}
 
@@ -65,6 +101,20 @@ func (i *Interp) _registry(c any) any {
 			"root_array":           f.RootArray,
 			"skip_decode_function": f.SkipDecodeFunction,
 		}
+		if f.Extensions != nil {
+			var ss []any
+			for _, s := range f.Extensions {
+				ss = append(ss, s)
+			}
+			vf["extensions"] = ss
+		}
+		if f.MIMETypes != nil {
+			var ss []any
+			for _, s := range f.MIMETypes {
+				ss = append(ss, s)
+			}
+			vf["mime_types"] = ss
+		}
 
 		var dependenciesVs []any
 		for _, d := range f.Dependencies {
@@ -109,6 +159,14 @@ func (i *Interp) _registry(c any) any {
 			vf["decode_in_arg"] = gojqx.Normalize(args)
 		}
 
+		if f.Enums != nil {
+			enums := map[string]any{}
+			for name, m := range f.Enums {
+				enums[name] = enumToMap(m)
+			}
+			vf["enums"] = gojqx.Normalize(enums)
+		}
+
 		if f.Functions != nil {
 			var ss []any
 			for _, f := range f.Functions {
@@ -169,9 +227,146 @@ func (i *Interp) _toValue(c any, om map[string]any) any {
 }
 
 type decodeOpts struct {
-	Force    bool
-	Progress string
-	Remain   map[string]any `mapstruct:",remain"`
+	Force         bool
+	Progress      string
+	ReservedCheck string
+	MIMEType      string
+	ProbeExt      map[string]any
+	Parallel      bool
+	DecodeEvents  bool           `mapstruct:"decode_events"`
+	Remain        map[string]any `mapstruct:",remain"`
+}
+
+var decodeEventKindNames = map[decode.EventKind]string{
+	decode.EventOpen:  "open",
+	decode.EventClose: "close",
+	decode.EventValue: "value",
+	decode.EventError: "error",
+}
+
+type decodeEvent struct {
+	Event  string `json:"event"`
+	Format string `json:"format,omitempty"`
+	Path   string `json:"path"`
+	Start  int64  `json:"start"`
+	Len    *int64 `json:"len,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// path expression for a value that might still be decoding, Index is
+// only set after decode so look it up, usually the last child
+func decodeEventPath(v *decode.Value) string {
+	var parts []string
+	for ; v.Parent != nil; v = v.Parent {
+		c, ok := v.Parent.V.(*decode.Compound)
+		if !ok {
+			break
+		}
+		if !c.IsArray {
+			parts = append(parts, "."+v.Name)
+			continue
+		}
+		for j := len(c.Children) - 1; j >= 0; j-- {
+			if c.Children[j] == v {
+				parts = append(parts, "["+strconv.Itoa(j)+"]")
+				break
+			}
+		}
+	}
+	slices.Reverse(parts)
+	if len(parts) == 0 || parts[0][0] == '[' {
+		parts = append([]string{"."}, parts...)
+	}
+	return strings.Join(parts, "")
+}
+
+// eventFn that writes decode events as JSON lines to w
+func decodeEventsFn(w io.Writer) func(e decode.Event) {
+	var mu sync.Mutex
+	je := json.NewEncoder(w)
+	return func(e decode.Event) {
+		de := decodeEvent{
+			Event: decodeEventKindNames[e.Kind],
+			Path:  decodeEventPath(e.Value),
+			Start: e.Value.Range.Start,
+		}
+		for v := e.Value; v != nil; v = v.Parent {
+			if v.Format != nil {
+				de.Format = v.Format.Name
+				break
+			}
+		}
+		if e.Kind == decode.EventValue {
+			l := e.Value.Range.Len
+			de.Len = &l
+		}
+		if e.Err != nil {
+			de.Error = e.Err.Error()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_ = je.Encode(de)
+	}
+}
+
+// probeHintGroup returns group with formats probed in order: format overridden
+// for the filename extension by probeExt, formats with matching extension or
+// MIME type hint, and then the rest in group order.
+func (i *Interp) probeHintGroup(group *decode.Group, filename string, mimeType string, probeExt map[string]any) (*decode.Group, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if ext == "" && mimeType == "" {
+		return group, nil
+	}
+
+	var overrideFormats []*decode.Format
+	for k, v := range probeExt {
+		if ext == "" || !strings.EqualFold(k, ext) {
+			continue
+		}
+		name, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("probe_ext: %s: expected a format name string got %s", k, gojqx.TypeErrorPreview(v))
+		}
+		og, err := i.Registry.Group(name)
+		if err != nil {
+			return nil, fmt.Errorf("probe_ext: %s: %w", k, err)
+		}
+		overrideFormats = og.Formats
+	}
+
+	hintRank := func(f *decode.Format) int {
+		if slices.Contains(overrideFormats, f) {
+			return 0
+		}
+		if ext != "" && slices.ContainsFunc(f.Extensions, func(s string) bool { return strings.EqualFold(s, ext) }) {
+			return 1
+		}
+		if mimeType != "" && slices.ContainsFunc(f.MIMETypes, func(s string) bool { return strings.EqualFold(s, mimeType) }) {
+			return 1
+		}
+		return 2
+	}
+
+	var formats []*decode.Format
+	for _, f := range overrideFormats {
+		if !slices.Contains(group.Formats, f) {
+			formats = append(formats, f)
+		}
+	}
+	formats = append(formats, group.Formats...)
+	sort.SliceStable(formats, func(i, j int) bool { return hintRank(formats[i]) < hintRank(formats[j]) })
+
+	hintGroup := *group
+	hintGroup.Formats = formats
+
+	return &hintGroup, nil
+}
+
+var reservedCheckNames = map[string]decode.ReservedCheck{
+	"":       decode.ReservedCheckIgnore,
+	"ignore": decode.ReservedCheckIgnore,
+	"warn":   decode.ReservedCheckWarn,
+	"error":  decode.ReservedCheckError,
 }
 
 func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
@@ -231,14 +426,32 @@ func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
 	if err != nil {
 		return err
 	}
+	if probeFilename, ok := opts.Remain["filename"].(string); ok || opts.MIMEType != "" {
+		decodeGroup, err = i.probeHintGroup(decodeGroup, probeFilename, opts.MIMEType, opts.ProbeExt)
+		if err != nil {
+			return err
+		}
+	}
+	reservedCheck, ok := reservedCheckNames[opts.ReservedCheck]
+	if !ok {
+		return fmt.Errorf("reserved_check: should be ignore, warn or error: %q", opts.ReservedCheck)
+	}
+
+	var eventFn func(e decode.Event)
+	if opts.DecodeEvents {
+		eventFn = decodeEventsFn(i.OS.Stderr())
+	}
 
 	dv, formatOut, err := decode.Decode(i.EvalInstance.Ctx, bv.br, decodeGroup,
 		decode.Options{
-			IsRoot:      true,
-			FillGaps:    true,
-			Force:       opts.Force,
-			Range:       bv.r,
-			Description: filename,
+			IsRoot:        true,
+			FillGaps:      true,
+			Force:         opts.Force,
+			Range:         bv.r,
+			Description:   filename,
+			ReservedCheck: reservedCheck,
+			Parallel:      opts.Parallel,
+			EventFn:       eventFn,
 			ParseOptsFn: func(init any) any {
 				v, err := copystructure.Copy(init)
 				if err != nil {
@@ -286,6 +499,324 @@ func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
 	return makeDecodeValueOut(dv, decodeValueValue, formatOutMap)
 }
 
+// _validate returns results of all constraints checked while decoding
+func (i *Interp) _validate(c DecodeValue) any {
+	vs := []any{}
+	_ = c.DecodeValue().WalkPreOrder(func(v *decode.Value, _ *decode.Value, _ int, _ int) error {
+		for _, c := range v.Constraints {
+			vs = append(vs, map[string]any{
+				"path":        valuePath(v),
+				"description": c.Description,
+				"valid":       c.Valid,
+			})
+		}
+		return nil
+	})
+	return vs
+}
+
+// probeParseOptsFn sets is_probe for formats that takes probe arguments so
+// they are as strict as when probing input
+func probeParseOptsFn(init any) any {
+	v, err := copystructure.Copy(init)
+	if err != nil {
+		return nil
+	}
+	if err := mapstruct.ToStruct(map[string]any{"is_probe": true}, &v); err != nil {
+		return nil
+	}
+	if reflect.DeepEqual(init, v) {
+		return nil
+	}
+	return v
+}
+
+// _probeScores tries all formats in the probe group and scores how well each
+// decoded. Ordered by decode success, fewest failed constraints, most bytes
+// consumed and most fields.
+func (i *Interp) _probeScores(c any) any {
+	bv, err := toBinary(c)
+	if err != nil {
+		return err
+	}
+	probeGroup, err := i.Registry.Group("probe")
+	if err != nil {
+		return err
+	}
+
+	type probeScore struct {
+		format            string
+		err               error
+		bitsConsumed      int64
+		fields            int
+		failedConstraints int
+	}
+	var scores []probeScore
+
+	for _, f := range probeGroup.Formats {
+		dv, _, err := decode.Decode(i.EvalInstance.Ctx, bv.br, &decode.Group{Name: f.Name, Formats: []*decode.Format{f}, DefaultInArg: probeGroup.DefaultInArg},
+			decode.Options{
+				IsRoot:      true,
+				Range:       bv.r,
+				ParseOptsFn: probeParseOptsFn,
+			},
+		)
+		if ctxErr := i.EvalInstance.Ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		s := probeScore{format: f.Name, err: err}
+		if dv != nil {
+			s.bitsConsumed = dv.Range.Len
+			_ = dv.WalkPreOrder(func(v *decode.Value, _ *decode.Value, _ int, _ int) error {
+				if _, ok := v.V.(*decode.Compound); !ok {
+					s.fields++
+				}
+				for _, c := range v.Constraints {
+					if !c.Valid {
+						s.failedConstraints++
+					}
+				}
+				return nil
+			})
+		}
+		scores = append(scores, s)
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		a, b := scores[i], scores[j]
+		switch {
+		case (a.err == nil) != (b.err == nil):
+			return a.err == nil
+		case a.failedConstraints != b.failedConstraints:
+			return a.failedConstraints < b.failedConstraints
+		case a.bitsConsumed != b.bitsConsumed:
+			return a.bitsConsumed > b.bitsConsumed
+		default:
+			return a.fields > b.fields
+		}
+	})
+
+	vs := []any{}
+	for _, s := range scores {
+		var errV any
+		if s.err != nil {
+			errV = s.err.Error()
+		}
+		coverage := 0.0
+		if bv.r.Len > 0 {
+			coverage = float64(s.bitsConsumed) / float64(bv.r.Len)
+		}
+		vs = append(vs, map[string]any{
+			"format":             s.format,
+			"error":              errV,
+			"bytes_consumed":     s.bitsConsumed / 8,
+			"coverage":           coverage,
+			"fields":             s.fields,
+			"failed_constraints": s.failedConstraints,
+		})
+	}
+	return vs
+}
+
+type carveOpts struct {
+	Group    string
+	MinBytes int64
+}
+
+// _carve tries to decode raw fields in decode value c using a group and outputs
+// successful decodes with the path of the raw field they were found at
+func (i *Interp) _carve(c DecodeValue, opts carveOpts) any {
+	group, err := i.Registry.Group(opts.Group)
+	if err != nil {
+		return err
+	}
+
+	vs := []any{}
+	if err := c.DecodeValue().WalkPreOrder(func(v *decode.Value, _ *decode.Value, _ int, _ int) error {
+		s, ok := v.V.(scalar.Scalarable)
+		if !ok || s.ScalarFlags().IsSynthetic() {
+			return nil
+		}
+		if _, ok := s.ScalarActual().(bitio.ReaderAtSeeker); !ok {
+			return nil
+		}
+		if v.Range.Len < opts.MinBytes*8 {
+			return nil
+		}
+
+		dv, _, _ := decode.Decode(i.EvalInstance.Ctx, v.RootReader, group,
+			decode.Options{
+				IsRoot:      true,
+				FillGaps:    true,
+				Range:       v.Range,
+				ParseOptsFn: probeParseOptsFn,
+			},
+		)
+		if ctxErr := i.EvalInstance.Ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if dv == nil || dv.Err != nil {
+			return nil
+		}
+
+		vs = append(vs, map[string]any{
+			"path":   valuePath(v),
+			"format": dv.Format.Name,
+			"value":  makeDecodeValue(dv, decodeValueValue),
+		})
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return vs
+}
+
+// isShortReadError returns true if all formats failed because of reading
+// outside buffer, more input might make them succeed
+func isShortReadError(err error) bool {
+	var formatsErr decode.FormatsError
+	if !errors.As(err, &formatsErr) || len(formatsErr.Errs) == 0 {
+		return false
+	}
+	for _, fe := range formatsErr.Errs {
+		var ioErr decode.IOError
+		if !errors.As(fe.Err, &ioErr) {
+			return false
+		}
+	}
+	return true
+}
+
+// _stream_decode reads from stdin, or file if input is a path, and outputs a
+// decode value for each frame decoded using format as soon as enough has been
+// read instead of reading until end of input first. Stops at end of input or if
+// a frame fails to decode for other reasons than running out of input.
+func (i *Interp) _streamDecode(c any, format string) gojq.Iter {
+	group, err := i.Registry.Group(format)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	var f fs.File
+	switch c.(type) {
+	case nil:
+		f = i.OS.Stdin()
+	default:
+		path, err := toString(c)
+		if err != nil {
+			return gojq.NewIter(err)
+		}
+		f, err = i.OS.FS().Open(path)
+		if err != nil {
+			return gojq.NewIter(err)
+		}
+	}
+	r := ctxreadseeker.New(i.EvalInstance.Ctx, &iox.ReadErrSeeker{Reader: f})
+
+	const readSize = 64 * 1024
+	var buf []byte
+	eof := false
+	done := false
+
+	return iterFn(func() (any, bool) {
+		for !done {
+			if len(buf) > 0 {
+				dv, _, err := decode.Decode(i.EvalInstance.Ctx, bitio.NewBitReader(buf, -1), group,
+					decode.Options{IsRoot: true},
+				)
+				if ctxErr := i.EvalInstance.Ctx.Err(); ctxErr != nil {
+					done = true
+					return ctxErr, true
+				}
+				if dv != nil && dv.Err == nil && dv.Range.Len > 0 {
+					n := int((dv.Range.Len + 7) / 8)
+					buf = buf[n:]
+					return makeDecodeValue(dv, decodeValueValue), true
+				}
+				if eof || !isShortReadError(err) {
+					done = true
+					return fmt.Errorf("%s: failed to decode frame with %d bytes left: %w", format, len(buf), err), true
+				}
+			} else if eof {
+				done = true
+				break
+			}
+
+			rBuf := make([]byte, readSize)
+			n, err := r.Read(rBuf)
+			buf = append(buf[:len(buf):len(buf)], rBuf[:n]...)
+			if errors.Is(err, io.EOF) {
+				eof = true
+				f.Close()
+			} else if err != nil {
+				done = true
+				f.Close()
+				return err, true
+			}
+		}
+		return nil, false
+	})
+}
+
+// _patch outputs the buffer of decode value c with its bit range replaced by v.
+// v is a binary with same bit length or a non-negative integer written as big-endian.
+// Checksums covering the range are not recomputed as decoders don't describe what a checksum covers.
+func (i *Interp) _patch(c DecodeValue, v any) any {
+	dv := c.DecodeValue()
+	if s, ok := dv.V.(scalar.Scalarable); ok && s.ScalarFlags().IsSynthetic() {
+		return fmt.Errorf("patch: cannot patch synthetic value")
+	}
+	r := dv.Range
+
+	var vBR bitio.ReaderAtSeeker
+	switch v.(type) {
+	case int, float64, *big.Int:
+		var err error
+		vBR, err = uintBitReader(v, r.Len, false)
+		if err != nil {
+			return fmt.Errorf("patch: %w", err)
+		}
+	default:
+		var err error
+		vBR, err = ToBitReader(v)
+		if err != nil {
+			return err
+		}
+		vLen, err := bitiox.Len(vBR)
+		if err != nil {
+			return err
+		}
+		if vLen != r.Len {
+			return fmt.Errorf("patch: binary length %d bits does not match %d bits", vLen, r.Len)
+		}
+	}
+
+	rootLen, err := bitiox.Len(dv.RootReader)
+	if err != nil {
+		return err
+	}
+	beforeBR, err := bitiox.Range(dv.RootReader, 0, r.Start)
+	if err != nil {
+		return err
+	}
+	afterBR, err := bitiox.Range(dv.RootReader, r.Stop(), rootLen-r.Stop())
+	if err != nil {
+		return err
+	}
+	mr, err := bitio.NewMultiReader(beforeBR, vBR, afterBR)
+	if err != nil {
+		return err
+	}
+
+	bb, err := NewBinaryFromBitReader(mr, 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
+
 func valueOrFallbackKey(name string, baseKey func(name string) any, valueHas func(key any) any, valueKey func(name string) any) any {
 	v := valueHas(name)
 	if b, ok := v.(bool); ok && b {
@@ -474,6 +1005,8 @@ func (dvb decodeValueBase) ExtKeys() []string {
 		"_start",
 		"_stop",
 		"_sym",
+		"_synthetic",
+		"_unit",
 	}
 }
 
@@ -502,7 +1035,9 @@ func (dvb decodeValueBase) JQValueHas(key any) any {
 		"_root",
 		"_start",
 		"_stop",
-		"_sym":
+		"_sym",
+		"_synthetic",
+		"_unit":
 		return true
 	}
 
@@ -567,6 +1102,24 @@ func (dvb decodeValueBase) JQValueKey(name string) any {
 		default:
 			return false
 		}
+	case "_synthetic":
+		switch vv := dv.V.(type) {
+		case scalar.Scalarable:
+			return vv.ScalarFlags().IsSynthetic()
+		default:
+			return false
+		}
+	case "_unit":
+		switch vv := dv.V.(type) {
+		case scalar.Scalarable:
+			unit := vv.ScalarUnit()
+			if unit == "" {
+				return nil
+			}
+			return unit
+		default:
+			return nil
+		}
 	case "_len":
 		return big.NewInt(dv.Range.Len)
 	case "_name":
@@ -39,6 +39,8 @@ func decoratorFromOptions(opts Options) Decorator {
 
 		d.DumpHeader = ansi.FromString(colors["dumpheader"])
 		d.DumpAddr = ansi.FromString(colors["dumpaddr"])
+		d.DumpContext = ansi.FromString(colors["dumpcontext"])
+		d.DumpHighlight = ansi.FromString(colors["dumphighlight"])
 
 		d.Error = ansi.FromString(colors["error"])
 
@@ -104,8 +106,10 @@ type Decorator struct {
 	Index ansi.Code
 	Value ansi.Code
 
-	DumpHeader ansi.Code
-	DumpAddr   ansi.Code
+	DumpHeader    ansi.Code
+	DumpAddr      ansi.Code
+	DumpContext   ansi.Code
+	DumpHighlight ansi.Code
 
 	Error ansi.Code
 
@@ -15,6 +15,7 @@ import (
 	"github.com/wader/fq/internal/mathx"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
 	"github.com/wader/fq/pkg/scalar"
 )
 
@@ -116,6 +117,21 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 	innerRange := v.InnerRange()
 	willDisplayData := innerRange.Len > 0 && (!isCompound || (opts.Depth != 0 && opts.Depth == depth))
 
+	// a single field is shown with the rest of its lines dimmed. Synthetic fields
+	// assembled from other fields show the lines of all sources.
+	highlightRanges := []ranges.Range{innerRange}
+	if len(v.Sources) > 0 {
+		highlightRanges = v.Sources
+	}
+	highlight := depth == 0 && !isCompound && (opts.Color || len(v.Sources) > 0)
+	if highlight && len(v.Sources) > 0 {
+		innerRange = v.Sources[0]
+		for _, r := range v.Sources[1:] {
+			innerRange = ranges.MinMax(innerRange, r)
+		}
+		willDisplayData = innerRange.Len > 0
+	}
+
 	// show address bar on root, nested root and format change
 	if depth == 0 || v.IsRoot || v.Format != nil {
 		cfmt(colHex, "%s", deco.DumpHeader.F(ctx.hexHeader))
@@ -147,13 +163,13 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 	case scalar.Scalarable:
 		cprint(colField, ":")
 		actual := vv.ScalarActual()
-		sym := vv.ScalarSym()
-		df := vv.ScalarDisplayFormat()
-		if sym == nil {
-			cfmt(colField, " %s", deco.ValueColor(actual).F(previewValue(actual, df, opts)))
-		} else {
-			cfmt(colField, " %s", deco.ValueColor(sym).F(previewValue(sym, scalar.NumberDecimal, opts)))
-			cfmt(colField, " (%s)", deco.ValueColor(actual).F(previewValue(actual, df, opts)))
+		sp := newScalarPreview(vv, opts)
+		cfmt(colField, " %s", deco.ValueColor(sp.valueV).F(sp.value))
+		if sp.unit != "" {
+			cfmt(colField, " %s", deco.Value.F(sp.unit))
+		}
+		if sp.actual != "" {
+			cfmt(colField, " (%s)", deco.ValueColor(actual).F(sp.actual))
 		}
 		desc = vv.ScalarDescription()
 		isSynthetic = vv.ScalarFlags().IsSynthetic()
@@ -182,9 +198,13 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 	}
 	valueErr := v.Err
 
-	if opts.Verbose && !isSynthetic {
-		cfmt(colField, " %s (%s)",
-			mathx.BitRange(innerRange).StringByteBits(opts.Addrbase), mathx.Bits(innerRange.Len).StringByteBits(opts.Sizebase))
+	if opts.Verbose {
+		if isSynthetic {
+			cfmt(colField, " %s", deco.Value.F("synthetic"))
+		} else {
+			cfmt(colField, " %s (%s)",
+				mathx.BitRange(innerRange).StringByteBits(opts.Addrbase), mathx.Bits(innerRange.Len).StringByteBits(opts.Sizebase))
+		}
 	}
 
 	cprint(colField, "\n")
@@ -270,21 +290,56 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 		cfmt(colAddr, "%s%s\n",
 			rootIndent, deco.DumpAddr.F(mathx.PadFormatInt(startLineByte, opts.Addrbase, true, addrWidth)))
 
-		vBR, err := bitiox.Range(rootV.RootReader, startByte*8, displaySizeBits)
+		readStartByte := startByte
+		readLastByte := lastDisplayByte
+		readSizeBits := displaySizeBits
+		lineByteOffset := int(startLineByteOffset)
+		if highlight {
+			// read whole lines
+			readStartByte = startLineByte
+			readLastByte = min((lastDisplayLine+1)*int64(opts.LineBytes)-1, bufferLastByte)
+			readSizeBits = min((readLastByte-readStartByte+1)*8, rootBitLen-readStartByte*8)
+			lineByteOffset = 0
+		}
+
+		vBR, err := bitiox.Range(rootV.RootReader, readStartByte*8, readSizeBits)
 		if err != nil {
 			return err
 		}
 
 		addrLines := lastDisplayLine - startLine + 1
-		hexpairFn := func(b byte) string { return deco.ByteColor(b).Wrap(hexpairwriter.Pair(b)) }
+		pairFn := hexpairwriter.Pair
+		if opts.HexUpper {
+			pairFn = func(b byte) string { return strings.ToUpper(hexpairwriter.Pair(b)) }
+		}
+		hexpairFn := func(b byte) string { return deco.ByteColor(b).Wrap(pairFn(b)) }
 		asciiFn := func(b byte) string { return deco.ByteColor(b).Wrap(asciiwriter.SafeASCII(b)) }
+		if highlight {
+			rangeHexpairFn, rangeASCIIFn := hexpairFn, asciiFn
+			hexpairFn = dumpHighlightFn(readStartByte, highlightRanges, func(b byte) string {
+				return deco.DumpHighlight.Wrap(rangeHexpairFn(b))
+			}, func(b byte) string {
+				if opts.Color {
+					return deco.DumpContext.Wrap(pairFn(b))
+				}
+				return "  "
+			})
+			asciiFn = dumpHighlightFn(readStartByte, highlightRanges, func(b byte) string {
+				return deco.DumpHighlight.Wrap(rangeASCIIFn(b))
+			}, func(b byte) string {
+				if opts.Color {
+					return deco.DumpContext.Wrap(asciiwriter.SafeASCII(b))
+				}
+				return " "
+			})
+		}
 
 		hexBR, err := bitio.CloneReadSeeker(vBR)
 		if err != nil {
 			return err
 		}
 		if _, err := bitiox.CopyBitsBuffer(
-			hexpairwriter.New(cw.Columns[colHex], opts.LineBytes, int(startLineByteOffset), hexpairFn),
+			hexpairwriter.NewGroup(cw.Columns[colHex], opts.LineBytes, opts.HexGroup, lineByteOffset, hexpairFn),
 			hexBR,
 			buf); err != nil {
 			return err
@@ -295,7 +350,7 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 			return err
 		}
 		if _, err := bitiox.CopyBitsBuffer(
-			asciiwriter.New(cw.Columns[colASCII], opts.LineBytes, int(startLineByteOffset), asciiFn),
+			asciiwriter.New(cw.Columns[colASCII], opts.LineBytes, lineByteOffset, asciiFn),
 			asciiBR,
 			buf); err != nil {
 			return err
@@ -307,7 +362,7 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 		}
 		// TODO: correct? should rethink columnwriter api maybe?
 		lastLineStopByte := startLineByte + addrLines*int64(opts.LineBytes) - 1
-		if lastDisplayByte == bufferLastByte && lastDisplayByte != lastLineStopByte {
+		if readLastByte == bufferLastByte && readLastByte != lastLineStopByte {
 			// extra "|" as end markers
 			cfmt(colHex, "%s\n", deco.Column)
 			cfmt(colASCII, "%s\n", deco.Column)
@@ -337,6 +392,22 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 	return nil
 }
 
+// dumpHighlightFn returns byte function that uses fn for bytes overlapping rs and
+// contextFn for other bytes. Assumes to be called for each byte starting at startByte.
+func dumpHighlightFn(startByte int64, rs []ranges.Range, fn func(b byte) string, contextFn func(b byte) string) func(b byte) string {
+	i := startByte
+	return func(b byte) string {
+		bitStart := i * 8
+		i++
+		for _, r := range rs {
+			if bitStart < r.Stop() && bitStart+8 > r.Start {
+				return fn(b)
+			}
+		}
+		return contextFn(b)
+	}
+}
+
 func dump(v *decode.Value, w io.Writer, opts *Options) error {
 	maxAddrIndentWidth := 0
 	makeWalkFn := func(fn decode.WalkFn) decode.WalkFn {
@@ -365,8 +436,14 @@ func dump(v *decode.Value, w io.Writer, opts *Options) error {
 	}
 
 	addrColumnWidth := maxAddrIndentWidth
-	hexColumnWidth := opts.LineBytes*3 - 1
+	// two characters per byte and a space between each group
+	hexColumnWidth := opts.LineBytes*2 + (opts.LineBytes+opts.HexGroup-1)/opts.HexGroup - 1
 	asciiColumnWidth := opts.LineBytes
+	asciiBar := columnwriter.BarColumn(opts.Decorator.Column)
+	if opts.SkipASCII {
+		asciiColumnWidth = 0
+		asciiBar = columnwriter.BarColumn("")
+	}
 	treeColumnWidth := -1
 	// TODO: set with and truncate/wrap properly
 	// if opts.Width != 0 {
@@ -380,7 +457,7 @@ func dump(v *decode.Value, w io.Writer, opts *Options) error {
 		&columnwriter.MultiLineColumn{Width: hexColumnWidth, LenFn: displayLenFn, SliceFn: displayTruncateFn},
 		columnwriter.BarColumn(opts.Decorator.Column),
 		&columnwriter.MultiLineColumn{Width: asciiColumnWidth, LenFn: displayLenFn, SliceFn: displayTruncateFn},
-		columnwriter.BarColumn(opts.Decorator.Column),
+		asciiBar,
 		&columnwriter.MultiLineColumn{Width: treeColumnWidth, Wrap: false, LenFn: displayLenFn, SliceFn: displayTruncateFn},
 	)
 
@@ -390,8 +467,11 @@ func dump(v *decode.Value, w io.Writer, opts *Options) error {
 	var asciiHeader string
 	for i := 0; i < opts.LineBytes; i++ {
 		s := mathx.PadFormatInt(int64(i), opts.Addrbase, false, 2)
+		if opts.HexUpper {
+			s = strings.ToUpper(s)
+		}
 		hexHeader += s
-		if i < opts.LineBytes-1 {
+		if i < opts.LineBytes-1 && (i+1)%opts.HexGroup == 0 {
 			hexHeader += " "
 		}
 		asciiHeader += s[len(s)-1:]
@@ -0,0 +1,187 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/internal/ansi"
+	"github.com/wader/fq/internal/bitiox"
+	"github.com/wader/fq/internal/mathx"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// dump variant for sub-byte layouts, each leaf value is shown as rows of bits
+// where bits owned by the value are shown as 0/1 and other bits in the same
+// bytes as "."
+
+var bitDumpColors = []ansi.Code{
+	ansi.Cyan,
+	ansi.Green,
+	ansi.Yellow,
+	ansi.Magenta,
+	ansi.Blue,
+	ansi.Red,
+}
+
+func bitDump(v *decode.Value, w io.Writer, opts *Options) error {
+	deco := opts.Decorator
+	lineBytes := int64(opts.LineBytes)
+	rootBitLen, err := bitiox.Len(v.RootReader)
+	if err != nil {
+		return err
+	}
+	addrWidth := len(mathx.PadFormatInt((rootBitLen/8/lineBytes)*lineBytes, opts.Addrbase, true, 0))
+	bitsWidth := int(lineBytes)*9 - 1
+
+	bw := bufio.NewWriter(w)
+	line := func(addr string, bits string, field string) {
+		fmt.Fprintf(bw, "%s%s%s%s%s\n", addr, deco.Column, bits, deco.Column, field)
+	}
+
+	var ruler []string
+	for i := int64(0); i < lineBytes; i++ {
+		ruler = append(ruler, "01234567")
+	}
+	line(
+		strings.Repeat(" ", addrWidth),
+		deco.DumpHeader.Wrap(strings.Join(ruler, " ")),
+		"",
+	)
+
+	leafIndex := 0
+	buf := make([]byte, lineBytes)
+	if err := v.WalkPreOrder(func(wv *decode.Value, _ *decode.Value, depth int, _ int) error {
+		if opts.Depth != 0 && depth > opts.Depth {
+			return decode.ErrWalkSkipChildren
+		}
+		if opts.ArrayTruncate != 0 && wv.Parent != nil && wv.Index >= opts.ArrayTruncate {
+			if dc, ok := wv.Parent.V.(*decode.Compound); ok && dc.IsArray {
+				return decode.ErrWalkSkipChildren
+			}
+		}
+
+		name := deco.ObjectKey.Wrap(wv.Name)
+		if wv.Parent != nil {
+			if dc, ok := wv.Parent.V.(*decode.Compound); ok && dc.IsArray {
+				name = deco.Index.Wrap("[") + deco.Number.Wrap(strconv.Itoa(wv.Index)) + deco.Index.Wrap("]")
+			}
+		}
+		if wv == v {
+			name = valuePathExprDecorated(wv, deco)
+		}
+		field := indentStr(depth*treeIndentWidth) + name
+
+		r := wv.InnerRange()
+		showBits := r.Len > 0 && wv.RootReader == v.RootReader
+
+		switch vv := wv.V.(type) {
+		case *decode.Compound:
+			if vv.IsArray {
+				field += deco.Index.Wrap("[") + deco.Number.Wrap("0") + ":" + deco.Number.Wrap(strconv.Itoa(len(vv.Children))) + deco.Index.Wrap("]")
+			} else {
+				field += deco.Object.Wrap("{}")
+			}
+			field += ":"
+			if vv.Description != "" {
+				field += " (" + vv.Description + ")"
+			}
+			// show bits only for compounds at max depth
+			showBits = showBits && opts.Depth != 0 && depth == opts.Depth
+		case scalar.Scalarable:
+			field += ": " + deco.ValueColor(vv.ScalarActual()).Wrap(previewScalar(vv, opts))
+			if d := vv.ScalarDescription(); d != "" {
+				field += " (" + d + ")"
+			}
+			showBits = showBits && !vv.ScalarFlags().IsSynthetic()
+		}
+
+		if !showBits {
+			line(strings.Repeat(" ", addrWidth), strings.Repeat(" ", bitsWidth), field)
+			return nil
+		}
+
+		color := ansi.None
+		if opts.Color {
+			color = bitDumpColors[leafIndex%len(bitDumpColors)]
+		}
+		leafIndex++
+
+		firstLine := r.Start / 8 / lineBytes
+		lastLine := (r.Stop() - 1) / 8 / lineBytes
+		stopLine := lastLine + 1
+		if opts.DisplayBytes > 0 {
+			stopLine = min(stopLine, firstLine+(int64(opts.DisplayBytes)+lineBytes-1)/lineBytes)
+		}
+
+		for l := firstLine; l < stopLine; l++ {
+			lineStart := l * lineBytes * 8
+			lineStop := min(lineStart+lineBytes*8, rootBitLen)
+			br, err := bitiox.Range(v.RootReader, lineStart, lineStop-lineStart)
+			if err != nil {
+				return err
+			}
+			if _, err := bitio.ReadFull(br, buf, lineStop-lineStart); err != nil {
+				return err
+			}
+
+			// collect runs of same color to not wrap each bit
+			sb := &strings.Builder{}
+			run := &strings.Builder{}
+			// 0 outside, 1 value bit, 2 other bit in same byte
+			runKind := 0
+			kindColors := [3]ansi.Code{ansi.None, color, deco.DumpContext}
+			flush := func() {
+				if run.Len() == 0 {
+					return
+				}
+				sb.WriteString(kindColors[runKind].Wrap(run.String()))
+				run.Reset()
+			}
+			for i := int64(0); i < lineBytes*8; i++ {
+				if i > 0 && i%8 == 0 {
+					flush()
+					sb.WriteByte(' ')
+				}
+				bit := lineStart + i
+				byteStart := bit &^ 7
+				c, kind := " ", 0
+				switch {
+				case bit >= r.Start && bit < r.Stop():
+					c, kind = "0", 1
+					if buf[i/8]&(0x80>>(i%8)) != 0 {
+						c = "1"
+					}
+				case byteStart+8 > r.Start && byteStart < r.Stop() && bit < lineStop:
+					c, kind = ".", 2
+				}
+				if kind != runKind {
+					flush()
+					runKind = kind
+				}
+				run.WriteString(c)
+			}
+			flush()
+
+			addr := mathx.PadFormatInt(l*lineBytes, opts.Addrbase, true, addrWidth)
+			if l == firstLine {
+				line(deco.DumpAddr.Wrap(addr), sb.String(), field)
+			} else {
+				line(deco.DumpAddr.Wrap(addr), sb.String(), "")
+			}
+		}
+		if stopLine <= lastLine {
+			line(strings.Repeat(" ", addrWidth), fmt.Sprintf("%-*s", bitsWidth, "..."), "")
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,242 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/wader/fq/internal/asciiwriter"
+	"github.com/wader/fq/internal/bitiox"
+	"github.com/wader/fq/internal/hexpairwriter"
+	"github.com/wader/fq/internal/mathx"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// standalone HTML version of dump with a collapsible tree and a hexdump where
+// hovering a field highlights its bytes and hovering a byte highlights its field
+
+type htmlDumpNode struct {
+	Name        string
+	Value       string
+	Description string
+	Format      string
+	Error       string
+	Range       string
+	// byte range in root buffer, -1 if value is in another buffer
+	Start    int64
+	Stop     int64
+	Children []htmlDumpNode
+	Compound bool
+}
+
+type htmlDumpByte struct {
+	Index int64
+	Hex   string
+	ASCII string
+}
+
+type htmlDumpLine struct {
+	Addr  string
+	Bytes []htmlDumpByte
+}
+
+type htmlDump struct {
+	Title     string
+	Root      htmlDumpNode
+	Lines     []htmlDumpLine
+	Truncated bool
+}
+
+var htmlDumpTemplate = template.Must(template.New("dump").Parse(`{{define "label"}}<span class="n">{{.Name}}</span>: {{if .Value}}<span class="v">{{.Value}}</span> {{end}}{{if .Description}}<span class="d">({{.Description}})</span> {{end}}{{if .Format}}<span class="d">({{.Format}})</span> {{end}}<span class="r">{{.Range}}</span>{{if .Error}} <span class="e">{{.Error}}</span>{{end}}{{end -}}
+{{define "node"}}{{if .Compound}}<details open><summary{{if ge .Start 0}} data-s="{{.Start}}" data-e="{{.Stop}}"{{end}}>{{template "label" .}}</summary>
+{{range .Children}}{{template "node" .}}{{end}}</details>
+{{else}}<div class="f"{{if ge .Start 0}} data-s="{{.Start}}" data-e="{{.Stop}}"{{end}}>{{template "label" .}}</div>
+{{end}}{{end -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: monospace; margin: 0; display: flex; height: 100vh; }
+div#tree, div#hex { overflow: auto; padding: 8px; }
+div#tree { flex: 1; border-right: 1px solid #ccc; }
+div#hex { white-space: pre; }
+details > :not(summary) { margin-left: 2ch; }
+summary, .f { cursor: default; }
+.n { color: #1b5e9f; }
+.v { color: #2e7d32; }
+.d, .r { color: #777; }
+.e { color: #c62828; }
+.a { color: #777; }
+.hl { background: #ffe082; }
+</style>
+</head>
+<body>
+<div id="tree">
+{{template "node" .Root}}
+</div>
+<div id="hex">{{range .Lines}}<span class="a">{{.Addr}}</span> {{range .Bytes}}<span{{if ge .Index 0}} id="h{{.Index}}"{{end}}>{{.Hex}}</span> {{end}} {{range .Bytes}}<span{{if ge .Index 0}} id="c{{.Index}}"{{end}}>{{.ASCII}}</span>{{end}}
+{{end}}{{if .Truncated}}...
+{{end}}</div>
+<script>
+let hls = [];
+function clear() {
+  hls.forEach(e => e.classList.remove("hl"));
+  hls = [];
+}
+function hl(el) {
+  clear();
+  el.classList.add("hl");
+  hls.push(el);
+  for (let i = +el.dataset.s; i < +el.dataset.e; i++) {
+    for (const id of ["h" + i, "c" + i]) {
+      const b = document.getElementById(id);
+      if (b) {
+        b.classList.add("hl");
+        hls.push(b);
+      }
+    }
+  }
+}
+const fields = [...document.querySelectorAll("[data-s]")];
+fields.forEach(el => {
+  el.addEventListener("mouseover", e => { e.stopPropagation(); hl(el); });
+  el.addEventListener("mouseout", clear);
+});
+const leafs = fields.filter(el => el.classList.contains("f"));
+document.querySelectorAll("#hex [id]").forEach(b => {
+  const i = +b.id.slice(1);
+  b.addEventListener("mouseover", () => {
+    const el = leafs.find(el => +el.dataset.s <= i && i < +el.dataset.e);
+    if (el) {
+      hl(el);
+      el.scrollIntoView({block: "nearest"});
+    }
+  });
+  b.addEventListener("mouseout", clear);
+});
+</script>
+</body>
+</html>
+`))
+
+func htmlDumpTree(v *decode.Value, rootV *decode.Value, opts *Options) htmlDumpNode {
+	name := v.Name
+	if v.Parent != nil {
+		if dc, ok := v.Parent.V.(*decode.Compound); ok && dc.IsArray {
+			name = fmt.Sprintf("[%d]", v.Index)
+		}
+	}
+	if v == rootV {
+		name = valuePathExprDecorated(v, PlainDecorator)
+	}
+
+	innerRange := v.InnerRange()
+	n := htmlDumpNode{
+		Name:  name,
+		Start: -1,
+		Stop:  -1,
+		Range: mathx.BitRange(innerRange).StringByteBits(opts.Addrbase),
+	}
+	if v.RootReader == rootV.RootReader {
+		n.Start = innerRange.Start / 8
+		n.Stop = (innerRange.Stop() + 7) / 8
+	}
+	if v.Format != nil {
+		n.Format = v.Format.Name
+	}
+	if v.Err != nil {
+		var formatErr decode.FormatError
+		if errors.As(v.Err, &formatErr) {
+			n.Error = formatErr.Format.Name + ": " + formatErr.Err.Error()
+		} else {
+			n.Error = v.Err.Error()
+		}
+	}
+
+	switch vv := v.V.(type) {
+	case *decode.Compound:
+		n.Compound = true
+		n.Description = vv.Description
+		if vv.IsArray {
+			n.Value = fmt.Sprintf("[%d]", len(vv.Children))
+		}
+		for _, c := range vv.Children {
+			n.Children = append(n.Children, htmlDumpTree(c, rootV, opts))
+		}
+	case scalar.Scalarable:
+		n.Value = previewScalar(vv, opts)
+		n.Description = vv.ScalarDescription()
+		if vv.ScalarFlags().IsSynthetic() {
+			n.Range = "synthetic"
+			n.Start = -1
+			n.Stop = -1
+		}
+	}
+
+	return n
+}
+
+func dumpHTML(v *decode.Value, w io.Writer, opts *Options) error {
+	innerRange := v.InnerRange()
+	startByte := innerRange.Start / 8
+	stopByte := (innerRange.Stop() + 7) / 8
+	truncated := false
+	if opts.DisplayBytes > 0 && stopByte-startByte > int64(opts.DisplayBytes) {
+		stopByte = startByte + int64(opts.DisplayBytes)
+		truncated = true
+	}
+
+	br, err := bitiox.Range(v.RootReader, startByte*8, (stopByte-startByte)*8)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, stopByte-startByte)
+	if _, err := bitio.ReadFull(br, buf, int64(len(buf))*8); err != nil {
+		return err
+	}
+
+	lineBytes := int64(opts.LineBytes)
+	rootBitLen, err := bitiox.Len(v.RootReader)
+	if err != nil {
+		return err
+	}
+	addrWidth := len(mathx.PadFormatInt((rootBitLen/8/lineBytes)*lineBytes, opts.Addrbase, true, 0))
+
+	var lines []htmlDumpLine
+	for i, b := range buf {
+		index := startByte + int64(i)
+		if i == 0 || index%lineBytes == 0 {
+			lines = append(lines, htmlDumpLine{
+				Addr: mathx.PadFormatInt((index/lineBytes)*lineBytes, opts.Addrbase, true, addrWidth),
+			})
+			// pad first line so columns line up
+			for j := (index / lineBytes) * lineBytes; j < index; j++ {
+				lines[0].Bytes = append(lines[0].Bytes, htmlDumpByte{Index: -1, Hex: "  ", ASCII: " "})
+			}
+		}
+		l := &lines[len(lines)-1]
+		l.Bytes = append(l.Bytes, htmlDumpByte{
+			Index: index,
+			Hex:   hexpairwriter.Pair(b),
+			ASCII: asciiwriter.SafeASCII(b),
+		})
+	}
+
+	root := htmlDumpTree(v, v, opts)
+	title := root.Name
+	if v.Format != nil {
+		title += " (" + v.Format.Name + ")"
+	}
+
+	return htmlDumpTemplate.Execute(w, htmlDump{
+		Title:     title,
+		Root:      root,
+		Lines:     lines,
+		Truncated: truncated,
+	})
+}
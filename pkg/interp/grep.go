@@ -0,0 +1,170 @@
+package interp
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+	"github.com/wader/gojq"
+)
+
+// native fast path for common grep predicates, walks the decode tree in Go
+// instead of evaluating a jq filter per value
+
+func init() {
+	RegisterIter1("_grep_decode_value", (*Interp)._grepDecodeValue)
+}
+
+type grepPredicate struct {
+	nameRe   *regexp.Regexp
+	nameMemo map[string]bool
+	sym      any
+	hasSym   bool
+	min      any
+	max      any
+	hasMin   bool
+	hasMax   bool
+}
+
+func newGrepPredicate(spec map[string]any) (*grepPredicate, error) {
+	p := &grepPredicate{}
+	if v, ok := spec["name"]; ok {
+		name, err := toString(v)
+		if err != nil {
+			return nil, fmt.Errorf("name: %w", err)
+		}
+		var flags string
+		if v, ok := spec["flags"]; ok && v != nil {
+			if flags, err = toString(v); err != nil {
+				return nil, fmt.Errorf("flags: %w", err)
+			}
+		}
+		var reFlags string
+		for _, f := range flags {
+			switch f {
+			case 'i', 's':
+				reFlags += string(f)
+			case 'g', 'n':
+				// no effect when only testing for match
+			default:
+				return nil, fmt.Errorf("unsupported flag %q", f)
+			}
+		}
+		if reFlags != "" {
+			name = "(?" + reFlags + ")" + name
+		}
+		if p.nameRe, err = regexp.Compile(name); err != nil {
+			return nil, err
+		}
+		p.nameMemo = map[string]bool{}
+	}
+	p.sym, p.hasSym = spec["sym"]
+	p.min, p.hasMin = spec["min"]
+	p.max, p.hasMax = spec["max"]
+
+	return p, nil
+}
+
+// scalar value as a comparable jq value, ok is false for raw bits etc
+func grepJQValue(v any) (any, bool) {
+	switch v := v.(type) {
+	case nil, bool, int, float64, string, *big.Int:
+		return v, true
+	case int64:
+		return big.NewInt(v), true
+	case uint64:
+		return new(big.Int).SetUint64(v), true
+	default:
+		return nil, false
+	}
+}
+
+func (p *grepPredicate) match(dv *decode.Value) bool {
+	if p.nameRe != nil {
+		m, ok := p.nameMemo[dv.Name]
+		if !ok {
+			m = p.nameRe.MatchString(dv.Name)
+			p.nameMemo[dv.Name] = m
+		}
+		if !m {
+			return false
+		}
+	}
+
+	if !p.hasSym && !p.hasMin && !p.hasMax {
+		return true
+	}
+	s, ok := dv.V.(scalar.Scalarable)
+	if !ok {
+		return false
+	}
+
+	if p.hasSym {
+		sym := s.ScalarSym()
+		if sym == nil {
+			return false
+		}
+		v, ok := grepJQValue(sym)
+		if !ok || gojq.Compare(v, p.sym) != 0 {
+			return false
+		}
+	}
+
+	if p.hasMin || p.hasMax {
+		v, ok := grepJQValue(s.ScalarActual())
+		if !ok {
+			return false
+		}
+		switch v.(type) {
+		case int, float64, *big.Int:
+		default:
+			return false
+		}
+		if p.hasMin && gojq.Compare(v, p.min) < 0 {
+			return false
+		}
+		if p.hasMax && gojq.Compare(v, p.max) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// _grep_decode_value({name: "re", flags: "i", sym: v, min: n, max: n})
+// outputs input and all values below it matching all given predicates in
+// the same order as ..
+func (i *Interp) _grepDecodeValue(c DecodeValue, spec map[string]any) gojq.Iter {
+	p, err := newGrepPredicate(spec)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	stack := []*decode.Value{c.DecodeValue()}
+	n := 0
+	return iterFn(func() (any, bool) {
+		for len(stack) > 0 {
+			n++
+			if n%1024 == 0 {
+				if err := i.EvalInstance.Ctx.Err(); err != nil {
+					stack = nil
+					return err, true
+				}
+			}
+
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if c, ok := v.V.(*decode.Compound); ok {
+				for j := len(c.Children) - 1; j >= 0; j-- {
+					stack = append(stack, c.Children[j])
+				}
+			}
+			if p.match(v) {
+				return makeDecodeValue(v, decodeValueValue), true
+			}
+		}
+		return nil, false
+	})
+}
@@ -41,12 +41,14 @@ import (
 //go:embed format_decode.jq
 //go:embed format_func.jq
 //go:embed grep.jq
+//go:embed archive.jq
 //go:embed args.jq
 //go:embed eval.jq
 //go:embed query.jq
 //go:embed repl.jq
 //go:embed help.jq
 //go:embed funcs.jq
+//go:embed timing.jq
 //go:embed ansi.jq
 //go:embed init.jq
 var builtinFS embed.FS
@@ -68,9 +70,14 @@ func init() {
 	RegisterFunc1("_global_state", func(i *Interp, _ any, v any) any { *i.state = v; return v })
 
 	RegisterFunc0("history", (*Interp).history)
+	RegisterFunc1("_watch_wait", (*Interp)._watchWait)
 	RegisterIter1("_display", (*Interp)._display)
 	RegisterFunc0("_can_display", (*Interp)._canDisplay)
 	RegisterIter1("_hexdump", (*Interp)._hexdump)
+	RegisterIter1("_dump_html", (*Interp)._dumpHTML)
+	RegisterIter1("_byte_map_svg", (*Interp)._byteMapSVG)
+	RegisterIter1("_bitdump", (*Interp)._bitDump)
+	RegisterIter1("_browse", (*Interp)._browse)
 	RegisterIter1("_print_color_json", (*Interp)._printColorJSON)
 
 	RegisterFunc0("_is_completing", (*Interp)._isCompleting)
@@ -139,8 +146,9 @@ type Platform struct {
 type CompleteFn func(line string, pos int) (newLine []string, shared int)
 
 type ReadlineOpts struct {
-	Prompt     string
-	CompleteFn CompleteFn
+	Prompt      string
+	CompleteFn  CompleteFn
+	HistoryFile string // empty for default path
 }
 
 type OS interface {
@@ -443,9 +451,10 @@ type completionResult struct {
 }
 
 type readlineOpts struct {
-	Prompt   string
-	Complete string
-	Timeout  float64
+	Prompt      string
+	Complete    string
+	Timeout     float64
+	HistoryFile string
 }
 
 func (i *Interp) _readline(c any, opts readlineOpts) gojq.Iter {
@@ -454,7 +463,8 @@ func (i *Interp) _readline(c any, opts readlineOpts) gojq.Iter {
 	}
 
 	expr, err := i.OS.Readline(ReadlineOpts{
-		Prompt: opts.Prompt,
+		Prompt:      opts.Prompt,
+		HistoryFile: opts.HistoryFile,
 		CompleteFn: func(line string, pos int) (newLine []string, shared int) {
 			completeCtx := i.EvalInstance.Ctx
 			if opts.Timeout > 0 {
@@ -642,6 +652,60 @@ func (i *Interp) history(c any) any {
 	return vs
 }
 
+const watchPollInterval = 250 * time.Millisecond
+
+// blocks until modification time or size of any of the files changes
+func (i *Interp) _watchWait(c any, v []any) any {
+	if i.EvalInstance.IsCompleting {
+		return nil
+	}
+
+	type fileState struct {
+		modTime time.Time
+		size    int64
+	}
+	stat := func() ([]fileState, error) {
+		var fss []fileState
+		for _, fv := range v {
+			path, err := toString(fv)
+			if err != nil {
+				return nil, fmt.Errorf("watch only supports file inputs: %w", err)
+			}
+			fi, err := fs.Stat(i.OS.FS(), path)
+			if err != nil {
+				// file might be replaced, treat as change when it reappears
+				fss = append(fss, fileState{})
+				continue
+			}
+			fss = append(fss, fileState{modTime: fi.ModTime(), size: fi.Size()})
+		}
+		return fss, nil
+	}
+
+	start, err := stat()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-i.EvalInstance.Ctx.Done():
+			return i.EvalInstance.Ctx.Err()
+		case <-ticker.C:
+		}
+		now, err := stat()
+		if err != nil {
+			return err
+		}
+		for j := range now {
+			if now[j] != start[j] && now[j] != (fileState{}) {
+				return nil
+			}
+		}
+	}
+}
+
 func (i *Interp) _display(c any, v any) gojq.Iter {
 	opts, err := OptionsFromValue(v)
 	if err != nil {
@@ -681,6 +745,74 @@ func (i *Interp) _hexdump(c any, v any) gojq.Iter {
 	return gojq.NewIter()
 }
 
+func (i *Interp) _dumpHTML(c any, v any) gojq.Iter {
+	opts, err := OptionsFromValue(v)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	dv, ok := c.(DecodeValue)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%+#v: not a decode value", c))
+	}
+	if err := dumpHTML(dv.DecodeValue(), i.EvalInstance.Output, opts); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return gojq.NewIter()
+}
+
+func (i *Interp) _byteMapSVG(c any, v any) gojq.Iter {
+	opts, err := OptionsFromValue(v)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	dv, ok := c.(DecodeValue)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%+#v: not a decode value", c))
+	}
+	if err := byteMapSVG(dv.DecodeValue(), i.EvalInstance.Output, opts); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return gojq.NewIter()
+}
+
+func (i *Interp) _bitDump(c any, v any) gojq.Iter {
+	opts, err := OptionsFromValue(v)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	dv, ok := c.(DecodeValue)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%+#v: not a decode value", c))
+	}
+	if err := bitDump(dv.DecodeValue(), i.EvalInstance.Output, opts); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return gojq.NewIter()
+}
+
+func (i *Interp) _browse(c any, v any) gojq.Iter {
+	opts, err := OptionsFromValue(v)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	dv, ok := c.(DecodeValue)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%+#v: not a decode value", c))
+	}
+	if err := browse(dv.DecodeValue(), i.OS.Stdin(), i.OS.Stdout(), opts); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return gojq.NewIter()
+}
+
 func (i *Interp) _printColorJSON(c any, v any) gojq.Iter {
 	opts, err := OptionsFromValue(v)
 	if err != nil {
@@ -1047,9 +1179,13 @@ type Options struct {
 	BitsFormat   string
 	LineBytes    int
 	DisplayBytes int
+	HexGroup     int
+	HexUpper     bool
+	SkipASCII    bool
 	Addrbase     int
 	Sizebase     int
 	SkipGaps     bool
+	UnitPrefix   bool
 
 	Decorator    Decorator
 	BitsFormatFn func(br bitio.ReaderAtSeeker) (any, error)
@@ -1065,6 +1201,7 @@ func OptionsFromValue(v any) (*Options, error) {
 	opts.Sizebase = mathx.Clamp(2, 36, opts.Sizebase)
 	opts.LineBytes = max(1, opts.LineBytes)
 	opts.DisplayBytes = max(0, opts.DisplayBytes)
+	opts.HexGroup = max(1, opts.HexGroup)
 	opts.Decorator = decoratorFromOptions(opts)
 	if fn, err := bitsFormatFnFromOptions(opts); err != nil {
 		return nil, err
@@ -2,6 +2,7 @@ package interp
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"strconv"
 	"unicode/utf8"
@@ -52,3 +53,83 @@ func previewValue(v any, df scalar.DisplayFormat, opts *Options) string {
 		panic(fmt.Sprintf("unreachable %v (%T)", v, v))
 	}
 }
+
+// scalarPreview is a scalar split into parts shown as "value unit (actual)"
+type scalarPreview struct {
+	// symbolic value, actual value or actual value with unit prefix
+	value  string
+	valueV any
+	// empty if no unit or if included in value
+	unit string
+	// empty if value is the actual value
+	actual string
+}
+
+func newScalarPreview(s scalar.Scalarable, opts *Options) scalarPreview {
+	actual := s.ScalarActual()
+	sym := s.ScalarSym()
+	df := s.ScalarDisplayFormat()
+	unit := s.ScalarUnit()
+
+	if sym != nil {
+		return scalarPreview{
+			value:  previewValue(sym, scalar.NumberDecimal, opts),
+			valueV: sym,
+			unit:   unit,
+			actual: previewValue(actual, df, opts),
+		}
+	}
+	if opts.UnitPrefix {
+		if prefixed, ok := previewPrefixed(actual, s.ScalarFlags(), unit); ok {
+			return scalarPreview{
+				value:  prefixed,
+				valueV: actual,
+				actual: previewValue(actual, df, opts),
+			}
+		}
+	}
+	return scalarPreview{
+		value:  previewValue(actual, df, opts),
+		valueV: actual,
+		unit:   unit,
+	}
+}
+
+// previewScalar formats scalar same as dump but without colors
+func previewScalar(s scalar.Scalarable, opts *Options) string {
+	sp := newScalarPreview(s, opts)
+	str := sp.value
+	if sp.unit != "" {
+		str += " " + sp.unit
+	}
+	if sp.actual != "" {
+		str += " (" + sp.actual + ")"
+	}
+	return str
+}
+
+var siPrefixes = []string{"k", "M", "G", "T", "P", "E"}
+
+// previewPrefixed formats integer v with a SI unit prefix if flags has
+// FlagPrefixSI, ex 594 MHz. Returns false if no prefix is used.
+func previewPrefixed(v any, flags scalar.Flags, unit string) (string, bool) {
+	vv, ok := v.(uint64)
+	if !ok || !flags.IsPrefixSI() {
+		return "", false
+	}
+	f := float64(vv)
+
+	prefix := ""
+	for _, p := range siPrefixes {
+		if f < 1000 {
+			break
+		}
+		f /= 1000
+		prefix = p
+	}
+	if prefix == "" {
+		return "", false
+	}
+
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64) + " " + prefix + unit, true
+}
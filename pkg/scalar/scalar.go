@@ -8,6 +8,7 @@ package scalar
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -25,6 +26,7 @@ type Scalarable interface {
 	ScalarDescription() string
 	ScalarFlags() Flags
 	ScalarDisplayFormat() DisplayFormat
+	ScalarUnit() string
 }
 
 type DisplayFormat int
@@ -54,12 +56,14 @@ func (df DisplayFormat) FormatBase() int {
 const (
 	FlagGap Flags = 1 << iota
 	FlagSynthetic
+	FlagPrefixSI
 )
 
 type Flags uint
 
 func (f Flags) IsGap() bool       { return f&FlagGap != 0 }
 func (f Flags) IsSynthetic() bool { return f&FlagSynthetic != 0 }
+func (f Flags) IsPrefixSI() bool  { return f&FlagPrefixSI != 0 }
 
 // TODO: todos
 // rename raw?
@@ -86,6 +90,9 @@ var BigIntOct = BigIntFn(func(s BigInt) (BigInt, error) { s.DisplayFormat = Numb
 var BigIntDec = BigIntFn(func(s BigInt) (BigInt, error) { s.DisplayFormat = NumberDecimal; return s, nil })
 var BigIntHex = BigIntFn(func(s BigInt) (BigInt, error) { s.DisplayFormat = NumberHex; return s, nil })
 
+// display using SI (1000) unit prefix, ex 594 MHz
+var UintPrefixSI = UintFn(func(s Uint) (Uint, error) { s.Flags |= FlagPrefixSI; return s, nil })
+
 func UintActualAdd(n int) UintActualFn {
 	// TODO: use math.Add/Sub?
 	return UintActualFn(func(a uint64) uint64 { return uint64(int64(a) + int64(n)) })
@@ -95,6 +102,95 @@ func SintActualAdd(n int) SintActualFn {
 	return SintActualFn(func(a int64) int64 { return a + int64(n) })
 }
 
+// UintFixedPoint map actual as a binary fixed-point number with fracBits fraction bits to sym.
+// Actual is kept as is so that the exact value can be round-tripped.
+func UintFixedPoint(fracBits int) UintFn {
+	return UintFn(func(s Uint) (Uint, error) {
+		s.Sym = math.Ldexp(float64(s.Actual), -fracBits)
+		return s, nil
+	})
+}
+
+// SintFixedPoint map actual as a binary fixed-point number with fracBits fraction bits to sym.
+// Actual is kept as is so that the exact value can be round-tripped.
+func SintFixedPoint(fracBits int) SintFn {
+	return SintFn(func(s Sint) (Sint, error) {
+		s.Sym = math.Ldexp(float64(s.Actual), -fracBits)
+		return s, nil
+	})
+}
+
+// UintFixedPointDecimal map actual as a decimal fixed-point number with decimals fraction digits
+// to sym, ex: 31270 with 5 decimals is 0.3127. Actual is kept as is so that the exact value can
+// be round-tripped.
+func UintFixedPointDecimal(decimals int) UintFn {
+	return UintFn(func(s Uint) (Uint, error) {
+		s.Sym = float64(s.Actual) / math.Pow10(decimals)
+		return s, nil
+	})
+}
+
+// SintFixedPointDecimal map actual as a decimal fixed-point number with decimals fraction digits
+// to sym. Actual is kept as is so that the exact value can be round-tripped.
+func SintFixedPointDecimal(decimals int) SintFn {
+	return SintFn(func(s Sint) (Sint, error) {
+		s.Sym = float64(s.Actual) / math.Pow10(decimals)
+		return s, nil
+	})
+}
+
+// number to transform, sym if set by a previous linear mapper otherwise actual
+func linearValue(sym any, actual any) any {
+	switch sym.(type) {
+	case uint64, int64, float64:
+		return sym
+	}
+	return actual
+}
+
+func linearScale(v any, n int64) any {
+	switch v := v.(type) {
+	case uint64:
+		if n >= 0 {
+			return v * uint64(n)
+		}
+		return int64(v) * n
+	case int64:
+		return v * n
+	case float64:
+		return v * float64(n)
+	}
+	return v
+}
+
+func linearOffset(v any, n int64) any {
+	switch v := v.(type) {
+	case uint64:
+		if n >= 0 {
+			return v + uint64(n)
+		}
+		if v >= uint64(-n) {
+			return v - uint64(-n)
+		}
+		return int64(v) + n
+	case int64:
+		return v + n
+	case float64:
+		return v + float64(n)
+	}
+	return v
+}
+
+// UintScale map actual, or sym from a previous UintScale/UintOffset, multiplied by n to sym
+func UintScale(n int64) UintFn {
+	return UintFn(func(s Uint) (Uint, error) { s.Sym = linearScale(linearValue(s.Sym, s.Actual), n); return s, nil })
+}
+
+// UintOffset map actual, or sym from a previous UintScale/UintOffset, plus n to sym
+func UintOffset(n int64) UintFn {
+	return UintFn(func(s Uint) (Uint, error) { s.Sym = linearOffset(linearValue(s.Sym, s.Actual), n); return s, nil })
+}
+
 func StrActualTrim(cutset string) StrActualFn {
 	return StrActualFn(func(a string) string { return strings.Trim(a, cutset) })
 }
@@ -257,6 +353,17 @@ func UintActualUnixTimeDescription(unit time.Duration, format string) UintFn {
 	return UintActualDateDescription(unixTimeEpochDate, unit, format)
 }
 
+// windows FILETIME is number of 100ns intervals since 1601-01-01, relative to unix epoch
+// to not overflow time.Duration
+const windowsFileTimeUnixEpochDiff = 116444736000000000
+
+func UintActualWindowsFileTimeDescription(format string) UintFn {
+	return UintFn(func(s Uint) (Uint, error) {
+		s.Description = unixTimeEpochDate.Add(time.Duration(int64(s.Actual)-windowsFileTimeUnixEpochDiff) * 100).Format(format)
+		return s, nil
+	})
+}
+
 func SintActualDateDescription(epoch time.Time, unit time.Duration, format string) SintFn {
 	return SintFn(func(s Sint) (Sint, error) {
 		s.Description = epoch.Add(time.Duration(s.Actual) * unit).Format(format)
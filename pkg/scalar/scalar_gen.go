@@ -29,6 +29,7 @@ func (s Any) ScalarSym() any                     { return s.Sym }
 func (s Any) ScalarDescription() string          { return s.Description }
 func (s Any) ScalarFlags() Flags                 { return s.Flags }
 func (s Any) ScalarDisplayFormat() DisplayFormat { return 0 }
+func (s Any) ScalarUnit() string                 { return "" }
 
 func AnyActual(v any) AnyMapper {
 	return AnyFn(func(s Any) (Any, error) { s.Actual = v; return s, nil })
@@ -226,6 +227,7 @@ func (s BigInt) ScalarSym() any                     { return s.Sym }
 func (s BigInt) ScalarDescription() string          { return s.Description }
 func (s BigInt) ScalarFlags() Flags                 { return s.Flags }
 func (s BigInt) ScalarDisplayFormat() DisplayFormat { return s.DisplayFormat }
+func (s BigInt) ScalarUnit() string                 { return "" }
 
 func BigIntActual(v *big.Int) BigIntMapper {
 	return BigIntFn(func(s BigInt) (BigInt, error) { s.Actual = v; return s, nil })
@@ -422,6 +424,7 @@ func (s BitBuf) ScalarSym() any                     { return s.Sym }
 func (s BitBuf) ScalarDescription() string          { return s.Description }
 func (s BitBuf) ScalarFlags() Flags                 { return s.Flags }
 func (s BitBuf) ScalarDisplayFormat() DisplayFormat { return 0 }
+func (s BitBuf) ScalarUnit() string                 { return "" }
 
 func BitBufActual(v bitio.ReaderAtSeeker) BitBufMapper {
 	return BitBufFn(func(s BitBuf) (BitBuf, error) { s.Actual = v; return s, nil })
@@ -618,6 +621,7 @@ func (s Bool) ScalarSym() any                     { return s.Sym }
 func (s Bool) ScalarDescription() string          { return s.Description }
 func (s Bool) ScalarFlags() Flags                 { return s.Flags }
 func (s Bool) ScalarDisplayFormat() DisplayFormat { return 0 }
+func (s Bool) ScalarUnit() string                 { return "" }
 
 func BoolActual(v bool) BoolMapper {
 	return BoolFn(func(s Bool) (Bool, error) { s.Actual = v; return s, nil })
@@ -800,6 +804,7 @@ type Flt struct {
 	Description string
 	Flags       Flags
 	Actual      float64
+	Unit        string
 }
 
 // interp.Scalarable
@@ -814,6 +819,7 @@ func (s Flt) ScalarSym() any                     { return s.Sym }
 func (s Flt) ScalarDescription() string          { return s.Description }
 func (s Flt) ScalarFlags() Flags                 { return s.Flags }
 func (s Flt) ScalarDisplayFormat() DisplayFormat { return 0 }
+func (s Flt) ScalarUnit() string                 { return s.Unit }
 
 func FltActual(v float64) FltMapper {
 	return FltFn(func(s Flt) (Flt, error) { s.Actual = v; return s, nil })
@@ -824,6 +830,9 @@ func FltSym(v any) FltMapper {
 func FltDescription(v string) FltMapper {
 	return FltFn(func(s Flt) (Flt, error) { s.Description = v; return s, nil })
 }
+func FltUnit(v string) FltMapper {
+	return FltFn(func(s Flt) (Flt, error) { s.Unit = v; return s, nil })
+}
 
 type FltMapper interface {
 	MapFlt(Flt) (Flt, error)
@@ -997,6 +1006,7 @@ type Sint struct {
 	Flags         Flags
 	Actual        int64
 	DisplayFormat DisplayFormat
+	Unit          string
 }
 
 // interp.Scalarable
@@ -1011,6 +1021,7 @@ func (s Sint) ScalarSym() any                     { return s.Sym }
 func (s Sint) ScalarDescription() string          { return s.Description }
 func (s Sint) ScalarFlags() Flags                 { return s.Flags }
 func (s Sint) ScalarDisplayFormat() DisplayFormat { return s.DisplayFormat }
+func (s Sint) ScalarUnit() string                 { return s.Unit }
 
 func SintActual(v int64) SintMapper {
 	return SintFn(func(s Sint) (Sint, error) { s.Actual = v; return s, nil })
@@ -1021,6 +1032,9 @@ func SintSym(v any) SintMapper {
 func SintDescription(v string) SintMapper {
 	return SintFn(func(s Sint) (Sint, error) { s.Description = v; return s, nil })
 }
+func SintUnit(v string) SintMapper {
+	return SintFn(func(s Sint) (Sint, error) { s.Unit = v; return s, nil })
+}
 
 type SintMapper interface {
 	MapSint(Sint) (Sint, error)
@@ -1207,6 +1221,7 @@ func (s Str) ScalarSym() any                     { return s.Sym }
 func (s Str) ScalarDescription() string          { return s.Description }
 func (s Str) ScalarFlags() Flags                 { return s.Flags }
 func (s Str) ScalarDisplayFormat() DisplayFormat { return 0 }
+func (s Str) ScalarUnit() string                 { return "" }
 
 func StrActual(v string) StrMapper {
 	return StrFn(func(s Str) (Str, error) { s.Actual = v; return s, nil })
@@ -1390,6 +1405,7 @@ type Uint struct {
 	Flags         Flags
 	Actual        uint64
 	DisplayFormat DisplayFormat
+	Unit          string
 }
 
 // interp.Scalarable
@@ -1404,6 +1420,7 @@ func (s Uint) ScalarSym() any                     { return s.Sym }
 func (s Uint) ScalarDescription() string          { return s.Description }
 func (s Uint) ScalarFlags() Flags                 { return s.Flags }
 func (s Uint) ScalarDisplayFormat() DisplayFormat { return s.DisplayFormat }
+func (s Uint) ScalarUnit() string                 { return s.Unit }
 
 func UintActual(v uint64) UintMapper {
 	return UintFn(func(s Uint) (Uint, error) { s.Actual = v; return s, nil })
@@ -1414,6 +1431,9 @@ func UintSym(v any) UintMapper {
 func UintDescription(v string) UintMapper {
 	return UintFn(func(s Uint) (Uint, error) { s.Description = v; return s, nil })
 }
+func UintUnit(v string) UintMapper {
+	return UintFn(func(s Uint) (Uint, error) { s.Unit = v; return s, nil })
+}
 
 type UintMapper interface {
 	MapUint(Uint) (Uint, error)